@@ -1,22 +1,100 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"envie-backend/internal/accesslog"
+	"envie-backend/internal/accountdeletion"
+	"envie-backend/internal/alerts"
+	"envie-backend/internal/auditstream"
 	"envie-backend/internal/auth"
+	"envie-backend/internal/authcache"
+	"envie-backend/internal/config"
+	"envie-backend/internal/configsign"
+	"envie-backend/internal/crypto"
 	"envie-backend/internal/database"
+	"envie-backend/internal/errorreport"
+	"envie-backend/internal/grpcapi"
 	"envie-backend/internal/handlers"
+	"envie-backend/internal/keypolicy"
 	"envie-backend/internal/middleware"
+	"envie-backend/internal/redact"
+	"envie-backend/internal/router"
+	"envie-backend/internal/settings"
 	"envie-backend/internal/storage"
+	"envie-backend/internal/tracing"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Version info (set at build time via ldflags)
+var (
+	version = "dev"
+	commit  = "unknown"
 )
 
 func main() {
-	if err := godotenv.Load(); err != nil {
+	// Everything logged goes through the redaction filter, including gin's request
+	// log and GORM's query log
+	log.SetOutput(redact.NewWriter(os.Stderr))
+	gin.DefaultWriter = redact.NewWriter(os.Stdout)
+	gin.DefaultErrorWriter = redact.NewWriter(os.Stderr)
+
+	configFile := flag.String("config", os.Getenv(config.FileEnv), "YAML or TOML config file; the environment and .env take precedence over it")
+	flag.Parse()
+
+	if err := settings.LoadDotenv(); err != nil {
 		log.Println("No .env file found, relying on system env vars")
 	}
+	if *configFile != "" {
+		if err := settings.LoadConfigFile(*configFile); err != nil {
+			log.Fatalf("Invalid config file: %v", err)
+		}
+		log.Printf("Loaded config file %s", *configFile)
+	}
+	if err := config.Validate(os.Getenv); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if _, err := settings.Init(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	settings.ReloadOnSignal()
+
+	reporter, err := errorreport.FromEnv(version, commit)
+	if err != nil {
+		log.Fatalf("Invalid SENTRY_DSN: %v", err)
+	}
+	if reporter != nil {
+		log.Printf("Reporting errors for release %s (%s)", version, commit)
+	}
+
+	provider, err := tracing.FromEnv(version)
+	if err != nil {
+		log.Fatalf("Invalid tracing configuration: %v", err)
+	}
+	if provider != nil {
+		tracing.SetTracerProvider(provider)
+		log.Println("Exporting traces over OTLP")
+	}
+
+	if ttl, err := authcache.ConfigureFromEnv(); err != nil {
+		log.Fatalf("Invalid cache configuration: %v", err)
+	} else if ttl > 0 {
+		log.Printf("Caching authorization lookups for %s", ttl)
+	}
+
+	configureTokens()
+	configureChecksums()
+	configureConfigSigning()
 
 	database.Connect()
 	auth.InitOAuth()
@@ -25,142 +103,203 @@ func main() {
 		log.Fatalf("Failed to initialize S3 storage: %v", err)
 	}
 	log.Println("S3 storage initialized successfully")
+	log.Printf("Using %s crypto provider", crypto.CurrentProvider().Name())
 
-	r := gin.Default()
+	middleware.StartIdempotencyKeyPurge(time.Hour)
+	auth.StartLinkingCodeFailurePurge(time.Hour)
+	handlers.StartFileUploadPurge(time.Hour)
+	handlers.StartReadEventPrune(time.Hour)
+	handlers.StartConfigTrashPurge(time.Hour)
+	handlers.StartRotationReminders(5 * time.Minute)
+	startAlertEvaluator()
+	startKeyAgeChecker()
+	startAccessLogPruner()
+	startAuditStreamShipper()
+	startAccountPurger()
+	startGRPCServer()
 
-	// CORS Middleware
-	r.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
-		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Master-Key-Version")
+	router.Version, router.Commit = version, commit
+	r := router.New(reporter)
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
+	// SIGINT and SIGTERM stop accepting requests and let those in flight finish
+	// before the queued spans and error reports are flushed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		c.Next()
-	})
+	server := &http.Server{Addr: ":8080", Handler: router.Handler(r)}
+	served := make(chan error, 1)
+	go func() {
+		served <- server.ListenAndServe()
+	}()
+	log.Println("Listening and serving HTTP on :8080")
 
-	// Public routes
-	r.GET("/auth/login", handlers.AuthLogin)
-	r.GET("/auth/callback", handlers.AuthCallback)
-	r.GET("/auth/login/google", handlers.AuthLoginGoogle)
-	r.GET("/auth/callback/google", handlers.AuthCallbackGoogle)
-	r.POST("/auth/exchange", handlers.AuthExchange)
-	r.POST("/auth/refresh", handlers.AuthRefresh)
-	r.GET("/ping", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"message": "pong",
-		})
-	})
-	r.GET("/health", func(c *gin.Context) {
-		sqlDB, err := database.DB.DB()
-		if err != nil {
-			c.String(503, "Database connection unavailable")
-			return
+	select {
+	case err := <-served:
+		log.Printf("Failed to start HTTP server: %v", err)
+	case <-ctx.Done():
+		log.Println("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Failed to finish in-flight requests: %v", err)
 		}
-		if err := sqlDB.Ping(); err != nil {
-			c.String(503, "Database connection failed")
-			return
+		if provider != nil {
+			if err := provider.Shutdown(shutdownCtx); err != nil {
+				log.Printf("Failed to export the remaining spans: %v", err)
+			}
 		}
-		c.String(200, "OK")
+		reporter.Flush(5 * time.Second)
+	}
+}
+
+// shutdownTimeout bounds how long a shutdown waits for in-flight requests and the
+// span export
+const shutdownTimeout = 30 * time.Second
+
+// configureTokens checks the JWT signing keys and sets the token lifetimes from
+// ACCESS_TOKEN_LIFETIME and REFRESH_TOKEN_LIFETIME
+func configureTokens() {
+	keys, err := auth.SigningKeys()
+	if err != nil {
+		log.Fatalf("Invalid JWT configuration: %v", err)
+	}
+	lifetimes, err := auth.LifetimesFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid token configuration: %v", err)
+	}
+	auth.DefaultLifetimes = lifetimes
+	log.Printf("Access tokens %s, refresh tokens %s, %s", lifetimes.Access, lifetimes.Refresh, keys)
+}
+
+// configureChecksums sets how long version 1 config checksums are served next to
+// version 2 from LEGACY_CONFIG_CHECKSUMS_UNTIL
+func configureChecksums() {
+	until, err := handlers.LegacyChecksumsUntilFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid checksum configuration: %v", err)
+	}
+	handlers.LegacyChecksumsUntil = until
+	if time.Now().Before(until) {
+		log.Printf("Serving version 1 config checksums until %s", until.Format(time.DateOnly))
+	}
+}
+
+// configureConfigSigning sets the key CLI config responses are signed with from
+// CONFIG_SIGNING_KEY, and logs its public half for CLIs to pin
+func configureConfigSigning() {
+	signer, err := configsign.FromEnv()
+	if err != nil {
+		log.Fatalf("Invalid config signing key: %v", err)
+	}
+	if signer == nil {
+		log.Println("CONFIG_SIGNING_KEY not set, CLI configs are served unsigned")
+		return
+	}
+	configsign.Current = signer
+	log.Printf("Signing CLI configs with key %s, public key %s", signer.KeyID(), signer.PublicKey())
+}
+
+// startAlertEvaluator checks organization usage alerts every
+// ALERT_EVALUATION_INTERVAL, sending email through the SMTP_* settings in use
+func startAlertEvaluator() {
+	interval, err := alerts.IntervalFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid alert configuration: %v", err)
+	}
+	if interval == 0 {
+		log.Println("Organization alerts disabled")
+		return
+	}
+	if settings.Current().Email == nil {
+		log.Println("SMTP_HOST not set, email alerts will fail")
+	}
+	alerts.StartEvaluator(interval, &alerts.Channels{
+		EmailSource:  func() *alerts.EmailConfig { return settings.Current().Email },
+		EgressPolicy: settings.EgressPolicy,
 	})
+}
+
+// startKeyAgeChecker flags projects whose key outgrew its rotation policy every
+// KEY_AGE_CHECK_INTERVAL
+func startKeyAgeChecker() {
+	interval, err := keypolicy.IntervalFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid key age check configuration: %v", err)
+	}
+	if interval == 0 {
+		log.Println("Key age checks disabled")
+		return
+	}
+	keypolicy.StartChecker(interval, &alerts.Channels{EgressPolicy: settings.EgressPolicy})
+}
+
+// startAuditStreamShipper ships organizations' audit events to their SIEMs every
+// AUDIT_STREAM_INTERVAL
+func startAuditStreamShipper() {
+	interval, err := auditstream.IntervalFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid audit stream configuration: %v", err)
+	}
+	if interval == 0 {
+		log.Println("Audit streaming disabled")
+		return
+	}
+	auditstream.StartShipper(interval, settings.EgressPolicy)
+}
 
-	// Protected routes
-	authorized := r.Group("/")
-	authorized.Use(middleware.AuthMiddleware())
-	{
-		authorized.GET("/me", handlers.GetMe)
-		authorized.PUT("/me/public-key", handlers.SetPublicKey)
-		authorized.POST("/me/rotate-master-key", handlers.RotateMasterKey)
-		authorized.POST("/auth/logout", handlers.AuthLogout)
-
-		// Identity
-		authorized.POST("/devices", handlers.RegisterDevice)
-		authorized.GET("/devices", handlers.GetDevices)
-		authorized.DELETE("/devices", handlers.DeleteAllDevices)
-		authorized.DELETE("/devices/:id", handlers.DeleteDevice)
-		authorized.PUT("/devices/:id", handlers.UpdateDevice)
-
-		// Project Routes
-		authorized.POST("/projects", handlers.CreateProject)
-		authorized.GET("/projects", handlers.GetProjects)
-		authorized.GET("/projects/organization/:id", handlers.GetOrganizationProjects)
-		authorized.GET("/projects/:id", handlers.GetProject)
-		authorized.PUT("/projects/:id", handlers.UpdateProject)
-		// Config Items
-		authorized.GET("/projects/:id/config", handlers.GetConfigItems)
-		authorized.PUT("/projects/:id/config", handlers.SyncConfigItems)
-		authorized.DELETE("/projects/:id", handlers.DeleteProject)
-
-		// Secret Manager Configs
-		authorized.GET("/projects/:id/secret-managers", handlers.GetSecretManagerConfigs)
-		authorized.POST("/projects/:id/secret-managers", handlers.CreateSecretManagerConfig)
-		authorized.PUT("/projects/:id/secret-managers/:configId", handlers.UpdateSecretManagerConfig)
-		authorized.DELETE("/projects/:id/secret-managers/:configId", handlers.DeleteSecretManagerConfig)
-
-		// Project Access (Teams)
-		authorized.GET("/projects/:id/teams", handlers.GetProjectTeams)
-		authorized.POST("/projects/:id/teams", handlers.AddTeamToProject)
-
-		// Key Rotation
-		authorized.GET("/projects/:id/rotation", handlers.GetPendingRotation)
-		authorized.POST("/projects/:id/rotation", handlers.InitiateKeyRotation)
-		authorized.POST("/projects/:id/rotation/:rotationId/approve", handlers.ApproveKeyRotation)
-		authorized.POST("/projects/:id/rotation/:rotationId/reject", handlers.RejectKeyRotation)
-		authorized.DELETE("/projects/:id/rotation/:rotationId", handlers.CancelKeyRotation)
-		authorized.GET("/pending-rotations", handlers.GetUserPendingRotations)
-
-		// Project Tokens (CLI tokens for CI/CD)
-		authorized.POST("/projects/:id/tokens", handlers.CreateProjectToken)
-		authorized.GET("/projects/:id/tokens", handlers.GetProjectTokens)
-		authorized.DELETE("/projects/:id/tokens/:tokenId", handlers.DeleteProjectToken)
-
-		// Project Files
-		authorized.GET("/projects/:id/files", handlers.ListProjectFiles)
-		authorized.POST("/projects/:id/files", handlers.UploadProjectFile)
-		authorized.GET("/projects/:id/files/:fileId", handlers.DownloadProjectFile)
-		authorized.DELETE("/projects/:id/files/:fileId", handlers.DeleteProjectFile)
-		authorized.GET("/projects/:id/files-feks", handlers.GetProjectFilesForRotation)
-		authorized.PUT("/projects/:id/files-feks", handlers.UpdateFileFEKs)
-
-		// Organizations
-		authorized.POST("/organizations", handlers.CreateOrganization)
-		authorized.GET("/organizations", handlers.GetOrganizations)
-		authorized.GET("/organizations/:id", handlers.GetOrganization)
-		authorized.PUT("/organizations/:id", handlers.UpdateOrganization)
-		authorized.GET("/organizations/:id/users", handlers.GetOrganizationUsers)
-		authorized.POST("/organizations/:id/members", handlers.AddOrganizationMember)
-		authorized.PUT("/organizations/:id/members/:userId", handlers.UpdateOrganizationMember)
-		authorized.DELETE("/organizations/:id/members/:userId", handlers.RemoveOrganizationMember)
-
-		// Users
-		authorized.GET("/users/search", handlers.SearchUserByEmail)
-
-		// Teams
-		authorized.POST("/teams", handlers.CreateTeam)
-		authorized.GET("/teams", handlers.GetTeams)
-		authorized.GET("/teams/my", handlers.GetMyTeams)
-		authorized.PUT("/teams/:id/my-key", handlers.UpdateMyTeamKey)
-		authorized.GET("/teams/:id/members", handlers.GetTeamMembers)
-		authorized.POST("/teams/:id/members", handlers.AddTeamMember)
-		authorized.PUT("/teams/:id/members/:userId", handlers.UpdateTeamMember)
-		authorized.DELETE("/teams/:id/members/:userId", handlers.RemoveTeamMember)
-	}
-
-	cli := r.Group("/v1")
-	cli.Use(middleware.CLIAuthMiddleware())
-	{
-		cli.GET("/cli/verify", handlers.VerifyCLIIdentity)
-		cli.GET("/projects/:id/config", handlers.GetCLIProjectConfig)
-	}
-
-	err := r.Run(":8080")
+// startAccessLogPruner deletes access log entries past their organization's
+// retention every ACCESS_LOG_PRUNE_INTERVAL
+func startAccessLogPruner() {
+	interval, err := accesslog.PruneIntervalFromEnv()
 	if err != nil {
-		log.Println("Failed to start HTPP server")
+		log.Fatalf("Invalid access log configuration: %v", err)
+	}
+	if interval == 0 {
+		log.Println("Access log pruning disabled")
 		return
 	}
+	accesslog.StartPruner(interval)
+}
+
+// startAccountPurger erases the personal data of accounts deleted more than
+// ACCOUNT_DELETION_GRACE_PERIOD ago, checking hourly
+func startAccountPurger() {
+	gracePeriod, err := accountdeletion.GracePeriodFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid account deletion configuration: %v", err)
+	}
+	accountdeletion.GracePeriod = gracePeriod
+	accountdeletion.StartPurger(time.Hour)
+}
+
+// startGRPCServer serves the gRPC config API in the background.
+// It needs GRPC_TLS_CERT_FILE and GRPC_TLS_KEY_FILE; GRPC_INSECURE=true serves
+// plaintext instead, for local development or behind a TLS-terminating proxy.
+func startGRPCServer() {
+	addr := os.Getenv("GRPC_ADDR")
+	if addr == "" {
+		addr = ":9090"
+	}
+
+	var opts []grpc.ServerOption
+	certFile, keyFile := os.Getenv("GRPC_TLS_CERT_FILE"), os.Getenv("GRPC_TLS_KEY_FILE")
+	switch {
+	case certFile != "" && keyFile != "":
+		creds, err := credentials.NewServerTLSFromFile(certFile, keyFile)
+		if err != nil {
+			log.Fatalf("Failed to load gRPC TLS certificate: %v", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	case os.Getenv("GRPC_INSECURE") == "true":
+		log.Println("WARNING: gRPC server running without TLS")
+	default:
+		log.Println("gRPC server disabled: set GRPC_TLS_CERT_FILE and GRPC_TLS_KEY_FILE to enable it")
+		return
+	}
+
+	go func() {
+		if err := grpcapi.ListenAndServe(addr, opts...); err != nil {
+			log.Fatalf("gRPC server failed: %v", err)
+		}
+	}()
 }
@@ -0,0 +1,79 @@
+// Command seed creates a demo account in a local database, so the desktop app
+// and the CLI have something to work against without signing up first:
+//
+//	go run ./cmd/seed -email demo@example.com
+//
+// It refuses to run against a database that already has the email.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"envie-backend/internal/config"
+	"envie-backend/internal/database"
+	"envie-backend/internal/seed"
+	"envie-backend/internal/settings"
+)
+
+func main() {
+	var opts seed.Options
+	flag.StringVar(&opts.Email, "email", "demo@example.com", "email of the demo user")
+	flag.StringVar(&opts.Name, "name", "Demo User", "name of the demo user")
+	flag.StringVar(&opts.Organization, "organization", "Demo Organization", "name of the organization")
+	flag.StringVar(&opts.Project, "project", "Demo Project", "name of the project")
+	apiURL := flag.String("api-url", "http://localhost:8080", "API URL printed in the usage hints")
+	configFile := flag.String("config", os.Getenv(config.FileEnv), "YAML or TOML config file, as for the API")
+	flag.Parse()
+
+	if err := settings.LoadDotenv(); err != nil {
+		log.Println("No .env file found, relying on system env vars")
+	}
+	if *configFile != "" {
+		if err := settings.LoadConfigFile(*configFile); err != nil {
+			log.Fatalf("Invalid config file: %v", err)
+		}
+	}
+	if _, err := settings.Init(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	database.Connect()
+
+	result, err := seed.Run(database.DB, opts, time.Now())
+	if errors.Is(err, seed.ErrUserExists) {
+		fmt.Fprintf(os.Stderr, "%s already exists, pass -email to seed another user\n", opts.Email)
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Fatalf("Seeding failed: %v", err)
+	}
+
+	fmt.Printf(`Seeded %s with %d config items in %s / %s
+
+User          %s (%s)
+Organization  %s
+Project       %s (%s)
+
+Master key (paste into the desktop app to unlock, keep it local):
+  %s
+
+Linking code (POST /auth/exchange, expires %s):
+  %s
+
+CLI token (files.write, 90 days):
+  ENVIE_TOKEN=%s envie export --project %s --api-url %s
+`,
+		opts.Email, result.Items, opts.Organization, opts.Project,
+		result.UserID, opts.Email,
+		result.OrganizationID,
+		result.ProjectID, result.ProjectSlug,
+		result.MasterKey,
+		result.CodeExpires.Format(time.Kitchen), strings.ToUpper(result.LinkingCode),
+		result.Token, result.ProjectSlug, *apiURL,
+	)
+}
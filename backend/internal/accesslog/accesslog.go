@@ -0,0 +1,225 @@
+// Package accesslog records authenticated requests to organization resources
+// in the organization's access log.
+//
+// Organizations choose how much is kept (models.AccessLogFull, AccessLogMetadata
+// or AccessLogWrites) and for how long; the level applies to new entries and
+// the pruner deletes entries older than the retention.
+package accesslog
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/middleware"
+	"envie-backend/internal/models"
+	"envie-backend/internal/redact"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	pruneIntervalEnv = "ACCESS_LOG_PRUNE_INTERVAL"
+
+	defaultPruneInterval = time.Hour
+	maxUserAgentLen      = 255
+)
+
+// Levels lists the access log levels an organization can choose
+var Levels = []string{models.AccessLogFull, models.AccessLogMetadata, models.AccessLogWrites}
+
+// scope is the resource a route is about, found from its template
+type scope struct {
+	kind string // "organizations", "projects" or "teams"
+	id   uuid.UUID
+}
+
+// Middleware records each request after it was handled. Place it after the
+// authentication middleware; entries are written in the background so they
+// don't delay the response.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		entry, target, ok := newEntry(c)
+		if !ok {
+			return
+		}
+		// The handle the request ran against, even if database.DB is swapped
+		// before the entry is written
+		db := database.DB
+		go func() {
+			if err := record(db, entry, target); err != nil {
+				log.Printf("Failed to record access log entry: %v", err)
+			}
+		}()
+	}
+}
+
+// newEntry builds the full entry for a request, and finds the resource it is
+// about. ok is false for requests outside any organization.
+func newEntry(c *gin.Context) (*models.AccessLog, scope, bool) {
+	entry := &models.AccessLog{
+		Method: c.Request.Method,
+		Route:  c.FullPath(),
+		Status: c.Writer.Status(),
+	}
+	if entry.Route == "" {
+		return nil, scope{}, false // no route matched
+	}
+
+	var target scope
+	if token := middleware.GetCLIToken(c); token != nil {
+		// CLI routes may name the project by slug; the token is bound to one project
+		entry.TokenID = &token.ID
+		target = scope{kind: "projects", id: token.ProjectID}
+	} else if userID, ok := c.Get("user_id"); ok {
+		uid, ok := userID.(uuid.UUID)
+		if !ok {
+			return nil, scope{}, false
+		}
+		entry.UserID = &uid
+		if target, ok = routeScope(entry.Route, c.Param("id")); !ok {
+			return nil, scope{}, false
+		}
+	} else {
+		return nil, scope{}, false
+	}
+
+	path := redact.URL(c.Request.URL.RequestURI())
+	clientIP := middleware.ClientIP(c)
+	entry.Path, entry.ClientIP = &path, &clientIP
+	if userAgent := c.Request.UserAgent(); userAgent != "" {
+		if len(userAgent) > maxUserAgentLen {
+			userAgent = userAgent[:maxUserAgentLen]
+		}
+		entry.UserAgent = &userAgent
+	}
+	return entry, target, true
+}
+
+// routeScope finds the organization, project or team whose :id a route template
+// starts from, such as /v1/projects/:id/config or /projects/organization/:id
+func routeScope(route, id string) (scope, bool) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return scope{}, false
+	}
+
+	segments := strings.Split(strings.Trim(route, "/"), "/")
+	for i := 0; i+1 < len(segments); i++ {
+		if segments[i+1] != ":id" {
+			continue
+		}
+		switch segments[i] {
+		case "organizations", "organization":
+			return scope{kind: "organizations", id: parsed}, true
+		case "projects", "teams":
+			return scope{kind: segments[i], id: parsed}, true
+		}
+		return scope{}, false
+	}
+	return scope{}, false
+}
+
+// record resolves the organization of the entry and stores it at the level the
+// organization chose
+func record(db *gorm.DB, entry *models.AccessLog, target scope) error {
+	var org struct {
+		ID             uuid.UUID
+		AccessLogLevel string
+	}
+	query := db.Table("organizations").Select("organizations.id, organizations.access_log_level").
+		Where("organizations.deleted_at IS NULL")
+	switch target.kind {
+	case "organizations":
+		query = query.Where("organizations.id = ?", target.id)
+	case "projects":
+		query = query.Joins("JOIN projects ON projects.organization_id = organizations.id").Where("projects.id = ?", target.id)
+		entry.ProjectID = &target.id
+	case "teams":
+		query = query.Joins("JOIN teams ON teams.organization_id = organizations.id").Where("teams.id = ?", target.id)
+	}
+	if err := query.Limit(1).Scan(&org).Error; err != nil {
+		return err
+	}
+	if org.ID == uuid.Nil {
+		return nil // the resource doesn't exist, nobody's log to write to
+	}
+
+	if !applyLevel(org.AccessLogLevel, entry) {
+		return nil
+	}
+	entry.OrganizationID = org.ID
+	return db.Create(entry).Error
+}
+
+// applyLevel strips what the level leaves out of entry, and reports whether the
+// entry is kept at all
+func applyLevel(level string, entry *models.AccessLog) bool {
+	switch level {
+	case models.AccessLogMetadata:
+		entry.Path, entry.ClientIP, entry.UserAgent = nil, nil, nil
+	case models.AccessLogWrites:
+		switch entry.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return false
+		}
+	}
+	return true
+}
+
+// PruneIntervalFromEnv reads ACCESS_LOG_PRUNE_INTERVAL, a duration such as 1h.
+// Unset means hourly, 0 disables pruning.
+func PruneIntervalFromEnv() (time.Duration, error) {
+	value := os.Getenv(pruneIntervalEnv)
+	if value == "" {
+		return defaultPruneInterval, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval < 0 {
+		return 0, fmt.Errorf("invalid %s %q", pruneIntervalEnv, value)
+	}
+	return interval, nil
+}
+
+// StartPruner deletes entries past their organization's retention each interval
+// in the background
+func StartPruner(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := Prune(database.DB, time.Now()); err != nil {
+				log.Printf("Failed to prune access logs: %v", err)
+			}
+		}
+	}()
+}
+
+// Prune deletes the entries older than their organization's retention and
+// returns how many it deleted. It deletes once per retention in use rather
+// than joining organizations, which SQLite can't do in a DELETE.
+func Prune(db *gorm.DB, now time.Time) (int64, error) {
+	var retentions []int
+	if err := db.Model(&models.Organization{}).Unscoped().Distinct("access_log_retention_days").Pluck("access_log_retention_days", &retentions).Error; err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	for _, days := range retentions {
+		orgs := db.Model(&models.Organization{}).Unscoped().Select("id").Where("access_log_retention_days = ?", days)
+		result := db.Where("organization_id IN (?) AND created_at < ?", orgs, now.AddDate(0, 0, -days)).Delete(&models.AccessLog{})
+		if result.Error != nil {
+			return deleted, result.Error
+		}
+		deleted += result.RowsAffected
+	}
+	return deleted, nil
+}
@@ -0,0 +1,107 @@
+package accesslog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"envie-backend/internal/middleware"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestRouteScope(t *testing.T) {
+	id := uuid.New()
+	tests := []struct {
+		route string
+		kind  string
+	}{
+		{"/v1/organizations/:id/alerts", "organizations"},
+		{"/v1/projects/organization/:id", "organizations"},
+		{"/v1/projects/:id/config-items/:itemId", "projects"},
+		{"/v1/resources/projects/:id", "projects"},
+		{"/projects/:id/files", "projects"}, // legacy alias
+		{"/v1/teams/:id/members", "teams"},
+		{"/v1/devices/:id", ""},
+		{"/v1/me", ""},
+	}
+	for _, tt := range tests {
+		target, ok := routeScope(tt.route, id.String())
+		if ok != (tt.kind != "") || target.kind != tt.kind {
+			t.Errorf("%s: scope %q, ok %v, want %q", tt.route, target.kind, ok, tt.kind)
+		} else if ok && target.id != id {
+			t.Errorf("%s: id %s, want %s", tt.route, target.id, id)
+		}
+	}
+
+	if _, ok := routeScope("/v1/projects/:id", "my-api"); ok {
+		t.Error("slug accepted as a project ID")
+	}
+}
+
+func TestApplyLevel(t *testing.T) {
+	entry := func(method string) *models.AccessLog {
+		path, ip, ua := "/v1/projects/x/config", "10.0.0.1", "envie-cli"
+		return &models.AccessLog{Method: method, Path: &path, ClientIP: &ip, UserAgent: &ua}
+	}
+
+	if full := entry(http.MethodGet); !applyLevel(models.AccessLogFull, full) || full.Path == nil || full.ClientIP == nil {
+		t.Errorf("full level stripped the entry: %+v", full)
+	}
+
+	metadata := entry(http.MethodGet)
+	if !applyLevel(models.AccessLogMetadata, metadata) || metadata.Path != nil || metadata.ClientIP != nil || metadata.UserAgent != nil {
+		t.Errorf("metadata level kept details: %+v", metadata)
+	}
+
+	if applyLevel(models.AccessLogWrites, entry(http.MethodGet)) {
+		t.Error("writes level kept a read")
+	}
+	if write := entry(http.MethodPut); !applyLevel(models.AccessLogWrites, write) || write.ClientIP == nil {
+		t.Errorf("writes level dropped or stripped a write: %+v", write)
+	}
+}
+
+func TestNewEntry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	projectID, userID, tokenID := uuid.New(), uuid.New(), uuid.New()
+
+	r := gin.New()
+	var entry *models.AccessLog
+	var target scope
+	var ok bool
+	capture := func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+		entry, target, ok = newEntry(c)
+	}
+	r.GET("/v1/projects/:id/config", func(c *gin.Context) { c.Set("user_id", userID) }, capture)
+	r.GET("/v1/cli/projects/:id/config", func(c *gin.Context) {
+		c.Set(middleware.CLITokenContextKey, &models.ProjectToken{ID: tokenID, ProjectID: projectID})
+	}, capture)
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/projects/"+projectID.String()+"/config?token=secret", nil))
+	if !ok || target.kind != "projects" || target.id != projectID || *entry.UserID != userID || entry.Route != "/v1/projects/:id/config" {
+		t.Fatalf("user request: ok %v, target %+v, entry %+v", ok, target, entry)
+	}
+	if entry.Status != http.StatusNoContent || entry.Path == nil || *entry.Path == "/v1/projects/"+projectID.String()+"/config?token=secret" {
+		t.Errorf("path %v was not redacted, status %d", entry.Path, entry.Status)
+	}
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/cli/projects/my-api/config", nil))
+	if !ok || target.id != projectID || entry.TokenID == nil || *entry.TokenID != tokenID || entry.UserID != nil {
+		t.Errorf("CLI request by slug: ok %v, target %+v, entry %+v", ok, target, entry)
+	}
+}
+
+func TestPruneIntervalFromEnv(t *testing.T) {
+	t.Setenv(pruneIntervalEnv, "")
+	if interval, err := PruneIntervalFromEnv(); err != nil || interval != defaultPruneInterval {
+		t.Errorf("PruneIntervalFromEnv = %s, %v", interval, err)
+	}
+	t.Setenv(pruneIntervalEnv, "nope")
+	if _, err := PruneIntervalFromEnv(); err == nil {
+		t.Error("invalid interval accepted")
+	}
+}
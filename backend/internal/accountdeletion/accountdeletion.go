@@ -0,0 +1,126 @@
+// Package accountdeletion erases the personal data of deleted accounts once
+// their grace period is over.
+//
+// Deleting an account soft-deletes the user and removes their access right
+// away: memberships, devices and sessions. What is stored about them stays for
+// the grace period, during which signing in again restores the account. Purge
+// then erases it: the profile is anonymized rather than deleted, so the audit
+// and access logs of their organizations keep a consistent actor.
+package accountdeletion
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	gracePeriodEnv = "ACCOUNT_DELETION_GRACE_PERIOD"
+
+	defaultGracePeriod = 30 * 24 * time.Hour
+
+	// AnonymizedName replaces the name of a purged account
+	AnonymizedName = "Deleted user"
+)
+
+// GracePeriod is how long a deleted account can be restored before its personal
+// data is erased, set from ACCOUNT_DELETION_GRACE_PERIOD at startup
+var GracePeriod = defaultGracePeriod
+
+// GracePeriodFromEnv reads ACCOUNT_DELETION_GRACE_PERIOD, a duration such as
+// 720h. Unset means 30 days, 0 erases the data at the next purge.
+func GracePeriodFromEnv() (time.Duration, error) {
+	value := os.Getenv(gracePeriodEnv)
+	if value == "" {
+		return defaultGracePeriod, nil
+	}
+	gracePeriod, err := time.ParseDuration(value)
+	if err != nil || gracePeriod < 0 {
+		return 0, fmt.Errorf("invalid %s %q", gracePeriodEnv, value)
+	}
+	return gracePeriod, nil
+}
+
+// PurgeAt is when the data of an account deleted at deletedAt is erased, at the
+// latest one purge interval later
+func PurgeAt(deletedAt time.Time) time.Time {
+	return deletedAt.Add(GracePeriod)
+}
+
+// StartPurger erases the accounts past their grace period each interval in the
+// background
+func StartPurger(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := Purge(database.DB, time.Now()); err != nil {
+				log.Printf("Failed to purge deleted accounts: %v", err)
+			} else if n > 0 {
+				log.Printf("Purged %d deleted accounts", n)
+			}
+		}
+	}()
+}
+
+// Purge erases the personal data of the accounts deleted more than GracePeriod
+// before now and returns how many it erased
+func Purge(db *gorm.DB, now time.Time) (int64, error) {
+	var purged int64
+	err := database.Transaction(db, func(tx *gorm.DB) error {
+		due := tx.Unscoped().Model(&models.User{}).Select("id").
+			Where("deleted_at IS NOT NULL AND deleted_at <= ? AND purged_at IS NULL", now.Add(-GracePeriod))
+
+		for _, table := range []any{
+			&models.UserIdentity{},
+			&models.RefreshToken{},
+			&models.LinkingCode{},
+			&models.LinkingCodeFailure{},
+			&models.DevicePairing{},
+			&models.RecoveryCode{},
+			&models.TwoFactorEvent{},
+			&models.Notification{},
+			&models.IdempotencyKey{},
+			&models.UserSSOIdentity{},
+		} {
+			if err := tx.Unscoped().Where("user_id IN (?)", due).Delete(table).Error; err != nil {
+				return err
+			}
+		}
+
+		// The organizations keep the requests for their retention, without the
+		// client details
+		if err := tx.Model(&models.AccessLog{}).Where("user_id IN (?)", due).
+			Updates(map[string]any{"client_ip": nil, "user_agent": nil}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.AuditEvent{}).Where("actor_id IN (?) AND client_ip IS NOT NULL", due).
+			Update("client_ip", nil).Error; err != nil {
+			return err
+		}
+
+		// NULL provider IDs, as the unique indexes allow several of them
+		result := tx.Unscoped().Model(&models.User{}).
+			Where("deleted_at IS NOT NULL AND deleted_at <= ? AND purged_at IS NULL", now.Add(-GracePeriod)).
+			UpdateColumns(map[string]any{
+				"name":               AnonymizedName,
+				"email":              gorm.Expr("'deleted-' || id || '@deleted.invalid'"),
+				"avatar_url":         "",
+				"github_id":          nil,
+				"google_id":          nil,
+				"public_key":         nil,
+				"two_factor_enabled": false,
+				"totp_secret":        nil,
+				"purged_at":          now,
+			})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	return purged, err
+}
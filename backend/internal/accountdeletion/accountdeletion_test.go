@@ -0,0 +1,30 @@
+package accountdeletion
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGracePeriodFromEnv(t *testing.T) {
+	t.Setenv(gracePeriodEnv, "")
+	if gracePeriod, err := GracePeriodFromEnv(); err != nil || gracePeriod != defaultGracePeriod {
+		t.Errorf("GracePeriodFromEnv = %s, %v", gracePeriod, err)
+	}
+	t.Setenv(gracePeriodEnv, "0")
+	if gracePeriod, err := GracePeriodFromEnv(); err != nil || gracePeriod != 0 {
+		t.Errorf("GracePeriodFromEnv = %s, %v", gracePeriod, err)
+	}
+	for _, value := range []string{"-1h", "30d"} {
+		t.Setenv(gracePeriodEnv, value)
+		if _, err := GracePeriodFromEnv(); err == nil {
+			t.Errorf("%q accepted", value)
+		}
+	}
+}
+
+func TestPurgeAt(t *testing.T) {
+	deleted := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	if got, want := PurgeAt(deleted), time.Date(2026, 10, 31, 12, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("PurgeAt = %s, want %s", got, want)
+	}
+}
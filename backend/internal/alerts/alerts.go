@@ -0,0 +1,218 @@
+// Package alerts evaluates organization usage alerts on a schedule and notifies
+// their email address or webhook when a metric reaches its threshold.
+//
+// An alert fires once per crossing: it is marked triggered when notified and
+// re-armed only after the metric drops below the threshold again. The triggered
+// flag is claimed with a conditional update, so with several instances running
+// the evaluator each crossing is still notified once.
+package alerts
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	alertIntervalEnv = "ALERT_EVALUATION_INTERVAL"
+
+	defaultInterval = 5 * time.Minute
+
+	// failedAuthWindow is the period failed_auth counts over
+	failedAuthWindow = 24 * time.Hour
+
+	// twoFactorEventFailed matches handlers.TwoFactorEventFailed
+	twoFactorEventFailed = "failed"
+)
+
+// Metrics lists the valid alert metrics
+var Metrics = map[string]bool{
+	models.AlertMetricTokenCount:   true,
+	models.AlertMetricStorageBytes: true,
+	models.AlertMetricMemberCount:  true,
+	models.AlertMetricFailedAuth:   true,
+
+	models.AlertMetricTokenAnomalies: true,
+}
+
+// Notification is what a channel is told when an alert fires
+type Notification struct {
+	AlertID          uuid.UUID `json:"alertId"`
+	OrganizationID   uuid.UUID `json:"organizationId"`
+	OrganizationName string    `json:"organizationName"`
+	Metric           string    `json:"metric"`
+	Threshold        int64     `json:"threshold"`
+	Value            int64     `json:"value"`
+	TriggeredAt      time.Time `json:"triggeredAt"`
+}
+
+// Notifier delivers a notification to an alert's channel
+type Notifier interface {
+	Notify(alert *models.OrganizationAlert, n Notification) error
+}
+
+// IntervalFromEnv reads ALERT_EVALUATION_INTERVAL, a duration such as 5m. Unset
+// means every five minutes, 0 disables evaluation.
+func IntervalFromEnv() (time.Duration, error) {
+	value := os.Getenv(alertIntervalEnv)
+	if value == "" {
+		return defaultInterval, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval < 0 {
+		return 0, fmt.Errorf("invalid %s %q", alertIntervalEnv, value)
+	}
+	return interval, nil
+}
+
+// StartEvaluator evaluates every enabled alert each interval in the background
+func StartEvaluator(interval time.Duration, notifier Notifier) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := Evaluate(database.DB, notifier, time.Now()); err != nil {
+				log.Printf("Failed to evaluate organization alerts: %v", err)
+			}
+		}
+	}()
+}
+
+// Evaluate measures the metrics of all enabled alerts, notifies the ones that
+// crossed their threshold and re-arms the ones that dropped below it
+func Evaluate(db *gorm.DB, notifier Notifier, now time.Time) error {
+	var alerts []models.OrganizationAlert
+	err := db.Preload("Organization").
+		Where("enabled = ?", true).
+		Where("organization_id IN (?)", db.Model(&models.Organization{}).Select("id")).
+		Find(&alerts).Error
+	if err != nil {
+		return err
+	}
+
+	// Alerts on the same metric of an organization share one measurement
+	type measurement struct {
+		orgID  uuid.UUID
+		metric string
+	}
+	values := map[measurement]int64{}
+
+	for i := range alerts {
+		alert := &alerts[i]
+		key := measurement{alert.OrganizationID, alert.Metric}
+		value, ok := values[key]
+		if !ok {
+			var err error
+			if value, err = Measure(db, alert.OrganizationID, alert.Metric, now); err != nil {
+				log.Printf("Failed to measure %s for organization %s: %v", alert.Metric, alert.OrganizationID, err)
+				continue
+			}
+			values[key] = value
+		}
+		if err := evaluateAlert(db, notifier, alert, value, now); err != nil {
+			log.Printf("Failed to evaluate alert %s: %v", alert.ID, err)
+		}
+	}
+	return nil
+}
+
+// transition is what an evaluation does to an alert's triggered state
+type transition int
+
+const (
+	unchanged transition = iota
+	fire
+	rearm
+)
+
+func decide(alert *models.OrganizationAlert, value int64) transition {
+	switch {
+	case value >= alert.Threshold && !alert.Triggered:
+		return fire
+	case value < alert.Threshold && alert.Triggered:
+		return rearm
+	default:
+		return unchanged
+	}
+}
+
+func evaluateAlert(db *gorm.DB, notifier Notifier, alert *models.OrganizationAlert, value int64, now time.Time) error {
+	updates := map[string]any{"last_value": value, "last_evaluated_at": now}
+
+	switch decide(alert, value) {
+	case rearm:
+		updates["triggered"] = false
+	case fire:
+		// Claim the crossing first, so only one instance notifies it
+		claim := db.Model(&models.OrganizationAlert{}).
+			Where("id = ? AND triggered = ?", alert.ID, false).
+			Updates(map[string]any{"triggered": true, "last_triggered_at": now})
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 1 {
+			err := notifier.Notify(alert, Notification{
+				AlertID:          alert.ID,
+				OrganizationID:   alert.OrganizationID,
+				OrganizationName: alert.Organization.Name,
+				Metric:           alert.Metric,
+				Threshold:        alert.Threshold,
+				Value:            value,
+				TriggeredAt:      now,
+			})
+			if err != nil {
+				message := err.Error()
+				updates["last_notify_error"] = &message
+				log.Printf("Failed to notify alert %s: %v", alert.ID, err)
+			} else {
+				updates["last_notify_error"] = nil
+			}
+		}
+	}
+
+	return db.Model(&models.OrganizationAlert{}).Where("id = ?", alert.ID).Updates(updates).Error
+}
+
+// Measure returns the current value of metric for an organization. Sandbox
+// projects hold test data, so their tokens and files are left out.
+func Measure(db *gorm.DB, orgID uuid.UUID, metric string, now time.Time) (int64, error) {
+	var value int64
+	var err error
+	switch metric {
+	case models.AlertMetricTokenCount:
+		err = db.Model(&models.ProjectToken{}).
+			Joins("JOIN projects ON projects.id = project_tokens.project_id AND projects.deleted_at IS NULL AND NOT projects.sandbox").
+			Where("projects.organization_id = ?", orgID).
+			Where("project_tokens.expires_at IS NULL OR project_tokens.expires_at > ?", now).
+			Count(&value).Error
+	case models.AlertMetricStorageBytes:
+		err = db.Model(&models.ProjectFile{}).
+			Select("COALESCE(SUM(project_files.size_bytes), 0)").
+			Joins("JOIN projects ON projects.id = project_files.project_id AND projects.deleted_at IS NULL AND NOT projects.sandbox").
+			Where("projects.organization_id = ?", orgID).
+			Scan(&value).Error
+	case models.AlertMetricMemberCount:
+		err = db.Model(&models.OrganizationUser{}).Where("organization_id = ?", orgID).Count(&value).Error
+	case models.AlertMetricFailedAuth:
+		err = db.Model(&models.TwoFactorEvent{}).
+			Joins("JOIN organization_users ON organization_users.user_id = two_factor_events.user_id").
+			Where("organization_users.organization_id = ?", orgID).
+			Where("two_factor_events.event = ? AND two_factor_events.created_at > ?", twoFactorEventFailed, now.Add(-failedAuthWindow)).
+			Count(&value).Error
+	case models.AlertMetricTokenAnomalies:
+		err = db.Model(&models.TokenAnomaly{}).
+			Joins("JOIN projects ON projects.id = token_anomalies.project_id AND projects.deleted_at IS NULL").
+			Where("token_anomalies.organization_id = ? AND token_anomalies.acknowledged_at IS NULL", orgID).
+			Count(&value).Error
+	default:
+		err = fmt.Errorf("unknown metric %q", metric)
+	}
+	return value, err
+}
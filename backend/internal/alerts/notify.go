@@ -0,0 +1,254 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"envie-backend/internal/egress"
+	"envie-backend/internal/models"
+)
+
+const (
+	smtpHostEnv     = "SMTP_HOST"
+	smtpPortEnv     = "SMTP_PORT"
+	smtpUsernameEnv = "SMTP_USERNAME"
+	smtpPasswordEnv = "SMTP_PASSWORD"
+	smtpFromEnv     = "SMTP_FROM"
+
+	webhookTimeout = 10 * time.Second
+	maxTargetLen   = 500
+)
+
+// EmailConfig is the SMTP server alert emails are sent through
+type EmailConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// EmailConfigFromEnv reads the SMTP_* variables, or returns nil when SMTP_HOST is
+// not set
+func EmailConfigFromEnv() (*EmailConfig, error) {
+	return EmailConfigFrom(os.Getenv)
+}
+
+// EmailConfigFrom is EmailConfigFromEnv reading variables through getenv
+func EmailConfigFrom(getenv func(string) string) (*EmailConfig, error) {
+	host := getenv(smtpHostEnv)
+	if host == "" {
+		return nil, nil
+	}
+	config := &EmailConfig{
+		Host:     host,
+		Port:     getenv(smtpPortEnv),
+		Username: getenv(smtpUsernameEnv),
+		Password: getenv(smtpPasswordEnv),
+		From:     getenv(smtpFromEnv),
+	}
+	if config.Port == "" {
+		config.Port = "587"
+	}
+	if _, err := mail.ParseAddress(config.From); err != nil {
+		return nil, fmt.Errorf("invalid %s %q", smtpFromEnv, config.From)
+	}
+	return config, nil
+}
+
+// Channels delivers notifications by email or webhook. Email alerts fail while
+// Email is nil.
+type Channels struct {
+	Email *EmailConfig
+	// EmailSource, when set, is asked for the SMTP server on every email instead
+	// of Email, so reloaded settings apply
+	EmailSource func() *EmailConfig
+
+	// EgressPolicy, when set, is asked for the rules webhooks are posted under on
+	// every connection. Without it only the built-in protections apply.
+	EgressPolicy func() *egress.Policy
+}
+
+// Notify sends n to the alert's target
+func (ch *Channels) Notify(alert *models.OrganizationAlert, n Notification) error {
+	switch alert.Channel {
+	case models.AlertChannelEmail:
+		return ch.sendEmail(alert.Target, n)
+	case models.AlertChannelWebhook:
+		return ch.sendWebhook(alert.Target, n)
+	default:
+		return fmt.Errorf("unknown channel %q", alert.Channel)
+	}
+}
+
+// ValidateTarget checks an alert target for its channel: an email address, or an
+// https URL for webhooks
+func ValidateTarget(channel, target string) error {
+	if len(target) > maxTargetLen {
+		return fmt.Errorf("target must be at most %d characters", maxTargetLen)
+	}
+	switch channel {
+	case models.AlertChannelEmail:
+		address, err := mail.ParseAddress(target)
+		if err != nil || address.Address != target {
+			return errors.New("target must be an email address")
+		}
+	case models.AlertChannelWebhook:
+		u, err := url.Parse(target)
+		if err != nil || u.Scheme != "https" || u.Hostname() == "" || u.User != nil {
+			return errors.New("target must be an https URL")
+		}
+	default:
+		return errors.New("channel must be email or webhook")
+	}
+	return nil
+}
+
+// describe is the one-line summary used as email subject and webhook text
+func describe(n Notification) string {
+	return fmt.Sprintf("Envie alert: %s %s is %s (threshold %s)",
+		n.OrganizationName, metricLabel(n.Metric), formatValue(n.Metric, n.Value), formatValue(n.Metric, n.Threshold))
+}
+
+func metricLabel(metric string) string {
+	switch metric {
+	case models.AlertMetricTokenCount:
+		return "CLI token count"
+	case models.AlertMetricStorageBytes:
+		return "file storage"
+	case models.AlertMetricMemberCount:
+		return "member count"
+	case models.AlertMetricFailedAuth:
+		return "failed 2FA attempts in the last 24 hours"
+	case models.AlertMetricTokenAnomalies:
+		return "unacknowledged token anomalies"
+	default:
+		return metric
+	}
+}
+
+func formatValue(metric string, value int64) string {
+	if metric != models.AlertMetricStorageBytes {
+		return fmt.Sprint(value)
+	}
+	const unit = 1024
+	if value < unit {
+		return fmt.Sprintf("%d B", value)
+	}
+	div, exp := int64(unit), 0
+	for n := value / unit; n >= unit && exp < 3; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(value)/float64(div), "KMGT"[exp])
+}
+
+func (ch *Channels) email() *EmailConfig {
+	if ch.EmailSource != nil {
+		return ch.EmailSource()
+	}
+	return ch.Email
+}
+
+// ErrEmailNotConfigured is returned for emails while no SMTP server is set
+var ErrEmailNotConfigured = errors.New("email delivery is not configured on the server")
+
+func (ch *Channels) sendEmail(to string, n Notification) error {
+	subject := describe(n)
+	body := fmt.Sprintf("%s\r\n\r\nOrganization: %s (%s)\r\nMetric: %s\r\nValue: %s\r\nThreshold: %s\r\nTriggered at: %s\r\n\r\n"+
+		"You will not be notified again until the value drops below the threshold.\r\n",
+		subject, n.OrganizationName, n.OrganizationID, n.Metric,
+		formatValue(n.Metric, n.Value), formatValue(n.Metric, n.Threshold), n.TriggeredAt.UTC().Format(time.RFC1123))
+	return ch.send(to, subject, body, n.TriggeredAt)
+}
+
+// SendEmail sends a plain text email through the SMTP server in use, failing with
+// ErrEmailNotConfigured when there is none
+func (ch *Channels) SendEmail(to, subject, body string) error {
+	return ch.send(to, subject, strings.ReplaceAll(body, "\n", "\r\n"), time.Now())
+}
+
+func (ch *Channels) send(to, subject, body string, date time.Time) error {
+	config := ch.email()
+	if config == nil {
+		return ErrEmailNotConfigured
+	}
+	// Subjects carry user input such as organization names; keep it from adding
+	// headers
+	subject = strings.NewReplacer("\r", " ", "\n", " ").Replace(subject)
+
+	message := strings.Join([]string{
+		"From: " + config.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + date.Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"",
+		body,
+	}, "\r\n")
+
+	var auth smtp.Auth
+	if config.Username != "" {
+		auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	}
+	from, _ := mail.ParseAddress(config.From)
+	return smtp.SendMail(net.JoinHostPort(config.Host, config.Port), auth, from.Address, []string{to}, []byte(message))
+}
+
+// webhookPayload is the JSON body posted to webhooks
+type webhookPayload struct {
+	Event string `json:"event"`
+	Text  string `json:"text"` // for chat webhooks such as Slack's
+	Notification
+}
+
+func (ch *Channels) sendWebhook(target string, n Notification) error {
+	return ch.PostWebhook(target, webhookPayload{Event: "organization.alert", Text: describe(n), Notification: n})
+}
+
+// PostWebhook posts payload as JSON to an https URL checked with ValidateTarget,
+// failing on connection errors and non-2xx responses
+func (ch *Channels) PostWebhook(target string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "envie-alerts")
+
+	resp, err := ch.webhookClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// webhookClient connects only where the egress policy allows, so a webhook can't
+// be pointed at services inside the deployment
+func (ch *Channels) webhookClient() *http.Client {
+	policy := ch.EgressPolicy
+	if policy == nil {
+		policy = func() *egress.Policy { return nil }
+	}
+	return egress.NewClient(webhookTimeout, policy)
+}
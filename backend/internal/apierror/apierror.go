@@ -0,0 +1,165 @@
+// Package apierror defines the machine-readable codes error responses carry.
+//
+// Every error body is {"error": "<message>", "code": "ENVIE_..."}. The message
+// is for people and may change; clients branch on the code, which is stable once
+// released. Specific codes name a condition a client can act on, such as a
+// stale rotation or a missing 2FA code; the rest get the generic code of their
+// HTTP status.
+package apierror
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Code is a stable, machine-readable error identifier
+type Code string
+
+// Generic codes, one per HTTP status
+const (
+	CodeBadRequest         Code = "ENVIE_BAD_REQUEST"
+	CodeUnauthorized       Code = "ENVIE_UNAUTHORIZED"
+	CodeForbidden          Code = "ENVIE_FORBIDDEN"
+	CodeNotFound           Code = "ENVIE_NOT_FOUND"
+	CodeConflict           Code = "ENVIE_CONFLICT"
+	CodeGone               Code = "ENVIE_GONE"
+	CodePreconditionFailed Code = "ENVIE_PRECONDITION_FAILED"
+	CodePayloadTooLarge    Code = "ENVIE_PAYLOAD_TOO_LARGE"
+	CodeUnprocessable      Code = "ENVIE_UNPROCESSABLE"
+	CodeUpgradeRequired    Code = "ENVIE_UPGRADE_REQUIRED"
+	CodeTooManyRequests    Code = "ENVIE_TOO_MANY_REQUESTS"
+	CodeInternal           Code = "ENVIE_INTERNAL"
+	CodeNotImplemented     Code = "ENVIE_NOT_IMPLEMENTED"
+	CodeBadGateway         Code = "ENVIE_BAD_GATEWAY"
+	CodeUnavailable        Code = "ENVIE_UNAVAILABLE"
+	CodeGatewayTimeout     Code = "ENVIE_GATEWAY_TIMEOUT"
+)
+
+// Specific codes
+const (
+	CodeProjectNotFound     Code = "ENVIE_PROJECT_NOT_FOUND"
+	CodeProjectAccessDenied Code = "ENVIE_PROJECT_ACCESS_DENIED"
+	CodePermissionDenied    Code = "ENVIE_PERMISSION_DENIED" // the role lacks a permission
+	CodeNotOrgMember        Code = "ENVIE_NOT_ORGANIZATION_MEMBER"
+	CodeProjectInUse        Code = "ENVIE_PROJECT_IN_USE" // deleting needs confirmation
+
+	CodeTokenMissing       Code = "ENVIE_TOKEN_MISSING"
+	CodeTokenInvalid       Code = "ENVIE_TOKEN_INVALID"
+	CodeTokenExpired       Code = "ENVIE_TOKEN_EXPIRED"
+	CodeTokenAddressDenied Code = "ENVIE_TOKEN_ADDRESS_DENIED"
+	CodeRefreshTokenReused Code = "ENVIE_REFRESH_TOKEN_REUSED"
+
+	CodeTwoFactorRequired        Code = "ENVIE_TWO_FACTOR_REQUIRED"
+	CodeTwoFactorInvalid         Code = "ENVIE_TWO_FACTOR_INVALID"
+	CodeSSORequired              Code = "ENVIE_SSO_REQUIRED"
+	CodeAccountDisabled          Code = "ENVIE_ACCOUNT_DISABLED"
+	CodeIPNotAllowed             Code = "ENVIE_IP_NOT_ALLOWED"
+	CodeDeviceChallengeRequired  Code = "ENVIE_DEVICE_CHALLENGE_REQUIRED"
+	CodeAPIVersionUnsupported    Code = "ENVIE_API_VERSION_UNSUPPORTED"
+	CodeIdempotencyKeyReused     Code = "ENVIE_IDEMPOTENCY_KEY_REUSED"
+	CodeIdempotencyKeyInProgress Code = "ENVIE_IDEMPOTENCY_KEY_IN_PROGRESS"
+
+	CodeRotationPending Code = "ENVIE_ROTATION_PENDING"
+	CodeRotationStale   Code = "ENVIE_ROTATION_STALE"
+	CodeRotationExpired Code = "ENVIE_ROTATION_EXPIRED"
+	CodeFileTooLarge    Code = "ENVIE_FILE_TOO_LARGE"
+	CodeStorageQuota    Code = "ENVIE_STORAGE_QUOTA_EXCEEDED"
+	CodePlanLimit       Code = "ENVIE_PLAN_LIMIT_REACHED" // 402, a usage limit of the instance or the organization's plan
+
+	CodeValidationFailed Code = "ENVIE_VALIDATION_FAILED" // the body is malformed or breaks a field rule; see "fields"
+)
+
+var statusCodes = map[int]Code{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusConflict:              CodeConflict,
+	http.StatusGone:                  CodeGone,
+	http.StatusPreconditionFailed:    CodePreconditionFailed,
+	http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	http.StatusUnprocessableEntity:   CodeUnprocessable,
+	http.StatusUpgradeRequired:       CodeUpgradeRequired,
+	http.StatusTooManyRequests:       CodeTooManyRequests,
+	http.StatusInternalServerError:   CodeInternal,
+	http.StatusNotImplemented:        CodeNotImplemented,
+	http.StatusBadGateway:            CodeBadGateway,
+	http.StatusServiceUnavailable:    CodeUnavailable,
+	http.StatusGatewayTimeout:        CodeGatewayTimeout,
+}
+
+// ForStatus returns the generic code of an HTTP status
+func ForStatus(status int) Code {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// Error is an error with the status and code it is reported with
+type Error struct {
+	Status  int
+	Code    Code
+	Message string
+}
+
+func New(status int, code Code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is matches errors with the same code, so errors.Is(err, ErrProjectNotFound)
+// holds for a copy with another message
+func (e *Error) Is(target error) bool {
+	var other *Error
+	return errors.As(target, &other) && other.Code == e.Code
+}
+
+// Errors shared by the handlers and their helpers
+var (
+	ErrProjectNotFound     = New(http.StatusNotFound, CodeProjectNotFound, "Project not found")
+	ErrProjectAccessDenied = New(http.StatusForbidden, CodeProjectAccessDenied, "Access denied")
+)
+
+// CodeOf returns the code of err, or "" when it isn't an *Error
+func CodeOf(err error) Code {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return ""
+}
+
+// Body is the JSON body of an error response
+type Body struct {
+	Error string `json:"error"`
+	Code  Code   `json:"code"`
+}
+
+// H returns an error body with extra fields, for responses that carry more than
+// the message
+func H(code Code, message string, extra gin.H) gin.H {
+	body := gin.H{"error": message, "code": code}
+	for key, value := range extra {
+		body[key] = value
+	}
+	return body
+}
+
+// Respond writes err as the response
+func Respond(c *gin.Context, err *Error) {
+	c.JSON(err.Status, Body{Error: err.Message, Code: err.Code})
+}
+
+// Abort writes err as the response and stops the handler chain, for middleware
+func Abort(c *gin.Context, err *Error) {
+	c.AbortWithStatusJSON(err.Status, Body{Error: err.Message, Code: err.Code})
+}
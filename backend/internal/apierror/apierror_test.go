@@ -0,0 +1,60 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestForStatus(t *testing.T) {
+	tests := map[int]Code{
+		http.StatusNotFound:                CodeNotFound,
+		http.StatusConflict:                CodeConflict,
+		http.StatusInternalServerError:     CodeInternal,
+		http.StatusHTTPVersionNotSupported: CodeInternal,
+		http.StatusTeapot:                  CodeBadRequest,
+	}
+	for status, want := range tests {
+		if got := ForStatus(status); got != want {
+			t.Errorf("ForStatus(%d) = %s, want %s", status, got, want)
+		}
+	}
+}
+
+func TestErrorIsMatchesCode(t *testing.T) {
+	err := fmt.Errorf("loading: %w", New(http.StatusNotFound, CodeProjectNotFound, "Project 42 not found"))
+	if !errors.Is(err, ErrProjectNotFound) {
+		t.Error("wrapped error with the same code doesn't match")
+	}
+	if errors.Is(err, ErrProjectAccessDenied) {
+		t.Error("error matches another code")
+	}
+	if CodeOf(err) != CodeProjectNotFound || CodeOf(errors.New("plain")) != "" {
+		t.Errorf("CodeOf = %q, %q", CodeOf(err), CodeOf(errors.New("plain")))
+	}
+}
+
+func TestAbortWritesBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+
+	Abort(c, New(http.StatusConflict, CodeRotationStale, "Rotation is stale"))
+
+	var body Body
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusConflict || body.Code != CodeRotationStale || body.Error != "Rotation is stale" {
+		t.Errorf("response = %d %+v", w.Code, body)
+	}
+	if !c.IsAborted() {
+		t.Error("handler chain not aborted")
+	}
+}
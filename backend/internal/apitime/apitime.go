@@ -0,0 +1,95 @@
+// Package apitime is the timestamp type of the API. Responses carry UTC RFC 3339
+// timestamps, the same format encoding/json gives the UTC times read from the
+// database. Requests may also send the other formats clients commonly produce,
+// which are normalized to UTC, so a local time never reaches a timestamp column
+// that doesn't store its offset.
+package apitime
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Format is the layout of every timestamp in responses, always in UTC
+const Format = time.RFC3339Nano
+
+// layouts are the formats Parse accepts besides Format. Those without an offset
+// are read as UTC.
+var layouts = []string{
+	Format,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	time.RFC1123Z,
+	time.RFC1123,
+	"2006-01-02",
+}
+
+// Time is a timestamp in API requests and responses
+type Time struct {
+	time.Time
+}
+
+// New returns t for a response
+func New(t time.Time) Time {
+	return Time{t.UTC()}
+}
+
+// NewPtr returns t for a response, nil if t is nil
+func NewPtr(t *time.Time) *Time {
+	if t == nil {
+		return nil
+	}
+	v := New(*t)
+	return &v
+}
+
+// Ptr returns the time of t in UTC, nil if t is nil
+func (t *Time) Ptr() *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
+
+// Parse reads an RFC 3339 timestamp, with or without the T, fraction or offset;
+// an RFC 1123 date; or a bare date, at midnight. The result is in UTC.
+func Parse(value string) (time.Time, error) {
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use RFC 3339 such as %s", value, time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC).Format(Format))
+}
+
+func (t Time) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Time.UTC().Format(Format))
+}
+
+// UnmarshalJSON accepts the strings Parse accepts and Unix timestamps in seconds
+func (t *Time) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		seconds, err := strconv.ParseInt(string(data), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid time %s, use an RFC 3339 string or Unix seconds", data)
+		}
+		t.Time = time.Unix(seconds, 0).UTC()
+		return nil
+	}
+	parsed, err := Parse(value)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
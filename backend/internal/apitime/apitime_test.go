@@ -0,0 +1,63 @@
+package apitime
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestUnmarshalJSON(t *testing.T) {
+	want := time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)
+	for _, input := range []string{
+		`"2026-03-01T12:30:00Z"`,
+		`"2026-03-01T14:30:00+02:00"`,
+		`"2026-03-01T14:30:00+0200"`,
+		`"2026-03-01T12:30:00"`,
+		`"2026-03-01 12:30:00"`,
+		`"2026-03-01 07:30:00-05:00"`,
+		`"Sun, 01 Mar 2026 12:30:00 +0000"`,
+		`1772368200`,
+	} {
+		var got Time
+		if err := json.Unmarshal([]byte(input), &got); err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+		if !got.Equal(want) || got.Location() != time.UTC {
+			t.Errorf("%s = %v, want %v", input, got.Time, want)
+		}
+	}
+
+	var date Time
+	if err := json.Unmarshal([]byte(`"2026-03-01"`), &date); err != nil || !date.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("date = %v, %v", date.Time, err)
+	}
+
+	for _, input := range []string{`"tomorrow"`, `"01/03/2026"`, `true`} {
+		var got Time
+		if err := json.Unmarshal([]byte(input), &got); err == nil {
+			t.Errorf("%s accepted as %v", input, got.Time)
+		}
+	}
+
+	var request struct {
+		ExpiresAt *Time `json:"expiresAt"`
+	}
+	if err := json.Unmarshal([]byte(`{"expiresAt": null}`), &request); err != nil || request.ExpiresAt != nil {
+		t.Errorf("null = %v, %v", request.ExpiresAt, err)
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	prague := time.FixedZone("CET", 3600)
+	body, err := json.Marshal(struct {
+		At    Time  `json:"at"`
+		Never *Time `json:"never"`
+	}{At: Time{time.Date(2026, 3, 1, 13, 30, 0, 500_000_000, prague)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(body), `{"at":"2026-03-01T12:30:00.5Z","never":null}`; got != want {
+		t.Errorf("body = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,220 @@
+// Package auditstream ships organizations' audit events to their SIEM: POSTed
+// to an HTTPS endpoint, sent to a syslog server over TLS, or written to an S3
+// bucket. Events are encoded as NDJSON, one models.AuditEvent per line, and
+// HTTPS and S3 batches are signed with the stream's secret (see Sign).
+//
+// Each stream has a cursor, the last event shipped. An instance leases a stream
+// before shipping it, so with several instances running each batch is sent by
+// one of them; a batch that fails is retried at the next run. Delivery is at
+// least once: an instance stopping between sending a batch and moving the
+// cursor sends it again, and receivers can drop duplicates by event ID.
+package auditstream
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/egress"
+	"envie-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	intervalEnv = "AUDIT_STREAM_INTERVAL"
+
+	defaultInterval = time.Minute
+
+	// BatchSize is the most events sent at once; a run sends up to maxBatches
+	BatchSize  = 500
+	maxBatches = 20
+
+	// settleDelay leaves recent events for the next run, so an event whose
+	// transaction commits after a later one's is not skipped by the cursor
+	settleDelay = 10 * time.Second
+
+	leaseDuration = 5 * time.Minute
+	sendTimeout   = 30 * time.Second
+)
+
+// Batch is a run of consecutive events of one organization
+type Batch struct {
+	Events    []models.AuditEvent
+	Body      []byte // NDJSON
+	Timestamp int64  // Unix seconds, signed with the body
+	Signature string
+}
+
+// Sink delivers batches to a stream's destination
+type Sink interface {
+	Send(ctx context.Context, batch *Batch) error
+}
+
+// SinkFactory opens the sink of a stream
+type SinkFactory func(stream *models.AuditStream) (Sink, error)
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>" keyed by secret,
+// sent as v1=<signature> with the timestamp so receivers can refuse replays
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Encode renders events as NDJSON
+func Encode(events []models.AuditEvent) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for i := range events {
+		if err := encoder.Encode(&events[i]); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// IntervalFromEnv reads AUDIT_STREAM_INTERVAL, a duration such as 1m. Unset
+// means every minute, 0 disables streaming.
+func IntervalFromEnv() (time.Duration, error) {
+	value := os.Getenv(intervalEnv)
+	if value == "" {
+		return defaultInterval, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval < 0 {
+		return 0, fmt.Errorf("invalid %s %q", intervalEnv, value)
+	}
+	return interval, nil
+}
+
+// StartShipper ships every enabled stream each interval in the background,
+// connecting only where the egress policy allows
+func StartShipper(interval time.Duration, policy func() *egress.Policy) {
+	sinks := func(stream *models.AuditStream) (Sink, error) {
+		return NewSink(stream, policy)
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := Ship(database.DB, sinks, time.Now()); err != nil {
+				log.Printf("Failed to ship audit streams: %v", err)
+			}
+		}
+	}()
+}
+
+// Ship sends the new events of every enabled stream
+func Ship(db *gorm.DB, sinks SinkFactory, now time.Time) error {
+	var streams []models.AuditStream
+	if err := db.Where("enabled = ?", true).
+		Where("organization_id IN (?)", db.Model(&models.Organization{}).Select("id")).
+		Find(&streams).Error; err != nil {
+		return err
+	}
+
+	for i := range streams {
+		if err := shipStream(db, sinks, &streams[i], now); err != nil {
+			log.Printf("Failed to ship the audit stream of organization %s: %v", streams[i].OrganizationID, err)
+		}
+	}
+	return nil
+}
+
+func shipStream(db *gorm.DB, sinks SinkFactory, stream *models.AuditStream, now time.Time) error {
+	claim := db.Model(&models.AuditStream{}).
+		Where("organization_id = ? AND (lease_ends IS NULL OR lease_ends < ?)", stream.OrganizationID, now).
+		Update("lease_ends", now.Add(leaseDuration))
+	if claim.Error != nil || claim.RowsAffected == 0 {
+		return claim.Error
+	}
+	defer db.Model(&models.AuditStream{}).Where("organization_id = ?", stream.OrganizationID).Update("lease_ends", nil)
+
+	sink, err := sinks(stream)
+	if err != nil {
+		return recordFailure(db, stream, err, now)
+	}
+
+	for range maxBatches {
+		events, err := nextEvents(db, stream, now)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+
+		batch, err := newBatch(stream.SigningSecret, events, now)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err = sink.Send(ctx, batch)
+		cancel()
+		if err != nil {
+			return recordFailure(db, stream, err, now)
+		}
+
+		last := events[len(events)-1]
+		stream.CursorAt, stream.CursorID = last.CreatedAt, last.ID
+		if err := db.Model(&models.AuditStream{}).Where("organization_id = ?", stream.OrganizationID).Updates(map[string]any{
+			"cursor_at":       last.CreatedAt,
+			"cursor_id":       last.ID,
+			"last_shipped_at": now,
+			"last_error":      nil,
+			"last_error_at":   nil,
+		}).Error; err != nil {
+			return err
+		}
+		if len(events) < BatchSize {
+			return nil
+		}
+	}
+	return nil
+}
+
+// nextEvents returns the events after the stream's cursor, oldest first
+func nextEvents(db *gorm.DB, stream *models.AuditStream, now time.Time) ([]models.AuditEvent, error) {
+	query := db.Where("organization_id = ?", stream.OrganizationID).
+		Where("(created_at, id) > (?, ?)", stream.CursorAt, stream.CursorID).
+		Where("created_at <= ?", now.Add(-settleDelay))
+	if !stream.IncludeReads {
+		query = query.Where("action NOT IN ?", models.AuditReadActions)
+	}
+	var events []models.AuditEvent
+	err := query.Order("created_at, id").Limit(BatchSize).Find(&events).Error
+	return events, err
+}
+
+func newBatch(secret string, events []models.AuditEvent, now time.Time) (*Batch, error) {
+	body, err := Encode(events)
+	if err != nil {
+		return nil, err
+	}
+	timestamp := now.Unix()
+	return &Batch{
+		Events:    events,
+		Body:      body,
+		Timestamp: timestamp,
+		Signature: Sign(secret, timestamp, body),
+	}, nil
+}
+
+func recordFailure(db *gorm.DB, stream *models.AuditStream, cause error, now time.Time) error {
+	message := cause.Error()
+	if err := db.Model(&models.AuditStream{}).Where("organization_id = ?", stream.OrganizationID).Updates(map[string]any{
+		"last_error":    message,
+		"last_error_at": now,
+	}).Error; err != nil {
+		return err
+	}
+	return cause
+}
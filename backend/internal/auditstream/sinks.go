@@ -0,0 +1,225 @@
+package auditstream
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"envie-backend/internal/egress"
+	"envie-backend/internal/models"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	// TimestampHeader and SignatureHeader carry the signature of HTTPS batches;
+	// S3 objects carry them as envie-timestamp and envie-signature metadata
+	TimestampHeader = "X-Envie-Timestamp"
+	SignatureHeader = "X-Envie-Signature"
+
+	ndjsonType   = "application/x-ndjson"
+	maxURLLength = 500
+
+	// syslogPriority is facility 13 (log audit) at severity 6 (informational)
+	syslogPriority = 13*8 + 6
+)
+
+// Validate checks the destination settings of a stream
+func Validate(stream *models.AuditStream) error {
+	switch stream.Destination {
+	case models.AuditStreamHTTPS:
+		return validateHTTPSURL("url", stream.URL)
+	case models.AuditStreamSyslog:
+		host, port, err := net.SplitHostPort(stream.Address)
+		if err != nil || host == "" {
+			return errors.New("address must be host:port")
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return errors.New("address has an invalid port")
+		}
+	case models.AuditStreamS3:
+		if stream.Bucket == "" {
+			return errors.New("bucket is required")
+		}
+		if stream.Region == "" {
+			return errors.New("region is required")
+		}
+		if stream.AccessKeyID == "" || stream.SecretAccessKey == "" {
+			return errors.New("accessKeyId and secretAccessKey are required")
+		}
+		if stream.Endpoint != "" {
+			return validateHTTPSURL("endpoint", stream.Endpoint)
+		}
+	default:
+		return errors.New("destination must be https, syslog or s3")
+	}
+	return nil
+}
+
+func validateHTTPSURL(field, value string) error {
+	if len(value) > maxURLLength {
+		return fmt.Errorf("%s must be at most %d characters", field, maxURLLength)
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" || u.User != nil {
+		return fmt.Errorf("%s must be an https URL", field)
+	}
+	return nil
+}
+
+// Host is the host a stream connects to, for checking against the egress
+// policy when it's configured
+func Host(stream *models.AuditStream) string {
+	switch stream.Destination {
+	case models.AuditStreamHTTPS:
+		if u, err := url.Parse(stream.URL); err == nil {
+			return u.Hostname()
+		}
+	case models.AuditStreamSyslog:
+		if host, _, err := net.SplitHostPort(stream.Address); err == nil {
+			return host
+		}
+	case models.AuditStreamS3:
+		if stream.Endpoint == "" {
+			return "s3." + stream.Region + ".amazonaws.com"
+		}
+		if u, err := url.Parse(stream.Endpoint); err == nil {
+			return u.Hostname()
+		}
+	}
+	return ""
+}
+
+// NewSink opens the destination of a valid stream, connecting only where the
+// egress policy allows
+func NewSink(stream *models.AuditStream, policy func() *egress.Policy) (Sink, error) {
+	switch stream.Destination {
+	case models.AuditStreamHTTPS:
+		return &httpsSink{url: stream.URL, client: egress.NewClient(sendTimeout, policy)}, nil
+	case models.AuditStreamSyslog:
+		return &syslogSink{address: stream.Address, dial: egress.NewDialer(sendTimeout, policy)}, nil
+	case models.AuditStreamS3:
+		client := s3.New(s3.Options{
+			Region:      stream.Region,
+			Credentials: credentials.NewStaticCredentialsProvider(stream.AccessKeyID, stream.SecretAccessKey, ""),
+			HTTPClient:  egress.NewClient(sendTimeout, policy),
+		}, func(o *s3.Options) {
+			if stream.Endpoint != "" {
+				o.BaseEndpoint = aws.String(stream.Endpoint)
+				o.UsePathStyle = true
+			}
+		})
+		return &s3Sink{client: client, bucket: stream.Bucket, prefix: stream.Prefix}, nil
+	default:
+		return nil, fmt.Errorf("unknown destination %q", stream.Destination)
+	}
+}
+
+type httpsSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *httpsSink) Send(ctx context.Context, batch *Batch) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(batch.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ndjsonType)
+	req.Header.Set("User-Agent", "envie-audit-stream")
+	req.Header.Set(TimestampHeader, strconv.FormatInt(batch.Timestamp, 10))
+	req.Header.Set(SignatureHeader, "v1="+batch.Signature)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// syslogSink sends each event as an RFC 5424 message with the event's JSON as
+// its text, framed by octet counting (RFC 6587) over TLS. Messages aren't signed,
+// the server's certificate is verified instead.
+type syslogSink struct {
+	address string
+	dial    func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+func (s *syslogSink) Send(ctx context.Context, batch *Batch) error {
+	host, _, err := net.SplitHostPort(s.address)
+	if err != nil {
+		return err
+	}
+	raw, err := s.dial(ctx, "tcp", s.address)
+	if err != nil {
+		return err
+	}
+	conn := tls.Client(raw, &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return err
+	}
+
+	lines := bytes.Split(bytes.TrimSuffix(batch.Body, []byte("\n")), []byte("\n"))
+	var buf bytes.Buffer
+	for i, line := range lines {
+		message := SyslogMessage(&batch.Events[i], line)
+		fmt.Fprintf(&buf, "%d %s", len(message), message)
+	}
+	_, err = conn.Write(buf.Bytes())
+	return err
+}
+
+// SyslogMessage formats an event and its JSON as an RFC 5424 message
+func SyslogMessage(event *models.AuditEvent, eventJSON []byte) []byte {
+	header := fmt.Sprintf("<%d>1 %s envie envie - %s - ", syslogPriority, event.CreatedAt.UTC().Format(time.RFC3339Nano), event.Action)
+	return append([]byte(header), eventJSON...)
+}
+
+type s3Sink struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func (s *s3Sink) Send(ctx context.Context, batch *Batch) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(ObjectKey(s.prefix, batch)),
+		Body:        bytes.NewReader(batch.Body),
+		ContentType: aws.String(ndjsonType),
+		Metadata: map[string]string{
+			"envie-timestamp": strconv.FormatInt(batch.Timestamp, 10),
+			"envie-signature": "v1=" + batch.Signature,
+		},
+	})
+	return err
+}
+
+// ObjectKey names a batch's object by the day and time of its first event and
+// the ID of its last, so objects list in order: prefix/2025/01/31/<time>-<id>.ndjson
+func ObjectKey(prefix string, batch *Batch) string {
+	first := batch.Events[0].CreatedAt.UTC()
+	last := batch.Events[len(batch.Events)-1]
+	name := fmt.Sprintf("%s-%s.ndjson", first.Format("20060102T150405.000000000Z"), last.ID)
+	return path.Join(prefix, first.Format("2006/01/02"), name)
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"envie-backend/internal/crypto"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// A device proves it holds the private key of its public key before an exchange
+// binds the session to it. Device keys are X25519, which can't sign, so the
+// proof is decrypting: the challenge is a random nonce encrypted to the device
+// key, and the device answers with the nonce. The server keeps no state; the
+// challenge token carries hashes of the key and the nonce, signed.
+const DeviceChallengeDuration = 2 * time.Minute
+
+const (
+	tokenTypeDeviceChallenge TokenType = "device_challenge"
+
+	deviceChallengeNonceSize = 32
+)
+
+var (
+	ErrInvalidDeviceKey      = errors.New("device public key must be a base64 X25519 key")
+	ErrDeviceChallengeFailed = errors.New("device challenge failed")
+)
+
+// DeviceChallenge is handed to a device to prove it holds its private key
+type DeviceChallenge struct {
+	Token     string    `json:"challengeToken"` // returned with the answer
+	Challenge string    `json:"challenge"`      // the nonce encrypted to the device key
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type deviceChallengeClaims struct {
+	KeyHash   string    `json:"key_hash"`
+	NonceHash string    `json:"nonce_hash"`
+	TokenType TokenType `json:"token_type"`
+	jwt.RegisteredClaims
+}
+
+// deviceChallengeKey derives the challenge signing key from JWT_SECRET, so
+// challenge tokens and other tokens never verify each other
+func deviceChallengeKey() []byte {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("JWT_SECRET")))
+	mac.Write([]byte("envie device challenge v1"))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// NewDeviceChallenge returns a challenge for the device with the base64 X25519
+// public key publicKey
+func NewDeviceChallenge(publicKey string, now time.Time) (*DeviceChallenge, error) {
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != 32 {
+		return nil, ErrInvalidDeviceKey
+	}
+
+	nonce := make([]byte, deviceChallengeNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	challenge, err := crypto.EncryptToPublicKeyBase64(key, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := now.Add(DeviceChallengeDuration)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &deviceChallengeClaims{
+		KeyHash:   sha256Hex([]byte(publicKey)),
+		NonceHash: sha256Hex(nonce),
+		TokenType: tokenTypeDeviceChallenge,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}).SignedString(deviceChallengeKey())
+	if err != nil {
+		return nil, err
+	}
+	return &DeviceChallenge{Token: token, Challenge: challenge, ExpiresAt: expiresAt}, nil
+}
+
+// VerifyDeviceChallenge checks that answer, the base64 nonce decrypted by the
+// device, answers the challenge token issued for publicKey
+func VerifyDeviceChallenge(token, publicKey, answer string, now time.Time) error {
+	claims := &deviceChallengeClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return deviceChallengeKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(func() time.Time { return now }))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDeviceChallengeFailed, err)
+	}
+	if claims.TokenType != tokenTypeDeviceChallenge {
+		return fmt.Errorf("%w: invalid token type", ErrDeviceChallengeFailed)
+	}
+	if claims.KeyHash != sha256Hex([]byte(publicKey)) {
+		return fmt.Errorf("%w: issued for another device", ErrDeviceChallengeFailed)
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(answer)
+	if err != nil || subtle.ConstantTimeCompare([]byte(sha256Hex(nonce)), []byte(claims.NonceHash)) != 1 {
+		return fmt.Errorf("%w: wrong answer", ErrDeviceChallengeFailed)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"envie-backend/internal/crypto"
+
+	"github.com/google/uuid"
+)
+
+// newDeviceKey returns a device's X25519 private key and its base64 public key
+func newDeviceKey(t *testing.T) ([]byte, string) {
+	t.Helper()
+	private := make([]byte, 32)
+	if _, err := rand.Read(private); err != nil {
+		t.Fatal(err)
+	}
+	public, err := crypto.CurrentProvider().X25519PublicKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return private, base64.StdEncoding.EncodeToString(public)
+}
+
+// answerChallenge decrypts a challenge the way a device does
+func answerChallenge(t *testing.T, private []byte, challenge string) string {
+	t.Helper()
+	_, body, err := crypto.DecodeBlob(challenge, crypto.AlgX25519HKDF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := crypto.CurrentProvider()
+	shared, err := provider.X25519(private, body[:crypto.EphemeralPublicKeySize])
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := provider.HKDF(shared, []byte("envie-encrypt"), 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := aes.NewCipher(key)
+	gcm, _ := cipher.NewGCM(block)
+	ivEnd := crypto.EphemeralPublicKeySize + crypto.IVSize
+	nonce, err := gcm.Open(nil, body[crypto.EphemeralPublicKeySize:ivEnd], body[ivEnd:], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(nonce)
+}
+
+func TestDeviceChallenge(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	now := time.Now()
+	private, public := newDeviceKey(t)
+
+	challenge, err := NewDeviceChallenge(public, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer := answerChallenge(t, private, challenge.Challenge)
+	if err := VerifyDeviceChallenge(challenge.Token, public, answer, now); err != nil {
+		t.Fatalf("correct answer rejected: %v", err)
+	}
+
+	_, otherPublic := newDeviceKey(t)
+	tests := map[string]func() error{
+		"wrong answer": func() error {
+			return VerifyDeviceChallenge(challenge.Token, public, base64.StdEncoding.EncodeToString(make([]byte, 32)), now)
+		},
+		"other device": func() error {
+			return VerifyDeviceChallenge(challenge.Token, otherPublic, answer, now)
+		},
+		"expired": func() error {
+			return VerifyDeviceChallenge(challenge.Token, public, answer, now.Add(DeviceChallengeDuration+time.Second))
+		},
+		"no challenge": func() error {
+			return VerifyDeviceChallenge("", public, answer, now)
+		},
+		"access token": func() error {
+			token, _ := GenerateAccessToken(uuid.New(), uuid.New(), time.Hour)
+			return VerifyDeviceChallenge(token, public, answer, now)
+		},
+	}
+	for name, verify := range tests {
+		if err := verify(); !errors.Is(err, ErrDeviceChallengeFailed) {
+			t.Errorf("%s: err = %v, want ErrDeviceChallengeFailed", name, err)
+		}
+	}
+
+	if _, err := NewDeviceChallenge("not a key", now); !errors.Is(err, ErrInvalidDeviceKey) {
+		t.Errorf("invalid key: err = %v", err)
+	}
+}
@@ -4,38 +4,35 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
-const (
-	AccessTokenDuration  = 1 * time.Hour
-	RefreshTokenDuration = 30 * 24 * time.Hour
-	LinkingCodeDuration  = 5 * time.Minute
-)
+const LinkingCodeDuration = 5 * time.Minute
 
 type TokenType string
 
+// Refresh tokens used to be JWTs too; they are opaque now (see refresh.go), but
+// the type claim keeps old refresh JWTs from being accepted as access tokens.
 const (
-	TokenTypeAccess  TokenType = "access"
-	TokenTypeRefresh TokenType = "refresh"
+	TokenTypeAccess TokenType = "access"
 )
 
 type Claims struct {
 	UserID    uuid.UUID `json:"user_id"`
 	TokenType TokenType `json:"token_type"`
+	// SessionID is the refresh token family the access token was issued for;
+	// tokens issued before sessions were tracked have none
+	SessionID uuid.UUID `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func GenerateAccessToken(userID uuid.UUID) (string, error) {
-	return generateToken(userID, TokenTypeAccess, AccessTokenDuration)
-}
-
-func GenerateRefreshToken(userID uuid.UUID) (string, error) {
-	return generateToken(userID, TokenTypeRefresh, RefreshTokenDuration)
+// GenerateAccessToken issues an access token for userID in the session (refresh
+// token family) sessionID, valid for lifetime
+func GenerateAccessToken(userID, sessionID uuid.UUID, lifetime time.Duration) (string, error) {
+	return generateToken(userID, sessionID, TokenTypeAccess, lifetime)
 }
 
 func GenerateLinkingCode() (string, error) {
@@ -47,12 +44,16 @@ func GenerateLinkingCode() (string, error) {
 	return hexCode[0:4] + "-" + hexCode[4:8] + "-" + hexCode[8:12], nil
 }
 
-func generateToken(userID uuid.UUID, tokenType TokenType, duration time.Duration) (string, error) {
-	secretKey := os.Getenv("JWT_SECRET")
+func generateToken(userID, sessionID uuid.UUID, tokenType TokenType, duration time.Duration) (string, error) {
+	keys, err := SigningKeys()
+	if err != nil {
+		return "", err
+	}
 
 	claims := &Claims{
 		UserID:    userID,
 		TokenType: tokenType,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -60,14 +61,15 @@ func generateToken(userID uuid.UUID, tokenType TokenType, duration time.Duration
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secretKey))
+	return keys.Sign(token)
 }
 
 func ValidateToken(tokenString string) (*Claims, error) {
-	secretKey := os.Getenv("JWT_SECRET")
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (any, error) {
-		return []byte(secretKey), nil
-	})
+	keys, err := SigningKeys()
+	if err != nil {
+		return nil, err
+	}
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, keys.Verify, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 
 	if err != nil {
 		return nil, err
@@ -80,13 +82,14 @@ func ValidateToken(tokenString string) (*Claims, error) {
 	return nil, errors.New("invalid token")
 }
 
-func ValidateRefreshToken(tokenString string) (*Claims, error) {
+// ValidateAccessToken validates a JWT and checks that it is an access token
+func ValidateAccessToken(tokenString string) (*Claims, error) {
 	claims, err := ValidateToken(tokenString)
 	if err != nil {
 		return nil, err
 	}
-	if claims.TokenType != TokenTypeRefresh {
-		return nil, errors.New("invalid token type: expected refresh token")
+	if claims.TokenType != TokenTypeAccess {
+		return nil, errors.New("invalid token type: expected access token")
 	}
 	return claims, nil
 }
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	accessTokenLifetimeEnv  = "ACCESS_TOKEN_LIFETIME"
+	refreshTokenLifetimeEnv = "REFRESH_TOKEN_LIFETIME"
+
+	defaultAccessTokenLifetime  = 1 * time.Hour
+	defaultRefreshTokenLifetime = 30 * 24 * time.Hour
+
+	// MinTokenLifetime keeps a misconfiguration from issuing tokens that expire
+	// before the client can use them
+	MinTokenLifetime = time.Minute
+)
+
+// TokenLifetimes are how long access and refresh tokens are valid for
+type TokenLifetimes struct {
+	Access  time.Duration
+	Refresh time.Duration
+}
+
+// DefaultLifetimes are the lifetimes of the deployment, set from
+// ACCESS_TOKEN_LIFETIME and REFRESH_TOKEN_LIFETIME at startup. Organizations can
+// only shorten them for their members.
+var DefaultLifetimes = TokenLifetimes{Access: defaultAccessTokenLifetime, Refresh: defaultRefreshTokenLifetime}
+
+// LifetimesFromEnv reads ACCESS_TOKEN_LIFETIME and REFRESH_TOKEN_LIFETIME,
+// durations such as 15m or 720h. Unset means 1 hour and 30 days.
+func LifetimesFromEnv() (TokenLifetimes, error) {
+	lifetimes := TokenLifetimes{Access: defaultAccessTokenLifetime, Refresh: defaultRefreshTokenLifetime}
+	for _, setting := range []struct {
+		env      string
+		lifetime *time.Duration
+	}{{accessTokenLifetimeEnv, &lifetimes.Access}, {refreshTokenLifetimeEnv, &lifetimes.Refresh}} {
+		value := os.Getenv(setting.env)
+		if value == "" {
+			continue
+		}
+		lifetime, err := time.ParseDuration(value)
+		if err != nil || lifetime < MinTokenLifetime {
+			return TokenLifetimes{}, fmt.Errorf("invalid %s %q: expected a duration of at least %s", setting.env, value, MinTokenLifetime)
+		}
+		*setting.lifetime = lifetime
+	}
+	if lifetimes.Refresh < lifetimes.Access {
+		return TokenLifetimes{}, fmt.Errorf("%s must not be shorter than %s", refreshTokenLifetimeEnv, accessTokenLifetimeEnv)
+	}
+	return lifetimes, nil
+}
+
+// Cap shortens the lifetimes to the given maximums; nil leaves a lifetime as it
+// is. The access token never outlives the refresh token.
+func (l TokenLifetimes) Cap(access, refresh *time.Duration) TokenLifetimes {
+	if access != nil && *access < l.Access {
+		l.Access = *access
+	}
+	if refresh != nil && *refresh < l.Refresh {
+		l.Refresh = *refresh
+	}
+	if l.Refresh < l.Access {
+		l.Access = l.Refresh
+	}
+	return l
+}
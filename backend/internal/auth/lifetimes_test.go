@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLifetimesFromEnv(t *testing.T) {
+	t.Setenv("ACCESS_TOKEN_LIFETIME", "")
+	t.Setenv("REFRESH_TOKEN_LIFETIME", "")
+	lifetimes, err := LifetimesFromEnv()
+	if err != nil || lifetimes.Access != time.Hour || lifetimes.Refresh != 30*24*time.Hour {
+		t.Errorf("defaults = %+v, %v", lifetimes, err)
+	}
+
+	t.Setenv("ACCESS_TOKEN_LIFETIME", "15m")
+	t.Setenv("REFRESH_TOKEN_LIFETIME", "168h")
+	lifetimes, err = LifetimesFromEnv()
+	if err != nil || lifetimes.Access != 15*time.Minute || lifetimes.Refresh != 168*time.Hour {
+		t.Errorf("configured = %+v, %v", lifetimes, err)
+	}
+
+	for access, refresh := range map[string]string{"soon": "1h", "10s": "1h", "2h": "1h"} {
+		t.Setenv("ACCESS_TOKEN_LIFETIME", access)
+		t.Setenv("REFRESH_TOKEN_LIFETIME", refresh)
+		if _, err := LifetimesFromEnv(); err == nil {
+			t.Errorf("%s/%s accepted", access, refresh)
+		}
+	}
+}
+
+func TestTokenLifetimesCap(t *testing.T) {
+	defaults := TokenLifetimes{Access: time.Hour, Refresh: 24 * time.Hour}
+	duration := func(d time.Duration) *time.Duration { return &d }
+
+	tests := []struct {
+		access, refresh *time.Duration
+		want            TokenLifetimes
+	}{
+		{nil, nil, defaults},
+		{duration(15 * time.Minute), nil, TokenLifetimes{Access: 15 * time.Minute, Refresh: 24 * time.Hour}},
+		{duration(2 * time.Hour), duration(48 * time.Hour), defaults},
+		{nil, duration(30 * time.Minute), TokenLifetimes{Access: 30 * time.Minute, Refresh: 30 * time.Minute}},
+	}
+	for _, tt := range tests {
+		if got := defaults.Cap(tt.access, tt.refresh); got != tt.want {
+			t.Errorf("Cap(%v, %v) = %+v, want %+v", tt.access, tt.refresh, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"strings"
+	"time"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+)
+
+// A linking code is looked up by its first group, the selector, and the whole
+// code is then compared in constant time against the stored hash. A wrong code
+// with a live selector locks that code, so guessing the 32 bits after the
+// selector gets one try per sign-in; clients are throttled on top of that.
+const (
+	linkingCodeSelectorLen = 4
+
+	// LinkingCodeMaxFailures is how many wrong attempts lock a linking code
+	LinkingCodeMaxFailures = 1
+	// LinkingCodeClientMaxFailures failed exchanges from one client address
+	// within LinkingCodeFailureWindow make it wait for the window to pass
+	LinkingCodeClientMaxFailures = 10
+	LinkingCodeFailureWindow     = 15 * time.Minute
+
+	linkingCodeFailureRetention = 30 * 24 * time.Hour
+)
+
+// Reasons recorded in LinkingCodeFailure.Reason
+const (
+	LinkingCodeUnknown  = "unknown"  // no live code has the selector
+	LinkingCodeMismatch = "mismatch" // the selector matched, the rest didn't
+)
+
+// NormalizeLinkingCode uppercases a code as typed and drops the separators
+func NormalizeLinkingCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(code)))
+}
+
+// LinkingCodeSelector returns the lookup part of a normalized code
+func LinkingCodeSelector(code string) string {
+	if len(code) < linkingCodeSelectorLen {
+		return code
+	}
+	return code[:linkingCodeSelectorLen]
+}
+
+// HashLinkingCode returns the stored form of a normalized code
+func HashLinkingCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// LinkingCodeMatches compares a normalized code with a stored hash in constant time
+func LinkingCodeMatches(hash, code string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(HashLinkingCode(code))) == 1
+}
+
+// StartLinkingCodeFailurePurge deletes failed exchange records past their
+// retention every interval
+func StartLinkingCodeFailurePurge(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			result := database.DB.Where("created_at < ?", time.Now().Add(-linkingCodeFailureRetention)).
+				Delete(&models.LinkingCodeFailure{})
+			if result.Error != nil {
+				log.Printf("Failed to purge linking code failures: %v", result.Error)
+			} else if result.RowsAffected > 0 {
+				log.Printf("Purged %d linking code failures", result.RowsAffected)
+			}
+		}
+	}()
+}
@@ -0,0 +1,34 @@
+package auth
+
+import "testing"
+
+func TestLinkingCode(t *testing.T) {
+	code, err := GenerateLinkingCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	normalized := NormalizeLinkingCode(code)
+	if len(normalized) != 12 {
+		t.Fatalf("normalized %q to %q", code, normalized)
+	}
+	hash := HashLinkingCode(normalized)
+
+	// Typed in lowercase, with spaces or without separators
+	for _, typed := range []string{code, " " + code + " ", normalized, normalized[:4] + " " + normalized[4:8] + " " + normalized[8:]} {
+		if !LinkingCodeMatches(hash, NormalizeLinkingCode(typed)) {
+			t.Errorf("%q doesn't match", typed)
+		}
+	}
+	if LinkingCodeSelector(NormalizeLinkingCode(code)) != normalized[:4] {
+		t.Errorf("selector = %q", LinkingCodeSelector(normalized))
+	}
+
+	wrong := []byte(normalized)
+	wrong[11] ^= 1
+	if LinkingCodeMatches(hash, string(wrong)) {
+		t.Error("a different code matches")
+	}
+	if LinkingCodeSelector("AB") != "AB" {
+		t.Error("short code selector")
+	}
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func idToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	// Signed with a key the validation never sees, as it doesn't check signatures
+	raw, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("provider key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestValidateIDToken(t *testing.T) {
+	now := time.Now()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":            "https://idp.example.com",
+			"aud":            "envie",
+			"sub":            "user-1",
+			"exp":            now.Add(time.Hour).Unix(),
+			"nonce":          "n1",
+			"email":          "ada@example.com",
+			"email_verified": true,
+		}
+	}
+
+	claims, err := ValidateIDToken(idToken(t, valid()), "https://idp.example.com", "envie", "n1", now)
+	if err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "ada@example.com" || !claims.EmailVerified {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	tests := map[string]func(jwt.MapClaims){
+		"other issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		"other audience": func(c jwt.MapClaims) { c["aud"] = "someone-else" },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Hour).Unix() },
+		"no expiry":      func(c jwt.MapClaims) { delete(c, "exp") },
+		"no subject":     func(c jwt.MapClaims) { delete(c, "sub") },
+		"other nonce":    func(c jwt.MapClaims) { c["nonce"] = "n2" },
+		"other party": func(c jwt.MapClaims) {
+			c["aud"] = []string{"envie", "someone-else"}
+			c["azp"] = "someone-else"
+		},
+	}
+	for name, mutate := range tests {
+		claims := valid()
+		mutate(claims)
+		if _, err := ValidateIDToken(idToken(t, claims), "https://idp.example.com", "envie", "n1", now); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+}
+
+func TestSSOState(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	now := time.Now()
+	orgID, userID := uuid.New(), uuid.New()
+
+	state, err := SignSSOState(orgID, "n1", &userID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseSSOState(state, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.OrganizationID != orgID || parsed.Nonce != "n1" || parsed.LinkUserID == nil || *parsed.LinkUserID != userID {
+		t.Errorf("state = %+v", parsed)
+	}
+	if _, err := ParseSSOState(state, now.Add(SSOStateDuration+time.Minute)); err == nil {
+		t.Error("expired state accepted")
+	}
+	if _, err := ValidateAccessToken(state); err == nil {
+		t.Error("state accepted as an access token")
+	}
+
+	link, _ := SignSSOLink(orgID, userID, now)
+	if _, err := ParseSSOState(link, now); err == nil {
+		t.Error("link token accepted as a state")
+	}
+	if got, err := ParseSSOLink(link, orgID, now); err != nil || got != userID {
+		t.Errorf("ParseSSOLink = %v, %v", got, err)
+	}
+	if _, err := ParseSSOLink(link, uuid.New(), now); err == nil {
+		t.Error("link token accepted for another organization")
+	}
+}
+
+func TestDiscoverOIDC(t *testing.T) {
+	issuer := ""
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/openid-configuration" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer,
+			"authorization_endpoint": issuer + "/authorize",
+			"token_endpoint":         issuer + "/token",
+		})
+	}))
+	defer server.Close()
+
+	issuer = server.URL
+	provider, err := DiscoverOIDC(context.Background(), server.Client(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider.TokenEndpoint != server.URL+"/token" {
+		t.Errorf("token endpoint = %q", provider.TokenEndpoint)
+	}
+
+	issuer = "https://impostor.example.com"
+	if _, err := DiscoverOIDC(context.Background(), server.Client(), server.URL); err == nil {
+		t.Error("document of another issuer accepted")
+	}
+
+	if _, err := DiscoverOIDC(context.Background(), server.Client(), "http://idp.example.com"); err == nil {
+		t.Error("plain http issuer accepted")
+	}
+}
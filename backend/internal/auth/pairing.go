@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"time"
+)
+
+// A pairing links a new device without a linking code: the device shows a QR
+// code with the pairing ID and its approval code, a signed-in user approves it
+// from another device, and the new device, polling with the secret only it
+// knows, then receives its tokens.
+const (
+	PairingDuration     = 5 * time.Minute
+	PairingPollInterval = 2 * time.Second
+
+	// PairingQRScheme prefixes the QR code payload: envie://pair?id=...&code=...
+	PairingQRScheme = "envie://pair"
+)
+
+// GeneratePairingSecret returns a random secret for a pairing and its stored hash
+func GeneratePairingSecret() (secret, hash string, err error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", "", err
+	}
+	secret = base64.RawURLEncoding.EncodeToString(bytes)
+	return secret, sha256Hex([]byte(secret)), nil
+}
+
+// PairingSecretMatches compares a presented secret with a stored hash in
+// constant time
+func PairingSecretMatches(hash, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(sha256Hex([]byte(secret)))) == 1
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestPairingSecret(t *testing.T) {
+	secret, hash, err := GeneratePairingSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !PairingSecretMatches(hash, secret) {
+		t.Error("secret doesn't match its hash")
+	}
+	if PairingSecretMatches(hash, secret+"x") || PairingSecretMatches(hash, "") {
+		t.Error("another secret matches")
+	}
+
+	// Safe in the QR code payload without escaping
+	if url.QueryEscape(secret) != secret {
+		t.Errorf("secret %q needs escaping", secret)
+	}
+
+	other, _, _ := GeneratePairingSecret()
+	if other == secret {
+		t.Error("secrets repeat")
+	}
+}
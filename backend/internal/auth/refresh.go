@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Refresh tokens are opaque random strings. Only their SHA-256 hash is stored, and
+// every refresh rotates the token: the presented one is revoked and a new one is
+// issued in the same family. A revoked token presented again means it was copied,
+// so the whole family is revoked and the user has to sign in again.
+
+// Reasons recorded in RefreshToken.RevokedReason
+const (
+	RevokedRotated  = "rotated"      // replaced by a newer token of the same family
+	RevokedReuse    = "reuse"        // family revoked after a revoked token was presented
+	RevokedLogout   = "logout"       // family revoked by the user
+	RevokedOffboard = "offboarded"   // every family revoked when the user was offboarded
+	RevokedSSO      = "sso_required" // family revoked because an organization requires SSO
+	RevokedSession  = "session"      // family revoked from the session list, or with its device
+	RevokedDeleted  = "deleted"      // every family revoked when the user deleted their account
+	RevokedDisabled = "disabled"     // every family revoked when an instance administrator disabled the user
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// RefreshTokenStore persists refresh tokens. Implementations must make Revoke
+// atomic: of two concurrent calls for the same token only one may return true.
+type RefreshTokenStore interface {
+	// FindByHash returns the token with the given hash, or nil if there is none
+	FindByHash(hash string) (*models.RefreshToken, error)
+	Create(token *models.RefreshToken) error
+	// Revoke revokes an active token, reporting whether this call revoked it
+	Revoke(id uuid.UUID, reason string, at time.Time) (bool, error)
+	// RevokeFamily revokes every active token of a family
+	RevokeFamily(familyID uuid.UUID, reason string, at time.Time) error
+	// FamilyRevoked reports whether the family was revoked, not just rotated
+	FamilyRevoked(familyID uuid.UUID) (bool, error)
+}
+
+// GenerateRefreshToken returns a new opaque refresh token and the hash to store
+func GenerateRefreshToken() (token, hash string, err error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(bytes)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken returns the hex encoded SHA-256 of a refresh token
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Session describes the sign-in a refresh token family belongs to and the client
+// that last used it
+type Session struct {
+	DeviceID          *uuid.UUID // the device registered with this sign-in, if any
+	SSOOrganizationID *uuid.UUID // the organization whose provider it went through, if any
+	ClientIP          string
+	UserAgent         string
+	// Lifetime is how long the refresh token is valid for; zero means
+	// DefaultLifetimes.Refresh
+	Lifetime time.Duration
+}
+
+// LifetimePolicy returns the token lifetimes that apply to a user
+type LifetimePolicy func(userID uuid.UUID) (TokenLifetimes, error)
+
+// maxUserAgentLen is the size of the RefreshToken.UserAgent column
+const maxUserAgentLen = 255
+
+// IssueRefreshToken creates a refresh token for userID. A nil familyID starts a
+// new family, i.e. a new sign-in.
+func IssueRefreshToken(store RefreshTokenStore, userID uuid.UUID, familyID uuid.UUID, session Session, now time.Time) (string, error) {
+	token, hash, err := GenerateRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	if familyID == uuid.Nil {
+		familyID = uuid.New()
+	}
+	if session.Lifetime <= 0 {
+		session.Lifetime = DefaultLifetimes.Refresh
+	}
+	if len(session.UserAgent) > maxUserAgentLen {
+		session.UserAgent = session.UserAgent[:maxUserAgentLen]
+	}
+
+	record := &models.RefreshToken{
+		Token:     hash,
+		UserID:    userID,
+		DeviceID:  session.DeviceID,
+		FamilyID:  familyID,
+		ExpiresAt: now.Add(session.Lifetime),
+
+		SSOOrganizationID: session.SSOOrganizationID,
+		ClientIP:          session.ClientIP,
+		UserAgent:         session.UserAgent,
+	}
+	if err := store.Create(record); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RotateRefreshToken revokes the presented token and issues its successor to the
+// client at clientIP, valid for the refresh lifetime policy gives its user (nil
+// means DefaultLifetimes). It returns the presented token's record and the new
+// token.
+func RotateRefreshToken(store RefreshTokenStore, presented, clientIP, userAgent string, policy LifetimePolicy, now time.Time) (*models.RefreshToken, string, error) {
+	record, err := store.FindByHash(HashRefreshToken(presented))
+	if err != nil {
+		return nil, "", err
+	}
+	if record == nil {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	if record.RevokedAt != nil {
+		return nil, "", revokeForReuse(store, record, now)
+	}
+	if !now.Before(record.ExpiresAt) {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	// A concurrent refresh with the same token already won: one of the two
+	// callers holds a copy, so treat it like any other reuse
+	revoked, err := store.Revoke(record.ID, RevokedRotated, now)
+	if err != nil {
+		return nil, "", err
+	}
+	if !revoked {
+		return nil, "", revokeForReuse(store, record, now)
+	}
+
+	lifetimes := DefaultLifetimes
+	if policy != nil {
+		if lifetimes, err = policy(record.UserID); err != nil {
+			return nil, "", err
+		}
+	}
+
+	token, err := IssueRefreshToken(store, record.UserID, record.FamilyID, Session{
+		DeviceID:          record.DeviceID,
+		SSOOrganizationID: record.SSOOrganizationID,
+		ClientIP:          clientIP,
+		UserAgent:         userAgent,
+		Lifetime:          lifetimes.Refresh,
+	}, now)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The family may have been revoked between the lookup and the insert; the new
+	// token must not outlive it
+	familyRevoked, err := store.FamilyRevoked(record.FamilyID)
+	if err != nil {
+		return nil, "", err
+	}
+	if familyRevoked {
+		return nil, "", revokeForReuse(store, record, now)
+	}
+
+	return record, token, nil
+}
+
+// RevokeRefreshTokenFamily revokes the family of the presented token, if it
+// belongs to userID. Unknown tokens are ignored.
+func RevokeRefreshTokenFamily(store RefreshTokenStore, presented string, userID uuid.UUID, now time.Time) error {
+	record, err := store.FindByHash(HashRefreshToken(presented))
+	if err != nil || record == nil || record.UserID != userID {
+		return err
+	}
+	return store.RevokeFamily(record.FamilyID, RevokedLogout, now)
+}
+
+// RevokeUserRefreshTokens revokes every refresh token family of a user in db,
+// which may be a transaction, and returns how many active tokens it revoked
+func RevokeUserRefreshTokens(db *gorm.DB, userID uuid.UUID, reason string, at time.Time) (int64, error) {
+	var active int64
+	if err := db.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Count(&active).Error; err != nil {
+		return 0, err
+	}
+	// Rotated tokens are re-marked as in RevokeFamily
+	err := db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND (revoked_at IS NULL OR revoked_reason = ?)", userID, RevokedRotated).
+		Updates(map[string]any{"revoked_at": at, "revoked_reason": reason}).Error
+	return active, err
+}
+
+// RevokeDeviceRefreshTokens revokes the refresh token families of userID bound to
+// deviceID, or to any device when deviceID is nil, in db, which may be a
+// transaction
+func RevokeDeviceRefreshTokens(db *gorm.DB, userID uuid.UUID, deviceID *uuid.UUID, reason string, at time.Time) error {
+	families := db.Model(&models.RefreshToken{}).Select("family_id").Where("user_id = ? AND device_id IS NOT NULL", userID)
+	if deviceID != nil {
+		families = families.Where("device_id = ?", *deviceID)
+	}
+	// Rotated tokens are re-marked as in RevokeFamily
+	return db.Model(&models.RefreshToken{}).
+		Where("family_id IN (?) AND (revoked_at IS NULL OR revoked_reason = ?)", families, RevokedRotated).
+		Updates(map[string]any{"revoked_at": at, "revoked_reason": reason}).Error
+}
+
+func revokeForReuse(store RefreshTokenStore, record *models.RefreshToken, now time.Time) error {
+	if err := store.RevokeFamily(record.FamilyID, RevokedReuse, now); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+type gormRefreshTokenStore struct{}
+
+// DBRefreshTokenStore is the refresh token store backed by the main database
+var DBRefreshTokenStore RefreshTokenStore = gormRefreshTokenStore{}
+
+func (gormRefreshTokenStore) FindByHash(hash string) (*models.RefreshToken, error) {
+	var record models.RefreshToken
+	err := database.DB.Where("token = ?", hash).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (gormRefreshTokenStore) Create(token *models.RefreshToken) error {
+	return database.DB.Create(token).Error
+}
+
+func (gormRefreshTokenStore) Revoke(id uuid.UUID, reason string, at time.Time) (bool, error) {
+	result := database.DB.Model(&models.RefreshToken{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Updates(map[string]any{"revoked_at": at, "revoked_reason": reason})
+	return result.RowsAffected == 1, result.Error
+}
+
+func (gormRefreshTokenStore) RevokeFamily(familyID uuid.UUID, reason string, at time.Time) error {
+	// Rotated tokens are re-marked too, so FamilyRevoked sees the family as revoked
+	// even when it has no active token left
+	return database.DB.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND (revoked_at IS NULL OR revoked_reason = ?)", familyID, RevokedRotated).
+		Updates(map[string]any{"revoked_at": at, "revoked_reason": reason}).Error
+}
+
+func (gormRefreshTokenStore) FamilyRevoked(familyID uuid.UUID) (bool, error) {
+	var count int64
+	err := database.DB.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NOT NULL AND revoked_reason <> ?", familyID, RevokedRotated).
+		Count(&count).Error
+	return count > 0, err
+}
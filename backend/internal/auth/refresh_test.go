@@ -0,0 +1,331 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"envie-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// memoryRefreshTokenStore mirrors the semantics of the database store
+type memoryRefreshTokenStore struct {
+	mu     sync.Mutex
+	tokens map[uuid.UUID]*models.RefreshToken
+}
+
+func newMemoryRefreshTokenStore() *memoryRefreshTokenStore {
+	return &memoryRefreshTokenStore{tokens: map[uuid.UUID]*models.RefreshToken{}}
+}
+
+func (s *memoryRefreshTokenStore) FindByHash(hash string) (*models.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, token := range s.tokens {
+		if token.Token == hash {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *memoryRefreshTokenStore) Create(token *models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token.ID = uuid.New()
+	copied := *token
+	s.tokens[token.ID] = &copied
+	return nil
+}
+
+func (s *memoryRefreshTokenStore) Revoke(id uuid.UUID, reason string, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token := s.tokens[id]
+	if token == nil || token.RevokedAt != nil {
+		return false, nil
+	}
+	token.RevokedAt = &at
+	token.RevokedReason = reason
+	return true, nil
+}
+
+func (s *memoryRefreshTokenStore) RevokeFamily(familyID uuid.UUID, reason string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, token := range s.tokens {
+		if token.FamilyID == familyID && (token.RevokedAt == nil || token.RevokedReason == RevokedRotated) {
+			token.RevokedAt = &at
+			token.RevokedReason = reason
+		}
+	}
+	return nil
+}
+
+func (s *memoryRefreshTokenStore) FamilyRevoked(familyID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, token := range s.tokens {
+		if token.FamilyID == familyID && token.RevokedAt != nil && token.RevokedReason != RevokedRotated {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *memoryRefreshTokenStore) active() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, token := range s.tokens {
+		if token.RevokedAt == nil {
+			count++
+		}
+	}
+	return count
+}
+
+func TestGenerateRefreshToken(t *testing.T) {
+	token, hash, err := GenerateRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != HashRefreshToken(token) {
+		t.Error("hash does not match HashRefreshToken")
+	}
+	if len(hash) != 64 {
+		t.Errorf("hash length = %d, want 64 to fit the token column", len(hash))
+	}
+
+	other, _, _ := GenerateRefreshToken()
+	if token == other {
+		t.Error("two generated tokens are equal")
+	}
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	store := newMemoryRefreshTokenStore()
+	now := time.Now()
+	userID := uuid.New()
+
+	first, err := IssueRefreshToken(store, userID, uuid.Nil, Session{}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	owner, second, err := RotateRefreshToken(store, first, "", "", nil, now)
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if owner.UserID != userID {
+		t.Errorf("owner = %s, want %s", owner.UserID, userID)
+	}
+	if second == first {
+		t.Error("rotation returned the same token")
+	}
+
+	stored, _ := store.FindByHash(HashRefreshToken(second))
+	if stored.FamilyID != owner.FamilyID {
+		t.Error("rotated token left the family")
+	}
+	if store.active() != 1 {
+		t.Errorf("%d active tokens, want 1", store.active())
+	}
+
+	if _, _, err := RotateRefreshToken(store, second, "", "", nil, now); err != nil {
+		t.Errorf("rotating the successor: %v", err)
+	}
+}
+
+func TestRotateRefreshTokenKeepsSession(t *testing.T) {
+	store := newMemoryRefreshTokenStore()
+	now := time.Now()
+	deviceID, orgID := uuid.New(), uuid.New()
+
+	first, _ := IssueRefreshToken(store, uuid.New(), uuid.Nil, Session{
+		DeviceID:          &deviceID,
+		SSOOrganizationID: &orgID,
+		ClientIP:          "192.0.2.1",
+		UserAgent:         "envie-cli/1.0",
+	}, now)
+	_, second, err := RotateRefreshToken(store, first, "198.51.100.7", "envie-cli/1.1", nil, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, _ := store.FindByHash(HashRefreshToken(second))
+	if stored.DeviceID == nil || *stored.DeviceID != deviceID {
+		t.Errorf("device = %v, want %s", stored.DeviceID, deviceID)
+	}
+	if stored.SSOOrganizationID == nil || *stored.SSOOrganizationID != orgID {
+		t.Errorf("SSO organization = %v, want %s", stored.SSOOrganizationID, orgID)
+	}
+	if stored.ClientIP != "198.51.100.7" || stored.UserAgent != "envie-cli/1.1" {
+		t.Errorf("client = %q %q, want the latest", stored.ClientIP, stored.UserAgent)
+	}
+}
+
+func TestRotateRefreshTokenReuseRevokesFamily(t *testing.T) {
+	store := newMemoryRefreshTokenStore()
+	now := time.Now()
+
+	first, _ := IssueRefreshToken(store, uuid.New(), uuid.Nil, Session{}, now)
+	_, second, err := RotateRefreshToken(store, first, "", "", nil, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The old token shows up again: someone holds a copy
+	if _, _, err := RotateRefreshToken(store, first, "", "", nil, now); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reuse: err = %v, want ErrRefreshTokenReused", err)
+	}
+
+	if _, _, err := RotateRefreshToken(store, second, "", "", nil, now); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("successor after reuse: err = %v, want ErrRefreshTokenReused", err)
+	}
+	if store.active() != 0 {
+		t.Errorf("%d active tokens after reuse, want 0", store.active())
+	}
+}
+
+func TestRotateRefreshTokenAfterLogout(t *testing.T) {
+	store := newMemoryRefreshTokenStore()
+	now := time.Now()
+	userID := uuid.New()
+
+	first, _ := IssueRefreshToken(store, userID, uuid.Nil, Session{}, now)
+	_, second, _ := RotateRefreshToken(store, first, "", "", nil, now)
+	other, _ := IssueRefreshToken(store, userID, uuid.Nil, Session{}, now)
+
+	// Another user's logout must not touch this family
+	if err := RevokeRefreshTokenFamily(store, second, uuid.New(), now); err != nil {
+		t.Fatal(err)
+	}
+	if store.active() != 2 {
+		t.Fatalf("%d active tokens, want 2", store.active())
+	}
+
+	if err := RevokeRefreshTokenFamily(store, second, userID, now); err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{first, second} {
+		if _, _, err := RotateRefreshToken(store, token, "", "", nil, now); !errors.Is(err, ErrRefreshTokenReused) {
+			t.Errorf("err = %v, want ErrRefreshTokenReused", err)
+		}
+	}
+
+	// Other sign-ins of the same user keep working
+	if _, _, err := RotateRefreshToken(store, other, "", "", nil, now); err != nil {
+		t.Errorf("other family: %v", err)
+	}
+}
+
+func TestRotateRefreshTokenLifetimePolicy(t *testing.T) {
+	store := newMemoryRefreshTokenStore()
+	now := time.Now()
+	userID := uuid.New()
+
+	first, _ := IssueRefreshToken(store, userID, uuid.Nil, Session{}, now)
+	policy := func(id uuid.UUID) (TokenLifetimes, error) {
+		if id != userID {
+			t.Errorf("policy asked for %s, want %s", id, userID)
+		}
+		return TokenLifetimes{Access: time.Minute, Refresh: 8 * time.Hour}, nil
+	}
+	_, second, err := RotateRefreshToken(store, first, "", "", policy, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, _ := store.FindByHash(HashRefreshToken(second))
+	if want := now.Add(8 * time.Hour); !stored.ExpiresAt.Equal(want) {
+		t.Errorf("expires at %s, want %s", stored.ExpiresAt, want)
+	}
+}
+
+func TestRotateRefreshTokenInvalid(t *testing.T) {
+	store := newMemoryRefreshTokenStore()
+	now := time.Now()
+
+	if _, _, err := RotateRefreshToken(store, "unknown", "", "", nil, now); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("unknown token: err = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	token, _ := IssueRefreshToken(store, uuid.New(), uuid.Nil, Session{}, now)
+	if _, _, err := RotateRefreshToken(store, token, "", "", nil, now.Add(DefaultLifetimes.Refresh)); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expired token: err = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestRotateRefreshTokenRace(t *testing.T) {
+	store := newMemoryRefreshTokenStore()
+	now := time.Now()
+	token, _ := IssueRefreshToken(store, uuid.New(), uuid.Nil, Session{}, now)
+
+	const callers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := RotateRefreshToken(store, token, "", "", nil, now)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	reused := 0
+	for err := range errs {
+		switch {
+		case errors.Is(err, ErrRefreshTokenReused):
+			reused++
+		case err != nil:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+
+	// At most one caller may win, and then the losers revoke the family it got
+	if reused < callers-1 {
+		t.Errorf("%d of %d concurrent rotations detected reuse", reused, callers)
+	}
+	if store.active() != 0 {
+		t.Errorf("%d active tokens after a racing reuse, want 0", store.active())
+	}
+}
+
+func TestRotateRefreshTokenFamilyRevokedDuringRotation(t *testing.T) {
+	store := &revokingStore{memoryRefreshTokenStore: newMemoryRefreshTokenStore()}
+	now := time.Now()
+	token, _ := IssueRefreshToken(store, uuid.New(), uuid.Nil, Session{}, now)
+
+	store.revokeOnCreate = true
+	if _, _, err := RotateRefreshToken(store, token, "", "", nil, now); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("err = %v, want ErrRefreshTokenReused", err)
+	}
+	if store.active() != 0 {
+		t.Errorf("%d active tokens, want 0: the successor outlived its family", store.active())
+	}
+}
+
+// revokingStore logs the family out right after a successor is created, as a
+// concurrent logout would
+type revokingStore struct {
+	*memoryRefreshTokenStore
+	revokeOnCreate bool
+}
+
+func (s *revokingStore) Create(token *models.RefreshToken) error {
+	if err := s.memoryRefreshTokenStore.Create(token); err != nil {
+		return err
+	}
+	if s.revokeOnCreate {
+		return s.RevokeFamily(token.FamilyID, RevokedLogout, time.Now())
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPublicShareSignature(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret-with-at-least-32-chars!")
+	shareID := uuid.New()
+	signature := SignPublicShare(shareID, 1800000000)
+
+	if !VerifyPublicShare(shareID, 1800000000, signature) {
+		t.Fatal("valid signature rejected")
+	}
+	if VerifyPublicShare(shareID, 0, signature) {
+		t.Error("signature accepted for a different expiry")
+	}
+	if VerifyPublicShare(uuid.New(), 1800000000, signature) {
+		t.Error("signature accepted for a different share")
+	}
+	if VerifyPublicShare(shareID, 1800000000, "") {
+		t.Error("empty signature accepted")
+	}
+
+	t.Setenv("JWT_SECRET", "another-secret-with-at-least-32-chars")
+	if VerifyPublicShare(shareID, 1800000000, signature) {
+		t.Error("signature survived a secret change")
+	}
+}
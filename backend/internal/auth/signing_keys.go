@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Access tokens are signed with the first key of JWT_SIGNING_KEYS, a comma
+// separated list of id:secret pairs, and carry its id in the kid header. Tokens
+// are verified with the key their kid names, so a secret is rotated by putting a
+// new key first and dropping the old one once the tokens it signed have expired
+// (at most one access token lifetime later). Refresh tokens are opaque and are
+// not affected.
+//
+// Without JWT_SIGNING_KEYS tokens are signed with JWT_SECRET and have no kid.
+// JWT_SECRET keeps verifying tokens without a kid either way, which lets a
+// deployment move to JWT_SIGNING_KEYS without signing everyone out. It also
+// stays the secret share URLs, SSO states and device challenges are signed with,
+// so it is required even with JWT_SIGNING_KEYS set.
+
+const (
+	signingKeysEnv = "JWT_SIGNING_KEYS"
+	jwtSecretEnv   = "JWT_SECRET"
+)
+
+var (
+	ErrNoSigningKey      = errors.New("no JWT secret: set JWT_SECRET, which also signs share URLs, SSO states and device challenges")
+	ErrUnknownSigningKey = errors.New("token signed with an unknown key")
+)
+
+// SigningKey is an HMAC key access tokens are signed with
+type SigningKey struct {
+	ID     string // kid header value; empty for JWT_SECRET
+	Secret []byte
+}
+
+// Keyring holds the key new tokens are signed with and every key tokens are
+// still accepted from
+type Keyring struct {
+	Active SigningKey
+	keys   map[string][]byte
+}
+
+// SigningKeysFrom reads the signing keys through getenv
+func SigningKeysFrom(getenv func(string) string) (*Keyring, error) {
+	secret := getenv(jwtSecretEnv)
+	if strings.TrimSpace(secret) == "" {
+		return nil, ErrNoSigningKey
+	}
+	keyring := &Keyring{Active: SigningKey{Secret: []byte(secret)}, keys: map[string][]byte{}}
+	keyring.keys[""] = keyring.Active.Secret
+
+	value := strings.TrimSpace(getenv(signingKeysEnv))
+	if value == "" {
+		return keyring, nil
+	}
+
+	for i, entry := range strings.Split(value, ",") {
+		id, secret, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("invalid %s entry %q: expected id:secret", signingKeysEnv, entry)
+		}
+		if _, duplicate := keyring.keys[id]; duplicate {
+			return nil, fmt.Errorf("duplicate %s id %q", signingKeysEnv, id)
+		}
+		keyring.keys[id] = []byte(secret)
+		if i == 0 {
+			keyring.Active = SigningKey{ID: id, Secret: []byte(secret)}
+		}
+	}
+	return keyring, nil
+}
+
+// SigningKeys reads the signing keys from the environment
+func SigningKeys() (*Keyring, error) {
+	return SigningKeysFrom(os.Getenv)
+}
+
+// String describes the keyring without secrets, for the log
+func (k *Keyring) String() string {
+	active := "JWT_SECRET"
+	if k.Active.ID != "" {
+		active = fmt.Sprintf("key %q", k.Active.ID)
+	}
+	return fmt.Sprintf("signing with %s, accepting %d keys", active, len(k.keys))
+}
+
+// Sign signs token with the active key
+func (k *Keyring) Sign(token *jwt.Token) (string, error) {
+	if k.Active.ID != "" {
+		token.Header["kid"] = k.Active.ID
+	}
+	return token.SignedString(k.Active.Secret)
+}
+
+// Verify returns the key token claims to be signed with, as a jwt.Keyfunc
+func (k *Keyring) Verify(token *jwt.Token) (any, error) {
+	id, _ := token.Header["kid"].(string)
+	secret, ok := k.keys[id]
+	if !ok {
+		return nil, ErrUnknownSigningKey
+	}
+	return secret, nil
+}
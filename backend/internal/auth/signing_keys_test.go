@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestSigningKeysFrom(t *testing.T) {
+	tests := map[string]struct {
+		env     map[string]string
+		active  string
+		wantErr bool
+	}{
+		"secret only":  {env: map[string]string{"JWT_SECRET": "s"}, active: ""},
+		"keys":         {env: map[string]string{"JWT_SECRET": "s", "JWT_SIGNING_KEYS": "b:new, a:old"}, active: "b"},
+		"both":         {env: map[string]string{"JWT_SECRET": "s", "JWT_SIGNING_KEYS": "a:k"}, active: "a"},
+		"none":         {env: map[string]string{}, wantErr: true},
+		"no secret":    {env: map[string]string{"JWT_SIGNING_KEYS": "b:new, a:old"}, wantErr: true},
+		"blank secret": {env: map[string]string{"JWT_SECRET": " ", "JWT_SIGNING_KEYS": "a:k"}, wantErr: true},
+		"missing id":   {env: map[string]string{"JWT_SECRET": "s", "JWT_SIGNING_KEYS": ":k"}, wantErr: true},
+		"no separator": {env: map[string]string{"JWT_SECRET": "s", "JWT_SIGNING_KEYS": "k"}, wantErr: true},
+		"duplicate":    {env: map[string]string{"JWT_SECRET": "s", "JWT_SIGNING_KEYS": "a:k,a:l"}, wantErr: true},
+	}
+	for name, tt := range tests {
+		keyring, err := SigningKeysFrom(func(name string) string { return tt.env[name] })
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: no error", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if keyring.Active.ID != tt.active {
+			t.Errorf("%s: active key = %q, want %q", name, keyring.Active.ID, tt.active)
+		}
+	}
+}
+
+func TestSigningKeyRotation(t *testing.T) {
+	userID := uuid.New()
+
+	// Tokens signed with JWT_SECRET keep working once keys are introduced
+	t.Setenv("JWT_SECRET", "legacy-secret")
+	legacy, err := GenerateAccessToken(userID, uuid.New(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("JWT_SIGNING_KEYS", "k1:first-secret")
+	first, err := GenerateAccessToken(userID, uuid.New(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, _ := jwt.NewParser().ParseUnverified(first, &Claims{})
+	if parsed.Header["kid"] != "k1" {
+		t.Errorf("kid = %v, want k1", parsed.Header["kid"])
+	}
+
+	t.Setenv("JWT_SIGNING_KEYS", "k2:second-secret,k1:first-secret")
+	for name, token := range map[string]string{"legacy": legacy, "previous key": first} {
+		if claims, err := ValidateAccessToken(token); err != nil || claims.UserID != userID {
+			t.Errorf("%s token rejected after rotation: %v", name, err)
+		}
+	}
+
+	// Dropping a key invalidates the tokens it signed, and only those
+	t.Setenv("JWT_SIGNING_KEYS", "k2:second-secret")
+	if _, err := ValidateAccessToken(first); err == nil {
+		t.Error("token of a dropped key accepted")
+	}
+	second, _ := GenerateAccessToken(userID, uuid.New(), time.Hour)
+	if _, err := ValidateAccessToken(second); err != nil {
+		t.Errorf("token of the active key rejected: %v", err)
+	}
+
+	// A kid can't be used to pick the secret of another key
+	t.Setenv("JWT_SIGNING_KEYS", "k2:other-secret")
+	if _, err := ValidateAccessToken(second); err == nil {
+		t.Error("token accepted after its key's secret changed")
+	}
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key from RFC 6238 appendix B, base32 encoded
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// The RFC lists 8 digit codes; 6 digit codes are their last six digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.code {
+			t.Errorf("T=%d: code = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := TOTPStep(now)
+	code, _ := TOTPCode(rfc6238Secret, step)
+
+	got, err := ValidateTOTP(rfc6238Secret, code, now, 0)
+	if err != nil || got != step {
+		t.Fatalf("ValidateTOTP = %d, %v; want %d", got, err, step)
+	}
+
+	// One step of clock drift either way is tolerated, two are not
+	if _, err := ValidateTOTP(rfc6238Secret, code, now.Add(TOTPPeriod), 0); err != nil {
+		t.Errorf("one step late: %v", err)
+	}
+	if _, err := ValidateTOTP(rfc6238Secret, code, now.Add(-TOTPPeriod), 0); err != nil {
+		t.Errorf("one step early: %v", err)
+	}
+	if _, err := ValidateTOTP(rfc6238Secret, code, now.Add(2*TOTPPeriod), 0); err != ErrInvalidTwoFactorCode {
+		t.Errorf("two steps late: err = %v", err)
+	}
+
+	if _, err := ValidateTOTP(rfc6238Secret, code, now, step); err != ErrInvalidTwoFactorCode {
+		t.Errorf("replayed code: err = %v", err)
+	}
+	if _, err := ValidateTOTP(rfc6238Secret, "12345", now, 0); err != ErrInvalidTwoFactorCode {
+		t.Errorf("short code: err = %v", err)
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("secret length = %d, want 32 base32 characters (160 bits)", len(secret))
+	}
+	if _, err := TOTPCode(secret, 1); err != nil {
+		t.Errorf("generated secret does not decode: %v", err)
+	}
+
+	uri, err := url.Parse(TOTPProvisioningURI(secret, "ada@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Envie:ada@example.com" {
+		t.Errorf("unexpected provisioning URI %s", uri)
+	}
+	if uri.Query().Get("secret") != secret || uri.Query().Get("issuer") != TOTPIssuer {
+		t.Errorf("provisioning URI query = %v", uri.Query())
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodeCount || len(hashes) != RecoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), RecoveryCodeCount)
+	}
+
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if seen[code] {
+			t.Errorf("duplicate recovery code %s", code)
+		}
+		seen[code] = true
+		if hashes[i] != HashRecoveryCode(code) {
+			t.Errorf("hash %d does not match its code", i)
+		}
+		if strings.Contains(hashes[i], code) {
+			t.Error("hash contains the code")
+		}
+	}
+
+	// Users retype codes in any case, with or without the dash
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+	if HashRecoveryCode(typed) != hashes[0] {
+		t.Errorf("%q does not match %q", typed, codes[0])
+	}
+}
@@ -0,0 +1,176 @@
+// Package authcache caches the authorization lookups made on nearly every request:
+// organization roles, team membership of a project and CLI tokens by identity hash.
+//
+// Entries are dropped whenever a membership, team or token table is written, through
+// GORM callbacks, so no handler needs to know which entries a change affects. The
+// cache is per instance: with several instances, a change made on one reaches the
+// others only when their entries expire, so keep the TTL short.
+package authcache
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	authCacheTTLEnv = "AUTH_CACHE_TTL"
+
+	maxEntries = 10000
+
+	// reinvalidateAfter repeats an invalidation once the writing transaction has
+	// most likely committed, so a value another request read from the old state in
+	// the meantime doesn't survive
+	reinvalidateAfter = 2 * time.Second
+
+	skipInvalidationKey = "authcache:skip_invalidation"
+)
+
+type entry struct {
+	value   any
+	expires time.Time
+}
+
+var (
+	mu         sync.Mutex
+	ttl        time.Duration
+	entries    = map[string]entry{}
+	generation uint64
+)
+
+// Configure enables the cache with the given TTL; zero disables it
+func Configure(entryTTL time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	ttl = entryTTL
+	entries = map[string]entry{}
+	generation++
+}
+
+// ConfigureFromEnv reads AUTH_CACHE_TTL, a duration such as 30s. Unset disables
+// the cache.
+func ConfigureFromEnv() (time.Duration, error) {
+	value := os.Getenv(authCacheTTLEnv)
+	if value == "" {
+		Configure(0)
+		return 0, nil
+	}
+	entryTTL, err := time.ParseDuration(value)
+	if err != nil || entryTTL < 0 {
+		return 0, fmt.Errorf("invalid %s %q", authCacheTTLEnv, value)
+	}
+	Configure(entryTTL)
+	return entryTTL, nil
+}
+
+// Lookup returns the cached value for key, or calls load and caches its result.
+// Errors are not cached. Values are returned by copy, so T should not contain
+// pointers the caller may modify.
+func Lookup[T any](key string, load func() (T, error)) (T, error) {
+	mu.Lock()
+	if ttl <= 0 {
+		mu.Unlock()
+		return load()
+	}
+	if e, ok := entries[key]; ok && time.Now().Before(e.expires) {
+		mu.Unlock()
+		return e.value.(T), nil
+	}
+	loadedIn := generation
+	mu.Unlock()
+
+	value, err := load()
+	if err != nil {
+		return value, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// An invalidation while loading means value may predate the change
+	if generation == loadedIn && ttl > 0 {
+		if len(entries) >= maxEntries {
+			evict()
+		}
+		entries[key] = entry{value: value, expires: time.Now().Add(ttl)}
+	}
+	return value, nil
+}
+
+// Invalidate drops every entry
+func Invalidate() {
+	mu.Lock()
+	defer mu.Unlock()
+	entries = map[string]entry{}
+	generation++
+}
+
+// evict drops expired entries, or everything if none have expired. Must be called
+// with mu held.
+func evict() {
+	now := time.Now()
+	for key, e := range entries {
+		if !now.Before(e.expires) {
+			delete(entries, key)
+		}
+	}
+	if len(entries) >= maxEntries {
+		entries = map[string]entry{}
+	}
+}
+
+// watchedTables are the tables cached lookups read from
+var watchedTables = map[string]bool{
+	"organization_users": true,
+	"roles":              true,
+	"teams":              true,
+	"team_users":         true,
+	"team_projects":      true,
+	"project_tokens":     true,
+}
+
+// cascadingTables are only watched for deletes, which cascade to watched tables in
+// the database where no callback sees them. Their frequent updates don't matter.
+var cascadingTables = map[string]bool{
+	"organizations": true,
+	"projects":      true,
+	"users":         true,
+}
+
+// SkipInvalidation marks a write to a watched table that cached lookups don't
+// depend on, such as a token's last use time
+func SkipInvalidation(db *gorm.DB) *gorm.DB {
+	return db.Set(skipInvalidationKey, true)
+}
+
+// RegisterCallbacks invalidates the cache after every create, update and delete on
+// the watched tables, and every delete on the cascading ones
+func RegisterCallbacks(db *gorm.DB) error {
+	invalidateOn := func(tables ...map[string]bool) func(*gorm.DB) {
+		return func(db *gorm.DB) {
+			if db.Error != nil {
+				return
+			}
+			if skip, _ := db.Get(skipInvalidationKey); skip == true {
+				return
+			}
+			for _, watched := range tables {
+				if watched[db.Statement.Table] {
+					Invalidate()
+					time.AfterFunc(reinvalidateAfter, Invalidate)
+					return
+				}
+			}
+		}
+	}
+
+	if err := db.Callback().Create().After("gorm:create").Register("authcache:invalidate", invalidateOn(watchedTables)); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("authcache:invalidate", invalidateOn(watchedTables)); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:delete").Register("authcache:invalidate", invalidateOn(watchedTables, cascadingTables))
+}
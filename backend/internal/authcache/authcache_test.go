@@ -0,0 +1,159 @@
+package authcache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"envie-backend/internal/models"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func counter(value string) (func() (string, error), *int) {
+	calls := 0
+	return func() (string, error) {
+		calls++
+		return value, nil
+	}, &calls
+}
+
+func TestLookup(t *testing.T) {
+	Configure(time.Minute)
+	t.Cleanup(func() { Configure(0) })
+
+	load, calls := counter("admin")
+	for range 3 {
+		if role, err := Lookup("org_role:a", load); err != nil || role != "admin" {
+			t.Fatalf("Lookup = %q, %v", role, err)
+		}
+	}
+	if *calls != 1 {
+		t.Errorf("loaded %d times, want 1", *calls)
+	}
+
+	Invalidate()
+	Lookup("org_role:a", load)
+	if *calls != 2 {
+		t.Errorf("loaded %d times after Invalidate, want 2", *calls)
+	}
+}
+
+func TestLookupDoesNotCacheErrors(t *testing.T) {
+	Configure(time.Minute)
+	t.Cleanup(func() { Configure(0) })
+
+	calls := 0
+	load := func() (string, error) {
+		calls++
+		return "", errors.New("record not found")
+	}
+	Lookup("cli_token:x", load)
+	if _, err := Lookup("cli_token:x", load); err == nil || calls != 2 {
+		t.Errorf("err = %v after %d loads", err, calls)
+	}
+}
+
+func TestLookupDropsValuesLoadedDuringInvalidation(t *testing.T) {
+	Configure(time.Minute)
+	t.Cleanup(func() { Configure(0) })
+
+	// The membership changes while the old role is being read
+	Lookup("org_role:a", func() (string, error) {
+		Invalidate()
+		return "admin", nil
+	})
+
+	load, calls := counter("member")
+	if role, _ := Lookup("org_role:a", load); role != "member" || *calls != 1 {
+		t.Errorf("Lookup = %q, the stale value was cached", role)
+	}
+}
+
+func TestLookupExpires(t *testing.T) {
+	Configure(time.Millisecond)
+	t.Cleanup(func() { Configure(0) })
+
+	load, calls := counter("owner")
+	Lookup("org_role:a", load)
+	time.Sleep(5 * time.Millisecond)
+	Lookup("org_role:a", load)
+	if *calls != 2 {
+		t.Errorf("loaded %d times, want 2", *calls)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	Configure(0)
+	load, calls := counter("owner")
+	Lookup("org_role:a", load)
+	Lookup("org_role:a", load)
+	if *calls != 2 {
+		t.Errorf("loaded %d times with the cache disabled, want 2", *calls)
+	}
+}
+
+func TestConfigureFromEnv(t *testing.T) {
+	t.Cleanup(func() { Configure(0) })
+
+	t.Setenv(authCacheTTLEnv, "30s")
+	if ttl, err := ConfigureFromEnv(); err != nil || ttl != 30*time.Second {
+		t.Errorf("ConfigureFromEnv = %s, %v", ttl, err)
+	}
+	t.Setenv(authCacheTTLEnv, "soon")
+	if _, err := ConfigureFromEnv(); err == nil {
+		t.Error("invalid TTL accepted")
+	}
+}
+
+func TestCallbacksInvalidate(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterCallbacks(db); err != nil {
+		t.Fatal(err)
+	}
+
+	Configure(time.Minute)
+	t.Cleanup(func() { Configure(0) })
+
+	tests := []struct {
+		name        string
+		write       func() *gorm.DB
+		invalidates bool
+	}{
+		{"member added", func() *gorm.DB { return db.Create(&models.TeamUser{}) }, true},
+		{"role changed", func() *gorm.DB {
+			return db.Model(&models.OrganizationUser{}).Where("user_id = ?", "u").Update("role", "admin")
+		}, true},
+		{"token revoked", func() *gorm.DB { return db.Where("id = ?", "t").Delete(&models.ProjectToken{}) }, true},
+		{"project deleted", func() *gorm.DB { return db.Where("id = ?", "p").Delete(&models.Project{}) }, true},
+		{"project renamed", func() *gorm.DB {
+			return db.Model(&models.Project{}).Where("id = ?", "p").Update("name", "api")
+		}, false},
+		{"token used", func() *gorm.DB {
+			return SkipInvalidation(db).Model(&models.ProjectToken{}).Where("id = ?", "t").Update("last_used_at", time.Now())
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Lookup("org_role:a", func() (string, error) { return "owner", nil })
+			if err := tt.write().Error; err != nil {
+				t.Fatal(err)
+			}
+
+			load, calls := counter("member")
+			Lookup("org_role:a", load)
+			if invalidated := *calls == 1; invalidated != tt.invalidates {
+				t.Errorf("invalidated = %v, want %v", invalidated, tt.invalidates)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+// Package config reads the backend's configuration file and checks that the
+// settings startup needs are there.
+//
+// The file is YAML (.yaml, .yml) or TOML (.toml). Its keys are the environment
+// variables, and nested keys are joined with underscores, so
+//
+//	db:
+//	  driver: sqlite
+//	  dsn: /var/lib/envie/envie.db
+//	cors_allowed_origins: [https://app.example.com, tauri://localhost]
+//
+// sets DB_DRIVER, DB_DSN and CORS_ALLOWED_ORIGINS. Lists are joined with
+// commas. The environment and .env take precedence over the file, see
+// settings.LoadConfigFile.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// FileEnv names the config file when --config isn't given
+const FileEnv = "ENVIE_CONFIG"
+
+var keyPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// Load reads the file at path into environment variable values
+func Load(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tree map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return nil, fmt.Errorf("%s: unknown config format %q, use .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	if err := flatten("", tree, values); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return values, nil
+}
+
+func flatten(prefix string, tree map[string]any, values map[string]string) error {
+	for key, value := range tree {
+		if !keyPattern.MatchString(key) {
+			return fmt.Errorf("invalid key %q: use letters, digits and underscores", prefix+key)
+		}
+		name := strings.ToUpper(prefix + key)
+
+		if nested, ok := value.(map[string]any); ok {
+			if err := flatten(name+"_", nested, values); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var text string
+		var err error
+		if list, ok := value.([]any); ok {
+			items := make([]string, len(list))
+			for i, item := range list {
+				if items[i], err = scalar(item); err != nil {
+					break
+				}
+			}
+			text = strings.Join(items, ",")
+		} else {
+			text, err = scalar(value)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if _, duplicate := values[name]; duplicate {
+			return fmt.Errorf("%s is set twice", name)
+		}
+		values[name] = text
+	}
+	return nil
+}
+
+// scalar formats a value the way it would be written in the environment
+func scalar(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case time.Time:
+		return v.Format(time.RFC3339), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", value)
+	}
+}
+
+// requirement is a setting startup fails without, met by any of its names
+type requirement struct {
+	names []string
+	what  string
+}
+
+var required = []requirement{
+	{[]string{"DB_DSN"}, "the database to connect to"},
+	{[]string{"JWT_SECRET"}, "the secret share URLs, SSO states and device challenges are signed with"},
+	{[]string{"TIGRIS_STORAGE_ACCESS_KEY_ID"}, "the S3 access key"},
+	{[]string{"TIGRIS_STORAGE_SECRET_ACCESS_KEY"}, "the S3 secret key"},
+	{[]string{"TIGRIS_STORAGE_ENDPOINT"}, "the S3 endpoint"},
+	{[]string{"TIGRIS_BUCKET_NAME"}, "the S3 bucket files are stored in"},
+}
+
+// Validate checks through getenv that the settings startup needs are set,
+// naming every one that is missing
+func Validate(getenv func(string) string) error {
+	var missing []string
+	for _, r := range required {
+		set := false
+		for _, name := range r.names {
+			if strings.TrimSpace(getenv(name)) != "" {
+				set = true
+			}
+		}
+		if !set {
+			missing = append(missing, fmt.Sprintf("%s (%s)", strings.Join(r.names, " or "), r.what))
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return errors.New("missing " + strings.Join(missing, ", ") + "; set them in the environment, .env or the config file")
+}
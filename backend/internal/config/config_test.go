@@ -0,0 +1,101 @@
+package config
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	want := map[string]string{
+		"DB_DRIVER":             "sqlite",
+		"DB_DSN":                "/var/lib/envie/envie.db",
+		"CORS_ALLOWED_ORIGINS":  "https://app.example.com,tauri://localhost",
+		"LOG_PAYLOADS":          "true",
+		"LIMIT_MEMBERS_PER_ORG": "25",
+		"SENTRY_DSN":            "",
+	}
+
+	yamlPath := writeConfig(t, "envie.yaml", `
+db:
+  driver: sqlite
+  dsn: /var/lib/envie/envie.db
+cors_allowed_origins:
+  - https://app.example.com
+  - tauri://localhost
+log_payloads: true
+limit:
+  members_per_org: 25
+sentry_dsn:
+`)
+	tomlPath := writeConfig(t, "envie.toml", `
+cors_allowed_origins = ["https://app.example.com", "tauri://localhost"]
+log_payloads = true
+sentry_dsn = ""
+
+[db]
+driver = "sqlite"
+dsn = "/var/lib/envie/envie.db"
+
+[limit]
+members_per_org = 25
+`)
+	for _, path := range []string{yamlPath, tomlPath} {
+		got, err := Load(path)
+		if err != nil {
+			t.Fatalf("Load(%s): %v", filepath.Base(path), err)
+		}
+		if !maps.Equal(got, want) {
+			t.Errorf("Load(%s) = %v, want %v", filepath.Base(path), got, want)
+		}
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	for name, content := range map[string]string{
+		"twice.yaml":   "db_dsn: a\ndb:\n  dsn: b\n",
+		"key.yaml":     "db-dsn: a\n",
+		"nested.yaml":  "origins:\n  - a: b\n",
+		"format.json":  "{}",
+		"invalid.toml": "db = [",
+	} {
+		if _, err := Load(writeConfig(t, name, content)); err == nil {
+			t.Errorf("Load(%s) accepted it", name)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	env := map[string]string{
+		"DB_DSN":                           "postgres://localhost/envie",
+		"JWT_SECRET":                       "secret",
+		"JWT_SIGNING_KEYS":                 "2026-10:secret",
+		"TIGRIS_STORAGE_ACCESS_KEY_ID":     "id",
+		"TIGRIS_STORAGE_SECRET_ACCESS_KEY": "secret",
+		"TIGRIS_STORAGE_ENDPOINT":          "https://s3.example.com",
+		"TIGRIS_BUCKET_NAME":               "envie",
+	}
+	if err := Validate(func(name string) string { return env[name] }); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	delete(env, "DB_DSN")
+	// JWT_SIGNING_KEYS alone leaves share URLs, SSO states and device
+	// challenges without a secret
+	delete(env, "JWT_SECRET")
+	err := Validate(func(name string) string { return env[name] })
+	if err == nil || !strings.Contains(err.Error(), "DB_DSN (") || !strings.Contains(err.Error(), "JWT_SECRET (") {
+		t.Errorf("Validate() = %v, want both missing settings named", err)
+	}
+}
@@ -0,0 +1,166 @@
+// Package configsign signs the configs served to CLI tokens with the instance's
+// Ed25519 key, so a CLI that pins the public key can tell a config the server
+// sent from one a TLS-terminating proxy replayed or altered.
+//
+// A signature covers the project ID, the config checksum, the project key
+// version, a digest of the items as served and the time of signing. Each is
+// written with its length as a big-endian uint64 after the tag
+// envie-config-signature-v1, so no two payloads share a message.
+package configsign
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	keyEnv = "CONFIG_SIGNING_KEY"
+
+	// Algorithm names the signature scheme in responses
+	Algorithm = "ed25519"
+
+	messageTag = "envie-config-signature-v1"
+	digestTag  = "envie-config-items-v1"
+)
+
+// Item is the part of a served config item its digest covers
+type Item struct {
+	Name           string
+	EncryptedValue string
+	ValueType      string
+	Masked         bool
+}
+
+// Payload is what a signature covers
+type Payload struct {
+	ProjectID  string
+	Checksum   string
+	KeyVersion int
+	ItemDigest string
+	SignedAt   time.Time
+}
+
+// Signature - a signed config payload as responses carry it. SignedAt is RFC 3339
+// in UTC with second precision, as it is signed.
+type Signature struct {
+	KeyID      string `json:"keyId"`
+	Algorithm  string `json:"algorithm"`
+	KeyVersion int    `json:"keyVersion"`
+	ItemDigest string `json:"itemDigest"`
+	SignedAt   string `json:"signedAt"`
+	Value      string `json:"value"` // base64
+}
+
+// Signer signs configs with the instance key
+type Signer struct {
+	key ed25519.PrivateKey
+	id  string
+}
+
+// Current is the instance's signer, set from CONFIG_SIGNING_KEY at startup. Nil
+// serves configs unsigned.
+var Current *Signer
+
+// NewSigner signs with key
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	return &Signer{key: key, id: KeyID(key.Public().(ed25519.PublicKey))}
+}
+
+// FromEnv reads CONFIG_SIGNING_KEY, a base64 Ed25519 seed (32 bytes) or private
+// key (64 bytes). Unset returns nil.
+func FromEnv() (*Signer, error) {
+	value := strings.TrimSpace(os.Getenv(keyEnv))
+	if value == "" {
+		return nil, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: not base64", keyEnv)
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return NewSigner(ed25519.NewKeyFromSeed(raw)), nil
+	case ed25519.PrivateKeySize:
+		key := ed25519.PrivateKey(raw)
+		if !ed25519.NewKeyFromSeed(key.Seed()).Equal(key) {
+			return nil, fmt.Errorf("invalid %s: the public half doesn't match the seed", keyEnv)
+		}
+		return NewSigner(key), nil
+	default:
+		return nil, fmt.Errorf("invalid %s: expected a 32 byte seed or a 64 byte private key, got %d bytes", keyEnv, len(raw))
+	}
+}
+
+// KeyID names a public key in signatures: the first 8 bytes of its SHA-256, in
+// hex
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// KeyID is the ID of the signer's public key
+func (s *Signer) KeyID() string {
+	return s.id
+}
+
+// PublicKey is the signer's public key in base64, the value CLIs pin
+func (s *Signer) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey))
+}
+
+// Sign signs p, its time truncated to the second
+func (s *Signer) Sign(p Payload) *Signature {
+	p.SignedAt = p.SignedAt.UTC().Truncate(time.Second)
+	return &Signature{
+		KeyID:      s.id,
+		Algorithm:  Algorithm,
+		KeyVersion: p.KeyVersion,
+		ItemDigest: p.ItemDigest,
+		SignedAt:   p.SignedAt.Format(time.RFC3339),
+		Value:      base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, Message(p))),
+	}
+}
+
+// Message is the byte string signed for p
+func Message(p Payload) []byte {
+	fields := []string{
+		p.ProjectID,
+		p.Checksum,
+		strconv.Itoa(p.KeyVersion),
+		p.ItemDigest,
+		p.SignedAt.UTC().Format(time.RFC3339),
+	}
+	return framed(messageTag, fields)
+}
+
+// ItemDigest is the SHA-256, in hex, of the items in the order served: their
+// count, then each item's name, encrypted value, value type and whether it was
+// masked
+func ItemDigest(items []Item) string {
+	fields := make([]string, 0, 1+4*len(items))
+	fields = append(fields, strconv.Itoa(len(items)))
+	for _, item := range items {
+		fields = append(fields, item.Name, item.EncryptedValue, item.ValueType, strconv.FormatBool(item.Masked))
+	}
+	sum := sha256.Sum256(framed(digestTag, fields))
+	return hex.EncodeToString(sum[:])
+}
+
+// framed writes tag and fields, each prefixed with its length as a big-endian
+// uint64
+func framed(tag string, fields []string) []byte {
+	var b []byte
+	for _, field := range append([]string{tag}, fields...) {
+		b = binary.BigEndian.AppendUint64(b, uint64(len(field)))
+		b = append(b, field...)
+	}
+	return b
+}
@@ -0,0 +1,84 @@
+package configsign
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSeed = []byte("envie-config-signing-test-seed!!")
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv(keyEnv, "")
+	if signer, err := FromEnv(); signer != nil || err != nil {
+		t.Errorf("unset: %v, %v", signer, err)
+	}
+
+	key := ed25519.NewKeyFromSeed(testSeed)
+	for _, raw := range [][]byte{testSeed, key} {
+		t.Setenv(keyEnv, base64.StdEncoding.EncodeToString(raw))
+		signer, err := FromEnv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signer.PublicKey() != base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)) {
+			t.Errorf("public key %s from %d bytes", signer.PublicKey(), len(raw))
+		}
+	}
+
+	mismatched := append(append([]byte{}, testSeed...), make([]byte, ed25519.PublicKeySize)...)
+	for _, value := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("short")), base64.StdEncoding.EncodeToString(mismatched)} {
+		t.Setenv(keyEnv, value)
+		if _, err := FromEnv(); err == nil {
+			t.Errorf("%q accepted", value)
+		}
+	}
+}
+
+// The CLI checks the same vector in internal/api/signature_test.go
+func TestSignVector(t *testing.T) {
+	signer := NewSigner(ed25519.NewKeyFromSeed(testSeed))
+	digest := ItemDigest([]Item{
+		{Name: "A", EncryptedValue: "eA==", ValueType: "string"},
+		{Name: "B", ValueType: "string", Masked: true},
+	})
+	if want := "c112f6d55e86d8c3cd7c4c10a85357c2b5635922ee07cd3147de8ba53bb811de"; digest != want {
+		t.Errorf("digest %s, want %s", digest, want)
+	}
+
+	payload := Payload{
+		ProjectID:  "7d1f1c36-2b9a-4c55-9a1e-1f0a4c3e8b21",
+		Checksum:   "4c4820abcea6b7725146144d70c1ca12edef93776f5d5ee7b484290ab41fc561",
+		KeyVersion: 3,
+		ItemDigest: digest,
+		SignedAt:   time.Date(2026, 10, 16, 12, 0, 0, 500, time.FixedZone("CEST", 2*60*60)),
+	}
+	signature := signer.Sign(payload)
+	if signature.SignedAt != "2026-10-16T10:00:00Z" || signature.KeyID != signer.KeyID() || signature.Algorithm != Algorithm {
+		t.Errorf("signature %+v", signature)
+	}
+	if want := "GsKg/q+NzcSIPlDH10vu331gfKak+vBjxpKBN23mtS2SXFg2/XYG6ed4HrGv+jSdAaUJ61uA4v+VKqUN/pKAAQ=="; signature.Value != want {
+		t.Errorf("signature %s, want %s", signature.Value, want)
+	}
+
+	value, _ := base64.StdEncoding.DecodeString(signature.Value)
+	public := ed25519.NewKeyFromSeed(testSeed).Public().(ed25519.PublicKey)
+	if !ed25519.Verify(public, Message(payload), value) {
+		t.Error("signature doesn't verify")
+	}
+	payload.KeyVersion = 4
+	if ed25519.Verify(public, Message(payload), value) {
+		t.Error("signature verifies another key version")
+	}
+}
+
+// Framing keeps fields that run into each other apart
+func TestItemDigestFraming(t *testing.T) {
+	a := ItemDigest([]Item{{Name: "AB", EncryptedValue: "C"}})
+	b := ItemDigest([]Item{{Name: "A", EncryptedValue: "BC"}})
+	if a == b || len(a) != 64 || strings.Trim(a, "0123456789abcdef") != "" {
+		t.Errorf("digests %s and %s", a, b)
+	}
+}
@@ -0,0 +1,52 @@
+// Package configwatch notifies in-process watchers when a project's config changes.
+//
+// Notifications only reach subscribers in the same process; watchers on other
+// instances fall back to polling the project's config checksum.
+package configwatch
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+var (
+	mu          sync.Mutex
+	subscribers = map[uuid.UUID]map[chan struct{}]struct{}{}
+)
+
+// Subscribe registers for change notifications on a project.
+// Bursts of changes are coalesced into a single pending notification.
+// Call the returned function to unsubscribe.
+func Subscribe(projectID uuid.UUID) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	mu.Lock()
+	if subscribers[projectID] == nil {
+		subscribers[projectID] = map[chan struct{}]struct{}{}
+	}
+	subscribers[projectID][ch] = struct{}{}
+	mu.Unlock()
+
+	return ch, func() {
+		mu.Lock()
+		delete(subscribers[projectID], ch)
+		if len(subscribers[projectID]) == 0 {
+			delete(subscribers, projectID)
+		}
+		mu.Unlock()
+	}
+}
+
+// Publish notifies every subscriber of a project that its config changed
+func Publish(projectID uuid.UUID) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for ch := range subscribers[projectID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
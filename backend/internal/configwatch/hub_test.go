@@ -0,0 +1,68 @@
+package configwatch
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPublishNotifiesProjectSubscribers(t *testing.T) {
+	projectID := uuid.New()
+	other := uuid.New()
+
+	ch, unsubscribe := Subscribe(projectID)
+	defer unsubscribe()
+	otherCh, unsubscribeOther := Subscribe(other)
+	defer unsubscribeOther()
+
+	Publish(projectID)
+
+	select {
+	case <-ch:
+	default:
+		t.Fatal("subscriber was not notified")
+	}
+	select {
+	case <-otherCh:
+		t.Fatal("subscriber of another project was notified")
+	default:
+	}
+}
+
+func TestPublishCoalescesBursts(t *testing.T) {
+	projectID := uuid.New()
+	ch, unsubscribe := Subscribe(projectID)
+	defer unsubscribe()
+
+	Publish(projectID)
+	Publish(projectID)
+	Publish(projectID)
+
+	<-ch
+	select {
+	case <-ch:
+		t.Fatal("expected a single pending notification")
+	default:
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	projectID := uuid.New()
+	ch, unsubscribe := Subscribe(projectID)
+	unsubscribe()
+
+	Publish(projectID)
+
+	select {
+	case <-ch:
+		t.Fatal("unsubscribed channel was notified")
+	default:
+	}
+
+	mu.Lock()
+	_, exists := subscribers[projectID]
+	mu.Unlock()
+	if exists {
+		t.Fatal("project entry was not removed after the last unsubscribe")
+	}
+}
@@ -0,0 +1,51 @@
+package crypto
+
+// Envelope versions for data wrapped to a recipient's public key.
+//
+// v1: AlgX25519HKDF, also stored as legacy plain base64
+// v2: AlgX25519MLKEM768, only ever written in the versioned blob format (see Algorithm)
+//
+// v2 is a hybrid X25519 + ML-KEM-768 scheme, so wrapped keys stay confidential unless
+// both the classical and the post-quantum KEM are broken. Clients pick the version when
+// wrapping and announce what they can unwrap; the server only stores and forwards envelopes.
+//
+// The server never wraps v2 envelopes itself: the desktop app produces them when a
+// token is created, so only the ML-KEM key derivation is needed here (see GenerateToken).
+const (
+	EnvelopeV1 = 1
+	EnvelopeV2 = 2
+
+	MLKEMSeedSize             = 64
+	MLKEMEncapsulationKeySize = 1184
+	MLKEMCiphertextSize       = 1088
+)
+
+// SupportedEnvelopeVersions lists every envelope version this build understands
+var SupportedEnvelopeVersions = []int{EnvelopeV1, EnvelopeV2}
+
+// EnvelopeVersion returns the version of an encoded envelope, or 0 if the blob uses
+// an algorithm that isn't a public key envelope
+func EnvelopeVersion(encoded string) int {
+	alg, err := BlobAlgorithm(encoded, AlgX25519HKDF)
+	if err != nil {
+		return 0
+	}
+	switch alg {
+	case AlgX25519HKDF:
+		return EnvelopeV1
+	case AlgX25519MLKEM768:
+		return EnvelopeV2
+	default:
+		return 0
+	}
+}
+
+// IsSupportedEnvelopeVersion reports whether version is a known envelope version
+func IsSupportedEnvelopeVersion(version int) bool {
+	for _, v := range SupportedEnvelopeVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Fuzz targets for the parsers that run on unauthenticated input. The seeds below
+// and testdata/fuzz/<target> run as regular tests; to fuzz, e.g.
+//
+//	go test ./internal/crypto -run '^$' -fuzz FuzzDecodeBlob -fuzztime 1m
+//
+// New failing inputs are written to testdata/fuzz and should be committed with the fix.
+
+func FuzzHashIdentityID(f *testing.F) {
+	for _, v := range loadTestVectors(f).Tokens {
+		f.Add(v.IdentityID)
+	}
+	f.Add("")
+	f.Add("zz")
+	f.Add(strings.Repeat("a", 2*IdentityIDSize+1))
+
+	f.Fuzz(func(t *testing.T, identityID string) {
+		hash, err := HashIdentityID(identityID)
+		if err != nil {
+			return
+		}
+		if decoded, _ := hex.DecodeString(identityID); len(decoded) != IdentityIDSize {
+			t.Fatalf("accepted identity ID of %d bytes", len(decoded))
+		}
+		if len(hash) != 64 || strings.ToLower(hash) != hash {
+			t.Fatalf("hash %q is not lowercase hex SHA-256", hash)
+		}
+		if _, err := hex.DecodeString(hash); err != nil {
+			t.Fatalf("hash %q is not hex: %v", hash, err)
+		}
+	})
+}
+
+func FuzzDecodeBlob(f *testing.F) {
+	addBlobSeeds(f)
+
+	f.Fuzz(func(t *testing.T, encoded string) {
+		alg, body, err := DecodeBlob(encoded, AlgX25519HKDF)
+		if err != nil {
+			return
+		}
+		if !slices.Contains(SupportedAlgorithms, alg) {
+			t.Fatalf("DecodeBlob returned unsupported algorithm 0x%02x", byte(alg))
+		}
+		if !IsVersionedBlob(encoded) && alg != AlgX25519HKDF {
+			t.Fatalf("legacy blob decoded as 0x%02x", byte(alg))
+		}
+
+		reAlg, reBody, err := DecodeBlob(EncodeBlob(alg, body), AlgAESGCM)
+		if err != nil || reAlg != alg || !bytes.Equal(reBody, body) {
+			t.Fatalf("EncodeBlob does not round-trip: alg 0x%02x, err %v", byte(reAlg), err)
+		}
+	})
+}
+
+func FuzzEnvelopeVersion(f *testing.F) {
+	addBlobSeeds(f)
+
+	f.Fuzz(func(t *testing.T, encoded string) {
+		version := EnvelopeVersion(encoded)
+		if version != 0 && !IsSupportedEnvelopeVersion(version) {
+			t.Fatalf("EnvelopeVersion = %d", version)
+		}
+
+		alg, err := BlobAlgorithm(encoded, AlgX25519HKDF)
+		if err != nil && version != 0 {
+			t.Fatalf("invalid blob reported as envelope v%d", version)
+		}
+		if version == EnvelopeV2 && alg != AlgX25519MLKEM768 {
+			t.Fatalf("v2 envelope with algorithm 0x%02x", byte(alg))
+		}
+	})
+}
+
+func addBlobSeeds(f *testing.F) {
+	vectors := loadTestVectors(f)
+	for _, v := range vectors.Envelopes {
+		f.Add(v.Encoded)
+	}
+	for _, v := range vectors.ConfigValues {
+		f.Add(v.Encoded)
+	}
+	for _, v := range vectors.InvalidBlobs {
+		f.Add(v.Encoded)
+	}
+	f.Add("")
+	f.Add(VersionedBlobPrefix)
+	f.Add("$$")
+}
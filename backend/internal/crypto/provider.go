@@ -0,0 +1,44 @@
+package crypto
+
+// Provider supplies the cryptographic primitives behind envie's encryption scheme
+// (X25519 ECDH + HKDF-SHA256 + AES-256-GCM). Callers in this package never use the
+// primitives directly, so a build can swap in a FIPS-validated module or a
+// post-quantum hybrid implementation without touching the envelope format code.
+type Provider interface {
+	// Name identifies the provider in logs and diagnostics
+	Name() string
+
+	// Random fills b with cryptographically secure random bytes
+	Random(b []byte) error
+
+	// X25519 computes the shared secret between a private scalar and a peer public key
+	X25519(privateKey, peerPublicKey []byte) ([]byte, error)
+
+	// X25519PublicKey derives the public key for a private scalar
+	X25519PublicKey(privateKey []byte) ([]byte, error)
+
+	// HKDF derives length bytes from secret using HKDF-SHA256 with an empty salt
+	HKDF(secret, info []byte, length int) ([]byte, error)
+
+	// SealAESGCM encrypts and authenticates plaintext, returning ciphertext || tag
+	SealAESGCM(key, iv, plaintext []byte) ([]byte, error)
+
+	// MLKEM768EncapsulationKey derives the ML-KEM-768 encapsulation (public) key from a 64 byte seed
+	MLKEM768EncapsulationKey(seed []byte) ([]byte, error)
+}
+
+var provider Provider = defaultProvider()
+
+// SetProvider replaces the active crypto provider. It must be called during
+// startup, before any keys are generated or data is encrypted.
+func SetProvider(p Provider) {
+	if p == nil {
+		panic("crypto: nil provider")
+	}
+	provider = p
+}
+
+// CurrentProvider returns the active crypto provider
+func CurrentProvider() Provider {
+	return provider
+}
@@ -1,17 +1,10 @@
 package crypto
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
-	"io"
-
-	"golang.org/x/crypto/curve25519"
-	"golang.org/x/crypto/hkdf"
 )
 
 const (
@@ -19,6 +12,7 @@ const (
 	TokenLength            = 32
 	EphemeralPublicKeySize = 32
 	IVSize                 = 12
+	IdentityIDSize         = 16
 )
 
 type GeneratedToken struct {
@@ -26,11 +20,12 @@ type GeneratedToken struct {
 	TokenPrefix    string
 	IdentityIDHash string
 	PublicKey      []byte
+	KEMPublicKey   []byte // ML-KEM-768 encapsulation key for hybrid (v2) envelopes
 }
 
 func GenerateToken() (*GeneratedToken, error) {
 	tokenBytes := make([]byte, TokenLength)
-	if _, err := rand.Read(tokenBytes); err != nil {
+	if err := provider.Random(tokenBytes); err != nil {
 		return nil, fmt.Errorf("failed to generate random bytes: %w", err)
 	}
 
@@ -38,7 +33,7 @@ func GenerateToken() (*GeneratedToken, error) {
 	token := TokenPrefix + encoded
 	prefix := encoded[:3]
 
-	identityIDBytes, err := hkdfDerive(tokenBytes, []byte("envie-identity-id"), 16)
+	identityIDBytes, err := provider.HKDF(tokenBytes, []byte("envie-identity-id"), IdentityIDSize)
 	if err != nil {
 		return nil, fmt.Errorf("failed to derive identity ID: %w", err)
 	}
@@ -46,21 +41,32 @@ func GenerateToken() (*GeneratedToken, error) {
 	hash := sha256.Sum256(identityIDBytes)
 	identityIDHash := hex.EncodeToString(hash[:])
 
-	privateKey, err := hkdfDerive(tokenBytes, []byte("envie-private-key"), 32)
+	privateKey, err := provider.HKDF(tokenBytes, []byte("envie-private-key"), 32)
 	if err != nil {
 		return nil, fmt.Errorf("failed to derive private key: %w", err)
 	}
 
-	publicKey, err := curve25519.X25519(privateKey, curve25519.Basepoint)
+	publicKey, err := provider.X25519PublicKey(privateKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to derive public key: %w", err)
 	}
 
+	kemSeed, err := provider.HKDF(tokenBytes, []byte("envie-mlkem-seed"), MLKEMSeedSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive ML-KEM seed: %w", err)
+	}
+
+	kemPublicKey, err := provider.MLKEM768EncapsulationKey(kemSeed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive ML-KEM public key: %w", err)
+	}
+
 	return &GeneratedToken{
 		Token:          token,
 		TokenPrefix:    prefix,
 		IdentityIDHash: identityIDHash,
 		PublicKey:      publicKey,
+		KEMPublicKey:   kemPublicKey,
 	}, nil
 }
 
@@ -68,31 +74,31 @@ func GenerateToken() (*GeneratedToken, error) {
 // Output format: ephemeral_public_key (32) || iv (12) || ciphertext+tag
 func EncryptToPublicKey(publicKey []byte, plaintext []byte) ([]byte, error) {
 	ephemeralPrivate := make([]byte, 32)
-	if _, err := rand.Read(ephemeralPrivate); err != nil {
+	if err := provider.Random(ephemeralPrivate); err != nil {
 		return nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
 	}
 
-	ephemeralPublic, err := curve25519.X25519(ephemeralPrivate, curve25519.Basepoint)
+	ephemeralPublic, err := provider.X25519PublicKey(ephemeralPrivate)
 	if err != nil {
 		return nil, fmt.Errorf("failed to derive ephemeral public key: %w", err)
 	}
 
-	sharedSecret, err := curve25519.X25519(ephemeralPrivate, publicKey)
+	sharedSecret, err := provider.X25519(ephemeralPrivate, publicKey)
 	if err != nil {
 		return nil, fmt.Errorf("X25519 key exchange failed: %w", err)
 	}
 
-	aesKey, err := deriveAESKey(sharedSecret)
+	aesKey, err := provider.HKDF(sharedSecret, []byte("envie-encrypt"), 32)
 	if err != nil {
 		return nil, fmt.Errorf("key derivation failed: %w", err)
 	}
 
 	iv := make([]byte, IVSize)
-	if _, err := rand.Read(iv); err != nil {
+	if err := provider.Random(iv); err != nil {
 		return nil, fmt.Errorf("failed to generate IV: %w", err)
 	}
 
-	ciphertext, err := encryptAESGCM(aesKey, iv, plaintext)
+	ciphertext, err := provider.SealAESGCM(aesKey, iv, plaintext)
 	if err != nil {
 		return nil, fmt.Errorf("AES-GCM encryption failed: %w", err)
 	}
@@ -110,46 +116,19 @@ func EncryptToPublicKeyBase64(publicKey []byte, plaintext []byte) (string, error
 	if err != nil {
 		return "", err
 	}
-	return base64.StdEncoding.EncodeToString(encrypted), nil
-}
-
-func hkdfDerive(secret, info []byte, length int) ([]byte, error) {
-	reader := hkdf.New(sha256.New, secret, nil, info)
-	result := make([]byte, length)
-	if _, err := io.ReadFull(reader, result); err != nil {
-		return nil, err
-	}
-	return result, nil
-}
-
-func deriveAESKey(sharedSecret []byte) ([]byte, error) {
-	reader := hkdf.New(sha256.New, sharedSecret, nil, []byte("envie-encrypt"))
-	key := make([]byte, 32)
-	if _, err := io.ReadFull(reader, key); err != nil {
-		return nil, err
-	}
-	return key, nil
-}
-
-func encryptAESGCM(key, iv, plaintext []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
-	}
-
-	aesGCM, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
-	}
-
-	return aesGCM.Seal(nil, iv, plaintext, nil), nil
+	return EncodeBlob(AlgX25519HKDF, encrypted), nil
 }
 
+// HashIdentityID returns the lookup hash of a hex encoded identity ID. It runs on
+// unauthenticated input, so anything but IdentityIDSize bytes of hex is rejected.
 func HashIdentityID(identityID string) (string, error) {
 	identityBytes, err := hex.DecodeString(identityID)
 	if err != nil {
 		return "", fmt.Errorf("invalid identity ID format: %w", err)
 	}
+	if len(identityBytes) != IdentityIDSize {
+		return "", fmt.Errorf("invalid identity ID length: expected %d bytes, got %d", IdentityIDSize, len(identityBytes))
+	}
 	hash := sha256.Sum256(identityBytes)
 	return hex.EncodeToString(hash[:]), nil
 }
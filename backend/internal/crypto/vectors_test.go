@@ -0,0 +1,205 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+)
+
+// vectorsPath is the test vector file shared with cli/internal/crypto
+const vectorsPath = "../../../testdata/crypto-vectors.json"
+
+type testVectors struct {
+	Tokens []struct {
+		Name               string `json:"name"`
+		TokenBytes         string `json:"tokenBytes"`
+		Token              string `json:"token"`
+		TokenPrefix        string `json:"tokenPrefix"`
+		IdentityID         string `json:"identityId"`
+		IdentityIDHash     string `json:"identityIdHash"`
+		PublicKey          string `json:"publicKey"`
+		KEMPublicKeySHA256 string `json:"kemPublicKeySha256"`
+	} `json:"tokens"`
+	Envelopes []struct {
+		Name                string `json:"name"`
+		Token               string `json:"token"`
+		EphemeralPrivateKey string `json:"ephemeralPrivateKey"`
+		IV                  string `json:"iv"`
+		Plaintext           string `json:"plaintext"`
+		Algorithm           int    `json:"algorithm"`
+		EnvelopeVersion     int    `json:"envelopeVersion"`
+		Encoded             string `json:"encoded"`
+	} `json:"envelopes"`
+	ConfigValues []struct {
+		Name    string `json:"name"`
+		Encoded string `json:"encoded"`
+	} `json:"configValues"`
+	InvalidBlobs []struct {
+		Name    string `json:"name"`
+		Encoded string `json:"encoded"`
+	} `json:"invalidBlobs"`
+}
+
+func loadTestVectors(t testing.TB) *testVectors {
+	t.Helper()
+
+	data, err := os.ReadFile(vectorsPath)
+	if err != nil {
+		t.Fatalf("failed to read test vectors: %v", err)
+	}
+
+	var vectors testVectors
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatalf("failed to parse test vectors: %v", err)
+	}
+	return &vectors
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid hex in test vectors: %v", err)
+	}
+	return b
+}
+
+// fixedRandomProvider replays predetermined bytes from Random so encryption is reproducible
+type fixedRandomProvider struct {
+	Provider
+	random io.Reader
+}
+
+func (p fixedRandomProvider) Random(b []byte) error {
+	if _, err := io.ReadFull(p.random, b); err != nil {
+		return fmt.Errorf("fixed random source exhausted: %w", err)
+	}
+	return nil
+}
+
+// withFixedRandom runs fn with a provider whose Random returns the given bytes in order
+func withFixedRandom(t *testing.T, random []byte, fn func()) {
+	t.Helper()
+
+	original := CurrentProvider()
+	SetProvider(fixedRandomProvider{Provider: original, random: bytes.NewReader(random)})
+	defer SetProvider(original)
+
+	fn()
+}
+
+func TestVectorsTokenGeneration(t *testing.T) {
+	for _, v := range loadTestVectors(t).Tokens {
+		t.Run(v.Name, func(t *testing.T) {
+			var token *GeneratedToken
+			var err error
+			withFixedRandom(t, mustHex(t, v.TokenBytes), func() {
+				token, err = GenerateToken()
+			})
+			if err != nil {
+				t.Fatalf("GenerateToken failed: %v", err)
+			}
+
+			if token.Token != v.Token {
+				t.Errorf("token = %s, want %s", token.Token, v.Token)
+			}
+			if token.TokenPrefix != v.TokenPrefix {
+				t.Errorf("token prefix = %s, want %s", token.TokenPrefix, v.TokenPrefix)
+			}
+			if token.IdentityIDHash != v.IdentityIDHash {
+				t.Errorf("identity ID hash = %s, want %s", token.IdentityIDHash, v.IdentityIDHash)
+			}
+			if got := hex.EncodeToString(token.PublicKey); got != v.PublicKey {
+				t.Errorf("public key = %s, want %s", got, v.PublicKey)
+			}
+			kemHash := sha256.Sum256(token.KEMPublicKey)
+			if got := hex.EncodeToString(kemHash[:]); got != v.KEMPublicKeySHA256 {
+				t.Errorf("ML-KEM public key hash = %s, want %s", got, v.KEMPublicKeySHA256)
+			}
+
+			hash, err := HashIdentityID(v.IdentityID)
+			if err != nil || hash != v.IdentityIDHash {
+				t.Errorf("HashIdentityID = %s (%v), want %s", hash, err, v.IdentityIDHash)
+			}
+		})
+	}
+}
+
+func TestVectorsEnvelopeEncryption(t *testing.T) {
+	vectors := loadTestVectors(t)
+
+	publicKeys := map[string][]byte{}
+	for _, v := range vectors.Tokens {
+		publicKeys[v.Name] = mustHex(t, v.PublicKey)
+	}
+
+	for _, v := range vectors.Envelopes {
+		// Only versioned v1 envelopes are produced by the server; the rest are parsed below
+		if v.Algorithm != int(AlgX25519HKDF) || !IsVersionedBlob(v.Encoded) {
+			continue
+		}
+
+		t.Run(v.Name, func(t *testing.T) {
+			random := append(mustHex(t, v.EphemeralPrivateKey), mustHex(t, v.IV)...)
+
+			var encoded string
+			var err error
+			withFixedRandom(t, random, func() {
+				encoded, err = EncryptToPublicKeyBase64(publicKeys[v.Token], mustHex(t, v.Plaintext))
+			})
+			if err != nil {
+				t.Fatalf("EncryptToPublicKeyBase64 failed: %v", err)
+			}
+			if encoded != v.Encoded {
+				t.Errorf("encoded = %s, want %s", encoded, v.Encoded)
+			}
+		})
+	}
+}
+
+func TestVectorsEnvelopeParsing(t *testing.T) {
+	for _, v := range loadTestVectors(t).Envelopes {
+		t.Run(v.Name, func(t *testing.T) {
+			alg, err := BlobAlgorithm(v.Encoded, AlgX25519HKDF)
+			if err != nil {
+				t.Fatalf("BlobAlgorithm failed: %v", err)
+			}
+			if int(alg) != v.Algorithm {
+				t.Errorf("algorithm = %d, want %d", alg, v.Algorithm)
+			}
+			if got := EnvelopeVersion(v.Encoded); got != v.EnvelopeVersion {
+				t.Errorf("envelope version = %d, want %d", got, v.EnvelopeVersion)
+			}
+		})
+	}
+}
+
+func TestVectorsConfigValueParsing(t *testing.T) {
+	for _, v := range loadTestVectors(t).ConfigValues {
+		t.Run(v.Name, func(t *testing.T) {
+			alg, err := BlobAlgorithm(v.Encoded, AlgAESGCM)
+			if err != nil {
+				t.Fatalf("BlobAlgorithm failed: %v", err)
+			}
+			if alg != AlgAESGCM {
+				t.Errorf("algorithm = %d, want %d", alg, AlgAESGCM)
+			}
+		})
+	}
+}
+
+func TestVectorsInvalidBlobs(t *testing.T) {
+	for _, v := range loadTestVectors(t).InvalidBlobs {
+		t.Run(v.Name, func(t *testing.T) {
+			if _, _, err := DecodeBlob(v.Encoded, AlgAESGCM); err == nil {
+				t.Error("expected DecodeBlob to fail")
+			}
+		})
+	}
+}
@@ -1,62 +1,265 @@
 package database
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"time"
 
+	"envie-backend/internal/authcache"
 	"envie-backend/internal/models"
+	"envie-backend/internal/redact"
+	"envie-backend/internal/tracing"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 var DB *gorm.DB
 
+// Drivers DB_DRIVER selects between
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
 func Connect() {
 	dsn := os.Getenv("DB_DSN")
 	if dsn == "" {
 		log.Fatal("DB_DSN environment variable not set")
 	}
+	pool, err := PoolConfigFrom(os.Getenv)
+	if err != nil {
+		log.Fatal("Invalid connection pool configuration: ", err)
+	}
+
+	var dialector gorm.Dialector
+	switch driver := os.Getenv("DB_DRIVER"); driver {
+	case "", DriverPostgres:
+		config, err := pgx.ParseConfig(dsn)
+		if err != nil {
+			log.Fatal("Invalid DB_DSN:", err)
+		}
+		config.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+		// Sessions run in UTC so timestamptz values read back in UTC, whatever the
+		// server's default, and timestamps are written in UTC, see apitime
+		config.RuntimeParams["timezone"] = "UTC"
+		dialector = postgres.New(postgres.Config{
+			Conn: stdlib.OpenDB(*config),
+		})
+	case DriverSQLite:
+		dialector = openSQLite(dsn)
+	default:
+		log.Fatalf("Invalid DB_DRIVER %q: use %s or %s", driver, DriverPostgres, DriverSQLite)
+	}
 
-	db, err := gorm.Open(postgres.New(postgres.Config{
-		DSN:                  dsn,
-		PreferSimpleProtocol: true,
-	}), &gorm.Config{
+	db, err := gorm.Open(dialector, &gorm.Config{
 		SkipDefaultTransaction: true,
 		PrepareStmt:            false,
+		NowFunc: func() time.Time {
+			return time.Now().UTC()
+		},
+		// Slow and failed queries are logged with placeholders instead of the bound
+		// values, which are mostly ciphertext
+		Logger: logger.New(log.New(redact.NewWriter(os.Stdout), "\r\n", log.LstdFlags), logger.Config{
+			SlowThreshold:        200 * time.Millisecond,
+			LogLevel:             logger.Warn,
+			ParameterizedQueries: true,
+		}),
 	})
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	log.Println("Database connection established")
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	pool.apply(sqlDB)
+	log.Printf("Database connection established (%s)", pool)
+
+	if err := authcache.RegisterCallbacks(db); err != nil {
+		log.Fatal("Failed to register cache callbacks:", err)
+	}
+	if err := tracing.RegisterCallbacks(db); err != nil {
+		log.Fatal("Failed to register tracing callbacks:", err)
+	}
 
 	log.Println("Running migrations...")
+	if err := migrate(db); err != nil {
+		log.Fatal("Failed to migrate database:", err)
+	}
+	if err := registerStatementTimeout(db, pool.StatementTimeout); err != nil {
+		log.Fatal("Failed to register statement timeout callbacks:", err)
+	}
+
+	DB = db
+}
+
+// migrate brings the schema up to date with the models
+func migrate(db *gorm.DB) error {
 	if err := db.AutoMigrate(
 		&models.User{},
 		&models.Project{},
 		&models.ConfigItem{},
+		&models.ConfigSnapshot{},
+		&models.ConfigDraft{},
 		&models.SecretManagerConfig{},
 		&models.UserIdentity{},
 
 		&models.Organization{},
+		&models.Role{},
 		&models.OrganizationUser{},
 		&models.Team{},
 		&models.TeamUser{},
 		&models.TeamProject{},
+		&models.PendingKeyGrant{},
+
+		&models.RecoveryEscrow{},
+		&models.RecoveryShare{},
+		&models.RecoveryRequest{},
+		&models.RecoveryApproval{},
+		&models.RecoveryEvent{},
+
+		&models.PendingProjectDeletion{},
+		&models.ProjectRename{},
+		&models.ProjectTag{},
+		&models.ProjectFavorite{},
+		&models.ProjectSchemaVariable{},
+
+		&models.ComplianceLabel{},
+		&models.ProjectComplianceLabel{},
+		&models.ConfigItemComplianceLabel{},
 
 		&models.PendingKeyRotation{},
 		&models.KeyRotationApproval{},
+		&models.KeyRotationPolicy{},
 
 		&models.ProjectFile{},
+		&models.FileUpload{},
 
 		&models.LinkingCode{},
+		&models.LinkingCodeFailure{},
+		&models.DevicePairing{},
+		&models.OrganizationSSO{},
+		&models.UserSSOIdentity{},
 
 		&models.ProjectToken{},
-		// RefreshToken table no longer needed - using stateless JWTs
+
+		&models.DeploymentTarget{},
+		&models.DeploymentSync{},
+
+		&models.IdempotencyKey{},
+		&models.RefreshToken{},
+		&models.RecoveryCode{},
+		&models.TwoFactorEvent{},
+
+		&models.OrganizationAlert{},
+		&models.PublicShare{},
+		&models.FileShare{},
+		&models.FileShareAccess{},
+		&models.Notification{},
+		&models.AccessLog{},
+		&models.AuditEvent{},
+		&models.AuditStream{},
+		&models.InstanceEvent{},
+		&models.TokenAnomaly{},
+		&models.TokenNetwork{},
+		&models.TokenUsageBucket{},
 	); err != nil {
-		log.Fatal("Failed to migrate database:", err)
+		return err
+	}
+	if err := backfillProjectSlugs(db); err != nil {
+		return fmt.Errorf("assigning project slugs: %w", err)
+	}
+	if err := backfillConfigChecksums(db); err != nil {
+		return fmt.Errorf("upgrading config checksums: %w", err)
 	}
+	if err := dropReplacedIndexes(db); err != nil {
+		return fmt.Errorf("dropping replaced indexes: %w", err)
+	}
+	return nil
+}
 
-	DB = db
+// replacedIndexes were superseded by composite indexes that lead with the same
+// column; AutoMigrate adds indexes but never drops them
+var replacedIndexes = []struct {
+	model any
+	name  string
+}{
+	{&models.ConfigItem{}, "idx_config_items_project_id"},
+}
+
+func dropReplacedIndexes(db *gorm.DB) error {
+	for _, index := range replacedIndexes {
+		if !db.Migrator().HasIndex(index.model, index.name) {
+			continue
+		}
+		if err := db.Migrator().DropIndex(index.model, index.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillProjectSlugs assigns slugs to projects created before slugs existed
+func backfillProjectSlugs(db *gorm.DB) error {
+	var projects []models.Project
+	if err := db.Unscoped().Where("slug IS NULL OR slug = ''").Order("created_at").Find(&projects).Error; err != nil {
+		return err
+	}
+	for i := range projects {
+		if err := projects[i].AssignSlug(db); err != nil {
+			return err
+		}
+		if err := db.Unscoped().Model(&projects[i]).UpdateColumn("slug", projects[i].Slug).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillConfigChecksums moves the checksums of projects and snapshots stored in
+// version 1 to models.ConfigChecksumVersion, keeping the version 1 checksum as
+// the legacy one. Audit events keep the checksums they recorded.
+func backfillConfigChecksums(db *gorm.DB) error {
+	var projects []models.Project
+	err := db.Unscoped().Select("id").
+		Where("config_checksum IS NOT NULL AND legacy_config_checksum IS NULL").
+		FindInBatches(&projects, 100, func(tx *gorm.DB, batch int) error {
+			for _, project := range projects {
+				var items []models.ConfigItem
+				if err := db.Where("project_id = ?", project.ID).Order("position asc").Find(&items).Error; err != nil {
+					return err
+				}
+				if err := db.Unscoped().Model(&models.Project{}).Where("id = ?", project.ID).UpdateColumns(map[string]interface{}{
+					"config_checksum":        models.ConfigChecksum(items),
+					"legacy_config_checksum": models.LegacyConfigChecksum(items),
+				}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	var snapshots []models.ConfigSnapshot
+	return db.Where("legacy_checksum IS NULL OR legacy_checksum = ''").
+		FindInBatches(&snapshots, 100, func(tx *gorm.DB, batch int) error {
+			for _, snapshot := range snapshots {
+				items := snapshot.ConfigItems()
+				if err := db.Model(&models.ConfigSnapshot{}).Where("id = ?", snapshot.ID).UpdateColumns(map[string]interface{}{
+					"checksum":        models.ConfigChecksum(items),
+					"legacy_checksum": models.LegacyConfigChecksum(items),
+				}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
 }
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	maxOpenConnsEnv     = "DB_MAX_OPEN_CONNS"
+	maxIdleConnsEnv     = "DB_MAX_IDLE_CONNS"
+	connMaxLifetimeEnv  = "DB_CONN_MAX_LIFETIME"
+	connMaxIdleTimeEnv  = "DB_CONN_MAX_IDLE_TIME"
+	statementTimeoutEnv = "DB_STATEMENT_TIMEOUT"
+
+	statementCancelKey = "database:cancel_statement"
+)
+
+// PoolConfig sizes the connection pool and bounds how long a statement may run.
+// A bounded pool makes requests queue for a connection instead of opening more
+// than the database accepts, and the statement timeout keeps a slow query from
+// holding its connection, and the requests queued behind it, indefinitely.
+type PoolConfig struct {
+	MaxOpenConns     int           // 0 is unlimited
+	MaxIdleConns     int           // 0 keeps none idle
+	ConnMaxLifetime  time.Duration // 0 keeps connections forever
+	ConnMaxIdleTime  time.Duration // 0 keeps idle connections forever
+	StatementTimeout time.Duration // 0 disables it
+}
+
+// DefaultPoolConfig is used for the settings that aren't set
+var DefaultPoolConfig = PoolConfig{
+	MaxOpenConns:     25,
+	MaxIdleConns:     10,
+	ConnMaxLifetime:  30 * time.Minute,
+	ConnMaxIdleTime:  5 * time.Minute,
+	StatementTimeout: 30 * time.Second,
+}
+
+// PoolConfigFrom reads the DB_* pool variables through getenv
+func PoolConfigFrom(getenv func(string) string) (PoolConfig, error) {
+	config := DefaultPoolConfig
+	var err error
+	if config.MaxOpenConns, err = parseCount(getenv, maxOpenConnsEnv, config.MaxOpenConns); err != nil {
+		return config, err
+	}
+	if config.MaxIdleConns, err = parseCount(getenv, maxIdleConnsEnv, config.MaxIdleConns); err != nil {
+		return config, err
+	}
+	if config.ConnMaxLifetime, err = parseDuration(getenv, connMaxLifetimeEnv, config.ConnMaxLifetime); err != nil {
+		return config, err
+	}
+	if config.ConnMaxIdleTime, err = parseDuration(getenv, connMaxIdleTimeEnv, config.ConnMaxIdleTime); err != nil {
+		return config, err
+	}
+	if config.StatementTimeout, err = parseDuration(getenv, statementTimeoutEnv, config.StatementTimeout); err != nil {
+		return config, err
+	}
+	if config.MaxOpenConns > 0 && config.MaxIdleConns > config.MaxOpenConns {
+		return config, fmt.Errorf("%s (%d) must not exceed %s (%d)", maxIdleConnsEnv, config.MaxIdleConns, maxOpenConnsEnv, config.MaxOpenConns)
+	}
+	return config, nil
+}
+
+func parseCount(getenv func(string) string, name string, fallback int) (int, error) {
+	value := strings.TrimSpace(getenv(name))
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a number of at least 0, got %q", name, value)
+	}
+	return n, nil
+}
+
+func parseDuration(getenv func(string) string, name string, fallback time.Duration) (time.Duration, error) {
+	value := strings.TrimSpace(getenv(name))
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s must be a duration such as 30s, got %q", name, value)
+	}
+	return d, nil
+}
+
+func (p PoolConfig) apply(db *sql.DB) {
+	db.SetMaxOpenConns(p.MaxOpenConns)
+	db.SetMaxIdleConns(p.MaxIdleConns)
+	db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+}
+
+// String describes the pool for the log
+func (p PoolConfig) String() string {
+	return fmt.Sprintf("max %d open, %d idle, lifetime %s, idle time %s, statement timeout %s",
+		p.MaxOpenConns, p.MaxIdleConns, p.ConnMaxLifetime, p.ConnMaxIdleTime, p.StatementTimeout)
+}
+
+// registerStatementTimeout gives every statement a context deadline of timeout,
+// unless its context ends sooner. On Postgres the driver then cancels the query
+// on the server too. It is registered after migrations, which may legitimately
+// take longer.
+//
+// Cursors opened with Rows aren't covered: the deadline would end with the
+// callback, before the caller reads them.
+func registerStatementTimeout(db *gorm.DB, timeout time.Duration) error {
+	if timeout <= 0 {
+		return nil
+	}
+	start := func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= timeout {
+			return
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		db.Statement.Context = ctx
+		db.InstanceSet(statementCancelKey, cancel)
+	}
+	end := func(db *gorm.DB) {
+		if cancel, ok := db.InstanceGet(statementCancelKey); ok {
+			cancel.(context.CancelFunc)()
+		}
+	}
+
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("*").Register("timeout:before_create", start),
+		cb.Create().After("*").Register("timeout:after_create", end),
+		cb.Query().Before("*").Register("timeout:before_query", start),
+		cb.Query().After("*").Register("timeout:after_query", end),
+		cb.Update().Before("*").Register("timeout:before_update", start),
+		cb.Update().After("*").Register("timeout:after_update", end),
+		cb.Delete().Before("*").Register("timeout:before_delete", start),
+		cb.Delete().After("*").Register("timeout:after_delete", end),
+		cb.Raw().Before("*").Register("timeout:before_raw", start),
+		cb.Raw().After("*").Register("timeout:after_raw", end),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
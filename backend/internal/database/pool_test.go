@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestPoolConfigFrom(t *testing.T) {
+	config, err := PoolConfigFrom(func(string) string { return "" })
+	if err != nil || config != DefaultPoolConfig {
+		t.Fatalf("defaults = %+v, %v", config, err)
+	}
+
+	env := map[string]string{
+		"DB_MAX_OPEN_CONNS":     "50",
+		"DB_MAX_IDLE_CONNS":     "0",
+		"DB_CONN_MAX_LIFETIME":  "1h",
+		"DB_STATEMENT_TIMEOUT":  "0",
+		"DB_CONN_MAX_IDLE_TIME": "90s",
+	}
+	config, err = PoolConfigFrom(func(name string) string { return env[name] })
+	want := PoolConfig{MaxOpenConns: 50, ConnMaxLifetime: time.Hour, ConnMaxIdleTime: 90 * time.Second}
+	if err != nil || config != want {
+		t.Errorf("config = %+v, %v, want %+v", config, err, want)
+	}
+
+	for name, value := range map[string]string{
+		"DB_MAX_OPEN_CONNS":    "-1",
+		"DB_MAX_IDLE_CONNS":    "many",
+		"DB_STATEMENT_TIMEOUT": "30",
+		"DB_CONN_MAX_LIFETIME": "-5m",
+	} {
+		if _, err := PoolConfigFrom(func(n string) string {
+			if n == name {
+				return value
+			}
+			return ""
+		}); err == nil {
+			t.Errorf("%s=%s accepted", name, value)
+		}
+	}
+
+	if _, err := PoolConfigFrom(func(name string) string {
+		return map[string]string{"DB_MAX_OPEN_CONNS": "5", "DB_MAX_IDLE_CONNS": "10"}[name]
+	}); err == nil {
+		t.Error("more idle than open connections accepted")
+	}
+}
+
+func TestStatementTimeout(t *testing.T) {
+	db, err := gorm.Open(openSQLite(t.TempDir()+"/envie.db"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registerStatementTimeout(db, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int64
+	if err := db.Raw("SELECT 1").Scan(&n).Error; err != nil || n != 1 {
+		t.Fatalf("quick query = %d, %v", n, err)
+	}
+
+	// Counts far longer than the timeout
+	start := time.Now()
+	err = db.Exec(`WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c) SELECT count(*) FROM c`).Error
+	if err == nil {
+		t.Fatal("slow statement not interrupted")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("interrupted after %s", elapsed)
+	}
+
+	// A shorter deadline of the caller is kept
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	time.Sleep(2 * time.Millisecond)
+	if err := db.WithContext(ctx).Raw("SELECT 1").Scan(&n).Error; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expired context: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/glebarez/go-sqlite"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// transactionAttempts bounds how often Transaction runs a transaction that
+// keeps conflicting with concurrent ones
+const transactionAttempts = 4
+
+// transactionBackoff is the delay before the first retry, doubled on each
+// further one; the actual delay is random up to it so the conflicting
+// transactions don't retry in lockstep. Swapped out in tests.
+var transactionBackoff = 25 * time.Millisecond
+
+// Transaction runs fn in a transaction of db like db.Transaction, and runs it
+// again when the database aborted it for conflicting with a concurrent one: a
+// serialization failure or deadlock in Postgres, a busy database in SQLite.
+// fn may run more than once, so it must not have effects outside tx, such as
+// appending to a slice declared outside it, that a failed attempt would leave
+// behind.
+func Transaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	// Within a transaction fn runs in a savepoint, and a conflict aborts the
+	// enclosing transaction, which only its own retry can run again
+	if committer, ok := db.Statement.ConnPool.(gorm.TxCommitter); ok && committer != nil {
+		return db.Transaction(fn)
+	}
+
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	backoff := transactionBackoff
+	for attempt := 1; ; attempt++ {
+		err := db.Transaction(fn)
+		if err == nil || attempt == transactionAttempts || !IsTransientConflict(err) {
+			return err
+		}
+
+		wait := time.NewTimer(rand.N(backoff) + 1)
+		select {
+		case <-ctx.Done():
+			wait.Stop()
+			return err
+		case <-wait.C:
+		}
+		backoff *= 2
+	}
+}
+
+// IsTransientConflict reports whether err aborted a transaction only because
+// of a concurrent one, so running it again may succeed
+func IsTransientConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "40001", // serialization_failure
+			"40P01": // deadlock_detected
+			return true
+		}
+		return false
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() & 0xff {
+		case 5, // SQLITE_BUSY
+			6: // SQLITE_LOCKED
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type retryRow struct {
+	ID      int
+	Attempt int
+}
+
+func openRetryDB(t *testing.T, dsn string) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(openSQLite(t.TempDir()+"/envie.db"+dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&retryRow{}); err != nil {
+		t.Fatal(err)
+	}
+	previous := transactionBackoff
+	transactionBackoff = time.Millisecond
+	t.Cleanup(func() { transactionBackoff = previous })
+	return db
+}
+
+func TestTransactionRetriesConflicts(t *testing.T) {
+	db := openRetryDB(t, "")
+	for _, code := range []string{"40001", "40P01"} {
+		db.Where("1 = 1").Delete(&retryRow{})
+
+		attempts := 0
+		err := Transaction(db, func(tx *gorm.DB) error {
+			attempts++
+			if err := tx.Create(&retryRow{Attempt: attempts}).Error; err != nil {
+				return err
+			}
+			if attempts < 3 {
+				return fmt.Errorf("updating: %w", &pgconn.PgError{Code: code})
+			}
+			return nil
+		})
+		if err != nil || attempts != 3 {
+			t.Fatalf("%s: err = %v after %d attempts", code, err, attempts)
+		}
+
+		// Only the rows of the committed attempt remain
+		var rows []retryRow
+		db.Find(&rows)
+		if len(rows) != 1 || rows[0].Attempt != 3 {
+			t.Errorf("%s: rows = %+v", code, rows)
+		}
+	}
+}
+
+func TestTransactionGivesUp(t *testing.T) {
+	db := openRetryDB(t, "")
+
+	attempts := 0
+	conflict := &pgconn.PgError{Code: "40001"}
+	err := Transaction(db, func(tx *gorm.DB) error {
+		attempts++
+		return conflict
+	})
+	if !errors.Is(err, conflict) || attempts != transactionAttempts {
+		t.Errorf("err = %v after %d attempts, want %d", err, attempts, transactionAttempts)
+	}
+
+	attempts = 0
+	unique := &pgconn.PgError{Code: "23505"}
+	if err := Transaction(db, func(tx *gorm.DB) error { attempts++; return unique }); !errors.Is(err, unique) || attempts != 1 {
+		t.Errorf("other error: %v after %d attempts", err, attempts)
+	}
+
+	// A cancelled request stops retrying
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts = 0
+	err = Transaction(db.WithContext(ctx), func(tx *gorm.DB) error {
+		attempts++
+		cancel()
+		return conflict
+	})
+	if err == nil || attempts != 1 {
+		t.Errorf("cancelled: %v after %d attempts", err, attempts)
+	}
+}
+
+func TestTransactionNestedIsNotRetried(t *testing.T) {
+	db := openRetryDB(t, "")
+
+	inner := 0
+	conflict := &pgconn.PgError{Code: "40P01"}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return Transaction(tx, func(tx *gorm.DB) error {
+			inner++
+			return conflict
+		})
+	})
+	if !errors.Is(err, conflict) || inner != 1 {
+		t.Errorf("nested: %v after %d attempts", err, inner)
+	}
+}
+
+func TestIsTransientConflictSQLiteBusy(t *testing.T) {
+	db := openRetryDB(t, "?_pragma=busy_timeout(0)")
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another connection holds the write lock
+	holder, err := sqlDB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Rollback()
+	if _, err := holder.Exec("INSERT INTO retry_rows (attempt) VALUES (0)"); err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return tx.Create(&retryRow{Attempt: 1}).Error
+	})
+	if err == nil || !IsTransientConflict(err) {
+		t.Errorf("busy database: %v, transient = %v", err, IsTransientConflict(err))
+	}
+	if IsTransientConflict(errors.New("database is locked")) || IsTransientConflict(gorm.ErrRecordNotFound) {
+		t.Error("plain errors taken for conflicts")
+	}
+}
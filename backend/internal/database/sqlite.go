@@ -0,0 +1,87 @@
+package database
+
+import (
+	"database/sql/driver"
+	"net/url"
+	"strings"
+
+	"github.com/glebarez/go-sqlite"
+	gormsqlite "github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// sqlitePragmas are set on every connection unless the DSN sets them. WAL lets
+// requests read while another writes, and foreign keys are off by default in
+// SQLite.
+var sqlitePragmas = []string{"foreign_keys(1)", "journal_mode(WAL)", "busy_timeout(5000)"}
+
+func init() {
+	// The models default their ids to Postgres' gen_random_uuid(), so SQLite gets
+	// one too
+	sqlite.MustRegisterScalarFunction("gen_random_uuid", 0, func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return uuid.NewString(), nil
+	})
+}
+
+// openSQLite returns the dialector for a SQLite database file, for single user
+// instances that don't run Postgres. The driver is pure Go, so the binary
+// still builds with CGO_ENABLED=0.
+func openSQLite(dsn string) gorm.Dialector {
+	return sqliteDialector{&gormsqlite.Dialector{DSN: sqliteDSN(dsn)}}
+}
+
+// sqliteDSN adds sqlitePragmas and immediate transactions to dsn. Transactions
+// take the write lock when they begin, so two of them can't both read and then
+// fail to upgrade to writing; the busy timeout queues them instead.
+func sqliteDSN(dsn string) string {
+	path, query, _ := strings.Cut(dsn, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return dsn
+	}
+
+	for _, pragma := range sqlitePragmas {
+		name, _, _ := strings.Cut(pragma, "(")
+		set := false
+		for _, value := range params["_pragma"] {
+			if strings.HasPrefix(strings.ToLower(strings.TrimSpace(value)), name) {
+				set = true
+			}
+		}
+		if !set {
+			params.Add("_pragma", pragma)
+		}
+	}
+	if !params.Has("_txlock") {
+		params.Set("_txlock", "immediate")
+	}
+	return path + "?" + params.Encode()
+}
+
+// sqliteDialector writes Postgres style function defaults, like
+// default:gen_random_uuid(), in the parentheses SQLite requires. It embeds the
+// driver's type rather than gorm.Dialector so the optional interfaces, such as
+// the savepoints of nested transactions, are kept.
+type sqliteDialector struct {
+	*gormsqlite.Dialector
+}
+
+func (d sqliteDialector) Migrator(db *gorm.DB) gorm.Migrator {
+	return sqliteMigrator{d.Dialector.Migrator(db)}
+}
+
+type sqliteMigrator struct {
+	gorm.Migrator
+}
+
+func (m sqliteMigrator) FullDataTypeOf(field *schema.Field) clause.Expr {
+	if strings.HasSuffix(field.DefaultValue, ")") && !strings.HasPrefix(field.DefaultValue, "(") {
+		wrapped := *field
+		wrapped.DefaultValue = "(" + field.DefaultValue + ")"
+		field = &wrapped
+	}
+	return m.Migrator.FullDataTypeOf(field)
+}
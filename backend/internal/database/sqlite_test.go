@@ -0,0 +1,98 @@
+package database
+
+import (
+	"testing"
+
+	"envie-backend/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMigrateSQLite(t *testing.T) {
+	db, err := gorm.Open(openSQLite(t.TempDir()+"/envie.db"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := migrate(db); err != nil {
+		t.Fatalf("migrate again: %v", err)
+	}
+
+	user := models.User{Name: "Ada", Email: "ada@example.com"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	org := models.Organization{Name: "Acme"}
+	if err := db.Create(&org).Error; err != nil {
+		t.Fatal(err)
+	}
+	project := models.Project{Name: "API", OrganizationID: org.ID}
+	if err := db.Create(&project).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.ID == org.ID || project.Slug == "" {
+		t.Fatalf("ids and slugs not assigned: %v %v %q", user.ID, org.ID, project.Slug)
+	}
+
+	var found models.Project
+	if err := db.First(&found, "id = ?", project.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if found.OrganizationID != org.ID || found.CreatedAt.IsZero() {
+		t.Errorf("read back %+v", found)
+	}
+}
+
+func TestMigrateIndexes(t *testing.T) {
+	db, err := gorm.Open(openSQLite(t.TempDir()+"/envie.db"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A database migrated before the composite index replaced this one
+	if err := db.Exec("CREATE TABLE config_items (id text PRIMARY KEY, project_id text NOT NULL)").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("CREATE INDEX idx_config_items_project_id ON config_items (project_id)").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	if db.Migrator().HasIndex(&models.ConfigItem{}, "idx_config_items_project_id") {
+		t.Error("replaced index not dropped")
+	}
+	for _, index := range []struct {
+		model any
+		name  string
+	}{
+		{&models.ConfigItem{}, "idx_config_item_project_position"},
+		{&models.TeamUser{}, "idx_team_user_user_team"},
+		{&models.TeamProject{}, "idx_team_project_project_team"},
+		{&models.OrganizationUser{}, "idx_organization_user_user_role"},
+	} {
+		if !db.Migrator().HasIndex(index.model, index.name) {
+			t.Errorf("missing index %s", index.name)
+		}
+	}
+
+	var columns string
+	db.Raw("SELECT group_concat(name) FROM pragma_index_info('idx_team_user_user_team')").Scan(&columns)
+	if columns != "user_id,team_id" {
+		t.Errorf("idx_team_user_user_team columns = %q", columns)
+	}
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	for _, tc := range []struct{ dsn, want string }{
+		{"envie.db", "envie.db?_pragma=foreign_keys%281%29&_pragma=journal_mode%28WAL%29&_pragma=busy_timeout%285000%29&_txlock=immediate"},
+		{"file:/data/envie.db?_pragma=journal_mode(DELETE)&_txlock=deferred", "file:/data/envie.db?_pragma=journal_mode%28DELETE%29&_pragma=foreign_keys%281%29&_pragma=busy_timeout%285000%29&_txlock=deferred"},
+	} {
+		if got := sqliteDSN(tc.dsn); got != tc.want {
+			t.Errorf("sqliteDSN(%q) = %q, want %q", tc.dsn, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+// Package egress decides where the server may connect on behalf of users, for
+// integrations such as alert and key rotation webhooks whose URLs come from API
+// requests. NewClient is the HTTP client all such code goes through.
+//
+// Cloud metadata endpoints are always refused, and so are loopback, private,
+// link-local and shared addresses unless an EGRESS_ALLOW CIDR contains them.
+// EGRESS_DENY refuses hostnames and CIDRs on top of that. When EGRESS_ALLOW is
+// set, only the hostnames and CIDRs it lists can be reached. Rules are checked on
+// the name and again on every address it resolves to, and the client connects
+// to the checked address, so DNS can't point an allowed name inside.
+package egress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+const (
+	allowEnv = "EGRESS_ALLOW"
+	denyEnv  = "EGRESS_DENY"
+)
+
+// metadataAddrs are the instance metadata services of AWS, GCP, Azure, Oracle
+// Cloud and Alibaba Cloud, which hand out credentials to whoever asks
+var metadataAddrs = map[netip.Addr]bool{
+	netip.MustParseAddr("169.254.169.254"): true,
+	netip.MustParseAddr("fd00:ec2::254"):   true,
+	netip.MustParseAddr("100.100.100.200"): true,
+}
+
+var metadataHosts = map[string]bool{
+	"metadata.google.internal": true,
+	"metadata":                 true,
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, internal to providers
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// Policy holds the EGRESS_ALLOW and EGRESS_DENY rules. A nil Policy has no rules,
+// so only the built-in protections apply.
+type Policy struct {
+	allowHosts []string
+	allowNets  []netip.Prefix
+	denyHosts  []string
+	denyNets   []netip.Prefix
+}
+
+// PolicyFrom reads EGRESS_ALLOW and EGRESS_DENY through getenv
+func PolicyFrom(getenv func(string) string) (*Policy, error) {
+	return ParsePolicy(getenv(allowEnv), getenv(denyEnv))
+}
+
+// ParsePolicy parses comma-separated rules: hostnames such as hooks.slack.com,
+// wildcards such as *.example.com matching subdomains, IP addresses and CIDRs
+func ParsePolicy(allow, deny string) (*Policy, error) {
+	p := &Policy{}
+	var err error
+	if p.allowHosts, p.allowNets, err = parseRules(allow); err != nil {
+		return nil, fmt.Errorf("%s: %w", allowEnv, err)
+	}
+	if p.denyHosts, p.denyNets, err = parseRules(deny); err != nil {
+		return nil, fmt.Errorf("%s: %w", denyEnv, err)
+	}
+	return p, nil
+}
+
+func parseRules(rules string) (hosts []string, nets []netip.Prefix, err error) {
+	for _, rule := range strings.Split(rules, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(rule); err == nil {
+			nets = append(nets, prefix.Masked())
+			continue
+		}
+		if addr, err := netip.ParseAddr(rule); err == nil {
+			nets = append(nets, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		host := normalizeHost(rule)
+		name := strings.TrimPrefix(host, "*.")
+		if name == "" || strings.ContainsAny(name, "/:*@ ") {
+			return nil, nil, fmt.Errorf("invalid rule %q, want a hostname, *.domain, IP address or CIDR", rule)
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nets, nil
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+func matchHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if domain, ok := strings.CutPrefix(pattern, "*"); ok {
+			if strings.HasSuffix(host, domain) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAddr(nets []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range nets {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func isPublic(addr netip.Addr) bool {
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+func (p *Policy) restricted() bool {
+	return p != nil && (len(p.allowHosts) > 0 || len(p.allowNets) > 0)
+}
+
+// CheckHost applies the rules that don't need the name resolved, to reject a URL
+// when it is configured. The address rules still apply when connecting.
+func (p *Policy) CheckHost(host string) error {
+	host = normalizeHost(host)
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return p.Check(host, addr)
+	}
+	if metadataHosts[host] {
+		return fmt.Errorf("%s is a cloud metadata endpoint", host)
+	}
+	if p == nil {
+		return nil
+	}
+	if matchHost(p.denyHosts, host) {
+		return fmt.Errorf("%s is denied by %s", host, denyEnv)
+	}
+	if p.restricted() && len(p.allowNets) == 0 && !matchHost(p.allowHosts, host) {
+		return fmt.Errorf("%s is not allowed by %s", host, allowEnv)
+	}
+	return nil
+}
+
+// Check decides whether the server may connect to addr, resolved from host
+func (p *Policy) Check(host string, addr netip.Addr) error {
+	host = normalizeHost(host)
+	addr = addr.Unmap()
+	if metadataAddrs[addr] || metadataHosts[host] {
+		return fmt.Errorf("%s is a cloud metadata endpoint", addr)
+	}
+
+	var allowedNet bool
+	if p != nil {
+		if matchHost(p.denyHosts, host) || containsAddr(p.denyNets, addr) {
+			return fmt.Errorf("%s (%s) is denied by %s", host, addr, denyEnv)
+		}
+		allowedNet = containsAddr(p.allowNets, addr)
+	}
+	if !isPublic(addr) && !allowedNet {
+		return fmt.Errorf("%s (%s) is not a public address", host, addr)
+	}
+	if p.restricted() && !allowedNet && !matchHost(p.allowHosts, host) {
+		return fmt.Errorf("%s (%s) is not allowed by %s", host, addr, allowEnv)
+	}
+	return nil
+}
+
+// String describes the rules, for the log
+func (p *Policy) String() string {
+	if p == nil {
+		return "public addresses"
+	}
+	describe := func(hosts []string, nets []netip.Prefix) string {
+		rules := append([]string{}, hosts...)
+		for _, prefix := range nets {
+			rules = append(rules, prefix.String())
+		}
+		return strings.Join(rules, ",")
+	}
+	allow, deny := describe(p.allowHosts, p.allowNets), describe(p.denyHosts, p.denyNets)
+	switch {
+	case allow == "" && deny == "":
+		return "public addresses"
+	case allow == "":
+		return "public addresses except " + deny
+	case deny == "":
+		return "only " + allow
+	default:
+		return "only " + allow + " except " + deny
+	}
+}
+
+// NewDialer returns a dial function that only connects where the policy
+// returned by policy allows, asked on every connection so reloaded rules apply
+func NewDialer(timeout time.Duration, policy func() *Policy) func(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		p := policy()
+		if err := p.CheckHost(host); err != nil {
+			return nil, err
+		}
+		addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("%s has no addresses", host)
+		}
+		// A name resolving to any refused address is refused as a whole
+		for _, addr := range addrs {
+			if err := p.Check(host, addr); err != nil {
+				return nil, err
+			}
+		}
+		var errs []error
+		for _, addr := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(addr.Unmap().String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			errs = append(errs, err)
+		}
+		return nil, errors.Join(errs...)
+	}
+}
+
+// NewClient returns an HTTP client that connects through NewDialer. It ignores
+// proxy settings and doesn't follow redirects, which could lead anywhere.
+func NewClient(timeout time.Duration, policy func() *Policy) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         NewDialer(timeout, policy),
+			TLSHandshakeTimeout: timeout,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
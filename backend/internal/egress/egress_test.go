@@ -0,0 +1,96 @@
+package egress
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	policy, err := ParsePolicy("hooks.slack.com, *.example.com, 10.20.0.0/16", "evil.example.com, 203.0.113.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		policy *Policy
+		host   string
+		addr   string
+		ok     bool
+	}{
+		{nil, "hooks.example.org", "93.184.216.34", true},
+		{nil, "localhost", "127.0.0.1", false},
+		{nil, "internal", "10.0.0.5", false},
+		{nil, "cgnat", "100.64.1.1", false},
+		{nil, "v6", "::ffff:192.168.1.1", false},
+		{nil, "metadata.google.internal", "93.184.216.34", false},
+		{policy, "instance-data", "169.254.169.254", false},
+		{policy, "hooks.slack.com", "93.184.216.34", true},
+		{policy, "HOOKS.SLACK.COM.", "93.184.216.34", true},
+		{policy, "api.example.com", "93.184.216.34", true},
+		{policy, "example.com", "93.184.216.34", false},
+		{policy, "evil.example.com", "93.184.216.34", false},
+		{policy, "api.example.com", "203.0.113.7", false},
+		{policy, "rebound.example.com", "10.0.0.1", false},
+		{policy, "receiver.internal", "10.20.3.4", true},
+		{policy, "other.org", "93.184.216.34", false},
+	}
+	for _, tt := range tests {
+		err := tt.policy.Check(tt.host, netip.MustParseAddr(tt.addr))
+		if (err == nil) != tt.ok {
+			t.Errorf("Check(%q, %s) with %s = %v, want allowed %t", tt.host, tt.addr, tt.policy, err, tt.ok)
+		}
+	}
+
+	if err := policy.CheckHost("other.org"); err != nil {
+		t.Errorf("CheckHost refused a name that may resolve into an allowed CIDR: %v", err)
+	}
+	hostsOnly, _ := ParsePolicy("hooks.slack.com", "")
+	if err := hostsOnly.CheckHost("other.org"); err == nil {
+		t.Error("CheckHost allowed a name outside EGRESS_ALLOW")
+	}
+	if err := (*Policy)(nil).CheckHost("169.254.169.254"); err == nil {
+		t.Error("CheckHost allowed the metadata address")
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	for _, rules := range []string{"https://hooks.slack.com", "10.0.0.0/33", "*", "a b"} {
+		if _, err := ParsePolicy(rules, ""); err == nil {
+			t.Errorf("rule %q accepted", rules)
+		}
+	}
+	policy, err := PolicyFrom(func(name string) string {
+		return map[string]string{allowEnv: "10.0.0.1", denyEnv: "*.internal"}[name]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := policy.String(), "only 10.0.0.1/32 except *.internal"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestClient(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	if _, err := NewClient(time.Second, func() *Policy { return nil }).Get(server.URL); err == nil || called {
+		t.Errorf("request to loopback sent, err = %v", err)
+	}
+
+	loopback, _ := ParsePolicy("127.0.0.0/8", "")
+	resp, err := NewClient(time.Second, func() *Policy { return loopback }).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !called {
+		t.Error("request to an allowed CIDR not sent")
+	}
+}
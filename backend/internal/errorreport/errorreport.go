@@ -0,0 +1,331 @@
+// Package errorreport sends panics and server errors to a Sentry-compatible
+// endpoint (Sentry, GlitchTip, Bugsink, ...). Events carry the error, stack trace,
+// route, caller and build info only: never request or response bodies, headers,
+// query strings or client addresses, and messages pass through the redaction
+// filter.
+package errorreport
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"envie-backend/internal/redact"
+)
+
+const (
+	sentryDSNEnv         = "SENTRY_DSN"
+	sentryEnvironmentEnv = "SENTRY_ENVIRONMENT"
+
+	// queueSize bounds the events waiting to be sent; more are dropped rather than
+	// slowing down requests while the endpoint is unreachable
+	queueSize   = 64
+	sendTimeout = 10 * time.Second
+	maxFrames   = 50
+)
+
+// Options describe the running build. Release and Commit come from the version
+// variables set with -ldflags.
+type Options struct {
+	Release     string
+	Commit      string
+	Environment string
+}
+
+// Request is the sanitized request information attached to an event. The IDs
+// identify records and aren't credentials; each is left out when empty.
+type Request struct {
+	Method string
+	Route  string // the route pattern, e.g. /v1/projects/:id, not the raw path
+	Status int
+
+	UserID  string // the signed in user
+	TokenID string // the CLI token, for requests to the CLI API
+	TraceID string // the request's trace, see package tracing
+	SpanID  string
+}
+
+// Reporter sends events in the background. A nil *Reporter is valid and does
+// nothing, so callers don't need to check whether reporting is configured.
+type Reporter struct {
+	endpoint   string
+	authHeader string
+	options    Options
+	serverName string
+	client     *http.Client
+
+	queue chan event
+	wg    sync.WaitGroup
+}
+
+// New parses a DSN of the form https://<public key>@<host>/<project id>
+func New(dsn string, options Options) (*Reporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DSN: %w", err)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("invalid DSN: missing public key")
+	}
+	path := strings.Trim(u.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	projectID := path[slash+1:]
+	if projectID == "" {
+		return nil, fmt.Errorf("invalid DSN: missing project ID")
+	}
+	prefix := ""
+	if slash >= 0 {
+		prefix = "/" + path[:slash]
+	}
+
+	hostname, _ := os.Hostname()
+	r := &Reporter{
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, prefix, projectID),
+		authHeader: fmt.Sprintf("Sentry sentry_version=7, sentry_client=envie-backend/%s, sentry_key=%s",
+			options.Release, u.User.Username()),
+		options:    options,
+		serverName: hostname,
+		client:     &http.Client{Timeout: sendTimeout},
+		queue:      make(chan event, queueSize),
+	}
+	go r.run()
+	return r, nil
+}
+
+// FromEnv returns a reporter for SENTRY_DSN tagged with SENTRY_ENVIRONMENT, or nil
+// when SENTRY_DSN is not set
+func FromEnv(release, commit string) (*Reporter, error) {
+	dsn := os.Getenv(sentryDSNEnv)
+	if dsn == "" {
+		return nil, nil
+	}
+	return New(dsn, Options{
+		Release:     release,
+		Commit:      commit,
+		Environment: os.Getenv(sentryEnvironmentEnv),
+	})
+}
+
+// CaptureError reports an error returned while handling req
+func (r *Reporter) CaptureError(err error, req *Request) {
+	if r == nil || err == nil {
+		return
+	}
+	r.enqueue(r.newEvent("error", fmt.Sprintf("%T", err), err.Error(), nil, req))
+}
+
+// CapturePanic reports a recovered panic. stack is the output of
+// runtime.Callers taken in the deferred function.
+func (r *Reporter) CapturePanic(value any, stack []uintptr, req *Request) {
+	if r == nil {
+		return
+	}
+	r.enqueue(r.newEvent("fatal", "panic", fmt.Sprint(value), stack, req))
+}
+
+// Flush waits up to timeout for queued events to be sent, e.g. before exiting
+func (r *Reporter) Flush(timeout time.Duration) {
+	if r == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+func (r *Reporter) enqueue(e event) {
+	r.wg.Add(1)
+	select {
+	case r.queue <- e:
+	default:
+		r.wg.Done()
+		log.Printf("Error report queue full, dropping event %s", e.EventID)
+	}
+}
+
+func (r *Reporter) run() {
+	for e := range r.queue {
+		if err := r.send(e); err != nil {
+			log.Printf("Failed to send error report %s: %v", e.EventID, err)
+		}
+		r.wg.Done()
+	}
+}
+
+func (r *Reporter) send(e event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", r.authHeader)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// event is the subset of the Sentry event payload the reporter fills in
+type event struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Transaction string            `json:"transaction,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	User        *eventUser        `json:"user,omitempty"`
+	Contexts    *eventContexts    `json:"contexts,omitempty"`
+	Exception   *exceptions       `json:"exception,omitempty"`
+}
+
+type eventUser struct {
+	ID string `json:"id"`
+}
+
+type eventContexts struct {
+	Trace traceContext `json:"trace"`
+}
+
+// traceContext links the event to the request's trace
+type traceContext struct {
+	TraceID string `json:"trace_id"`
+	SpanID  string `json:"span_id"`
+}
+
+type exceptions struct {
+	Values []exception `json:"values"`
+}
+
+type exception struct {
+	Type       string      `json:"type"`
+	Value      string      `json:"value"`
+	Stacktrace *stacktrace `json:"stacktrace,omitempty"`
+}
+
+type stacktrace struct {
+	Frames []frame `json:"frames"`
+}
+
+type frame struct {
+	Function string `json:"function"`
+	Module   string `json:"module,omitempty"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+func (r *Reporter) newEvent(level, errType, message string, stack []uintptr, req *Request) event {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	e := event{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339Nano),
+		Level:       level,
+		Platform:    "go",
+		Logger:      "envie-backend",
+		ServerName:  r.serverName,
+		Release:     r.options.Release,
+		Environment: r.options.Environment,
+		Tags:        map[string]string{},
+	}
+	if r.options.Commit != "" {
+		e.Tags["commit"] = r.options.Commit
+	}
+	if req != nil {
+		e.Transaction = req.Method + " " + req.Route
+		e.Tags["http.method"] = req.Method
+		e.Tags["http.route"] = req.Route
+		if req.Status != 0 {
+			e.Tags["http.status_code"] = fmt.Sprint(req.Status)
+		}
+		if req.UserID != "" {
+			e.User = &eventUser{ID: req.UserID}
+		}
+		if req.TokenID != "" {
+			e.Tags["cli.token_id"] = req.TokenID
+		}
+		if req.TraceID != "" {
+			e.Tags["trace_id"] = req.TraceID
+			e.Contexts = &eventContexts{Trace: traceContext{TraceID: req.TraceID, SpanID: req.SpanID}}
+		}
+	}
+
+	ex := exception{Type: errType, Value: redact.Text(message)}
+	if frames := stackFrames(stack); len(frames) > 0 {
+		ex.Stacktrace = &stacktrace{Frames: frames}
+	}
+	e.Exception = &exceptions{Values: []exception{ex}}
+	return e
+}
+
+// stackFrames converts program counters to Sentry frames, outermost call first
+func stackFrames(stack []uintptr) []frame {
+	if len(stack) == 0 {
+		return nil
+	}
+	var frames []frame
+	iter := runtime.CallersFrames(stack)
+	for {
+		f, more := iter.Next()
+		module, function := splitFunction(f.Function)
+		frames = append(frames, frame{
+			Function: function,
+			Module:   module,
+			Filename: f.File,
+			Lineno:   f.Line,
+			InApp:    strings.HasPrefix(module, "envie-backend/"),
+		})
+		if !more {
+			break
+		}
+	}
+	if len(frames) > maxFrames {
+		frames = frames[:maxFrames]
+	}
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return frames
+}
+
+// splitFunction splits "envie-backend/internal/handlers.GetProject" into its
+// package path and function name
+func splitFunction(name string) (module, function string) {
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return "", name
+	}
+	return name[:slash+1+dot], name[slash+2+dot:]
+}
@@ -0,0 +1,138 @@
+package errorreport
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type capturedEvent struct {
+	path, auth string
+	event      event
+}
+
+func newTestReporter(t *testing.T) (*Reporter, func() []capturedEvent) {
+	var mu sync.Mutex
+	var events []capturedEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var e event
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Errorf("invalid event: %v", err)
+		}
+		mu.Lock()
+		events = append(events, capturedEvent{r.URL.Path, r.Header.Get("X-Sentry-Auth"), e})
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+
+	dsn := strings.Replace(server.URL, "://", "://public@", 1) + "/42"
+	reporter, err := New(dsn, Options{Release: "v1.2.3", Commit: "abc1234", Environment: "staging"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reporter, func() []capturedEvent {
+		reporter.Flush(5 * time.Second)
+		mu.Lock()
+		defer mu.Unlock()
+		return events
+	}
+}
+
+func TestNewParsesDSN(t *testing.T) {
+	r, err := New("https://key@errors.example.com/sentry/7", Options{Release: "v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.endpoint != "https://errors.example.com/sentry/api/7/store/" {
+		t.Errorf("endpoint = %q", r.endpoint)
+	}
+	if !strings.Contains(r.authHeader, "sentry_key=key") {
+		t.Errorf("auth header = %q", r.authHeader)
+	}
+
+	for _, dsn := range []string{"https://errors.example.com/7", "https://key@errors.example.com/", "://bad"} {
+		if _, err := New(dsn, Options{}); err == nil {
+			t.Errorf("New(%q) accepted an invalid DSN", dsn)
+		}
+	}
+}
+
+func TestCaptureError(t *testing.T) {
+	reporter, events := newTestReporter(t)
+	reporter.CaptureError(errors.New(`sync failed: {"encryptedValue": "c2VjcmV0"}`),
+		&Request{Method: "POST", Route: "/v1/projects/:id/config", Status: 500})
+
+	got := events()
+	if len(got) != 1 {
+		t.Fatalf("got %d events", len(got))
+	}
+	e := got[0]
+	if e.path != "/api/42/store/" || !strings.Contains(e.auth, "sentry_key=public") {
+		t.Errorf("sent to %q with %q", e.path, e.auth)
+	}
+	if e.event.Release != "v1.2.3" || e.event.Environment != "staging" || e.event.Tags["commit"] != "abc1234" {
+		t.Errorf("build info = %q %q %v", e.event.Release, e.event.Environment, e.event.Tags)
+	}
+	if e.event.Transaction != "POST /v1/projects/:id/config" || e.event.Tags["http.status_code"] != "500" {
+		t.Errorf("request info = %q %v", e.event.Transaction, e.event.Tags)
+	}
+	value := e.event.Exception.Values[0].Value
+	if strings.Contains(value, "c2VjcmV0") {
+		t.Errorf("message was not redacted: %q", value)
+	}
+}
+
+func TestCaptureErrorCaller(t *testing.T) {
+	reporter, events := newTestReporter(t)
+	reporter.CaptureError(errors.New("boom"), &Request{
+		Method: "GET", Route: "/v1/cli/config", Status: 500,
+		UserID: "u1", TokenID: "t1", TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7",
+	})
+
+	got := events()
+	if len(got) != 1 {
+		t.Fatalf("got %d events", len(got))
+	}
+	e := got[0].event
+	if e.User == nil || e.User.ID != "u1" || e.Tags["cli.token_id"] != "t1" {
+		t.Errorf("caller = %+v %v", e.User, e.Tags)
+	}
+	if e.Contexts == nil || e.Contexts.Trace.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || e.Contexts.Trace.SpanID != "00f067aa0ba902b7" {
+		t.Errorf("contexts = %+v", e.Contexts)
+	}
+}
+
+func TestCapturePanic(t *testing.T) {
+	reporter, events := newTestReporter(t)
+	stack := make([]uintptr, 32)
+	stack = stack[:runtime.Callers(1, stack)]
+	reporter.CapturePanic("boom", stack, nil)
+
+	got := events()
+	if len(got) != 1 {
+		t.Fatalf("got %d events", len(got))
+	}
+	ex := got[0].event.Exception.Values[0]
+	if got[0].event.Level != "fatal" || ex.Type != "panic" || ex.Value != "boom" {
+		t.Errorf("exception = %+v", ex)
+	}
+	frames := ex.Stacktrace.Frames
+	if last := frames[len(frames)-1]; last.Function != "TestCapturePanic" || last.Module != "envie-backend/internal/errorreport" || !last.InApp {
+		t.Errorf("innermost frame = %+v", last)
+	}
+}
+
+func TestNilReporter(t *testing.T) {
+	var r *Reporter
+	r.CaptureError(errors.New("ignored"), nil)
+	r.CapturePanic("ignored", nil, nil)
+	r.Flush(time.Millisecond)
+}
@@ -0,0 +1,683 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: envie/v1/config.proto
+
+package enviev1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type VerifyIdentityRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VerifyIdentityRequest) Reset() {
+	*x = VerifyIdentityRequest{}
+	mi := &file_envie_v1_config_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VerifyIdentityRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VerifyIdentityRequest) ProtoMessage() {}
+
+func (x *VerifyIdentityRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_envie_v1_config_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VerifyIdentityRequest.ProtoReflect.Descriptor instead.
+func (*VerifyIdentityRequest) Descriptor() ([]byte, []int) {
+	return file_envie_v1_config_proto_rawDescGZIP(), []int{0}
+}
+
+type VerifyIdentityResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TokenId       string                 `protobuf:"bytes,1,opt,name=token_id,json=tokenId,proto3" json:"token_id,omitempty"`
+	TokenName     string                 `protobuf:"bytes,2,opt,name=token_name,json=tokenName,proto3" json:"token_name,omitempty"`
+	ProjectId     string                 `protobuf:"bytes,3,opt,name=project_id,json=projectId,proto3" json:"project_id,omitempty"`
+	ProjectName   string                 `protobuf:"bytes,4,opt,name=project_name,json=projectName,proto3" json:"project_name,omitempty"`
+	ExpiresAt     string                 `protobuf:"bytes,5,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VerifyIdentityResponse) Reset() {
+	*x = VerifyIdentityResponse{}
+	mi := &file_envie_v1_config_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VerifyIdentityResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VerifyIdentityResponse) ProtoMessage() {}
+
+func (x *VerifyIdentityResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_envie_v1_config_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VerifyIdentityResponse.ProtoReflect.Descriptor instead.
+func (*VerifyIdentityResponse) Descriptor() ([]byte, []int) {
+	return file_envie_v1_config_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *VerifyIdentityResponse) GetTokenId() string {
+	if x != nil {
+		return x.TokenId
+	}
+	return ""
+}
+
+func (x *VerifyIdentityResponse) GetTokenName() string {
+	if x != nil {
+		return x.TokenName
+	}
+	return ""
+}
+
+func (x *VerifyIdentityResponse) GetProjectId() string {
+	if x != nil {
+		return x.ProjectId
+	}
+	return ""
+}
+
+func (x *VerifyIdentityResponse) GetProjectName() string {
+	if x != nil {
+		return x.ProjectName
+	}
+	return ""
+}
+
+func (x *VerifyIdentityResponse) GetExpiresAt() string {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return ""
+}
+
+type GetProjectConfigRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ProjectId     string                 `protobuf:"bytes,1,opt,name=project_id,json=projectId,proto3" json:"project_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetProjectConfigRequest) Reset() {
+	*x = GetProjectConfigRequest{}
+	mi := &file_envie_v1_config_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetProjectConfigRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetProjectConfigRequest) ProtoMessage() {}
+
+func (x *GetProjectConfigRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_envie_v1_config_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetProjectConfigRequest.ProtoReflect.Descriptor instead.
+func (*GetProjectConfigRequest) Descriptor() ([]byte, []int) {
+	return file_envie_v1_config_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetProjectConfigRequest) GetProjectId() string {
+	if x != nil {
+		return x.ProjectId
+	}
+	return ""
+}
+
+type ConfigItem struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Id             string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name           string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	EncryptedValue string                 `protobuf:"bytes,3,opt,name=encrypted_value,json=encryptedValue,proto3" json:"encrypted_value,omitempty"`
+	Position       int32                  `protobuf:"varint,4,opt,name=position,proto3" json:"position,omitempty"`
+	Category       *string                `protobuf:"bytes,5,opt,name=category,proto3,oneof" json:"category,omitempty"`
+	Masked         bool                   `protobuf:"varint,6,opt,name=masked,proto3" json:"masked,omitempty"`
+	ValueType      string                 `protobuf:"bytes,7,opt,name=value_type,json=valueType,proto3" json:"value_type,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *ConfigItem) Reset() {
+	*x = ConfigItem{}
+	mi := &file_envie_v1_config_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConfigItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfigItem) ProtoMessage() {}
+
+func (x *ConfigItem) ProtoReflect() protoreflect.Message {
+	mi := &file_envie_v1_config_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfigItem.ProtoReflect.Descriptor instead.
+func (*ConfigItem) Descriptor() ([]byte, []int) {
+	return file_envie_v1_config_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ConfigItem) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ConfigItem) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ConfigItem) GetEncryptedValue() string {
+	if x != nil {
+		return x.EncryptedValue
+	}
+	return ""
+}
+
+func (x *ConfigItem) GetPosition() int32 {
+	if x != nil {
+		return x.Position
+	}
+	return 0
+}
+
+func (x *ConfigItem) GetCategory() string {
+	if x != nil && x.Category != nil {
+		return *x.Category
+	}
+	return ""
+}
+
+func (x *ConfigItem) GetMasked() bool {
+	if x != nil {
+		return x.Masked
+	}
+	return false
+}
+
+func (x *ConfigItem) GetValueType() string {
+	if x != nil {
+		return x.ValueType
+	}
+	return ""
+}
+
+type ProjectConfig struct {
+	state                protoimpl.MessageState `protogen:"open.v1"`
+	ProjectId            string                 `protobuf:"bytes,1,opt,name=project_id,json=projectId,proto3" json:"project_id,omitempty"`
+	ProjectName          string                 `protobuf:"bytes,2,opt,name=project_name,json=projectName,proto3" json:"project_name,omitempty"`
+	EncryptedProjectKey  string                 `protobuf:"bytes,3,opt,name=encrypted_project_key,json=encryptedProjectKey,proto3" json:"encrypted_project_key,omitempty"`
+	Items                []*ConfigItem          `protobuf:"bytes,4,rep,name=items,proto3" json:"items,omitempty"`
+	ConfigChecksum       string                 `protobuf:"bytes,5,opt,name=config_checksum,json=configChecksum,proto3" json:"config_checksum,omitempty"`
+	EnvelopeVersion      int32                  `protobuf:"varint,6,opt,name=envelope_version,json=envelopeVersion,proto3" json:"envelope_version,omitempty"`
+	ChecksumVersion      int32                  `protobuf:"varint,7,opt,name=checksum_version,json=checksumVersion,proto3" json:"checksum_version,omitempty"`
+	LegacyConfigChecksum string                 `protobuf:"bytes,8,opt,name=legacy_config_checksum,json=legacyConfigChecksum,proto3" json:"legacy_config_checksum,omitempty"`
+	Signature            *ConfigSignature       `protobuf:"bytes,9,opt,name=signature,proto3" json:"signature,omitempty"`
+	unknownFields        protoimpl.UnknownFields
+	sizeCache            protoimpl.SizeCache
+}
+
+func (x *ProjectConfig) Reset() {
+	*x = ProjectConfig{}
+	mi := &file_envie_v1_config_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProjectConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProjectConfig) ProtoMessage() {}
+
+func (x *ProjectConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_envie_v1_config_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProjectConfig.ProtoReflect.Descriptor instead.
+func (*ProjectConfig) Descriptor() ([]byte, []int) {
+	return file_envie_v1_config_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ProjectConfig) GetProjectId() string {
+	if x != nil {
+		return x.ProjectId
+	}
+	return ""
+}
+
+func (x *ProjectConfig) GetProjectName() string {
+	if x != nil {
+		return x.ProjectName
+	}
+	return ""
+}
+
+func (x *ProjectConfig) GetEncryptedProjectKey() string {
+	if x != nil {
+		return x.EncryptedProjectKey
+	}
+	return ""
+}
+
+func (x *ProjectConfig) GetItems() []*ConfigItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *ProjectConfig) GetConfigChecksum() string {
+	if x != nil {
+		return x.ConfigChecksum
+	}
+	return ""
+}
+
+func (x *ProjectConfig) GetEnvelopeVersion() int32 {
+	if x != nil {
+		return x.EnvelopeVersion
+	}
+	return 0
+}
+
+func (x *ProjectConfig) GetChecksumVersion() int32 {
+	if x != nil {
+		return x.ChecksumVersion
+	}
+	return 0
+}
+
+func (x *ProjectConfig) GetLegacyConfigChecksum() string {
+	if x != nil {
+		return x.LegacyConfigChecksum
+	}
+	return ""
+}
+
+func (x *ProjectConfig) GetSignature() *ConfigSignature {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+type ConfigSignature struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	KeyId         string                 `protobuf:"bytes,1,opt,name=key_id,json=keyId,proto3" json:"key_id,omitempty"`
+	Algorithm     string                 `protobuf:"bytes,2,opt,name=algorithm,proto3" json:"algorithm,omitempty"`
+	KeyVersion    int32                  `protobuf:"varint,3,opt,name=key_version,json=keyVersion,proto3" json:"key_version,omitempty"`
+	ItemDigest    string                 `protobuf:"bytes,4,opt,name=item_digest,json=itemDigest,proto3" json:"item_digest,omitempty"`
+	SignedAt      string                 `protobuf:"bytes,5,opt,name=signed_at,json=signedAt,proto3" json:"signed_at,omitempty"`
+	Value         string                 `protobuf:"bytes,6,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConfigSignature) Reset() {
+	*x = ConfigSignature{}
+	mi := &file_envie_v1_config_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConfigSignature) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfigSignature) ProtoMessage() {}
+
+func (x *ConfigSignature) ProtoReflect() protoreflect.Message {
+	mi := &file_envie_v1_config_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfigSignature.ProtoReflect.Descriptor instead.
+func (*ConfigSignature) Descriptor() ([]byte, []int) {
+	return file_envie_v1_config_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ConfigSignature) GetKeyId() string {
+	if x != nil {
+		return x.KeyId
+	}
+	return ""
+}
+
+func (x *ConfigSignature) GetAlgorithm() string {
+	if x != nil {
+		return x.Algorithm
+	}
+	return ""
+}
+
+func (x *ConfigSignature) GetKeyVersion() int32 {
+	if x != nil {
+		return x.KeyVersion
+	}
+	return 0
+}
+
+func (x *ConfigSignature) GetItemDigest() string {
+	if x != nil {
+		return x.ItemDigest
+	}
+	return ""
+}
+
+func (x *ConfigSignature) GetSignedAt() string {
+	if x != nil {
+		return x.SignedAt
+	}
+	return ""
+}
+
+func (x *ConfigSignature) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+type WatchConfigRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ProjectId     string                 `protobuf:"bytes,1,opt,name=project_id,json=projectId,proto3" json:"project_id,omitempty"`
+	LastChecksum  string                 `protobuf:"bytes,2,opt,name=last_checksum,json=lastChecksum,proto3" json:"last_checksum,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchConfigRequest) Reset() {
+	*x = WatchConfigRequest{}
+	mi := &file_envie_v1_config_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchConfigRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchConfigRequest) ProtoMessage() {}
+
+func (x *WatchConfigRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_envie_v1_config_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchConfigRequest.ProtoReflect.Descriptor instead.
+func (*WatchConfigRequest) Descriptor() ([]byte, []int) {
+	return file_envie_v1_config_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *WatchConfigRequest) GetProjectId() string {
+	if x != nil {
+		return x.ProjectId
+	}
+	return ""
+}
+
+func (x *WatchConfigRequest) GetLastChecksum() string {
+	if x != nil {
+		return x.LastChecksum
+	}
+	return ""
+}
+
+type ConfigEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Config        *ProjectConfig         `protobuf:"bytes,1,opt,name=config,proto3" json:"config,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConfigEvent) Reset() {
+	*x = ConfigEvent{}
+	mi := &file_envie_v1_config_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConfigEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfigEvent) ProtoMessage() {}
+
+func (x *ConfigEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_envie_v1_config_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfigEvent.ProtoReflect.Descriptor instead.
+func (*ConfigEvent) Descriptor() ([]byte, []int) {
+	return file_envie_v1_config_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ConfigEvent) GetConfig() *ProjectConfig {
+	if x != nil {
+		return x.Config
+	}
+	return nil
+}
+
+var File_envie_v1_config_proto protoreflect.FileDescriptor
+
+const file_envie_v1_config_proto_rawDesc = "" +
+	"\n" +
+	"\x15envie/v1/config.proto\x12\benvie.v1\"\x17\n" +
+	"\x15VerifyIdentityRequest\"\xb3\x01\n" +
+	"\x16VerifyIdentityResponse\x12\x19\n" +
+	"\btoken_id\x18\x01 \x01(\tR\atokenId\x12\x1d\n" +
+	"\n" +
+	"token_name\x18\x02 \x01(\tR\ttokenName\x12\x1d\n" +
+	"\n" +
+	"project_id\x18\x03 \x01(\tR\tprojectId\x12!\n" +
+	"\fproject_name\x18\x04 \x01(\tR\vprojectName\x12\x1d\n" +
+	"\n" +
+	"expires_at\x18\x05 \x01(\tR\texpiresAt\"8\n" +
+	"\x17GetProjectConfigRequest\x12\x1d\n" +
+	"\n" +
+	"project_id\x18\x01 \x01(\tR\tprojectId\"\xda\x01\n" +
+	"\n" +
+	"ConfigItem\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12'\n" +
+	"\x0fencrypted_value\x18\x03 \x01(\tR\x0eencryptedValue\x12\x1a\n" +
+	"\bposition\x18\x04 \x01(\x05R\bposition\x12\x1f\n" +
+	"\bcategory\x18\x05 \x01(\tH\x00R\bcategory\x88\x01\x01\x12\x16\n" +
+	"\x06masked\x18\x06 \x01(\bR\x06masked\x12\x1d\n" +
+	"\n" +
+	"value_type\x18\a \x01(\tR\tvalueTypeB\v\n" +
+	"\t_category\"\x9f\x03\n" +
+	"\rProjectConfig\x12\x1d\n" +
+	"\n" +
+	"project_id\x18\x01 \x01(\tR\tprojectId\x12!\n" +
+	"\fproject_name\x18\x02 \x01(\tR\vprojectName\x122\n" +
+	"\x15encrypted_project_key\x18\x03 \x01(\tR\x13encryptedProjectKey\x12*\n" +
+	"\x05items\x18\x04 \x03(\v2\x14.envie.v1.ConfigItemR\x05items\x12'\n" +
+	"\x0fconfig_checksum\x18\x05 \x01(\tR\x0econfigChecksum\x12)\n" +
+	"\x10envelope_version\x18\x06 \x01(\x05R\x0fenvelopeVersion\x12)\n" +
+	"\x10checksum_version\x18\a \x01(\x05R\x0fchecksumVersion\x124\n" +
+	"\x16legacy_config_checksum\x18\b \x01(\tR\x14legacyConfigChecksum\x127\n" +
+	"\tsignature\x18\t \x01(\v2\x19.envie.v1.ConfigSignatureR\tsignature\"\xbb\x01\n" +
+	"\x0fConfigSignature\x12\x15\n" +
+	"\x06key_id\x18\x01 \x01(\tR\x05keyId\x12\x1c\n" +
+	"\talgorithm\x18\x02 \x01(\tR\talgorithm\x12\x1f\n" +
+	"\vkey_version\x18\x03 \x01(\x05R\n" +
+	"keyVersion\x12\x1f\n" +
+	"\vitem_digest\x18\x04 \x01(\tR\n" +
+	"itemDigest\x12\x1b\n" +
+	"\tsigned_at\x18\x05 \x01(\tR\bsignedAt\x12\x14\n" +
+	"\x05value\x18\x06 \x01(\tR\x05value\"X\n" +
+	"\x12WatchConfigRequest\x12\x1d\n" +
+	"\n" +
+	"project_id\x18\x01 \x01(\tR\tprojectId\x12#\n" +
+	"\rlast_checksum\x18\x02 \x01(\tR\flastChecksum\">\n" +
+	"\vConfigEvent\x12/\n" +
+	"\x06config\x18\x01 \x01(\v2\x17.envie.v1.ProjectConfigR\x06config2\xfa\x01\n" +
+	"\rConfigService\x12S\n" +
+	"\x0eVerifyIdentity\x12\x1f.envie.v1.VerifyIdentityRequest\x1a .envie.v1.VerifyIdentityResponse\x12N\n" +
+	"\x10GetProjectConfig\x12!.envie.v1.GetProjectConfigRequest\x1a\x17.envie.v1.ProjectConfig\x12D\n" +
+	"\vWatchConfig\x12\x1c.envie.v1.WatchConfigRequest\x1a\x15.envie.v1.ConfigEvent0\x01B0Z.envie-backend/internal/grpcapi/enviev1;enviev1b\x06proto3"
+
+var (
+	file_envie_v1_config_proto_rawDescOnce sync.Once
+	file_envie_v1_config_proto_rawDescData []byte
+)
+
+func file_envie_v1_config_proto_rawDescGZIP() []byte {
+	file_envie_v1_config_proto_rawDescOnce.Do(func() {
+		file_envie_v1_config_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_envie_v1_config_proto_rawDesc), len(file_envie_v1_config_proto_rawDesc)))
+	})
+	return file_envie_v1_config_proto_rawDescData
+}
+
+var file_envie_v1_config_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_envie_v1_config_proto_goTypes = []any{
+	(*VerifyIdentityRequest)(nil),   // 0: envie.v1.VerifyIdentityRequest
+	(*VerifyIdentityResponse)(nil),  // 1: envie.v1.VerifyIdentityResponse
+	(*GetProjectConfigRequest)(nil), // 2: envie.v1.GetProjectConfigRequest
+	(*ConfigItem)(nil),              // 3: envie.v1.ConfigItem
+	(*ProjectConfig)(nil),           // 4: envie.v1.ProjectConfig
+	(*ConfigSignature)(nil),         // 5: envie.v1.ConfigSignature
+	(*WatchConfigRequest)(nil),      // 6: envie.v1.WatchConfigRequest
+	(*ConfigEvent)(nil),             // 7: envie.v1.ConfigEvent
+}
+var file_envie_v1_config_proto_depIdxs = []int32{
+	3, // 0: envie.v1.ProjectConfig.items:type_name -> envie.v1.ConfigItem
+	5, // 1: envie.v1.ProjectConfig.signature:type_name -> envie.v1.ConfigSignature
+	4, // 2: envie.v1.ConfigEvent.config:type_name -> envie.v1.ProjectConfig
+	0, // 3: envie.v1.ConfigService.VerifyIdentity:input_type -> envie.v1.VerifyIdentityRequest
+	2, // 4: envie.v1.ConfigService.GetProjectConfig:input_type -> envie.v1.GetProjectConfigRequest
+	6, // 5: envie.v1.ConfigService.WatchConfig:input_type -> envie.v1.WatchConfigRequest
+	1, // 6: envie.v1.ConfigService.VerifyIdentity:output_type -> envie.v1.VerifyIdentityResponse
+	4, // 7: envie.v1.ConfigService.GetProjectConfig:output_type -> envie.v1.ProjectConfig
+	7, // 8: envie.v1.ConfigService.WatchConfig:output_type -> envie.v1.ConfigEvent
+	6, // [6:9] is the sub-list for method output_type
+	3, // [3:6] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_envie_v1_config_proto_init() }
+func file_envie_v1_config_proto_init() {
+	if File_envie_v1_config_proto != nil {
+		return
+	}
+	file_envie_v1_config_proto_msgTypes[3].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_envie_v1_config_proto_rawDesc), len(file_envie_v1_config_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_envie_v1_config_proto_goTypes,
+		DependencyIndexes: file_envie_v1_config_proto_depIdxs,
+		MessageInfos:      file_envie_v1_config_proto_msgTypes,
+	}.Build()
+	File_envie_v1_config_proto = out.File
+	file_envie_v1_config_proto_goTypes = nil
+	file_envie_v1_config_proto_depIdxs = nil
+}
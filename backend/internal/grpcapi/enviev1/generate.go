@@ -0,0 +1,4 @@
+// Package enviev1 contains the generated gRPC bindings for proto/envie/v1.
+package enviev1
+
+//go:generate protoc -I ../../../proto --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative envie/v1/config.proto
@@ -0,0 +1,300 @@
+// Package grpcapi serves the CLI config API over gRPC for agents and sidecars.
+//
+// It mirrors the /v1/cli REST routes and adds WatchConfig, which pushes config
+// changes to the client instead of making it poll.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"envie-backend/internal/apitime"
+	"envie-backend/internal/configwatch"
+	"envie-backend/internal/database"
+	"envie-backend/internal/grpcapi/enviev1"
+	"envie-backend/internal/handlers"
+	"envie-backend/internal/middleware"
+	"envie-backend/internal/models"
+	"envie-backend/internal/tokenwatch"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// WatchPollInterval is how often WatchConfig re-checks the token and the config
+// checksum, which catches changes made on other instances.
+const WatchPollInterval = 30 * time.Second
+
+type configServer struct {
+	enviev1.UnimplementedConfigServiceServer
+
+	// authenticateIdentity and buildConfig are swapped out in tests
+	authenticateIdentity func(identityID string) (*models.ProjectToken, error)
+	buildConfig          func(ctx context.Context, token *models.ProjectToken, projectID uuid.UUID, envelopeVersions, algorithms string) (*handlers.CLIProjectConfigResponse, error)
+	pollInterval         time.Duration
+	// clientIPs resolves callers behind trusted proxies; nil uses the peer address
+	clientIPs *middleware.ClientIPResolver
+	// observe runs the usage anomaly checks; nil skips them
+	observe func(token *models.ProjectToken, ip string)
+	// recordRead audits a config fetch; nil skips it
+	recordRead func(token *models.ProjectToken, ip string, items int)
+}
+
+func newConfigServer() *configServer {
+	// The router already refused an invalid TRUSTED_PROXIES at startup
+	clientIPs, _ := middleware.ClientIPResolverFromEnv()
+	return &configServer{
+		authenticateIdentity: middleware.AuthenticateCLIIdentity,
+		buildConfig:          handlers.BuildCLIProjectConfig,
+		pollInterval:         WatchPollInterval,
+		clientIPs:            clientIPs,
+		observe:              tokenwatch.ObserveInBackground,
+		recordRead: func(token *models.ProjectToken, ip string, items int) {
+			handlers.RecordCLIConfigRead(database.DB, token, ip, items)
+		},
+	}
+}
+
+// NewServer creates a gRPC server with the config service registered.
+// Transport credentials are passed in opts; see cmd/api.
+func NewServer(opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(opts...)
+	enviev1.RegisterConfigServiceServer(s, newConfigServer())
+	return s
+}
+
+// ListenAndServe serves the config service on addr until the listener fails
+func ListenAndServe(addr string, opts ...grpc.ServerOption) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("gRPC server listening on %s", addr)
+	return NewServer(opts...).Serve(lis)
+}
+
+func (s *configServer) VerifyIdentity(ctx context.Context, _ *enviev1.VerifyIdentityRequest) (*enviev1.VerifyIdentityResponse, error) {
+	token, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := handlers.BuildCLIVerifyResponse(token)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &enviev1.VerifyIdentityResponse{
+		TokenId:     info.TokenID,
+		TokenName:   info.TokenName,
+		ProjectId:   info.ProjectID,
+		ProjectName: info.ProjectName,
+	}
+	if info.ExpiresAt != nil {
+		resp.ExpiresAt = info.ExpiresAt.UTC().Format(apitime.Format)
+	}
+	return resp, nil
+}
+
+func (s *configServer) GetProjectConfig(ctx context.Context, req *enviev1.GetProjectConfigRequest) (*enviev1.ProjectConfig, error) {
+	token, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	projectID, err := handlers.ResolveCLIProject(token, req.GetProjectId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return s.loadConfig(ctx, token, projectID)
+}
+
+func (s *configServer) WatchConfig(req *enviev1.WatchConfigRequest, stream grpc.ServerStreamingServer[enviev1.ConfigEvent]) error {
+	ctx := stream.Context()
+
+	token, err := s.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+
+	projectID, err := handlers.ResolveCLIProject(token, req.GetProjectId())
+	if err != nil {
+		return toStatus(err)
+	}
+
+	// Subscribe before the first read so a change in between isn't missed
+	changes, unsubscribe := configwatch.Subscribe(projectID)
+	defer unsubscribe()
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	// The first event is skipped only when the client already holds a matching,
+	// non-empty checksum; after that, events are sent whenever the checksum changes
+	lastChecksum := req.GetLastChecksum()
+	skipUnchanged := lastChecksum != ""
+	for {
+		config, err := s.loadConfig(ctx, token, projectID)
+		if err != nil {
+			return err
+		}
+
+		if !skipUnchanged || config.ConfigChecksum != lastChecksum {
+			if err := stream.Send(&enviev1.ConfigEvent{Config: config}); err != nil {
+				return err
+			}
+		}
+		skipUnchanged = true
+		lastChecksum = config.ConfigChecksum
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changes:
+		case <-ticker.C:
+		}
+
+		// Re-authenticate on every wake-up so expired or revoked tokens end the stream.
+		// These checks aren't requests of the client, so they aren't observed.
+		if token, err = s.resolveToken(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// authenticate resolves the CLI identity of a call and records its use for the
+// usage anomaly checks
+func (s *configServer) authenticate(ctx context.Context) (*models.ProjectToken, error) {
+	token, err := s.resolveToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.observe != nil {
+		s.observe(token, s.clientIP(ctx))
+	}
+	return token, nil
+}
+
+// resolveToken resolves the CLI identity sent in the x-cli-identity metadata
+func (s *configServer) resolveToken(ctx context.Context) (*models.ProjectToken, error) {
+	identityID := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(strings.ToLower(middleware.CLIIdentityHeader)); len(values) > 0 {
+			identityID = values[0]
+		}
+	}
+
+	token, err := s.authenticateIdentity(identityID)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err := middleware.CheckCLITokenAddress(token, s.clientIP(ctx)); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	return token, nil
+}
+
+// clientIP is the address of the caller, behind trusted proxies read from the
+// same forwarding headers as over HTTP, sent as metadata
+func (s *configServer) clientIP(ctx context.Context) string {
+	remoteAddr := ""
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		remoteAddr = p.Addr.String()
+	}
+	if s.clientIPs == nil {
+		host, _, err := net.SplitHostPort(remoteAddr)
+		if err != nil {
+			return remoteAddr
+		}
+		return host
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	return s.clientIPs.Resolve(remoteAddr, func(name string) []string {
+		return md.Get(name)
+	})
+}
+
+// loadConfig builds the project config, checking the client's envelope and
+// algorithm support from the same headers the REST API uses, sent as metadata
+func (s *configServer) loadConfig(ctx context.Context, token *models.ProjectToken, projectID uuid.UUID) (*enviev1.ProjectConfig, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	envelopeVersions := strings.Join(md.Get(handlers.EnvelopeVersionsHeader), ",")
+	algorithms := strings.Join(md.Get(handlers.AlgorithmsHeader), ",")
+
+	config, err := s.buildConfig(ctx, token, projectID, envelopeVersions, algorithms)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if s.recordRead != nil {
+		s.recordRead(token, s.clientIP(ctx), len(config.Items))
+	}
+
+	items := make([]*enviev1.ConfigItem, len(config.Items))
+	for i, item := range config.Items {
+		items[i] = &enviev1.ConfigItem{
+			Id:             item.ID,
+			Name:           item.Name,
+			EncryptedValue: item.EncryptedValue,
+			Position:       int32(item.Position),
+			Category:       item.Category,
+			Masked:         item.Masked,
+			ValueType:      item.ValueType,
+		}
+	}
+
+	response := &enviev1.ProjectConfig{
+		ProjectId:           config.ProjectID,
+		ProjectName:         config.ProjectName,
+		EncryptedProjectKey: config.EncryptedProjectKey,
+		Items:               items,
+		ConfigChecksum:      config.ConfigChecksum,
+		EnvelopeVersion:     int32(config.EnvelopeVersion),
+
+		ChecksumVersion:      int32(config.ChecksumVersion),
+		LegacyConfigChecksum: config.LegacyConfigChecksum,
+	}
+	if signature := config.Signature; signature != nil {
+		response.Signature = &enviev1.ConfigSignature{
+			KeyId:      signature.KeyID,
+			Algorithm:  signature.Algorithm,
+			KeyVersion: int32(signature.KeyVersion),
+			ItemDigest: signature.ItemDigest,
+			SignedAt:   signature.SignedAt,
+			Value:      signature.Value,
+		}
+	}
+	return response, nil
+}
+
+// toStatus maps a handlers.CLIError to the gRPC code matching its HTTP status
+func toStatus(err error) error {
+	var cliErr *handlers.CLIError
+	if !errors.As(err, &cliErr) {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	code := codes.Internal
+	switch cliErr.Status {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusUpgradeRequired:
+		code = codes.FailedPrecondition
+	}
+	return status.Error(code, cliErr.Message)
+}
@@ -0,0 +1,249 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"envie-backend/internal/configsign"
+	"envie-backend/internal/configwatch"
+	"envie-backend/internal/grpcapi/enviev1"
+	"envie-backend/internal/handlers"
+	"envie-backend/internal/models"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestToStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		code codes.Code
+	}{
+		{&handlers.CLIError{Status: http.StatusBadRequest, Message: "bad"}, codes.InvalidArgument},
+		{&handlers.CLIError{Status: http.StatusUnauthorized, Message: "unauthorized"}, codes.Unauthenticated},
+		{&handlers.CLIError{Status: http.StatusForbidden, Message: "forbidden"}, codes.PermissionDenied},
+		{&handlers.CLIError{Status: http.StatusNotFound, Message: "not found"}, codes.NotFound},
+		{&handlers.CLIError{Status: http.StatusUpgradeRequired, Message: "upgrade"}, codes.FailedPrecondition},
+		{&handlers.CLIError{Status: http.StatusInternalServerError, Message: "boom"}, codes.Internal},
+		{errors.New("plain"), codes.Internal},
+	}
+
+	for _, tt := range tests {
+		st, _ := status.FromError(toStatus(tt.err))
+		if st.Code() != tt.code {
+			t.Errorf("toStatus(%v) = %v, want %v", tt.err, st.Code(), tt.code)
+		}
+		if st.Message() != tt.err.Error() {
+			t.Errorf("toStatus(%v) message = %q", tt.err, st.Message())
+		}
+	}
+}
+
+// fakeStream records the events WatchConfig sends
+type fakeStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	events chan *enviev1.ConfigEvent
+}
+
+func (f *fakeStream) Context() context.Context { return f.ctx }
+
+func (f *fakeStream) Send(event *enviev1.ConfigEvent) error {
+	f.events <- event
+	return nil
+}
+
+// fakeProject stands in for the database behind BuildCLIProjectConfig
+type fakeProject struct {
+	checksums chan string
+	revoked   chan struct{}
+}
+
+func newTestServer(projectID uuid.UUID, project *fakeProject) *configServer {
+	token := &models.ProjectToken{ProjectID: projectID}
+	checksum := ""
+	return &configServer{
+		authenticateIdentity: func(identityID string) (*models.ProjectToken, error) {
+			select {
+			case <-project.revoked:
+				return nil, errors.New("invalid or unknown token")
+			default:
+			}
+			if identityID != "identity" {
+				return nil, errors.New("invalid or unknown token")
+			}
+			return token, nil
+		},
+		buildConfig: func(_ context.Context, _ *models.ProjectToken, id uuid.UUID, _, _ string) (*handlers.CLIProjectConfigResponse, error) {
+			select {
+			case checksum = <-project.checksums:
+			default:
+			}
+			return &handlers.CLIProjectConfigResponse{ProjectID: id.String(), ConfigChecksum: checksum}, nil
+		},
+		pollInterval: time.Hour,
+	}
+}
+
+func watch(t *testing.T, s *configServer, req *enviev1.WatchConfigRequest) (*fakeStream, context.CancelFunc, chan error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-cli-identity", "identity")))
+	stream := &fakeStream{ctx: ctx, events: make(chan *enviev1.ConfigEvent, 10)}
+	done := make(chan error, 1)
+	go func() { done <- s.WatchConfig(req, stream) }()
+	return stream, cancel, done
+}
+
+func nextEvent(t *testing.T, stream *fakeStream) *enviev1.ConfigEvent {
+	t.Helper()
+	select {
+	case event := <-stream.events:
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a config event")
+		return nil
+	}
+}
+
+func expectNoEvent(t *testing.T, stream *fakeStream) {
+	t.Helper()
+	select {
+	case event := <-stream.events:
+		t.Fatalf("unexpected event with checksum %q", event.GetConfig().GetConfigChecksum())
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWatchConfigSendsInitialSnapshot(t *testing.T) {
+	projectID := uuid.New()
+	project := &fakeProject{checksums: make(chan string, 1), revoked: make(chan struct{})}
+	s := newTestServer(projectID, project)
+
+	// A project with no checksum yet still gets its first event
+	stream, cancel, done := watch(t, s, &enviev1.WatchConfigRequest{ProjectId: projectID.String()})
+	defer cancel()
+
+	if got := nextEvent(t, stream).GetConfig().GetProjectId(); got != projectID.String() {
+		t.Fatalf("project ID = %q", got)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("WatchConfig returned %v after cancel", err)
+	}
+}
+
+func TestWatchConfigSkipsMatchingChecksumAndStreamsChanges(t *testing.T) {
+	projectID := uuid.New()
+	project := &fakeProject{checksums: make(chan string, 1), revoked: make(chan struct{})}
+	project.checksums <- "abc"
+	s := newTestServer(projectID, project)
+
+	stream, cancel, _ := watch(t, s, &enviev1.WatchConfigRequest{ProjectId: projectID.String(), LastChecksum: "abc"})
+	defer cancel()
+
+	expectNoEvent(t, stream)
+
+	project.checksums <- "def"
+	configwatch.Publish(projectID)
+
+	if got := nextEvent(t, stream).GetConfig().GetConfigChecksum(); got != "def" {
+		t.Fatalf("checksum = %q, want def", got)
+	}
+
+	// A notification without a checksum change sends nothing
+	configwatch.Publish(projectID)
+	expectNoEvent(t, stream)
+}
+
+func TestWatchConfigEndsWhenTokenIsRevoked(t *testing.T) {
+	projectID := uuid.New()
+	project := &fakeProject{checksums: make(chan string, 1), revoked: make(chan struct{})}
+	s := newTestServer(projectID, project)
+
+	stream, cancel, done := watch(t, s, &enviev1.WatchConfigRequest{ProjectId: projectID.String()})
+	defer cancel()
+	nextEvent(t, stream)
+
+	close(project.revoked)
+	configwatch.Publish(projectID)
+
+	select {
+	case err := <-done:
+		if status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("WatchConfig returned %v, want Unauthenticated", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream did not end after the token was revoked")
+	}
+}
+
+func TestWatchConfigRejectsMissingIdentity(t *testing.T) {
+	s := newTestServer(uuid.New(), &fakeProject{revoked: make(chan struct{})})
+	stream := &fakeStream{ctx: context.Background(), events: make(chan *enviev1.ConfigEvent, 1)}
+
+	err := s.WatchConfig(&enviev1.WatchConfigRequest{ProjectId: uuid.NewString()}, stream)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("WatchConfig returned %v, want Unauthenticated", err)
+	}
+}
+
+func TestGetProjectConfigRecordsRead(t *testing.T) {
+	projectID := uuid.New()
+	project := &fakeProject{checksums: make(chan string, 1), revoked: make(chan struct{})}
+	s := newTestServer(projectID, project)
+	var reads []string
+	s.recordRead = func(_ *models.ProjectToken, ip string, _ int) {
+		reads = append(reads, ip)
+	}
+
+	ctx := peer.NewContext(
+		metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-cli-identity", "identity")),
+		&peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51000}},
+	)
+	if _, err := s.GetProjectConfig(ctx, &enviev1.GetProjectConfigRequest{ProjectId: projectID.String()}); err != nil {
+		t.Fatal(err)
+	}
+	if len(reads) != 1 || reads[0] != "203.0.113.7" {
+		t.Errorf("reads = %v, want one from 203.0.113.7", reads)
+	}
+}
+
+func TestGetProjectConfigCarriesSignature(t *testing.T) {
+	projectID := uuid.New()
+	s := newTestServer(projectID, &fakeProject{checksums: make(chan string, 1), revoked: make(chan struct{})})
+	signature := &configsign.Signature{KeyID: "eb2b7e17484260da", Algorithm: configsign.Algorithm, KeyVersion: 3, ItemDigest: "digest", SignedAt: "2026-10-16T10:00:00Z", Value: "c2ln"}
+	s.buildConfig = func(_ context.Context, _ *models.ProjectToken, id uuid.UUID, _, _ string) (*handlers.CLIProjectConfigResponse, error) {
+		return &handlers.CLIProjectConfigResponse{
+			ProjectID:            id.String(),
+			Items:                []handlers.CLIConfigItem{{Name: "A", ValueType: "string", Masked: true}},
+			ChecksumVersion:      2,
+			LegacyConfigChecksum: "legacy",
+			Signature:            signature,
+		}, nil
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-cli-identity", "identity"))
+	config, err := s.GetProjectConfig(ctx, &enviev1.GetProjectConfigRequest{ProjectId: projectID.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.GetChecksumVersion() != 2 || config.GetLegacyConfigChecksum() != "legacy" {
+		t.Errorf("checksum version %d, legacy %q", config.GetChecksumVersion(), config.GetLegacyConfigChecksum())
+	}
+	if item := config.GetItems()[0]; !item.GetMasked() || item.GetValueType() != "string" {
+		t.Errorf("item %v", item)
+	}
+	got := config.GetSignature()
+	if got.GetKeyId() != signature.KeyID || got.GetKeyVersion() != 3 || got.GetItemDigest() != "digest" || got.GetSignedAt() != signature.SignedAt || got.GetValue() != "c2ln" {
+		t.Errorf("signature %v", got)
+	}
+}
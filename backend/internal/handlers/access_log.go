@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"time"
+
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AccessLogSettings - how much of the organization's traffic is logged, and for
+// how long entries are kept
+type AccessLogSettings struct {
+	Level         string `json:"level" binding:"required,oneof=full metadata writes"`
+	RetentionDays int    `json:"retentionDays" binding:"required,min=1,max=3650"`
+}
+
+// AccessLogPage - a page of the organization's access log, newest first
+type AccessLogPage struct {
+	Items      []models.AccessLog `json:"items"`
+	NextCursor string             `json:"nextCursor,omitempty"`
+}
+
+func GetAccessLogSettings(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	var org models.Organization
+	if err := requestDB(c).Select("id, access_log_level, access_log_retention_days").First(&org, "id = ?", orgID).Error; err != nil {
+		RespondNotFound(c, "Organization not found")
+		return
+	}
+
+	RespondOK(c, AccessLogSettings{Level: org.AccessLogLevel, RetentionDays: org.AccessLogRetentionDays})
+}
+
+func UpdateAccessLogSettings(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	var req AccessLogSettings
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	if err := requestDB(c).Model(&models.Organization{}).Where("id = ?", orgID).Updates(map[string]any{
+		"access_log_level":          req.Level,
+		"access_log_retention_days": req.RetentionDays,
+	}).Error; err != nil {
+		RespondInternalError(c, "Failed to update access log settings")
+		return
+	}
+
+	RespondOK(c, req)
+}
+
+// GetAccessLogs lists the organization's access log; projectId and userId narrow
+// it down
+func GetAccessLogs(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	page, ok := RequestedPage(c)
+	if !ok {
+		return
+	}
+
+	query := requestDB(c).Where("organization_id = ?", orgID)
+	for _, filter := range []struct{ param, column string }{{"projectId", "project_id"}, {"userId", "user_id"}} {
+		value := c.Query(filter.param)
+		if value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			RespondBadRequest(c, "Invalid "+filter.param)
+			return
+		}
+		query = query.Where(filter.column+" = ?", id)
+	}
+
+	var entries []models.AccessLog
+	if err := page.Apply(query, "access_logs").Find(&entries).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch access logs")
+		return
+	}
+
+	var response AccessLogPage
+	response.Items, response.NextCursor = pageItems(page, entries, func(e *models.AccessLog) (time.Time, uuid.UUID) {
+		return e.CreatedAt, e.ID
+	})
+	RespondOK(c, response)
+}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"log"
+	"sort"
+	"strings"
+
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// accessMatrixColumns come before one column per project
+var accessMatrixColumns = []string{"user_id", "email", "name", "organization_role"}
+
+// accessGrant is one way a user reaches a project
+type accessGrant struct {
+	role   string // custom role name, or the built-in role
+	source string // "organization" or "team <name>"
+}
+
+// accessMatrix holds what the rows of an organization's access matrix are built
+// from, everything but the members themselves
+type accessMatrix struct {
+	projects      []models.Project
+	roleNames     map[uuid.UUID]string
+	teamNames     map[uuid.UUID]string
+	teamProjects  map[uuid.UUID]map[uuid.UUID]bool // team ID -> project IDs
+	userTeamRoles map[uuid.UUID][]models.TeamUser  // user ID -> team memberships
+}
+
+func loadAccessMatrix(db *gorm.DB, orgID uuid.UUID) (*accessMatrix, error) {
+	m := &accessMatrix{
+		roleNames:     map[uuid.UUID]string{},
+		teamNames:     map[uuid.UUID]string{},
+		teamProjects:  map[uuid.UUID]map[uuid.UUID]bool{},
+		userTeamRoles: map[uuid.UUID][]models.TeamUser{},
+	}
+
+	if err := db.Select("id", "name").Where("organization_id = ?", orgID).Order("name, id").Find(&m.projects).Error; err != nil {
+		return nil, err
+	}
+
+	var roles []models.Role
+	if err := db.Select("id", "name").Where("organization_id = ?", orgID).Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		m.roleNames[role.ID] = role.Name
+	}
+
+	var teams []models.Team
+	if err := db.Select("id", "name").Where("organization_id = ?", orgID).Find(&teams).Error; err != nil {
+		return nil, err
+	}
+	teamIDs := make([]uuid.UUID, len(teams))
+	for i, team := range teams {
+		teamIDs[i] = team.ID
+		m.teamNames[team.ID] = team.Name
+	}
+	if len(teamIDs) == 0 {
+		return m, nil
+	}
+
+	var teamProjects []models.TeamProject
+	if err := db.Select("team_id", "project_id").Where("team_id IN ?", teamIDs).Find(&teamProjects).Error; err != nil {
+		return nil, err
+	}
+	for _, tp := range teamProjects {
+		if m.teamProjects[tp.TeamID] == nil {
+			m.teamProjects[tp.TeamID] = map[uuid.UUID]bool{}
+		}
+		m.teamProjects[tp.TeamID][tp.ProjectID] = true
+	}
+
+	var teamUsers []models.TeamUser
+	if err := db.Select("team_id", "user_id", "role", "role_id").Where("team_id IN ?", teamIDs).Find(&teamUsers).Error; err != nil {
+		return nil, err
+	}
+	for _, tu := range teamUsers {
+		m.userTeamRoles[tu.UserID] = append(m.userTeamRoles[tu.UserID], tu)
+	}
+	return m, nil
+}
+
+// roleName is the custom role if one is assigned, otherwise the built-in role
+func (m *accessMatrix) roleName(role string, roleID *uuid.UUID) string {
+	if roleID != nil {
+		if name, ok := m.roleNames[*roleID]; ok {
+			return name
+		}
+	}
+	return normalizeOrgRole(role)
+}
+
+// header is the first CSV record: the member columns, then the project names
+func (m *accessMatrix) header() []string {
+	header := append([]string{}, accessMatrixColumns...)
+	for _, project := range m.projects {
+		header = append(header, csvSafe(project.Name))
+	}
+	return header
+}
+
+// row is the CSV record of a member. A cell lists every grant that opens the
+// project, the same ones GetUserProjectAccess combines, and is empty without one.
+func (m *accessMatrix) row(member *models.OrganizationUser) []string {
+	row := []string{
+		member.UserID.String(),
+		csvSafe(member.User.Email),
+		csvSafe(member.User.Name),
+		csvSafe(m.roleName(member.Role, member.RoleID)),
+	}
+
+	// Organization owners and admins open every project with the organization key
+	var orgGrant *accessGrant
+	if IsAdminOrOwner(member.Role) {
+		orgGrant = &accessGrant{role: m.roleName(member.Role, member.RoleID), source: "organization"}
+	}
+
+	for _, project := range m.projects {
+		var grants []accessGrant
+		if orgGrant != nil {
+			grants = append(grants, *orgGrant)
+		}
+		for _, tu := range m.userTeamRoles[member.UserID] {
+			if m.teamProjects[tu.TeamID][project.ID] {
+				grants = append(grants, accessGrant{role: m.roleName(tu.Role, tu.RoleID), source: "team " + m.teamNames[tu.TeamID]})
+			}
+		}
+		row = append(row, csvSafe(formatGrants(grants)))
+	}
+	return row
+}
+
+// formatGrants renders grants as "admin (organization); member (team Backend)",
+// with team grants sorted for stable output
+func formatGrants(grants []accessGrant) string {
+	sort.SliceStable(grants, func(i, j int) bool {
+		return grants[i].source == "organization" && grants[j].source != "organization" ||
+			grants[i].source != "organization" && grants[j].source != "organization" && grants[i].source < grants[j].source
+	})
+	parts := make([]string, len(grants))
+	for i, grant := range grants {
+		parts[i] = grant.role + " (" + grant.source + ")"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// csvSafe keeps spreadsheets from evaluating a user-chosen name as a formula
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// GetAccessMatrix writes a CSV with a row per organization member and a column per
+// project, each cell listing the member's effective roles in the project. Rows are
+// written as members are read, so large organizations don't build the whole grid
+// in memory.
+func GetAccessMatrix(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	db := requestDB(c)
+	matrix, err := loadAccessMatrix(db, orgID)
+	if err != nil {
+		RespondInternalError(c, "Failed to build the access matrix")
+		return
+	}
+
+	rows, err := db.Model(&models.OrganizationUser{}).
+		Select("organization_users.user_id, organization_users.role, organization_users.role_id, users.email, users.name").
+		Joins("JOIN users ON users.id = organization_users.user_id AND users.deleted_at IS NULL").
+		Where("organization_users.organization_id = ?", orgID).
+		Order("users.email").
+		Rows()
+	if err != nil {
+		RespondInternalError(c, "Failed to build the access matrix")
+		return
+	}
+	defer rows.Close()
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="access-matrix-`+orgID.String()+`.csv"`)
+
+	w := csv.NewWriter(c.Writer)
+	write := func(record []string) bool {
+		if err := w.Write(record); err != nil {
+			return false
+		}
+		w.Flush()
+		c.Writer.Flush()
+		return w.Error() == nil
+	}
+
+	// Once the header is out the status is sent, so failures can only cut the file
+	// short; they are logged
+	if !write(matrix.header()) {
+		log.Printf("access matrix of %s: write failed: %v", orgID, w.Error())
+		return
+	}
+	for rows.Next() {
+		var member models.OrganizationUser
+		if err := rows.Scan(&member.UserID, &member.Role, &member.RoleID, &member.User.Email, &member.User.Name); err != nil {
+			log.Printf("access matrix of %s: %v", orgID, err)
+			return
+		}
+		if !write(matrix.row(&member)) {
+			log.Printf("access matrix of %s: write failed: %v", orgID, w.Error())
+			return
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("access matrix of %s: %v", orgID, err)
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"envie-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestAccessMatrixRow(t *testing.T) {
+	api, worker := uuid.New(), uuid.New()
+	backend, ops := uuid.New(), uuid.New()
+	deployer := uuid.New()
+	m := &accessMatrix{
+		projects:      []models.Project{{ID: api, Name: "api"}, {ID: worker, Name: "=worker"}},
+		roleNames:     map[uuid.UUID]string{deployer: "Deployer"},
+		teamNames:     map[uuid.UUID]string{backend: "Backend", ops: "Ops"},
+		teamProjects:  map[uuid.UUID]map[uuid.UUID]bool{backend: {api: true}, ops: {api: true, worker: true}},
+		userTeamRoles: map[uuid.UUID][]models.TeamUser{},
+	}
+
+	admin := models.OrganizationUser{UserID: uuid.New(), Role: "admin", User: models.User{Email: "admin@example.com", Name: "Ada"}}
+	member := models.OrganizationUser{UserID: uuid.New(), Role: "member", User: models.User{Email: "dev@example.com", Name: "@dev"}}
+	outsider := models.OrganizationUser{UserID: uuid.New(), Role: "member", RoleID: &deployer, User: models.User{Email: "new@example.com"}}
+	m.userTeamRoles[admin.UserID] = []models.TeamUser{{TeamID: backend, Role: "owner"}}
+	m.userTeamRoles[member.UserID] = []models.TeamUser{{TeamID: ops, Role: "member"}, {TeamID: backend, Role: "member", RoleID: &deployer}}
+
+	if got, want := m.header(), []string{"user_id", "email", "name", "organization_role", "api", "'=worker"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("header = %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		member *models.OrganizationUser
+		cells  []string
+	}{
+		{&admin, []string{"admin", "admin (organization); owner (team Backend)", "admin (organization)"}},
+		{&member, []string{"member", "Deployer (team Backend); member (team Ops)", "member (team Ops)"}},
+		{&outsider, []string{"Deployer", "", ""}},
+	}
+	for _, tt := range tests {
+		row := m.row(tt.member)
+		if row[0] != tt.member.UserID.String() || row[1] != tt.member.User.Email {
+			t.Errorf("row starts with %q", row[:2])
+		}
+		if got := append([]string{row[3]}, row[4:]...); !reflect.DeepEqual(got, tt.cells) {
+			t.Errorf("%s: cells = %q, want %q", tt.member.User.Email, got, tt.cells)
+		}
+	}
+	if name := m.row(&member)[2]; name != "'@dev" {
+		t.Errorf("name = %q, want it escaped for spreadsheets", name)
+	}
+}
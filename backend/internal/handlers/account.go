@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"envie-backend/internal/accountdeletion"
+	"envie-backend/internal/apierror"
+	"envie-backend/internal/auth"
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AccountDeletionResponse - when the personal data of the deleted account is erased
+type AccountDeletionResponse struct {
+	Message string    `json:"message"`
+	PurgeAt time.Time `json:"purgeAt"` // signing in before then restores the account
+}
+
+// ExportedMembership - an organization or team the user belongs to
+type ExportedMembership struct {
+	ID             uuid.UUID  `json:"id"`
+	Name           string     `json:"name"`
+	OrganizationID *uuid.UUID `json:"organizationId,omitempty"` // of a team
+	Role           string     `json:"role"`
+	JoinedAt       time.Time  `json:"joinedAt"`
+}
+
+// ExportedDevice - a registered device, without its encrypted master key
+type ExportedDevice struct {
+	ID         uuid.UUID `json:"id"`
+	Name       string    `json:"name"`
+	PublicKey  string    `json:"publicKey"`
+	Approved   bool      `json:"approved"`
+	LastActive time.Time `json:"lastActive"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// AccountExport - everything stored about the user. Secrets (the TOTP secret,
+// recovery code and token hashes) are left out; encrypted keys are left out as
+// the user's devices hold them already.
+type AccountExport struct {
+	ExportedAt          time.Time                   `json:"exportedAt"`
+	User                models.User                 `json:"user"`
+	Organizations       []ExportedMembership        `json:"organizations"`
+	Teams               []ExportedMembership        `json:"teams"`
+	Devices             []ExportedDevice            `json:"devices"`
+	Sessions            []models.RefreshToken       `json:"sessions"` // every refresh token, by family
+	SSOIdentities       []models.UserSSOIdentity    `json:"ssoIdentities"`
+	TwoFactorEvents     []models.TwoFactorEvent     `json:"twoFactorEvents"`
+	LinkingCodeFailures []models.LinkingCodeFailure `json:"linkingCodeFailures"` // wrong attempts at the user's codes
+	Notifications       []models.Notification       `json:"notifications"`
+	AuditEvents         []models.AuditEvent         `json:"auditEvents"` // actions the user took
+	AccessLogs          []models.AccessLog          `json:"accessLogs"`  // requests the user made
+}
+
+// DeleteAccount deletes the caller's account. Their memberships, devices and
+// sessions go at once; the rest of their personal data is erased after the
+// grace period, and signing in before then restores the account without them.
+// The last owner of an organization has to hand it over first.
+func DeleteAccount(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	if !RequireTwoFactor(c, uid, TwoFactorActionDeleteAccount) {
+		return
+	}
+
+	var soleOwned []string
+	if err := requestDB(c).Table("organizations").
+		Joins("JOIN organization_users ON organization_users.organization_id = organizations.id").
+		Where("organization_users.user_id = ? AND organization_users.role = ? AND organizations.deleted_at IS NULL", uid, "owner").
+		Where("NOT EXISTS (SELECT 1 FROM organization_users other WHERE other.organization_id = organizations.id AND other.role = ? AND other.user_id <> ?)", "owner", uid).
+		Order("organizations.name").Pluck("organizations.name", &soleOwned).Error; err != nil {
+		RespondInternalError(c, "Failed to check organization ownership")
+		return
+	}
+	if len(soleOwned) > 0 {
+		c.JSON(http.StatusConflict, apierror.H(apierror.CodeConflict,
+			fmt.Sprintf("You are the last owner of %s; make another member an owner first", strings.Join(soleOwned, ", ")),
+			gin.H{"organizations": soleOwned}))
+		return
+	}
+
+	var user models.User
+	if err := requestDB(c).Select("id, email").First(&user, "id = ?", uid).Error; err != nil {
+		RespondNotFound(c, "User not found")
+		return
+	}
+
+	now := time.Now()
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		var orgIDs []uuid.UUID
+		if err := tx.Model(&models.OrganizationUser{}).Where("user_id = ?", uid).Pluck("organization_id", &orgIDs).Error; err != nil {
+			return err
+		}
+
+		for _, table := range []any{
+			&models.TeamUser{},
+			&models.OrganizationUser{},
+			&models.PendingKeyGrant{},
+			&models.UserIdentity{},
+			&models.LinkingCode{},
+			&models.UserSSOIdentity{},
+		} {
+			if err := tx.Where("user_id = ?", uid).Delete(table).Error; err != nil {
+				return err
+			}
+		}
+		if _, err := auth.RevokeUserRefreshTokens(tx, uid, auth.RevokedDeleted, now); err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.User{}, "id = ?", uid).Error; err != nil {
+			return err
+		}
+
+		for _, orgID := range orgIDs {
+			if err := recordAuditEvent(tx, orgID, nil, uid, models.AuditMemberDeleted, user.Email, 1); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to delete account")
+		return
+	}
+
+	RespondOK(c, AccountDeletionResponse{
+		Message: "Account deleted",
+		PurgeAt: accountdeletion.PurgeAt(now),
+	})
+}
+
+// restoreDeletedAccount cancels the deletion of an account signing in during its
+// grace period. The user has to be loaded unscoped.
+func restoreDeletedAccount(db *gorm.DB, user *models.User) error {
+	if !user.DeletedAt.Valid {
+		return nil
+	}
+	if err := db.Unscoped().Model(user).UpdateColumn("deleted_at", nil).Error; err != nil {
+		return err
+	}
+	log.Printf("Restored account %s, deleted at %s", user.ID, user.DeletedAt.Time)
+	user.DeletedAt = gorm.DeletedAt{}
+	return nil
+}
+
+// ExportAccount returns everything stored about the caller as a JSON download
+func ExportAccount(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	db := requestDB(c)
+	export := AccountExport{ExportedAt: time.Now()}
+	if err := db.First(&export.User, "id = ?", uid).Error; err != nil {
+		RespondNotFound(c, "User not found")
+		return
+	}
+
+	err := db.Table("organization_users").
+		Select("organizations.id, organizations.name, organization_users.role, organization_users.created_at AS joined_at").
+		Joins("JOIN organizations ON organizations.id = organization_users.organization_id AND organizations.deleted_at IS NULL").
+		Where("organization_users.user_id = ?", uid).Order("organizations.name").Scan(&export.Organizations).Error
+	if err == nil {
+		err = db.Table("team_users").
+			Select("teams.id, teams.name, teams.organization_id, team_users.role, team_users.created_at AS joined_at").
+			Joins("JOIN teams ON teams.id = team_users.team_id AND teams.deleted_at IS NULL").
+			Where("team_users.user_id = ?", uid).Order("teams.name").Scan(&export.Teams).Error
+	}
+	if err == nil {
+		var identities []models.UserIdentity
+		err = db.Where("user_id = ?", uid).Order("created_at").Find(&identities).Error
+		export.Devices = make([]ExportedDevice, len(identities))
+		for i, identity := range identities {
+			export.Devices[i] = ExportedDevice{
+				ID:         identity.ID,
+				Name:       identity.Name,
+				PublicKey:  identity.PublicKey,
+				Approved:   identity.EncryptedMasterKey != nil,
+				LastActive: identity.LastActive,
+				CreatedAt:  identity.CreatedAt,
+			}
+		}
+	}
+	for _, list := range []struct {
+		dest  any
+		where string
+	}{
+		{&export.Sessions, "user_id = ?"},
+		{&export.SSOIdentities, "user_id = ?"},
+		{&export.TwoFactorEvents, "user_id = ?"},
+		{&export.LinkingCodeFailures, "user_id = ?"},
+		{&export.Notifications, "user_id = ?"},
+		{&export.AuditEvents, "actor_id = ?"},
+		{&export.AccessLogs, "user_id = ?"},
+	} {
+		if err != nil {
+			break
+		}
+		err = db.Where(list.where, uid).Order("created_at").Find(list.dest).Error
+	}
+	if err != nil {
+		RespondInternalError(c, "Failed to export account data")
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="envie-export-%s.json"`, export.ExportedAt.Format("2006-01-02")))
+	RespondOK(c, export)
+}
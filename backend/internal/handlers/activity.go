@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"envie-backend/internal/apitime"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// organizationActivityActions are the audit log entries shown in the activity
+// feed. The rest of the log stays with the admins (see GetAuditEvents).
+var organizationActivityActions = []string{
+	models.AuditProjectCreated,
+	models.AuditMemberAdded,
+	models.AuditRotationCommitted,
+	models.AuditTokenIssued,
+	models.AuditTokenRotated,
+}
+
+// projectActivityActions are the audit log entries shown in a project's timeline
+var projectActivityActions = []string{
+	models.AuditProjectCreated,
+	models.AuditConfigSynced,
+	models.AuditFileUploaded,
+	models.AuditFileDeleted,
+	models.AuditTokenIssued,
+	models.AuditTokenRotated,
+	models.AuditTokenRenewed,
+	models.AuditTokenDeleted,
+	models.AuditTokensRevoked,
+	models.AuditRotationInitiated,
+	models.AuditRotationCommitted,
+}
+
+// ActivityActor - who made a change. Name and email are empty once the account is
+// erased.
+type ActivityActor struct {
+	ID    uuid.UUID `json:"id"`
+	Name  string    `json:"name"`
+	Email string    `json:"email"`
+}
+
+// ActivityEvent - a change in an organization
+type ActivityEvent struct {
+	ID          uuid.UUID     `json:"id"`
+	Action      string        `json:"action"`
+	ProjectID   *uuid.UUID    `json:"projectId"`   // nil for organization-wide changes
+	ProjectName *string       `json:"projectName"` // nil as well once the project is deleted
+	Actor       ActivityActor `json:"actor"`
+	Detail      string        `json:"detail"`
+	Count       int           `json:"count"`
+	CreatedAt   time.Time     `json:"createdAt"`
+
+	// Config checksums around a config sync, so a client can tell which change
+	// produced the values it holds
+	ChecksumBefore *string `json:"checksumBefore,omitempty"`
+	ChecksumAfter  *string `json:"checksumAfter,omitempty"`
+}
+
+// ActivityPage - a page of an activity feed, newest first
+type ActivityPage struct {
+	Items      []ActivityEvent `json:"items"`
+	NextCursor string          `json:"nextCursor,omitempty"`
+}
+
+type activityRow struct {
+	models.AuditEvent
+	ProjectName *string
+	ActorName   *string
+	ActorEmail  *string
+}
+
+// GetOrganizationActivity lists recent changes in the organization: projects
+// created, members added, key rotations committed and tokens issued. Members see
+// organization-wide changes and those of the projects their teams can access;
+// admins see everything.
+//
+// Query parameters: since (a timestamp, changes after it), action (comma
+// separated actions to keep), limit and cursor.
+func GetOrganizationActivity(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	orgUser, ok := RequireOrgMembership(c, uid, orgID)
+	if !ok {
+		return
+	}
+
+	page, ok := RequestedPage(c)
+	if !ok {
+		return
+	}
+
+	query, ok := activityQuery(c, organizationActivityActions)
+	if !ok {
+		return
+	}
+	query = query.Where("audit_events.organization_id = ?", orgID)
+	if !IsAdminOrOwner(orgUser.Role) {
+		query = query.Where(`(audit_events.project_id IS NULL OR audit_events.project_id IN (
+			SELECT team_projects.project_id FROM team_projects
+			JOIN team_users ON team_users.team_id = team_projects.team_id
+			WHERE team_users.user_id = ?))`, uid)
+	}
+
+	var rows []activityRow
+	if err := page.Apply(query, "audit_events").Scan(&rows).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch activity")
+		return
+	}
+
+	RespondOK(c, activityPage(page, rows))
+}
+
+// GetProjectActivity lists a project's changes as one timeline: config syncs with
+// the checksum before and after, file uploads and deletions, token lifecycle
+// events and key rotations. Anyone with access to the project can read it.
+//
+// Query parameters are those of GetOrganizationActivity.
+func GetProjectActivity(c *gin.Context) {
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	page, ok := RequestedPage(c)
+	if !ok {
+		return
+	}
+
+	query, ok := activityQuery(c, projectActivityActions)
+	if !ok {
+		return
+	}
+	query = query.Where("audit_events.project_id = ?", projectID)
+
+	var rows []activityRow
+	if err := page.Apply(query, "audit_events").Scan(&rows).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch activity")
+		return
+	}
+
+	RespondOK(c, activityPage(page, rows))
+}
+
+// activityQuery selects audit events with the names of their project and actor,
+// filtered by the action and since query parameters. allowed are the actions of
+// the feed. If a parameter is invalid, it sends an error response automatically.
+func activityQuery(c *gin.Context, allowed []string) (*gorm.DB, bool) {
+	actions := allowed
+	if value := c.Query("action"); value != "" {
+		actions = strings.Split(value, ",")
+		for _, action := range actions {
+			if !slices.Contains(allowed, action) {
+				RespondBadRequest(c, "Unknown action: "+action+". Must be one of "+strings.Join(allowed, ", "))
+				return nil, false
+			}
+		}
+	}
+
+	query := requestDB(c).Table("audit_events").
+		Select("audit_events.*, projects.name AS project_name, users.name AS actor_name, users.email AS actor_email").
+		Joins("LEFT JOIN projects ON projects.id = audit_events.project_id AND projects.deleted_at IS NULL").
+		Joins("LEFT JOIN users ON users.id = audit_events.actor_id").
+		Where("audit_events.action IN ?", actions)
+	if value := c.Query("since"); value != "" {
+		since, err := apitime.Parse(value)
+		if err != nil {
+			RespondBadRequest(c, "Invalid since: expected a timestamp")
+			return nil, false
+		}
+		query = query.Where("audit_events.created_at > ?", since)
+	}
+	return query, true
+}
+
+func activityPage(page PageRequest, rows []activityRow) ActivityPage {
+	rows, next := pageItems(page, rows, func(r *activityRow) (time.Time, uuid.UUID) {
+		return r.CreatedAt, r.ID
+	})
+
+	items := make([]ActivityEvent, len(rows))
+	for i, row := range rows {
+		items[i] = ActivityEvent{
+			ID:          row.ID,
+			Action:      row.Action,
+			ProjectID:   row.ProjectID,
+			ProjectName: row.ProjectName,
+			Actor:       ActivityActor{ID: row.ActorID, Name: deref(row.ActorName), Email: deref(row.ActorEmail)},
+			Detail:      row.Detail,
+			Count:       row.Count,
+			CreatedAt:   row.CreatedAt,
+
+			ChecksumBefore: row.ChecksumBefore,
+			ChecksumAfter:  row.ChecksumAfter,
+		}
+	}
+	return ActivityPage{Items: items, NextCursor: next}
+}
+
+func deref(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"envie-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestActivityPage(t *testing.T) {
+	now := time.Now().UTC()
+	projectName, actorName, before, after := "api", "Ada", "aa11", "bb22"
+	rows := make([]activityRow, 3)
+	for i := range rows {
+		rows[i] = activityRow{AuditEvent: models.AuditEvent{
+			ID:        uuid.New(),
+			ActorID:   uuid.New(),
+			Action:    models.AuditTokenIssued,
+			CreatedAt: now.Add(-time.Duration(i) * time.Minute),
+		}}
+	}
+	rows[0].ProjectName, rows[0].ActorName = &projectName, &actorName
+	rows[0].Action, rows[0].ChecksumBefore, rows[0].ChecksumAfter = models.AuditConfigSynced, &before, &after
+
+	page := activityPage(PageRequest{Limit: 2}, rows)
+	if len(page.Items) != 2 || page.NextCursor == "" {
+		t.Fatalf("%d items, cursor %q; want 2 and a next page", len(page.Items), page.NextCursor)
+	}
+	first := page.Items[0]
+	if first.ID != rows[0].ID || first.Actor.ID != rows[0].ActorID || first.Actor.Name != "Ada" || *first.ProjectName != "api" ||
+		*first.ChecksumBefore != before || *first.ChecksumAfter != after {
+		t.Errorf("first item = %+v", first)
+	}
+	// An erased account or a deleted project leaves the names empty
+	if second := page.Items[1]; second.Actor.Name != "" || second.Actor.Email != "" || second.ProjectName != nil {
+		t.Errorf("second item = %+v", second)
+	}
+
+	if last := activityPage(PageRequest{Limit: 5}, rows); last.NextCursor != "" || len(last.Items) != 3 {
+		t.Errorf("last page: %d items, cursor %q", len(last.Items), last.NextCursor)
+	}
+	if empty := activityPage(PageRequest{Limit: 5}, nil); empty.Items == nil {
+		t.Error("empty page has nil items, want []")
+	}
+}
@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"envie-backend/internal/apitime"
+	"envie-backend/internal/auditstream"
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+	"envie-backend/internal/settings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const maxAuditExportRange = 366 * 24 * time.Hour
+
+// AuditStreamRequest configures where the organization's audit events are
+// shipped. Only the fields of the destination are used; an empty
+// secretAccessKey keeps the current one.
+type AuditStreamRequest struct {
+	Destination  string `json:"destination" binding:"required,oneof=https syslog s3"`
+	Enabled      *bool  `json:"enabled"` // default true
+	IncludeReads bool   `json:"includeReads"`
+
+	URL     string `json:"url"`
+	Address string `json:"address"`
+
+	Bucket          string `json:"bucket" binding:"max=255"`
+	Prefix          string `json:"prefix" binding:"max=255"`
+	Region          string `json:"region" binding:"max=50"`
+	Endpoint        string `json:"endpoint"`
+	AccessKeyID     string `json:"accessKeyId" binding:"max=255"`
+	SecretAccessKey string `json:"secretAccessKey" binding:"max=1024"`
+
+	// RotateSecret replaces the signing secret
+	RotateSecret bool `json:"rotateSecret"`
+}
+
+// AuditStreamResponse - the stream's settings and delivery state. SigningSecret
+// is only returned when it's created or rotated.
+type AuditStreamResponse struct {
+	models.AuditStream
+	SigningSecret string `json:"signingSecret,omitempty"`
+}
+
+func newSigningSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+func GetAuditStream(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	var stream models.AuditStream
+	if err := requestDB(c).First(&stream, "organization_id = ?", orgID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			RespondNotFound(c, "No audit stream configured")
+		} else {
+			RespondInternalError(c, "Failed to fetch audit stream")
+		}
+		return
+	}
+
+	RespondOK(c, AuditStreamResponse{AuditStream: stream})
+}
+
+// PutAuditStream configures the organization's audit stream. A new stream ships
+// events recorded from now on; older ones are exported with
+// ExportAuditEvents. Changing the destination keeps the cursor, so the new one
+// gets the events the old one hasn't.
+func PutAuditStream(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	var req AuditStreamRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	db := requestDB(c)
+	var stream models.AuditStream
+	err := db.First(&stream, "organization_id = ?", orgID).Error
+	created := errors.Is(err, gorm.ErrRecordNotFound)
+	if err != nil && !created {
+		RespondInternalError(c, "Failed to fetch audit stream")
+		return
+	}
+	if created {
+		stream = models.AuditStream{OrganizationID: orgID, CursorAt: time.Now(), CreatedByID: uid}
+	}
+
+	secretAccessKey := stream.SecretAccessKey
+	if req.SecretAccessKey != "" || stream.Destination != models.AuditStreamS3 {
+		secretAccessKey = req.SecretAccessKey
+	}
+	stream.Destination = req.Destination
+	stream.Enabled = req.Enabled == nil || *req.Enabled
+	stream.IncludeReads = req.IncludeReads
+	stream.URL, stream.Address = "", ""
+	stream.Bucket, stream.Prefix, stream.Region, stream.Endpoint, stream.AccessKeyID, stream.SecretAccessKey = "", "", "", "", "", ""
+	switch req.Destination {
+	case models.AuditStreamHTTPS:
+		stream.URL = req.URL
+	case models.AuditStreamSyslog:
+		stream.Address = req.Address
+	case models.AuditStreamS3:
+		stream.Bucket, stream.Prefix, stream.Region, stream.Endpoint = req.Bucket, req.Prefix, req.Region, req.Endpoint
+		stream.AccessKeyID, stream.SecretAccessKey = req.AccessKeyID, secretAccessKey
+	}
+	if err := auditstream.Validate(&stream); err != nil {
+		RespondBadRequest(c, err.Error())
+		return
+	}
+	// Refused at configuration rather than at every shipment
+	if err := settings.EgressPolicy().CheckHost(auditstream.Host(&stream)); err != nil {
+		RespondBadRequest(c, err.Error())
+		return
+	}
+
+	var response AuditStreamResponse
+	if created || req.RotateSecret {
+		secret, err := newSigningSecret()
+		if err != nil {
+			RespondInternalError(c, "Failed to save audit stream")
+			return
+		}
+		stream.SigningSecret = secret
+		response.SigningSecret = secret
+	}
+
+	err = database.Transaction(db, func(tx *gorm.DB) error {
+		if err := tx.Save(&stream).Error; err != nil {
+			return err
+		}
+		return recordAuditEvent(tx, orgID, nil, uid, models.AuditStreamConfigured, auditstream.Host(&stream), 0)
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to save audit stream")
+		return
+	}
+
+	response.AuditStream = stream
+	RespondOK(c, response)
+}
+
+func DeleteAuditStream(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	var deleted int64
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		result := tx.Where("organization_id = ?", orgID).Delete(&models.AuditStream{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		return recordAuditEvent(tx, orgID, nil, uid, models.AuditStreamRemoved, "", 0)
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to delete audit stream")
+		return
+	}
+	if deleted == 0 {
+		RespondNotFound(c, "No audit stream configured")
+		return
+	}
+
+	RespondMessage(c, "Audit stream deleted")
+}
+
+// ExportAuditEvents streams the organization's audit events recorded in
+// [from, to), read events included, oldest first, as CSV, NDJSON or a JSON
+// array: for backfilling a SIEM or an audit without one
+func ExportAuditEvents(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	from, fromErr := apitime.Parse(c.Query("from"))
+	to, toErr := apitime.Parse(c.Query("to"))
+	if fromErr != nil || toErr != nil {
+		RespondBadRequest(c, "from and to must be timestamps")
+		return
+	}
+	if !to.After(from) {
+		RespondBadRequest(c, "to must be after from")
+		return
+	}
+	if to.Sub(from) > maxAuditExportRange {
+		RespondBadRequest(c, "Exports can cover at most 366 days")
+		return
+	}
+
+	format := c.DefaultQuery("format", "ndjson")
+	contentType, ok := map[string]string{
+		"csv":    "text/csv; charset=utf-8",
+		"ndjson": "application/x-ndjson",
+		"json":   "application/json",
+	}[format]
+	if !ok {
+		RespondBadRequest(c, "format must be csv, ndjson or json")
+		return
+	}
+
+	db := requestDB(c)
+	rows, err := db.Model(&models.AuditEvent{}).
+		Where("organization_id = ? AND created_at >= ? AND created_at < ?", orgID, from, to).
+		Order("created_at, id").
+		Rows()
+	if err != nil {
+		RespondInternalError(c, "Failed to export audit events")
+		return
+	}
+	defer rows.Close()
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="audit-events-`+orgID.String()+`.`+format+`"`)
+	c.Status(http.StatusOK)
+
+	// Once the first bytes are out the status is sent, so failures can only cut
+	// the file short; they are logged
+	writer := newAuditEventWriter(c.Writer, format)
+	for rows.Next() {
+		var event models.AuditEvent
+		if err := db.ScanRows(rows, &event); err != nil {
+			log.Printf("audit export of %s: %v", orgID, err)
+			return
+		}
+		if err := writer.write(&event); err != nil {
+			log.Printf("audit export of %s: write failed: %v", orgID, err)
+			return
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("audit export of %s: %v", orgID, err)
+		return
+	}
+	if err := writer.close(); err != nil {
+		log.Printf("audit export of %s: write failed: %v", orgID, err)
+	}
+}
+
+var auditEventCSVHeader = []string{"id", "created_at", "action", "actor_id", "token_id", "project_id", "client_ip", "detail", "count"}
+
+// auditEventWriter writes exported events in one of the export formats
+type auditEventWriter struct {
+	w      gin.ResponseWriter
+	format string
+	csv    *csv.Writer
+	count  int
+}
+
+func newAuditEventWriter(w gin.ResponseWriter, format string) *auditEventWriter {
+	writer := &auditEventWriter{w: w, format: format}
+	if format == "csv" {
+		writer.csv = csv.NewWriter(w)
+	}
+	return writer
+}
+
+func (a *auditEventWriter) write(event *models.AuditEvent) error {
+	defer func() { a.count++ }()
+	switch a.format {
+	case "csv":
+		if a.count == 0 {
+			if err := a.csv.Write(auditEventCSVHeader); err != nil {
+				return err
+			}
+		}
+		if err := a.csv.Write(auditEventRecord(event)); err != nil {
+			return err
+		}
+		a.csv.Flush()
+		return a.csv.Error()
+	case "json":
+		separator := ","
+		if a.count == 0 {
+			separator = "["
+		}
+		if _, err := a.w.Write([]byte(separator)); err != nil {
+			return err
+		}
+		return json.NewEncoder(a.w).Encode(event)
+	default:
+		return json.NewEncoder(a.w).Encode(event)
+	}
+}
+
+// close ends the export, which may have had no events
+func (a *auditEventWriter) close() error {
+	switch {
+	case a.format == "csv" && a.count == 0:
+		if err := a.csv.Write(auditEventCSVHeader); err != nil {
+			return err
+		}
+		a.csv.Flush()
+		return a.csv.Error()
+	case a.format == "json" && a.count == 0:
+		_, err := a.w.Write([]byte("[]\n"))
+		return err
+	case a.format == "json":
+		_, err := a.w.Write([]byte("]\n"))
+		return err
+	}
+	return nil
+}
+
+func auditEventRecord(event *models.AuditEvent) []string {
+	optional := func(id *uuid.UUID) string {
+		if id == nil {
+			return ""
+		}
+		return id.String()
+	}
+	clientIP := ""
+	if event.ClientIP != nil {
+		clientIP = *event.ClientIP
+	}
+	return []string{
+		event.ID.String(),
+		event.CreatedAt.UTC().Format(apitime.Format),
+		event.Action,
+		event.ActorID.String(),
+		optional(event.TokenID),
+		optional(event.ProjectID),
+		clientIP,
+		csvSafe(event.Detail),
+		strconv.Itoa(event.Count),
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func exportEvents(t *testing.T, format string, events []models.AuditEvent) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	writer := newAuditEventWriter(c.Writer, format)
+	for i := range events {
+		if err := writer.write(&events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.close(); err != nil {
+		t.Fatal(err)
+	}
+	return w.Body.String()
+}
+
+func TestAuditEventWriter(t *testing.T) {
+	ip := "203.0.113.7"
+	events := []models.AuditEvent{
+		{ID: uuid.New(), Action: models.AuditFileDownloaded, Detail: "=HYPERLINK(\"x\")", Count: 1, ClientIP: &ip, CreatedAt: time.Unix(1700000000, 0)},
+		{ID: uuid.New(), Action: models.AuditTokenIssued, CreatedAt: time.Unix(1700000001, 0)},
+	}
+
+	var array []models.AuditEvent
+	if err := json.Unmarshal([]byte(exportEvents(t, "json", events)), &array); err != nil || len(array) != 2 || array[1].ID != events[1].ID {
+		t.Errorf("json export = %v, %v", array, err)
+	}
+	if got := exportEvents(t, "json", nil); strings.TrimSpace(got) != "[]" {
+		t.Errorf("empty json export = %q", got)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(exportEvents(t, "ndjson", events)), "\n"); len(lines) != 2 {
+		t.Errorf("ndjson export has %d lines", len(lines))
+	}
+
+	csv := strings.Split(strings.TrimSpace(exportEvents(t, "csv", events)), "\n")
+	if len(csv) != 3 || csv[0] != strings.Join(auditEventCSVHeader, ",") {
+		t.Fatalf("csv export = %q", csv)
+	}
+	if !strings.Contains(csv[1], "203.0.113.7") || !strings.Contains(csv[1], `"'=HYPERLINK(""x"")"`) {
+		t.Errorf("csv row = %s", csv[1])
+	}
+	if got := exportEvents(t, "csv", nil); strings.TrimSpace(got) != strings.Join(auditEventCSVHeader, ",") {
+		t.Errorf("empty csv export = %q", got)
+	}
+}
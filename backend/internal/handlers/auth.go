@@ -3,14 +3,16 @@ package handlers
 import (
 	"errors"
 	"fmt"
+	"html"
 	"html/template"
 	"log"
 	"net/http"
 	"strings"
 	"time"
 
+	"envie-backend/internal/apierror"
 	"envie-backend/internal/auth"
-	"envie-backend/internal/database"
+	"envie-backend/internal/middleware"
 	"envie-backend/internal/models"
 
 	"github.com/gin-gonic/gin"
@@ -34,13 +36,14 @@ func AuthCallback(c *gin.Context) {
 
 	githubUser, err := auth.GetGithubUser(code)
 	if err != nil {
-		c.HTML(http.StatusInternalServerError, "", renderErrorPage("Authentication failed: "+err.Error()))
+		writeAuthErrorPage(c, "Authentication failed: "+err.Error())
 		return
 	}
 
 
+	// Unscoped, so signing in restores an account during its deletion grace period
 	var user models.User
-	if err := database.DB.Where("github_id = ?", githubUser.ID).First(&user).Error; err != nil {
+	if err := requestDB(c).Unscoped().Where("github_id = ?", githubUser.ID).First(&user).Error; err != nil {
 		if !errors.Is(err, gorm.ErrRecordNotFound) {
 			RespondInternalError(c, "Failed to check for user existence")
 			return
@@ -58,11 +61,16 @@ func AuthCallback(c *gin.Context) {
 			user.Name = githubUser.Login
 		}
 
-		if err := database.DB.Create(&user).Error; err != nil {
-			c.HTML(http.StatusInternalServerError, "", renderErrorPage("Failed to create user: "+err.Error()))
+		if err := requestDB(c).Create(&user).Error; err != nil {
+			writeAuthErrorPage(c, "Failed to create user: "+err.Error())
 			return
 		}
 	} else {
+		if err := restoreDeletedAccount(requestDB(c), &user); err != nil {
+			writeAuthErrorPage(c, "Failed to restore account: "+err.Error())
+			return
+		}
+
 		user.Name = githubUser.Name
 		user.Email = githubUser.Email
 		user.AvatarURL = githubUser.AvatarURL
@@ -71,34 +79,14 @@ func AuthCallback(c *gin.Context) {
 			user.Name = githubUser.Login
 		}
 
-		database.DB.Save(&user)
-	}
-
-	// Clean old linking codes
-	database.DB.Where("user_id = ? AND (used_at IS NOT NULL OR expires_at < ?)", user.ID, time.Now()).
-		Delete(&models.LinkingCode{})
-
-	linkingCode, err := auth.GenerateLinkingCode()
-	if err != nil {
-		c.HTML(http.StatusInternalServerError, "", renderErrorPage("Failed to generate linking code"))
-		return
+		requestDB(c).Save(&user)
 	}
 
-	linkingCodeRecord := models.LinkingCode{
-		Code:      strings.ToUpper(linkingCode),
-		UserID:    user.ID,
-		ExpiresAt: time.Now().Add(auth.LinkingCodeDuration),
-	}
-
-	if err := database.DB.Create(&linkingCodeRecord).Error; err != nil {
-		c.HTML(http.StatusInternalServerError, "", renderErrorPage("Failed to save linking code: "+err.Error()))
+	if !ssoSignInAllowed(c, user.ID, nil) {
 		return
 	}
 
-	log.Printf("Created linking code for user %s: %s", user.ID, strings.ToUpper(linkingCode))
-
-	c.Header("Content-Type", "text/html")
-	c.String(http.StatusOK, renderLinkingCodePage(strings.ToUpper(linkingCode), user.Name))
+	writeLinkingCodePage(c, &user, nil)
 }
 
 func AuthCallbackGoogle(c *gin.Context) {
@@ -106,13 +94,14 @@ func AuthCallbackGoogle(c *gin.Context) {
 
 	googleUser, err := auth.GetGoogleUser(code)
 	if err != nil {
-		c.HTML(http.StatusInternalServerError, "", renderErrorPage("Authentication failed: "+err.Error()))
+		writeAuthErrorPage(c, "Authentication failed: "+err.Error())
 		return
 	}
 
 	var user models.User
-	// First try to find by Google ID
-	err = database.DB.Where("google_id = ?", googleUser.ID).First(&user).Error
+	// First try to find by Google ID. Unscoped, so signing in restores an
+	// account during its deletion grace period.
+	err = requestDB(c).Unscoped().Where("google_id = ?", googleUser.ID).First(&user).Error
 	if err != nil {
 		if !errors.Is(err, gorm.ErrRecordNotFound) {
 			RespondInternalError(c, "Failed to check for user existence")
@@ -120,7 +109,7 @@ func AuthCallbackGoogle(c *gin.Context) {
 		}
 
 		// Not found by Google ID — try by email (account linking)
-		err = database.DB.Where("email = ?", googleUser.Email).First(&user).Error
+		err = requestDB(c).Unscoped().Where("email = ?", googleUser.Email).First(&user).Error
 		if err != nil {
 			if !errors.Is(err, gorm.ErrRecordNotFound) {
 				RespondInternalError(c, "Failed to check for user existence")
@@ -136,59 +125,58 @@ func AuthCallbackGoogle(c *gin.Context) {
 				PublicKey: nil,
 			}
 
-			if err := database.DB.Create(&user).Error; err != nil {
-				c.HTML(http.StatusInternalServerError, "", renderErrorPage("Failed to create user: "+err.Error()))
+			if err := requestDB(c).Create(&user).Error; err != nil {
+				writeAuthErrorPage(c, "Failed to create user: "+err.Error())
 				return
 			}
 		} else {
 			// Existing user found by email — link Google ID
+			if err := restoreDeletedAccount(requestDB(c), &user); err != nil {
+				writeAuthErrorPage(c, "Failed to restore account: "+err.Error())
+				return
+			}
 			user.GoogleID = googleUser.ID
-			database.DB.Save(&user)
+			requestDB(c).Save(&user)
 		}
 	} else {
 		// Found by Google ID — update profile
+		if err := restoreDeletedAccount(requestDB(c), &user); err != nil {
+			writeAuthErrorPage(c, "Failed to restore account: "+err.Error())
+			return
+		}
 		user.Name = googleUser.Name
 		user.Email = googleUser.Email
 		user.AvatarURL = googleUser.AvatarURL
-		database.DB.Save(&user)
-	}
-
-	// Clean old linking codes
-	database.DB.Where("user_id = ? AND (used_at IS NOT NULL OR expires_at < ?)", user.ID, time.Now()).
-		Delete(&models.LinkingCode{})
-
-	linkingCode, err := auth.GenerateLinkingCode()
-	if err != nil {
-		c.HTML(http.StatusInternalServerError, "", renderErrorPage("Failed to generate linking code"))
-		return
-	}
-
-	linkingCodeRecord := models.LinkingCode{
-		Code:      strings.ToUpper(linkingCode),
-		UserID:    user.ID,
-		ExpiresAt: time.Now().Add(auth.LinkingCodeDuration),
+		requestDB(c).Save(&user)
 	}
 
-	if err := database.DB.Create(&linkingCodeRecord).Error; err != nil {
-		c.HTML(http.StatusInternalServerError, "", renderErrorPage("Failed to save linking code: "+err.Error()))
+	if !ssoSignInAllowed(c, user.ID, nil) {
 		return
 	}
 
-	log.Printf("Created linking code for user %s: %s", user.ID, strings.ToUpper(linkingCode))
-
-	c.Header("Content-Type", "text/html")
-	c.String(http.StatusOK, renderLinkingCodePage(strings.ToUpper(linkingCode), user.Name))
+	writeLinkingCodePage(c, &user, nil)
 }
 
 type ExchangeRequest struct {
 	Code            string `json:"code" binding:"required"`
 	DevicePublicKey string `json:"devicePublicKey"`
+
+	// Proof of the device key, required with it: the token of a challenge from
+	// POST /auth/device-challenge and the decrypted nonce, base64
+	ChallengeToken    string `json:"challengeToken"`
+	ChallengeResponse string `json:"challengeResponse"`
+}
+
+type DeviceChallengeRequest struct {
+	DevicePublicKey string `json:"devicePublicKey" binding:"required"`
 }
 
 type ExchangeResponse struct {
-	AccessToken  string `json:"accessToken"`
-	RefreshToken string `json:"refreshToken"`
-	ExpiresIn    int    `json:"expiresIn"`
+	AccessToken  string     `json:"accessToken"`
+	RefreshToken string     `json:"refreshToken"`
+	ExpiresIn    int        `json:"expiresIn"`
+	SessionID    uuid.UUID  `json:"sessionId"` // see GET /me/sessions
+	DeviceID     *uuid.UUID `json:"deviceId"`  // the registered device the session is bound to
 	User         struct {
 		ID               uuid.UUID `json:"id"`
 		Name             string    `json:"name"`
@@ -203,57 +191,96 @@ type ExchangeResponse struct {
 
 func AuthExchange(c *gin.Context) {
 	var req ExchangeRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		RespondBadRequest(c, "Invalid request: "+err.Error())
+	if !BindJSON(c, &req) {
 		return
 	}
 
-	code := strings.ToUpper(strings.TrimSpace(req.Code))
-
-	var linkingCode models.LinkingCode
-	if err := database.DB.Where("code = ?", code).First(&linkingCode).Error; err != nil {
-		RespondUnauthorized(c, "Invalid or expired linking code")
-		return
+	// Checked before claiming, so a failed proof doesn't use the code up
+	if req.DevicePublicKey != "" {
+		if err := auth.VerifyDeviceChallenge(req.ChallengeToken, req.DevicePublicKey, req.ChallengeResponse, time.Now()); err != nil {
+			log.Printf("Device challenge failed from %s: %v", middleware.ClientIP(c), err)
+			c.JSON(http.StatusUnauthorized, apierror.H(apierror.CodeDeviceChallengeRequired,
+				"The device key is not proven: answer a challenge from POST /auth/device-challenge",
+				gin.H{"deviceChallengeRequired": true}))
+			return
+		}
 	}
 
-	if !linkingCode.IsValid() {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Linking code has expired or already been used"})
+	linkingCode, ok := claimLinkingCode(c, req.Code)
+	if !ok {
 		return
 	}
 
-	now := time.Now()
-	linkingCode.UsedAt = &now
-	database.DB.Save(&linkingCode)
+	completeSignIn(c, linkingCode.UserID, linkingCode.SSOOrganizationID, req.DevicePublicKey)
+}
 
+// completeSignIn starts a session for userID once a linking code is exchanged or
+// a pairing approved, and responds with its tokens. ssoOrgID is the organization
+// whose provider the user signed in at, devicePublicKey a proven device key.
+func completeSignIn(c *gin.Context, userID uuid.UUID, ssoOrgID *uuid.UUID, devicePublicKey string) {
 	var user models.User
-	if err := database.DB.First(&user, "id = ?", linkingCode.UserID).Error; err != nil {
+	if err := requestDB(c).First(&user, "id = ?", userID).Error; err != nil {
 		RespondInternalError(c, "User not found")
 		return
 	}
+	if user.DisabledAt != nil {
+		RespondCode(c, http.StatusForbidden, apierror.CodeAccountDisabled, "Account has been disabled")
+		return
+	}
 
-	// Update device LastActive if device public key provided
-	if req.DevicePublicKey != "" {
-		database.DB.Model(&models.UserIdentity{}).
-			Where("user_id = ? AND public_key = ?", user.ID, req.DevicePublicKey).
-			Update("last_active", time.Now())
+	// SSO may have become required since the sign-in started
+	required, err := missingSSO(requestDB(c), user.ID, ssoOrgID)
+	if err != nil {
+		RespondInternalError(c, "Failed to check single sign-on requirements")
+		return
+	}
+	if required != nil {
+		RespondCode(c, http.StatusForbidden, apierror.CodeSSORequired, ssoRequiredMessage(required))
+		return
 	}
 
-	accessToken, err := auth.GenerateAccessToken(user.ID)
+	// Update LastActive of the device whose key was proven, and bind the refresh
+	// token family to it
+	var deviceID *uuid.UUID
+	if devicePublicKey != "" {
+		var device models.UserIdentity
+		if err := requestDB(c).Where("user_id = ? AND public_key = ?", user.ID, devicePublicKey).First(&device).Error; err == nil {
+			requestDB(c).Model(&device).Update("last_active", time.Now())
+			deviceID = &device.ID
+		}
+	}
+
+	lifetimes, err := tokenLifetimes(requestDB(c), user.ID)
+	if err != nil {
+		RespondInternalError(c, "Failed to read the session policy")
+		return
+	}
+
+	sessionID := uuid.New()
+	accessToken, err := auth.GenerateAccessToken(user.ID, sessionID, lifetimes.Access)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate access token"})
+		RespondError(c, http.StatusInternalServerError, "Failed to generate access token")
 		return
 	}
 
-	refreshToken, err := auth.GenerateRefreshToken(user.ID)
+	refreshToken, err := auth.IssueRefreshToken(auth.DBRefreshTokenStore, user.ID, sessionID, auth.Session{
+		DeviceID:          deviceID,
+		SSOOrganizationID: ssoOrgID,
+		ClientIP:          middleware.ClientIP(c),
+		UserAgent:         c.Request.UserAgent(),
+		Lifetime:          lifetimes.Refresh,
+	}, time.Now())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
+		RespondError(c, http.StatusInternalServerError, "Failed to generate refresh token")
 		return
 	}
 
 	response := ExchangeResponse{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
-		ExpiresIn:    int(auth.AccessTokenDuration.Seconds()),
+		ExpiresIn:    int(lifetimes.Access.Seconds()),
+		SessionID:    sessionID,
+		DeviceID:     deviceID,
 	}
 	response.User.ID = user.ID
 	response.User.Name = user.Name
@@ -267,58 +294,179 @@ func AuthExchange(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// AuthDeviceChallenge issues a challenge for a device to prove it holds the
+// private key of the public key it exchanges a linking code with
+func AuthDeviceChallenge(c *gin.Context) {
+	var req DeviceChallengeRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	challenge, err := auth.NewDeviceChallenge(req.DevicePublicKey, time.Now())
+	if errors.Is(err, auth.ErrInvalidDeviceKey) {
+		RespondBadRequest(c, err.Error())
+		return
+	}
+	if err != nil {
+		RespondInternalError(c, "Failed to create a device challenge")
+		return
+	}
+
+	RespondOK(c, challenge)
+}
+
 type RefreshRequest struct {
 	RefreshToken string `json:"refreshToken" binding:"required"`
 }
 
 func AuthRefresh(c *gin.Context) {
 	var req RefreshRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	if !BindJSON(c, &req) {
 		return
 	}
 
-	// Validate the refresh token JWT
-	claims, err := auth.ValidateRefreshToken(req.RefreshToken)
+	// Rotate the refresh token; a reused token revokes its whole family. The
+	// successor and the access token get the lifetimes of the user's current
+	// session policy.
+	var lifetimes auth.TokenLifetimes
+	policy := func(userID uuid.UUID) (auth.TokenLifetimes, error) {
+		var err error
+		lifetimes, err = tokenLifetimes(requestDB(c), userID)
+		return lifetimes, err
+	}
+	previous, newRefreshToken, err := auth.RotateRefreshToken(auth.DBRefreshTokenStore, req.RefreshToken, middleware.ClientIP(c), c.Request.UserAgent(), policy, time.Now())
+	if errors.Is(err, auth.ErrRefreshTokenReused) {
+		log.Printf("Refresh token reuse detected, revoked token family")
+		RespondCode(c, http.StatusUnauthorized, apierror.CodeRefreshTokenReused, "Refresh token has been revoked")
+		return
+	}
+	if errors.Is(err, auth.ErrInvalidRefreshToken) {
+		RespondCode(c, http.StatusUnauthorized, apierror.CodeTokenInvalid, "Invalid refresh token")
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		RespondError(c, http.StatusInternalServerError, "Failed to refresh token")
 		return
 	}
 
-	// Generate new tokens
-	accessToken, err := auth.GenerateAccessToken(claims.UserID)
+	// A session from before its organization required SSO ends at its next refresh
+	required, err := missingSSO(requestDB(c), previous.UserID, previous.SSOOrganizationID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate access token"})
+		RespondError(c, http.StatusInternalServerError, "Failed to refresh token")
+		return
+	}
+	if required != nil {
+		if err := auth.DBRefreshTokenStore.RevokeFamily(previous.FamilyID, auth.RevokedSSO, time.Now()); err != nil {
+			RespondError(c, http.StatusInternalServerError, "Failed to refresh token")
+			return
+		}
+		RespondCode(c, http.StatusUnauthorized, apierror.CodeSSORequired, ssoRequiredMessage(required))
 		return
 	}
 
-	newRefreshToken, err := auth.GenerateRefreshToken(claims.UserID)
+	accessToken, err := auth.GenerateAccessToken(previous.UserID, previous.FamilyID, lifetimes.Access)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
+		RespondError(c, http.StatusInternalServerError, "Failed to generate access token")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"accessToken":  accessToken,
 		"refreshToken": newRefreshToken,
-		"expiresIn":    int(auth.AccessTokenDuration.Seconds()),
+		"expiresIn":    int(lifetimes.Access.Seconds()),
 	})
 }
 
+// LogoutRequest is optional; without a refresh token only the client discards its tokens
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
 func AuthLogout(c *gin.Context) {
-	// With stateless JWT refresh tokens, we can't revoke server-side.
-	// The client should discard the tokens locally.
+	userID, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	var req LogoutRequest
+	_ = c.ShouldBindJSON(&req)
+
+	if req.RefreshToken != "" {
+		if err := auth.RevokeRefreshTokenFamily(auth.DBRefreshTokenStore, req.RefreshToken, userID, time.Now()); err != nil {
+			RespondInternalError(c, "Failed to revoke refresh token")
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
-func renderLinkingCodePage(code string, userName string) string {
+// writeLinkingCodePage issues a linking code for user and renders it. ssoOrgID is
+// the organization whose provider the user signed in at, nil for GitHub and Google.
+func writeLinkingCodePage(c *gin.Context, user *models.User, ssoOrgID *uuid.UUID) {
+	// Clean old linking codes
+	requestDB(c).Where("user_id = ? AND (used_at IS NOT NULL OR expires_at < ?)", user.ID, time.Now()).
+		Delete(&models.LinkingCode{})
+
+	// The selector has to identify a single live code, or a wrong attempt at one
+	// code would lock the others
+	var linkingCode string
+	for attempt := 0; linkingCode == "" && attempt < 5; attempt++ {
+		candidate, err := auth.GenerateLinkingCode()
+		if err != nil {
+			writeAuthErrorPage(c, "Failed to generate linking code")
+			return
+		}
+		var taken int64
+		if err := requestDB(c).Model(&models.LinkingCode{}).
+			Where("selector = ? AND used_at IS NULL AND locked_at IS NULL AND expires_at > ?", auth.LinkingCodeSelector(auth.NormalizeLinkingCode(candidate)), time.Now()).
+			Count(&taken).Error; err != nil {
+			writeAuthErrorPage(c, "Failed to generate linking code")
+			return
+		}
+		if taken == 0 {
+			linkingCode = candidate
+		}
+	}
+	if linkingCode == "" {
+		writeAuthErrorPage(c, "Failed to generate linking code, try again")
+		return
+	}
+
+	normalized := auth.NormalizeLinkingCode(linkingCode)
+	linkingCodeRecord := models.LinkingCode{
+		Code:              auth.HashLinkingCode(normalized),
+		Selector:          auth.LinkingCodeSelector(normalized),
+		UserID:            user.ID,
+		ExpiresAt:         time.Now().Add(auth.LinkingCodeDuration),
+		SSOOrganizationID: ssoOrgID,
+	}
+
+	if err := requestDB(c).Create(&linkingCodeRecord).Error; err != nil {
+		writeAuthErrorPage(c, "Failed to save linking code: "+err.Error())
+		return
+	}
+
+	log.Printf("Created linking code for user %s", user.ID)
+
+	nonce := middleware.SetPageContentSecurityPolicy(c)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(renderLinkingCodePage(strings.ToUpper(linkingCode), user.Name, nonce)))
+}
+
+// writeAuthErrorPage renders the error page of the OAuth callbacks
+func writeAuthErrorPage(c *gin.Context, message string) {
+	nonce := middleware.SetPageContentSecurityPolicy(c)
+	c.Data(http.StatusInternalServerError, "text/html; charset=utf-8", []byte(renderErrorPage(message, nonce)))
+}
+
+func renderLinkingCodePage(code string, userName string, nonce string) string {
 	tmpl := `<!DOCTYPE html>
 <html lang="en">
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
     <title>Envie - Authentication Successful</title>
-    <style>
+    <style nonce="{{.Nonce}}">
         * {
             margin: 0;
             padding: 0;
@@ -458,16 +606,16 @@ func renderLinkingCodePage(code string, userName string) string {
 
         <div class="code-container">
             <div class="code-label">Your linking code</div>
-            <div class="code" id="code" onclick="copyCode()">{{.Code}}</div>
+            <div class="code" id="code">{{.Code}}</div>
             <div class="expires">Expires in 5 minutes</div>
         </div>
 
-        <button class="copy-btn" id="copyBtn" onclick="copyCode()">Copy Code</button>
+        <button class="copy-btn" id="copyBtn">Copy Code</button>
 
         <p class="note">You can close this page after copying the code.</p>
     </div>
 
-    <script>
+    <script nonce="{{.Nonce}}">
         function copyCode() {
             const code = document.getElementById('code').textContent;
             navigator.clipboard.writeText(code).then(() => {
@@ -480,6 +628,8 @@ func renderLinkingCodePage(code string, userName string) string {
                 }, 2000);
             });
         }
+        document.getElementById('code').addEventListener('click', copyCode);
+        document.getElementById('copyBtn').addEventListener('click', copyCode);
     </script>
 </body>
 </html>`
@@ -489,18 +639,19 @@ func renderLinkingCodePage(code string, userName string) string {
 	t.Execute(&result, struct {
 		Code     string
 		UserName string
-	}{Code: code, UserName: userName})
+		Nonce    string
+	}{Code: code, UserName: userName, Nonce: nonce})
 	return result.String()
 }
 
-func renderErrorPage(message string) string {
+func renderErrorPage(message string, nonce string) string {
 	return fmt.Sprintf(`<!DOCTYPE html>
 <html lang="en">
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
     <title>Envie - Error</title>
-    <style>
+    <style nonce="%s">
         * {
             margin: 0;
             padding: 0;
@@ -572,5 +723,5 @@ func renderErrorPage(message string) string {
         <p class="error">%s</p>
     </div>
 </body>
-</html>`, message)
+</html>`, nonce, html.EscapeString(message))
 }
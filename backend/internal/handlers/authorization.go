@@ -2,20 +2,28 @@ package handlers
 
 import (
 	"errors"
+	"net/http"
 
+	"envie-backend/internal/apierror"
+	"envie-backend/internal/authcache"
 	"envie-backend/internal/database"
 	"envie-backend/internal/models"
 
+	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// projectAccessKey is where AuthorizeProject stores the caller's access
+const projectAccessKey = "project_access"
+
 type ProjectAccess struct {
 	Project             *models.Project
 	Team                *models.Team
 	TeamProject         *models.TeamProject
 	TeamRole            string
 	OrgRole             string
+	Permissions         PermissionSet
 	CanEdit             bool
 	CanDelete           bool
 	CanManageSecrets    bool
@@ -23,94 +31,266 @@ type ProjectAccess struct {
 	EncryptedTeamKey    string
 }
 
+// Can reports whether the user has permission in the project
+func (a *ProjectAccess) Can(permission string) bool {
+	return a.Permissions.Has(permission)
+}
+
+// MasksSensitive reports whether the values of sensitive items are withheld from
+// the user, because the project restricts them and the user lacks secrets.reveal
+func (a *ProjectAccess) MasksSensitive() bool {
+	return a.Project.RestrictSensitive && !a.Can(models.PermissionSecretsReveal)
+}
+
+// PermissionSet is the set of permissions a user has in an organization, team
+// or project
+type PermissionSet map[string]bool
+
+func NewPermissionSet(lists ...[]string) PermissionSet {
+	set := PermissionSet{}
+	for _, list := range lists {
+		for _, permission := range list {
+			set[permission] = true
+		}
+	}
+	return set
+}
+
+func (s PermissionSet) Has(permission string) bool {
+	return s[permission]
+}
+
+// Covers reports whether the set has every one of permissions, so that its
+// holder can grant them without escalating their own access
+func (s PermissionSet) Covers(permissions []string) bool {
+	for _, permission := range permissions {
+		if !s[permission] {
+			return false
+		}
+	}
+	return true
+}
+
+// List returns the permissions in the order of models.AllPermissions
+func (s PermissionSet) List() []string {
+	list := []string{}
+	for _, permission := range models.AllPermissions {
+		if s[permission] {
+			list = append(list, permission)
+		}
+	}
+	return list
+}
+
+// membershipPermissions are the permissions of an organization or team
+// membership: those of its custom role if it has one, otherwise those of its
+// built-in role. Owners always have every permission.
+func membershipPermissions(role string, custom *models.Role) []string {
+	if IsOwner(role) {
+		return models.AllPermissions
+	}
+	if custom != nil {
+		return custom.Permissions
+	}
+	return models.BuiltinRolePermissions[role]
+}
+
+// loadCustomRole loads the custom role of a membership, nil if it has none
+func loadCustomRole(roleID *uuid.UUID) (*models.Role, error) {
+	if roleID == nil {
+		return nil, nil
+	}
+	var role models.Role
+	if err := database.DB.First(&role, "id = ?", *roleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+// projectMembership is the part of ProjectAccess that comes from organization and
+// team membership, cached per user and project
+type projectMembership struct {
+	OrgRole          string
+	OrgPermissions   []string
+	HasTeamProject   bool
+	TeamProject      models.TeamProject
+	HasTeam          bool
+	Team             models.Team
+	TeamRole         string
+	TeamPermissions  []string
+	EncryptedTeamKey string
+}
+
 func GetUserProjectAccess(userID uuid.UUID, projectID uuid.UUID) (*ProjectAccess, error) {
 	var project models.Project
 	if err := database.DB.Where("id = ?", projectID).First(&project).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("project not found")
+			return nil, apierror.ErrProjectNotFound
 		}
 		return nil, err
 	}
 
+	membership, err := authcache.Lookup("project_access:"+userID.String()+":"+projectID.String(), func() (projectMembership, error) {
+		return loadProjectMembership(userID, &project)
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	access := &ProjectAccess{
-		Project: &project,
+		Project:          &project,
+		OrgRole:          membership.OrgRole,
+		TeamRole:         membership.TeamRole,
+		EncryptedTeamKey: membership.EncryptedTeamKey,
+	}
+	if membership.HasTeamProject {
+		access.TeamProject = &membership.TeamProject
+		access.EncryptedProjectKey = membership.TeamProject.EncryptedProjectKey
+	}
+	if membership.HasTeam {
+		access.Team = &membership.Team
 	}
 
-	orgRole, err := GetUserOrgRole(userID, project.OrganizationID)
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, err
+	// Outside their teams, only organization owners and admins can open a
+	// project, with the organization key. Custom roles don't change who holds it.
+	if access.TeamProject == nil && !IsAdminOrOwner(access.OrgRole) {
+		return nil, apierror.ErrProjectAccessDenied
 	}
-	access.OrgRole = orgRole
+
+	access.Permissions = NewPermissionSet(membership.OrgPermissions, membership.TeamPermissions)
+
+	access.CanEdit = access.Can(models.PermissionConfigWrite)
+
+	access.CanDelete = access.Can(models.PermissionProjectDelete)
+
+	access.CanManageSecrets = access.CanEdit
+
+	return access, nil
+}
+
+func loadProjectMembership(userID uuid.UUID, project *models.Project) (projectMembership, error) {
+	var membership projectMembership
+
+	orgUser, err := loadOrgUser(userID, project.OrganizationID)
+	if err != nil {
+		return membership, err
+	}
+	if orgUser != nil {
+		membership.OrgRole = normalizeOrgRole(orgUser.Role)
+		if membership.OrgPermissions, err = loadOrgUserPermissions(orgUser); err != nil {
+			return membership, err
+		}
+	}
+	orgRole := membership.OrgRole
 
 	var teamProject models.TeamProject
 	var teamUser models.TeamUser
 
 	err = database.DB.
 		Joins("JOIN team_users ON team_users.team_id = team_projects.team_id").
-		Where("team_projects.project_id = ? AND team_users.user_id = ?", projectID, userID).
+		Where("team_projects.project_id = ? AND team_users.user_id = ?", project.ID, userID).
 		First(&teamProject).Error
 
 	if err == nil {
-		access.TeamProject = &teamProject
-		access.EncryptedProjectKey = teamProject.EncryptedProjectKey
+		membership.HasTeamProject = true
+		membership.TeamProject = teamProject
 
 		var team models.Team
 		if err := database.DB.Where("id = ?", teamProject.TeamID).First(&team).Error; err == nil {
-			access.Team = &team
+			membership.HasTeam = true
+			membership.Team = team
 		}
 
 		if err := database.DB.Where("team_id = ? AND user_id = ?", teamProject.TeamID, userID).First(&teamUser).Error; err == nil {
-			access.TeamRole = teamUser.Role
-			access.EncryptedTeamKey = teamUser.EncryptedTeamKey
+			membership.TeamRole = teamUser.Role
+			membership.EncryptedTeamKey = teamUser.EncryptedTeamKey
+
+			custom, err := loadCustomRole(teamUser.RoleID)
+			if err != nil {
+				return membership, err
+			}
+			membership.TeamPermissions = membershipPermissions(teamUser.Role, custom)
 		}
 	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, err
+		return membership, err
 	}
 
-	if access.TeamProject == nil && (orgRole == "owner" || orgRole == "admin") {
-		if err := database.DB.Where("project_id = ?", projectID).First(&teamProject).Error; err == nil {
-			access.TeamProject = &teamProject
-			access.EncryptedProjectKey = teamProject.EncryptedProjectKey
+	if !membership.HasTeamProject && IsAdminOrOwner(orgRole) {
+		if err := database.DB.Where("project_id = ?", project.ID).First(&teamProject).Error; err == nil {
+			membership.HasTeamProject = true
+			membership.TeamProject = teamProject
 
 			var team models.Team
 			if err := database.DB.Where("id = ?", teamProject.TeamID).First(&team).Error; err == nil {
-				access.Team = &team
+				membership.HasTeam = true
+				membership.Team = team
 			}
 		}
 	}
 
-	if access.TeamProject == nil && access.OrgRole == "" {
-		return nil, errors.New("access denied")
-	}
-	if access.TeamProject == nil && access.OrgRole == "member" {
-		return nil, errors.New("access denied")
-	}
-
-	access.CanEdit = access.TeamRole == "owner" || access.TeamRole == "admin" ||
-		access.OrgRole == "owner" || access.OrgRole == "admin"
-
-	access.CanDelete = access.TeamRole == "owner" || access.OrgRole == "owner"
+	return membership, nil
+}
 
-	access.CanManageSecrets = access.CanEdit
+func GetUserOrgRole(userID uuid.UUID, orgID uuid.UUID) (string, error) {
+	return authcache.Lookup("org_role:"+userID.String()+":"+orgID.String(), func() (string, error) {
+		return loadUserOrgRole(userID, orgID)
+	})
+}
 
-	return access, nil
+func loadUserOrgRole(userID uuid.UUID, orgID uuid.UUID) (string, error) {
+	orgUser, err := loadOrgUser(userID, orgID)
+	if err != nil || orgUser == nil {
+		return "", err
+	}
+	return normalizeOrgRole(orgUser.Role), nil
 }
 
-func GetUserOrgRole(userID uuid.UUID, orgID uuid.UUID) (string, error) {
+// loadOrgUser loads the user's organization membership, nil if they aren't a
+// member
+func loadOrgUser(userID uuid.UUID, orgID uuid.UUID) (*models.OrganizationUser, error) {
 	var orgUser models.OrganizationUser
 	err := database.DB.Where("user_id = ? AND organization_id = ?", userID, orgID).First(&orgUser).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return "", nil
+			return nil, nil
 		}
-		return "", err
+		return nil, err
 	}
+	return &orgUser, nil
+}
 
-	role := orgUser.Role
+func normalizeOrgRole(role string) string {
 	if role == "Owner" {
-		role = "owner"
+		return "owner"
+	}
+	return role
+}
+
+func loadOrgUserPermissions(orgUser *models.OrganizationUser) ([]string, error) {
+	custom, err := loadCustomRole(orgUser.RoleID)
+	if err != nil {
+		return nil, err
 	}
-	return role, nil
+	return membershipPermissions(orgUser.Role, custom), nil
+}
+
+// GetUserOrgPermissions returns the permissions the user has across an
+// organization, none if they aren't a member
+func GetUserOrgPermissions(userID uuid.UUID, orgID uuid.UUID) (PermissionSet, error) {
+	permissions, err := authcache.Lookup("org_permissions:"+userID.String()+":"+orgID.String(), func() ([]string, error) {
+		orgUser, err := loadOrgUser(userID, orgID)
+		if err != nil || orgUser == nil {
+			return nil, err
+		}
+		return loadOrgUserPermissions(orgUser)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewPermissionSet(permissions), nil
 }
 
 func GetUserTeamRole(userID uuid.UUID, teamID uuid.UUID) (string, error) {
@@ -125,6 +305,33 @@ func GetUserTeamRole(userID uuid.UUID, teamID uuid.UUID) (string, error) {
 	return teamUser.Role, nil
 }
 
+// GetUserTeamPermissions returns the permissions the user has in a team, through
+// their team membership or organization-wide
+func GetUserTeamPermissions(userID uuid.UUID, teamID uuid.UUID, orgID uuid.UUID) (PermissionSet, error) {
+	permissions, err := GetUserOrgPermissions(userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	var teamUser models.TeamUser
+	err = database.DB.Where("user_id = ? AND team_id = ?", userID, teamID).First(&teamUser).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return permissions, nil
+		}
+		return nil, err
+	}
+
+	custom, err := loadCustomRole(teamUser.RoleID)
+	if err != nil {
+		return nil, err
+	}
+	for _, permission := range membershipPermissions(teamUser.Role, custom) {
+		permissions[permission] = true
+	}
+	return permissions, nil
+}
+
 func IsUserOrgOwnerOrAdmin(userID uuid.UUID, orgID uuid.UUID) (bool, string, error) {
 	role, err := GetUserOrgRole(userID, orgID)
 	if err != nil {
@@ -135,46 +342,70 @@ func IsUserOrgOwnerOrAdmin(userID uuid.UUID, orgID uuid.UUID) (bool, string, err
 }
 
 func CanUserCreateProjectInTeam(userID uuid.UUID, teamID uuid.UUID, orgID uuid.UUID) (bool, error) {
-	isOrgOwnerOrAdmin, _, err := IsUserOrgOwnerOrAdmin(userID, orgID)
+	permissions, err := GetUserTeamPermissions(userID, teamID, orgID)
 	if err != nil {
 		return false, err
 	}
-	if isOrgOwnerOrAdmin {
-		return true, nil
-	}
-
-	teamRole, err := GetUserTeamRole(userID, teamID)
-	if err != nil {
-		return false, err
-	}
-
-	return teamRole == "owner" || teamRole == "admin", nil
+	return permissions.Has(models.PermissionProjectCreate), nil
 }
 
-func CheckProjectAccessSimple(userID uuid.UUID, projectIDStr string) error {
-	projectID, err := uuid.Parse(projectIDStr)
-	if err != nil {
-		return errors.New("invalid project ID")
-	}
+// AuthorizeProject resolves the caller's access to the project in the :id param
+// once per request and answers 403 unless it grants every one of permissions;
+// with none, anyone who can open the project passes. Handlers behind it read the
+// access with CurrentProjectAccess. A project the caller can't open is
+// reported the same whether it exists or not.
+func AuthorizeProject(permissions ...string) gin.HandlerFunc {
+	return authorizeProject(func(c *gin.Context) { respondNoProjectAccess(c) }, permissions)
+}
 
-	_, err = GetUserProjectAccess(userID, projectID)
-	return err
+// AuthorizeProjectResource is AuthorizeProject for the resource API, which
+// answers 404 for missing projects so declarative clients can detect drift
+func AuthorizeProjectResource(permissions ...string) gin.HandlerFunc {
+	return authorizeProject(func(c *gin.Context) { apierror.Respond(c, apierror.ErrProjectNotFound) }, permissions)
 }
 
-func CheckProjectWriteAccess(userID uuid.UUID, projectIDStr string) (*ProjectAccess, error) {
-	projectID, err := uuid.Parse(projectIDStr)
-	if err != nil {
-		return nil, errors.New("invalid project ID")
-	}
+func authorizeProject(respondNotFound func(c *gin.Context), permissions []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid, ok := GetAuthUserID(c)
+		if !ok {
+			c.Abort()
+			return
+		}
+		projectID, ok := ParseUUIDParam(c, "id", "project")
+		if !ok {
+			c.Abort()
+			return
+		}
 
-	access, err := GetUserProjectAccess(userID, projectID)
-	if err != nil {
-		return nil, err
-	}
+		access, err := GetUserProjectAccess(uid, projectID)
+		switch {
+		case errors.Is(err, apierror.ErrProjectNotFound):
+			respondNotFound(c)
+		case errors.Is(err, apierror.ErrProjectAccessDenied):
+			respondNoProjectAccess(c)
+		case err != nil:
+			RespondInternalError(c, "Failed to check access")
+		}
+		if err != nil {
+			c.Abort()
+			return
+		}
 
-	if !access.CanEdit {
-		return nil, errors.New("insufficient permissions to edit project")
+		for _, permission := range permissions {
+			if !access.Can(permission) {
+				RespondCode(c, http.StatusForbidden, apierror.CodePermissionDenied, "Your role doesn't grant "+permission+" in this project")
+				c.Abort()
+				return
+			}
+		}
+
+		c.Set(projectAccessKey, access)
+		c.Next()
 	}
+}
 
-	return access, nil
+// CurrentProjectAccess returns the access AuthorizeProject resolved for the
+// request. It panics on routes registered without it, which is a wiring bug.
+func CurrentProjectAccess(c *gin.Context) *ProjectAccess {
+	return c.MustGet(projectAccessKey).(*ProjectAccess)
 }
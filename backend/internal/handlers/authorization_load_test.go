@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// accessIndexes back the lookups of GetUserProjectAccess
+var accessIndexes = []struct {
+	model any
+	name  string
+}{
+	{&models.TeamUser{}, "idx_team_user_user_team"},
+	{&models.TeamProject{}, "idx_team_project_project_team"},
+	{&models.OrganizationUser{}, "idx_organization_user_user_role"},
+}
+
+// seedAccessLoad fills an organization with teams of users and projects, and
+// returns a member and a project of one of its teams
+func seedAccessLoad(b *testing.B, db *gorm.DB, teams, perTeam int) (uuid.UUID, uuid.UUID) {
+	b.Helper()
+	org := models.Organization{Name: "Load"}
+	if err := db.Create(&org).Error; err != nil {
+		b.Fatal(err)
+	}
+
+	var member, project uuid.UUID
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for t := 0; t < teams; t++ {
+			team := models.Team{ID: uuid.New(), OrganizationID: org.ID, Name: fmt.Sprintf("Team %d", t)}
+			users := make([]models.User, perTeam)
+			projects := make([]models.Project, perTeam)
+			orgUsers := make([]models.OrganizationUser, perTeam)
+			teamUsers := make([]models.TeamUser, perTeam)
+			teamProjects := make([]models.TeamProject, perTeam)
+			for i := range users {
+				n := t*perTeam + i + 1
+				users[i] = models.User{ID: uuid.New(), Name: "User", Email: fmt.Sprintf("user-%d@example.com", n), GithubID: int64(n), GoogleID: fmt.Sprint(n)}
+				projects[i] = models.Project{ID: uuid.New(), OrganizationID: org.ID, Name: "Project", Slug: fmt.Sprintf("project-%d-%d", t, i)}
+				orgUsers[i] = models.OrganizationUser{OrganizationID: org.ID, UserID: users[i].ID, Role: "member"}
+				teamUsers[i] = models.TeamUser{TeamID: team.ID, UserID: users[i].ID, EncryptedTeamKey: "a2V5", Role: "member"}
+				teamProjects[i] = models.TeamProject{TeamID: team.ID, ProjectID: projects[i].ID, EncryptedProjectKey: "a2V5"}
+			}
+			for _, rows := range []any{&team, &users, &projects, &orgUsers, &teamUsers, &teamProjects} {
+				if err := tx.Create(rows).Error; err != nil {
+					return err
+				}
+			}
+			if t == teams/2 {
+				member, project = users[0].ID, projects[perTeam-1].ID
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return member, project
+}
+
+// BenchmarkGetUserProjectAccess loads the access of a team member in an
+// organization of 10,000 users and projects, with and without the indexes
+// that lead with the user and the project:
+//
+//	go test ./internal/handlers -run '^$' -bench GetUserProjectAccess
+func BenchmarkGetUserProjectAccess(b *testing.B) {
+	b.Setenv("DB_DRIVER", database.DriverSQLite)
+	b.Setenv("DB_DSN", b.TempDir()+"/envie.db")
+	previous := database.DB
+	database.Connect()
+	b.Cleanup(func() { database.DB = previous })
+
+	db := database.DB.Session(&gorm.Session{Logger: logger.Discard})
+	member, project := seedAccessLoad(b, db, 1000, 10)
+
+	run := func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			access, err := GetUserProjectAccess(member, project)
+			if err != nil || access.TeamProject == nil {
+				b.Fatalf("access = %v, %v", access, err)
+			}
+		}
+	}
+
+	b.Run("without indexes", func(b *testing.B) {
+		for _, index := range accessIndexes {
+			if db.Migrator().HasIndex(index.model, index.name) {
+				if err := db.Migrator().DropIndex(index.model, index.name); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		db.Exec("ANALYZE")
+		run(b)
+	})
+	b.Run("with indexes", func(b *testing.B) {
+		for _, index := range accessIndexes {
+			if !db.Migrator().HasIndex(index.model, index.name) {
+				if err := db.Migrator().CreateIndex(index.model, index.name); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		db.Exec("ANALYZE")
+		run(b)
+	})
+}
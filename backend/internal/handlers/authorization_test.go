@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"envie-backend/internal/apierror"
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestMembershipPermissions(t *testing.T) {
+	auditor := &models.Role{Name: "auditor", Permissions: []string{models.PermissionRotationApprove}}
+
+	tests := []struct {
+		role   string
+		custom *models.Role
+		want   []string
+	}{
+		{"Owner", nil, models.AllPermissions},
+		{"owner", auditor, models.AllPermissions},
+		{"admin", nil, models.BuiltinRolePermissions["admin"]},
+		{"admin", auditor, auditor.Permissions},
+		{"member", nil, []string{}},
+		{"member", auditor, auditor.Permissions},
+	}
+	for _, tt := range tests {
+		if got := NewPermissionSet(membershipPermissions(tt.role, tt.custom)).List(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("membershipPermissions(%q, %v) = %v, want %v", tt.role, tt.custom != nil, got, tt.want)
+		}
+	}
+}
+
+func TestPermissionSet(t *testing.T) {
+	set := NewPermissionSet([]string{models.PermissionConfigWrite}, []string{models.PermissionTokenManage, models.PermissionConfigWrite})
+
+	if got, want := set.List(), []string{models.PermissionConfigWrite, models.PermissionTokenManage}; !reflect.DeepEqual(got, want) {
+		t.Errorf("List() = %v, want %v", got, want)
+	}
+	if !set.Covers([]string{models.PermissionTokenManage}) || set.Covers([]string{models.PermissionTokenManage, models.PermissionMembersManage}) {
+		t.Error("Covers doesn't match the permissions of the set")
+	}
+	if !set.Covers(nil) {
+		t.Error("every set covers no permissions")
+	}
+
+	if _, err := validatePermissions([]string{models.PermissionFilesWrite, "config.read"}); err == nil {
+		t.Error("unknown permission accepted")
+	}
+}
+
+// accessFixture is an organization on a SQLite database with a project of the
+// member's team, a sandbox project where a custom role gives them files.write,
+// an organization admin outside both teams and a user outside the organization
+type accessFixture struct {
+	project, sandbox        models.Project
+	backend, ops            models.Team // the teams of project and sandbox
+	member, admin, outsider models.User
+}
+
+func newAccessFixture(t *testing.T) accessFixture {
+	t.Helper()
+	t.Setenv("DB_DRIVER", database.DriverSQLite)
+	t.Setenv("DB_DSN", t.TempDir()+"/envie.db")
+	previous := database.DB
+	database.Connect()
+	t.Cleanup(func() { database.DB = previous })
+
+	org := models.Organization{Name: "Acme"}
+	f := accessFixture{
+		project:  models.Project{ID: uuid.New(), Name: "API", Slug: "api"},
+		sandbox:  models.Project{ID: uuid.New(), Name: "Sandbox", Slug: "sandbox", Sandbox: true, RestrictSensitive: true},
+		member:   models.User{ID: uuid.New(), Name: "Member", Email: "member@example.com", GithubID: 1, GoogleID: "1"},
+		admin:    models.User{ID: uuid.New(), Name: "Admin", Email: "admin@example.com", GithubID: 2, GoogleID: "2"},
+		outsider: models.User{ID: uuid.New(), Name: "Outsider", Email: "outsider@example.com", GithubID: 3, GoogleID: "3"},
+	}
+	seed := func(rows ...any) {
+		for _, row := range rows {
+			if err := database.DB.Create(row).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	seed(&org, &f.member, &f.admin, &f.outsider)
+	f.backend = models.Team{ID: uuid.New(), OrganizationID: org.ID, Name: "Backend"}
+	f.ops = models.Team{ID: uuid.New(), OrganizationID: org.ID, Name: "Ops"}
+	backend, ops := &f.backend, &f.ops
+	uploader := models.Role{OrganizationID: org.ID, Name: "Uploader", Scope: models.RoleScopeTeam, Permissions: []string{models.PermissionFilesWrite}}
+	f.project.OrganizationID, f.sandbox.OrganizationID = org.ID, org.ID
+	seed(backend, ops, &uploader, &f.project, &f.sandbox)
+	seed(&models.OrganizationUser{OrganizationID: org.ID, UserID: f.member.ID, Role: "member"},
+		&models.OrganizationUser{OrganizationID: org.ID, UserID: f.admin.ID, Role: "admin"},
+		&models.TeamUser{TeamID: backend.ID, UserID: f.member.ID, EncryptedTeamKey: "a2V5", Role: "member"},
+		&models.TeamUser{TeamID: ops.ID, UserID: f.member.ID, EncryptedTeamKey: "a2V5", Role: "member", RoleID: &uploader.ID},
+		&models.TeamProject{TeamID: backend.ID, ProjectID: f.project.ID, EncryptedProjectKey: "a2V5"},
+		&models.TeamProject{TeamID: ops.ID, ProjectID: f.sandbox.ID, EncryptedProjectKey: "a2V5"})
+	return f
+}
+
+func TestAuthorizeProject(t *testing.T) {
+	f := newAccessFixture(t)
+	project, member, admin, outsider := f.project, f.member, f.admin, f.outsider
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", uuid.MustParse(c.GetHeader("X-User"))) })
+	respond := func(c *gin.Context) { c.String(http.StatusOK, CurrentProjectAccess(c).Project.Name) }
+	r.GET("/projects/:id", AuthorizeProject(), respond)
+	r.PUT("/projects/:id", AuthorizeProject(models.PermissionConfigWrite), respond)
+	r.GET("/resources/projects/:id", AuthorizeProjectResource(), respond)
+
+	missing := uuid.NewString()
+	tests := []struct {
+		method, path string
+		user         uuid.UUID
+		status       int
+		code         apierror.Code
+	}{
+		{"GET", "/projects/" + project.ID.String(), member.ID, http.StatusOK, ""},
+		{"GET", "/projects/" + project.ID.String(), admin.ID, http.StatusOK, ""},
+		{"GET", "/projects/" + project.ID.String(), outsider.ID, http.StatusForbidden, apierror.CodeProjectAccessDenied},
+		{"GET", "/projects/" + missing, member.ID, http.StatusForbidden, apierror.CodeProjectAccessDenied},
+		{"GET", "/projects/not-a-uuid", member.ID, http.StatusBadRequest, apierror.CodeBadRequest},
+		{"PUT", "/projects/" + project.ID.String(), member.ID, http.StatusForbidden, apierror.CodePermissionDenied},
+		{"PUT", "/projects/" + project.ID.String(), admin.ID, http.StatusOK, ""},
+		{"GET", "/resources/projects/" + missing, member.ID, http.StatusNotFound, apierror.CodeProjectNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("X-User", tt.user.String())
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s %s = %d, want %d: %s", tt.method, tt.path, w.Code, tt.status, w.Body)
+			continue
+		}
+		if tt.code == "" {
+			if w.Body.String() != project.Name {
+				t.Errorf("%s %s body = %q", tt.method, tt.path, w.Body)
+			}
+			continue
+		}
+		var body apierror.Body
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != tt.code {
+			t.Errorf("%s %s code = %q, want %q", tt.method, tt.path, body.Code, tt.code)
+		}
+	}
+}
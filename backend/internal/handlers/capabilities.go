@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ProjectCapabilities tell clients what the user may do in a project, from the
+// same permissions the project routes check (see AuthorizeProject), so they
+// don't have to infer it from role names
+type ProjectCapabilities struct {
+	CanManageTokens         bool `json:"canManageTokens"`         // token.manage
+	CanManageFiles          bool `json:"canManageFiles"`          // files.write
+	CanInitiateRotation     bool `json:"canInitiateRotation"`     // config.write, and secrets.reveal if the project restricts sensitive values
+	CanManageTeams          bool `json:"canManageTeams"`          // config.write
+	CanManageSecretManagers bool `json:"canManageSecretManagers"` // config.write, never in sandbox projects
+}
+
+func projectCapabilities(project *models.Project, permissions PermissionSet) ProjectCapabilities {
+	canWrite := permissions.Has(models.PermissionConfigWrite)
+	masksSensitive := project.RestrictSensitive && !permissions.Has(models.PermissionSecretsReveal)
+	return ProjectCapabilities{
+		CanManageTokens:         permissions.Has(models.PermissionTokenManage),
+		CanManageFiles:          permissions.Has(models.PermissionFilesWrite),
+		CanInitiateRotation:     canWrite && !masksSensitive,
+		CanManageTeams:          canWrite,
+		CanManageSecretManagers: canWrite && !project.Sandbox,
+	}
+}
+
+// Capabilities returns what the access allows in its project
+func (a *ProjectAccess) Capabilities() ProjectCapabilities {
+	return projectCapabilities(a.Project, a.Permissions)
+}
+
+// withProjectCapabilities fills in the capabilities of the user in the listed
+// projects, which are results in the same order. If unsuccessful, it sends an
+// error response automatically.
+func withProjectCapabilities(c *gin.Context, uid uuid.UUID, results []projectWithOrg, projects []ProjectListItem) ([]ProjectListItem, bool) {
+	permissions, err := loadProjectPermissions(requestDB(c), uid, results)
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch project permissions")
+		return nil, false
+	}
+	for i := range projects {
+		projects[i].Capabilities = projectCapabilities(&results[i].Project, permissions[results[i].ID])
+	}
+	return projects, true
+}
+
+// loadProjectPermissions returns the user's permissions in each of the projects
+// with a query per organization role and one for team roles, rather than
+// GetUserProjectAccess per project. Like it, the team role is that of the first
+// of the user's teams holding the project.
+func loadProjectPermissions(db *gorm.DB, uid uuid.UUID, projects []projectWithOrg) (map[uuid.UUID]PermissionSet, error) {
+	permissions := map[uuid.UUID]PermissionSet{}
+	if len(projects) == 0 {
+		return permissions, nil
+	}
+
+	orgPermissions := map[uuid.UUID]PermissionSet{}
+	ids := make([]uuid.UUID, len(projects))
+	for i, project := range projects {
+		ids[i] = project.ID
+		if _, ok := orgPermissions[project.OrganizationID]; ok {
+			continue
+		}
+		set, err := GetUserOrgPermissions(uid, project.OrganizationID)
+		if err != nil {
+			return nil, err
+		}
+		orgPermissions[project.OrganizationID] = set
+	}
+
+	var memberships []struct {
+		ProjectID uuid.UUID
+		Role      string
+		RoleID    *uuid.UUID
+	}
+	if err := db.Table("team_projects").
+		Select("team_projects.project_id, team_users.role, team_users.role_id").
+		Joins("JOIN team_users ON team_users.team_id = team_projects.team_id").
+		Where("team_users.user_id = ? AND team_projects.project_id IN ?", uid, ids).
+		Order("team_projects.team_id").
+		Scan(&memberships).Error; err != nil {
+		return nil, err
+	}
+
+	var roleIDs []uuid.UUID
+	for _, membership := range memberships {
+		if membership.RoleID != nil {
+			roleIDs = append(roleIDs, *membership.RoleID)
+		}
+	}
+	customRoles := map[uuid.UUID]*models.Role{}
+	if len(roleIDs) > 0 {
+		var roles []models.Role
+		if err := db.Where("id IN ?", roleIDs).Find(&roles).Error; err != nil {
+			return nil, err
+		}
+		for i := range roles {
+			customRoles[roles[i].ID] = &roles[i]
+		}
+	}
+
+	teamPermissions := map[uuid.UUID][]string{}
+	for _, membership := range memberships {
+		if _, ok := teamPermissions[membership.ProjectID]; ok {
+			continue
+		}
+		var custom *models.Role
+		if membership.RoleID != nil {
+			custom = customRoles[*membership.RoleID]
+		}
+		teamPermissions[membership.ProjectID] = membershipPermissions(membership.Role, custom)
+	}
+
+	for _, project := range projects {
+		permissions[project.ID] = NewPermissionSet(orgPermissions[project.OrganizationID].List(), teamPermissions[project.ID])
+	}
+	return permissions, nil
+}
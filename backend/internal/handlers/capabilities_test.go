@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+)
+
+func TestProjectCapabilities(t *testing.T) {
+	admin := NewPermissionSet(models.BuiltinRolePermissions["admin"])
+	writer := NewPermissionSet([]string{models.PermissionConfigWrite})
+	member := NewPermissionSet(nil)
+
+	tests := []struct {
+		name        string
+		project     models.Project
+		permissions PermissionSet
+		want        ProjectCapabilities
+	}{
+		{"admin", models.Project{}, admin, ProjectCapabilities{true, true, true, true, true}},
+		{"member", models.Project{}, member, ProjectCapabilities{}},
+		{"config writer", models.Project{}, writer, ProjectCapabilities{CanInitiateRotation: true, CanManageTeams: true, CanManageSecretManagers: true}},
+		{"masked sensitive values", models.Project{RestrictSensitive: true}, writer, ProjectCapabilities{CanManageTeams: true, CanManageSecretManagers: true}},
+		{"revealed sensitive values", models.Project{RestrictSensitive: true}, admin, ProjectCapabilities{true, true, true, true, true}},
+		{"sandbox", models.Project{Sandbox: true}, admin, ProjectCapabilities{true, true, true, true, false}},
+	}
+	for _, tt := range tests {
+		if got := projectCapabilities(&tt.project, tt.permissions); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadProjectPermissions(t *testing.T) {
+	f := newAccessFixture(t)
+	projects := []projectWithOrg{{Project: f.project}, {Project: f.sandbox}}
+
+	for _, user := range []models.User{f.member, f.admin, f.outsider} {
+		permissions, err := loadProjectPermissions(database.DB, user.ID, projects)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, project := range projects {
+			want := NewPermissionSet(nil)
+			if access, err := GetUserProjectAccess(user.ID, project.ID); err == nil {
+				want = access.Permissions
+			}
+			if got := permissions[project.ID]; !slices.Equal(got.List(), want.List()) {
+				t.Errorf("%s in %s: got %v, want %v", user.Name, project.Name, got.List(), want.List())
+			}
+		}
+	}
+
+	if permissions, _ := loadProjectPermissions(database.DB, f.member.ID, projects); !permissions[f.sandbox.ID].Has(models.PermissionFilesWrite) {
+		t.Error("the member's custom team role should grant files.write in the sandbox")
+	}
+}
@@ -1,19 +1,35 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"envie-backend/internal/apitime"
+	"envie-backend/internal/configsign"
+	"envie-backend/internal/crypto"
 	"envie-backend/internal/database"
 	"envie-backend/internal/middleware"
 	"envie-backend/internal/models"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 type CLIConfigItem struct {
-	ID             string  `json:"id"`
-	Name           string  `json:"name"`
-	EncryptedValue string  `json:"encryptedValue"`
-	Position       int     `json:"position"`
-	Category       *string `json:"category,omitempty"`
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	EncryptedValue string   `json:"encryptedValue"`
+	Masked         bool     `json:"masked,omitempty"` // sensitive value omitted, the token lacks secrets.reveal
+	Position       int      `json:"position"`
+	ValueType      string   `json:"valueType"`
+	HasReferences  bool     `json:"hasReferences,omitempty"` // the value contains ${KEY} references to expand
+	Category       *string  `json:"category,omitempty"`
+	Labels         []string `json:"labels,omitempty"` // compliance labels, including the project's
 }
 
 type CLIProjectConfigResponse struct {
@@ -22,35 +38,146 @@ type CLIProjectConfigResponse struct {
 	EncryptedProjectKey string          `json:"encryptedProjectKey"`
 	Items               []CLIConfigItem `json:"items"`
 	ConfigChecksum      string          `json:"configChecksum"`
+	EnvelopeVersion     int             `json:"envelopeVersion"`
+	Labels              []string        `json:"labels,omitempty"` // compliance labels of the project
+
+	// ConfigChecksum is in ChecksumVersion. LegacyConfigChecksum is the version 1
+	// checksum, served during the migration window for clients that still
+	// compute or record it.
+	ChecksumVersion      int    `json:"checksumVersion"`
+	LegacyConfigChecksum string `json:"legacyConfigChecksum,omitempty"`
+
+	// Signature is the instance's signature over the project ID, checksum, key
+	// version and items, when CONFIG_SIGNING_KEY is set. See configsign.
+	Signature *configsign.Signature `json:"signature,omitempty"`
 }
 
-func GetCLIProjectConfig(c *gin.Context) {
-	token := middleware.GetCLIToken(c)
-	if token == nil {
-		RespondUnauthorized(c, "Authentication required")
+// CLIError is a failure from the CLI config logic shared by REST and gRPC,
+// carrying the HTTP status it maps to.
+type CLIError struct {
+	Status  int
+	Message string
+}
+
+func (e *CLIError) Error() string {
+	return e.Message
+}
+
+// respondCLIError sends err as a JSON error, using the status of a CLIError when there is one
+func respondCLIError(c *gin.Context, err error) {
+	var cliErr *CLIError
+	if errors.As(err, &cliErr) {
+		RespondError(c, cliErr.Status, cliErr.Message)
 		return
 	}
+	RespondInternalError(c, err.Error())
+}
 
-	projectID, ok := ParseUUIDParam(c, "id", "project")
-	if !ok {
-		return
+// EnvelopeVersionsHeader lists the envelope versions a CLI can unwrap, e.g. "1,2".
+// Older CLIs don't send it and only understand v1.
+const EnvelopeVersionsHeader = "X-Envie-Envelope-Versions"
+
+// checkCLIEnvelopeSupport rejects clients that can't unwrap the token's project key.
+// header is the client's EnvelopeVersionsHeader value.
+func checkCLIEnvelopeSupport(header string, token *models.ProjectToken) error {
+	version := token.EnvelopeVersion
+	if version == 0 {
+		version = crypto.EnvelopeV1
+	}
+
+	supported := map[int]bool{crypto.EnvelopeV1: true}
+	if header != "" {
+		supported = map[int]bool{}
+		for _, part := range strings.Split(header, ",") {
+			if v, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+				supported[v] = true
+			}
+		}
+	}
+
+	if !supported[version] {
+		return &CLIError{http.StatusUpgradeRequired, fmt.Sprintf("This token uses envelope version %d, which this client does not support. Upgrade the Envie CLI.", version)}
+	}
+	return nil
+}
+
+// AlgorithmsHeader lists the versioned blob algorithms a CLI can decrypt, e.g. "1,2,3,4".
+// CLIs that don't send it predate the versioned format and only read legacy blobs.
+const AlgorithmsHeader = "X-Envie-Algorithms"
+
+// checkCLIAlgorithmSupport rejects clients that can't decrypt every given blob.
+// header is the client's AlgorithmsHeader value.
+func checkCLIAlgorithmSupport(header string, blobs ...string) error {
+	supported := map[crypto.Algorithm]bool{}
+	for _, part := range strings.Split(header, ",") {
+		if v, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+			supported[crypto.Algorithm(v)] = true
+		}
 	}
 
+	for _, blob := range blobs {
+		if !crypto.IsVersionedBlob(blob) {
+			continue
+		}
+		alg, err := crypto.BlobAlgorithm(blob, 0)
+		if err != nil || !supported[alg] {
+			return &CLIError{http.StatusUpgradeRequired, "This project contains data encrypted with an algorithm this client does not support. Upgrade the Envie CLI."}
+		}
+	}
+	return nil
+}
+
+// requireCLIAlgorithmSupport rejects clients that can't decrypt every given blob.
+// If unsuccessful, it sends an error response automatically.
+func requireCLIAlgorithmSupport(c *gin.Context, blobs ...string) bool {
+	if err := checkCLIAlgorithmSupport(c.GetHeader(AlgorithmsHeader), blobs...); err != nil {
+		respondCLIError(c, err)
+		return false
+	}
+	return true
+}
+
+// BuildCLIProjectConfig loads a project's encrypted config for a CLI token,
+// with the queries bound to ctx. envelopeVersions and algorithms are the
+// client's EnvelopeVersionsHeader and AlgorithmsHeader values. Failures are
+// returned as *CLIError.
+func BuildCLIProjectConfig(ctx context.Context, token *models.ProjectToken, projectID uuid.UUID, envelopeVersions, algorithms string) (*CLIProjectConfigResponse, error) {
 	if token.ProjectID != projectID {
-		RespondForbidden(c, "Token is not valid for this project")
-		return
+		return nil, &CLIError{http.StatusForbidden, "Token is not valid for this project"}
+	}
+
+	if err := checkCLIEnvelopeSupport(envelopeVersions, token); err != nil {
+		return nil, err
 	}
 
+	db := database.DB.WithContext(ctx)
 	var project models.Project
-	if err := database.DB.Where("id = ?", projectID).First(&project).Error; err != nil {
-		RespondNotFound(c, "Project not found")
-		return
+	if err := db.Where("id = ?", projectID).First(&project).Error; err != nil {
+		return nil, &CLIError{http.StatusNotFound, "Project not found"}
 	}
 
 	var items []models.ConfigItem
-	if err := database.DB.Where("project_id = ?", projectID).Order("position asc").Find(&items).Error; err != nil {
-		RespondInternalError(c, "Failed to fetch config items")
-		return
+	if err := db.Where("project_id = ?", projectID).Order("position asc").Find(&items).Error; err != nil {
+		return nil, &CLIError{http.StatusInternalServerError, "Failed to fetch config items"}
+	}
+
+	if project.RestrictSensitive && !token.HasScope(models.TokenScopeSecretsReveal) {
+		maskSensitiveItems(items)
+	}
+
+	blobs := []string{token.EncryptedProjectKey}
+	for _, item := range items {
+		if !item.Masked {
+			blobs = append(blobs, item.Value)
+		}
+	}
+	if err := checkCLIAlgorithmSupport(algorithms, blobs...); err != nil {
+		return nil, err
+	}
+
+	labels, err := loadProjectLabels(db, projectID)
+	if err != nil {
+		return nil, &CLIError{http.StatusInternalServerError, "Failed to fetch compliance labels"}
 	}
 
 	cliItems := make([]CLIConfigItem, len(items))
@@ -59,8 +186,12 @@ func GetCLIProjectConfig(c *gin.Context) {
 			ID:             item.ID.String(),
 			Name:           item.Name,
 			EncryptedValue: item.Value,
+			Masked:         item.Masked,
 			Position:       item.Position,
+			ValueType:      item.ValueType,
+			HasReferences:  item.HasReferences,
 			Category:       item.Category,
+			Labels:         labels.item(item.ID),
 		}
 	}
 
@@ -69,47 +200,119 @@ func GetCLIProjectConfig(c *gin.Context) {
 		checksum = *project.ConfigChecksum
 	}
 
-	RespondOK(c, CLIProjectConfigResponse{
+	response := &CLIProjectConfigResponse{
 		ProjectID:           project.ID.String(),
 		ProjectName:         project.Name,
 		EncryptedProjectKey: token.EncryptedProjectKey,
 		Items:               cliItems,
 		ConfigChecksum:      checksum,
+		EnvelopeVersion:     crypto.EnvelopeVersion(token.EncryptedProjectKey),
+		Labels:              labels.project,
+
+		ChecksumVersion:      models.ConfigChecksumVersion,
+		LegacyConfigChecksum: legacyConfigChecksum(&project),
+	}
+	if signer := configsign.Current; signer != nil {
+		response.Signature = signConfig(signer, response, project.KeyVersion)
+	}
+	return response, nil
+}
+
+// signConfig signs the config in response as served, after masking
+func signConfig(signer *configsign.Signer, response *CLIProjectConfigResponse, keyVersion int) *configsign.Signature {
+	items := make([]configsign.Item, len(response.Items))
+	for i, item := range response.Items {
+		items[i] = configsign.Item{Name: item.Name, EncryptedValue: item.EncryptedValue, ValueType: item.ValueType, Masked: item.Masked}
+	}
+	return signer.Sign(configsign.Payload{
+		ProjectID:  response.ProjectID,
+		Checksum:   response.ConfigChecksum,
+		KeyVersion: keyVersion,
+		ItemDigest: configsign.ItemDigest(items),
+		SignedAt:   time.Now(),
 	})
 }
 
-type CLIVerifyResponse struct {
-	TokenID     string  `json:"tokenId"`
-	TokenName   string  `json:"tokenName"`
-	ProjectID   string  `json:"projectId"`
-	ProjectName string  `json:"projectName"`
-	ExpiresAt   *string `json:"expiresAt,omitempty"`
+// ResolveCLIProject returns the ID of the project a CLI names by ID or slug. Slugs
+// are only matched against the token's own project, so a token can't probe the
+// slugs of other projects. Failures are returned as *CLIError.
+func ResolveCLIProject(token *models.ProjectToken, value string) (uuid.UUID, error) {
+	if id, err := uuid.Parse(value); err == nil {
+		return id, nil
+	}
+
+	var count int64
+	if err := database.DB.Model(&models.Project{}).Where("id = ? AND slug = ?", token.ProjectID, value).Count(&count).Error; err != nil {
+		return uuid.Nil, &CLIError{http.StatusInternalServerError, "Failed to fetch project"}
+	}
+	if count == 0 {
+		return uuid.Nil, &CLIError{http.StatusForbidden, "Token is not valid for this project"}
+	}
+	return token.ProjectID, nil
 }
 
-func VerifyCLIIdentity(c *gin.Context) {
+func GetCLIProjectConfig(c *gin.Context) {
 	token := middleware.GetCLIToken(c)
 	if token == nil {
 		RespondUnauthorized(c, "Authentication required")
 		return
 	}
 
-	var project models.Project
-	if err := database.DB.Where("id = ?", token.ProjectID).First(&project).Error; err != nil {
-		RespondInternalError(c, "Failed to fetch project")
+	projectID, err := ResolveCLIProject(token, c.Param("id"))
+	if err != nil {
+		respondCLIError(c, err)
 		return
 	}
 
-	var expiresAt *string
-	if token.ExpiresAt != nil {
-		exp := token.ExpiresAt.Format("2006-01-02T15:04:05Z07:00")
-		expiresAt = &exp
+	config, err := BuildCLIProjectConfig(c.Request.Context(), token, projectID, c.GetHeader(EnvelopeVersionsHeader), c.GetHeader(AlgorithmsHeader))
+	if err != nil {
+		respondCLIError(c, err)
+		return
 	}
+	RecordCLIConfigRead(requestDB(c), token, middleware.ClientIP(c), len(config.Items))
+
+	RespondOK(c, config)
+}
 
-	RespondOK(c, CLIVerifyResponse{
+type CLIVerifyResponse struct {
+	TokenID     string        `json:"tokenId"`
+	TokenName   string        `json:"tokenName"`
+	ProjectID   string        `json:"projectId"`
+	ProjectName string        `json:"projectName"`
+	ProjectSlug string        `json:"projectSlug"`
+	ExpiresAt   *apitime.Time `json:"expiresAt,omitempty"`
+}
+
+// BuildCLIVerifyResponse describes the token a CLI identity resolved to.
+// Failures are returned as *CLIError.
+func BuildCLIVerifyResponse(token *models.ProjectToken) (*CLIVerifyResponse, error) {
+	var project models.Project
+	if err := database.DB.Where("id = ?", token.ProjectID).First(&project).Error; err != nil {
+		return nil, &CLIError{http.StatusInternalServerError, "Failed to fetch project"}
+	}
+
+	return &CLIVerifyResponse{
 		TokenID:     token.ID.String(),
 		TokenName:   token.Name,
 		ProjectID:   token.ProjectID.String(),
 		ProjectName: project.Name,
-		ExpiresAt:   expiresAt,
-	})
+		ProjectSlug: project.Slug,
+		ExpiresAt:   apitime.NewPtr(token.ExpiresAt),
+	}, nil
+}
+
+func VerifyCLIIdentity(c *gin.Context) {
+	token := middleware.GetCLIToken(c)
+	if token == nil {
+		RespondUnauthorized(c, "Authentication required")
+		return
+	}
+
+	info, err := BuildCLIVerifyResponse(token)
+	if err != nil {
+		respondCLIError(c, err)
+		return
+	}
+
+	RespondOK(c, info)
 }
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"time"
+
+	"envie-backend/internal/crypto"
+	"envie-backend/internal/models"
+	"envie-backend/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// CLIProjectFile - a project file as the CLI lists it
+type CLIProjectFile struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Folder    string    `json:"folder"`
+	SizeBytes int64     `json:"sizeBytes"`
+	MimeType  string    `json:"mimeType"`
+	Checksum  string    `json:"checksum"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CLIProjectFilesResponse - the project's files and the project key their FEKs
+// are encrypted with, encrypted to the token
+type CLIProjectFilesResponse struct {
+	EncryptedProjectKey string           `json:"encryptedProjectKey"`
+	EnvelopeVersion     int              `json:"envelopeVersion"`
+	Files               []CLIProjectFile `json:"files"`
+}
+
+func GetCLIProjectFiles(c *gin.Context) {
+	token, projectID, ok := requireCLIProjectToken(c)
+	if !ok {
+		return
+	}
+
+	if !requireCLIAlgorithmSupport(c, token.EncryptedProjectKey) {
+		return
+	}
+
+	var files []models.ProjectFile
+	if err := requestDB(c).Where("project_id = ?", projectID).Order("folder, name").Find(&files).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch files")
+		return
+	}
+
+	response := CLIProjectFilesResponse{
+		EncryptedProjectKey: token.EncryptedProjectKey,
+		EnvelopeVersion:     crypto.EnvelopeVersion(token.EncryptedProjectKey),
+		Files:               make([]CLIProjectFile, len(files)),
+	}
+	for i, f := range files {
+		response.Files[i] = CLIProjectFile{
+			ID:        f.ID,
+			Name:      f.Name,
+			Folder:    f.Folder,
+			SizeBytes: f.SizeBytes,
+			MimeType:  f.MimeType,
+			Checksum:  f.Checksum,
+			CreatedAt: f.CreatedAt,
+		}
+	}
+	RespondOK(c, response)
+}
+
+func DownloadCLIProjectFile(c *gin.Context) {
+	if !checkStorageConfigured(c) {
+		return
+	}
+
+	token, projectID, ok := requireCLIProjectToken(c)
+	if !ok {
+		return
+	}
+
+	fileID, ok := ParseUUIDParam(c, "fileId", "file")
+	if !ok {
+		return
+	}
+
+	var file models.ProjectFile
+	if err := requestDB(c).Where("id = ? AND project_id = ?", fileID, projectID).First(&file).Error; err != nil {
+		RespondNotFound(c, "File not found")
+		return
+	}
+
+	if !requireCLIAlgorithmSupport(c, file.EncryptedFEK) {
+		return
+	}
+
+	var project models.Project
+	if err := requestDB(c).Select("id, organization_id").First(&project, "id = ?", projectID).Error; err != nil {
+		RespondNotFound(c, "Project not found")
+		return
+	}
+
+	data, err := storage.DownloadFile(context.WithoutCancel(c.Request.Context()), file.S3Key)
+	if err != nil {
+		RespondInternalError(c, "Failed to download file")
+		return
+	}
+	recordFileDownload(c, project.OrganizationID, &file, token.CreatedBy, &token.ID)
+
+	RespondOK(c, FileDownloadResponse{
+		Data:         base64.StdEncoding.EncodeToString(data),
+		EncryptedFEK: file.EncryptedFEK,
+		Checksum:     file.Checksum,
+		Name:         file.Name,
+		MimeType:     file.MimeType,
+	})
+}
+
+// UploadCLIProjectFile takes the same multipart form as UploadProjectFile from
+// a token with the files.write scope. The file is attributed to the token's
+// creator.
+func UploadCLIProjectFile(c *gin.Context) {
+	if !checkStorageConfigured(c) {
+		return
+	}
+
+	token, projectID, ok := requireCLIProjectToken(c)
+	if !ok {
+		return
+	}
+
+	if !token.HasScope(models.TokenScopeFilesWrite) {
+		RespondForbidden(c, "Token lacks the "+models.TokenScopeFilesWrite+" scope")
+		return
+	}
+
+	var project models.Project
+	if err := requestDB(c).Select("id, organization_id").First(&project, "id = ?", projectID).Error; err != nil {
+		RespondNotFound(c, "Project not found")
+		return
+	}
+
+	receiveProjectFile(c, projectID, project.OrganizationID, token.CreatedBy, " (CLI token "+token.Name+")")
+}
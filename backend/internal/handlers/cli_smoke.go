@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"envie-backend/internal/configwatch"
+	"envie-backend/internal/crypto"
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SmokeCanaryKey is the config item `envie smoke --write` rewrites. CLI tokens are
+// otherwise read-only; creating this item in the app opts a project into the write
+// check, so monitoring should use a dedicated project.
+const SmokeCanaryKey = "ENVIE_SMOKE_CANARY"
+
+type CLIConfigChecksumResponse struct {
+	ProjectID            string `json:"projectId"`
+	ConfigChecksum       string `json:"configChecksum"`
+	ChecksumVersion      int    `json:"checksumVersion"`
+	LegacyConfigChecksum string `json:"legacyConfigChecksum,omitempty"` // version 1, during the migration window
+}
+
+// configChecksumResponse reports the config checksum of project, loaded with
+// config_checksum and legacy_config_checksum
+func configChecksumResponse(project *models.Project) CLIConfigChecksumResponse {
+	response := CLIConfigChecksumResponse{
+		ProjectID:            project.ID.String(),
+		ChecksumVersion:      models.ConfigChecksumVersion,
+		LegacyConfigChecksum: legacyConfigChecksum(project),
+	}
+	if project.ConfigChecksum != nil {
+		response.ConfigChecksum = *project.ConfigChecksum
+	}
+	return response
+}
+
+type WriteCLICanaryRequest struct {
+	EncryptedValue string `json:"encryptedValue" binding:"required,ciphertext"`
+}
+
+// GetCLIConfigChecksum returns the checksum of the stored config, so a client can
+// check its copy without downloading every value
+func GetCLIConfigChecksum(c *gin.Context) {
+	_, projectID, ok := requireCLIProjectToken(c)
+	if !ok {
+		return
+	}
+
+	var project models.Project
+	if err := requestDB(c).Select("id, config_checksum, legacy_config_checksum").First(&project, "id = ?", projectID).Error; err != nil {
+		RespondNotFound(c, "Project not found")
+		return
+	}
+	RespondOK(c, configChecksumResponse(&project))
+}
+
+// WriteCLICanary replaces the value of the project's SmokeCanaryKey item, which must
+// already exist. The value is encrypted by the CLI with the project key.
+func WriteCLICanary(c *gin.Context) {
+	token, projectID, ok := requireCLIProjectToken(c)
+	if !ok {
+		return
+	}
+
+	var req WriteCLICanaryRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+	if alg, _, err := crypto.DecodeBlob(req.EncryptedValue, crypto.AlgAESGCM); err != nil || alg != crypto.AlgAESGCM {
+		RespondBadRequest(c, "Canary value must be encrypted with the project key")
+		return
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		var canary models.ConfigItem
+		if err := tx.Where("project_id = ? AND name = ?", projectID, SmokeCanaryKey).First(&canary).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&canary).Updates(map[string]any{
+			"value":      req.EncryptedValue,
+			"updated_by": token.CreatedBy,
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		return updateConfigChecksum(tx, projectID, configChange{ActorID: token.CreatedBy, Detail: "CLI write check by token " + token.Name, Count: 1})
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		RespondNotFound(c, "Create the "+SmokeCanaryKey+" config item in the app to enable write checks")
+		return
+	}
+	if err != nil {
+		RespondInternalError(c, "Failed to write canary")
+		return
+	}
+
+	configwatch.Publish(projectID)
+
+	var project models.Project
+	if err := requestDB(c).Select("id, config_checksum, legacy_config_checksum").First(&project, "id = ?", projectID).Error; err != nil || project.ConfigChecksum == nil {
+		RespondInternalError(c, "Failed to read config checksum")
+		return
+	}
+	RespondOK(c, configChecksumResponse(&project))
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"envie-backend/internal/apitime"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CLIPendingRotation is a key rotation waiting for approval. Committing it
+// revokes every CLI token of the project.
+type CLIPendingRotation struct {
+	ID         string       `json:"id"`
+	NewVersion int          `json:"newVersion"`
+	ExpiresAt  apitime.Time `json:"expiresAt"`
+	ExpiresIn  int          `json:"expiresIn"` // seconds left to approve
+}
+
+// CLIProjectStatusResponse is what `envie status` reports about the project
+type CLIProjectStatusResponse struct {
+	ProjectID          string              `json:"projectId"`
+	ConfigChecksum     string              `json:"configChecksum"`
+	KeyVersion         int                 `json:"keyVersion"`
+	PendingRotation    *CLIPendingRotation `json:"pendingRotation,omitempty"`
+	RotationRequiredAt *apitime.Time       `json:"rotationRequiredAt,omitempty"`
+
+	// LegacyConfigChecksum is ConfigChecksum in version 1, during the migration
+	// window, to compare checksums recorded by older CLIs with
+	ChecksumVersion      int    `json:"checksumVersion"`
+	LegacyConfigChecksum string `json:"legacyConfigChecksum,omitempty"`
+}
+
+// GetCLIProjectStatus returns the config checksum, key version and rotation state
+// of the token's project in one request, for diagnosing a failing pipeline
+func GetCLIProjectStatus(c *gin.Context) {
+	_, projectID, ok := requireCLIProjectToken(c)
+	if !ok {
+		return
+	}
+
+	db := requestDB(c)
+	var project models.Project
+	if err := db.Select("id, config_checksum, legacy_config_checksum, key_version, key_rotation_required_at").First(&project, "id = ?", projectID).Error; err != nil {
+		RespondNotFound(c, "Project not found")
+		return
+	}
+
+	response := CLIProjectStatusResponse{
+		ProjectID:          projectID.String(),
+		KeyVersion:         project.KeyVersion,
+		RotationRequiredAt: apitime.NewPtr(project.KeyRotationRequiredAt),
+
+		ChecksumVersion:      models.ConfigChecksumVersion,
+		LegacyConfigChecksum: legacyConfigChecksum(&project),
+	}
+	if project.ConfigChecksum != nil {
+		response.ConfigChecksum = *project.ConfigChecksum
+	}
+
+	var pending models.PendingKeyRotation
+	err := db.Select("id, new_version, expires_at").
+		Where("project_id = ? AND status = ?", projectID, "pending").
+		First(&pending).Error
+	if err == nil {
+		response.PendingRotation = &CLIPendingRotation{
+			ID:         pending.ID.String(),
+			NewVersion: pending.NewVersion,
+			ExpiresAt:  apitime.New(pending.ExpiresAt),
+			ExpiresIn:  secondsLeft(pending.ExpiresAt, time.Now()),
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		RespondInternalError(c, "Failed to fetch pending rotation")
+		return
+	}
+
+	RespondOK(c, response)
+}
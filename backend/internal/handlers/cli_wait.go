@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"envie-backend/internal/configwatch"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultConfigWaitTimeout = 30 * time.Second
+	maxConfigWaitTimeout     = 60 * time.Second
+	configWaitDeadlineMargin = 2 * time.Second
+)
+
+// configWaitPollInterval is how often a waiting request re-reads the checksum,
+// which catches changes made on other instances. Swapped out in tests.
+var configWaitPollInterval = 5 * time.Second
+
+type CLIConfigWaitResponse struct {
+	ProjectID      string `json:"projectId"`
+	ConfigChecksum string `json:"configChecksum"`
+	Changed        bool   `json:"changed"`
+}
+
+// WaitCLIConfigChange long-polls for a config change, for clients that can't
+// keep a stream open. It returns as soon as the stored checksum differs from the
+// checksum query parameter, or unchanged once timeout seconds have passed.
+func WaitCLIConfigChange(c *gin.Context) {
+	_, projectID, ok := requireCLIProjectToken(c)
+	if !ok {
+		return
+	}
+
+	timeout := defaultConfigWaitTimeout
+	if value := c.Query("timeout"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			RespondBadRequest(c, "timeout must be a number of seconds")
+			return
+		}
+		timeout = min(time.Duration(seconds)*time.Second, maxConfigWaitTimeout)
+	}
+	// Answer unchanged before REQUEST_TIMEOUT cuts the request off
+	if deadline, ok := c.Request.Context().Deadline(); ok {
+		timeout = max(min(timeout, time.Until(deadline)-configWaitDeadlineMargin), 0)
+	}
+
+	db := requestDB(c)
+	known := c.Query("checksum")
+	load := func() (string, error) {
+		var project models.Project
+		if err := db.Select("id, config_checksum, legacy_config_checksum").First(&project, "id = ?", projectID).Error; err != nil {
+			return "", err
+		}
+		if project.ConfigChecksum == nil {
+			return "", nil
+		}
+		if known != "" && known == legacyConfigChecksum(&project) {
+			return known, nil // a version 1 checksum of the current config
+		}
+		return *project.ConfigChecksum, nil
+	}
+
+	checksum, changed, err := waitForConfigChange(c.Request.Context(), projectID, known, timeout, load)
+	if err != nil {
+		if c.Request.Context().Err() != nil {
+			return // the client went away
+		}
+		RespondNotFound(c, "Project not found")
+		return
+	}
+
+	RespondOK(c, CLIConfigWaitResponse{ProjectID: projectID.String(), ConfigChecksum: checksum, Changed: changed})
+}
+
+// waitForConfigChange waits until load returns a checksum other than known, or
+// until timeout passes. It re-reads the checksum when this instance publishes a
+// change and every configWaitPollInterval for changes published elsewhere.
+func waitForConfigChange(ctx context.Context, projectID uuid.UUID, known string, timeout time.Duration, load func() (string, error)) (string, bool, error) {
+	// Subscribe before the first read, so a change in between isn't missed
+	changes, unsubscribe := configwatch.Subscribe(projectID)
+	defer unsubscribe()
+
+	checksum, err := load()
+	if err != nil || checksum != known {
+		return checksum, err == nil, err
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	poll := time.NewTicker(configWaitPollInterval)
+	defer poll.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return checksum, false, ctx.Err()
+		case <-deadline.C:
+			return checksum, false, nil
+		case <-changes:
+		case <-poll.C:
+		}
+
+		checksum, err = load()
+		if err != nil || checksum != known {
+			return checksum, err == nil, err
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"envie-backend/internal/configwatch"
+
+	"github.com/google/uuid"
+)
+
+func TestWaitForConfigChange(t *testing.T) {
+	projectID := uuid.New()
+
+	var stored atomic.Value
+	stored.Store("a")
+	load := func() (string, error) { return stored.Load().(string), nil }
+
+	checksum, changed, err := waitForConfigChange(context.Background(), projectID, "old", time.Minute, load)
+	if err != nil || !changed || checksum != "a" {
+		t.Errorf("stale checksum: got %q, changed %v, err %v", checksum, changed, err)
+	}
+
+	checksum, changed, err = waitForConfigChange(context.Background(), projectID, "a", 10*time.Millisecond, load)
+	if err != nil || changed || checksum != "a" {
+		t.Errorf("timeout: got %q, changed %v, err %v", checksum, changed, err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		stored.Store("b")
+		configwatch.Publish(projectID)
+	}()
+	start := time.Now()
+	checksum, changed, err = waitForConfigChange(context.Background(), projectID, "a", time.Minute, load)
+	if err != nil || !changed || checksum != "b" {
+		t.Errorf("publish: got %q, changed %v, err %v", checksum, changed, err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("publish did not end the wait early")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := waitForConfigChange(ctx, projectID, "b", time.Minute, load); err == nil {
+		t.Error("cancelled request kept waiting")
+	}
+}
+
+func TestWaitForConfigChangePolls(t *testing.T) {
+	interval := configWaitPollInterval
+	configWaitPollInterval = 10 * time.Millisecond
+	defer func() { configWaitPollInterval = interval }()
+
+	loads := 0
+	load := func() (string, error) {
+		loads++
+		if loads > 2 {
+			return "changed elsewhere", nil
+		}
+		return "a", nil
+	}
+
+	checksum, changed, err := waitForConfigChange(context.Background(), uuid.New(), "a", time.Minute, load)
+	if err != nil || !changed || checksum != "changed elsewhere" {
+		t.Errorf("got %q, changed %v, err %v", checksum, changed, err)
+	}
+}
@@ -0,0 +1,570 @@
+package handlers
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type CreateComplianceLabelRequest struct {
+	Name        string  `json:"name" binding:"required,min=1,max=50"`
+	Description *string `json:"description" binding:"omitempty,max=255"`
+}
+
+type SetComplianceLabelsRequest struct {
+	LabelIDs []uuid.UUID `json:"labelIds" binding:"max=50"`
+}
+
+// ConfigItemLabels - the labels of one config item, including those inherited
+// from its project
+type ConfigItemLabels struct {
+	ID     uuid.UUID `json:"id"`
+	Name   string    `json:"name"`
+	Labels []string  `json:"labels"`
+}
+
+type ProjectComplianceLabelsResponse struct {
+	Labels []models.ComplianceLabel `json:"labels"`
+	Items  []ConfigItemLabels       `json:"items"`
+}
+
+// ComplianceReportProject - a project under a label, either as a whole or
+// through some of its items
+type ComplianceReportProject struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Labelled  bool      `json:"labelled"` // the whole project carries the label
+	ItemNames []string  `json:"itemNames"`
+}
+
+type ComplianceReportEntry struct {
+	Label    models.ComplianceLabel    `json:"label"`
+	Projects []ComplianceReportProject `json:"projects"`
+}
+
+// KeyHolder - a user who can decrypt the project key, and how
+type KeyHolder struct {
+	UserID             uuid.UUID `json:"userId"`
+	Name               string    `json:"name"`
+	Email              string    `json:"email"`
+	ViaOrganizationKey bool      `json:"viaOrganizationKey"`
+	ViaTeams           []string  `json:"viaTeams"`
+}
+
+type KeyHolderToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+type ProjectKeyHoldersResponse struct {
+	ProjectID  uuid.UUID        `json:"projectId"`
+	KeyVersion int              `json:"keyVersion"`
+	Labels     []string         `json:"labels"`
+	Users      []KeyHolder      `json:"users"`
+	Tokens     []KeyHolderToken `json:"tokens"`
+}
+
+// projectLabels holds the label names of a project and of its config items
+type projectLabels struct {
+	project []string
+	items   map[uuid.UUID][]string
+}
+
+// item returns the labels of a config item: its own and the project's
+func (l projectLabels) item(id uuid.UUID) []string {
+	return mergeLabels(l.project, l.items[id])
+}
+
+func (l projectLabels) has(id uuid.UUID, name string) bool {
+	for _, label := range l.item(id) {
+		if label == name {
+			return true
+		}
+	}
+	return false
+}
+
+func mergeLabels(a, b []string) []string {
+	seen := map[string]bool{}
+	merged := []string{}
+	for _, label := range append(append([]string{}, a...), b...) {
+		if !seen[label] {
+			seen[label] = true
+			merged = append(merged, label)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+func loadProjectLabels(db *gorm.DB, projectID uuid.UUID) (projectLabels, error) {
+	labels := projectLabels{project: []string{}, items: map[uuid.UUID][]string{}}
+	if err := db.Table("compliance_labels").
+		Joins("JOIN project_compliance_labels ON project_compliance_labels.label_id = compliance_labels.id").
+		Where("project_compliance_labels.project_id = ?", projectID).
+		Order("compliance_labels.name").Pluck("compliance_labels.name", &labels.project).Error; err != nil {
+		return labels, err
+	}
+
+	var rows []struct {
+		ConfigItemID uuid.UUID
+		Name         string
+	}
+	if err := db.Table("config_item_compliance_labels").
+		Select("config_item_compliance_labels.config_item_id, compliance_labels.name").
+		Joins("JOIN compliance_labels ON compliance_labels.id = config_item_compliance_labels.label_id").
+		Joins("JOIN config_items ON config_items.id = config_item_compliance_labels.config_item_id").
+		Where("config_items.project_id = ? AND config_items.deleted_at IS NULL", projectID).
+		Scan(&rows).Error; err != nil {
+		return labels, err
+	}
+	for _, row := range rows {
+		labels.items[row.ConfigItemID] = append(labels.items[row.ConfigItemID], row.Name)
+	}
+	return labels, nil
+}
+
+// projectsWithLabel returns the IDs of the projects that carry the named label,
+// themselves or through one of their config items
+func projectsWithLabel(db *gorm.DB, name string) (map[uuid.UUID]bool, error) {
+	var ids []uuid.UUID
+	err := db.Raw(`
+		SELECT project_compliance_labels.project_id
+		FROM project_compliance_labels
+		JOIN compliance_labels ON compliance_labels.id = project_compliance_labels.label_id
+		WHERE compliance_labels.name = ?
+
+		UNION
+
+		SELECT config_items.project_id
+		FROM config_item_compliance_labels
+		JOIN compliance_labels ON compliance_labels.id = config_item_compliance_labels.label_id
+		JOIN config_items ON config_items.id = config_item_compliance_labels.config_item_id
+		WHERE compliance_labels.name = ? AND config_items.deleted_at IS NULL
+	`, name, name).Scan(&ids).Error
+
+	set := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set, err
+}
+
+// filterProjectsByLabel keeps the projects carrying the label query parameter,
+// if one is given
+func filterProjectsByLabel(c *gin.Context, projects []projectWithOrg) ([]projectWithOrg, bool) {
+	name := c.Query("label")
+	if name == "" {
+		return projects, true
+	}
+
+	labelled, err := projectsWithLabel(requestDB(c), name)
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch compliance labels")
+		return nil, false
+	}
+
+	filtered := []projectWithOrg{}
+	for _, project := range projects {
+		if labelled[project.ID] {
+			filtered = append(filtered, project)
+		}
+	}
+	return filtered, true
+}
+
+// requireComplianceLabels loads the labels with the given IDs, which must all
+// belong to the organization
+func requireComplianceLabels(c *gin.Context, orgID uuid.UUID, ids []uuid.UUID) ([]models.ComplianceLabel, bool) {
+	labels := []models.ComplianceLabel{}
+	if len(ids) == 0 {
+		return labels, true
+	}
+	if err := requestDB(c).Where("organization_id = ? AND id IN ?", orgID, ids).Find(&labels).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch compliance labels")
+		return nil, false
+	}
+
+	unique := map[uuid.UUID]bool{}
+	for _, id := range ids {
+		unique[id] = true
+	}
+	if len(labels) != len(unique) {
+		RespondBadRequest(c, "Unknown compliance label")
+		return nil, false
+	}
+	return labels, true
+}
+
+func GetComplianceLabels(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgMembership(c, uid, orgID); !ok {
+		return
+	}
+
+	labels := []models.ComplianceLabel{}
+	if err := requestDB(c).Where("organization_id = ?", orgID).Order("name").Find(&labels).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch compliance labels")
+		return
+	}
+
+	RespondOK(c, labels)
+}
+
+func CreateComplianceLabel(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	var req CreateComplianceLabelRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		RespondBadRequest(c, "Label name required")
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	var count int64
+	requestDB(c).Model(&models.ComplianceLabel{}).Where("organization_id = ? AND name = ?", orgID, req.Name).Count(&count)
+	if count > 0 {
+		RespondBadRequest(c, "A label with this name already exists")
+		return
+	}
+
+	label := models.ComplianceLabel{OrganizationID: orgID, Name: req.Name, Description: req.Description}
+	if err := requestDB(c).Create(&label).Error; err != nil {
+		RespondInternalError(c, "Failed to create compliance label")
+		return
+	}
+
+	RespondCreated(c, label)
+}
+
+// DeleteComplianceLabel deletes a label, untagging everything that carried it
+func DeleteComplianceLabel(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	labelID, ok := ParseUUIDParam(c, "labelId", "label")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	result := requestDB(c).Where("id = ? AND organization_id = ?", labelID, orgID).Delete(&models.ComplianceLabel{})
+	if result.Error != nil {
+		RespondInternalError(c, "Failed to delete compliance label")
+		return
+	}
+	if result.RowsAffected == 0 {
+		RespondNotFound(c, "Label not found")
+		return
+	}
+
+	RespondMessage(c, "Compliance label deleted")
+}
+
+// GetProjectComplianceLabels lists the labels of a project and of each of its
+// config items
+func GetProjectComplianceLabels(c *gin.Context) {
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	response := ProjectComplianceLabelsResponse{Labels: []models.ComplianceLabel{}, Items: []ConfigItemLabels{}}
+	if err := requestDB(c).Joins("JOIN project_compliance_labels ON project_compliance_labels.label_id = compliance_labels.id").
+		Where("project_compliance_labels.project_id = ?", projectID).Order("name").Find(&response.Labels).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch compliance labels")
+		return
+	}
+
+	labels, err := loadProjectLabels(requestDB(c), projectID)
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch compliance labels")
+		return
+	}
+
+	var items []models.ConfigItem
+	if err := requestDB(c).Select("id, name").Where("project_id = ?", projectID).Order("position asc").Find(&items).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch config items")
+		return
+	}
+	for _, item := range items {
+		response.Items = append(response.Items, ConfigItemLabels{ID: item.ID, Name: item.Name, Labels: labels.item(item.ID)})
+	}
+
+	RespondOK(c, response)
+}
+
+// SetProjectComplianceLabels replaces the labels of a project
+func SetProjectComplianceLabels(c *gin.Context) {
+	var req SetComplianceLabelsRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	access := CurrentProjectAccess(c)
+	project := access.Project
+
+	labels, ok := requireComplianceLabels(c, project.OrganizationID, req.LabelIDs)
+	if !ok {
+		return
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Where("project_id = ?", project.ID).Delete(&models.ProjectComplianceLabel{}).Error; err != nil {
+			return err
+		}
+		for _, label := range labels {
+			if err := tx.Create(&models.ProjectComplianceLabel{ProjectID: project.ID, LabelID: label.ID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to update compliance labels")
+		return
+	}
+
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	RespondOK(c, labels)
+}
+
+// SetConfigItemComplianceLabels replaces the labels of a config item. Labels the
+// item inherits from its project are set on the project.
+func SetConfigItemComplianceLabels(c *gin.Context) {
+	var req SetComplianceLabelsRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	itemID, ok := ParseUUIDParam(c, "itemId", "config item")
+	if !ok {
+		return
+	}
+
+	access := CurrentProjectAccess(c)
+	project := access.Project
+
+	var item models.ConfigItem
+	if err := requestDB(c).Select("id").Where("id = ? AND project_id = ?", itemID, project.ID).First(&item).Error; err != nil {
+		RespondNotFound(c, "Config item not found")
+		return
+	}
+
+	labels, ok := requireComplianceLabels(c, project.OrganizationID, req.LabelIDs)
+	if !ok {
+		return
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Where("config_item_id = ?", item.ID).Delete(&models.ConfigItemComplianceLabel{}).Error; err != nil {
+			return err
+		}
+		for _, label := range labels {
+			if err := tx.Create(&models.ConfigItemComplianceLabel{ConfigItemID: item.ID, LabelID: label.ID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to update compliance labels")
+		return
+	}
+
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	RespondOK(c, labels)
+}
+
+// GetComplianceReport lists, for each label of the organization, the projects
+// and config items carrying it
+func GetComplianceReport(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	var labels []models.ComplianceLabel
+	if err := requestDB(c).Where("organization_id = ?", orgID).Order("name").Find(&labels).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch compliance labels")
+		return
+	}
+
+	var rows []struct {
+		LabelID     uuid.UUID
+		ProjectID   uuid.UUID
+		ProjectName string
+		ItemName    *string // nil when the project itself is labelled
+	}
+	err := requestDB(c).Raw(`
+		SELECT project_compliance_labels.label_id, projects.id AS project_id, projects.name AS project_name, NULL AS item_name
+		FROM project_compliance_labels
+		JOIN projects ON projects.id = project_compliance_labels.project_id
+		WHERE projects.organization_id = ? AND projects.deleted_at IS NULL
+
+		UNION ALL
+
+		SELECT config_item_compliance_labels.label_id, projects.id, projects.name, config_items.name
+		FROM config_item_compliance_labels
+		JOIN config_items ON config_items.id = config_item_compliance_labels.config_item_id
+		JOIN projects ON projects.id = config_items.project_id
+		WHERE projects.organization_id = ? AND projects.deleted_at IS NULL AND config_items.deleted_at IS NULL
+
+		ORDER BY project_name, project_id, item_name
+	`, orgID, orgID).Scan(&rows).Error
+	if err != nil {
+		RespondInternalError(c, "Failed to build compliance report")
+		return
+	}
+
+	report := make([]ComplianceReportEntry, len(labels))
+	entries := map[uuid.UUID]*ComplianceReportEntry{}
+	for i, label := range labels {
+		report[i] = ComplianceReportEntry{Label: label, Projects: []ComplianceReportProject{}}
+		entries[label.ID] = &report[i]
+	}
+	for _, row := range rows {
+		entry := entries[row.LabelID]
+		if entry == nil {
+			continue
+		}
+		n := len(entry.Projects)
+		if n == 0 || entry.Projects[n-1].ID != row.ProjectID {
+			entry.Projects = append(entry.Projects, ComplianceReportProject{ID: row.ProjectID, Name: row.ProjectName, ItemNames: []string{}})
+			n++
+		}
+		if row.ItemName == nil {
+			entry.Projects[n-1].Labelled = true
+		} else {
+			entry.Projects[n-1].ItemNames = append(entry.Projects[n-1].ItemNames, *row.ItemName)
+		}
+	}
+
+	RespondOK(c, report)
+}
+
+// GetProjectKeyHolders lists who can decrypt the project key: members of its
+// teams holding the team key, members holding the organization key, and active
+// CLI tokens, along with the project's labels
+func GetProjectKeyHolders(c *gin.Context) {
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID
+
+	project := access.Project
+
+	labels, err := loadProjectLabels(requestDB(c), projectID)
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch compliance labels")
+		return
+	}
+
+	var rows []struct {
+		UserID   uuid.UUID
+		Name     string
+		Email    string
+		TeamName *string // nil for organization key holders
+	}
+	err = requestDB(c).Raw(`
+		SELECT users.id AS user_id, users.name, users.email, teams.name AS team_name
+		FROM team_projects
+		JOIN teams ON teams.id = team_projects.team_id AND teams.deleted_at IS NULL
+		JOIN team_users ON team_users.team_id = teams.id AND team_users.encrypted_team_key <> ''
+		JOIN users ON users.id = team_users.user_id
+		WHERE team_projects.project_id = ?
+
+		UNION ALL
+
+		SELECT users.id, users.name, users.email, NULL
+		FROM organization_users
+		JOIN users ON users.id = organization_users.user_id
+		WHERE organization_users.organization_id = ? AND organization_users.encrypted_organization_key IS NOT NULL
+	`, projectID, project.OrganizationID).Scan(&rows).Error
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch key holders")
+		return
+	}
+
+	response := ProjectKeyHoldersResponse{
+		ProjectID:  project.ID,
+		KeyVersion: project.KeyVersion,
+		Labels:     labels.project,
+		Users:      []KeyHolder{},
+		Tokens:     []KeyHolderToken{},
+	}
+	index := map[uuid.UUID]int{}
+	for _, row := range rows {
+		i, seen := index[row.UserID]
+		if !seen {
+			i = len(response.Users)
+			index[row.UserID] = i
+			response.Users = append(response.Users, KeyHolder{UserID: row.UserID, Name: row.Name, Email: row.Email, ViaTeams: []string{}})
+		}
+		if row.TeamName == nil {
+			response.Users[i].ViaOrganizationKey = true
+		} else {
+			response.Users[i].ViaTeams = append(response.Users[i].ViaTeams, *row.TeamName)
+		}
+	}
+	sort.Slice(response.Users, func(i, j int) bool { return response.Users[i].Email < response.Users[j].Email })
+	for i := range response.Users {
+		sort.Strings(response.Users[i].ViaTeams)
+	}
+
+	if err := requestDB(c).Model(&models.ProjectToken{}).
+		Where("project_id = ? AND (expires_at IS NULL OR expires_at > ?)", projectID, time.Now()).
+		Order("name").Scan(&response.Tokens).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch project tokens")
+		return
+	}
+
+	RespondOK(c, response)
+}
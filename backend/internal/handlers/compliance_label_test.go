@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestProjectLabelsInheritance(t *testing.T) {
+	tagged, untagged := uuid.New(), uuid.New()
+	labels := projectLabels{
+		project: []string{"internal-only", "PCI"},
+		items:   map[uuid.UUID][]string{tagged: {"PCI", "HIPAA"}},
+	}
+
+	if got, want := labels.item(tagged), []string{"HIPAA", "PCI", "internal-only"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("item labels = %v, want %v", got, want)
+	}
+	if got, want := labels.item(untagged), []string{"PCI", "internal-only"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("inherited labels = %v, want %v", got, want)
+	}
+	if !labels.has(untagged, "PCI") || labels.has(untagged, "HIPAA") || labels.has(tagged, "pci") {
+		t.Error("has doesn't match the exact label names of the item")
+	}
+
+	if got := (projectLabels{}).item(untagged); got == nil || len(got) != 0 {
+		t.Errorf("unlabelled item = %#v, want an empty list", got)
+	}
+}
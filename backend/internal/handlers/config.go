@@ -1,11 +1,15 @@
 package handlers
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
+	"envie-backend/internal/apitime"
+	"envie-backend/internal/configwatch"
+	"envie-backend/internal/crypto"
 	"envie-backend/internal/database"
 	"envie-backend/internal/models"
 
@@ -14,87 +18,321 @@ import (
 	"gorm.io/gorm"
 )
 
-func computeConfigChecksum(items []models.ConfigItem) string {
-	var lines []string
-	for _, item := range items {
-		lines = append(lines, item.Name+"="+item.Value)
+// configChange describes a write to a project's config for its activity timeline
+type configChange struct {
+	ActorID uuid.UUID
+	Detail  string
+	Count   int // items written or deleted
+}
+
+// updateConfigChecksum recomputes the project's config checksum inside a
+// transaction. When the checksum moves, the change is recorded in the audit log
+// with the checksums before and after.
+func updateConfigChecksum(tx *gorm.DB, projectID uuid.UUID, change configChange) error {
+	var project models.Project
+	if err := tx.Select("id, organization_id, config_checksum, legacy_config_checksum").First(&project, "id = ?", projectID).Error; err != nil {
+		return err
+	}
+
+	var items []models.ConfigItem
+	if err := tx.Where("project_id = ?", projectID).Order("position asc").Find(&items).Error; err != nil {
+		return err
 	}
 
-	content := strings.Join(lines, "\n")
-	hash := sha256.Sum256([]byte(content))
-	return hex.EncodeToString(hash[:])
+	checksum, legacy := models.ConfigChecksum(items), models.LegacyConfigChecksum(items)
+	if project.ConfigChecksum != nil && *project.ConfigChecksum == checksum &&
+		project.LegacyConfigChecksum != nil && *project.LegacyConfigChecksum == legacy {
+		return nil
+	}
+	if err := tx.Model(&models.Project{}).Where("id = ?", projectID).Updates(map[string]interface{}{
+		"config_checksum":        checksum,
+		"legacy_config_checksum": legacy,
+	}).Error; err != nil {
+		return err
+	}
+	if project.ConfigChecksum != nil && *project.ConfigChecksum == checksum {
+		return nil // only the legacy checksum was missing
+	}
+	return tx.Create(&models.AuditEvent{
+		OrganizationID: project.OrganizationID,
+		ProjectID:      &projectID,
+		ActorID:        change.ActorID,
+		Action:         models.AuditConfigSynced,
+		Detail:         change.Detail,
+		Count:          change.Count,
+		ChecksumBefore: project.ConfigChecksum,
+		ChecksumAfter:  &checksum,
+	}).Error
 }
 func GetConfigItems(c *gin.Context) {
-	projectID := c.Param("id")
-	if projectID == "" {
-		RespondBadRequest(c, "Project ID required")
-		return
-	}
+	access := CurrentProjectAccess(c)
+	projectUUID := access.Project.ID
 
-	userID, ok := GetAuthUserID(c)
+	fields, ok := RequestedFields(c, models.ConfigItem{})
 	if !ok {
 		return
 	}
 
-	if err := CheckProjectAccessSimple(userID, projectID); err != nil {
-		RespondForbidden(c, "Project not found or access denied")
+	db := requestDB(c)
+	label := c.Query("label")
+	var labels *projectLabels
+	if label != "" {
+		loaded, err := loadProjectLabels(db, projectUUID)
+		if err != nil {
+			RespondInternalError(c, "Failed to fetch compliance labels")
+			return
+		}
+		labels = &loaded
+	}
+	users, err := configItemUsers(db, projectUUID, fields)
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch config items")
 		return
 	}
 
-	var items []models.ConfigItem
-	if err := database.DB.Preload("Creator").Preload("Updater").Where("project_id = ?", projectID).Order("position asc").Find(&items).Error; err != nil {
+	// Streamed from the cursor, a project can have thousands of items
+	rows, err := db.Model(&models.ConfigItem{}).Where("project_id = ?", projectUUID).Order("position asc").Rows()
+	if err != nil {
 		RespondInternalError(c, "Failed to fetch config items")
 		return
 	}
+	defer rows.Close()
+
+	stream := startJSONArray(c, fields)
+	for rows.Next() {
+		var item models.ConfigItem
+		if err := db.ScanRows(rows, &item); err != nil {
+			stream.Close(err)
+			return
+		}
+		if labels != nil && !labels.has(item.ID, label) {
+			continue
+		}
+		if fields.Has("creator") {
+			item.Creator = users[item.CreatedBy]
+		}
+		if fields.Has("updater") {
+			item.Updater = users[item.UpdatedBy]
+		}
+		if access.MasksSensitive() {
+			maskSensitiveItem(&item)
+		}
+		if err := stream.Write(&item); err != nil {
+			stream.Close(err)
+			return
+		}
+	}
+	stream.Close(rows.Err())
+}
+
+// configItemUsers loads the creators and updaters of the project's items when
+// the response includes them, in place of preloading them per item
+func configItemUsers(db *gorm.DB, projectID uuid.UUID, fields FieldSet) (map[uuid.UUID]models.User, error) {
+	users := map[uuid.UUID]models.User{}
+	if !fields.Has("creator") && !fields.Has("updater") {
+		return users, nil
+	}
+
+	items := db.Model(&models.ConfigItem{}).Where("project_id = ?", projectID)
+	var list []models.User
+	if err := db.Where("id IN (?) OR id IN (?)", items.Select("created_by"), items.Session(&gorm.Session{}).Select("updated_by")).
+		Find(&list).Error; err != nil {
+		return nil, err
+	}
+	for _, user := range list {
+		users[user.ID] = user
+	}
+	return users, nil
+}
+
+// maskSensitiveItem omits the value of the item if it is sensitive
+func maskSensitiveItem(item *models.ConfigItem) {
+	if item.Sensitive {
+		item.Value = ""
+		item.Masked = true
+	}
+}
 
-	RespondOK(c, items)
+func maskSensitiveItems(items []models.ConfigItem) {
+	for i := range items {
+		maskSensitiveItem(&items[i])
+	}
+}
+
+// keepMaskedValues restores the stored values of sensitive items a user who can't
+// read them synced back masked or empty. Such a user may replace these values but
+// not unmark the items, which would reveal them.
+func keepMaskedValues(items, existing []models.ConfigItem) error {
+	stored := make(map[uuid.UUID]*models.ConfigItem, len(existing))
+	for i := range existing {
+		stored[existing[i].ID] = &existing[i]
+	}
+	for i := range items {
+		current, ok := stored[items[i].ID]
+		if !ok || !current.Sensitive {
+			continue
+		}
+		if !items[i].Sensitive {
+			return &ValidationError{Message: "Only members with " + models.PermissionSecretsReveal + " can unmark the sensitive item " + current.Name}
+		}
+		if items[i].Masked || items[i].Value == "" {
+			items[i].Value = current.Value
+		}
+	}
+	return nil
+}
+
+// validateEncryptedBlob rejects versioned blobs with an unknown algorithm, so data no
+// client can decrypt is never stored. Legacy blobs are opaque and accepted as is.
+func validateEncryptedBlob(encoded string) error {
+	if !crypto.IsVersionedBlob(encoded) {
+		return nil
+	}
+	_, _, err := crypto.DecodeBlob(encoded, 0)
+	return err
 }
 
 type SyncConfigItemRequest struct {
-	Items []models.ConfigItem `json:"items"`
+	Items []SyncConfigItem `json:"items"`
+	// ExpectedChecksum is the checksum of the config the client edited. When set,
+	// the sync fails with 412 if the config has changed since.
+	ExpectedChecksum string `json:"expectedChecksum,omitempty"`
+}
+
+type SyncConfigItemsResponse struct {
+	Message string `json:"message"`
+	// Variables of the project's schema the synced config lacks. The sync is saved
+	// regardless.
+	MissingVariables []string `json:"missingVariables,omitempty"`
+}
+
+// SyncConfigItem is a config item in a sync request, with its timestamps in any
+// format apitime accepts
+type SyncConfigItem struct {
+	models.ConfigItem
+	ExpiresAt               *apitime.Time `json:"expiresAt"`
+	SecretManagerLastSyncAt *apitime.Time `json:"secretManagerLastSyncAt"`
+}
+
+func (r SyncConfigItemRequest) configItems() []models.ConfigItem {
+	items := make([]models.ConfigItem, len(r.Items))
+	for i, item := range r.Items {
+		items[i] = item.ConfigItem
+		items[i].ExpiresAt = item.ExpiresAt.Ptr()
+		items[i].SecretManagerLastSyncAt = item.SecretManagerLastSyncAt.Ptr()
+		if items[i].ValueType == "" {
+			items[i].ValueType = models.VariableTypeString
+		}
+	}
+	return items
 }
 
 func SyncConfigItems(c *gin.Context) {
-	projectId, ok := ParseUUIDParam(c, "id", "project")
+	userID, ok := GetAuthUserID(c)
 	if !ok {
 		return
 	}
 
-	userID, ok := GetAuthUserID(c)
-	if !ok {
+	access := CurrentProjectAccess(c)
+	projectId := access.Project.ID
+
+	var req SyncConfigItemRequest
+	if !BindJSON(c, &req) {
 		return
 	}
 
-	if err := CheckProjectAccessSimple(userID, projectId.String()); err != nil {
-		RespondForbidden(c, "Project not found or access denied")
+	items := req.configItems()
+	if !checkConfigItems(c, access, items) {
+		return
+	}
+	if req.ExpectedChecksum != "" && !checksumPattern.MatchString(req.ExpectedChecksum) {
+		RespondBadRequest(c, "expectedChecksum must be a config checksum")
 		return
 	}
 
-	var req SyncConfigItemRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		RespondBadRequest(c, err.Error())
+	var existingItems []models.ConfigItem
+	if err := requestDB(c).Where("project_id = ?", projectId).Find(&existingItems).Error; err != nil {
+		RespondInternalError(c, "Sync failed: "+err.Error())
 		return
 	}
 
-	nameMap := make(map[string]bool)
-	for _, item := range req.Items {
-		if nameMap[item.Name] {
-			RespondBadRequest(c, "Duplicate config key name: "+item.Name)
+	if access.MasksSensitive() {
+		if err := keepMaskedValues(items, existingItems); err != nil {
+			RespondForbidden(c, err.Error())
 			return
 		}
-		nameMap[item.Name] = true
 	}
 
-	var existingItems []models.ConfigItem
-	if err := database.DB.Where("project_id = ?", projectId).Find(&existingItems).Error; err != nil {
+	sync := planConfigSync(projectId, userID, items, existingItems)
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if req.ExpectedChecksum != "" {
+			if err := expectConfigChecksum(tx, projectId, req.ExpectedChecksum); err != nil {
+				return err
+			}
+		}
+		return sync.apply(tx, access.Project, userID, "Before sync", sync.summary())
+	})
+
+	if errors.Is(err, errConfigChecksumMismatch) {
+		RespondError(c, http.StatusPreconditionFailed, errConfigChecksumMismatch.Error())
+		return
+	}
+	if err != nil {
 		RespondInternalError(c, "Sync failed: "+err.Error())
 		return
 	}
 
-	var itemsToSave []models.ConfigItem
-	var itemsToDelete []uuid.UUID
+	configwatch.Publish(projectId)
+
+	response := SyncConfigItemsResponse{Message: "Config synced successfully"}
+	if schema, err := loadProjectSchema(requestDB(c), projectId); err == nil {
+		response.MissingVariables = missingSchemaVariables(schema, items)
+	}
+	RespondOK(c, response)
+}
+
+// checkConfigItems answers 400 or 409 unless items are a valid config for the
+// project: unique names, known value types and well-formed encrypted values
+func checkConfigItems(c *gin.Context, access *ProjectAccess, items []models.ConfigItem) bool {
+	nameMap := make(map[string]bool)
+	for _, item := range items {
+		if nameMap[item.Name] {
+			RespondBadRequest(c, "Duplicate config key name: "+item.Name)
+			return false
+		}
+		nameMap[item.Name] = true
+
+		if !models.IsVariableType(item.ValueType) {
+			RespondBadRequest(c, "Invalid value type for "+item.Name+": must be one of "+strings.Join(models.VariableTypes, ", "))
+			return false
+		}
+
+		if err := validateEncryptedBlob(item.Value); err != nil {
+			RespondBadRequest(c, "Invalid encrypted value for "+item.Name+": "+err.Error())
+			return false
+		}
+
+		if access.Project.Sandbox && item.SecretManagerConfigID != nil {
+			RespondConflict(c, "Sandbox projects can't link secret manager configurations: "+item.Name)
+			return false
+		}
+	}
+	return true
+}
+
+// configSync is the writes that turn a project's config into a synced one
+type configSync struct {
+	existing []models.ConfigItem
+	save     []models.ConfigItem
+	delete   []uuid.UUID
+}
+
+// planConfigSync compares the synced items with the existing ones by ID: items
+// that differ or are new are saved, existing items left out are deleted
+func planConfigSync(projectId, userID uuid.UUID, items, existingItems []models.ConfigItem) configSync {
+	sync := configSync{existing: existingItems}
 
-	for _, item := range req.Items {
+	for _, item := range items {
 		var foundExistingItem *models.ConfigItem
 		for _, existingItem := range existingItems {
 			if existingItem.ID == item.ID {
@@ -137,6 +375,8 @@ func SyncConfigItems(c *gin.Context) {
 				item.Value != foundExistingItem.Value ||
 				item.Sensitive != foundExistingItem.Sensitive ||
 				item.Position != foundExistingItem.Position ||
+				item.ValueType != foundExistingItem.ValueType ||
+				item.HasReferences != foundExistingItem.HasReferences ||
 				strPtrDiffers(item.Category, foundExistingItem.Category) ||
 				strPtrDiffers(item.Description, foundExistingItem.Description) ||
 				timePtrDiffers(item.ExpiresAt, foundExistingItem.ExpiresAt) ||
@@ -146,13 +386,15 @@ func SyncConfigItems(c *gin.Context) {
 				uuidPtrDiffers(item.SecretManagerConfigID, foundExistingItem.SecretManagerConfigID)
 
 			if differs {
-				itemsToSave = append(itemsToSave, models.ConfigItem{
+				sync.save = append(sync.save, models.ConfigItem{
 					ID:                      foundExistingItem.ID,
 					ProjectID:               foundExistingItem.ProjectID,
 					Name:                    item.Name,
 					Value:                   item.Value,
 					Sensitive:               item.Sensitive,
 					Position:                item.Position,
+					ValueType:               item.ValueType,
+					HasReferences:           item.HasReferences,
 					Category:                item.Category,
 					Description:             item.Description,
 					ExpiresAt:               item.ExpiresAt,
@@ -167,12 +409,14 @@ func SyncConfigItems(c *gin.Context) {
 				})
 			}
 		} else {
-			itemsToSave = append(itemsToSave, models.ConfigItem{
+			sync.save = append(sync.save, models.ConfigItem{
 				ProjectID:               projectId,
 				Name:                    item.Name,
 				Value:                   item.Value,
 				Sensitive:               item.Sensitive,
 				Position:                item.Position,
+				ValueType:               item.ValueType,
+				HasReferences:           item.HasReferences,
 				Category:                item.Category,
 				Description:             item.Description,
 				ExpiresAt:               item.ExpiresAt,
@@ -190,48 +434,49 @@ func SyncConfigItems(c *gin.Context) {
 
 	for _, existingItem := range existingItems {
 		var foundItem *models.ConfigItem
-		for _, item := range req.Items {
+		for _, item := range items {
 			if item.ID == existingItem.ID {
 				foundItem = &existingItem
 				break
 			}
 		}
 		if foundItem == nil {
-			itemsToDelete = append(itemsToDelete, existingItem.ID)
+			sync.delete = append(sync.delete, existingItem.ID)
 		}
 	}
+	return sync
+}
 
-	err := database.DB.Transaction(func(tx *gorm.DB) error {
-
-		if len(itemsToSave) > 0 {
-			if err := tx.Save(&itemsToSave).Error; err != nil {
-				return err
-			}
-		}
+func (s configSync) summary() string {
+	return fmt.Sprintf("%d items saved, %d deleted", len(s.save), len(s.delete))
+}
 
-		if len(itemsToDelete) > 0 {
-			if err := tx.Unscoped().Delete(&[]models.ConfigItem{}, itemsToDelete).Error; err != nil {
-				return err
-			}
+// apply writes the sync in tx, snapshotting the existing config under
+// snapshotName first when anything changes, and records detail in the project's
+// activity
+func (s configSync) apply(tx *gorm.DB, project *models.Project, userID uuid.UUID, snapshotName, detail string) error {
+	if len(s.save) > 0 || len(s.delete) > 0 {
+		if _, err := takeConfigSnapshot(tx, project.ID, project.KeyVersion, userID, snapshotName, models.SnapshotSync, s.existing); err != nil {
+			return err
 		}
+	}
 
-		var finalItems []models.ConfigItem
-		if err := tx.Where("project_id = ?", projectId).Order("position asc").Find(&finalItems).Error; err != nil {
+	if len(s.save) > 0 {
+		if err := tx.Save(&s.save).Error; err != nil {
 			return err
 		}
+	}
 
-		checksum := computeConfigChecksum(finalItems)
-		if err := tx.Model(&models.Project{}).Where("id = ?", projectId).Update("config_checksum", checksum).Error; err != nil {
+	if len(s.delete) > 0 {
+		// Kept in the trash until purged, see GetConfigTrash
+		if err := tx.Delete(&[]models.ConfigItem{}, s.delete).Error; err != nil {
 			return err
 		}
-
-		return nil
-	})
-
-	if err != nil {
-		RespondInternalError(c, "Sync failed: "+err.Error())
-		return
 	}
 
-	RespondMessage(c, "Config synced successfully")
+	return updateConfigChecksum(tx, project.ID, configChange{
+		ActorID: userID,
+		Detail:  detail,
+		Count:   len(s.save) + len(s.delete),
+	})
 }
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"envie-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const legacyChecksumsUntilEnv = "LEGACY_CONFIG_CHECKSUMS_UNTIL"
+
+// errConfigChecksumMismatch is a write based on a config that has changed since
+var errConfigChecksumMismatch = errors.New("the config has changed since the expected checksum; fetch it again and retry")
+
+// defaultLegacyChecksumsUntil closes the migration window to version 2 config
+// checksums about six months after they were introduced
+var defaultLegacyChecksumsUntil = time.Date(2027, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+// LegacyChecksumsUntil is when the server stops serving and accepting version 1
+// config checksums, set from LEGACY_CONFIG_CHECKSUMS_UNTIL at startup
+var LegacyChecksumsUntil = defaultLegacyChecksumsUntil
+
+// LegacyChecksumsUntilFromEnv reads LEGACY_CONFIG_CHECKSUMS_UNTIL, a date such as
+// 2027-04-01 or an RFC 3339 time. Unset means 2027-04-01; a past date ends the
+// migration window.
+func LegacyChecksumsUntilFromEnv() (time.Time, error) {
+	value := os.Getenv(legacyChecksumsUntilEnv)
+	if value == "" {
+		return defaultLegacyChecksumsUntil, nil
+	}
+	if until, err := time.Parse(time.DateOnly, value); err == nil {
+		return until, nil
+	}
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s %q", legacyChecksumsUntilEnv, value)
+	}
+	return until, nil
+}
+
+// legacyChecksumsServed reports whether the migration window is open
+func legacyChecksumsServed() bool {
+	return time.Now().Before(LegacyChecksumsUntil)
+}
+
+// legacyConfigChecksum is the project's config checksum in version 1 while the
+// migration window is open, empty after. The project must have been loaded with
+// legacy_config_checksum.
+func legacyConfigChecksum(project *models.Project) string {
+	if !legacyChecksumsServed() || project.LegacyConfigChecksum == nil {
+		return ""
+	}
+	return *project.LegacyConfigChecksum
+}
+
+// currentChecksum translates a checksum a client sent to the project's current
+// config checksum when it is the current config's version 1 checksum, so clients
+// that haven't moved to version 2 aren't told the config changed. Other checksums
+// are returned as they are.
+func currentChecksum(project *models.Project, checksum string) string {
+	if checksum != "" && project.ConfigChecksum != nil && checksum == legacyConfigChecksum(project) {
+		return *project.ConfigChecksum
+	}
+	return checksum
+}
+
+// expectConfigChecksum returns errConfigChecksumMismatch unless expected is the
+// checksum of the project's config, in either version during the migration
+// window. The check is a conditional update of the project row, which holds its
+// lock until tx ends: a concurrent sync expecting the same checksum waits for tx
+// and then sees the checksum tx wrote.
+func expectConfigChecksum(tx *gorm.DB, projectID uuid.UUID, expected string) error {
+	query := tx.Model(&models.Project{}).Where("id = ?", projectID)
+	if legacyChecksumsServed() {
+		query = query.Where("config_checksum = ? OR legacy_config_checksum = ?", expected, expected)
+	} else {
+		query = query.Where("config_checksum = ?", expected)
+	}
+	result := query.UpdateColumn("config_checksum", gorm.Expr("config_checksum"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errConfigChecksumMismatch
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestConfigChecksumFormat(t *testing.T) {
+	// The CLI's smoke check computes the same checksum
+	items := []models.ConfigItem{{Name: "A", Value: "x"}, {Name: "B", Value: "y\nz"}}
+	if got, want := models.ConfigChecksum(items), "4c4820abcea6b7725146144d70c1ca12edef93776f5d5ee7b484290ab41fc561"; got != want {
+		t.Errorf("ConfigChecksum = %s, want %s", got, want)
+	}
+
+	one := []models.ConfigItem{{Name: "A", Value: "x\nB=y"}}
+	two := []models.ConfigItem{{Name: "A", Value: "x"}, {Name: "B", Value: "y"}}
+	if models.LegacyConfigChecksum(one) != models.LegacyConfigChecksum(two) || models.ConfigChecksum(one) == models.ConfigChecksum(two) {
+		t.Error("only the legacy checksum should confuse a newline in a value with two items")
+	}
+}
+
+func TestSyncExpectedChecksum(t *testing.T) {
+	f := newAccessFixture(t)
+	db := database.DB
+	defer func(until time.Time) { LegacyChecksumsUntil = until }(LegacyChecksumsUntil)
+	LegacyChecksumsUntil = time.Now().Add(time.Hour)
+
+	item := models.ConfigItem{ID: uuid.New(), ProjectID: f.project.ID, Name: "A", Value: "YQ==", CreatedBy: f.admin.ID, UpdatedBy: f.admin.ID}
+	db.Create(&item)
+	if err := updateConfigChecksum(db, f.project.ID, configChange{ActorID: f.admin.ID}); err != nil {
+		t.Fatal(err)
+	}
+	items := []models.ConfigItem{item}
+	checksum, legacy := models.ConfigChecksum(items), models.LegacyConfigChecksum(items)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", f.admin.ID) })
+	r.PUT("/projects/:id/config", AuthorizeProject(models.PermissionConfigWrite), SyncConfigItems)
+	sync := func(value, expected string) int {
+		body := `{"items":[{"id":"` + item.ID.String() + `","name":"A","value":"` + value + `"}],"expectedChecksum":"` + expected + `"}`
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("PUT", "/projects/"+f.project.ID.String()+"/config", strings.NewReader(body)))
+		return w.Code
+	}
+
+	if code := sync("Yg==", "stale"); code != http.StatusBadRequest {
+		t.Errorf("malformed expected checksum = %d", code)
+	}
+	if code := sync("Yg==", strings.Repeat("0", 64)); code != http.StatusPreconditionFailed {
+		t.Errorf("sync against another config = %d", code)
+	}
+	// A client still on version 1 checksums
+	if code := sync("Yg==", legacy); code != http.StatusOK {
+		t.Errorf("sync expecting the legacy checksum = %d", code)
+	}
+	// The config moved on from checksum
+	if code := sync("Yw==", checksum); code != http.StatusPreconditionFailed {
+		t.Errorf("sync expecting the previous checksum = %d", code)
+	}
+
+	var project models.Project
+	db.First(&project, "id = ?", f.project.ID)
+	LegacyChecksumsUntil = time.Now()
+	if code := sync("Yw==", *project.LegacyConfigChecksum); code != http.StatusPreconditionFailed {
+		t.Errorf("legacy checksum accepted after the migration window = %d", code)
+	}
+	if code := sync("Yw==", *project.ConfigChecksum); code != http.StatusOK {
+		t.Errorf("sync expecting the current checksum = %d", code)
+	}
+}
+
+// Syncs racing on the same expected checksum: one wins, the others are told the
+// config changed rather than overwriting it
+func TestSyncExpectedChecksumConcurrent(t *testing.T) {
+	f := newAccessFixture(t)
+	db := database.DB
+
+	item := models.ConfigItem{ID: uuid.New(), ProjectID: f.project.ID, Name: "A", Value: "YQ==", CreatedBy: f.admin.ID, UpdatedBy: f.admin.ID}
+	db.Create(&item)
+	if err := updateConfigChecksum(db, f.project.ID, configChange{ActorID: f.admin.ID}); err != nil {
+		t.Fatal(err)
+	}
+	checksum := models.ConfigChecksum([]models.ConfigItem{item})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", f.admin.ID) })
+	r.PUT("/projects/:id/config", AuthorizeProject(models.PermissionConfigWrite), SyncConfigItems)
+
+	values := []string{"Yg==", "Yw==", "ZA==", "ZQ==", "Zg=="}
+	codes := make([]int, len(values))
+	var wg sync.WaitGroup
+	for i, value := range values {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := `{"items":[{"id":"` + item.ID.String() + `","name":"A","value":"` + value + `"}],"expectedChecksum":"` + checksum + `"}`
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("PUT", "/projects/"+f.project.ID.String()+"/config", strings.NewReader(body)))
+			codes[i] = w.Code
+		}()
+	}
+	wg.Wait()
+
+	winner := -1
+	for i, code := range codes {
+		switch code {
+		case http.StatusOK:
+			if winner >= 0 {
+				t.Errorf("syncs of %s and %s both applied", values[winner], values[i])
+			}
+			winner = i
+		case http.StatusPreconditionFailed:
+		default:
+			t.Errorf("sync of %s = %d", values[i], code)
+		}
+	}
+	if winner < 0 {
+		t.Fatalf("no sync applied: %v", codes)
+	}
+	var stored models.ConfigItem
+	db.First(&stored, "id = ?", item.ID)
+	if stored.Value != values[winner] {
+		t.Errorf("stored %s, but %s won", stored.Value, values[winner])
+	}
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"time"
+
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// currentConfigState names the project's config as it is now in diffs
+const currentConfigState = "current"
+
+var checksumPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+var (
+	errInvalidConfigState  = errors.New("from and to must be a snapshot ID, a config checksum or current")
+	errConfigStateNotFound = errors.New("no snapshot or current config matches")
+)
+
+// ConfigDiffState - one side of a diff: a snapshot, or the current config
+type ConfigDiffState struct {
+	SnapshotID   *uuid.UUID `json:"snapshotId,omitempty"`
+	SnapshotName string     `json:"snapshotName,omitempty"`
+	Checksum     string     `json:"checksum"`
+	KeyVersion   int        `json:"keyVersion"`
+	TakenAt      *time.Time `json:"takenAt,omitempty"`
+}
+
+// ConfigDiffChange - an item in both states, and which of its fields differ
+type ConfigDiffChange struct {
+	Name   string   `json:"name"`
+	Fields []string `json:"fields"`
+}
+
+// ConfigDiff - the config items added, removed and changed between two states,
+// by name. Values stay encrypted: a value differs when its ciphertext does, which
+// can't be told across a key rotation, so ValuesCompared is false then.
+type ConfigDiff struct {
+	From           ConfigDiffState    `json:"from"`
+	To             ConfigDiffState    `json:"to"`
+	ValuesCompared bool               `json:"valuesCompared"`
+	Added          []string           `json:"added"`
+	Removed        []string           `json:"removed"`
+	Changed        []ConfigDiffChange `json:"changed"`
+}
+
+// GetConfigDiff compares two states of the project's config, each a snapshot ID,
+// a config checksum or current
+func GetConfigDiff(c *gin.Context) {
+	respondConfigDiff(c, CurrentProjectAccess(c).Project.ID)
+}
+
+// GetCLIConfigDiff is GetConfigDiff for CLI tokens, e.g. to compare the last
+// export's checksum with the current config
+func GetCLIConfigDiff(c *gin.Context) {
+	_, projectID, ok := requireCLIProjectToken(c)
+	if !ok {
+		return
+	}
+	respondConfigDiff(c, projectID)
+}
+
+func respondConfigDiff(c *gin.Context, projectID uuid.UUID) {
+	to := c.DefaultQuery("to", currentConfigState)
+	diff, err := configDiff(requestDB(c), projectID, c.Query("from"), to)
+	var stateErr *configStateError
+	switch {
+	case errors.Is(err, errInvalidConfigState):
+		RespondBadRequest(c, errInvalidConfigState.Error())
+	case errors.As(err, &stateErr):
+		RespondNotFound(c, "No snapshot or current config matches "+stateErr.ref)
+	case err != nil:
+		RespondInternalError(c, "Failed to compare config")
+	default:
+		RespondOK(c, diff)
+	}
+}
+
+// configStateError is a state reference that couldn't be resolved
+type configStateError struct {
+	ref string
+	err error
+}
+
+func (e *configStateError) Error() string { return e.err.Error() + ": " + e.ref }
+func (e *configStateError) Unwrap() error { return e.err }
+
+// configDiff resolves from and to and compares their items
+func configDiff(db *gorm.DB, projectID uuid.UUID, from, to string) (*ConfigDiff, error) {
+	var project models.Project
+	if err := db.Select("id, key_version, config_checksum, legacy_config_checksum").First(&project, "id = ?", projectID).Error; err != nil {
+		return nil, err
+	}
+	fromState, fromItems, err := resolveConfigState(db, &project, from)
+	if err != nil {
+		return nil, err
+	}
+	toState, toItems, err := resolveConfigState(db, &project, to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := diffConfigItems(fromItems, toItems, fromState.KeyVersion == toState.KeyVersion)
+	diff.From, diff.To = fromState, toState
+	return diff, nil
+}
+
+// resolveConfigState loads the items of a state reference: current, a snapshot ID,
+// or a checksum of the current config or of a snapshot, the newest one when
+// several match. Version 1 checksums match during the migration window.
+func resolveConfigState(db *gorm.DB, project *models.Project, ref string) (ConfigDiffState, []models.ConfigSnapshotItem, error) {
+	checksum := ""
+	if project.ConfigChecksum != nil {
+		checksum = *project.ConfigChecksum
+	}
+	if ref == currentConfigState || (checksumPattern.MatchString(ref) && currentChecksum(project, ref) == checksum) {
+		var items []models.ConfigItem
+		if err := db.Where("project_id = ?", project.ID).Order("position asc").Find(&items).Error; err != nil {
+			return ConfigDiffState{}, nil, err
+		}
+		state := make([]models.ConfigSnapshotItem, len(items))
+		for i, item := range items {
+			state[i] = snapshotItem(item)
+		}
+		return ConfigDiffState{Checksum: models.ConfigChecksum(items), KeyVersion: project.KeyVersion}, state, nil
+	}
+
+	query := db.Where("project_id = ?", project.ID)
+	if id, err := uuid.Parse(ref); err == nil {
+		query = query.Where("id = ?", id)
+	} else if checksumPattern.MatchString(ref) {
+		if legacyChecksumsServed() {
+			query = query.Where("checksum = ? OR legacy_checksum = ?", ref, ref)
+		} else {
+			query = query.Where("checksum = ?", ref)
+		}
+		query = query.Order("created_at desc")
+	} else {
+		return ConfigDiffState{}, nil, &configStateError{ref: ref, err: errInvalidConfigState}
+	}
+	var snapshot models.ConfigSnapshot
+	err := query.First(&snapshot).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ConfigDiffState{}, nil, &configStateError{ref: ref, err: errConfigStateNotFound}
+	}
+	if err != nil {
+		return ConfigDiffState{}, nil, err
+	}
+	return ConfigDiffState{
+		SnapshotID:   &snapshot.ID,
+		SnapshotName: snapshot.Name,
+		Checksum:     snapshot.Checksum,
+		KeyVersion:   snapshot.KeyVersion,
+		TakenAt:      &snapshot.CreatedAt,
+	}, snapshot.Items, nil
+}
+
+// diffConfigItems compares two states by item name. Positions are left out, as
+// removing one item moves every item after it.
+func diffConfigItems(from, to []models.ConfigSnapshotItem, compareValues bool) *ConfigDiff {
+	diff := &ConfigDiff{
+		ValuesCompared: compareValues,
+		Added:          []string{},
+		Removed:        []string{},
+		Changed:        []ConfigDiffChange{},
+	}
+
+	before := make(map[string]models.ConfigSnapshotItem, len(from))
+	for _, item := range from {
+		before[item.Name] = item
+	}
+	after := make(map[string]bool, len(to))
+	for _, item := range to {
+		after[item.Name] = true
+		old, ok := before[item.Name]
+		if !ok {
+			diff.Added = append(diff.Added, item.Name)
+			continue
+		}
+		if fields := changedItemFields(old, item, compareValues); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, ConfigDiffChange{Name: item.Name, Fields: fields})
+		}
+	}
+	for _, item := range from {
+		if !after[item.Name] {
+			diff.Removed = append(diff.Removed, item.Name)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Name < diff.Changed[j].Name })
+	return diff
+}
+
+// changedItemFields lists the JSON names of the fields that differ between two
+// versions of an item
+func changedItemFields(a, b models.ConfigSnapshotItem, compareValues bool) []string {
+	var fields []string
+	if compareValues && a.Value != b.Value {
+		fields = append(fields, "value")
+	}
+	if a.Sensitive != b.Sensitive {
+		fields = append(fields, "sensitive")
+	}
+	if a.ValueType != b.ValueType {
+		fields = append(fields, "valueType")
+	}
+	if a.HasReferences != b.HasReferences {
+		fields = append(fields, "hasReferences")
+	}
+	if !equalPtr(a.Category, b.Category) {
+		fields = append(fields, "category")
+	}
+	if !equalPtr(a.Description, b.Description) {
+		fields = append(fields, "description")
+	}
+	if (a.ExpiresAt == nil) != (b.ExpiresAt == nil) || (a.ExpiresAt != nil && !a.ExpiresAt.Equal(*b.ExpiresAt)) {
+		fields = append(fields, "expiresAt")
+	}
+	if !equalPtr(a.SecretManagerConfigID, b.SecretManagerConfigID) || !equalPtr(a.SecretManagerName, b.SecretManagerName) {
+		fields = append(fields, "secretManager")
+	}
+	return fields
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestDiffConfigItems(t *testing.T) {
+	staging := "staging"
+	from := []models.ConfigSnapshotItem{
+		{Name: "KEPT", Value: "a"},
+		{Name: "EDITED", Value: "b"},
+		{Name: "RELABELED", Value: "c", ValueType: "string"},
+		{Name: "GONE", Value: "d"},
+	}
+	to := []models.ConfigSnapshotItem{
+		{Name: "NEW", Value: "e"},
+		{Name: "RELABELED", Value: "c", ValueType: "url", Category: &staging, Position: 5},
+		{Name: "EDITED", Value: "b2"},
+		{Name: "KEPT", Value: "a", Position: 3},
+	}
+
+	diff := diffConfigItems(from, to, true)
+	if !reflect.DeepEqual(diff.Added, []string{"NEW"}) || !reflect.DeepEqual(diff.Removed, []string{"GONE"}) {
+		t.Errorf("added %v, removed %v", diff.Added, diff.Removed)
+	}
+	want := []ConfigDiffChange{
+		{Name: "EDITED", Fields: []string{"value"}},
+		{Name: "RELABELED", Fields: []string{"valueType", "category"}},
+	}
+	if !reflect.DeepEqual(diff.Changed, want) {
+		t.Errorf("changed %+v, want %+v", diff.Changed, want)
+	}
+
+	// Across a key rotation every ciphertext differs
+	if diff := diffConfigItems(from, to, false); len(diff.Changed) != 1 || diff.Changed[0].Name != "RELABELED" {
+		t.Errorf("changed across a rotation %+v", diff.Changed)
+	}
+}
+
+func TestConfigDiffStates(t *testing.T) {
+	f := newAccessFixture(t)
+	db := database.DB
+
+	items := []models.ConfigItem{
+		{ID: uuid.New(), ProjectID: f.project.ID, Name: "A", Value: "YQ==", CreatedBy: f.member.ID, UpdatedBy: f.member.ID},
+		{ID: uuid.New(), ProjectID: f.project.ID, Name: "B", Value: "Yg==", Position: 1, CreatedBy: f.member.ID, UpdatedBy: f.member.ID},
+	}
+	db.Create(&items)
+	snapshot, err := takeConfigSnapshot(db, f.project.ID, f.project.KeyVersion, f.member.ID, "Tuesday", models.SnapshotManual, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Delete(&items[0])
+	db.Create(&models.ConfigItem{ProjectID: f.project.ID, Name: "C", Value: "Yw==", Position: 2, CreatedBy: f.member.ID, UpdatedBy: f.member.ID})
+	if err := updateConfigChecksum(db, f.project.ID, configChange{ActorID: f.member.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	// By snapshot ID and by its checksum, against the current config
+	for _, from := range []string{snapshot.ID.String(), snapshot.Checksum} {
+		diff, err := configDiff(db, f.project.ID, from, currentConfigState)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff.From.SnapshotID == nil || *diff.From.SnapshotID != snapshot.ID || diff.To.SnapshotID != nil {
+			t.Errorf("from %s resolved to %+v, %+v", from, diff.From, diff.To)
+		}
+		if !reflect.DeepEqual(diff.Added, []string{"C"}) || !reflect.DeepEqual(diff.Removed, []string{"A"}) || len(diff.Changed) != 0 {
+			t.Errorf("diff from %s: %+v", from, diff)
+		}
+	}
+
+	// The current checksum names the current config
+	current, err := configDiff(db, f.project.ID, currentConfigState, currentConfigState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reverse, err := configDiff(db, f.project.ID, current.To.Checksum, snapshot.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reverse.From.SnapshotID != nil || !reflect.DeepEqual(reverse.Added, []string{"A"}) {
+		t.Errorf("diff from the current checksum: %+v", reverse)
+	}
+
+	if _, err := configDiff(db, f.project.ID, "yesterday", currentConfigState); !errors.Is(err, errInvalidConfigState) {
+		t.Errorf("invalid reference: %v", err)
+	}
+	if _, err := configDiff(db, f.project.ID, uuid.NewString(), currentConfigState); !errors.Is(err, errConfigStateNotFound) {
+		t.Errorf("unknown snapshot: %v", err)
+	}
+}
@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"envie-backend/internal/configwatch"
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// errConfigDraftOutdated is an approval of a draft the live config or project key
+// moved on from
+var errConfigDraftOutdated = errors.New("the config changed since the draft was saved; its author must update it before it can be approved")
+
+// ConfigDraftRequest - a full config staged as a draft, in the shape of a sync
+type ConfigDraftRequest struct {
+	Title string           `json:"title" binding:"required,max=255"`
+	Items []SyncConfigItem `json:"items"`
+}
+
+// RejectConfigDraftRequest - why a draft was rejected
+type RejectConfigDraftRequest struct {
+	Reason string `json:"reason" binding:"max=1000"`
+}
+
+// ConfigDraftResponse - a draft with the items it adds, removes and changes in the
+// live config, by name. Outdated drafts were based on a live config or project
+// key that has changed since, and must be updated before they can be approved.
+type ConfigDraftResponse struct {
+	models.ConfigDraft
+	Added    []string           `json:"added"`
+	Removed  []string           `json:"removed"`
+	Changed  []ConfigDiffChange `json:"changed"`
+	Outdated bool               `json:"outdated"`
+}
+
+// GetConfigDrafts lists the project's drafts without their items, newest first.
+// status filters them, open by default, or all.
+func GetConfigDrafts(c *gin.Context) {
+	access := CurrentProjectAccess(c)
+	db := requestDB(c)
+
+	query := db.Preload("Author").Preload("Reviewer").Where("project_id = ?", access.Project.ID)
+	if status := c.DefaultQuery("status", models.DraftOpen); status != "all" {
+		query = query.Where("status = ?", status)
+	}
+	var drafts []models.ConfigDraft
+	if err := query.Order("created_at desc").Find(&drafts).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch config drafts")
+		return
+	}
+
+	live, checksum, err := liveConfigState(db, access.Project.ID)
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch config drafts")
+		return
+	}
+	response := make([]ConfigDraftResponse, len(drafts))
+	for i, draft := range drafts {
+		response[i] = configDraftResponse(draft, live, checksum, access.Project.KeyVersion)
+		response[i].Items = nil
+	}
+	RespondOK(c, response)
+}
+
+// GetConfigDraft returns a draft with its items, for clients to decrypt and review
+func GetConfigDraft(c *gin.Context) {
+	access := CurrentProjectAccess(c)
+	draft, ok := loadConfigDraft(c)
+	if !ok {
+		return
+	}
+
+	live, checksum, err := liveConfigState(requestDB(c), access.Project.ID)
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch config draft")
+		return
+	}
+	response := configDraftResponse(*draft, live, checksum, access.Project.KeyVersion)
+	if access.MasksSensitive() {
+		for i := range response.Items {
+			if response.Items[i].Sensitive {
+				response.Items[i].Value = ""
+				response.Items[i].Masked = true
+			}
+		}
+	}
+	RespondOK(c, response)
+}
+
+// CreateConfigDraft stages a full config for review, leaving the live config as
+// it is
+func CreateConfigDraft(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+	access := CurrentProjectAccess(c)
+
+	var req ConfigDraftRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	draft := models.ConfigDraft{ProjectID: access.Project.ID, Title: req.Title, Status: models.DraftOpen, CreatedBy: uid}
+	if !stageConfigDraft(c, access, &draft, req) {
+		return
+	}
+	if err := requestDB(c).Create(&draft).Error; err != nil {
+		RespondInternalError(c, "Failed to create config draft")
+		return
+	}
+
+	draft.Items = nil
+	RespondCreated(c, draft)
+}
+
+// UpdateConfigDraft replaces the title and items of an open draft by its author,
+// and bases it on the live config as it is now
+func UpdateConfigDraft(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+	access := CurrentProjectAccess(c)
+
+	draft, ok := loadOpenConfigDraft(c)
+	if !ok {
+		return
+	}
+	if draft.CreatedBy != uid {
+		RespondForbidden(c, "Only the author can update a draft")
+		return
+	}
+
+	var req ConfigDraftRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+	draft.Title = req.Title
+	if !stageConfigDraft(c, access, draft, req) {
+		return
+	}
+	if err := requestDB(c).Model(draft).Select("title", "items", "base_checksum", "key_version").Updates(draft).Error; err != nil {
+		RespondInternalError(c, "Failed to update config draft")
+		return
+	}
+
+	draft.Items = nil
+	RespondOK(c, draft)
+}
+
+// ApproveConfigDraft applies a draft to the live config in one transaction, as a
+// sync of its items would. The author can't approve their own draft.
+func ApproveConfigDraft(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID
+
+	draft, ok := loadOpenConfigDraft(c)
+	if !ok {
+		return
+	}
+	if draft.CreatedBy == uid {
+		RespondForbidden(c, "Cannot approve your own draft")
+		return
+	}
+
+	items := make([]models.ConfigItem, len(draft.Items))
+	for i, item := range draft.Items {
+		items[i] = restoredConfigItem(projectID, item, draft.CreatedBy)
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		var project models.Project
+		if err := tx.Select("id, key_version").First(&project, "id = ?", projectID).Error; err != nil {
+			return err
+		}
+		var existing []models.ConfigItem
+		if err := tx.Where("project_id = ?", projectID).Order("position asc").Find(&existing).Error; err != nil {
+			return err
+		}
+		if project.KeyVersion != draft.KeyVersion || models.ConfigChecksum(existing) != draft.BaseChecksum {
+			return errConfigDraftOutdated
+		}
+
+		// Items get the author as their last editor; the approver owns the change
+		sync := planConfigSync(projectID, draft.CreatedBy, items, existing)
+		detail := fmt.Sprintf("applied draft %s: %s", draft.Title, sync.summary())
+		if err := sync.apply(tx, access.Project, uid, "Before draft "+draft.Title, detail); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		result := tx.Model(&models.ConfigDraft{}).
+			Where("id = ? AND status = ?", draft.ID, models.DraftOpen).
+			Updates(map[string]interface{}{"status": models.DraftApplied, "reviewed_by": uid, "reviewed_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errConfigDraftOutdated
+		}
+		return nil
+	})
+	if errors.Is(err, errConfigDraftOutdated) {
+		RespondConflict(c, errConfigDraftOutdated.Error())
+		return
+	}
+	if err != nil {
+		RespondInternalError(c, "Failed to apply config draft")
+		return
+	}
+	configwatch.Publish(projectID)
+
+	RespondMessage(c, "Draft applied")
+}
+
+// RejectConfigDraft closes a draft without applying it
+func RejectConfigDraft(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	draft, ok := loadOpenConfigDraft(c)
+	if !ok {
+		return
+	}
+	if draft.CreatedBy == uid {
+		RespondForbidden(c, "Cannot reject your own draft; discard it instead")
+		return
+	}
+
+	var req RejectConfigDraftRequest
+	if c.Request.ContentLength > 0 && !BindJSON(c, &req) {
+		return
+	}
+	updates := map[string]interface{}{"status": models.DraftRejected, "reviewed_by": uid, "reviewed_at": time.Now()}
+	if req.Reason != "" {
+		updates["rejection_reason"] = req.Reason
+	}
+	if err := requestDB(c).Model(&models.ConfigDraft{}).Where("id = ?", draft.ID).Updates(updates).Error; err != nil {
+		RespondInternalError(c, "Failed to reject config draft")
+		return
+	}
+	RespondMessage(c, "Draft rejected")
+}
+
+// DiscardConfigDraft withdraws an open draft by its author
+func DiscardConfigDraft(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	draft, ok := loadOpenConfigDraft(c)
+	if !ok {
+		return
+	}
+	if draft.CreatedBy != uid {
+		RespondForbidden(c, "Only the author can discard a draft")
+		return
+	}
+	if err := requestDB(c).Model(&models.ConfigDraft{}).Where("id = ?", draft.ID).Update("status", models.DraftDiscarded).Error; err != nil {
+		RespondInternalError(c, "Failed to discard config draft")
+		return
+	}
+	RespondMessage(c, "Draft discarded")
+}
+
+// stageConfigDraft validates the items of req as a sync would and stores them in
+// draft, based on the live config. It responds and returns false when they're
+// invalid.
+func stageConfigDraft(c *gin.Context, access *ProjectAccess, draft *models.ConfigDraft, req ConfigDraftRequest) bool {
+	items := SyncConfigItemRequest{Items: req.Items}.configItems()
+	if !checkConfigItems(c, access, items) {
+		return false
+	}
+
+	var existing []models.ConfigItem
+	if err := requestDB(c).Where("project_id = ?", access.Project.ID).Order("position asc").Find(&existing).Error; err != nil {
+		RespondInternalError(c, "Failed to save config draft")
+		return false
+	}
+	if access.MasksSensitive() {
+		if err := keepMaskedValues(items, existing); err != nil {
+			RespondForbidden(c, err.Error())
+			return false
+		}
+	}
+
+	draft.BaseChecksum = models.ConfigChecksum(existing)
+	draft.KeyVersion = access.Project.KeyVersion
+	draft.Items = make([]models.ConfigSnapshotItem, len(items))
+	for i, item := range items {
+		draft.Items[i] = snapshotItem(item)
+	}
+	return true
+}
+
+// liveConfigState is the project's live config as drafts are compared with it
+func liveConfigState(db *gorm.DB, projectID uuid.UUID) ([]models.ConfigSnapshotItem, string, error) {
+	var items []models.ConfigItem
+	if err := db.Where("project_id = ?", projectID).Order("position asc").Find(&items).Error; err != nil {
+		return nil, "", err
+	}
+	state := make([]models.ConfigSnapshotItem, len(items))
+	for i, item := range items {
+		state[i] = snapshotItem(item)
+	}
+	return state, models.ConfigChecksum(items), nil
+}
+
+func configDraftResponse(draft models.ConfigDraft, live []models.ConfigSnapshotItem, checksum string, keyVersion int) ConfigDraftResponse {
+	response := ConfigDraftResponse{ConfigDraft: draft, Added: []string{}, Removed: []string{}, Changed: []ConfigDiffChange{}}
+	if draft.Status != models.DraftOpen {
+		return response
+	}
+	diff := diffConfigItems(live, draft.Items, draft.KeyVersion == keyVersion)
+	response.Added, response.Removed, response.Changed = diff.Added, diff.Removed, diff.Changed
+	response.Outdated = draft.KeyVersion != keyVersion || draft.BaseChecksum != checksum
+	return response
+}
+
+func loadConfigDraft(c *gin.Context) (*models.ConfigDraft, bool) {
+	draftID, ok := ParseUUIDParam(c, "draftId", "draft")
+	if !ok {
+		return nil, false
+	}
+	var draft models.ConfigDraft
+	err := requestDB(c).Preload("Author").Preload("Reviewer").
+		First(&draft, "id = ? AND project_id = ?", draftID, CurrentProjectAccess(c).Project.ID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		RespondNotFound(c, "Draft not found")
+		return nil, false
+	}
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch config draft")
+		return nil, false
+	}
+	return &draft, true
+}
+
+func loadOpenConfigDraft(c *gin.Context) (*models.ConfigDraft, bool) {
+	draft, ok := loadConfigDraft(c)
+	if !ok {
+		return nil, false
+	}
+	if draft.Status != models.DraftOpen {
+		RespondConflict(c, "The draft is already "+draft.Status)
+		return nil, false
+	}
+	return draft, true
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestConfigDraftApproval(t *testing.T) {
+	f := newAccessFixture(t)
+	db := database.DB
+
+	kept := models.ConfigItem{ID: uuid.New(), ProjectID: f.project.ID, Name: "KEPT", Value: "a2VwdA==", CreatedBy: f.admin.ID, UpdatedBy: f.admin.ID}
+	edited := models.ConfigItem{ID: uuid.New(), ProjectID: f.project.ID, Name: "EDITED", Value: "b2xk", Position: 1, CreatedBy: f.admin.ID, UpdatedBy: f.admin.ID}
+	db.Create(&[]models.ConfigItem{kept, edited})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", uuid.MustParse(c.GetHeader("X-User"))) })
+	r.GET("/projects/:id/config/drafts", AuthorizeProject(), GetConfigDrafts)
+	r.POST("/projects/:id/config/drafts", AuthorizeProject(), CreateConfigDraft)
+	r.POST("/projects/:id/config/drafts/:draftId/approve", AuthorizeProject(models.PermissionConfigWrite), ApproveConfigDraft)
+	request := func(method, path string, user uuid.UUID, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/projects/"+f.project.ID.String()+"/config/drafts"+path, strings.NewReader(body))
+		req.Header.Set("X-User", user.String())
+		r.ServeHTTP(w, req)
+		return w
+	}
+	create := func(body string) models.ConfigDraft {
+		w := request("POST", "", f.member.ID, body)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create draft = %d %s", w.Code, w.Body)
+		}
+		var draft models.ConfigDraft
+		json.Unmarshal(w.Body.Bytes(), &draft)
+		return draft
+	}
+
+	items := `[{"id":"` + kept.ID.String() + `","name":"KEPT","value":"a2VwdA=="},{"id":"` + edited.ID.String() + `","name":"EDITED","value":"bmV3","position":1},{"name":"ADDED","value":"YWRkZWQ=","position":2}]`
+	draft := create(`{"title":"Add ADDED","items":` + items + `}`)
+	stale := create(`{"title":"Drop everything","items":[]}`)
+
+	w := request("GET", "", f.admin.ID, "")
+	var listed []ConfigDraftResponse
+	json.Unmarshal(w.Body.Bytes(), &listed)
+	if len(listed) != 2 {
+		t.Fatalf("listed %d drafts: %s", len(listed), w.Body)
+	}
+	for _, d := range listed {
+		if d.ID == draft.ID && (d.Author.Name != "Member" || len(d.Items) != 0 || d.Outdated ||
+			len(d.Added) != 1 || d.Added[0] != "ADDED" || len(d.Changed) != 1 || d.Changed[0].Name != "EDITED") {
+			t.Errorf("listed draft %+v", d)
+		}
+	}
+
+	var live []models.ConfigItem
+	db.Where("project_id = ?", f.project.ID).Find(&live)
+	if len(live) != 2 {
+		t.Errorf("creating drafts changed the live config to %d items", len(live))
+	}
+
+	if w := request("POST", "/"+draft.ID.String()+"/approve", f.member.ID, ""); w.Code != http.StatusForbidden {
+		t.Errorf("approval without config.write = %d", w.Code)
+	}
+	if w := request("POST", "/"+draft.ID.String()+"/approve", f.admin.ID, ""); w.Code != http.StatusOK {
+		t.Fatalf("approve = %d %s", w.Code, w.Body)
+	}
+	live = nil
+	db.Where("project_id = ?", f.project.ID).Order("position asc").Find(&live)
+	if len(live) != 3 || live[1].Value != "bmV3" || live[2].Name != "ADDED" || live[2].UpdatedBy != f.member.ID {
+		t.Errorf("live config after approval: %+v", live)
+	}
+	var applied models.ConfigDraft
+	db.First(&applied, "id = ?", draft.ID)
+	if applied.Status != models.DraftApplied || applied.ReviewedBy == nil || *applied.ReviewedBy != f.admin.ID {
+		t.Errorf("approved draft %s reviewed by %v", applied.Status, applied.ReviewedBy)
+	}
+
+	// The other draft was based on the config before the approval
+	if w := request("POST", "/"+stale.ID.String()+"/approve", f.admin.ID, ""); w.Code != http.StatusConflict {
+		t.Errorf("approving an outdated draft = %d", w.Code)
+	}
+	if w := request("POST", "/"+draft.ID.String()+"/approve", f.admin.ID, ""); w.Code != http.StatusConflict {
+		t.Errorf("approving an applied draft = %d", w.Code)
+	}
+}
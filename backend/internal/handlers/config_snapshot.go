@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"envie-backend/internal/configwatch"
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxAutomaticConfigSnapshots is how many snapshots taken by syncs, rotations and
+// restores a project keeps; manual snapshots are kept until deleted
+const maxAutomaticConfigSnapshots = 50
+
+// configSnapshotColumns are the columns of a snapshot without its items
+const configSnapshotColumns = "id, project_id, name, reason, key_version, item_count, checksum, created_by, created_at"
+
+// CreateConfigSnapshotRequest - name a snapshot of the current config
+type CreateConfigSnapshotRequest struct {
+	Name string `json:"name" binding:"required,max=255,name"`
+}
+
+// RestoreConfigSnapshotResponse - outcome of restoring a snapshot. The config it
+// replaced is kept as the snapshot BackupSnapshotID.
+type RestoreConfigSnapshotResponse struct {
+	Message          string     `json:"message"`
+	RestoredItems    int        `json:"restoredItems"`
+	BackupSnapshotID *uuid.UUID `json:"backupSnapshotId,omitempty"`
+}
+
+// GetConfigSnapshots lists the project's snapshots without their items, newest
+// first
+func GetConfigSnapshots(c *gin.Context) {
+	access := CurrentProjectAccess(c)
+
+	var snapshots []models.ConfigSnapshot
+	if err := requestDB(c).Select(configSnapshotColumns).
+		Where("project_id = ?", access.Project.ID).
+		Order("created_at desc").
+		Find(&snapshots).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch config snapshots")
+		return
+	}
+	for i := range snapshots {
+		snapshots[i].Restorable = snapshots[i].KeyVersion == access.Project.KeyVersion
+	}
+	RespondOK(c, snapshots)
+}
+
+// GetConfigSnapshot returns a snapshot with its items, for clients to decrypt and
+// compare with the current config
+func GetConfigSnapshot(c *gin.Context) {
+	access := CurrentProjectAccess(c)
+	snapshot, ok := loadConfigSnapshot(c)
+	if !ok {
+		return
+	}
+
+	if access.MasksSensitive() {
+		for i := range snapshot.Items {
+			if snapshot.Items[i].Sensitive {
+				snapshot.Items[i].Value = ""
+				snapshot.Items[i].Masked = true
+			}
+		}
+	}
+	snapshot.Restorable = snapshot.KeyVersion == access.Project.KeyVersion
+	RespondOK(c, snapshot)
+}
+
+// CreateConfigSnapshot takes a named snapshot of the project's current config
+func CreateConfigSnapshot(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+	access := CurrentProjectAccess(c)
+
+	var req CreateConfigSnapshotRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	var snapshot *models.ConfigSnapshot
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		var items []models.ConfigItem
+		if err := tx.Where("project_id = ?", access.Project.ID).Order("position asc").Find(&items).Error; err != nil {
+			return err
+		}
+		var err error
+		snapshot, err = takeConfigSnapshot(tx, access.Project.ID, access.Project.KeyVersion, uid, req.Name, models.SnapshotManual, items)
+		return err
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to create config snapshot")
+		return
+	}
+
+	snapshot.Items = nil
+	snapshot.Restorable = true
+	RespondCreated(c, snapshot)
+}
+
+// RestoreConfigSnapshot replaces the project's config with a snapshot's. Items
+// the snapshot lacks go to the trash, and the replaced config is snapshotted
+// first, so a restore can be undone. Snapshots taken before the last key rotation
+// can't be restored: their values are under the previous key.
+func RestoreConfigSnapshot(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID
+
+	if access.MasksSensitive() {
+		RespondForbidden(c, "Restoring a snapshot of a project that restricts sensitive values requires "+models.PermissionSecretsReveal)
+		return
+	}
+
+	snapshot, ok := loadConfigSnapshot(c)
+	if !ok {
+		return
+	}
+	if snapshot.KeyVersion != access.Project.KeyVersion {
+		RespondConflict(c, fmt.Sprintf("The snapshot is encrypted with key version %d; the project key has been rotated to version %d since", snapshot.KeyVersion, access.Project.KeyVersion))
+		return
+	}
+
+	var backup *models.ConfigSnapshot
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		var current []models.ConfigItem
+		if err := tx.Where("project_id = ?", projectID).Order("position asc").Find(&current).Error; err != nil {
+			return err
+		}
+		var err error
+		backup, err = takeConfigSnapshot(tx, projectID, access.Project.KeyVersion, uid, "Before restoring "+snapshot.Name, models.SnapshotRestore, current)
+		if err != nil {
+			return err
+		}
+
+		restored := make(map[uuid.UUID]bool, len(snapshot.Items))
+		for _, item := range snapshot.Items {
+			restored[item.ID] = true
+		}
+		var removed []uuid.UUID
+		for _, item := range current {
+			if !restored[item.ID] {
+				removed = append(removed, item.ID)
+			}
+		}
+		if len(removed) > 0 {
+			if err := tx.Delete(&[]models.ConfigItem{}, removed).Error; err != nil {
+				return err
+			}
+		}
+
+		// Links to secret manager configs deleted since are dropped
+		var secretManagerConfigIDs []uuid.UUID
+		if err := tx.Model(&models.SecretManagerConfig{}).Where("project_id = ?", projectID).Pluck("id", &secretManagerConfigIDs).Error; err != nil {
+			return err
+		}
+		linkable := make(map[uuid.UUID]bool, len(secretManagerConfigIDs))
+		for _, id := range secretManagerConfigIDs {
+			linkable[id] = true
+		}
+
+		// Saved as an upsert, which also brings back items in the trash or purged
+		if len(snapshot.Items) > 0 {
+			items := make([]models.ConfigItem, len(snapshot.Items))
+			for i, item := range snapshot.Items {
+				items[i] = restoredConfigItem(projectID, item, uid)
+				if items[i].SecretManagerConfigID != nil && !linkable[*items[i].SecretManagerConfigID] {
+					items[i].SecretManagerConfigID = nil
+				}
+			}
+			if err := tx.Save(&items).Error; err != nil {
+				return err
+			}
+		}
+
+		return updateConfigChecksum(tx, projectID, configChange{
+			ActorID: uid,
+			Detail:  "restored snapshot " + snapshot.Name,
+			Count:   len(snapshot.Items) + len(removed),
+		})
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to restore config snapshot")
+		return
+	}
+	configwatch.Publish(projectID)
+
+	response := RestoreConfigSnapshotResponse{Message: "Snapshot restored", RestoredItems: len(snapshot.Items)}
+	if backup != nil {
+		response.BackupSnapshotID = &backup.ID
+	}
+	RespondOK(c, response)
+}
+
+// DeleteConfigSnapshot deletes a snapshot
+func DeleteConfigSnapshot(c *gin.Context) {
+	snapshot, ok := loadConfigSnapshot(c)
+	if !ok {
+		return
+	}
+	if err := requestDB(c).Delete(&models.ConfigSnapshot{}, "id = ?", snapshot.ID).Error; err != nil {
+		RespondInternalError(c, "Failed to delete config snapshot")
+		return
+	}
+	RespondMessage(c, "Snapshot deleted")
+}
+
+func loadConfigSnapshot(c *gin.Context) (*models.ConfigSnapshot, bool) {
+	snapshotID, ok := ParseUUIDParam(c, "snapshotId", "snapshot")
+	if !ok {
+		return nil, false
+	}
+	var snapshot models.ConfigSnapshot
+	err := requestDB(c).First(&snapshot, "id = ? AND project_id = ?", snapshotID, CurrentProjectAccess(c).Project.ID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		RespondNotFound(c, "Snapshot not found")
+		return nil, false
+	}
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch config snapshot")
+		return nil, false
+	}
+	return &snapshot, true
+}
+
+// takeConfigSnapshot stores items, encrypted with the project key of keyVersion,
+// as a snapshot of the project and drops automatic snapshots past
+// maxAutomaticConfigSnapshots. Automatic snapshots of an empty config are skipped
+// and return nil.
+func takeConfigSnapshot(tx *gorm.DB, projectID uuid.UUID, keyVersion int, userID uuid.UUID, name, reason string, items []models.ConfigItem) (*models.ConfigSnapshot, error) {
+	if len(items) == 0 && reason != models.SnapshotManual {
+		return nil, nil
+	}
+
+	sorted := append([]models.ConfigItem{}, items...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Position < sorted[j].Position })
+	snapshot := &models.ConfigSnapshot{
+		ProjectID:      projectID,
+		Name:           name,
+		Reason:         reason,
+		KeyVersion:     keyVersion,
+		ItemCount:      len(sorted),
+		Checksum:       models.ConfigChecksum(sorted),
+		LegacyChecksum: models.LegacyConfigChecksum(sorted),
+		Items:          make([]models.ConfigSnapshotItem, len(sorted)),
+		CreatedBy:      userID,
+	}
+	for i, item := range sorted {
+		snapshot.Items[i] = snapshotItem(item)
+	}
+	if err := tx.Create(snapshot).Error; err != nil {
+		return nil, err
+	}
+	if reason == models.SnapshotManual {
+		return snapshot, nil
+	}
+
+	var automatic []uuid.UUID
+	if err := tx.Model(&models.ConfigSnapshot{}).
+		Where("project_id = ? AND reason <> ?", projectID, models.SnapshotManual).
+		Order("created_at desc").
+		Pluck("id", &automatic).Error; err != nil {
+		return nil, err
+	}
+	if len(automatic) > maxAutomaticConfigSnapshots {
+		if err := tx.Delete(&models.ConfigSnapshot{}, automatic[maxAutomaticConfigSnapshots:]).Error; err != nil {
+			return nil, err
+		}
+	}
+	return snapshot, nil
+}
+
+// snapshotItem is item as a snapshot keeps it
+func snapshotItem(item models.ConfigItem) models.ConfigSnapshotItem {
+	return models.ConfigSnapshotItem{
+		ID:                      item.ID,
+		Name:                    item.Name,
+		Value:                   item.Value,
+		Sensitive:               item.Sensitive,
+		Position:                item.Position,
+		Category:                item.Category,
+		Description:             item.Description,
+		ExpiresAt:               item.ExpiresAt,
+		ValueType:               item.ValueType,
+		HasReferences:           item.HasReferences,
+		SecretManagerConfigID:   item.SecretManagerConfigID,
+		SecretManagerName:       item.SecretManagerName,
+		SecretManagerLastSyncAt: item.SecretManagerLastSyncAt,
+		SecretManagerVersion:    item.SecretManagerVersion,
+		CreatedBy:               item.CreatedBy,
+		CreatedAt:               item.CreatedAt,
+	}
+}
+
+// restoredConfigItem is the config item a snapshot item restores, updated by
+// userID
+func restoredConfigItem(projectID uuid.UUID, item models.ConfigSnapshotItem, userID uuid.UUID) models.ConfigItem {
+	return models.ConfigItem{
+		ID:                      item.ID,
+		ProjectID:               projectID,
+		Name:                    item.Name,
+		Value:                   item.Value,
+		Sensitive:               item.Sensitive,
+		Position:                item.Position,
+		Category:                item.Category,
+		Description:             item.Description,
+		ExpiresAt:               item.ExpiresAt,
+		ValueType:               item.ValueType,
+		HasReferences:           item.HasReferences,
+		SecretManagerConfigID:   item.SecretManagerConfigID,
+		SecretManagerName:       item.SecretManagerName,
+		SecretManagerLastSyncAt: item.SecretManagerLastSyncAt,
+		SecretManagerVersion:    item.SecretManagerVersion,
+		CreatedBy:               item.CreatedBy,
+		CreatedAt:               item.CreatedAt,
+		UpdatedBy:               userID,
+		UpdatedAt:               time.Now(),
+	}
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestRestoreConfigSnapshot(t *testing.T) {
+	f := newAccessFixture(t)
+	db := database.DB
+
+	item := func(name, value string, position int) models.ConfigItem {
+		row := models.ConfigItem{ID: uuid.New(), ProjectID: f.project.ID, Name: name, Value: value, Position: position, CreatedBy: f.member.ID, UpdatedBy: f.member.ID}
+		if err := db.Create(&row).Error; err != nil {
+			t.Fatal(err)
+		}
+		return row
+	}
+	purged, changed, trashed := item("PURGED", "cHVyZ2Vk", 0), item("CHANGED", "b2xk", 1), item("TRASHED", "dHJhc2g=", 2)
+	var items []models.ConfigItem
+	db.Where("project_id = ?", f.project.ID).Order("position asc").Find(&items)
+	tuesday, err := takeConfigSnapshot(db, f.project.ID, f.project.KeyVersion, f.member.ID, "Tuesday", models.SnapshotManual, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.Unscoped().Delete(&purged)
+	db.Delete(&trashed)
+	db.Model(&changed).Update("value", "bmV3")
+	added := item("ADDED", "YWRkZWQ=", 3)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", f.admin.ID) })
+	r.POST("/projects/:id/config/snapshots/:snapshotId/restore", AuthorizeProject(models.PermissionConfigWrite), RestoreConfigSnapshot)
+	restore := func(id uuid.UUID) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/projects/"+f.project.ID.String()+"/config/snapshots/"+id.String()+"/restore", nil))
+		return w
+	}
+
+	w := restore(tuesday.ID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("restore = %d %s", w.Code, w.Body)
+	}
+	var response RestoreConfigSnapshotResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.RestoredItems != 3 || response.BackupSnapshotID == nil {
+		t.Errorf("response %+v", response)
+	}
+
+	var restored []models.ConfigItem
+	db.Where("project_id = ?", f.project.ID).Order("position asc").Find(&restored)
+	if got := models.ConfigChecksum(restored); got != tuesday.Checksum {
+		t.Errorf("restored config checksum %s, want the snapshot's %s", got, tuesday.Checksum)
+	}
+	var project models.Project
+	db.First(&project, "id = ?", f.project.ID)
+	if project.ConfigChecksum == nil || *project.ConfigChecksum != tuesday.Checksum {
+		t.Errorf("project checksum %v not updated", project.ConfigChecksum)
+	}
+	if err := db.Unscoped().Where("deleted_at IS NOT NULL").First(&models.ConfigItem{}, "id = ?", added.ID).Error; err != nil {
+		t.Errorf("item added after the snapshot not in the trash: %v", err)
+	}
+
+	var backup models.ConfigSnapshot
+	db.First(&backup, "id = ?", response.BackupSnapshotID)
+	if backup.Reason != models.SnapshotRestore || backup.ItemCount != 2 {
+		t.Errorf("backup %s with %d items", backup.Reason, backup.ItemCount)
+	}
+
+	db.Model(&models.Project{}).Where("id = ?", f.project.ID).Update("key_version", f.project.KeyVersion+1)
+	if w := restore(tuesday.ID); w.Code != http.StatusConflict {
+		t.Errorf("restore under a rotated key = %d", w.Code)
+	}
+}
+
+func TestAutomaticConfigSnapshotsPruned(t *testing.T) {
+	f := newAccessFixture(t)
+	db := database.DB
+
+	items := []models.ConfigItem{{ID: uuid.New(), Name: "A", Value: "YQ=="}}
+	if _, err := takeConfigSnapshot(db, f.project.ID, 1, f.member.ID, "Kept", models.SnapshotManual, items); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxAutomaticConfigSnapshots+2; i++ {
+		if _, err := takeConfigSnapshot(db, f.project.ID, 1, f.member.ID, "Before sync", models.SnapshotSync, items); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if snapshot, err := takeConfigSnapshot(db, f.project.ID, 1, f.member.ID, "Before sync", models.SnapshotSync, nil); snapshot != nil || err != nil {
+		t.Errorf("snapshot of an empty config = %v, %v", snapshot, err)
+	}
+
+	var automatic, manual int64
+	db.Model(&models.ConfigSnapshot{}).Where("reason = ?", models.SnapshotSync).Count(&automatic)
+	db.Model(&models.ConfigSnapshot{}).Where("reason = ?", models.SnapshotManual).Count(&manual)
+	if automatic != maxAutomaticConfigSnapshots || manual != 1 {
+		t.Errorf("%d automatic and %d manual snapshots kept", automatic, manual)
+	}
+}
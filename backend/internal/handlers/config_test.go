@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"testing"
+
+	"envie-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestKeepMaskedValues(t *testing.T) {
+	secret, plain := uuid.New(), uuid.New()
+	stored := []models.ConfigItem{
+		{ID: secret, Name: "DB_PASSWORD", Value: "stored-secret", Sensitive: true},
+		{ID: plain, Name: "LOG_LEVEL", Value: "stored-plain"},
+	}
+
+	masked := append([]models.ConfigItem{}, stored...)
+	maskSensitiveItems(masked)
+	if masked[0].Value != "" || !masked[0].Masked || masked[1].Value != "stored-plain" || masked[1].Masked {
+		t.Fatalf("masked = %+v", masked)
+	}
+
+	synced := append([]models.ConfigItem{}, masked...)
+	if err := keepMaskedValues(synced, stored); err != nil {
+		t.Fatal(err)
+	}
+	if synced[0].Value != "stored-secret" {
+		t.Errorf("masked value synced back as %q, want the stored value", synced[0].Value)
+	}
+
+	replaced := []models.ConfigItem{{ID: secret, Name: "DB_PASSWORD", Value: "new-secret", Sensitive: true}}
+	if err := keepMaskedValues(replaced, stored); err != nil || replaced[0].Value != "new-secret" {
+		t.Errorf("replaced value = %q, %v", replaced[0].Value, err)
+	}
+
+	unmarked := []models.ConfigItem{{ID: secret, Name: "DB_PASSWORD", Masked: true}}
+	if err := keepMaskedValues(unmarked, stored); err == nil {
+		t.Error("a sensitive item was unmarked without secrets.reveal")
+	}
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"envie-backend/internal/configwatch"
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ConfigTrashSettings - how long deleted config items can be restored
+type ConfigTrashSettings struct {
+	RetentionDays int `json:"retentionDays" binding:"required,min=1,max=365"`
+}
+
+// ConfigTrashItem - a deleted config item and when it will be purged
+type ConfigTrashItem struct {
+	models.ConfigItem
+	PurgeAt time.Time `json:"purgeAt"`
+}
+
+// errConfigItemNameTaken is returned when a restored item's name is in use again
+var errConfigItemNameTaken = errors.New("config item name taken")
+
+// GetConfigTrash lists the project's deleted config items that can still be
+// restored, most recently deleted first
+func GetConfigTrash(c *gin.Context) {
+	access := CurrentProjectAccess(c)
+	db := requestDB(c)
+
+	var org models.Organization
+	if err := db.Select("id, config_trash_retention_days").First(&org, "id = ?", access.Project.OrganizationID).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch the trash")
+		return
+	}
+
+	var items []models.ConfigItem
+	if err := db.Unscoped().
+		Where("project_id = ? AND deleted_at IS NOT NULL", access.Project.ID).
+		Order("deleted_at desc").
+		Find(&items).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch the trash")
+		return
+	}
+
+	trash := make([]ConfigTrashItem, len(items))
+	for i := range items {
+		if access.MasksSensitive() {
+			maskSensitiveItem(&items[i])
+		}
+		trash[i] = ConfigTrashItem{
+			ConfigItem: items[i],
+			PurgeAt:    items[i].DeletedAt.Time.AddDate(0, 0, org.ConfigTrashRetentionDays),
+		}
+	}
+	RespondOK(c, trash)
+}
+
+// RestoreConfigItem moves a deleted config item back to the end of the project's
+// config. It fails while another item has its name.
+func RestoreConfigItem(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID
+
+	itemID, ok := ParseUUIDParam(c, "itemId", "config item")
+	if !ok {
+		return
+	}
+
+	var item models.ConfigItem
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Unscoped().
+			Where("id = ? AND project_id = ? AND deleted_at IS NOT NULL", itemID, projectID).
+			First(&item).Error; err != nil {
+			return err
+		}
+
+		var taken int64
+		if err := tx.Model(&models.ConfigItem{}).Where("project_id = ? AND name = ?", projectID, item.Name).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return errConfigItemNameTaken
+		}
+
+		var maxPosition *int
+		if err := tx.Model(&models.ConfigItem{}).Where("project_id = ?", projectID).Select("MAX(position)").Scan(&maxPosition).Error; err != nil {
+			return err
+		}
+		position := 0
+		if maxPosition != nil {
+			position = *maxPosition + 1
+		}
+
+		if err := tx.Unscoped().Model(&item).Updates(map[string]any{
+			"deleted_at": nil,
+			"position":   position,
+			"updated_by": uid,
+		}).Error; err != nil {
+			return err
+		}
+		item.DeletedAt = gorm.DeletedAt{}
+		item.Position = position
+		item.UpdatedBy = uid
+
+		return updateConfigChecksum(tx, projectID, configChange{ActorID: uid, Detail: "restored " + item.Name, Count: 1})
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		RespondNotFound(c, "Config item not found in the trash")
+		return
+	}
+	if errors.Is(err, errConfigItemNameTaken) {
+		RespondConflict(c, "Another config item is named "+item.Name+"; rename or delete it first")
+		return
+	}
+	if err != nil {
+		RespondInternalError(c, "Failed to restore config item")
+		return
+	}
+	configwatch.Publish(projectID)
+
+	if access.MasksSensitive() {
+		maskSensitiveItem(&item)
+	}
+	RespondOK(c, item)
+}
+
+func GetConfigTrashSettings(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	var org models.Organization
+	if err := requestDB(c).Select("id, config_trash_retention_days").First(&org, "id = ?", orgID).Error; err != nil {
+		RespondNotFound(c, "Organization not found")
+		return
+	}
+
+	RespondOK(c, ConfigTrashSettings{RetentionDays: org.ConfigTrashRetentionDays})
+}
+
+// UpdateConfigTrashSettings changes how long deleted config items are kept.
+// Shortening it purges items at the next run, so the change is audited.
+func UpdateConfigTrashSettings(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	var req ConfigTrashSettings
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Organization{}).Where("id = ?", orgID).Update("config_trash_retention_days", req.RetentionDays).Error; err != nil {
+			return err
+		}
+		return recordAuditEvent(tx, orgID, nil, uid, models.AuditTrashRetention, fmt.Sprintf("%d days", req.RetentionDays), 0)
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to update config trash settings")
+		return
+	}
+
+	RespondOK(c, req)
+}
+
+// StartConfigTrashPurge permanently deletes config items past their
+// organization's trash retention each interval in the background
+func StartConfigTrashPurge(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := purgeConfigTrash(database.DB, time.Now()); err != nil {
+				log.Printf("Failed to purge deleted config items: %v", err)
+			} else if n > 0 {
+				log.Printf("Purged %d deleted config items", n)
+			}
+		}
+	}()
+}
+
+// purgeConfigTrash deletes once per retention in use, like pruneReadEvents
+func purgeConfigTrash(db *gorm.DB, now time.Time) (int64, error) {
+	var retentions []int
+	if err := db.Model(&models.Organization{}).Unscoped().Distinct("config_trash_retention_days").Pluck("config_trash_retention_days", &retentions).Error; err != nil {
+		return 0, err
+	}
+
+	var purged int64
+	for _, days := range retentions {
+		orgs := db.Model(&models.Organization{}).Unscoped().Select("id").Where("config_trash_retention_days = ?", days)
+		projects := db.Model(&models.Project{}).Unscoped().Select("id").Where("organization_id IN (?)", orgs)
+		result := db.Unscoped().Where("project_id IN (?) AND deleted_at < ?", projects, now.AddDate(0, 0, -days)).
+			Delete(&models.ConfigItem{})
+		if result.Error != nil {
+			return purged, result.Error
+		}
+		purged += result.RowsAffected
+	}
+	return purged, nil
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestConfigTrash(t *testing.T) {
+	f := newAccessFixture(t)
+	db := database.DB
+	now := time.Now()
+
+	item := func(name string, position int) models.ConfigItem {
+		row := models.ConfigItem{ID: uuid.New(), ProjectID: f.project.ID, Name: name, Value: "dmFsdWU=", Position: position, CreatedBy: f.member.ID, UpdatedBy: f.member.ID}
+		if err := db.Create(&row).Error; err != nil {
+			t.Fatal(err)
+		}
+		return row
+	}
+	deleted, kept, old := item("DELETED", 0), item("KEPT", 1), item("OLD", 2)
+	db.Delete(&deleted)
+	db.Unscoped().Model(&old).Update("deleted_at", gorm.DeletedAt{Time: now.AddDate(0, 0, -40), Valid: true})
+	item("OLD", 3)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", f.member.ID) })
+	r.GET("/projects/:id/config/trash", AuthorizeProject(), GetConfigTrash)
+	r.POST("/projects/:id/config/trash/:itemId/restore", AuthorizeProject(), RestoreConfigItem)
+	request := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, "/projects/"+f.project.ID.String()+path, nil))
+		return w
+	}
+
+	w := request("GET", "/config/trash")
+	var trash []ConfigTrashItem
+	if err := json.Unmarshal(w.Body.Bytes(), &trash); err != nil || len(trash) != 2 {
+		t.Fatalf("trash = %d %s", w.Code, w.Body)
+	}
+	if trash[0].ID != deleted.ID || trash[1].ID != old.ID {
+		t.Errorf("trash not most recently deleted first: %s, %s", trash[0].Name, trash[1].Name)
+	}
+	if want := trash[0].DeletedAt.Time.AddDate(0, 0, 30); !trash[0].PurgeAt.Equal(want) {
+		t.Errorf("purgeAt = %s, want %s", trash[0].PurgeAt, want)
+	}
+
+	if w := request("POST", "/config/trash/"+deleted.ID.String()+"/restore"); w.Code != http.StatusOK {
+		t.Fatalf("restore = %d %s", w.Code, w.Body)
+	}
+	var restored models.ConfigItem
+	if err := db.First(&restored, "id = ?", deleted.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if restored.Position != 4 {
+		t.Errorf("restored at position %d, want after the last item", restored.Position)
+	}
+	if w := request("POST", "/config/trash/"+deleted.ID.String()+"/restore"); w.Code != http.StatusNotFound {
+		t.Errorf("restoring an active item = %d", w.Code)
+	}
+	if w := request("POST", "/config/trash/"+kept.ID.String()+"/restore"); w.Code != http.StatusNotFound {
+		t.Errorf("restoring an item never deleted = %d", w.Code)
+	}
+	if w := request("POST", "/config/trash/"+old.ID.String()+"/restore"); w.Code != http.StatusConflict {
+		t.Errorf("restoring over an item of the same name = %d", w.Code)
+	}
+
+	purged, err := purgeConfigTrash(db, now)
+	if err != nil || purged != 1 {
+		t.Fatalf("purged %d: %v", purged, err)
+	}
+	if err := db.Unscoped().First(&models.ConfigItem{}, "id = ?", old.ID).Error; err == nil {
+		t.Error("item past the retention still stored")
+	}
+}
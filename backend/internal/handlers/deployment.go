@@ -0,0 +1,463 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/middleware"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DeploymentKeyMapping maps an envie config key to the variable name used on the provider
+type DeploymentKeyMapping struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+type CreateDeploymentTargetRequest struct {
+	Name                 string                 `json:"name" binding:"required,max=100,name"`
+	Provider             string                 `json:"provider" binding:"required"`
+	ExternalID           string                 `json:"externalId" binding:"required,max=255"`
+	ExternalTeam         *string                `json:"externalTeam"`
+	EncryptedCredentials string                 `json:"encryptedCredentials" binding:"required"`
+	KeyMapping           []DeploymentKeyMapping `json:"keyMapping"`
+	Environments         []string               `json:"environments"`
+}
+
+type UpdateDeploymentTargetRequest struct {
+	Name                 string                  `json:"name" binding:"omitempty,max=100,name"`
+	ExternalID           string                  `json:"externalId" binding:"max=255"`
+	ExternalTeam         *string                 `json:"externalTeam"`
+	EncryptedCredentials string                  `json:"encryptedCredentials"`
+	KeyMapping           *[]DeploymentKeyMapping `json:"keyMapping"`
+	Environments         *[]string               `json:"environments"`
+}
+
+type ReportDeploymentSyncRequest struct {
+	Status         string  `json:"status" binding:"required"`
+	KeysPushed     int     `json:"keysPushed"`
+	ConfigChecksum *string `json:"configChecksum"`
+	Error          *string `json:"error"`
+}
+
+var validDeploymentProviders = map[string]bool{
+	models.DeploymentProviderVercel:  true,
+	models.DeploymentProviderNetlify: true,
+	models.DeploymentProviderFly:     true,
+}
+
+func encodeKeyMapping(mapping []DeploymentKeyMapping) (string, error) {
+	if len(mapping) == 0 {
+		return "", nil
+	}
+
+	targets := make(map[string]bool)
+	for _, m := range mapping {
+		if m.Source == "" || m.Target == "" {
+			return "", &ValidationError{"Key mapping entries require both source and target"}
+		}
+		if targets[m.Target] {
+			return "", &ValidationError{"Duplicate key mapping target: " + m.Target}
+		}
+		targets[m.Target] = true
+	}
+
+	data, err := json.Marshal(mapping)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func requireDeploymentTarget(c *gin.Context, projectID uuid.UUID) (*models.DeploymentTarget, bool) {
+	targetID, ok := ParseUUIDParam(c, "targetId", "deployment target")
+	if !ok {
+		return nil, false
+	}
+
+	var target models.DeploymentTarget
+	if err := requestDB(c).Where("id = ? AND project_id = ?", targetID, projectID).First(&target).Error; err != nil {
+		RespondNotFound(c, "Deployment target not found")
+		return nil, false
+	}
+	return &target, true
+}
+
+func GetDeploymentTargets(c *gin.Context) {
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	var targets []models.DeploymentTarget
+	if err := requestDB(c).Preload("CreatedBy").Preload("UpdatedBy").
+		Where("project_id = ?", projectID).
+		Order("created_at asc").
+		Find(&targets).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch deployment targets")
+		return
+	}
+
+	RespondOK(c, targets)
+}
+
+func CreateDeploymentTarget(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	var req CreateDeploymentTargetRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	if !validDeploymentProviders[req.Provider] {
+		RespondBadRequest(c, "Invalid provider. Must be vercel, netlify, or fly")
+		return
+	}
+
+	keyMapping, err := encodeKeyMapping(req.KeyMapping)
+	if err != nil {
+		RespondBadRequest(c, err.Error())
+		return
+	}
+
+	target := models.DeploymentTarget{
+		ProjectID:            projectID,
+		Name:                 req.Name,
+		Provider:             req.Provider,
+		ExternalID:           req.ExternalID,
+		ExternalTeam:         req.ExternalTeam,
+		EncryptedCredentials: req.EncryptedCredentials,
+		KeyMapping:           keyMapping,
+		Environments:         strings.Join(req.Environments, ","),
+		CreatedByID:          uid,
+		UpdatedByID:          uid,
+	}
+
+	if err := requestDB(c).Create(&target).Error; err != nil {
+		RespondInternalError(c, "Failed to create deployment target")
+		return
+	}
+
+	requestDB(c).Preload("CreatedBy").Preload("UpdatedBy").First(&target, "id = ?", target.ID)
+
+	RespondCreated(c, target)
+}
+
+func UpdateDeploymentTarget(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	target, ok := requireDeploymentTarget(c, projectID)
+	if !ok {
+		return
+	}
+
+	var req UpdateDeploymentTargetRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	if req.Name != "" {
+		target.Name = req.Name
+	}
+	if req.ExternalID != "" {
+		target.ExternalID = req.ExternalID
+	}
+	if req.ExternalTeam != nil {
+		target.ExternalTeam = req.ExternalTeam
+	}
+	if req.EncryptedCredentials != "" {
+		target.EncryptedCredentials = req.EncryptedCredentials
+	}
+	if req.KeyMapping != nil {
+		keyMapping, err := encodeKeyMapping(*req.KeyMapping)
+		if err != nil {
+			RespondBadRequest(c, err.Error())
+			return
+		}
+		target.KeyMapping = keyMapping
+	}
+	if req.Environments != nil {
+		target.Environments = strings.Join(*req.Environments, ",")
+	}
+	target.UpdatedByID = uid
+
+	if err := requestDB(c).Omit("CreatedBy", "UpdatedBy").Save(target).Error; err != nil {
+		RespondInternalError(c, "Failed to update deployment target")
+		return
+	}
+
+	requestDB(c).Preload("CreatedBy").Preload("UpdatedBy").First(target, "id = ?", target.ID)
+
+	RespondOK(c, target)
+}
+
+func DeleteDeploymentTarget(c *gin.Context) {
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	target, ok := requireDeploymentTarget(c, projectID)
+	if !ok {
+		return
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Where("target_id = ?", target.ID).Delete(&models.DeploymentSync{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(target).Error
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to delete deployment target")
+		return
+	}
+
+	RespondMessage(c, "Deployment target deleted")
+}
+
+// DeploymentSyncPage - a page of sync runs, newest first
+type DeploymentSyncPage struct {
+	Items      []models.DeploymentSync `json:"items"`
+	NextCursor string                  `json:"nextCursor,omitempty"`
+}
+
+func GetDeploymentSyncs(c *gin.Context) {
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	target, ok := requireDeploymentTarget(c, projectID)
+	if !ok {
+		return
+	}
+
+	page, ok := RequestedPage(c)
+	if !ok {
+		return
+	}
+
+	var syncs []models.DeploymentSync
+	if err := page.Apply(requestDB(c).Where("target_id = ?", target.ID), "deployment_syncs").Find(&syncs).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch deployment syncs")
+		return
+	}
+
+	var response DeploymentSyncPage
+	response.Items, response.NextCursor = pageItems(page, syncs, func(s *models.DeploymentSync) (time.Time, uuid.UUID) {
+		return s.CreatedAt, s.ID
+	})
+	RespondOK(c, response)
+}
+
+func ReportDeploymentSync(c *gin.Context) {
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	target, ok := requireDeploymentTarget(c, projectID)
+	if !ok {
+		return
+	}
+
+	applyDeploymentSyncReport(c, target)
+}
+
+func applyDeploymentSyncReport(c *gin.Context, target *models.DeploymentTarget) {
+	syncID, ok := ParseUUIDParam(c, "syncId", "deployment sync")
+	if !ok {
+		return
+	}
+
+	var req ReportDeploymentSyncRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	switch req.Status {
+	case models.DeploymentSyncRunning, models.DeploymentSyncSucceeded, models.DeploymentSyncFailed:
+	default:
+		RespondBadRequest(c, "Invalid status. Must be running, succeeded, or failed")
+		return
+	}
+
+	var sync models.DeploymentSync
+	if err := requestDB(c).Where("id = ? AND target_id = ?", syncID, target.ID).First(&sync).Error; err != nil {
+		RespondNotFound(c, "Deployment sync not found")
+		return
+	}
+
+	if sync.IsFinished() {
+		RespondConflict(c, "Deployment sync has already finished")
+		return
+	}
+
+	sync.Status = req.Status
+	sync.KeysPushed = req.KeysPushed
+	sync.Error = req.Error
+	if req.ConfigChecksum != nil {
+		sync.ConfigChecksum = req.ConfigChecksum
+	}
+
+	now := time.Now()
+	if sync.IsFinished() {
+		sync.FinishedAt = &now
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Save(&sync).Error; err != nil {
+			return err
+		}
+		if !sync.IsFinished() {
+			return nil
+		}
+		return tx.Model(&models.DeploymentTarget{}).Where("id = ?", target.ID).Updates(map[string]any{
+			"last_sync_status": sync.Status,
+			"last_sync_at":     now,
+			"last_sync_error":  sync.Error,
+		}).Error
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to record deployment sync")
+		return
+	}
+
+	RespondOK(c, sync)
+}
+
+// CLIDeploymentTarget is the token-scoped view of a deployment target
+type CLIDeploymentTarget struct {
+	ID                   string                 `json:"id"`
+	Name                 string                 `json:"name"`
+	Provider             string                 `json:"provider"`
+	ExternalID           string                 `json:"externalId"`
+	ExternalTeam         *string                `json:"externalTeam,omitempty"`
+	EncryptedCredentials string                 `json:"encryptedCredentials"`
+	KeyMapping           []DeploymentKeyMapping `json:"keyMapping"`
+	Environments         []string               `json:"environments"`
+}
+
+func requireCLIProjectToken(c *gin.Context) (*models.ProjectToken, uuid.UUID, bool) {
+	token := middleware.GetCLIToken(c)
+	if token == nil {
+		RespondUnauthorized(c, "Authentication required")
+		return nil, uuid.Nil, false
+	}
+
+	projectID, err := ResolveCLIProject(token, c.Param("id"))
+	if err != nil {
+		respondCLIError(c, err)
+		return nil, uuid.Nil, false
+	}
+
+	if token.ProjectID != projectID {
+		RespondForbidden(c, "Token is not valid for this project")
+		return nil, uuid.Nil, false
+	}
+
+	return token, projectID, true
+}
+
+func GetCLIDeploymentTargets(c *gin.Context) {
+	_, projectID, ok := requireCLIProjectToken(c)
+	if !ok {
+		return
+	}
+
+	var targets []models.DeploymentTarget
+	if err := requestDB(c).Where("project_id = ?", projectID).Order("created_at asc").Find(&targets).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch deployment targets")
+		return
+	}
+
+	credentials := make([]string, len(targets))
+	for i, t := range targets {
+		credentials[i] = t.EncryptedCredentials
+	}
+	if !requireCLIAlgorithmSupport(c, credentials...) {
+		return
+	}
+
+	response := make([]CLIDeploymentTarget, len(targets))
+	for i, t := range targets {
+		var mapping []DeploymentKeyMapping
+		if t.KeyMapping != "" {
+			if err := json.Unmarshal([]byte(t.KeyMapping), &mapping); err != nil {
+				RespondInternalError(c, fmt.Sprintf("Deployment target %s has an invalid key mapping", t.Name))
+				return
+			}
+		}
+
+		var environments []string
+		if t.Environments != "" {
+			environments = strings.Split(t.Environments, ",")
+		}
+
+		response[i] = CLIDeploymentTarget{
+			ID:                   t.ID.String(),
+			Name:                 t.Name,
+			Provider:             t.Provider,
+			ExternalID:           t.ExternalID,
+			ExternalTeam:         t.ExternalTeam,
+			EncryptedCredentials: t.EncryptedCredentials,
+			KeyMapping:           mapping,
+			Environments:         environments,
+		}
+	}
+
+	RespondOK(c, response)
+}
+
+func CreateCLIDeploymentSync(c *gin.Context) {
+	token, projectID, ok := requireCLIProjectToken(c)
+	if !ok {
+		return
+	}
+
+	target, ok := requireDeploymentTarget(c, projectID)
+	if !ok {
+		return
+	}
+
+	var project models.Project
+	if err := requestDB(c).Select("id, config_checksum").First(&project, "id = ?", projectID).Error; err != nil {
+		RespondNotFound(c, "Project not found")
+		return
+	}
+
+	sync := models.DeploymentSync{
+		TargetID:           target.ID,
+		ProjectID:          projectID,
+		Status:             models.DeploymentSyncRunning,
+		TriggeredByTokenID: &token.ID,
+		ConfigChecksum:     project.ConfigChecksum,
+	}
+
+	if err := requestDB(c).Create(&sync).Error; err != nil {
+		RespondInternalError(c, "Failed to create deployment sync")
+		return
+	}
+
+	RespondCreated(c, sync)
+}
+
+func ReportCLIDeploymentSync(c *gin.Context) {
+	_, projectID, ok := requireCLIProjectToken(c)
+	if !ok {
+		return
+	}
+
+	target, ok := requireDeploymentTarget(c, projectID)
+	if !ok {
+		return
+	}
+
+	applyDeploymentSyncReport(c, target)
+}
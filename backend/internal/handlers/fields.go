@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FieldSet is the set of JSON fields a client selected with the fields query
+// parameter. A nil FieldSet selects every field.
+type FieldSet map[string]bool
+
+// Has reports whether the field is part of the response
+func (f FieldSet) Has(name string) bool {
+	return f == nil || f[name]
+}
+
+// RequestedFields parses the comma-separated fields query parameter, e.g.
+// ?fields=id,name, against the JSON fields of sample, a struct or a slice of
+// structs. If a field is unknown, it sends a 400 response automatically.
+func RequestedFields(c *gin.Context, sample any) (FieldSet, bool) {
+	param := c.Query("fields")
+	if param == "" {
+		return nil, true
+	}
+
+	known := jsonFieldNames(reflect.TypeOf(sample))
+	fields := FieldSet{}
+	for _, name := range strings.Split(param, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !known[name] {
+			RespondBadRequest(c, "Unknown field: "+name)
+			return nil, false
+		}
+		fields[name] = true
+	}
+	if len(fields) == 0 {
+		return nil, true
+	}
+	return fields, true
+}
+
+// jsonFieldNames returns the JSON object keys of a struct type, looking through
+// pointers, slices and embedded structs
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	names := map[string]bool{}
+	if t.Kind() != reflect.Struct {
+		return names
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			for embedded := range jsonFieldNames(field.Type) {
+				names[embedded] = true
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names[name] = true
+	}
+	return names
+}
+
+// RespondFields sends data with 200 OK like RespondOK, keeping only the selected
+// fields of the object or of each object in the list
+func RespondFields(c *gin.Context, fields FieldSet, data any) {
+	if fields == nil {
+		RespondOK(c, data)
+		return
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		RespondInternalError(c, "Failed to encode response")
+		return
+	}
+
+	var list []map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &list); err == nil {
+		for _, object := range list {
+			fields.filter(object)
+		}
+		c.JSON(http.StatusOK, list)
+		return
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &object); err != nil {
+		RespondOK(c, data)
+		return
+	}
+	fields.filter(object)
+	c.JSON(http.StatusOK, object)
+}
+
+func (f FieldSet) filter(object map[string]json.RawMessage) {
+	for name := range object {
+		if !f[name] {
+			delete(object, name)
+		}
+	}
+}
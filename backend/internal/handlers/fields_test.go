@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func fieldsContext(query string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/items"+query, nil)
+	return c, w
+}
+
+func TestRespondFields(t *testing.T) {
+	c, w := fieldsContext("?fields=id,%20role")
+	fields, ok := RequestedFields(c, []OrganizationUser{})
+	if !ok {
+		t.Fatal("valid fields rejected")
+	}
+	RespondFields(c, fields, []OrganizationUser{{Name: "Ada", Email: "ada@example.com", Role: "admin"}})
+
+	want := `[{"id":"00000000-0000-0000-0000-000000000000","role":"admin"}]`
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("response = %d %s, want %s", w.Code, w.Body, want)
+	}
+}
+
+func TestRespondFieldsWithoutSelection(t *testing.T) {
+	c, w := fieldsContext("")
+	fields, ok := RequestedFields(c, ProjectListItem{})
+	if !ok || fields != nil || !fields.Has("name") {
+		t.Fatalf("fields = %v, %v", fields, ok)
+	}
+	RespondFields(c, fields, ProjectListItem{Name: "api"})
+	if w.Body.Len() < 100 {
+		t.Errorf("unfiltered response trimmed: %s", w.Body)
+	}
+}
+
+func TestRequestedFieldsRejectsUnknown(t *testing.T) {
+	c, w := fieldsContext("?fields=name,project")
+	if _, ok := RequestedFields(c, models.ConfigItem{}); ok || w.Code != http.StatusBadRequest {
+		t.Errorf("hidden field accepted, status %d", w.Code)
+	}
+}
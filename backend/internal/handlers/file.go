@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
-	"io"
 	"net/http"
 	"time"
 
@@ -14,68 +13,89 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
-const MaxFileSize = 1 * 1024 * 1024 // 1MB limit
+type FileUploader struct {
+	ID    uuid.UUID `json:"id"`
+	Name  string    `json:"name"`
+	Email string    `json:"email"`
+}
+
+type FileResponse struct {
+	ID           uuid.UUID    `json:"id"`
+	Name         string       `json:"name"`
+	Folder       string       `json:"folder"`
+	SizeBytes    int64        `json:"sizeBytes"`
+	MimeType     string       `json:"mimeType"`
+	EncryptedFEK string       `json:"encryptedFek"`
+	Checksum     string       `json:"checksum"`
+	UploadedBy   FileUploader `json:"uploadedBy"`
+	CreatedAt    time.Time    `json:"createdAt"`
+}
+
+type UploadFileResponse struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Folder    string    `json:"folder"`
+	SizeBytes int64     `json:"sizeBytes"`
+}
+
+// FileDownloadResponse - the encrypted file content, base64 encoded
+type FileDownloadResponse struct {
+	Data         string `json:"data"`
+	EncryptedFEK string `json:"encryptedFek"`
+	Checksum     string `json:"checksum"`
+	Name         string `json:"name"`
+	MimeType     string `json:"mimeType"`
+}
+
+type FileFEK struct {
+	ID           uuid.UUID `json:"id"`
+	EncryptedFEK string    `json:"encryptedFek"`
+}
+
+type UpdateFileFEKsResponse struct {
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+}
 
 func checkStorageConfigured(c *gin.Context) bool {
 	if !storage.IsConfigured() {
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "File storage is not configured"})
+		RespondError(c, http.StatusServiceUnavailable, "File storage is not configured")
 		return false
 	}
 	return true
 }
 
 func ListProjectFiles(c *gin.Context) {
-	uid, exists := GetAuthUserID(c)
-	if !exists {
-		return
-	}
-	
-	projectIDStr := c.Param("id")
+	projectID := CurrentProjectAccess(c).Project.ID
 
-	projectID, err := uuid.Parse(projectIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+	folder, filtered, recursive, ok := parseFileFolderQuery(c)
+	if !ok {
 		return
 	}
 
-	access, err := GetUserProjectAccess(uid, projectID)
-	if err != nil || access == nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
+	query := requestDB(c).Where("project_id = ?", projectID)
+	if filtered {
+		query = inFolder(query, folder, recursive)
 	}
 
 	var files []models.ProjectFile
-	if err := database.DB.
+	if err := query.
 		Preload("UploadedUser").
-		Where("project_id = ?", projectID).
-		Order("created_at DESC").
+		Order("folder, created_at DESC").
 		Find(&files).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch files"})
+		RespondError(c, http.StatusInternalServerError, "Failed to fetch files")
 		return
 	}
 
-	type FileResponse struct {
-		ID           uuid.UUID `json:"id"`
-		Name         string    `json:"name"`
-		SizeBytes    int64     `json:"sizeBytes"`
-		MimeType     string    `json:"mimeType"`
-		EncryptedFEK string    `json:"encryptedFek"`
-		Checksum     string    `json:"checksum"`
-		UploadedBy   struct {
-			ID    uuid.UUID `json:"id"`
-			Name  string    `json:"name"`
-			Email string    `json:"email"`
-		} `json:"uploadedBy"`
-		CreatedAt time.Time `json:"createdAt"`
-	}
-
 	response := make([]FileResponse, len(files))
 	for i, f := range files {
 		response[i] = FileResponse{
 			ID:           f.ID,
 			Name:         f.Name,
+			Folder:       f.Folder,
 			SizeBytes:    f.SizeBytes,
 			MimeType:     f.MimeType,
 			EncryptedFEK: f.EncryptedFEK,
@@ -97,74 +117,79 @@ func UploadProjectFile(c *gin.Context) {
 
 	userID, _ := c.Get("user_id")
 	uid := userID.(uuid.UUID)
-	projectIDStr := c.Param("id")
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID
 
-	projectID, err := uuid.Parse(projectIDStr)
+	receiveProjectFile(c, projectID, access.Project.OrganizationID, uid, "")
+}
+
+// receiveProjectFile stores the file of a multipart upload in the project and
+// responds. uploaderID is the user the file is attributed to; via is appended
+// to the audit log entry when the upload didn't come from them directly.
+func receiveProjectFile(c *gin.Context, projectID, orgID, uploaderID uuid.UUID, via string) {
+	maxSize, err := orgMaxFileSize(requestDB(c), orgID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		RespondError(c, http.StatusInternalServerError, "Failed to load the file size limit")
 		return
 	}
 
-	access, err := GetUserProjectAccess(uid, projectID)
-	if err != nil || access == nil || !access.CanEdit {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+	// An organization already past its quota is refused before the file is read
+	if err := checkStorageQuota(requestDB(c), orgID, 0); err != nil {
+		RespondAPIError(c, err, "Failed to check the storage quota")
 		return
 	}
 
-	if err := c.Request.ParseMultipartForm(MaxFileSize + 1024*1024); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form: " + err.Error()})
-		return
-	}
+	fileID := uuid.New()
+	s3Key := fileS3Key(projectID, fileID)
 
-	file, header, err := c.Request.FormFile("file")
+	// The file is streamed to storage as it's read, so it's stored before the
+	// form is validated and has to be deleted if anything after it fails
+	ctx := context.WithoutCancel(c.Request.Context())
+	form, err := readUploadForm(ctx, c, s3Key, maxSize)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No file provided"})
+		RespondAPIError(c, err, "Failed to upload file")
 		return
 	}
-	defer file.Close()
+	stored := true
+	defer func() {
+		if stored {
+			storage.DeleteFile(ctx, s3Key)
+		}
+	}()
 
-	encryptedData, err := io.ReadAll(io.LimitReader(file, MaxFileSize+1))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
-		return
+	fileName := form.fields["name"]
+	if fileName == "" {
+		fileName = form.fileName
 	}
 
-	if int64(len(encryptedData)) > MaxFileSize {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("File too large. Max size is %d bytes", MaxFileSize)})
+	folder, message := normalizeFolder(form.fields["folder"])
+	if message != "" {
+		RespondError(c, http.StatusBadRequest, message)
 		return
 	}
 
-	fileName := c.PostForm("name")
-	if fileName == "" {
-		fileName = header.Filename
-	}
-
-	encryptedFEK := c.PostForm("encryptedFek")
+	encryptedFEK := form.fields["encryptedFek"]
 	if encryptedFEK == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing encryptedFek"})
+		RespondError(c, http.StatusBadRequest, "Missing encryptedFek")
 		return
 	}
 
-	checksum := c.PostForm("checksum")
-	mimeType := c.PostForm("mimeType")
+	checksum := form.fields["checksum"]
+	mimeType := form.fields["mimeType"]
 	if mimeType == "" {
 		mimeType = "application/octet-stream"
 	}
 
-	originalSize := c.PostForm("originalSize")
+	originalSize := form.fields["originalSize"]
 	var sizeBytes int64
 	if originalSize != "" {
 		fmt.Sscanf(originalSize, "%d", &sizeBytes)
 	} else {
-		sizeBytes = int64(len(encryptedData))
+		sizeBytes = form.size
 	}
 
-	fileID := uuid.New()
-	s3Key := fmt.Sprintf("projects/%s/files/%s", projectID.String(), fileID.String())
-
-	ctx := context.Background()
-	if err := storage.UploadFile(ctx, s3Key, encryptedData, "application/octet-stream"); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file: " + err.Error()})
+	if err := checkStorageQuota(requestDB(c), orgID, sizeBytes); err != nil {
+		RespondAPIError(c, err, "Failed to check the storage quota")
 		return
 	}
 
@@ -172,24 +197,32 @@ func UploadProjectFile(c *gin.Context) {
 		ID:           fileID,
 		ProjectID:    projectID,
 		Name:         fileName,
+		Folder:       folder,
 		SizeBytes:    sizeBytes,
 		MimeType:     mimeType,
 		S3Key:        s3Key,
 		EncryptedFEK: encryptedFEK,
 		Checksum:     checksum,
-		UploadedBy:   uid,
+		UploadedBy:   uploaderID,
 	}
 
-	if err := database.DB.Create(&projectFile).Error; err != nil {
-		storage.DeleteFile(ctx, s3Key)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file record"})
+	err = database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Create(&projectFile).Error; err != nil {
+			return err
+		}
+		return recordAuditEvent(tx, orgID, &projectID, uploaderID, models.AuditFileUploaded, fileName+via, 1)
+	})
+	if err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to save file record")
 		return
 	}
+	stored = false
 
-	c.JSON(http.StatusCreated, gin.H{
-		"id":        fileID,
-		"name":      fileName,
-		"sizeBytes": sizeBytes,
+	c.JSON(http.StatusCreated, UploadFileResponse{
+		ID:        fileID,
+		Name:      fileName,
+		Folder:    folder,
+		SizeBytes: sizeBytes,
 	})
 }
 
@@ -200,46 +233,36 @@ func DownloadProjectFile(c *gin.Context) {
 
 	userID, _ := c.Get("user_id")
 	uid := userID.(uuid.UUID)
-	projectIDStr := c.Param("id")
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID
 	fileIDStr := c.Param("fileId")
 
-	projectID, err := uuid.Parse(projectIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
-		return
-	}
-
 	fileID, err := uuid.Parse(fileIDStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file ID"})
-		return
-	}
-
-	access, err := GetUserProjectAccess(uid, projectID)
-	if err != nil || access == nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		RespondError(c, http.StatusBadRequest, "Invalid file ID")
 		return
 	}
 
 	var file models.ProjectFile
-	if err := database.DB.Where("id = ? AND project_id = ?", fileID, projectID).First(&file).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+	if err := requestDB(c).Where("id = ? AND project_id = ?", fileID, projectID).First(&file).Error; err != nil {
+		RespondError(c, http.StatusNotFound, "File not found")
 		return
 	}
 
-	ctx := context.Background()
+	ctx := context.WithoutCancel(c.Request.Context())
 	data, err := storage.DownloadFile(ctx, file.S3Key)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to download file"})
+		RespondError(c, http.StatusInternalServerError, "Failed to download file")
 		return
 	}
+	recordFileDownload(c, access.Project.OrganizationID, &file, uid, nil)
 
-	c.JSON(http.StatusOK, gin.H{
-		"data":         base64.StdEncoding.EncodeToString(data),
-		"encryptedFek": file.EncryptedFEK,
-		"checksum":     file.Checksum,
-		"name":         file.Name,
-		"mimeType":     file.MimeType,
+	c.JSON(http.StatusOK, FileDownloadResponse{
+		Data:         base64.StdEncoding.EncodeToString(data),
+		EncryptedFEK: file.EncryptedFEK,
+		Checksum:     file.Checksum,
+		Name:         file.Name,
+		MimeType:     file.MimeType,
 	})
 }
 
@@ -250,41 +273,36 @@ func DeleteProjectFile(c *gin.Context) {
 
 	userID, _ := c.Get("user_id")
 	uid := userID.(uuid.UUID)
-	projectIDStr := c.Param("id")
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID
 	fileIDStr := c.Param("fileId")
 
-	projectID, err := uuid.Parse(projectIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
-		return
-	}
-
 	fileID, err := uuid.Parse(fileIDStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file ID"})
-		return
-	}
-
-	access, err := GetUserProjectAccess(uid, projectID)
-	if err != nil || access == nil || !access.CanEdit {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		RespondError(c, http.StatusBadRequest, "Invalid file ID")
 		return
 	}
 
 	var file models.ProjectFile
-	if err := database.DB.Where("id = ? AND project_id = ?", fileID, projectID).First(&file).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+	if err := requestDB(c).Where("id = ? AND project_id = ?", fileID, projectID).First(&file).Error; err != nil {
+		RespondError(c, http.StatusNotFound, "File not found")
 		return
 	}
 
-	ctx := context.Background()
+	ctx := context.WithoutCancel(c.Request.Context())
 	if err := storage.DeleteFile(ctx, file.S3Key); err != nil {
 		// Log but continue - we still want to delete the DB record
 		fmt.Printf("Warning: Failed to delete file from S3: %v\n", err)
 	}
 
-	if err := database.DB.Delete(&file).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file record"})
+	err = database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Delete(&file).Error; err != nil {
+			return err
+		}
+		return recordAuditEvent(tx, access.Project.OrganizationID, &projectID, uid, models.AuditFileDeleted, file.Name, 1)
+	})
+	if err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to delete file record")
 		return
 	}
 
@@ -292,29 +310,10 @@ func DeleteProjectFile(c *gin.Context) {
 }
 
 func GetProjectFilesForRotation(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	uid := userID.(uuid.UUID)
-	projectIDStr := c.Param("id")
-
-	projectID, err := uuid.Parse(projectIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
-		return
-	}
-
-	access, err := GetUserProjectAccess(uid, projectID)
-	if err != nil || access == nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
-	}
-
-	type FileFEK struct {
-		ID           uuid.UUID `json:"id"`
-		EncryptedFEK string    `json:"encryptedFek"`
-	}
+	projectID := CurrentProjectAccess(c).Project.ID
 
 	var files []FileFEK
-	database.DB.Model(&models.ProjectFile{}).
+	requestDB(c).Model(&models.ProjectFile{}).
 		Select("id, encrypted_fek").
 		Where("project_id = ?", projectID).
 		Scan(&files)
@@ -330,45 +329,27 @@ type UpdateFileFEKsRequest struct {
 }
 
 func UpdateFileFEKs(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	uid := userID.(uuid.UUID)
-	projectIDStr := c.Param("id")
-
-	projectID, err := uuid.Parse(projectIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
-		return
-	}
-
-	access, err := GetUserProjectAccess(uid, projectID)
-	if err != nil || access == nil || !access.CanEdit {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
-	}
+	projectID := CurrentProjectAccess(c).Project.ID
 
 	var req UpdateFileFEKsRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !BindJSON(c, &req) {
 		return
 	}
 
-	tx := database.DB.Begin()
-	for _, f := range req.Files {
-		result := tx.Model(&models.ProjectFile{}).
-			Where("id = ? AND project_id = ?", f.ID, projectID).
-			Update("encrypted_fek", f.EncryptedFEK)
-
-		if result.Error != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update file FEK"})
-			return
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		for _, f := range req.Files {
+			if err := tx.Model(&models.ProjectFile{}).
+				Where("id = ? AND project_id = ?", f.ID, projectID).
+				Update("encrypted_fek", f.EncryptedFEK).Error; err != nil {
+				return err
+			}
 		}
-	}
-
-	if err := tx.Commit().Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit updates"})
+		return nil
+	})
+	if err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to update file FEK")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "File FEKs updated successfully", "count": len(req.Files)})
+	c.JSON(http.StatusOK, UpdateFileFEKsResponse{Message: "File FEKs updated successfully", Count: len(req.Files)})
 }
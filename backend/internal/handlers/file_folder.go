@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxFolderLength = 500
+
+// FileFolder - a folder with files directly in it. Folders exist as long as
+// they hold a file; their parents are only listed if they do too.
+type FileFolder struct {
+	Path      string `json:"path"`
+	FileCount int    `json:"fileCount"`
+	SizeBytes int64  `json:"sizeBytes"`
+}
+
+// UpdateProjectFileRequest - renames and/or moves a file; omitted fields are
+// kept, a folder of "" moves the file to the top level
+type UpdateProjectFileRequest struct {
+	Name   *string `json:"name" binding:"omitempty,min=1,max=255"`
+	Folder *string `json:"folder"`
+}
+
+// MoveFileFolderRequest - moves a folder with its subfolders under a new path
+type MoveFileFolderRequest struct {
+	From string `json:"from" binding:"required"`
+	To   string `json:"to"`
+}
+
+type MoveFileFolderResponse struct {
+	Message string `json:"message"`
+	Count   int64  `json:"count"`
+}
+
+// normalizeFolder trims the slashes around a folder path and checks its
+// segments; the message is empty when the path is valid. "" is the top level.
+func normalizeFolder(path string) (string, string) {
+	path = strings.Trim(strings.TrimSpace(path), "/")
+	if path == "" {
+		return "", ""
+	}
+	if len(path) > maxFolderLength {
+		return "", fmt.Sprintf("Folder path is longer than %d characters", maxFolderLength)
+	}
+	for _, segment := range strings.Split(path, "/") {
+		switch {
+		case segment == "":
+			return "", "Folder path has an empty segment"
+		case segment == "." || segment == "..":
+			return "", "Folder path can't contain . or .. segments"
+		case strings.TrimSpace(segment) != segment:
+			return "", fmt.Sprintf("Folder %q starts or ends with a space", segment)
+		}
+	}
+	return path, ""
+}
+
+// inFolder limits files to folder, and with recursive to its subfolders too
+func inFolder(db *gorm.DB, folder string, recursive bool) *gorm.DB {
+	if !recursive {
+		return db.Where("folder = ?", folder)
+	}
+	if folder == "" {
+		return db
+	}
+	// substr counts characters, not bytes
+	prefix := folder + "/"
+	return db.Where("folder = ? OR substr(folder, 1, ?) = ?", folder, utf8.RuneCountInString(prefix), prefix)
+}
+
+func ListFileFolders(c *gin.Context) {
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	folders := []FileFolder{}
+	if err := requestDB(c).Model(&models.ProjectFile{}).
+		Select("folder AS path, COUNT(*) AS file_count, COALESCE(SUM(size_bytes), 0) AS size_bytes").
+		Where("project_id = ?", projectID).
+		Group("folder").
+		Order("folder").
+		Scan(&folders).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch folders")
+		return
+	}
+
+	RespondOK(c, folders)
+}
+
+// UpdateProjectFile renames or moves a file. Only its metadata changes, the
+// stored object and its FEK stay as they are.
+func UpdateProjectFile(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID
+
+	fileID, ok := ParseUUIDParam(c, "fileId", "file")
+	if !ok {
+		return
+	}
+
+	var req UpdateProjectFileRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	var file models.ProjectFile
+	if err := requestDB(c).Where("id = ? AND project_id = ?", fileID, projectID).First(&file).Error; err != nil {
+		RespondNotFound(c, "File not found")
+		return
+	}
+
+	before := filePath(file.Folder, file.Name)
+	if req.Name != nil {
+		file.Name = *req.Name
+	}
+	if req.Folder != nil {
+		folder, message := normalizeFolder(*req.Folder)
+		if message != "" {
+			RespondBadRequest(c, message)
+			return
+		}
+		file.Folder = folder
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Model(&file).Updates(map[string]any{"name": file.Name, "folder": file.Folder}).Error; err != nil {
+			return err
+		}
+		return recordAuditEvent(tx, access.Project.OrganizationID, &projectID, uid, models.AuditFileMoved, before+" -> "+filePath(file.Folder, file.Name), 1)
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to update file")
+		return
+	}
+
+	RespondOK(c, UploadFileResponse{ID: file.ID, Name: file.Name, Folder: file.Folder, SizeBytes: file.SizeBytes})
+}
+
+// MoveFileFolder moves every file in a folder and its subfolders, which also
+// renames the folder when only its last segment changes
+func MoveFileFolder(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID
+
+	var req MoveFileFolderRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	from, message := normalizeFolder(req.From)
+	if message == "" && from == "" {
+		message = "Can't move the top level"
+	}
+	if message != "" {
+		RespondBadRequest(c, message)
+		return
+	}
+	to, message := normalizeFolder(req.To)
+	if message != "" {
+		RespondBadRequest(c, message)
+		return
+	}
+	if to == from || strings.HasPrefix(to, from+"/") {
+		RespondBadRequest(c, "Can't move a folder into itself")
+		return
+	}
+
+	var moved int64
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		// Subfolders keep the part of their path below from
+		result := inFolder(tx.Model(&models.ProjectFile{}).Where("project_id = ?", projectID), from, true).
+			Update("folder", gorm.Expr("? || substr(folder, ?)", to, utf8.RuneCountInString(from)+1))
+		if result.Error != nil {
+			return result.Error
+		}
+		moved = result.RowsAffected
+		if moved == 0 {
+			return nil
+		}
+		if to == "" {
+			// Moved to the top level, the subfolders of from are left with a leading slash
+			if err := tx.Model(&models.ProjectFile{}).
+				Where("project_id = ? AND substr(folder, 1, 1) = ?", projectID, "/").
+				Update("folder", gorm.Expr("substr(folder, 2)")).Error; err != nil {
+				return err
+			}
+		}
+		return recordAuditEvent(tx, access.Project.OrganizationID, &projectID, uid, models.AuditFileMoved, from+"/ -> "+to+"/", int(moved))
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to move folder")
+		return
+	}
+	if moved == 0 {
+		RespondNotFound(c, "Folder not found")
+		return
+	}
+
+	RespondOK(c, MoveFileFolderResponse{Message: "Folder moved", Count: moved})
+}
+
+func filePath(folder, name string) string {
+	if folder == "" {
+		return name
+	}
+	return folder + "/" + name
+}
+
+// parseFileFolderQuery reads the folder and recursive filters of a file
+// listing; ok is false when a response was sent
+func parseFileFolderQuery(c *gin.Context) (folder string, filtered, recursive, ok bool) {
+	value, filtered := c.GetQuery("folder")
+	if !filtered {
+		return "", false, false, true
+	}
+	folder, message := normalizeFolder(value)
+	if message != "" {
+		RespondError(c, http.StatusBadRequest, message)
+		return "", false, false, false
+	}
+	return folder, true, c.Query("recursive") == "true", true
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import "testing"
+
+func TestNormalizeFolder(t *testing.T) {
+	valid := map[string]string{
+		"":               "",
+		"/":              "",
+		" certs/prod/ ":  "certs/prod",
+		"/keytabs":       "keytabs",
+		"configs/bündel": "configs/bündel",
+		"a/b c/d":        "a/b c/d",
+	}
+	for input, want := range valid {
+		if got, message := normalizeFolder(input); message != "" || got != want {
+			t.Errorf("normalizeFolder(%q) = %q, %q, want %q", input, got, message, want)
+		}
+	}
+
+	for _, invalid := range []string{"certs//prod", "certs/../secrets", "./certs", "certs/ prod"} {
+		if _, message := normalizeFolder(invalid); message == "" {
+			t.Errorf("%q accepted", invalid)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"envie-backend/internal/apitime"
+	"envie-backend/internal/auth"
+	"envie-backend/internal/database"
+	"envie-backend/internal/middleware"
+	"envie-backend/internal/models"
+	"envie-backend/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	maxFileShareLifetime = 30 * 24 * time.Hour
+	maxFileShareAccesses = 100
+)
+
+// CreateFileShareRequest - WrappedFEK is the file's FEK wrapped with the share
+// key the recipient gets out of band
+type CreateFileShareRequest struct {
+	WrappedFEK string        `json:"wrappedFek" binding:"required"`
+	ExpiresAt  *apitime.Time `json:"expiresAt" binding:"required"`
+	SingleUse  bool          `json:"singleUse"`
+}
+
+// FileShareResponse describes a file share to project members
+type FileShareResponse struct {
+	ID          uuid.UUID  `json:"id"`
+	FileID      uuid.UUID  `json:"fileId"`
+	FileName    string     `json:"fileName"`
+	URL         string     `json:"url"` // path of the signed URL, relative to the API base URL
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	SingleUse   bool       `json:"singleUse"`
+	UsedAt      *time.Time `json:"usedAt"`
+	RevokedAt   *time.Time `json:"revokedAt"`
+	Downloads   int64      `json:"downloads"`
+	CreatedByID uuid.UUID  `json:"createdById"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+// FileShareContent is served at the signed URL: the encrypted file and its FEK
+// wrapped with the share key
+type FileShareContent struct {
+	Data       string `json:"data"`
+	WrappedFEK string `json:"wrappedFek"`
+	Checksum   string `json:"checksum"`
+	Name       string `json:"name"`
+	MimeType   string `json:"mimeType"`
+}
+
+// fileShareURL is the signed path of a file share. It's signed like public
+// shares, their IDs don't collide.
+func fileShareURL(share *models.FileShare) string {
+	expires := share.ExpiresAt.Unix()
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", auth.SignPublicShare(share.ID, expires))
+	return "/v1/public/files/" + share.ID.String() + "?" + query.Encode()
+}
+
+func toFileShareResponse(share *models.FileShare, fileName string, downloads int64) FileShareResponse {
+	return FileShareResponse{
+		ID:          share.ID,
+		FileID:      share.FileID,
+		FileName:    fileName,
+		URL:         fileShareURL(share),
+		ExpiresAt:   share.ExpiresAt,
+		SingleUse:   share.SingleUse,
+		UsedAt:      share.UsedAt,
+		RevokedAt:   share.RevokedAt,
+		Downloads:   downloads,
+		CreatedByID: share.CreatedByID,
+		CreatedAt:   share.CreatedAt,
+	}
+}
+
+// CreateFileShare creates a time-limited link to one file for someone outside
+// the project, by the same team or organization admins as public shares
+func CreateFileShare(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	fileID, ok := ParseUUIDParam(c, "fileId", "file")
+	if !ok {
+		return
+	}
+
+	var req CreateFileShareRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	now := time.Now()
+	if !req.ExpiresAt.After(now) {
+		RespondBadRequest(c, "expiresAt must be in the future")
+		return
+	}
+	if req.ExpiresAt.Sub(now) > maxFileShareLifetime {
+		RespondBadRequest(c, "File shares can last at most 30 days")
+		return
+	}
+
+	if !checkStorageConfigured(c) {
+		return
+	}
+
+	var file models.ProjectFile
+	if err := requestDB(c).Where("id = ? AND project_id = ?", fileID, projectID).First(&file).Error; err != nil {
+		RespondNotFound(c, "File not found")
+		return
+	}
+
+	var project models.Project
+	if err := requestDB(c).Select("id, organization_id").First(&project, "id = ?", projectID).Error; err != nil {
+		RespondInternalError(c, "Failed to create file share")
+		return
+	}
+
+	share := models.FileShare{
+		ID:          uuid.New(),
+		ProjectID:   projectID,
+		FileID:      fileID,
+		WrappedFEK:  req.WrappedFEK,
+		ExpiresAt:   req.ExpiresAt.Ptr().Truncate(time.Second),
+		SingleUse:   req.SingleUse,
+		CreatedByID: uid,
+	}
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Create(&share).Error; err != nil {
+			return err
+		}
+		return recordAuditEvent(tx, project.OrganizationID, &projectID, uid, models.AuditFileShared, filePath(file.Folder, file.Name), 1)
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to create file share")
+		return
+	}
+
+	RespondCreated(c, toFileShareResponse(&share, file.Name, 0))
+}
+
+// GetFileShares lists the project's file shares, newest first, including the
+// expired and revoked ones whose access logs are kept
+func GetFileShares(c *gin.Context) {
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	var shares []models.FileShare
+	if err := requestDB(c).Preload("File").Where("project_id = ?", projectID).Order("created_at DESC").Find(&shares).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch file shares")
+		return
+	}
+
+	downloads, err := fileShareDownloads(requestDB(c), shares)
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch file shares")
+		return
+	}
+
+	response := make([]FileShareResponse, len(shares))
+	for i := range shares {
+		response[i] = toFileShareResponse(&shares[i], shares[i].File.Name, downloads[shares[i].ID])
+	}
+	RespondOK(c, response)
+}
+
+func fileShareDownloads(db *gorm.DB, shares []models.FileShare) (map[uuid.UUID]int64, error) {
+	downloads := map[uuid.UUID]int64{}
+	if len(shares) == 0 {
+		return downloads, nil
+	}
+	ids := make([]uuid.UUID, len(shares))
+	for i, share := range shares {
+		ids[i] = share.ID
+	}
+
+	var counts []struct {
+		ShareID uuid.UUID
+		Count   int64
+	}
+	if err := db.Model(&models.FileShareAccess{}).
+		Select("share_id, COUNT(*) AS count").
+		Where("share_id IN ? AND outcome = ?", ids, models.FileShareDownloaded).
+		Group("share_id").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	for _, count := range counts {
+		downloads[count.ShareID] = count.Count
+	}
+	return downloads, nil
+}
+
+func requireFileShare(c *gin.Context, projectID uuid.UUID) (*models.FileShare, bool) {
+	shareID, ok := ParseUUIDParam(c, "shareId", "share")
+	if !ok {
+		return nil, false
+	}
+
+	var share models.FileShare
+	if err := requestDB(c).Preload("File").Where("id = ? AND project_id = ?", shareID, projectID).First(&share).Error; err != nil {
+		RespondNotFound(c, "Share not found")
+		return nil, false
+	}
+	return &share, true
+}
+
+// GetFileShareAccesses lists the most recent download attempts of a share
+func GetFileShareAccesses(c *gin.Context) {
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	share, ok := requireFileShare(c, projectID)
+	if !ok {
+		return
+	}
+
+	accesses := []models.FileShareAccess{}
+	if err := requestDB(c).Where("share_id = ?", share.ID).Order("created_at DESC").Limit(maxFileShareAccesses).Find(&accesses).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch share accesses")
+		return
+	}
+
+	RespondOK(c, accesses)
+}
+
+// RevokeFileShare stops a share from working. It's kept for its access log.
+func RevokeFileShare(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	share, ok := requireFileShare(c, projectID)
+	if !ok {
+		return
+	}
+	if share.RevokedAt != nil {
+		RespondMessage(c, "File share revoked")
+		return
+	}
+
+	var project models.Project
+	if err := requestDB(c).Select("id, organization_id").First(&project, "id = ?", projectID).Error; err != nil {
+		RespondInternalError(c, "Failed to revoke file share")
+		return
+	}
+
+	now := time.Now()
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Model(share).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return recordAuditEvent(tx, project.OrganizationID, &projectID, uid, models.AuditFileShareRevoked, filePath(share.File.Folder, share.File.Name), 1)
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to revoke file share")
+		return
+	}
+
+	RespondMessage(c, "File share revoked")
+}
+
+// GetFileShareContent serves a file share at its signed URL without
+// authentication. Every attempt past the signature check is logged.
+func GetFileShareContent(c *gin.Context) {
+	shareID, err := uuid.Parse(c.Param("shareId"))
+	expires, expiresErr := strconv.ParseInt(c.Query("expires"), 10, 64)
+	// Unknown shares and bad signatures look the same
+	if err != nil || expiresErr != nil || !auth.VerifyPublicShare(shareID, expires, c.Query("signature")) {
+		RespondNotFound(c, "Share not found")
+		return
+	}
+
+	var share models.FileShare
+	if err := requestDB(c).Preload("File").Where("id = ?", shareID).First(&share).Error; err != nil || share.File.ID == uuid.Nil {
+		RespondNotFound(c, "Share not found")
+		return
+	}
+
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	logAccess := func(outcome string) {
+		requestDB(c).Create(&models.FileShareAccess{
+			ShareID:   share.ID,
+			Outcome:   outcome,
+			IPAddress: middleware.ClientIP(c),
+			UserAgent: userAgent,
+		})
+	}
+
+	switch {
+	case share.RevokedAt != nil:
+		logAccess(models.FileShareRevoked)
+		RespondError(c, http.StatusGone, "Share has been revoked")
+		return
+	case time.Now().After(share.ExpiresAt):
+		logAccess(models.FileShareExpired)
+		RespondError(c, http.StatusGone, "Share has expired")
+		return
+	}
+
+	if !checkStorageConfigured(c) {
+		return
+	}
+
+	// Claiming a single-use share before the download keeps two concurrent
+	// requests from both getting the file
+	now := time.Now()
+	claim := requestDB(c).Model(&models.FileShare{}).Where("id = ? AND used_at IS NULL", share.ID).Update("used_at", now)
+	if claim.Error != nil {
+		RespondInternalError(c, "Failed to read file share")
+		return
+	}
+	if share.SingleUse && claim.RowsAffected == 0 {
+		logAccess(models.FileShareUsed)
+		RespondError(c, http.StatusGone, "Share has already been used")
+		return
+	}
+
+	data, err := storage.DownloadFile(context.WithoutCancel(c.Request.Context()), share.File.S3Key)
+	if err != nil {
+		if claim.RowsAffected > 0 {
+			requestDB(c).Model(&models.FileShare{}).Where("id = ?", share.ID).Update("used_at", nil)
+		}
+		RespondInternalError(c, "Failed to download file")
+		return
+	}
+	logAccess(models.FileShareDownloaded)
+
+	RespondOK(c, FileShareContent{
+		Data:       base64.StdEncoding.EncodeToString(data),
+		WrappedFEK: share.WrappedFEK,
+		Checksum:   share.File.Checksum,
+		Name:       share.File.Name,
+		MimeType:   share.File.MimeType,
+	})
+}
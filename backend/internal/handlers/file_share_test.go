@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"envie-backend/internal/auth"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestFileShareURL(t *testing.T) {
+	share := &models.FileShare{ID: uuid.New(), ExpiresAt: time.Unix(1800000000, 0)}
+
+	link, err := url.Parse(fileShareURL(share))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Path != "/v1/public/files/"+share.ID.String() {
+		t.Errorf("path = %s", link.Path)
+	}
+	expires, _ := strconv.ParseInt(link.Query().Get("expires"), 10, 64)
+	if expires != 1800000000 || !auth.VerifyPublicShare(share.ID, expires, link.Query().Get("signature")) {
+		t.Errorf("query %s doesn't verify", link.RawQuery)
+	}
+}
+
+func TestGetFileShareContentRejectsBadSignature(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/v1/public/files/:shareId", GetFileShareContent)
+
+	share := &models.FileShare{ID: uuid.New(), ExpiresAt: time.Unix(1800000000, 0)}
+	tampered := strings.Replace(fileShareURL(share), "expires=1800000000", "expires=1900000000", 1)
+
+	for _, path := range []string{tampered, "/v1/public/files/not-a-uuid?expires=0&signature=x"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404", path, w.Code)
+		}
+	}
+}
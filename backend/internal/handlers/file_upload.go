@@ -0,0 +1,511 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"envie-backend/internal/apierror"
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+	"envie-backend/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultMaxFileSize caps the encrypted size of files in organizations
+	// without a file policy
+	DefaultMaxFileSize int64 = 1 << 20
+	// MaxFileSizeLimit is the largest limit an organization can set, the most
+	// S3 takes in a single PUT
+	MaxFileSizeLimit int64 = 5 << 30
+
+	// maxUploadFieldSize caps each form field sent with a file, encryptedFek
+	// being the largest, and uploadFormOverhead all of them with the multipart
+	// framing
+	maxUploadFieldSize = 64 << 10
+	uploadFormOverhead = 1 << 20
+
+	// fileUploadURLExpiry is how long an upload URL accepts the file, and
+	// fileUploadTTL how long the upload can be finalized after it was started
+	fileUploadURLExpiry = 15 * time.Minute
+	fileUploadTTL       = time.Hour
+)
+
+// FilePolicy - the largest file the organization's members can upload, null
+// keeping the deployment's default, and the total size of files the
+// organization can store, null for unlimited
+type FilePolicy struct {
+	MaxFileSizeBytes  *int64 `json:"maxFileSizeBytes" binding:"omitempty,min=1024,max=5368709120"`
+	StorageQuotaBytes *int64 `json:"storageQuotaBytes" binding:"omitempty,min=1048576"`
+}
+
+// FilePolicyResponse - the organization's policy, the default it replaces, the
+// most it can be raised to and the storage used against the quota
+type FilePolicyResponse struct {
+	FilePolicy
+	DefaultMaxFileSizeBytes int64 `json:"defaultMaxFileSizeBytes"`
+	MaxFileSizeLimitBytes   int64 `json:"maxFileSizeLimitBytes"`
+	StorageUsedBytes        int64 `json:"storageUsedBytes"`
+}
+
+// CreateFileUploadRequest - the metadata of a file the client uploads to
+// storage itself. EncryptedSize is the exact size of the encrypted file and
+// SizeBytes the size before encryption.
+type CreateFileUploadRequest struct {
+	Name          string `json:"name" binding:"required,max=255"`
+	Folder        string `json:"folder"`
+	EncryptedSize int64  `json:"encryptedSize" binding:"required,min=1"`
+	SizeBytes     int64  `json:"sizeBytes" binding:"min=0"`
+	MimeType      string `json:"mimeType" binding:"max=100"`
+	EncryptedFEK  string `json:"encryptedFek" binding:"required"`
+	Checksum      string `json:"checksum" binding:"max=64"`
+}
+
+// FileUploadResponse - where to PUT the encrypted file, with the headers the
+// URL was signed for. The upload is finalized with its ID once the PUT is done.
+type FileUploadResponse struct {
+	ID        uuid.UUID         `json:"id"`
+	URL       string            `json:"url"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+func filePolicyResponse(policy FilePolicy, used int64) FilePolicyResponse {
+	return FilePolicyResponse{
+		FilePolicy:              policy,
+		DefaultMaxFileSizeBytes: DefaultMaxFileSize,
+		MaxFileSizeLimitBytes:   MaxFileSizeLimit,
+		StorageUsedBytes:        used,
+	}
+}
+
+// orgMaxFileSize returns the largest encrypted file the organization accepts
+func orgMaxFileSize(db *gorm.DB, orgID uuid.UUID) (int64, error) {
+	var org models.Organization
+	if err := db.Select("id, max_file_size_bytes").First(&org, "id = ?", orgID).Error; err != nil {
+		return 0, err
+	}
+	if org.MaxFileSizeBytes == nil {
+		return DefaultMaxFileSize, nil
+	}
+	return *org.MaxFileSizeBytes, nil
+}
+
+func fileTooLarge(maxSize int64) *apierror.Error {
+	return apierror.New(http.StatusBadRequest, apierror.CodeFileTooLarge, fmt.Sprintf("File too large. Max size is %d bytes", maxSize))
+}
+
+func fileS3Key(projectID, fileID uuid.UUID) string {
+	return fmt.Sprintf("projects/%s/files/%s", projectID.String(), fileID.String())
+}
+
+var errFileTooLarge = errors.New("file too large")
+
+// sizeLimitReader fails with errFileTooLarge once more than n bytes are read,
+// so an oversized file stops its upload instead of being stored first
+type sizeLimitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errFileTooLarge
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, errFileTooLarge
+	}
+	return n, err
+}
+
+// uploadForm is a multipart upload whose file has been stored
+type uploadForm struct {
+	fields   map[string]string
+	fileName string
+	size     int64 // of the encrypted file
+}
+
+// readUploadForm streams the "file" part of the request to s3Key as it's read
+// and collects the other fields, in whichever order they come. Nothing is left
+// in storage when it fails.
+func readUploadForm(ctx context.Context, c *gin.Context, s3Key string, maxSize int64) (form *uploadForm, err error) {
+	if c.Request.ContentLength > maxSize+uploadFormOverhead {
+		return nil, fileTooLarge(maxSize)
+	}
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeBadRequest, "Failed to parse form: "+err.Error())
+	}
+
+	form = &uploadForm{fields: map[string]string{}, size: -1}
+	defer func() {
+		if err != nil && form.size >= 0 {
+			storage.DeleteFile(ctx, s3Key)
+		}
+	}()
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return form, uploadReadError(err, maxSize)
+		}
+
+		if part.FormName() != "file" {
+			value, err := io.ReadAll(&sizeLimitReader{r: part, n: maxUploadFieldSize})
+			if err != nil {
+				return form, uploadReadError(err, maxSize)
+			}
+			form.fields[part.FormName()] = string(value)
+			continue
+		}
+
+		if form.size >= 0 {
+			return form, apierror.New(http.StatusBadRequest, apierror.CodeBadRequest, "Only one file can be uploaded at a time")
+		}
+		form.fileName = part.FileName()
+		size, err := storage.UploadStream(ctx, s3Key, &sizeLimitReader{r: part, n: maxSize}, "application/octet-stream")
+		if err != nil {
+			return form, uploadReadError(err, maxSize)
+		}
+		form.size = size
+	}
+
+	if form.size < 0 {
+		return form, apierror.New(http.StatusBadRequest, apierror.CodeBadRequest, "No file provided")
+	}
+	return form, nil
+}
+
+// uploadReadError reports a failed upload: too large files and broken forms
+// are the client's, anything else the storage's
+func uploadReadError(err error, maxSize int64) error {
+	var tooLarge *http.MaxBytesError
+	if errors.Is(err, errFileTooLarge) || errors.As(err, &tooLarge) {
+		return fileTooLarge(maxSize)
+	}
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		return err
+	}
+	log.Printf("Failed to upload file: %v", err)
+	return apierror.New(http.StatusInternalServerError, apierror.CodeInternal, "Failed to upload file")
+}
+
+// CreateFileUpload starts an upload that goes from the client straight to
+// storage, for files too large to pass through the backend. The returned URL
+// only accepts the declared size; FinalizeFileUpload adds the file once it's
+// stored.
+func CreateFileUpload(c *gin.Context) {
+	if !checkStorageConfigured(c) {
+		return
+	}
+
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID
+
+	var req CreateFileUploadRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	maxSize, err := orgMaxFileSize(requestDB(c), access.Project.OrganizationID)
+	if err != nil {
+		RespondInternalError(c, "Failed to load the file size limit")
+		return
+	}
+	if req.EncryptedSize > maxSize {
+		apierror.Respond(c, fileTooLarge(maxSize))
+		return
+	}
+
+	folder, message := normalizeFolder(req.Folder)
+	if message != "" {
+		RespondBadRequest(c, message)
+		return
+	}
+
+	if req.MimeType == "" {
+		req.MimeType = "application/octet-stream"
+	}
+	if req.SizeBytes == 0 {
+		req.SizeBytes = req.EncryptedSize
+	}
+	if err := checkStorageQuota(requestDB(c), access.Project.OrganizationID, req.SizeBytes); err != nil {
+		RespondAPIError(c, err, "Failed to check the storage quota")
+		return
+	}
+
+	upload := models.FileUpload{
+		ID:            uuid.New(),
+		ProjectID:     projectID,
+		Name:          req.Name,
+		Folder:        folder,
+		SizeBytes:     req.SizeBytes,
+		EncryptedSize: req.EncryptedSize,
+		MimeType:      req.MimeType,
+		EncryptedFEK:  req.EncryptedFEK,
+		Checksum:      req.Checksum,
+		KeyVersion:    access.Project.KeyVersion,
+		UploadedBy:    uid,
+		ExpiresAt:     time.Now().Add(fileUploadTTL),
+	}
+	upload.S3Key = fileS3Key(projectID, upload.ID)
+
+	url, err := storage.PresignUpload(c.Request.Context(), upload.S3Key, upload.EncryptedSize, fileUploadURLExpiry)
+	if err != nil {
+		RespondInternalError(c, "Failed to create the upload URL")
+		return
+	}
+
+	if err := requestDB(c).Create(&upload).Error; err != nil {
+		RespondInternalError(c, "Failed to start the upload")
+		return
+	}
+
+	c.JSON(http.StatusCreated, FileUploadResponse{
+		ID:        upload.ID,
+		URL:       url,
+		Method:    http.MethodPut,
+		Headers:   map[string]string{"Content-Type": "application/octet-stream"},
+		ExpiresAt: time.Now().Add(fileUploadURLExpiry),
+	})
+}
+
+// FinalizeFileUpload adds the file of a direct upload to the project once the
+// client has stored it, after checking it has the declared size
+func FinalizeFileUpload(c *gin.Context) {
+	if !checkStorageConfigured(c) {
+		return
+	}
+
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID
+
+	uploadID, ok := ParseUUIDParam(c, "uploadId", "upload")
+	if !ok {
+		return
+	}
+
+	var upload models.FileUpload
+	if err := requestDB(c).First(&upload, "id = ? AND project_id = ? AND uploaded_by = ?", uploadID, projectID, uid).Error; err != nil {
+		RespondNotFound(c, "Upload not found")
+		return
+	}
+
+	if time.Now().After(upload.ExpiresAt) {
+		RespondError(c, http.StatusGone, "The upload expired, start a new one")
+		return
+	}
+
+	ctx := context.WithoutCancel(c.Request.Context())
+	discard := func() {
+		storage.DeleteFile(ctx, upload.S3Key)
+		requestDB(c).Delete(&upload)
+	}
+
+	// The FEK was encrypted with the key the project had when the upload started
+	if upload.KeyVersion != access.Project.KeyVersion {
+		discard()
+		RespondConflict(c, "The project key was rotated during the upload, encrypt the file again")
+		return
+	}
+
+	size, err := storage.FileSize(ctx, upload.S3Key)
+	if err != nil {
+		RespondBadRequest(c, "The file hasn't been uploaded yet")
+		return
+	}
+	if size != upload.EncryptedSize {
+		discard()
+		RespondBadRequest(c, fmt.Sprintf("The uploaded file has %d bytes, %d were declared", size, upload.EncryptedSize))
+		return
+	}
+
+	// Other uploads may have filled the quota since this one started
+	if err := checkStorageQuota(requestDB(c), access.Project.OrganizationID, upload.SizeBytes); err != nil {
+		discard()
+		RespondAPIError(c, err, "Failed to check the storage quota")
+		return
+	}
+
+	projectFile := models.ProjectFile{
+		ID:           upload.ID,
+		ProjectID:    projectID,
+		Name:         upload.Name,
+		Folder:       upload.Folder,
+		SizeBytes:    upload.SizeBytes,
+		MimeType:     upload.MimeType,
+		S3Key:        upload.S3Key,
+		EncryptedFEK: upload.EncryptedFEK,
+		Checksum:     upload.Checksum,
+		UploadedBy:   uid,
+	}
+
+	err = database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Create(&projectFile).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&upload).Error; err != nil {
+			return err
+		}
+		return recordAuditEvent(tx, access.Project.OrganizationID, &projectID, uid, models.AuditFileUploaded, upload.Name, 1)
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to save file record")
+		return
+	}
+
+	c.JSON(http.StatusCreated, UploadFileResponse{
+		ID:        projectFile.ID,
+		Name:      projectFile.Name,
+		Folder:    projectFile.Folder,
+		SizeBytes: projectFile.SizeBytes,
+	})
+}
+
+// StartFileUploadPurge deletes direct uploads that were never finalized every
+// interval, along with anything the client stored for them
+func StartFileUploadPurge(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := purgeExpiredFileUploads(database.DB, time.Now()); err != nil {
+				log.Printf("Failed to purge expired file uploads: %v", err)
+			} else if n > 0 {
+				log.Printf("Purged %d expired file uploads", n)
+			}
+		}
+	}()
+}
+
+func purgeExpiredFileUploads(db *gorm.DB, now time.Time) (int, error) {
+	var uploads []models.FileUpload
+	if err := db.Where("expires_at <= ?", now).Find(&uploads).Error; err != nil {
+		return 0, err
+	}
+	for _, upload := range uploads {
+		if storage.IsConfigured() {
+			storage.DeleteFile(context.Background(), upload.S3Key)
+		}
+		if err := db.Delete(&upload).Error; err != nil {
+			return 0, err
+		}
+	}
+	return len(uploads), nil
+}
+
+func GetFilePolicy(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	var org models.Organization
+	if err := requestDB(c).Select("id, max_file_size_bytes, storage_quota_bytes").First(&org, "id = ?", orgID).Error; err != nil {
+		RespondNotFound(c, "Organization not found")
+		return
+	}
+
+	used, err := orgStorageUsage(requestDB(c), orgID)
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch storage usage")
+		return
+	}
+
+	RespondOK(c, filePolicyResponse(FilePolicy{MaxFileSizeBytes: org.MaxFileSizeBytes, StorageQuotaBytes: org.StorageQuotaBytes}, used))
+}
+
+// UpdateFilePolicy replaces the organization's file policy. Files already
+// stored are kept when the limits are lowered, even past the quota; only new
+// uploads are refused.
+func UpdateFilePolicy(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	var req FilePolicy
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Organization{}).Where("id = ?", orgID).Updates(map[string]any{
+			"max_file_size_bytes": req.MaxFileSizeBytes,
+			"storage_quota_bytes": req.StorageQuotaBytes,
+		}).Error; err != nil {
+			return err
+		}
+		return recordAuditEvent(tx, orgID, nil, uid, models.AuditFilePolicy, describeFilePolicy(req), 0)
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to update the file policy")
+		return
+	}
+
+	used, err := orgStorageUsage(requestDB(c), orgID)
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch storage usage")
+		return
+	}
+
+	RespondOK(c, filePolicyResponse(req, used))
+}
+
+func describeFilePolicy(policy FilePolicy) string {
+	describe := func(value *int64, unset string) string {
+		if value == nil {
+			return unset
+		}
+		return fmt.Sprintf("%d bytes", *value)
+	}
+	return fmt.Sprintf("max file size %s, storage quota %s",
+		describe(policy.MaxFileSizeBytes, "default"), describe(policy.StorageQuotaBytes, "unlimited"))
+}
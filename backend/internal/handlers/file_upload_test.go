@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"envie-backend/internal/apierror"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSizeLimitReader(t *testing.T) {
+	data, err := io.ReadAll(&sizeLimitReader{r: strings.NewReader("12345"), n: 5})
+	if err != nil || string(data) != "12345" {
+		t.Errorf("at the limit: %q, %v", data, err)
+	}
+
+	_, err = io.ReadAll(&sizeLimitReader{r: strings.NewReader("123456"), n: 5})
+	if !errors.Is(err, errFileTooLarge) {
+		t.Errorf("past the limit: err = %v, want errFileTooLarge", err)
+	}
+}
+
+func TestReadUploadFormRejects(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("encryptedFek", "fek")
+	writer.Close()
+
+	tests := []struct {
+		name          string
+		contentLength int64
+		want          apierror.Code
+	}{
+		{"announced too large", DefaultMaxFileSize + uploadFormOverhead + 1, apierror.CodeFileTooLarge},
+		{"no file", int64(body.Len()), apierror.CodeBadRequest},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/projects/p1/files", bytes.NewReader(body.Bytes()))
+		c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+		c.Request.ContentLength = tt.contentLength
+
+		_, err := readUploadForm(context.Background(), c, "key", DefaultMaxFileSize)
+		if code := apierror.CodeOf(err); code != tt.want {
+			t.Errorf("%s: code = %s (%v), want %s", tt.name, code, err, tt.want)
+		}
+	}
+}
@@ -1,28 +1,42 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 
+	"envie-backend/internal/apierror"
 	"envie-backend/internal/database"
 	"envie-backend/internal/models"
+	"envie-backend/internal/validation"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
+// requestDB returns the database bound to the request's context, so queries are
+// traced under the request's span and give up at its deadline
+func requestDB(c *gin.Context) *gorm.DB {
+	return database.DB.WithContext(c.Request.Context())
+}
+
 // GetAuthUserID extracts the authenticated user's ID from the context.
 // Returns the user ID and a boolean indicating success.
 // If unsuccessful, it sends an error response automatically.
 func GetAuthUserID(c *gin.Context) (uuid.UUID, bool) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		RespondUnauthorized(c, "Unauthorized")
 		return uuid.UUID{}, false
 	}
 
 	uid, ok := userID.(uuid.UUID)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		RespondUnauthorized(c, "Invalid user ID")
 		return uuid.UUID{}, false
 	}
 	
@@ -35,12 +49,12 @@ func GetAuthUserID(c *gin.Context) (uuid.UUID, bool) {
 func ParseUUIDParam(c *gin.Context, param string, entityName string) (uuid.UUID, bool) {
 	idStr := c.Param(param)
 	if idStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": entityName + " ID required"})
+		RespondBadRequest(c, entityName+" ID required")
 		return uuid.UUID{}, false
 	}
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + entityName + " ID"})
+		RespondBadRequest(c, "Invalid "+entityName+" ID")
 		return uuid.UUID{}, false
 	}
 	return id, true
@@ -52,12 +66,12 @@ func ParseUUIDParam(c *gin.Context, param string, entityName string) (uuid.UUID,
 func ParseUUIDQuery(c *gin.Context, param string, entityName string) (uuid.UUID, bool) {
 	idStr := c.Query(param)
 	if idStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": entityName + " ID query parameter required"})
+		RespondBadRequest(c, entityName+" ID query parameter required")
 		return uuid.UUID{}, false
 	}
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + entityName + " ID"})
+		RespondBadRequest(c, "Invalid "+entityName+" ID")
 		return uuid.UUID{}, false
 	}
 	return id, true
@@ -68,8 +82,8 @@ func ParseUUIDQuery(c *gin.Context, param string, entityName string) (uuid.UUID,
 // If unsuccessful, it sends an error response automatically.
 func RequireOrgMembership(c *gin.Context, userID, orgID uuid.UUID) (*models.OrganizationUser, bool) {
 	var orgUser models.OrganizationUser
-	if err := database.DB.Where("organization_id = ? AND user_id = ?", orgID, userID).First(&orgUser).Error; err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+	if err := requestDB(c).Where("organization_id = ? AND user_id = ?", orgID, userID).First(&orgUser).Error; err != nil {
+		RespondCode(c, http.StatusForbidden, apierror.CodeNotOrgMember, "Access denied")
 		return nil, false
 	}
 	return &orgUser, true
@@ -84,7 +98,7 @@ func RequireOrgAdmin(c *gin.Context, userID, orgID uuid.UUID) (*models.Organizat
 		return nil, false
 	}
 	if !IsAdminOrOwner(orgUser.Role) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only organization owners and admins can perform this action"})
+		RespondCode(c, http.StatusForbidden, apierror.CodePermissionDenied, "Only organization owners and admins can perform this action")
 		return nil, false
 	}
 	return orgUser, true
@@ -99,12 +113,33 @@ func RequireOrgOwner(c *gin.Context, userID, orgID uuid.UUID) (*models.Organizat
 		return nil, false
 	}
 	if !IsOwner(orgUser.Role) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only organization owners can perform this action"})
+		RespondCode(c, http.StatusForbidden, apierror.CodePermissionDenied, "Only organization owners can perform this action")
 		return nil, false
 	}
 	return orgUser, true
 }
 
+// RequireOrgPermission checks if the user's organization role grants permission.
+// Returns the OrganizationUser, the user's organization permissions and a
+// boolean indicating success.
+// If unsuccessful, it sends an error response automatically.
+func RequireOrgPermission(c *gin.Context, userID, orgID uuid.UUID, permission string) (*models.OrganizationUser, PermissionSet, bool) {
+	orgUser, ok := RequireOrgMembership(c, userID, orgID)
+	if !ok {
+		return nil, nil, false
+	}
+	permissions, err := GetUserOrgPermissions(userID, orgID)
+	if err != nil {
+		RespondInternalError(c, "Failed to check permissions")
+		return nil, nil, false
+	}
+	if !permissions.Has(permission) {
+		RespondCode(c, http.StatusForbidden, apierror.CodePermissionDenied, "Your role doesn't grant "+permission+" in this organization")
+		return nil, nil, false
+	}
+	return orgUser, permissions, true
+}
+
 // IsAdminOrOwner checks if a role is admin or owner (case-insensitive for owner).
 func IsAdminOrOwner(role string) bool {
 	return role == "owner" || role == "Owner" || role == "admin"
@@ -115,39 +150,108 @@ func IsOwner(role string) bool {
 	return role == "owner" || role == "Owner"
 }
 
-// RespondError sends a JSON error response with the given status and message.
+// BindJSON binds the request body to obj and validates it. Bodies that don't
+// parse or break a binding rule get a 422 listing the failed fields, and bodies
+// over the route's size limit a 413 (see middleware.BodyLimitMiddleware).
+// Returns false when it responded.
+func BindJSON(c *gin.Context, obj any) bool {
+	err := c.ShouldBindJSON(obj)
+	if err == nil {
+		return true
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		RespondCode(c, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, fmt.Sprintf("Request body too large. Max size is %d bytes", tooLarge.Limit))
+		return false
+	}
+
+	fields := validation.Fields(err)
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	message := "Invalid request: " + err.Error()
+	switch {
+	case len(fields) > 0:
+		message = "Invalid request: " + fields[0].Message
+	case errors.Is(err, io.EOF):
+		message = "Request body is required"
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		message = "Request body is not valid JSON"
+	case errors.As(err, &typeErr):
+		fields = []validation.FieldError{{Field: typeErr.Field, Rule: "type", Message: typeErr.Field + " must be " + typeErr.Type.String()}}
+		message = "Invalid request: " + fields[0].Message
+	}
+	if fields == nil {
+		fields = []validation.FieldError{}
+	}
+	c.JSON(http.StatusUnprocessableEntity, apierror.H(apierror.CodeValidationFailed, message, gin.H{"fields": fields}))
+	return false
+}
+
+// RespondError sends a JSON error response with the given status and message,
+// and the generic code of the status.
 func RespondError(c *gin.Context, status int, message string) {
-	c.JSON(status, gin.H{"error": message})
+	c.JSON(status, apierror.Body{Error: message, Code: apierror.ForStatus(status)})
+}
+
+// RespondCode sends a JSON error response with a specific error code.
+func RespondCode(c *gin.Context, status int, code apierror.Code, message string) {
+	c.JSON(status, apierror.Body{Error: message, Code: code})
+}
+
+// RespondAPIError sends err as the response when it is an *apierror.Error, and a
+// 500 with fallback as the message otherwise.
+func RespondAPIError(c *gin.Context, err error, fallback string) {
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		apierror.Respond(c, apiErr)
+		return
+	}
+	RespondInternalError(c, fallback)
 }
 
 // RespondUnauthorized is a shorthand for 401 Unauthorized errors.
 func RespondUnauthorized(c *gin.Context, message string) {
-	c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+	RespondError(c, http.StatusUnauthorized, message)
 }
 
 // RespondBadRequest is a shorthand for 400 Bad Request errors.
 func RespondBadRequest(c *gin.Context, message string) {
-	c.JSON(http.StatusBadRequest, gin.H{"error": message})
+	RespondError(c, http.StatusBadRequest, message)
 }
 
 // RespondForbidden is a shorthand for 403 Forbidden errors.
 func RespondForbidden(c *gin.Context, message string) {
-	c.JSON(http.StatusForbidden, gin.H{"error": message})
+	RespondError(c, http.StatusForbidden, message)
 }
 
 // RespondNotFound is a shorthand for 404 Not Found errors.
 func RespondNotFound(c *gin.Context, message string) {
-	c.JSON(http.StatusNotFound, gin.H{"error": message})
+	RespondError(c, http.StatusNotFound, message)
 }
 
 // RespondConflict is a shorthand for 409 Conflict errors.
 func RespondConflict(c *gin.Context, message string) {
-	c.JSON(http.StatusConflict, gin.H{"error": message})
+	RespondError(c, http.StatusConflict, message)
 }
 
-// RespondInternalError is a shorthand for 500 Internal Server Error.
+// RespondInternalError is a shorthand for 500 Internal Server Error. The message is
+// attached to the context for the error reporter.
 func RespondInternalError(c *gin.Context, message string) {
-	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	c.Error(errors.New(message))
+	// Failed because the request ran past REQUEST_TIMEOUT, most likely waiting on
+	// the database
+	if errors.Is(c.Request.Context().Err(), context.DeadlineExceeded) {
+		RespondError(c, http.StatusServiceUnavailable, "Request timed out")
+		return
+	}
+	RespondError(c, http.StatusInternalServerError, message)
+}
+
+// respondNoProjectAccess responds 403 to a user who can't open a project,
+// without telling whether it exists.
+func respondNoProjectAccess(c *gin.Context) {
+	RespondCode(c, http.StatusForbidden, apierror.CodeProjectAccessDenied, "Project not found or access denied")
 }
 
 // RespondOK sends a JSON response with 200 OK status.
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"envie-backend/internal/apierror"
+	"envie-backend/internal/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBindJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		body   string
+		limit  int64
+		status int
+		code   apierror.Code
+		fields []string
+	}{
+		{"valid", `{"teamId":"6f1c9a4e-8a4b-4c1e-9d55-0c4a3f1b2e7d","encryptedProjectKey":"a2V5"}`, 0, http.StatusOK, "", nil},
+		{"missing fields", `{}`, 0, http.StatusUnprocessableEntity, apierror.CodeValidationFailed, []string{"teamId", "encryptedProjectKey"}},
+		{"not ciphertext", `{"teamId":"6f1c9a4e-8a4b-4c1e-9d55-0c4a3f1b2e7d","encryptedProjectKey":"not base64"}`, 0, http.StatusUnprocessableEntity, apierror.CodeValidationFailed, []string{"encryptedProjectKey"}},
+		{"wrong type", `{"teamId":"6f1c9a4e-8a4b-4c1e-9d55-0c4a3f1b2e7d","encryptedProjectKey":42}`, 0, http.StatusUnprocessableEntity, apierror.CodeValidationFailed, []string{"encryptedProjectKey"}},
+		{"malformed", `{"teamId":`, 0, http.StatusUnprocessableEntity, apierror.CodeValidationFailed, nil},
+		{"empty", ``, 0, http.StatusUnprocessableEntity, apierror.CodeValidationFailed, nil},
+		{"too large", `{"encryptedProjectKey":"` + strings.Repeat("A", 64) + `"}`, 32, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/projects/p1/teams", strings.NewReader(tt.body))
+			if tt.limit > 0 {
+				c.Request.Body = http.MaxBytesReader(w, c.Request.Body, tt.limit)
+			}
+
+			var req AddTeamToProjectRequest
+			if BindJSON(c, &req) {
+				c.Status(http.StatusOK)
+			}
+			c.Writer.WriteHeaderNow()
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status == http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Code   apierror.Code           `json:"code"`
+				Fields []validation.FieldError `json:"fields"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != tt.code {
+				t.Errorf("code = %s, want %s", body.Code, tt.code)
+			}
+			if len(body.Fields) != len(tt.fields) {
+				t.Fatalf("fields = %+v, want %v", body.Fields, tt.fields)
+			}
+			for i, field := range tt.fields {
+				if body.Fields[i].Field != field {
+					t.Errorf("fields[%d] = %s, want %s", i, body.Fields[i].Field, field)
+				}
+			}
+		})
+	}
+}
+
+func TestRespondInternalErrorAfterDeadline(t *testing.T) {
+	c, w := fieldsContext("")
+	ctx, cancel := context.WithDeadline(c.Request.Context(), time.Now().Add(-time.Second))
+	defer cancel()
+	c.Request = c.Request.WithContext(ctx)
+
+	RespondInternalError(c, "Failed to fetch config items")
+	var body struct{ Code apierror.Code }
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusServiceUnavailable || body.Code != apierror.CodeUnavailable {
+		t.Errorf("response = %d %s", w.Code, w.Body)
+	}
+}
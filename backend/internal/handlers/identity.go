@@ -4,16 +4,18 @@ import (
 	"net/http"
 	"time"
 
+	"envie-backend/internal/auth"
 	"envie-backend/internal/database"
 	"envie-backend/internal/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type RegisterDeviceRequest struct {
-	Name               string  `json:"name" binding:"required"`
+	Name               string  `json:"name" binding:"required,max=255,name"`
 	PublicKey          string  `json:"publicKey" binding:"required"`
-	EncryptedMasterKey *string `json:"encryptedMasterKey"`
+	EncryptedMasterKey *string `json:"encryptedMasterKey" binding:"omitempty,ciphertext"`
 }
 
 func RegisterDevice(c *gin.Context) {
@@ -23,13 +25,16 @@ func RegisterDevice(c *gin.Context) {
 	}
 
 	var req RegisterDeviceRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !BindJSON(c, &req) {
 		return
 	}
 
 	var existing models.UserIdentity
-	if err := database.DB.Preload("User").Where("user_id = ? AND public_key = ?", userID, req.PublicKey).First(&existing).Error; err == nil {
+	if err := requestDB(c).Preload("User").Where("user_id = ? AND public_key = ?", userID, req.PublicKey).First(&existing).Error; err == nil {
+		if err := bindSessionToDevice(requestDB(c), c, userID, existing.ID); err != nil {
+			RespondInternalError(c, "Failed to bind the session to the device")
+			return
+		}
 		c.JSON(http.StatusOK, existing)
 		return
 	}
@@ -42,12 +47,18 @@ func RegisterDevice(c *gin.Context) {
 		LastActive:         time.Now(),
 	}
 
-	if err := database.DB.Create(&device).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register device"})
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Create(&device).Error; err != nil {
+			return err
+		}
+		return bindSessionToDevice(tx, c, userID, device.ID)
+	})
+	if err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to register device")
 		return
 	}
 
-	database.DB.Preload("User").First(&device)
+	requestDB(c).Preload("User").First(&device)
 
 	c.JSON(http.StatusCreated, device)
 }
@@ -59,7 +70,7 @@ func GetDevices(c *gin.Context) {
 	}
 
 	var devices []models.UserIdentity
-	if err := database.DB.Preload("User").Where("user_id = ?", userID).Find(&devices).Error; err != nil {
+	if err := requestDB(c).Preload("User").Where("user_id = ?", userID).Find(&devices).Error; err != nil {
 		RespondInternalError(c, "Failed to fetch devices")
 		return
 	}
@@ -73,9 +84,23 @@ func DeleteDevice(c *gin.Context) {
 		return
 	}
 
-	deviceID := c.Param("id")
+	deviceID, ok := ParseUUIDParam(c, "id", "device")
+	if !ok {
+		return
+	}
 
-	if err := database.DB.Where("id = ? AND user_id = ?", deviceID, userID).Delete(&models.UserIdentity{}).Error; err != nil {
+	if !RequireTwoFactor(c, userID, TwoFactorActionDeleteDevice) {
+		return
+	}
+
+	// The sessions signed in on the device end with it
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND user_id = ?", deviceID, userID).Delete(&models.UserIdentity{}).Error; err != nil {
+			return err
+		}
+		return auth.RevokeDeviceRefreshTokens(tx, userID, &deviceID, auth.RevokedSession, time.Now())
+	})
+	if err != nil {
 		RespondInternalError(c, "Failed to delete device")
 		return
 	}
@@ -89,7 +114,17 @@ func DeleteAllDevices(c *gin.Context) {
 		return
 	}
 
-	if err := database.DB.Where("user_id = ?", userID).Delete(&models.UserIdentity{}).Error; err != nil {
+	if !RequireTwoFactor(c, userID, TwoFactorActionDeleteAllDevices) {
+		return
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.UserIdentity{}).Error; err != nil {
+			return err
+		}
+		return auth.RevokeDeviceRefreshTokens(tx, userID, nil, auth.RevokedSession, time.Now())
+	})
+	if err != nil {
 		RespondInternalError(c, "Failed to delete devices")
 		return
 	}
@@ -98,7 +133,7 @@ func DeleteAllDevices(c *gin.Context) {
 }
 
 type UpdateDeviceRequest struct {
-	EncryptedMasterKey *string `json:"encryptedMasterKey"`
+	EncryptedMasterKey *string `json:"encryptedMasterKey" binding:"omitempty,ciphertext"`
 }
 
 func UpdateDevice(c *gin.Context) {
@@ -110,13 +145,12 @@ func UpdateDevice(c *gin.Context) {
 	deviceID := c.Param("id")
 
 	var req UpdateDeviceRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !BindJSON(c, &req) {
 		return
 	}
 
 	var device models.UserIdentity
-	if err := database.DB.Where("id = ? AND user_id = ?", deviceID, userID).First(&device).Error; err != nil {
+	if err := requestDB(c).Where("id = ? AND user_id = ?", deviceID, userID).First(&device).Error; err != nil {
 		RespondNotFound(c, "Device not found")
 		return
 	}
@@ -125,12 +159,12 @@ func UpdateDevice(c *gin.Context) {
 		device.EncryptedMasterKey = req.EncryptedMasterKey
 	}
 
-	if err := database.DB.Save(&device).Error; err != nil {
+	if err := requestDB(c).Save(&device).Error; err != nil {
 		RespondInternalError(c, "Failed to update device")
 		return
 	}
 
-	database.DB.Preload("User").First(&device, "id = ?", device.ID)
+	requestDB(c).Preload("User").First(&device, "id = ?", device.ID)
 
 	RespondOK(c, device)
 }
@@ -0,0 +1,588 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"envie-backend/internal/apierror"
+	"envie-backend/internal/auth"
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+	"envie-backend/internal/settings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Instance administration is for the operators of a self-hosted deployment.
+// Superadmins are the accounts with the superadmin instance role, and those
+// whose email is in SUPERADMIN_EMAILS, which bootstraps the first one.
+
+// InstanceOrganization - an organization as instance administrators list it
+type InstanceOrganization struct {
+	ID                uuid.UUID         `json:"id"`
+	Name              string            `json:"name"`
+	MemberCount       int64             `json:"memberCount"`
+	ProjectCount      int64             `json:"projectCount"`
+	StorageBytes      int64             `json:"storageBytes"`
+	StorageQuotaBytes *int64            `json:"storageQuotaBytes"`
+	PlanLimits        models.PlanLimits `json:"planLimits"` // overrides of the instance's limits
+	CreatedAt         time.Time         `json:"createdAt"`
+}
+
+type InstanceOrganizationPage struct {
+	Items      []InstanceOrganization `json:"items"`
+	NextCursor string                 `json:"nextCursor,omitempty"`
+}
+
+// InstanceUser - an account as instance administrators list it. Superadmin is
+// true for accounts given the role and those listed in SUPERADMIN_EMAILS.
+type InstanceUser struct {
+	ID                uuid.UUID  `json:"id"`
+	Name              string     `json:"name"`
+	Email             string     `json:"email"`
+	GithubID          int64      `json:"githubId"`
+	GoogleID          string     `json:"googleId"`
+	InstanceRole      string     `json:"instanceRole"`
+	Superadmin        bool       `json:"superadmin"`
+	TwoFactorEnabled  bool       `json:"twoFactorEnabled"`
+	OrganizationCount int64      `json:"organizationCount"`
+	DisabledAt        *time.Time `json:"disabledAt"`
+	CreatedAt         time.Time  `json:"createdAt"`
+}
+
+type InstanceUserPage struct {
+	Items      []InstanceUser `json:"items"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+}
+
+type UpdateInstanceRoleRequest struct {
+	Role string `json:"role" binding:"omitempty,oneof=superadmin"` // "" removes the role
+}
+
+// InstanceMetrics are totals across the instance
+type InstanceMetrics struct {
+	Users            int64 `json:"users"`
+	DisabledUsers    int64 `json:"disabledUsers"`
+	Organizations    int64 `json:"organizations"`
+	Projects         int64 `json:"projects"`
+	CLITokens        int64 `json:"cliTokens"`
+	ActiveSessions   int64 `json:"activeSessions"`
+	Files            int64 `json:"files"`
+	StorageBytes     int64 `json:"storageBytes"`
+	PendingRotations int64 `json:"pendingRotations"`
+}
+
+// InstanceRevokeTokensRequest selects CLI tokens across the instance. The
+// filters of RevokeTokensRequest combine with tokenIds and organizationId; all
+// with nothing else revokes every token of the instance.
+type InstanceRevokeTokensRequest struct {
+	TokenIDs       []uuid.UUID `json:"tokenIds" binding:"omitempty,max=500"`
+	OrganizationID *uuid.UUID  `json:"organizationId"`
+	RevokeTokensRequest
+}
+
+type InstanceEventPage struct {
+	Items      []models.InstanceEvent `json:"items"`
+	NextCursor string                 `json:"nextCursor,omitempty"`
+}
+
+// isSuperadmin reports whether user administers the instance. Emails only
+// count for GitHub and Google accounts, whose providers verified them;
+// otherwise an organization's SSO provider could claim the address.
+func isSuperadmin(user *models.User, emails []string) bool {
+	if user.InstanceRole == models.InstanceRoleSuperadmin {
+		return true
+	}
+	if user.GithubID == 0 && user.GoogleID == "" {
+		return false
+	}
+	return slices.Contains(emails, strings.ToLower(user.Email))
+}
+
+// RequireSuperadmin checks that the user administers the instance.
+// If unsuccessful, it sends an error response automatically.
+func RequireSuperadmin(c *gin.Context, userID uuid.UUID) bool {
+	var user models.User
+	if err := requestDB(c).Select("id, email, github_id, google_id, instance_role").First(&user, "id = ?", userID).Error; err != nil {
+		RespondInternalError(c, "Failed to check permissions")
+		return false
+	}
+	if !isSuperadmin(&user, settings.Current().SuperadminEmails) {
+		RespondCode(c, http.StatusForbidden, apierror.CodePermissionDenied, "Only instance administrators can perform this action")
+		return false
+	}
+	return true
+}
+
+// requireSuperadminUser authenticates the request and checks that the caller
+// administers the instance
+func requireSuperadminUser(c *gin.Context) (uuid.UUID, bool) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return uid, false
+	}
+	return uid, RequireSuperadmin(c, uid)
+}
+
+// likePattern matches values containing q, with LIKE's wildcards escaped
+func likePattern(q string) string {
+	q = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(q))
+	return "%" + q + "%"
+}
+
+func recordInstanceEvent(db *gorm.DB, actorID uuid.UUID, action string, target *uuid.UUID, detail string, count int) error {
+	return db.Create(&models.InstanceEvent{
+		ActorID:      actorID,
+		Action:       action,
+		TargetUserID: target,
+		Detail:       detail,
+		Count:        count,
+	}).Error
+}
+
+// countsByID runs query, which selects an id and a count grouped by it
+func countsByID(query *gorm.DB) (map[uuid.UUID]int64, error) {
+	var rows []struct {
+		ID    uuid.UUID
+		Count int64
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[uuid.UUID]int64, len(rows))
+	for _, row := range rows {
+		counts[row.ID] = row.Count
+	}
+	return counts, nil
+}
+
+// ListInstanceOrganizations lists every organization, newest first, with its
+// size. q filters by name.
+func ListInstanceOrganizations(c *gin.Context) {
+	if _, ok := requireSuperadminUser(c); !ok {
+		return
+	}
+
+	page, ok := RequestedPage(c)
+	if !ok {
+		return
+	}
+
+	query := requestDB(c).Model(&models.Organization{})
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		query = query.Where(`LOWER(name) LIKE ? ESCAPE '\'`, likePattern(q))
+	}
+	var orgs []models.Organization
+	if err := page.Apply(query, "organizations").Find(&orgs).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch organizations")
+		return
+	}
+
+	var response InstanceOrganizationPage
+	orgs, response.NextCursor = pageItems(page, orgs, func(o *models.Organization) (time.Time, uuid.UUID) {
+		return o.CreatedAt, o.ID
+	})
+	ids := make([]uuid.UUID, len(orgs))
+	for i, org := range orgs {
+		ids[i] = org.ID
+	}
+
+	db := requestDB(c)
+	members, err := countsByID(db.Model(&models.OrganizationUser{}).
+		Select("organization_id AS id, COUNT(*) AS count").Where("organization_id IN ?", ids).Group("organization_id"))
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch organizations")
+		return
+	}
+	projects, err := countsByID(db.Model(&models.Project{}).
+		Select("organization_id AS id, COUNT(*) AS count").Where("organization_id IN ?", ids).Group("organization_id"))
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch organizations")
+		return
+	}
+	// Counted like orgStorageUsage
+	storage, err := countsByID(db.Model(&models.ProjectFile{}).
+		Joins("JOIN projects ON projects.id = project_files.project_id AND projects.deleted_at IS NULL").
+		Select("projects.organization_id AS id, COALESCE(SUM(project_files.size_bytes), 0) AS count").
+		Where("projects.organization_id IN ?", ids).
+		Group("projects.organization_id"))
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch organizations")
+		return
+	}
+
+	response.Items = make([]InstanceOrganization, len(orgs))
+	for i, org := range orgs {
+		response.Items[i] = InstanceOrganization{
+			ID:                org.ID,
+			Name:              org.Name,
+			MemberCount:       members[org.ID],
+			ProjectCount:      projects[org.ID],
+			StorageBytes:      storage[org.ID],
+			StorageQuotaBytes: org.StorageQuotaBytes,
+			PlanLimits:        org.PlanLimits,
+			CreatedAt:         org.CreatedAt,
+		}
+	}
+	RespondOK(c, response)
+}
+
+// ListInstanceUsers lists every account, newest first. q filters by name or
+// email, disabled=true or false by whether the account is disabled.
+func ListInstanceUsers(c *gin.Context) {
+	if _, ok := requireSuperadminUser(c); !ok {
+		return
+	}
+
+	page, ok := RequestedPage(c)
+	if !ok {
+		return
+	}
+
+	query := requestDB(c).Model(&models.User{})
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := likePattern(q)
+		query = query.Where(`(LOWER(name) LIKE ? ESCAPE '\' OR LOWER(email) LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+	if value := c.Query("disabled"); value != "" {
+		disabled, err := strconv.ParseBool(value)
+		if err != nil {
+			RespondBadRequest(c, "disabled must be true or false")
+			return
+		}
+		if disabled {
+			query = query.Where("disabled_at IS NOT NULL")
+		} else {
+			query = query.Where("disabled_at IS NULL")
+		}
+	}
+	var users []models.User
+	if err := page.Apply(query, "users").Find(&users).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch users")
+		return
+	}
+
+	var response InstanceUserPage
+	users, response.NextCursor = pageItems(page, users, func(u *models.User) (time.Time, uuid.UUID) {
+		return u.CreatedAt, u.ID
+	})
+	ids := make([]uuid.UUID, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	memberships, err := countsByID(requestDB(c).Model(&models.OrganizationUser{}).
+		Select("user_id AS id, COUNT(*) AS count").Where("user_id IN ?", ids).Group("user_id"))
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch users")
+		return
+	}
+
+	emails := settings.Current().SuperadminEmails
+	response.Items = make([]InstanceUser, len(users))
+	for i := range users {
+		response.Items[i] = toInstanceUser(&users[i], emails, memberships[users[i].ID])
+	}
+	RespondOK(c, response)
+}
+
+// respondInstanceUser sends user as InstanceUser
+func respondInstanceUser(c *gin.Context, user *models.User) {
+	var organizations int64
+	if err := requestDB(c).Model(&models.OrganizationUser{}).Where("user_id = ?", user.ID).Count(&organizations).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch user")
+		return
+	}
+	RespondOK(c, toInstanceUser(user, settings.Current().SuperadminEmails, organizations))
+}
+
+func toInstanceUser(user *models.User, emails []string, organizations int64) InstanceUser {
+	return InstanceUser{
+		ID:                user.ID,
+		Name:              user.Name,
+		Email:             user.Email,
+		GithubID:          user.GithubID,
+		GoogleID:          user.GoogleID,
+		InstanceRole:      user.InstanceRole,
+		Superadmin:        isSuperadmin(user, emails),
+		TwoFactorEnabled:  user.TwoFactorEnabled,
+		OrganizationCount: organizations,
+		DisabledAt:        user.DisabledAt,
+		CreatedAt:         user.CreatedAt,
+	}
+}
+
+// requireInstanceTargetUser loads the account in the userId parameter. A
+// superadmin can't change their own account, so they can't lock themselves out.
+func requireInstanceTargetUser(c *gin.Context, uid uuid.UUID) (*models.User, bool) {
+	userID, ok := ParseUUIDParam(c, "userId", "user")
+	if !ok {
+		return nil, false
+	}
+	if userID == uid {
+		RespondBadRequest(c, "You can't change your own account")
+		return nil, false
+	}
+
+	var user models.User
+	if err := requestDB(c).First(&user, "id = ?", userID).Error; err != nil {
+		RespondNotFound(c, "User not found")
+		return nil, false
+	}
+	return &user, true
+}
+
+// DisableInstanceUser disables an account: its sessions end and it can't sign
+// in again until it's enabled. Its organizations, keys and tokens are kept.
+func DisableInstanceUser(c *gin.Context) {
+	uid, ok := requireSuperadminUser(c)
+	if !ok {
+		return
+	}
+
+	user, ok := requireInstanceTargetUser(c, uid)
+	if !ok {
+		return
+	}
+	if user.DisabledAt != nil {
+		respondInstanceUser(c, user)
+		return
+	}
+
+	now := time.Now()
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("disabled_at", now).Error; err != nil {
+			return err
+		}
+		sessions, err := auth.RevokeUserRefreshTokens(tx, user.ID, auth.RevokedDisabled, now)
+		if err != nil {
+			return err
+		}
+		return recordInstanceEvent(tx, uid, models.InstanceUserDisabled, &user.ID, user.Email, int(sessions))
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to disable user")
+		return
+	}
+	user.DisabledAt = &now
+
+	respondInstanceUser(c, user)
+}
+
+// EnableInstanceUser lets a disabled account sign in again
+func EnableInstanceUser(c *gin.Context) {
+	uid, ok := requireSuperadminUser(c)
+	if !ok {
+		return
+	}
+
+	user, ok := requireInstanceTargetUser(c, uid)
+	if !ok {
+		return
+	}
+	if user.DisabledAt == nil {
+		respondInstanceUser(c, user)
+		return
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("disabled_at", nil).Error; err != nil {
+			return err
+		}
+		return recordInstanceEvent(tx, uid, models.InstanceUserEnabled, &user.ID, user.Email, 0)
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to enable user")
+		return
+	}
+	user.DisabledAt = nil
+
+	respondInstanceUser(c, user)
+}
+
+// UpdateInstanceUserRole grants or removes the superadmin role. Accounts in
+// SUPERADMIN_EMAILS stay superadmins without it.
+func UpdateInstanceUserRole(c *gin.Context) {
+	uid, ok := requireSuperadminUser(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateInstanceRoleRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	user, ok := requireInstanceTargetUser(c, uid)
+	if !ok {
+		return
+	}
+
+	if user.InstanceRole != req.Role {
+		detail := user.Email + ": " + roleName(user.InstanceRole) + " -> " + roleName(req.Role)
+		err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+			if err := tx.Model(user).Update("instance_role", req.Role).Error; err != nil {
+				return err
+			}
+			return recordInstanceEvent(tx, uid, models.InstanceRoleChanged, &user.ID, detail, 0)
+		})
+		if err != nil {
+			RespondInternalError(c, "Failed to update instance role")
+			return
+		}
+		user.InstanceRole = req.Role
+	}
+
+	respondInstanceUser(c, user)
+}
+
+func roleName(role string) string {
+	if role == "" {
+		return "none"
+	}
+	return role
+}
+
+// GetInstanceMetrics counts what the instance holds
+func GetInstanceMetrics(c *gin.Context) {
+	if _, ok := requireSuperadminUser(c); !ok {
+		return
+	}
+
+	db := requestDB(c)
+	now := time.Now()
+	var metrics InstanceMetrics
+	counts := []struct {
+		query *gorm.DB
+		into  *int64
+	}{
+		{db.Model(&models.User{}), &metrics.Users},
+		{db.Model(&models.User{}).Where("disabled_at IS NOT NULL"), &metrics.DisabledUsers},
+		{db.Model(&models.Organization{}), &metrics.Organizations},
+		{db.Model(&models.Project{}), &metrics.Projects},
+		{db.Model(&models.ProjectToken{}), &metrics.CLITokens},
+		{db.Model(&models.RefreshToken{}).Where("revoked_at IS NULL AND expires_at > ?", now), &metrics.ActiveSessions},
+		{db.Model(&models.ProjectFile{}), &metrics.Files},
+		{db.Model(&models.PendingKeyRotation{}).Where("status = ?", "pending"), &metrics.PendingRotations},
+	}
+	for _, count := range counts {
+		if err := count.query.Count(count.into).Error; err != nil {
+			RespondInternalError(c, "Failed to count")
+			return
+		}
+	}
+	if err := db.Model(&models.ProjectFile{}).Select("COALESCE(SUM(size_bytes), 0)").Scan(&metrics.StorageBytes).Error; err != nil {
+		RespondInternalError(c, "Failed to count")
+		return
+	}
+
+	RespondOK(c, metrics)
+}
+
+func (r InstanceRevokeTokensRequest) describe() string {
+	if r.RevokeTokensRequest.empty() {
+		return "tokens by ID"
+	}
+	detail := r.RevokeTokensRequest.describe()
+	if len(r.TokenIDs) > 0 {
+		detail += ", by ID"
+	}
+	return detail
+}
+
+// RevokeInstanceTokens revokes CLI tokens in any organization. Each affected
+// organization gets a tokens_revoked event in its audit log.
+func RevokeInstanceTokens(c *gin.Context) {
+	uid, ok := requireSuperadminUser(c)
+	if !ok {
+		return
+	}
+
+	var req InstanceRevokeTokensRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+	if len(req.TokenIDs) == 0 && req.RevokeTokensRequest.empty() {
+		RespondBadRequest(c, "Set tokenIds, all, createdBy, olderThanDays or neverUsed")
+		return
+	}
+	if req.All && (len(req.TokenIDs) > 0 || req.CreatedBy != nil || req.OlderThanDays != nil || req.NeverUsed) {
+		RespondBadRequest(c, "all can only be combined with organizationId")
+		return
+	}
+
+	var revoked []struct {
+		ID             uuid.UUID
+		OrganizationID uuid.UUID
+	}
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		query := tx.Model(&models.ProjectToken{}).Joins("JOIN projects ON projects.id = project_tokens.project_id")
+		if len(req.TokenIDs) > 0 {
+			query = query.Where("project_tokens.id IN ?", req.TokenIDs)
+		}
+		if req.OrganizationID != nil {
+			query = query.Where("projects.organization_id = ?", *req.OrganizationID)
+		}
+		if err := req.apply(query, time.Now()).Select("project_tokens.id, projects.organization_id").Scan(&revoked).Error; err != nil {
+			return err
+		}
+		if len(revoked) == 0 {
+			return nil
+		}
+
+		ids := make([]uuid.UUID, len(revoked))
+		perOrg := map[uuid.UUID]int{}
+		for i, token := range revoked {
+			ids[i] = token.ID
+			perOrg[token.OrganizationID]++
+		}
+		if err := tx.Where("id IN ?", ids).Delete(&models.ProjectToken{}).Error; err != nil {
+			return err
+		}
+		detail := "Instance administrator revoked " + req.describe()
+		for orgID, count := range perOrg {
+			if err := recordAuditEvent(tx, orgID, nil, uid, models.AuditTokensRevoked, detail, count); err != nil {
+				return err
+			}
+		}
+		return recordInstanceEvent(tx, uid, models.InstanceTokensRevoked, nil, "Revoked "+req.describe(), len(ids))
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to revoke tokens")
+		return
+	}
+
+	response := RevokeTokensResponse{Revoked: len(revoked), TokenIDs: make([]uuid.UUID, len(revoked))}
+	for i, token := range revoked {
+		response.TokenIDs[i] = token.ID
+	}
+	RespondOK(c, response)
+}
+
+// GetInstanceEvents lists what superadmins did, newest first
+func GetInstanceEvents(c *gin.Context) {
+	if _, ok := requireSuperadminUser(c); !ok {
+		return
+	}
+
+	page, ok := RequestedPage(c)
+	if !ok {
+		return
+	}
+
+	var events []models.InstanceEvent
+	if err := page.Apply(requestDB(c).Model(&models.InstanceEvent{}), "instance_events").Find(&events).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch instance events")
+		return
+	}
+
+	var response InstanceEventPage
+	response.Items, response.NextCursor = pageItems(page, events, func(e *models.InstanceEvent) (time.Time, uuid.UUID) {
+		return e.CreatedAt, e.ID
+	})
+	RespondOK(c, response)
+}
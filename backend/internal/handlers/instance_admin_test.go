@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"testing"
+
+	"envie-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestIsSuperadmin(t *testing.T) {
+	emails := []string{"ops@example.com"}
+	tests := []struct {
+		name string
+		user models.User
+		want bool
+	}{
+		{"role", models.User{Email: "someone@example.com", InstanceRole: models.InstanceRoleSuperadmin}, true},
+		{"listed GitHub account", models.User{Email: "Ops@Example.com", GithubID: 42}, true},
+		{"listed Google account", models.User{Email: "ops@example.com", GoogleID: "1234"}, true},
+		{"listed SSO-only account", models.User{Email: "ops@example.com"}, false},
+		{"unlisted", models.User{Email: "dev@example.com", GithubID: 7}, false},
+	}
+	for _, tt := range tests {
+		if got := isSuperadmin(&tt.user, emails); got != tt.want {
+			t.Errorf("%s: isSuperadmin() = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLikePattern(t *testing.T) {
+	if got, want := likePattern(`Ops_100%\`), `%ops\_100\%\\%`; got != want {
+		t.Errorf("likePattern() = %q, want %q", got, want)
+	}
+}
+
+func TestInstanceRevokeTokensRequestDescribe(t *testing.T) {
+	days := 30
+	tests := []struct {
+		req  InstanceRevokeTokensRequest
+		want string
+	}{
+		{InstanceRevokeTokensRequest{TokenIDs: []uuid.UUID{uuid.New()}}, "tokens by ID"},
+		{InstanceRevokeTokensRequest{RevokeTokensRequest: RevokeTokensRequest{All: true}}, "all tokens"},
+		{InstanceRevokeTokensRequest{TokenIDs: []uuid.UUID{uuid.New()}, RevokeTokensRequest: RevokeTokensRequest{OlderThanDays: &days}}, "tokens older than 30 days, by ID"},
+	}
+	for _, tt := range tests {
+		if got := tt.req.describe(); got != tt.want {
+			t.Errorf("describe() = %q, want %q", got, tt.want)
+		}
+	}
+}
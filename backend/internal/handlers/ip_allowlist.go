@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/ipallowlist"
+	"envie-backend/internal/middleware"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// IPAllowlist - the ranges members of the organization may use the API from;
+// empty allows anywhere
+type IPAllowlist struct {
+	AllowedCIDRs []string `json:"allowedCidrs" binding:"max=100"`
+}
+
+func GetIPAllowlist(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	var org models.Organization
+	if err := requestDB(c).Select("id, allowed_cidrs").First(&org, "id = ?", orgID).Error; err != nil {
+		RespondNotFound(c, "Organization not found")
+		return
+	}
+
+	if org.AllowedCIDRs == nil {
+		org.AllowedCIDRs = []string{}
+	}
+	RespondOK(c, IPAllowlist{AllowedCIDRs: org.AllowedCIDRs})
+}
+
+// UpdateIPAllowlist replaces the organization's allowlist. The caller's own
+// address has to be inside the new ranges, so an admin can't lock themselves out.
+func UpdateIPAllowlist(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	var req IPAllowlist
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	cidrs, err := normalizeAllowedCIDRs(req.AllowedCIDRs)
+	if err != nil {
+		RespondBadRequest(c, err.Error())
+		return
+	}
+
+	restriction := ipallowlist.Restriction{OrganizationID: orgID}
+	for _, cidr := range cidrs {
+		restriction.Ranges = append(restriction.Ranges, netip.MustParsePrefix(cidr))
+	}
+	if clientIP := middleware.ClientIP(c); len(cidrs) > 0 && !restriction.Allows(clientIP) {
+		RespondConflict(c, fmt.Sprintf("Your address %s is outside these ranges; include it to keep access", clientIP))
+		return
+	}
+
+	detail := "removed"
+	if len(cidrs) > 0 {
+		detail = strings.Join(cidrs, ", ")
+		if len(detail) > 500 {
+			detail = fmt.Sprintf("%d ranges", len(cidrs))
+		}
+	}
+	err = database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		org := models.Organization{ID: orgID, AllowedCIDRs: cidrs}
+		if err := tx.Model(&org).Select("allowed_cidrs").Updates(&org).Error; err != nil {
+			return err
+		}
+		return recordAuditEvent(tx, orgID, nil, uid, models.AuditIPAllowlist, detail, len(cidrs))
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to update the IP allowlist")
+		return
+	}
+	ipallowlist.Invalidate()
+
+	RespondOK(c, IPAllowlist{AllowedCIDRs: cidrs})
+}
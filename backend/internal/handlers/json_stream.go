@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamBufferSize is how much of a streamed array is buffered before it is
+// written to the client, and so the first write CompressionMiddleware sees
+const streamBufferSize = 32 << 10
+
+// jsonArrayStream writes a JSON array to the response one element at a time,
+// so large lists aren't marshalled whole in memory first. Once the first byte
+// is out the status can't change: an error midway is logged and the array left
+// unclosed, so the client fails to parse it rather than taking it as complete.
+type jsonArrayStream struct {
+	c      *gin.Context
+	fields FieldSet
+	out    *bufio.Writer
+	count  int
+}
+
+// startJSONArray sends 200 OK and opens the array. Elements keep only the
+// selected fields, as with RespondFields.
+func startJSONArray(c *gin.Context, fields FieldSet) *jsonArrayStream {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Status(http.StatusOK)
+	out := bufio.NewWriterSize(c.Writer, streamBufferSize)
+	out.WriteByte('[')
+	return &jsonArrayStream{c: c, fields: fields, out: out}
+}
+
+// Write appends an element
+func (s *jsonArrayStream) Write(element any) error {
+	encoded, err := json.Marshal(element)
+	if err != nil {
+		return err
+	}
+	if s.fields != nil {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(encoded, &object); err != nil {
+			return err
+		}
+		s.fields.filter(object)
+		if encoded, err = json.Marshal(object); err != nil {
+			return err
+		}
+	}
+
+	if s.count > 0 {
+		s.out.WriteByte(',')
+	}
+	s.count++
+	_, err = s.out.Write(encoded)
+	return err
+}
+
+// Close ends the array, or after a failure leaves it open and logs err
+func (s *jsonArrayStream) Close(err error) {
+	if err != nil {
+		log.Printf("Failed to stream %s after %d elements: %v", s.c.FullPath(), s.count, err)
+		s.c.Abort()
+	} else {
+		s.out.WriteByte(']')
+	}
+	s.out.Flush()
+}
+
+// RespondList sends items as a JSON array with 200 OK like RespondFields,
+// encoding one element at a time
+func RespondList[T any](c *gin.Context, fields FieldSet, items []T) {
+	stream := startJSONArray(c, fields)
+	for i := range items {
+		if err := stream.Write(&items[i]); err != nil {
+			stream.Close(err)
+			return
+		}
+	}
+	stream.Close(nil)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// sampleConfigItems is the config of a large project, for comparing streamed
+// responses with marshalled ones
+func sampleConfigItems(n int) []models.ConfigItem {
+	projectID := uuid.New()
+	items := make([]models.ConfigItem, n)
+	for i := range items {
+		items[i] = models.ConfigItem{
+			ID:        uuid.New(),
+			ProjectID: projectID,
+			Name:      fmt.Sprintf("SERVICE_%d_URL", i),
+			Value:     "AQIDBAUGBwgJCgsMDQ4PEBESExQVFhcYGRobHB0eHyAhIiMkJSYnKCkqKywtLi8w",
+			Position:  i,
+		}
+	}
+	return items
+}
+
+func TestRespondListMatchesMarshal(t *testing.T) {
+	items := sampleConfigItems(3)
+	c, w := fieldsContext("")
+	RespondList(c, nil, items)
+
+	want, _ := json.Marshal(items)
+	if w.Code != http.StatusOK || w.Body.String() != string(want) {
+		t.Errorf("response = %d %s, want %s", w.Code, w.Body, want)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+}
+
+func TestRespondListEmpty(t *testing.T) {
+	c, w := fieldsContext("")
+	RespondList[models.ConfigItem](c, nil, nil)
+	if w.Body.String() != "[]" {
+		t.Errorf("response = %s, want []", w.Body)
+	}
+}
+
+func TestRespondListFields(t *testing.T) {
+	c, w := fieldsContext("?fields=id,role")
+	fields, ok := RequestedFields(c, []OrganizationUser{})
+	if !ok {
+		t.Fatal("valid fields rejected")
+	}
+	RespondList(c, fields, []OrganizationUser{{Name: "Ada", Role: "admin"}, {Name: "Grace", Role: "member"}})
+
+	want := `[{"id":"00000000-0000-0000-0000-000000000000","role":"admin"},{"id":"00000000-0000-0000-0000-000000000000","role":"member"}]`
+	if w.Body.String() != want {
+		t.Errorf("response = %s, want %s", w.Body, want)
+	}
+}
+
+func TestJSONArrayStreamFailureLeavesArrayOpen(t *testing.T) {
+	c, w := fieldsContext("")
+	stream := startJSONArray(c, nil)
+	stream.Write(map[string]string{"name": "A"})
+	stream.Close(errors.New("connection reset"))
+
+	var decoded []map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &decoded); err == nil {
+		t.Errorf("truncated response parsed as complete: %s", w.Body)
+	}
+	if !c.IsAborted() {
+		t.Error("context not aborted")
+	}
+}
+
+func benchmarkConfigList(b *testing.B, respond func(*gin.Context, []models.ConfigItem)) {
+	gin.SetMode(gin.TestMode)
+	items := sampleConfigItems(5000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	size := 0
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/config", nil)
+		respond(c, items)
+		size = w.Body.Len()
+	}
+	b.ReportMetric(float64(size), "bytes/response")
+}
+
+func BenchmarkConfigListMarshal(b *testing.B) {
+	benchmarkConfigList(b, func(c *gin.Context, items []models.ConfigItem) { RespondOK(c, items) })
+}
+
+func BenchmarkConfigListStream(b *testing.B) {
+	benchmarkConfigList(b, func(c *gin.Context, items []models.ConfigItem) { RespondList(c, nil, items) })
+}
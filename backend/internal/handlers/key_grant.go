@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"time"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// KeyGrantResponse - a pending team key grant with what a client needs to
+// fulfill it: the member's public key, and the team key encrypted with the
+// organization key and, if the requester is in the team, with their own key
+type KeyGrantResponse struct {
+	ID                        uuid.UUID `json:"id"`
+	TeamID                    uuid.UUID `json:"teamId"`
+	TeamName                  string    `json:"teamName"`
+	UserID                    uuid.UUID `json:"userId"`
+	UserName                  string    `json:"userName"`
+	UserEmail                 string    `json:"userEmail"`
+	UserPublicKey             *string   `json:"userPublicKey"`
+	TeamEncryptedKey          string    `json:"teamEncryptedKey"`                    // encrypted with the organization key
+	RequesterEncryptedTeamKey *string   `json:"requesterEncryptedTeamKey,omitempty"` // encrypted with the requester's key
+	RequestedBy               uuid.UUID `json:"requestedBy"`
+	CreatedAt                 time.Time `json:"createdAt"`
+}
+
+type FulfillKeyGrant struct {
+	GrantID          uuid.UUID `json:"grantId" binding:"required"`
+	EncryptedTeamKey string    `json:"encryptedTeamKey" binding:"required,ciphertext"`
+}
+
+type FulfillKeyGrantsRequest struct {
+	Grants []FulfillKeyGrant `json:"grants" binding:"required,min=1,max=500,dive"`
+}
+
+// KeyGrantResult - the outcome of fulfilling one grant; Error is set when it
+// wasn't
+type KeyGrantResult struct {
+	GrantID   uuid.UUID `json:"grantId"`
+	Fulfilled bool      `json:"fulfilled"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type FulfillKeyGrantsResponse struct {
+	Results []KeyGrantResult `json:"results"`
+}
+
+// pendingGrants selects the organization's grants whose member is still in the
+// team without a key; grants of earlier memberships are left out
+func pendingGrants(db *gorm.DB, orgID uuid.UUID) *gorm.DB {
+	return db.Table("pending_key_grants").
+		Joins("JOIN team_users ON team_users.team_id = pending_key_grants.team_id AND team_users.user_id = pending_key_grants.user_id").
+		Joins("JOIN teams ON teams.id = pending_key_grants.team_id AND teams.deleted_at IS NULL").
+		Where("pending_key_grants.organization_id = ? AND team_users.encrypted_team_key = ''", orgID)
+}
+
+// GetKeyGrants lists the pending grants the requester can fulfill: all of them
+// for organization admins, those of the teams they manage otherwise
+func GetKeyGrants(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	orgUser, ok := RequireOrgMembership(c, uid, orgID)
+	if !ok {
+		return
+	}
+
+	query := pendingGrants(requestDB(c), orgID).
+		Select(`pending_key_grants.id, pending_key_grants.team_id, teams.name AS team_name,
+			pending_key_grants.user_id, users.name AS user_name, users.email AS user_email, users.public_key AS user_public_key,
+			teams.encrypted_key AS team_encrypted_key, requester.encrypted_team_key AS requester_encrypted_team_key,
+			pending_key_grants.requested_by, pending_key_grants.created_at`).
+		Joins("JOIN users ON users.id = pending_key_grants.user_id").
+		Joins("LEFT JOIN team_users requester ON requester.team_id = pending_key_grants.team_id AND requester.user_id = ? AND requester.encrypted_team_key <> ''", uid)
+	if !IsAdminOrOwner(orgUser.Role) {
+		query = query.Where("requester.role IN ?", []string{"owner", "admin"})
+	}
+
+	grants := []KeyGrantResponse{}
+	if err := query.Order("pending_key_grants.created_at").Scan(&grants).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch key grants")
+		return
+	}
+
+	RespondOK(c, grants)
+}
+
+// FulfillKeyGrants stores team keys encrypted for their members, for a batch of
+// grants. Each grant succeeds or fails on its own.
+func FulfillKeyGrants(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	var req FulfillKeyGrantsRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	if _, ok := RequireOrgMembership(c, uid, orgID); !ok {
+		return
+	}
+
+	response := FulfillKeyGrantsResponse{Results: make([]KeyGrantResult, len(req.Grants))}
+	for i, item := range req.Grants {
+		response.Results[i] = fulfillKeyGrant(requestDB(c), uid, orgID, item)
+	}
+
+	RespondOK(c, response)
+}
+
+func fulfillKeyGrant(db *gorm.DB, uid, orgID uuid.UUID, item FulfillKeyGrant) KeyGrantResult {
+	result := KeyGrantResult{GrantID: item.GrantID}
+
+	var grant models.PendingKeyGrant
+	if err := pendingGrants(db, orgID).Select("pending_key_grants.*").
+		Where("pending_key_grants.id = ?", item.GrantID).Take(&grant).Error; err != nil {
+		result.Error = "Grant not found or already fulfilled"
+		return result
+	}
+
+	if canManage, err := canManageTeam(uid, grant.TeamID, orgID); err != nil || !canManage {
+		result.Error = "You don't have permission to manage this team"
+		return result
+	}
+
+	err := database.Transaction(db, func(tx *gorm.DB) error {
+		// Only an empty key is filled, so a concurrent fulfillment isn't overwritten
+		update := tx.Model(&models.TeamUser{}).
+			Where("team_id = ? AND user_id = ? AND encrypted_team_key = ''", grant.TeamID, grant.UserID).
+			Update("encrypted_team_key", item.EncryptedTeamKey)
+		if update.Error != nil {
+			return update.Error
+		}
+		if update.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Delete(&grant).Error
+	})
+	if err != nil {
+		result.Error = "Failed to fulfill grant"
+		return result
+	}
+
+	result.Fulfilled = true
+	return result
+}
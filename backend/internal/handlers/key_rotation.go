@@ -1,58 +1,104 @@
 package handlers
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"envie-backend/internal/alerts"
+	"envie-backend/internal/apierror"
+	"envie-backend/internal/configwatch"
 	"envie-backend/internal/database"
+	"envie-backend/internal/keypolicy"
 	"envie-backend/internal/models"
+	"envie-backend/internal/settings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
+// rotationWebhook posts the project.key_rotated event to the policy webhook once
+// a rotation commits; nil disables it
+var rotationWebhook keypolicy.Webhook = &alerts.Channels{EgressPolicy: settings.EgressPolicy}
+
 // TeamEncryptedKeyEntry - Project key encrypted for team
 type TeamEncryptedKeyEntry struct {
-	TeamID              string `json:"teamId"`
-	EncryptedProjectKey string `json:"encryptedProjectKey"`
+	TeamID              string `json:"teamId" binding:"required,uuid"`
+	EncryptedProjectKey string `json:"encryptedProjectKey" binding:"required,ciphertext"`
 }
 
 // ReEncryptedConfigItem - config item reencrypted with new key
 type ReEncryptedConfigItem struct {
-	ID    string `json:"id"`
-	Value string `json:"value"` // Re-encrypted value
+	ID    string `json:"id" binding:"required,uuid"`
+	Value string `json:"value" binding:"required,ciphertext"` // Re-encrypted value
 }
 
 // ReEncryptedFileFEK - file key reencrypted with new key
 type ReEncryptedFileFEK struct {
-	ID           string `json:"id"`
-	EncryptedFEK string `json:"encryptedFek"`
+	ID           string `json:"id" binding:"required,uuid"`
+	EncryptedFEK string `json:"encryptedFek" binding:"required,ciphertext"`
 }
 
 // Init request for rotation
 type InitiateRotationRequest struct {
-	TeamEncryptedKeys      []TeamEncryptedKeyEntry  `json:"teamEncryptedKeys" binding:"required"`
-	ReEncryptedConfigItems []ReEncryptedConfigItem  `json:"reEncryptedConfigItems" binding:"required"`
-	ReEncryptedFileFEKs    []ReEncryptedFileFEK     `json:"reEncryptedFileFEKs"`
+	TeamEncryptedKeys      []TeamEncryptedKeyEntry `json:"teamEncryptedKeys" binding:"required,dive"`
+	ReEncryptedConfigItems []ReEncryptedConfigItem `json:"reEncryptedConfigItems" binding:"required,dive"`
+	ReEncryptedFileFEKs    []ReEncryptedFileFEK    `json:"reEncryptedFileFEKs" binding:"dive"`
+	ExpiresInHours         int                     `json:"expiresInHours" binding:"min=0"` // approval window, 0 for the policy's; up to its maxApprovalWindowHours
+}
+
+// PendingRotationResponse - the pending rotation of a project, if any, and why a
+// rotation is required when one is (see OffboardOrganizationMember)
+type PendingRotationResponse struct {
+	Pending                *models.PendingKeyRotation `json:"pending"`
+	StaleRotationExists    bool                       `json:"staleRotationExists,omitempty"`
+	StaleRotationID        *uuid.UUID                 `json:"staleRotationId,omitempty"` // a stale rotation that can still be restarted
+	RotationRequiredAt     *time.Time                 `json:"rotationRequiredAt,omitempty"`
+	RotationRequiredReason *string                    `json:"rotationRequiredReason,omitempty"`
+}
+
+// KeyRotationResult - outcome of initiating or approving a rotation. Committed
+// rotations carry the new version, pending ones the approval state.
+type KeyRotationResult struct {
+	Message               string     `json:"message" binding:"required"`
+	Committed             bool       `json:"committed"`
+	NewVersion            int        `json:"newVersion,omitempty"`
+	RotationID            *uuid.UUID `json:"rotationId,omitempty"`
+	CurrentApprovals      *int64     `json:"currentApprovals,omitempty"`
+	RequiredApprovals     *int       `json:"requiredApprovals,omitempty"`
+	ExpiresAt             *time.Time `json:"expiresAt,omitempty"`
+	ExpiresIn             *int       `json:"expiresIn,omitempty"` // seconds left to approve
+	TokensInvalidated     *int64     `json:"tokensInvalidated,omitempty"`
+	TokensToBeInvalidated *int64     `json:"tokensToBeInvalidated,omitempty"`
+}
+
+// UserPendingRotationsResponse - rotations awaiting the current user's vote
+type UserPendingRotationsResponse struct {
+	PendingRotations []models.PendingKeyRotation `json:"pendingRotations"`
 }
 
 func GetPendingRotation(c *gin.Context) {
-	projectID := c.Param("id")
-	uid, _ := c.Get("user_id")
-	userID := uid.(uuid.UUID)
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID.String()
 
-	access, err := GetUserProjectAccess(userID, uuid.MustParse(projectID))
-	if err != nil || access == nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
+	response := PendingRotationResponse{
+		RotationRequiredAt:     access.Project.KeyRotationRequiredAt,
+		RotationRequiredReason: access.Project.KeyRotationRequiredReason,
 	}
 
 	var pending models.PendingKeyRotation
-	err = database.DB.
+	err := requestDB(c).
 		Preload("Initiator").
 		Preload("Approvals").
 		Preload("Approvals.User").
@@ -60,58 +106,93 @@ func GetPendingRotation(c *gin.Context) {
 		First(&pending).Error
 
 	if err != nil {
-		c.JSON(http.StatusOK, gin.H{"pending": nil})
+		response.StaleRotationID = restartableRotationID(requestDB(c), access.Project)
+		response.StaleRotationExists = response.StaleRotationID != nil
+		c.JSON(http.StatusOK, response)
 		return
 	}
 
 	isStale, _ := checkRotationStaleness(&pending)
 	if isStale {
-		database.DB.Model(&pending).Update("status", "stale")
-		c.JSON(http.StatusOK, gin.H{"pending": nil, "staleRotationExists": true})
+		requestDB(c).Model(&pending).Update("status", "stale")
+		response.StaleRotationExists = true
+		response.StaleRotationID = &pending.ID
+		c.JSON(http.StatusOK, response)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"pending": pending})
+	pending.ExpiresIn = secondsLeft(pending.ExpiresAt, time.Now())
+	response.Pending = &pending
+	c.JSON(http.StatusOK, response)
 }
 
 func InitiateKeyRotation(c *gin.Context) {
-	projectID := c.Param("id")
+	access := CurrentProjectAccess(c)
 	uid, _ := c.Get("user_id")
 	userID := uid.(uuid.UUID)
 
-	access, err := GetUserProjectAccess(userID, uuid.MustParse(projectID))
-	if err != nil || access == nil || !access.CanEdit {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only project admins can rotate keys"})
+	// A rotation re-encrypts every value, which needs the sensitive ones too
+	if access.MasksSensitive() {
+		RespondError(c, http.StatusForbidden, "Rotating the key of a project that restricts sensitive values requires "+models.PermissionSecretsReveal)
 		return
 	}
 
-	var existingPending models.PendingKeyRotation
-	if err := database.DB.Where("project_id = ? AND status = ?", projectID, "pending").First(&existingPending).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "A key rotation is already pending for this project"})
+	if !requireNoPendingRotation(c, access.Project.ID) {
 		return
 	}
 
 	var req InitiateRotationRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !BindJSON(c, &req) {
 		return
 	}
 
+	startRotation(c, userID, req, nil)
+}
+
+// requireNoPendingRotation checks that the project has no pending rotation. If
+// it has one, it sends an error response automatically.
+func requireNoPendingRotation(c *gin.Context, projectID uuid.UUID) bool {
+	var existingPending models.PendingKeyRotation
+	if err := requestDB(c).Where("project_id = ? AND status = ?", projectID, "pending").First(&existingPending).Error; err == nil {
+		RespondCode(c, http.StatusConflict, apierror.CodeRotationPending, "A key rotation is already pending for this project")
+		return false
+	}
+	return true
+}
+
+// startRotation checks a complete rotation payload against the current project
+// and commits it at once when no approval is needed, or creates the pending
+// rotation and notifies the approvers. restartedFrom is the stale rotation it
+// replaces, if any.
+func startRotation(c *gin.Context, userID uuid.UUID, req InitiateRotationRequest, restartedFrom *uuid.UUID) {
+	projectID := CurrentProjectAccess(c).Project.ID.String()
+
 	var project models.Project
-	if err := database.DB.First(&project, "id = ?", projectID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+	if err := requestDB(c).First(&project, "id = ?", projectID).Error; err != nil {
+		RespondError(c, http.StatusNotFound, "Project not found")
+		return
+	}
+
+	policy, err := keypolicy.PolicyFor(requestDB(c), &project)
+	if err != nil {
+		RespondInternalError(c, "Failed to load the key rotation policy")
+		return
+	}
+	window, message := rotationWindow(policy, req.ExpiresInHours)
+	if message != "" {
+		RespondBadRequest(c, message)
 		return
 	}
 
 	currentConfigItems, currentTeamIDs, currentSecretManagerConfigIDs, configItemsHash := getProjectSnapshot(uuid.MustParse(projectID))
 
 	if err := validateConfigItemsComplete(req.ReEncryptedConfigItems, currentConfigItems); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		RespondError(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	if err := validateTeamsComplete(req.TeamEncryptedKeys, currentTeamIDs); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		RespondError(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -125,6 +206,7 @@ func InitiateKeyRotation(c *gin.Context) {
 	teamIDsJSON, _ := json.Marshal(currentTeamIDs)
 	secretManagerConfigIDsJSON, _ := json.Marshal(currentSecretManagerConfigIDs)
 	fileFEKsJSON, _ := json.Marshal(req.ReEncryptedFileFEKs)
+	configItemHashesJSON, _ := json.Marshal(configItemHashes(currentConfigItems))
 
 	pending := models.PendingKeyRotation{
 		ProjectID:                    uuid.MustParse(projectID),
@@ -132,7 +214,7 @@ func InitiateKeyRotation(c *gin.Context) {
 		NewVersion:                   newVersion,
 		Status:                       "pending",
 		RequiredApprovals:            requiredApprovals,
-		ExpiresAt:                    time.Now().Add(24 * time.Hour), // 24 hour expiry
+		ExpiresAt:                    time.Now().Add(window),
 		TeamEncryptedKeys:            string(teamKeysJSON),
 		EncryptedConfigsSnapshot:     string(configsJSON),
 		EncryptedFileFEKsSnapshot:    string(fileFEKsJSON),
@@ -140,85 +222,276 @@ func InitiateKeyRotation(c *gin.Context) {
 		SnapshotTeamIDs:              string(teamIDsJSON),
 		SnapshotSecretManagerConfIDs: string(secretManagerConfigIDsJSON),
 		SnapshotConfigItemsHash:      configItemsHash,
+		SnapshotConfigItemHashes:     string(configItemHashesJSON),
+		RestartedFromID:              restartedFrom,
 	}
 
 	var tokenCount int64
-	database.DB.Model(&models.ProjectToken{}).Where("project_id = ?", projectID).Count(&tokenCount)
+	requestDB(c).Model(&models.ProjectToken{}).Where("project_id = ?", projectID).Count(&tokenCount)
 
 	if requiredApprovals == 0 {
-		if err := commitRotation(&pending, &project); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit rotation: " + err.Error()})
+		if err := commitRotation(c.Request.Context(), &pending, &project, userID); err != nil {
+			RespondError(c, http.StatusInternalServerError, "Failed to commit rotation: "+err.Error())
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{
-			"message":              "Key rotation completed immediately (single admin)",
-			"newVersion":           newVersion,
-			"committed":            true,
-			"tokensInvalidated":    tokenCount,
+		c.JSON(http.StatusOK, KeyRotationResult{
+			Message:           "Key rotation completed immediately (single admin)",
+			NewVersion:        newVersion,
+			Committed:         true,
+			TokensInvalidated: &tokenCount,
 		})
 		return
 	}
 
-	if err := database.DB.Create(&pending).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create pending rotation"})
+	err = database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Create(&pending).Error; err != nil {
+			return err
+		}
+		return recordAuditEvent(tx, project.OrganizationID, &project.ID, userID, models.AuditRotationInitiated, fmt.Sprintf("key version %d", newVersion), requiredApprovals)
+	})
+	if err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to create pending rotation")
 		return
 	}
+	if err := notifyRotationPending(requestDB(c), &pending, &project); err != nil {
+		log.Printf("Failed to notify the approvers of key rotation %s: %v", pending.ID, err)
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":              "Key rotation initiated, awaiting approval",
-		"rotationId":           pending.ID,
-		"requiredApprovals":    requiredApprovals,
-		"expiresAt":            pending.ExpiresAt,
-		"committed":            false,
-		"tokensToBeInvalidated": tokenCount,
+	expiresIn := secondsLeft(pending.ExpiresAt, time.Now())
+	c.JSON(http.StatusOK, KeyRotationResult{
+		Message:               "Key rotation initiated, awaiting approval",
+		RotationID:            &pending.ID,
+		RequiredApprovals:     &requiredApprovals,
+		ExpiresAt:             &pending.ExpiresAt,
+		ExpiresIn:             &expiresIn,
+		Committed:             false,
+		TokensToBeInvalidated: &tokenCount,
 	})
 }
 
+// RotationValidateRequest - a rotation payload to check, possibly still partial
+type RotationValidateRequest struct {
+	TeamEncryptedKeys      []TeamEncryptedKeyEntry `json:"teamEncryptedKeys"`
+	ReEncryptedConfigItems []ReEncryptedConfigItem `json:"reEncryptedConfigItems"`
+	ReEncryptedFileFEKs    []ReEncryptedFileFEK    `json:"reEncryptedFileFEKs" binding:"dive"`
+	ExpiresInHours         int                     `json:"expiresInHours" binding:"min=0"`
+}
+
+// RotationResource - something a rotation re-encrypts or snapshots
+type RotationResource struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// RotationValidationResponse - what a rotation of the project must cover, and
+// what the checked payload misses. Missing lists are resources the payload has no
+// entry for, unknown lists are payload entries the project doesn't have.
+type RotationValidationResponse struct {
+	Valid             bool       `json:"valid"`
+	Errors            []string   `json:"errors"`
+	PendingRotationID *uuid.UUID `json:"pendingRotationId,omitempty"`
+
+	ConfigItems          []RotationResource `json:"configItems"`
+	Teams                []RotationResource `json:"teams"`
+	Files                []RotationResource `json:"files"`
+	SecretManagerConfigs []RotationResource `json:"secretManagerConfigs"` // snapshotted, changes make a pending rotation stale
+
+	MissingConfigItems []string `json:"missingConfigItems"`
+	UnknownConfigItems []string `json:"unknownConfigItems"`
+	MissingTeams       []string `json:"missingTeams"`
+	UnknownTeams       []string `json:"unknownTeams"`
+	MissingFiles       []string `json:"missingFiles"`
+	UnknownFiles       []string `json:"unknownFiles"`
+
+	NewVersion            int   `json:"newVersion"`
+	RequiredApprovals     int   `json:"requiredApprovals"`
+	TokensToBeInvalidated int64 `json:"tokensToBeInvalidated"`
+
+	ApprovalWindowHours    int `json:"approvalWindowHours"`    // the window a rotation gets without expiresInHours
+	MaxApprovalWindowHours int `json:"maxApprovalWindowHours"` // the longest expiresInHours allowed
+}
+
+// ValidateKeyRotation runs the checks of InitiateKeyRotation on a payload without
+// creating anything, and lists what the client must re-encrypt. The body may be
+// empty to only get the lists.
+func ValidateKeyRotation(c *gin.Context) {
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID
+
+	var req RotationValidateRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		RespondBadRequest(c, err.Error())
+		return
+	}
+
+	db := requestDB(c)
+	configItems, teamIDs, _, _ := getProjectSnapshot(projectID)
+
+	policy, err := keypolicy.PolicyFor(db, access.Project)
+	if err != nil {
+		RespondInternalError(c, "Failed to load the key rotation policy")
+		return
+	}
+	window, longest := rotationWindows(policy)
+
+	var teams []models.Team
+	if err := db.Where("id IN ?", teamIDs).Order("name").Find(&teams).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch teams")
+		return
+	}
+	var files []models.ProjectFile
+	if err := db.Select("id, name").Where("project_id = ?", projectID).Order("name").Find(&files).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch files")
+		return
+	}
+	var secretManagerConfigs []models.SecretManagerConfig
+	if err := db.Select("id, name").Where("project_id = ?", projectID).Order("name").Find(&secretManagerConfigs).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch secret manager configs")
+		return
+	}
+
+	response := RotationValidationResponse{
+		Errors:               []string{},
+		ConfigItems:          make([]RotationResource, len(configItems)),
+		Teams:                make([]RotationResource, len(teams)),
+		Files:                make([]RotationResource, len(files)),
+		SecretManagerConfigs: make([]RotationResource, len(secretManagerConfigs)),
+		NewVersion:           access.Project.KeyVersion + 1,
+		RequiredApprovals:    getRequiredApprovals(projectID, access.Project.OrganizationID),
+
+		ApprovalWindowHours:    int(window.Hours()),
+		MaxApprovalWindowHours: int(longest.Hours()),
+	}
+	for i, item := range configItems {
+		response.ConfigItems[i] = RotationResource{ID: item.ID.String(), Name: item.Name}
+	}
+	for i, team := range teams {
+		response.Teams[i] = RotationResource{ID: team.ID.String(), Name: team.Name}
+	}
+	for i, file := range files {
+		response.Files[i] = RotationResource{ID: file.ID.String(), Name: file.Name}
+	}
+	for i, smc := range secretManagerConfigs {
+		response.SecretManagerConfigs[i] = RotationResource{ID: smc.ID.String(), Name: smc.Name}
+	}
+
+	requestedItems := make([]string, len(req.ReEncryptedConfigItems))
+	for i, item := range req.ReEncryptedConfigItems {
+		requestedItems[i] = item.ID
+	}
+	response.MissingConfigItems, response.UnknownConfigItems = diffRotationIDs(response.ConfigItems, requestedItems)
+
+	requestedTeams := make([]string, len(req.TeamEncryptedKeys))
+	for i, entry := range req.TeamEncryptedKeys {
+		requestedTeams[i] = entry.TeamID
+	}
+	response.MissingTeams, response.UnknownTeams = diffRotationIDs(response.Teams, requestedTeams)
+
+	requestedFiles := make([]string, len(req.ReEncryptedFileFEKs))
+	for i, fek := range req.ReEncryptedFileFEKs {
+		requestedFiles[i] = fek.ID
+	}
+	response.MissingFiles, response.UnknownFiles = diffRotationIDs(response.Files, requestedFiles)
+
+	var pending models.PendingKeyRotation
+	if err := db.Where("project_id = ? AND status = ?", projectID, "pending").First(&pending).Error; err == nil {
+		response.PendingRotationID = &pending.ID
+		if isStale, reason := checkRotationStaleness(&pending); isStale {
+			response.Errors = append(response.Errors, "The pending key rotation is stale ("+reason+") and must be cancelled first")
+		} else {
+			response.Errors = append(response.Errors, "A key rotation is already pending for this project")
+		}
+	}
+	if err := validateConfigItemsComplete(req.ReEncryptedConfigItems, configItems); err != nil {
+		response.Errors = append(response.Errors, err.Error())
+	}
+	if err := validateTeamsComplete(req.TeamEncryptedKeys, teamIDs); err != nil {
+		response.Errors = append(response.Errors, err.Error())
+	}
+	if _, message := rotationWindow(policy, req.ExpiresInHours); message != "" {
+		response.Errors = append(response.Errors, message)
+	}
+	if len(response.MissingFiles) > 0 {
+		response.Errors = append(response.Errors, "Files without a re-encrypted key become unreadable after the rotation")
+	}
+	response.Valid = len(response.Errors) == 0 && len(response.UnknownConfigItems) == 0 &&
+		len(response.UnknownTeams) == 0 && len(response.UnknownFiles) == 0
+
+	db.Model(&models.ProjectToken{}).Where("project_id = ?", projectID).Count(&response.TokensToBeInvalidated)
+
+	RespondOK(c, response)
+}
+
+// diffRotationIDs returns the IDs of current resources missing from requested,
+// and the requested IDs that aren't current resources
+func diffRotationIDs(current []RotationResource, requested []string) (missing, unknown []string) {
+	missing, unknown = []string{}, []string{}
+
+	requestedSet := make(map[string]bool, len(requested))
+	for _, id := range requested {
+		requestedSet[id] = true
+	}
+	currentSet := make(map[string]bool, len(current))
+	for _, resource := range current {
+		currentSet[resource.ID] = true
+		if !requestedSet[resource.ID] {
+			missing = append(missing, resource.ID)
+		}
+	}
+	for _, id := range requested {
+		if !currentSet[id] {
+			unknown = append(unknown, id)
+		}
+	}
+	return missing, unknown
+}
+
 func ApproveKeyRotation(c *gin.Context) {
-	projectID := c.Param("id")
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID.String()
 	rotationID := c.Param("rotationId")
 	uid, _ := c.Get("user_id")
 	userID := uid.(uuid.UUID)
 
-	access, err := GetUserProjectAccess(userID, uuid.MustParse(projectID))
-	if err != nil || access == nil || !access.CanEdit {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only project admins can approve rotations"})
-		return
-	}
-
 	var req struct {
 		VerifiedDecryption bool `json:"verifiedDecryption"`
 	}
 	c.ShouldBindJSON(&req)
 
 	var pending models.PendingKeyRotation
-	if err := database.DB.Preload("Approvals").First(&pending, "id = ? AND project_id = ? AND status = ?", rotationID, projectID, "pending").Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Pending rotation not found"})
+	if err := requestDB(c).Preload("Approvals").First(&pending, "id = ? AND project_id = ? AND status = ?", rotationID, projectID, "pending").Error; err != nil {
+		RespondError(c, http.StatusNotFound, "Pending rotation not found")
 		return
 	}
 
 	if pending.InitiatedBy == userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot approve your own key rotation"})
+		RespondError(c, http.StatusForbidden, "Cannot approve your own key rotation")
 		return
 	}
 
 	for _, approval := range pending.Approvals {
 		if approval.UserID == userID {
-			c.JSON(http.StatusConflict, gin.H{"error": "You have already voted on this rotation"})
+			RespondError(c, http.StatusConflict, "You have already voted on this rotation")
 			return
 		}
 	}
 
+	// A rotation with approvals may be extended instead, and the vote goes on
 	if time.Now().After(pending.ExpiresAt) {
-		database.DB.Model(&pending).Update("status", "expired")
-		c.JSON(http.StatusGone, gin.H{"error": "Rotation has expired"})
-		return
+		pendingStill, err := settleExpiredRotation(requestDB(c), &pending, access.Project, time.Now())
+		if err != nil {
+			log.Printf("Failed to settle expired key rotation %s: %v", pending.ID, err)
+		}
+		if !pendingStill {
+			RespondCode(c, http.StatusGone, apierror.CodeRotationExpired, "Rotation has expired")
+			return
+		}
 	}
 
 	isStale, reason := checkRotationStaleness(&pending)
 	if isStale {
-		database.DB.Model(&pending).Update("status", "stale")
-		c.JSON(http.StatusConflict, gin.H{"error": "Rotation is stale: " + reason})
+		requestDB(c).Model(&pending).Update("status", "stale")
+		RespondCode(c, http.StatusConflict, apierror.CodeRotationStale, "Rotation is stale: "+reason)
 		return
 	}
 
@@ -228,65 +501,66 @@ func ApproveKeyRotation(c *gin.Context) {
 		Approved:           true,
 		VerifiedDecryption: req.VerifiedDecryption,
 	}
-	database.DB.Create(&approval)
+	requestDB(c).Create(&approval)
 
 	var approvalCount int64
-	database.DB.Model(&models.KeyRotationApproval{}).
+	requestDB(c).Model(&models.KeyRotationApproval{}).
 		Where("rotation_id = ? AND approved = ?", pending.ID, true).
 		Count(&approvalCount)
 
 	if int(approvalCount) >= pending.RequiredApprovals {
 		isStale, reason := checkRotationStaleness(&pending)
 		if isStale {
-			database.DB.Model(&pending).Update("status", "stale")
-			c.JSON(http.StatusConflict, gin.H{"error": "Rotation became stale: " + reason})
+			requestDB(c).Model(&pending).Update("status", "stale")
+			RespondCode(c, http.StatusConflict, apierror.CodeRotationStale, "Rotation became stale: "+reason)
 			return
 		}
 
 		var project models.Project
-		database.DB.First(&project, "id = ?", projectID)
+		requestDB(c).First(&project, "id = ?", projectID)
 
-		if err := commitRotation(&pending, &project); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit rotation: " + err.Error()})
+		if err := commitRotation(c.Request.Context(), &pending, &project, userID); err != nil {
+			RespondError(c, http.StatusInternalServerError, "Failed to commit rotation: "+err.Error())
 			return
 		}
+		if err := notifyRotationApproved(requestDB(c), &pending, &project); err != nil {
+			log.Printf("Failed to notify the initiator of key rotation %s: %v", pending.ID, err)
+		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"message":    "Rotation approved and committed",
-			"newVersion": pending.NewVersion,
-			"committed":  true,
+		c.JSON(http.StatusOK, KeyRotationResult{
+			Message:    "Rotation approved and committed",
+			NewVersion: pending.NewVersion,
+			Committed:  true,
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":           "Approval recorded",
-		"currentApprovals":  approvalCount,
-		"requiredApprovals": pending.RequiredApprovals,
-		"committed":         false,
+	expiresIn := secondsLeft(pending.ExpiresAt, time.Now())
+	c.JSON(http.StatusOK, KeyRotationResult{
+		Message:           "Approval recorded",
+		CurrentApprovals:  &approvalCount,
+		RequiredApprovals: &pending.RequiredApprovals,
+		ExpiresAt:         &pending.ExpiresAt,
+		ExpiresIn:         &expiresIn,
+		Committed:         false,
 	})
 }
 
 func RejectKeyRotation(c *gin.Context) {
-	projectID := c.Param("id")
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID.String()
 	rotationID := c.Param("rotationId")
 	uid, _ := c.Get("user_id")
 	userID := uid.(uuid.UUID)
 
-	access, err := GetUserProjectAccess(userID, uuid.MustParse(projectID))
-	if err != nil || access == nil || !access.CanEdit {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only project admins can reject rotations"})
-		return
-	}
-
 	var req struct {
 		Comment string `json:"comment"`
 	}
 	c.ShouldBindJSON(&req)
 
 	var pending models.PendingKeyRotation
-	if err := database.DB.First(&pending, "id = ? AND project_id = ? AND status = ?", rotationID, projectID, "pending").Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Pending rotation not found"})
+	if err := requestDB(c).First(&pending, "id = ? AND project_id = ? AND status = ?", rotationID, projectID, "pending").Error; err != nil {
+		RespondError(c, http.StatusNotFound, "Pending rotation not found")
 		return
 	}
 
@@ -296,31 +570,34 @@ func RejectKeyRotation(c *gin.Context) {
 		Approved:   false,
 		Comment:    req.Comment,
 	}
-	database.DB.Create(&rejection)
+	requestDB(c).Create(&rejection)
 
-	database.DB.Model(&pending).Update("status", "rejected")
+	requestDB(c).Model(&pending).Update("status", "rejected")
+	if err := notifyRotationRejected(requestDB(c), &pending, access.Project, userID, req.Comment); err != nil {
+		log.Printf("Failed to notify the initiator of key rotation %s: %v", pending.ID, err)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Rotation rejected"})
 }
 
 func CancelKeyRotation(c *gin.Context) {
-	projectID := c.Param("id")
+	projectID := CurrentProjectAccess(c).Project.ID
 	rotationID := c.Param("rotationId")
 	uid, _ := c.Get("user_id")
 	userID := uid.(uuid.UUID)
 
 	var pending models.PendingKeyRotation
-	if err := database.DB.First(&pending, "id = ? AND project_id = ? AND status = ?", rotationID, projectID, "pending").Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Pending rotation not found"})
+	if err := requestDB(c).First(&pending, "id = ? AND project_id = ? AND status = ?", rotationID, projectID, "pending").Error; err != nil {
+		RespondError(c, http.StatusNotFound, "Pending rotation not found")
 		return
 	}
 
 	if pending.InitiatedBy != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only the initiator can cancel a rotation"})
+		RespondError(c, http.StatusForbidden, "Only the initiator can cancel a rotation")
 		return
 	}
 
-	database.DB.Model(&pending).Update("status", "cancelled")
+	requestDB(c).Model(&pending).Update("status", "cancelled")
 	c.JSON(http.StatusOK, gin.H{"message": "Rotation cancelled"})
 }
 
@@ -331,12 +608,12 @@ func GetUserPendingRotations(c *gin.Context) {
 	projectIDs := getUserAccessibleProjectIDs(userID)
 
 	if len(projectIDs) == 0 {
-		c.JSON(http.StatusOK, gin.H{"pendingRotations": []models.PendingKeyRotation{}})
+		c.JSON(http.StatusOK, UserPendingRotationsResponse{PendingRotations: []models.PendingKeyRotation{}})
 		return
 	}
 
 	var pendingRotations []models.PendingKeyRotation
-	database.DB.
+	requestDB(c).
 		Preload("Initiator").
 		Preload("Project").
 		Preload("Approvals").
@@ -348,7 +625,7 @@ func GetUserPendingRotations(c *gin.Context) {
 	for i := range pendingRotations {
 		isStale, _ := checkRotationStaleness(&pendingRotations[i])
 		if isStale {
-			database.DB.Model(&pendingRotations[i]).Update("status", "stale")
+			requestDB(c).Model(&pendingRotations[i]).Update("status", "stale")
 			continue
 		}
 
@@ -360,74 +637,157 @@ func GetUserPendingRotations(c *gin.Context) {
 			}
 		}
 		if pendingRotations[i].InitiatedBy != userID && !alreadyVoted {
+			pendingRotations[i].ExpiresIn = secondsLeft(pendingRotations[i].ExpiresAt, time.Now())
 			validRotations = append(validRotations, pendingRotations[i])
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"pendingRotations": validRotations})
+	c.JSON(http.StatusOK, UserPendingRotationsResponse{PendingRotations: validRotations})
 }
 
-func commitRotation(pending *models.PendingKeyRotation, project *models.Project) error {
-	tx := database.DB.Begin()
-
-	if err := tx.Model(project).Updates(map[string]any{
-		"key_version": pending.NewVersion,
-	}).Error; err != nil {
-		tx.Rollback()
-		return err
-	}
-
+// commitRotation swaps in the re-encrypted values and keys in one transaction,
+// which ends with ctx: it rewrites every item and key of the project
+func commitRotation(ctx context.Context, pending *models.PendingKeyRotation, project *models.Project, actorID uuid.UUID) error {
+	previousVersion := project.KeyVersion
+	rotatedAt := time.Now()
 	var reEncryptedItems []ReEncryptedConfigItem
 	json.Unmarshal([]byte(pending.EncryptedConfigsSnapshot), &reEncryptedItems)
-
-	for _, item := range reEncryptedItems {
-		if err := tx.Model(&models.ConfigItem{}).
-			Where("id = ?", item.ID).
-			Update("value", item.Value).Error; err != nil {
-			tx.Rollback()
-			return err
-		}
+	itemValues := make([]columnUpdate, len(reEncryptedItems))
+	for i, item := range reEncryptedItems {
+		itemValues[i] = columnUpdate{Key: item.ID, Value: item.Value}
 	}
 
 	var teamKeys []TeamEncryptedKeyEntry
 	json.Unmarshal([]byte(pending.TeamEncryptedKeys), &teamKeys)
-
-	for _, tk := range teamKeys {
-		if err := tx.Model(&models.TeamProject{}).
-			Where("team_id = ? AND project_id = ?", tk.TeamID, project.ID).
-			Update("encrypted_project_key", tk.EncryptedProjectKey).Error; err != nil {
-			tx.Rollback()
-			return err
-		}
+	teamValues := make([]columnUpdate, len(teamKeys))
+	for i, tk := range teamKeys {
+		teamValues[i] = columnUpdate{Key: tk.TeamID, Value: tk.EncryptedProjectKey}
 	}
 
+	var fekValues []columnUpdate
 	if pending.EncryptedFileFEKsSnapshot != "" {
 		var reEncryptedFileFEKs []ReEncryptedFileFEK
 		json.Unmarshal([]byte(pending.EncryptedFileFEKsSnapshot), &reEncryptedFileFEKs)
+		fekValues = make([]columnUpdate, len(reEncryptedFileFEKs))
+		for i, fileFEK := range reEncryptedFileFEKs {
+			fekValues[i] = columnUpdate{Key: fileFEK.ID, Value: fileFEK.EncryptedFEK}
+		}
+	}
+
+	err := database.Transaction(database.DB.WithContext(ctx), func(tx *gorm.DB) error {
+		if err := tx.Model(project).Updates(map[string]any{
+			"key_version":                  pending.NewVersion,
+			"key_rotated_at":               rotatedAt,
+			"key_rotation_overdue_at":      nil,
+			"key_rotation_required_at":     nil,
+			"key_rotation_required_reason": nil,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := snapshotRotatedConfig(tx, pending, project, actorID, itemValues); err != nil {
+			return err
+		}
+		if err := bulkUpdateColumn(tx, &models.ConfigItem{}, project.ID, "id", "value", itemValues); err != nil {
+			return err
+		}
+		if err := bulkUpdateColumn(tx, &models.TeamProject{}, project.ID, "team_id", "encrypted_project_key", teamValues); err != nil {
+			return err
+		}
+		if err := bulkUpdateColumn(tx, &models.ProjectFile{}, project.ID, "id", "encrypted_fek", fekValues); err != nil {
+			return err
+		}
 
-		for _, fileFEK := range reEncryptedFileFEKs {
-			if err := tx.Model(&models.ProjectFile{}).
-				Where("id = ?", fileFEK.ID).
-				Update("encrypted_fek", fileFEK.EncryptedFEK).Error; err != nil {
-				tx.Rollback()
+		if pending.ID != uuid.Nil {
+			if err := tx.Model(pending).Update("status", "approved").Error; err != nil {
 				return err
 			}
 		}
-	}
 
-	if pending.ID != uuid.Nil {
-		if err := tx.Model(pending).Update("status", "approved").Error; err != nil {
-			tx.Rollback()
+		if err := tx.Where("project_id = ?", project.ID).Delete(&models.ProjectToken{}).Error; err != nil {
+			return err
+		}
+
+		// Deleted items are encrypted with the old key, which no one can use to
+		// restore them after this
+		if err := tx.Unscoped().Where("project_id = ? AND deleted_at IS NOT NULL", project.ID).Delete(&models.ConfigItem{}).Error; err != nil {
 			return err
 		}
+
+		return recordAuditEvent(tx, project.OrganizationID, &project.ID, actorID, models.AuditRotationCommitted, fmt.Sprintf("key version %d", pending.NewVersion), len(reEncryptedItems))
+	})
+	if err != nil {
+		return err
+	}
+
+	configwatch.Publish(project.ID)
+
+	if rotationWebhook != nil {
+		rotated := *project
+		rotated.KeyVersion = pending.NewVersion
+		go func() {
+			if err := keypolicy.NotifyRotated(database.DB, rotationWebhook, &rotated, previousVersion, rotatedAt); err != nil {
+				log.Printf("Failed to post key rotation webhook for project %s: %v", rotated.ID, err)
+			}
+		}()
 	}
+	return nil
+}
 
-	if err := tx.Where("project_id = ?", project.ID).Delete(&models.ProjectToken{}).Error; err != nil {
-		tx.Rollback()
+// snapshotRotatedConfig snapshots the config a rotation is about to commit, with
+// the values re-encrypted under the new key so the snapshot stays restorable
+func snapshotRotatedConfig(tx *gorm.DB, pending *models.PendingKeyRotation, project *models.Project, actorID uuid.UUID, itemValues []columnUpdate) error {
+	var items []models.ConfigItem
+	if err := tx.Where("project_id = ?", project.ID).Order("position asc").Find(&items).Error; err != nil {
 		return err
 	}
+	values := make(map[string]string, len(itemValues))
+	for _, update := range itemValues {
+		values[update.Key] = update.Value
+	}
+	for i := range items {
+		items[i].Value = values[items[i].ID.String()]
+	}
+	name := fmt.Sprintf("Before key rotation to version %d", pending.NewVersion)
+	_, err := takeConfigSnapshot(tx, project.ID, pending.NewVersion, actorID, name, models.SnapshotRotation, items)
+	return err
+}
 
-	return tx.Commit().Error
+// rotationBatchSize bounds the rows set by one bulk update, keeping its bind
+// parameters well below PostgreSQL's limit of 65535
+const rotationBatchSize = 5000
+
+// columnUpdate is one row of a bulk update: the row's key and its new value
+type columnUpdate struct {
+	Key   string
+	Value string
+}
+
+// bulkUpdateColumn sets column on the project's rows of model from a CASE
+// expression over keyColumn, one statement per rotationBatchSize rows instead
+// of one per row
+func bulkUpdateColumn(tx *gorm.DB, model any, projectID uuid.UUID, keyColumn, column string, values []columnUpdate) error {
+	for start := 0; start < len(values); start += rotationBatchSize {
+		batch := values[start:min(start+rotationBatchSize, len(values))]
+
+		var sql strings.Builder
+		args := make([]any, 0, len(batch)*2)
+		keys := make([]string, len(batch))
+		sql.WriteString("CASE " + keyColumn)
+		for i, row := range batch {
+			sql.WriteString(" WHEN ? THEN ?")
+			args = append(args, row.Key, row.Value)
+			keys[i] = row.Key
+		}
+		sql.WriteString(" END")
+
+		if err := tx.Model(model).
+			Where("project_id = ? AND "+keyColumn+" IN ?", projectID, keys).
+			Update(column, gorm.Expr(sql.String(), args...)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func getRequiredApprovals(projectID uuid.UUID, orgID uuid.UUID) int {
@@ -496,6 +856,20 @@ func extractConfigItemIDs(items []models.ConfigItem) []string {
 	return ids
 }
 
+// configItemHashes hashes each item like hashConfigItems does the whole list, so
+// a stale rotation can tell which items changed (see GetRotationChanges)
+func configItemHashes(items []models.ConfigItem) map[string]string {
+	hashes := make(map[string]string, len(items))
+	for _, item := range items {
+		hasher := sha256.New()
+		hasher.Write([]byte(item.ID.String()))
+		hasher.Write([]byte(item.Value))
+		hasher.Write([]byte(item.Name))
+		hashes[item.ID.String()] = hex.EncodeToString(hasher.Sum(nil))
+	}
+	return hashes
+}
+
 func hashConfigItems(items []models.ConfigItem) string {
 	sort.Slice(items, func(i, j int) bool {
 		return items[i].ID.String() < items[j].ID.String()
@@ -512,7 +886,7 @@ func hashConfigItems(items []models.ConfigItem) string {
 
 func validateConfigItemsComplete(requested []ReEncryptedConfigItem, current []models.ConfigItem) error {
 	if len(requested) != len(current) {
-		return &ValidationError{"Number of config items doesn't match. Expected " + string(rune(len(current))) + " but got " + string(rune(len(requested)))}
+		return &ValidationError{"Number of config items doesn't match. Expected " + strconv.Itoa(len(current)) + " but got " + strconv.Itoa(len(requested))}
 	}
 
 	requestedIDs := make(map[string]bool)
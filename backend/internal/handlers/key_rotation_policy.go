@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/keypolicy"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// KeyRotationPolicyRequest - maxKeyAgeDays 0 sets no age limit, for a policy that
+// only routes rotation events to its webhook. The approval window fields left 0
+// keep the defaults: 24 hours, no longer windows and no extensions.
+type KeyRotationPolicyRequest struct {
+	MaxKeyAgeDays          int     `json:"maxKeyAgeDays" binding:"min=0,max=3650"`
+	WebhookURL             *string `json:"webhookUrl"`
+	ApprovalWindowHours    int     `json:"approvalWindowHours" binding:"min=0,max=720"`
+	MaxApprovalWindowHours int     `json:"maxApprovalWindowHours" binding:"min=0,max=720"`
+	AutoExtendHours        int     `json:"autoExtendHours" binding:"min=0,max=168"`
+}
+
+// KeyRotationPoliciesResponse - the organization policy and the project overrides
+type KeyRotationPoliciesResponse struct {
+	Organization *models.KeyRotationPolicy  `json:"organization"`
+	Projects     []models.KeyRotationPolicy `json:"projects"`
+}
+
+func GetKeyRotationPolicies(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgMembership(c, uid, orgID); !ok {
+		return
+	}
+
+	var policies []models.KeyRotationPolicy
+	if err := requestDB(c).Where("organization_id = ?", orgID).Order("created_at asc").Find(&policies).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch key rotation policies")
+		return
+	}
+
+	response := KeyRotationPoliciesResponse{Projects: []models.KeyRotationPolicy{}}
+	for i := range policies {
+		if policies[i].ProjectID == nil {
+			response.Organization = &policies[i]
+		} else {
+			response.Projects = append(response.Projects, policies[i])
+		}
+	}
+	RespondOK(c, response)
+}
+
+func PutOrganizationKeyRotationPolicy(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	var req KeyRotationPolicyRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	savePolicy(c, uid, orgID, nil, req)
+}
+
+func DeleteOrganizationKeyRotationPolicy(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	deletePolicy(c, orgID, nil)
+}
+
+func PutProjectKeyRotationPolicy(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID
+
+	var req KeyRotationPolicyRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	savePolicy(c, uid, access.Project.OrganizationID, &projectID, req)
+}
+
+func DeleteProjectKeyRotationPolicy(c *gin.Context) {
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID
+
+	deletePolicy(c, access.Project.OrganizationID, &projectID)
+}
+
+// policyScope restricts a query to the organization policy, or to the policy
+// of a project when projectID is set
+func policyScope(db *gorm.DB, orgID uuid.UUID, projectID *uuid.UUID) *gorm.DB {
+	if projectID == nil {
+		return db.Where("organization_id = ? AND project_id IS NULL", orgID)
+	}
+	return db.Where("organization_id = ? AND project_id = ?", orgID, *projectID)
+}
+
+// savePolicy creates or replaces the policy of the scope and responds with it
+func savePolicy(c *gin.Context, uid, orgID uuid.UUID, projectID *uuid.UUID, req KeyRotationPolicyRequest) {
+	if req.WebhookURL != nil && *req.WebhookURL == "" {
+		req.WebhookURL = nil
+	}
+	if req.WebhookURL != nil {
+		if err := validateAlertTarget(models.AlertChannelWebhook, *req.WebhookURL); err != nil {
+			RespondBadRequest(c, "Invalid webhookUrl: "+err.Error())
+			return
+		}
+	}
+
+	if req.MaxApprovalWindowHours != 0 && req.MaxApprovalWindowHours < req.ApprovalWindowHours {
+		RespondBadRequest(c, "maxApprovalWindowHours can't be shorter than approvalWindowHours")
+		return
+	}
+
+	var policy models.KeyRotationPolicy
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		err := policyScope(tx, orgID, projectID).First(&policy).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			policy = models.KeyRotationPolicy{
+				OrganizationID: orgID,
+				ProjectID:      projectID,
+				MaxKeyAgeDays:  req.MaxKeyAgeDays,
+				WebhookURL:     req.WebhookURL,
+				UpdatedByID:    uid,
+
+				ApprovalWindowHours:    req.ApprovalWindowHours,
+				MaxApprovalWindowHours: req.MaxApprovalWindowHours,
+				AutoExtendHours:        req.AutoExtendHours,
+			}
+			return tx.Create(&policy).Error
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(&policy).Updates(map[string]any{
+			"max_key_age_days":          req.MaxKeyAgeDays,
+			"webhook_url":               req.WebhookURL,
+			"approval_window_hours":     req.ApprovalWindowHours,
+			"max_approval_window_hours": req.MaxApprovalWindowHours,
+			"auto_extend_hours":         req.AutoExtendHours,
+			"updated_by_id":             uid,
+		}).Error
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to save key rotation policy")
+		return
+	}
+
+	RespondOK(c, policy)
+}
+
+func deletePolicy(c *gin.Context, orgID uuid.UUID, projectID *uuid.UUID) {
+	result := policyScope(requestDB(c), orgID, projectID).Delete(&models.KeyRotationPolicy{})
+	if result.Error != nil {
+		RespondInternalError(c, "Failed to delete key rotation policy")
+		return
+	}
+	if result.RowsAffected == 0 {
+		RespondNotFound(c, "Key rotation policy not found")
+		return
+	}
+
+	RespondMessage(c, "Key rotation policy deleted")
+}
+
+// GetOverdueKeyRotations lists the organization's projects whose key is older
+// than their policy allows
+func GetOverdueKeyRotations(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	overdue, err := keypolicy.Overdue(requestDB(c), &orgID, time.Now())
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch overdue key rotations")
+		return
+	}
+
+	RespondOK(c, overdue)
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// recordingPool is a gorm connection pool that records executed statements
+// and reports every one as affecting a single row
+type recordingPool struct {
+	statements []string
+}
+
+func (p *recordingPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+
+func (p *recordingPool) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	p.statements = append(p.statements, query)
+	return driver.RowsAffected(1), nil
+}
+
+// QueryContext allows the INSERT ... RETURNING of audit events and the read of
+// the config to snapshot, returning no rows
+func (p *recordingPool) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if !strings.HasPrefix(query, `INSERT INTO "audit_events"`) && !strings.HasPrefix(query, `SELECT * FROM "config_items"`) {
+		return nil, errors.New("unexpected query: " + query)
+	}
+	p.statements = append(p.statements, query)
+	return sql.OpenDB(emptyConnector{}).QueryContext(ctx, query)
+}
+
+// emptyConnector is a database/sql driver answering every query with no rows
+type emptyConnector struct{}
+
+func (emptyConnector) Connect(context.Context) (driver.Conn, error) { return emptyConn{}, nil }
+func (emptyConnector) Driver() driver.Driver                        { return nil }
+
+type emptyConn struct{}
+
+func (emptyConn) Prepare(query string) (driver.Stmt, error) { return emptyStmt{}, nil }
+func (emptyConn) Close() error                              { return nil }
+func (emptyConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+type emptyStmt struct{}
+
+func (emptyStmt) Close() error                                    { return nil }
+func (emptyStmt) NumInput() int                                   { return -1 }
+func (emptyStmt) Exec(args []driver.Value) (driver.Result, error) { return driver.RowsAffected(0), nil }
+func (emptyStmt) Query(args []driver.Value) (driver.Rows, error)  { return emptyRows{}, nil }
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string              { return nil }
+func (emptyRows) Close() error                   { return nil }
+func (emptyRows) Next(dest []driver.Value) error { return io.EOF }
+
+func (p *recordingPool) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	panic("unexpected query: " + query)
+}
+
+func (p *recordingPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	return p, nil
+}
+
+func (p *recordingPool) Commit() error   { return nil }
+func (p *recordingPool) Rollback() error { return nil }
+
+func useRecordingDB(t *testing.T) *recordingPool {
+	t.Helper()
+	pool := &recordingPool{}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: pool}), &gorm.Config{
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous, previousWebhook := database.DB, rotationWebhook
+	database.DB, rotationWebhook = db, nil
+	t.Cleanup(func() { database.DB, rotationWebhook = previous, previousWebhook })
+	return pool
+}
+
+func TestCommitRotationBatchesUpdates(t *testing.T) {
+	pool := useRecordingDB(t)
+
+	const itemCount = 1000
+	items := make([]ReEncryptedConfigItem, itemCount)
+	for i := range items {
+		items[i] = ReEncryptedConfigItem{ID: uuid.NewString(), Value: "v2:" + uuid.NewString()}
+	}
+	teamKeys := []TeamEncryptedKeyEntry{
+		{TeamID: uuid.NewString(), EncryptedProjectKey: "team-a"},
+		{TeamID: uuid.NewString(), EncryptedProjectKey: "team-b"},
+	}
+	feks := []ReEncryptedFileFEK{{ID: uuid.NewString(), EncryptedFEK: "fek"}}
+
+	itemsJSON, _ := json.Marshal(items)
+	teamKeysJSON, _ := json.Marshal(teamKeys)
+	feksJSON, _ := json.Marshal(feks)
+	pending := &models.PendingKeyRotation{
+		ID:                        uuid.New(),
+		NewVersion:                2,
+		EncryptedConfigsSnapshot:  string(itemsJSON),
+		TeamEncryptedKeys:         string(teamKeysJSON),
+		EncryptedFileFEKsSnapshot: string(feksJSON),
+	}
+	project := &models.Project{ID: uuid.New()}
+
+	if err := commitRotation(context.Background(), pending, project, uuid.New()); err != nil {
+		t.Fatal(err)
+	}
+
+	perTable := map[string]int{}
+	for _, statement := range pool.statements {
+		fields := strings.Fields(statement)
+		if len(fields) > 1 && fields[0] == "UPDATE" {
+			perTable[strings.Trim(fields[1], `"`)]++
+		}
+	}
+	for _, table := range []string{"config_items", "team_projects", "project_files"} {
+		if perTable[table] != 1 {
+			t.Errorf("%s updated in %d statements, want 1", table, perTable[table])
+		}
+	}
+
+	purged := false
+	for _, statement := range pool.statements {
+		if strings.HasPrefix(statement, `UPDATE "config_items"`) {
+			if whens := strings.Count(statement, " WHEN "); whens != itemCount {
+				t.Errorf("config_items update sets %d rows, want %d", whens, itemCount)
+			}
+		}
+		if strings.HasPrefix(statement, `DELETE FROM "config_items"`) && strings.Contains(statement, "deleted_at IS NOT NULL") {
+			purged = true
+		}
+	}
+	if !purged {
+		t.Error("deleted config items not purged with the old key")
+	}
+
+	audited := 0
+	for _, statement := range pool.statements {
+		if strings.HasPrefix(statement, `INSERT INTO "audit_events"`) {
+			audited++
+		}
+	}
+	if audited != 1 {
+		t.Errorf("%d audit events recorded, want 1 for the activity feed", audited)
+	}
+}
+
+func TestBulkUpdateColumnChunks(t *testing.T) {
+	pool := useRecordingDB(t)
+
+	values := make([]columnUpdate, rotationBatchSize+1)
+	for i := range values {
+		values[i] = columnUpdate{Key: uuid.NewString(), Value: "v"}
+	}
+	if err := bulkUpdateColumn(database.DB, &models.ConfigItem{}, uuid.New(), "id", "value", values); err != nil {
+		t.Fatal(err)
+	}
+	if len(pool.statements) != 2 {
+		t.Errorf("%d statements for %d rows, want 2", len(pool.statements), len(values))
+	}
+}
+
+func TestDiffRotationIDs(t *testing.T) {
+	current := []RotationResource{{ID: "a", Name: "A"}, {ID: "b", Name: "B"}, {ID: "c", Name: "C"}}
+
+	missing, unknown := diffRotationIDs(current, []string{"a", "c", "x"})
+	if strings.Join(missing, ",") != "b" || strings.Join(unknown, ",") != "x" {
+		t.Errorf("missing = %v, unknown = %v", missing, unknown)
+	}
+
+	missing, unknown = diffRotationIDs(current, nil)
+	if len(missing) != 3 || unknown == nil || len(unknown) != 0 {
+		t.Errorf("empty payload: missing = %v, unknown = %v", missing, unknown)
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"envie-backend/internal/auth"
+	"envie-backend/internal/middleware"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// invalidLinkingCodeMessage is the same whatever went wrong, so an attempt
+// doesn't tell whether it hit a live code
+const invalidLinkingCodeMessage = "Invalid or expired linking code. A wrong code stops working, sign in again for a new one"
+
+// claimLinkingCode marks the typed linking code as used and returns it. A wrong
+// code locks the live code with the same selector, and a client with too many
+// recent failures is refused without a lookup. If the code can't be claimed it
+// sends the error response automatically.
+func claimLinkingCode(c *gin.Context, typed string) (*models.LinkingCode, bool) {
+	now := time.Now()
+	clientIP := middleware.ClientIP(c)
+
+	var failures int64
+	if err := requestDB(c).Model(&models.LinkingCodeFailure{}).
+		Where("client_ip = ? AND created_at > ?", clientIP, now.Add(-auth.LinkingCodeFailureWindow)).
+		Count(&failures).Error; err != nil {
+		RespondInternalError(c, "Failed to check linking code attempts")
+		return nil, false
+	}
+	if failures >= auth.LinkingCodeClientMaxFailures {
+		RespondError(c, http.StatusTooManyRequests, "Too many failed linking code attempts, try again later")
+		return nil, false
+	}
+
+	code := auth.NormalizeLinkingCode(typed)
+	var linkingCode models.LinkingCode
+	err := requestDB(c).Where("selector = ? AND used_at IS NULL AND locked_at IS NULL AND expires_at > ?", auth.LinkingCodeSelector(code), now).
+		First(&linkingCode).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		recordLinkingCodeFailure(c, clientIP, auth.LinkingCodeUnknown, nil)
+		RespondUnauthorized(c, invalidLinkingCodeMessage)
+		return nil, false
+	}
+	if err != nil {
+		RespondInternalError(c, "Failed to check linking code")
+		return nil, false
+	}
+
+	if !auth.LinkingCodeMatches(linkingCode.Code, code) {
+		if err := requestDB(c).Model(&linkingCode).UpdateColumns(map[string]any{
+			"failed_attempts": gorm.Expr("failed_attempts + 1"),
+			"locked_at":       gorm.Expr("CASE WHEN failed_attempts + 1 >= ? THEN ? ELSE locked_at END", auth.LinkingCodeMaxFailures, now),
+		}).Error; err != nil {
+			log.Printf("Failed to count a wrong attempt at linking code %s: %v", linkingCode.ID, err)
+		}
+		log.Printf("Wrong linking code for user %s from %s", linkingCode.UserID, clientIP)
+		recordLinkingCodeFailure(c, clientIP, auth.LinkingCodeMismatch, &linkingCode)
+		RespondUnauthorized(c, invalidLinkingCodeMessage)
+		return nil, false
+	}
+
+	// Conditional, so a code exchanged twice at once is claimed once
+	claimed := requestDB(c).Model(&linkingCode).Where("used_at IS NULL AND locked_at IS NULL").Update("used_at", now)
+	if claimed.Error != nil {
+		RespondInternalError(c, "Failed to claim linking code")
+		return nil, false
+	}
+	if claimed.RowsAffected != 1 {
+		RespondUnauthorized(c, invalidLinkingCodeMessage)
+		return nil, false
+	}
+	return &linkingCode, true
+}
+
+func recordLinkingCodeFailure(c *gin.Context, clientIP, reason string, linkingCode *models.LinkingCode) {
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	failure := models.LinkingCodeFailure{ClientIP: clientIP, UserAgent: userAgent, Reason: reason}
+	if linkingCode != nil {
+		failure.LinkingCodeID = &linkingCode.ID
+		failure.UserID = &linkingCode.UserID
+	}
+	if err := requestDB(c).Create(&failure).Error; err != nil {
+		log.Printf("Failed to record a failed linking code exchange: %v", err)
+	}
+}
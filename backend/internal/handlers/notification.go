@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"time"
+
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// NotificationPage - a page of the notification center, newest first
+type NotificationPage struct {
+	Items      []models.Notification `json:"items"`
+	NextCursor string                `json:"nextCursor,omitempty"`
+}
+
+// GetNotifications lists the user's notifications; unread=true leaves out the
+// ones already read
+func GetNotifications(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	page, ok := RequestedPage(c)
+	if !ok {
+		return
+	}
+
+	query := requestDB(c).Where("user_id = ?", uid)
+	if c.Query("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var notifications []models.Notification
+	if err := page.Apply(query, "notifications").Find(&notifications).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch notifications")
+		return
+	}
+
+	var response NotificationPage
+	response.Items, response.NextCursor = pageItems(page, notifications, func(n *models.Notification) (time.Time, uuid.UUID) {
+		return n.CreatedAt, n.ID
+	})
+	RespondOK(c, response)
+}
+
+func MarkNotificationRead(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	notificationID, ok := ParseUUIDParam(c, "id", "notification")
+	if !ok {
+		return
+	}
+
+	result := requestDB(c).Model(&models.Notification{}).
+		Where("id = ? AND user_id = ? AND read_at IS NULL", notificationID, uid).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		RespondInternalError(c, "Failed to update notification")
+		return
+	}
+
+	RespondMessage(c, "Notification marked as read")
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"sort"
+	"time"
+
+	"envie-backend/internal/auth"
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OffboardedTeam - a team the offboarded user was removed from
+type OffboardedTeam struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+// OffboardedProject - a project whose key the offboarded user could decrypt,
+// through the organization key or the key of one of their teams
+type OffboardedProject struct {
+	ID                 uuid.UUID `json:"id"`
+	Name               string    `json:"name"`
+	KeyVersion         int       `json:"keyVersion"`
+	ViaOrganizationKey bool      `json:"viaOrganizationKey"`
+	ViaTeams           []string  `json:"viaTeams"`
+}
+
+// OffboardingReport - what offboarding a member changed, for the admin
+type OffboardingReport struct {
+	UserID               uuid.UUID           `json:"userId"`
+	Email                string              `json:"email"`
+	TeamsLeft            []OffboardedTeam    `json:"teamsLeft"`
+	RefreshTokensRevoked int64               `json:"refreshTokensRevoked"`
+	DevicesRevoked       int64               `json:"devicesRevoked"`
+	RotationsCancelled   int64               `json:"rotationsCancelled"` // pending rotations to a key the user may know
+	Projects             []OffboardedProject `json:"projects"`           // each now requires a key rotation
+}
+
+// OffboardOrganizationMember removes a member like RemoveOrganizationMember, and
+// also signs them out everywhere: their refresh tokens are revoked and their
+// devices deleted. Every project whose key they could decrypt is flagged as
+// requiring a rotation, which a project admin initiates from a client since
+// only clients hold keys; pending rotations of those projects are cancelled.
+func OffboardOrganizationMember(c *gin.Context) {
+	requesterUID, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	targetUserID, ok := ParseUUIDParam(c, "userId", "user")
+	if !ok {
+		return
+	}
+
+	if requesterUID == targetUserID {
+		RespondBadRequest(c, "Cannot offboard yourself")
+		return
+	}
+
+	targetOrgUser, ok := requireRemovableMember(c, requesterUID, orgID, targetUserID)
+	if !ok {
+		return
+	}
+
+	var user models.User
+	if err := requestDB(c).Select("id, email").First(&user, "id = ?", targetUserID).Error; err != nil {
+		RespondNotFound(c, "User not found")
+		return
+	}
+
+	report := OffboardingReport{UserID: targetUserID, Email: user.Email}
+	now := time.Now()
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		var err error
+		if report.TeamsLeft, err = memberTeams(tx, orgID, targetUserID); err != nil {
+			return err
+		}
+		if report.Projects, err = exposedProjects(tx, orgID, targetUserID, targetOrgUser.EncryptedOrganizationKey != nil); err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ? AND team_id IN (SELECT id FROM teams WHERE organization_id = ?)", targetUserID, orgID).Delete(&models.TeamUser{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(targetOrgUser).Error; err != nil {
+			return err
+		}
+
+		if report.RefreshTokensRevoked, err = auth.RevokeUserRefreshTokens(tx, targetUserID, auth.RevokedOffboard, now); err != nil {
+			return err
+		}
+		devices := tx.Where("user_id = ?", targetUserID).Delete(&models.UserIdentity{})
+		if devices.Error != nil {
+			return devices.Error
+		}
+		report.DevicesRevoked = devices.RowsAffected
+
+		if len(report.Projects) == 0 {
+			return nil
+		}
+		projectIDs := make([]uuid.UUID, len(report.Projects))
+		for i, project := range report.Projects {
+			projectIDs[i] = project.ID
+		}
+
+		cancelled := tx.Model(&models.PendingKeyRotation{}).
+			Where("project_id IN ? AND status = ?", projectIDs, "pending").
+			Update("status", "cancelled")
+		if cancelled.Error != nil {
+			return cancelled.Error
+		}
+		report.RotationsCancelled = cancelled.RowsAffected
+
+		// UpdateColumns leaves updated_at, which orders the project lists, alone
+		return tx.Model(&models.Project{}).Where("id IN ?", projectIDs).UpdateColumns(map[string]any{
+			"key_rotation_required_at":     now,
+			"key_rotation_required_reason": "Offboarded " + user.Email,
+		}).Error
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to offboard member")
+		return
+	}
+
+	RespondOK(c, report)
+}
+
+func memberTeams(db *gorm.DB, orgID, userID uuid.UUID) ([]OffboardedTeam, error) {
+	teams := []OffboardedTeam{}
+	err := db.Table("teams").Select("teams.id, teams.name").
+		Joins("JOIN team_users ON team_users.team_id = teams.id").
+		Where("teams.organization_id = ? AND team_users.user_id = ? AND teams.deleted_at IS NULL", orgID, userID).
+		Order("teams.name").Scan(&teams).Error
+	return teams, err
+}
+
+// exposedProjects lists the organization's projects whose key the user could
+// decrypt: those of their teams, or all of them when they held the organization
+// key, which decrypts every team key
+func exposedProjects(db *gorm.DB, orgID, userID uuid.UUID, heldOrgKey bool) ([]OffboardedProject, error) {
+	var rows []struct {
+		ID         uuid.UUID
+		Name       string
+		KeyVersion int
+		TeamName   *string
+	}
+	query := db.Table("projects").
+		Select("projects.id, projects.name, projects.key_version, teams.name AS team_name").
+		Joins("LEFT JOIN team_projects ON team_projects.project_id = projects.id").
+		Joins("LEFT JOIN teams ON teams.id = team_projects.team_id AND teams.deleted_at IS NULL AND teams.id IN (?)",
+			db.Table("team_users").Select("team_id").Where("user_id = ?", userID)).
+		Where("projects.organization_id = ? AND projects.deleted_at IS NULL", orgID)
+	if !heldOrgKey {
+		query = query.Where("teams.id IS NOT NULL")
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	projects := []OffboardedProject{}
+	index := map[uuid.UUID]int{}
+	for _, row := range rows {
+		i, seen := index[row.ID]
+		if !seen {
+			i = len(projects)
+			index[row.ID] = i
+			projects = append(projects, OffboardedProject{
+				ID:                 row.ID,
+				Name:               row.Name,
+				KeyVersion:         row.KeyVersion,
+				ViaOrganizationKey: heldOrgKey,
+				ViaTeams:           []string{},
+			})
+		}
+		if row.TeamName != nil {
+			projects[i].ViaTeams = append(projects[i].ViaTeams, *row.TeamName)
+		}
+	}
+
+	sort.Slice(projects, func(i, j int) bool { return projects[i].Name < projects[j].Name })
+	for i := range projects {
+		sort.Strings(projects[i].ViaTeams)
+	}
+	return projects, nil
+}
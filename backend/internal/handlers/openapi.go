@@ -0,0 +1,381 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"envie-backend/internal/auth"
+	"envie-backend/internal/keypolicy"
+	"envie-backend/internal/models"
+	"envie-backend/internal/openapi"
+)
+
+// MessageResponse is the body sent by RespondMessage
+type MessageResponse struct {
+	Message string `json:"message" binding:"required"`
+}
+
+// DescribeAPI registers OpenAPI metadata for every handler. Keep this in sync when
+// adding routes - handlers without metadata are left out of the spec, and the
+// router tests fail for any route that isn't described here.
+func DescribeAPI(g *openapi.Generator) {
+	page := []openapi.Parameter{
+		openapi.QueryParam("limit", "Page size, 50 by default and at most 200", false),
+		openapi.QueryParam("cursor", "nextCursor of the previous page", false),
+	}
+	fields := openapi.QueryParam("fields", "Comma-separated JSON fields to return, all when omitted", false)
+	label := openapi.QueryParam("label", "Only what carries this compliance label, on its own or through its project", false)
+	twoFactor := openapi.Parameter{Name: TwoFactorCodeHeader, In: "header", Description: "TOTP or recovery code, required once the user has enabled 2FA", Schema: openapi.Schema{Type: "string"}}
+
+	// Auth
+	g.Describe(AuthLogin, openapi.Operation{Tag: "auth", Summary: "Start GitHub OAuth login", Public: true, Status: http.StatusTemporaryRedirect})
+	g.Describe(AuthLoginGoogle, openapi.Operation{Tag: "auth", Summary: "Start Google OAuth login", Public: true, Status: http.StatusTemporaryRedirect})
+	g.Describe(AuthCallback, openapi.Operation{Tag: "auth", Summary: "GitHub OAuth callback, renders the linking code page", Public: true})
+	g.Describe(AuthCallbackGoogle, openapi.Operation{Tag: "auth", Summary: "Google OAuth callback, renders the linking code page", Public: true})
+	g.Describe(SSOLogin, openapi.Operation{Tag: "auth", Summary: "Start signing in at an organization's OpenID Connect provider", Public: true, Status: http.StatusTemporaryRedirect,
+		Parameters: []openapi.Parameter{openapi.QueryParam("link", "Link token from the SSO link endpoint, to link the identity to an existing account", false)}})
+	g.Describe(SSOCallback, openapi.Operation{Tag: "auth", Summary: "OpenID Connect callback, renders the linking code page", Public: true})
+	g.Describe(AuthDeviceChallenge, openapi.Operation{Tag: "auth", Summary: "Challenge a device to prove its key before an exchange", Public: true, Request: DeviceChallengeRequest{}, Response: auth.DeviceChallenge{}})
+	g.Describe(AuthExchange, openapi.Operation{Tag: "auth", Summary: "Exchange a linking code for tokens", Public: true, Request: ExchangeRequest{}, Response: ExchangeResponse{}})
+	g.Describe(AuthRefresh, openapi.Operation{Tag: "auth", Summary: "Refresh an access token", Public: true, Request: RefreshRequest{}})
+	g.Describe(AuthLogout, openapi.Operation{Tag: "auth", Summary: "Log out", Response: MessageResponse{}})
+
+	// User
+	g.Describe(GetMe, openapi.Operation{Tag: "user", Summary: "Get the current user", Response: models.User{}})
+	g.Describe(DeleteAccount, openapi.Operation{Tag: "user", Summary: "Delete the current user's account", Response: AccountDeletionResponse{}, Parameters: []openapi.Parameter{twoFactor}})
+	g.Describe(ExportAccount, openapi.Operation{Tag: "user", Summary: "Export everything stored about the current user", Response: AccountExport{}})
+	g.Describe(SetPublicKey, openapi.Operation{Tag: "user", Summary: "Set the master public key", Request: SetPublicKeyRequest{}})
+	g.Describe(RotateMasterKey, openapi.Operation{Tag: "user", Summary: "Rotate the master key pair", Request: RotateMasterKeyRequest{}, Parameters: []openapi.Parameter{twoFactor}})
+	g.Describe(SearchUserByEmail, openapi.Operation{Tag: "user", Summary: "Find a user by email", Parameters: []openapi.Parameter{openapi.QueryParam("email", "Exact email address", true)}})
+
+	// Instance administration
+	g.Describe(GetInstanceMetrics, openapi.Operation{Tag: "instance", Summary: "Count the users, organizations, tokens, sessions and files of the instance", Response: InstanceMetrics{}})
+	g.Describe(ListInstanceOrganizations, openapi.Operation{Tag: "instance", Summary: "List every organization with its size, newest first", Response: InstanceOrganizationPage{}, Parameters: append([]openapi.Parameter{
+		openapi.QueryParam("q", "Only organizations whose name contains this", false),
+	}, page...)})
+	g.Describe(UpdateOrganizationPlanLimits, openapi.Operation{Tag: "instance", Summary: "Override the instance's usage limits for an organization", Description: "Null fields use the instance's limits, 0 is unlimited. Lowering a limit below the usage refuses adding more and keeps what exists.", Request: UpdatePlanLimitsRequest{}, Response: models.PlanLimits{}})
+	g.Describe(ListInstanceUsers, openapi.Operation{Tag: "instance", Summary: "List every account, newest first", Response: InstanceUserPage{}, Parameters: append([]openapi.Parameter{
+		openapi.QueryParam("q", "Only accounts whose name or email contains this", false),
+		openapi.QueryParam("disabled", "true for disabled accounts only, false for the others", false),
+	}, page...)})
+	g.Describe(DisableInstanceUser, openapi.Operation{Tag: "instance", Summary: "Disable an account, ending its sessions", Response: InstanceUser{}})
+	g.Describe(EnableInstanceUser, openapi.Operation{Tag: "instance", Summary: "Let a disabled account sign in again", Response: InstanceUser{}})
+	g.Describe(UpdateInstanceUserRole, openapi.Operation{Tag: "instance", Summary: "Grant or remove the superadmin role", Request: UpdateInstanceRoleRequest{}, Response: InstanceUser{}})
+	g.Describe(RevokeInstanceTokens, openapi.Operation{Tag: "instance", Summary: "Revoke CLI tokens across organizations", Description: "Each affected organization gets a tokens_revoked event in its audit log.", Request: InstanceRevokeTokensRequest{}, Response: RevokeTokensResponse{}})
+	g.Describe(GetInstanceEvents, openapi.Operation{Tag: "instance", Summary: "List what instance administrators did, newest first", Response: InstanceEventPage{}, Parameters: page})
+
+	// Two-factor authentication
+	g.Describe(GetTwoFactorStatus, openapi.Operation{Tag: "two-factor", Summary: "Get the 2FA status", Response: TwoFactorStatusResponse{}})
+	g.Describe(SetupTwoFactor, openapi.Operation{Tag: "two-factor", Summary: "Start 2FA enrollment with a new TOTP secret", Response: TwoFactorSetupResponse{}})
+	g.Describe(EnableTwoFactor, openapi.Operation{Tag: "two-factor", Summary: "Confirm enrollment and get recovery codes", Request: TwoFactorCodeRequest{}, Response: RecoveryCodesResponse{}})
+	g.Describe(DisableTwoFactor, openapi.Operation{Tag: "two-factor", Summary: "Disable 2FA", Request: TwoFactorCodeRequest{}, Response: MessageResponse{}})
+	g.Describe(RegenerateRecoveryCodes, openapi.Operation{Tag: "two-factor", Summary: "Replace the recovery codes", Request: TwoFactorCodeRequest{}, Response: RecoveryCodesResponse{}})
+	g.Describe(GetTwoFactorEvents, openapi.Operation{Tag: "two-factor", Summary: "List 2FA events, newest first", Response: TwoFactorEventPage{}, Parameters: page})
+
+	// Notification center
+	g.Describe(GetNotifications, openapi.Operation{Tag: "notifications", Summary: "List the current user's notifications, newest first", Response: NotificationPage{}, Parameters: append([]openapi.Parameter{
+		openapi.QueryParam("unread", "true lists only unread notifications", false),
+	}, page...)})
+	g.Describe(MarkNotificationRead, openapi.Operation{Tag: "notifications", Summary: "Mark a notification as read", Response: MessageResponse{}})
+
+	// Pairing
+	g.Describe(StartPairing, openapi.Operation{Tag: "auth", Summary: "Start pairing a new device by QR code", Public: true, Request: StartPairingRequest{}, Response: PairingStarted{}, Status: http.StatusCreated})
+	g.Describe(PairingToken, openapi.Operation{Tag: "auth", Summary: "Poll a pairing for the new device's tokens (202 while pending)", Public: true, Request: PairingTokenRequest{}, Response: ExchangeResponse{}})
+	g.Describe(GetPairing, openapi.Operation{Tag: "pairing", Summary: "Show a device waiting for approval", Response: models.DevicePairing{}, Parameters: []openapi.Parameter{
+		openapi.QueryParam("code", "Approval code from the QR code", true),
+	}})
+	g.Describe(ApprovePairing, openapi.Operation{Tag: "pairing", Summary: "Sign a waiting device in", Request: PairingDecisionRequest{}, Response: models.DevicePairing{}, Parameters: []openapi.Parameter{twoFactor}})
+	g.Describe(DenyPairing, openapi.Operation{Tag: "pairing", Summary: "Refuse a waiting device", Request: PairingDecisionRequest{}, Response: models.DevicePairing{}})
+
+	// Sessions
+	g.Describe(GetSessions, openapi.Operation{Tag: "sessions", Summary: "List the current user's signed-in sessions", Response: []SessionResponse{}})
+	g.Describe(RevokeSession, openapi.Operation{Tag: "sessions", Summary: "Sign out a session", Response: MessageResponse{}})
+
+	// Devices
+	g.Describe(RegisterDevice, openapi.Operation{Tag: "devices", Summary: "Register a device", Request: RegisterDeviceRequest{}, Response: models.UserIdentity{}, Status: http.StatusCreated})
+	g.Describe(GetDevices, openapi.Operation{Tag: "devices", Summary: "List devices", Response: []models.UserIdentity{}})
+	g.Describe(UpdateDevice, openapi.Operation{Tag: "devices", Summary: "Rename a device", Request: UpdateDeviceRequest{}, Response: models.UserIdentity{}})
+	g.Describe(DeleteDevice, openapi.Operation{Tag: "devices", Summary: "Delete a device", Response: MessageResponse{}, Parameters: []openapi.Parameter{twoFactor}})
+	g.Describe(DeleteAllDevices, openapi.Operation{Tag: "devices", Summary: "Delete all devices", Response: MessageResponse{}, Parameters: []openapi.Parameter{twoFactor}})
+
+	// Projects
+	g.Describe(CreateProject, openapi.Operation{Tag: "projects", Summary: "Create a project", Request: CreateProjectRequest{}, Status: http.StatusCreated})
+	g.Describe(GetProjects, openapi.Operation{Tag: "projects", Summary: "List accessible projects", Response: []ProjectListItem{}, Parameters: []openapi.Parameter{fields, label}})
+	g.Describe(GetOrganizationProjects, openapi.Operation{Tag: "projects", Summary: "List projects of an organization", Response: []ProjectListItem{}, Parameters: []openapi.Parameter{fields, label}})
+	g.Describe(SearchProjects, openapi.Operation{Tag: "projects", Summary: "Search accessible projects by name, slug or tag", Description: "Favorites first, then the most recently updated.", Response: []ProjectListItem{}, Parameters: []openapi.Parameter{
+		openapi.QueryParam("q", "Part of a name, slug or tag, case-insensitive", false),
+		openapi.QueryParam("tag", "Comma-separated tags the projects must all carry", false),
+		fields,
+	}})
+	g.Describe(GetProjectSchema, openapi.Operation{Tag: "projects", Summary: "List the variables the project requires", Response: ProjectSchemaResponse{}})
+	g.Describe(PutProjectSchema, openapi.Operation{Tag: "projects", Summary: "Replace the variables the project requires", Request: SetProjectSchemaRequest{}, Response: ProjectSchemaResponse{}})
+	g.Describe(SetProjectTags, openapi.Operation{Tag: "projects", Summary: "Replace a project's tags", Request: SetProjectTagsRequest{}, Response: ProjectTagsResponse{}})
+	g.Describe(FavoriteProject, openapi.Operation{Tag: "projects", Summary: "Add a project to the user's favorites", Response: MessageResponse{}})
+	g.Describe(UnfavoriteProject, openapi.Operation{Tag: "projects", Summary: "Remove a project from the user's favorites", Response: MessageResponse{}})
+	g.Describe(GetProject, openapi.Operation{Tag: "projects", Summary: "Get a project", Response: ProjectResponse{}})
+	g.Describe(UpdateProject, openapi.Operation{Tag: "projects", Summary: "Update a project", Request: UpdateProjectRequest{}, Response: MessageResponse{}})
+	g.Describe(GetProjectRenames, openapi.Operation{Tag: "projects", Summary: "List a project's past names", Response: ProjectRenamePage{}, Parameters: page})
+	g.Describe(GetProjectActivity, openapi.Operation{Tag: "projects", Summary: "List a project's changes, newest first",
+		Description: "Config syncs with the checksum before and after, file uploads and deletions, token lifecycle events and key rotations, from the audit log.",
+		Response:    ActivityPage{},
+		Parameters: append([]openapi.Parameter{
+			openapi.QueryParam("since", "Only changes after this timestamp", false),
+			openapi.QueryParam("action", "Comma-separated actions to keep: "+strings.Join(projectActivityActions, ", "), false),
+		}, page...)})
+	g.Describe(GetSandboxFixtures, openapi.Operation{Tag: "projects", Summary: "Generate fake config items for a sandbox project", Response: []SandboxFixture{}})
+	g.Describe(DeleteProject, openapi.Operation{Tag: "projects", Summary: "Delete a project", Response: MessageResponse{}, Parameters: []openapi.Parameter{
+		openapi.QueryParam("force", "true deletes a project with active tokens or recent CLI reads without a second owner confirming", false),
+	}})
+	g.Describe(GetConfigItems, openapi.Operation{Tag: "projects", Summary: "List encrypted config items", Response: []models.ConfigItem{}, Parameters: []openapi.Parameter{fields, label}})
+	g.Describe(SyncConfigItems, openapi.Operation{Tag: "projects", Summary: "Replace the project config", Request: SyncConfigItemRequest{}, Response: SyncConfigItemsResponse{}})
+	g.Describe(GetConfigTrash, openapi.Operation{Tag: "projects", Summary: "List deleted config items that can be restored", Response: []ConfigTrashItem{}})
+	g.Describe(RestoreConfigItem, openapi.Operation{Tag: "projects", Summary: "Restore a deleted config item", Response: models.ConfigItem{}})
+	diffStates := []openapi.Parameter{
+		openapi.QueryParam("from", "A snapshot ID, a config checksum or current", true),
+		openapi.QueryParam("to", "A snapshot ID, a config checksum or current (the default)", false),
+	}
+	g.Describe(GetConfigDiff, openapi.Operation{Tag: "projects", Summary: "List the config items added, removed and changed between two states", Response: ConfigDiff{}, Parameters: diffStates})
+	g.Describe(GetConfigSnapshots, openapi.Operation{Tag: "projects", Summary: "List config snapshots, newest first", Response: []models.ConfigSnapshot{}})
+	g.Describe(CreateConfigSnapshot, openapi.Operation{Tag: "projects", Summary: "Snapshot the current config", Request: CreateConfigSnapshotRequest{}, Response: models.ConfigSnapshot{}})
+	g.Describe(GetConfigSnapshot, openapi.Operation{Tag: "projects", Summary: "Get a config snapshot with its encrypted items", Response: models.ConfigSnapshot{}})
+	g.Describe(RestoreConfigSnapshot, openapi.Operation{Tag: "projects", Summary: "Replace the config with a snapshot", Response: RestoreConfigSnapshotResponse{}})
+	g.Describe(DeleteConfigSnapshot, openapi.Operation{Tag: "projects", Summary: "Delete a config snapshot", Response: MessageResponse{}})
+	g.Describe(GetConfigDrafts, openapi.Operation{Tag: "projects", Summary: "List config drafts and the items they change, newest first", Response: []ConfigDraftResponse{}, Parameters: []openapi.Parameter{
+		openapi.QueryParam("status", "open (the default), applied, rejected, discarded or all", false),
+	}})
+	g.Describe(CreateConfigDraft, openapi.Operation{Tag: "projects", Summary: "Stage a config for review without changing the live config", Request: ConfigDraftRequest{}, Response: models.ConfigDraft{}, Status: http.StatusCreated})
+	g.Describe(GetConfigDraft, openapi.Operation{Tag: "projects", Summary: "Get a config draft with its encrypted items", Response: ConfigDraftResponse{}})
+	g.Describe(UpdateConfigDraft, openapi.Operation{Tag: "projects", Summary: "Replace the items of your config draft", Request: ConfigDraftRequest{}, Response: models.ConfigDraft{}})
+	g.Describe(ApproveConfigDraft, openapi.Operation{Tag: "projects", Summary: "Apply a config draft to the live config", Response: MessageResponse{}})
+	g.Describe(RejectConfigDraft, openapi.Operation{Tag: "projects", Summary: "Reject a config draft", Request: RejectConfigDraftRequest{}, Response: MessageResponse{}})
+	g.Describe(DiscardConfigDraft, openapi.Operation{Tag: "projects", Summary: "Discard your config draft", Response: MessageResponse{}})
+	g.Describe(GetProjectTeams, openapi.Operation{Tag: "projects", Summary: "List teams with access to a project", Response: ProjectAccessResponse{}})
+	g.Describe(AddTeamToProject, openapi.Operation{Tag: "projects", Summary: "Grant a team access to a project", Request: AddTeamToProjectRequest{}, Response: MessageResponse{}, Status: http.StatusCreated})
+
+	// Compliance labels
+	g.Describe(GetComplianceLabels, openapi.Operation{Tag: "compliance", Summary: "List the organization's compliance labels", Response: []models.ComplianceLabel{}})
+	g.Describe(CreateComplianceLabel, openapi.Operation{Tag: "compliance", Summary: "Create a compliance label", Request: CreateComplianceLabelRequest{}, Response: models.ComplianceLabel{}, Status: http.StatusCreated})
+	g.Describe(DeleteComplianceLabel, openapi.Operation{Tag: "compliance", Summary: "Delete a compliance label and untag everything carrying it", Response: MessageResponse{}})
+	g.Describe(GetComplianceReport, openapi.Operation{Tag: "compliance", Summary: "List the projects and config items under each label", Response: []ComplianceReportEntry{}})
+	g.Describe(GetProjectComplianceLabels, openapi.Operation{Tag: "compliance", Summary: "List the labels of a project and its config items", Response: ProjectComplianceLabelsResponse{}})
+	g.Describe(SetProjectComplianceLabels, openapi.Operation{Tag: "compliance", Summary: "Replace the labels of a project", Request: SetComplianceLabelsRequest{}, Response: []models.ComplianceLabel{}})
+	g.Describe(SetConfigItemComplianceLabels, openapi.Operation{Tag: "compliance", Summary: "Replace the labels of a config item", Request: SetComplianceLabelsRequest{}, Response: []models.ComplianceLabel{}})
+	g.Describe(GetProjectKeyHolders, openapi.Operation{Tag: "compliance", Summary: "List who can decrypt the project key", Response: ProjectKeyHoldersResponse{}})
+
+	// Secret managers
+	g.Describe(GetSecretManagerConfigs, openapi.Operation{Tag: "secret-managers", Summary: "List secret manager configurations", Response: []models.SecretManagerConfig{}})
+	g.Describe(CreateSecretManagerConfig, openapi.Operation{Tag: "secret-managers", Summary: "Create a secret manager configuration", Request: createSecretManagerConfigInput{}, Response: models.SecretManagerConfig{}, Status: http.StatusCreated})
+	g.Describe(UpdateSecretManagerConfig, openapi.Operation{Tag: "secret-managers", Summary: "Update a secret manager configuration", Request: updateSecretManagerConfigInput{}, Response: models.SecretManagerConfig{}})
+	g.Describe(DeleteSecretManagerConfig, openapi.Operation{Tag: "secret-managers", Summary: "Delete a secret manager configuration", Response: MessageResponse{}})
+
+	// Deployment targets
+	g.Describe(GetDeploymentTargets, openapi.Operation{Tag: "deployments", Summary: "List deployment targets", Response: []models.DeploymentTarget{}})
+	g.Describe(CreateDeploymentTarget, openapi.Operation{Tag: "deployments", Summary: "Create a deployment target", Request: CreateDeploymentTargetRequest{}, Response: models.DeploymentTarget{}, Status: http.StatusCreated})
+	g.Describe(UpdateDeploymentTarget, openapi.Operation{Tag: "deployments", Summary: "Update a deployment target", Request: UpdateDeploymentTargetRequest{}, Response: models.DeploymentTarget{}})
+	g.Describe(DeleteDeploymentTarget, openapi.Operation{Tag: "deployments", Summary: "Delete a deployment target", Response: MessageResponse{}})
+	g.Describe(GetDeploymentSyncs, openapi.Operation{Tag: "deployments", Summary: "List sync runs of a target, newest first", Response: DeploymentSyncPage{}, Parameters: page})
+	g.Describe(ReportDeploymentSync, openapi.Operation{Tag: "deployments", Summary: "Report the result of a sync run", Request: ReportDeploymentSyncRequest{}, Response: models.DeploymentSync{}})
+
+	// Key rotation
+	g.Describe(GetPendingRotation, openapi.Operation{Tag: "key-rotation", Summary: "Get the pending key rotation of a project", Response: PendingRotationResponse{}})
+	g.Describe(InitiateKeyRotation, openapi.Operation{Tag: "key-rotation", Summary: "Initiate a project key rotation", Request: InitiateRotationRequest{}, Response: KeyRotationResult{}})
+	g.Describe(GetKeyRotationPolicies, openapi.Operation{Tag: "key-rotation", Summary: "List the key age policies of an organization", Response: KeyRotationPoliciesResponse{}})
+	g.Describe(PutOrganizationKeyRotationPolicy, openapi.Operation{Tag: "key-rotation", Summary: "Set the maximum key age and rotation approval window of an organization's projects", Request: KeyRotationPolicyRequest{}, Response: models.KeyRotationPolicy{}})
+	g.Describe(DeleteOrganizationKeyRotationPolicy, openapi.Operation{Tag: "key-rotation", Summary: "Remove the organization key age policy", Response: MessageResponse{}})
+	g.Describe(GetOverdueKeyRotations, openapi.Operation{Tag: "key-rotation", Summary: "List projects whose key is older than their policy allows", Response: []keypolicy.OverdueProject{}})
+	g.Describe(PutProjectKeyRotationPolicy, openapi.Operation{Tag: "key-rotation", Summary: "Override the key age and rotation approval policy for a project", Request: KeyRotationPolicyRequest{}, Response: models.KeyRotationPolicy{}})
+	g.Describe(DeleteProjectKeyRotationPolicy, openapi.Operation{Tag: "key-rotation", Summary: "Remove a project's key age override", Response: MessageResponse{}})
+	g.Describe(ValidateKeyRotation, openapi.Operation{Tag: "key-rotation", Summary: "Check a key rotation payload without initiating it", Request: RotationValidateRequest{}, Response: RotationValidationResponse{}})
+	g.Describe(ApproveKeyRotation, openapi.Operation{Tag: "key-rotation", Summary: "Approve a key rotation", Response: KeyRotationResult{}})
+	g.Describe(RejectKeyRotation, openapi.Operation{Tag: "key-rotation", Summary: "Reject a key rotation", Response: MessageResponse{}})
+	g.Describe(GetRotationImpact, openapi.Operation{Tag: "key-rotation", Summary: "Summarize the tokens, teams, secret manager syncs and CLI consumers a rotation affects", Response: RotationImpact{}})
+	g.Describe(GetRotationChanges, openapi.Operation{Tag: "key-rotation", Summary: "List what changed in the project since a rotation's snapshot", Response: RotationChanges{}})
+	g.Describe(RestartKeyRotation, openapi.Operation{Tag: "key-rotation", Summary: "Restart a stale key rotation with only what changed", Request: RestartRotationRequest{}, Response: KeyRotationResult{}})
+	g.Describe(CancelKeyRotation, openapi.Operation{Tag: "key-rotation", Summary: "Cancel a key rotation", Response: MessageResponse{}})
+	g.Describe(GetUserPendingRotations, openapi.Operation{Tag: "key-rotation", Summary: "List rotations awaiting the current user", Response: UserPendingRotationsResponse{}})
+
+	// Project tokens
+	g.Describe(GetPublicShares, openapi.Operation{Tag: "shares", Summary: "List public shares", Response: []PublicShareResponse{}})
+	g.Describe(CreatePublicShare, openapi.Operation{Tag: "shares", Summary: "Publish non-sensitive config items at a signed URL", Request: CreatePublicShareRequest{}, Response: PublicShareResponse{}, Status: http.StatusCreated})
+	g.Describe(UpdatePublicShare, openapi.Operation{Tag: "shares", Summary: "Republish or rename a public share", Request: UpdatePublicShareRequest{}, Response: PublicShareResponse{}})
+	g.Describe(DeletePublicShare, openapi.Operation{Tag: "shares", Summary: "Delete a public share", Response: MessageResponse{}})
+	g.Describe(GetPublicShareContent, openapi.Operation{Tag: "shares", Summary: "Get a public share by its signed URL", Public: true, Response: PublicShareContent{}, Parameters: []openapi.Parameter{
+		openapi.QueryParam("expires", "Expiry the URL was signed for, Unix seconds or 0", true),
+		openapi.QueryParam("signature", "URL signature", true),
+		openapi.QueryParam("format", "env for a dotenv file instead of JSON", false),
+	}})
+	g.Describe(CreateFileShare, openapi.Operation{Tag: "shares", Summary: "Share a file at an expiring signed URL", Description: "The file's FEK is wrapped with a key the recipient gets out of band. Shares last at most 30 days and can be single-use.", Request: CreateFileShareRequest{}, Response: FileShareResponse{}, Status: http.StatusCreated})
+	g.Describe(GetFileShares, openapi.Operation{Tag: "shares", Summary: "List file shares", Response: []FileShareResponse{}})
+	g.Describe(GetFileShareAccesses, openapi.Operation{Tag: "shares", Summary: "List the latest download attempts of a file share", Response: []models.FileShareAccess{}})
+	g.Describe(RevokeFileShare, openapi.Operation{Tag: "shares", Summary: "Revoke a file share", Response: MessageResponse{}})
+	g.Describe(GetFileShareContent, openapi.Operation{Tag: "shares", Summary: "Get a shared file by its signed URL", Public: true, Response: FileShareContent{}, Parameters: []openapi.Parameter{
+		openapi.QueryParam("expires", "Expiry the URL was signed for, Unix seconds", true),
+		openapi.QueryParam("signature", "URL signature", true),
+	}})
+	g.Describe(CreateProjectToken, openapi.Operation{Tag: "tokens", Summary: "Create a CLI token", Request: CreateProjectTokenRequest{}, Response: CreateProjectTokenResponse{}, Status: http.StatusCreated, Parameters: []openapi.Parameter{twoFactor}})
+	g.Describe(GetProjectTokens, openapi.Operation{Tag: "tokens", Summary: "List CLI tokens", Response: []ProjectTokenResponse{}})
+	g.Describe(DeleteProjectToken, openapi.Operation{Tag: "tokens", Summary: "Revoke a CLI token", Response: MessageResponse{}})
+	g.Describe(RenewProjectToken, openapi.Operation{Tag: "tokens", Summary: "Extend a CLI token's expiry", Request: RenewProjectTokenRequest{}, Response: ProjectTokenResponse{}, Parameters: []openapi.Parameter{twoFactor}})
+	g.Describe(RevokeProjectTokens, openapi.Operation{Tag: "tokens", Summary: "Revoke the project's CLI tokens matching filters", Request: RevokeTokensRequest{}, Response: RevokeTokensResponse{}})
+	g.Describe(RevokeOrganizationTokens, openapi.Operation{Tag: "tokens", Summary: "Revoke CLI tokens matching filters across the organization", Request: RevokeTokensRequest{}, Response: RevokeTokensResponse{}})
+	g.Describe(RotateProjectToken, openapi.Operation{Tag: "tokens", Summary: "Replace a CLI token, keeping the old one valid for a grace window", Request: RotateProjectTokenRequest{}, Response: RotateProjectTokenResponse{}, Status: http.StatusCreated, Parameters: []openapi.Parameter{twoFactor}})
+	g.Describe(SetTokenAllowedCIDRs, openapi.Operation{Tag: "tokens", Summary: "Replace the address ranges a CLI token may be used from", Request: SetTokenAllowedCIDRsRequest{}, Response: ProjectTokenResponse{}})
+	g.Describe(GetTokenAnomalies, openapi.Operation{Tag: "tokens", Summary: "List unusual uses of the project's CLI tokens, newest first", Response: TokenAnomalyPage{}, Parameters: append([]openapi.Parameter{
+		openapi.QueryParam("status", "open (default), acknowledged or all", false),
+	}, page...)})
+	g.Describe(AcknowledgeTokenAnomaly, openapi.Operation{Tag: "tokens", Summary: "Acknowledge a token anomaly", Response: models.TokenAnomaly{}})
+	g.Describe(DeleteProjectTokens, openapi.Operation{Tag: "tokens", Summary: "Delete the project's expired CLI tokens", Response: ExpiredTokenPurgeResponse{}, Parameters: []openapi.Parameter{openapi.QueryParam("expiredOnly", "Must be true; only expired tokens can be deleted in bulk", true)}})
+	g.Describe(GetExpiredTokenReport, openapi.Operation{Tag: "tokens", Summary: "List expired CLI tokens across the organization", Response: ExpiredTokenReport{}})
+	g.Describe(PurgeExpiredTokens, openapi.Operation{Tag: "tokens", Summary: "Delete expired CLI tokens across the organization", Response: ExpiredTokenReport{}})
+
+	// Files
+	g.Describe(ListProjectFiles, openapi.Operation{Tag: "files", Summary: "List project files", Response: []FileResponse{}})
+	g.Describe(UploadProjectFile, openapi.Operation{Tag: "files", Summary: "Upload an encrypted file (multipart/form-data)", Description: "The file is streamed to storage as it's read, up to the organization's file size limit.", Response: UploadFileResponse{}, Status: http.StatusCreated})
+	g.Describe(CreateFileUpload, openapi.Operation{Tag: "files", Summary: "Start a direct upload to storage", Description: "Returns a URL that accepts a PUT of exactly encryptedSize bytes for 15 minutes. The file is added to the project when the upload is finalized.", Request: CreateFileUploadRequest{}, Response: FileUploadResponse{}, Status: http.StatusCreated})
+	g.Describe(FinalizeFileUpload, openapi.Operation{Tag: "files", Summary: "Add a directly uploaded file to the project", Description: "Checks the stored file has the declared size. Fails with 409 if the project key was rotated since the upload started.", Response: UploadFileResponse{}, Status: http.StatusCreated})
+	g.Describe(DownloadProjectFile, openapi.Operation{Tag: "files", Summary: "Download an encrypted file", Response: FileDownloadResponse{}})
+	g.Describe(UpdateProjectFile, openapi.Operation{Tag: "files", Summary: "Rename or move a file", Request: UpdateProjectFileRequest{}, Response: UploadFileResponse{}})
+	g.Describe(ListFileFolders, openapi.Operation{Tag: "files", Summary: "List the folders holding files", Description: "Each folder with the number and total size of the files directly in it.", Response: []FileFolder{}})
+	g.Describe(MoveFileFolder, openapi.Operation{Tag: "files", Summary: "Move a folder with its subfolders", Request: MoveFileFolderRequest{}, Response: MoveFileFolderResponse{}})
+	g.Describe(DeleteProjectFile, openapi.Operation{Tag: "files", Summary: "Delete a file", Response: MessageResponse{}})
+	g.Describe(GetProjectFilesForRotation, openapi.Operation{Tag: "files", Summary: "List file encryption keys for rotation", Response: []FileFEK{}})
+	g.Describe(UpdateFileFEKs, openapi.Operation{Tag: "files", Summary: "Replace file encryption keys", Request: UpdateFileFEKsRequest{}, Response: UpdateFileFEKsResponse{}})
+
+	// Organizations
+	g.Describe(CreateOrganization, openapi.Operation{Tag: "organizations", Summary: "Create an organization", Request: CreateOrganizationRequest{}, Response: models.Organization{}, Status: http.StatusCreated})
+	g.Describe(GetOrganizations, openapi.Operation{Tag: "organizations", Summary: "List organizations", Response: []OrganizationListItem{}})
+	g.Describe(GetOrganization, openapi.Operation{Tag: "organizations", Summary: "Get an organization", Response: OrganizationDetailResponse{}})
+	g.Describe(UpdateOrganization, openapi.Operation{Tag: "organizations", Summary: "Update an organization", Request: UpdateOrganizationRequest{}, Response: MessageResponse{}})
+	g.Describe(GetOrganizationUsers, openapi.Operation{Tag: "organizations", Summary: "List organization members", Response: []OrganizationUser{}, Parameters: []openapi.Parameter{fields}})
+	g.Describe(AddOrganizationMember, openapi.Operation{Tag: "organizations", Summary: "Add an organization member", Request: AddOrganizationMemberRequest{}, Response: OrganizationMemberResponse{}, Status: http.StatusCreated})
+	g.Describe(UpdateOrganizationMember, openapi.Operation{Tag: "organizations", Summary: "Change a member's role", Request: UpdateOrganizationMemberRequest{}, Response: OrganizationMemberResponse{}, Parameters: []openapi.Parameter{twoFactor}})
+	g.Describe(RemoveOrganizationMember, openapi.Operation{Tag: "organizations", Summary: "Remove an organization member", Response: OrganizationMemberResponse{}})
+	g.Describe(OffboardOrganizationMember, openapi.Operation{Tag: "organizations", Summary: "Remove a member, sign them out everywhere and flag the projects they could decrypt", Response: OffboardingReport{}})
+	g.Describe(GetOrganizationAlerts, openapi.Operation{Tag: "organizations", Summary: "List usage alerts", Response: []models.OrganizationAlert{}})
+	g.Describe(CreateOrganizationAlert, openapi.Operation{Tag: "organizations", Summary: "Create a usage alert", Request: CreateOrganizationAlertRequest{}, Response: models.OrganizationAlert{}, Status: http.StatusCreated})
+	g.Describe(UpdateOrganizationAlert, openapi.Operation{Tag: "organizations", Summary: "Update a usage alert", Request: UpdateOrganizationAlertRequest{}, Response: models.OrganizationAlert{}})
+	g.Describe(DeleteOrganizationAlert, openapi.Operation{Tag: "organizations", Summary: "Delete a usage alert", Response: MessageResponse{}})
+	g.Describe(GetAccessLogs, openapi.Operation{Tag: "organizations", Summary: "List the access log", Response: AccessLogPage{}, Parameters: append([]openapi.Parameter{
+		openapi.QueryParam("projectId", "Only requests to this project", false),
+		openapi.QueryParam("userId", "Only requests by this user", false),
+	}, page...)})
+	g.Describe(GetAccessMatrix, openapi.Operation{Tag: "organizations", Summary: "Export who can open which project", Description: "Responds with text/csv: a row per member with user_id, email, name and organization_role, then a column per project listing the member's effective roles there, e.g. \"admin (organization); member (team Backend)\". Empty cells mean no access."})
+	g.Describe(GetOrganizationSSO, openapi.Operation{Tag: "organizations", Summary: "Get the organization's single sign-on provider", Response: OrganizationSSOResponse{}})
+	g.Describe(PutOrganizationSSO, openapi.Operation{Tag: "organizations", Summary: "Configure the organization's single sign-on provider", Request: PutOrganizationSSORequest{}, Response: OrganizationSSOResponse{}})
+	g.Describe(DeleteOrganizationSSO, openapi.Operation{Tag: "organizations", Summary: "Remove the organization's single sign-on provider", Response: MessageResponse{}})
+	g.Describe(StartSSOLink, openapi.Operation{Tag: "organizations", Summary: "Get a URL linking your account to the organization's single sign-on provider", Response: SSOLinkResponse{}})
+	g.Describe(GetIPAllowlist, openapi.Operation{Tag: "organizations", Summary: "Get the ranges members may use the API from", Response: IPAllowlist{}})
+	g.Describe(UpdateIPAllowlist, openapi.Operation{Tag: "organizations", Summary: "Set the ranges members may use the API from; must include your address", Request: IPAllowlist{}, Response: IPAllowlist{}})
+	g.Describe(GetAccessLogSettings, openapi.Operation{Tag: "organizations", Summary: "Get the access log level and retention", Response: AccessLogSettings{}})
+	g.Describe(UpdateAccessLogSettings, openapi.Operation{Tag: "organizations", Summary: "Set the access log level and retention", Request: AccessLogSettings{}, Response: AccessLogSettings{}})
+	g.Describe(GetReadAuditSettings, openapi.Operation{Tag: "organizations", Summary: "Get how long read events are kept", Response: ReadAuditSettings{}})
+	g.Describe(UpdateReadAuditSettings, openapi.Operation{Tag: "organizations", Summary: "Set how long read events are kept", Request: ReadAuditSettings{}, Response: ReadAuditSettings{}})
+	g.Describe(GetConfigTrashSettings, openapi.Operation{Tag: "organizations", Summary: "Get how long deleted config items can be restored", Response: ConfigTrashSettings{}})
+	g.Describe(UpdateConfigTrashSettings, openapi.Operation{Tag: "organizations", Summary: "Set how long deleted config items can be restored", Request: ConfigTrashSettings{}, Response: ConfigTrashSettings{}})
+	g.Describe(GetSessionPolicy, openapi.Operation{Tag: "organizations", Summary: "Get the maximum token lifetimes for members", Response: SessionPolicyResponse{}})
+	g.Describe(GetFilePolicy, openapi.Operation{Tag: "organizations", Summary: "Get the file size limit and storage quota", Response: FilePolicyResponse{}})
+	g.Describe(UpdateFilePolicy, openapi.Operation{Tag: "organizations", Summary: "Set the file size limit and storage quota", Description: "Files already stored are kept when the limits are lowered; only new uploads are refused.", Request: FilePolicy{}, Response: FilePolicyResponse{}})
+	g.Describe(ListLargestFiles, openapi.Operation{Tag: "organizations", Summary: "List the organization's largest files", Response: []LargestFile{}, Parameters: []openapi.Parameter{
+		openapi.QueryParam("limit", "Number of files, 1-100, default 20", false),
+	}})
+	g.Describe(GetOrganizationUsage, openapi.Operation{Tag: "organizations", Summary: "Get the organization's usage against its limits", Description: "Creating a project, adding a member, issuing a token or uploading a file past a limit fails with 402 and ENVIE_PLAN_LIMIT_REACHED. A null limit is unlimited.", Response: OrganizationUsage{}})
+	g.Describe(UpdateSessionPolicy, openapi.Operation{Tag: "organizations", Summary: "Shorten the token lifetimes for members", Description: "Members of several organizations get the shortest lifetimes. Sessions pick the policy up at their next refresh.", Request: SessionPolicy{}, Response: SessionPolicyResponse{}})
+
+	// Roles
+	g.Describe(GetRoles, openapi.Operation{Tag: "roles", Summary: "List the permissions, the built-in roles and the organization's custom roles", Response: RolesResponse{}})
+	g.Describe(CreateRole, openapi.Operation{Tag: "roles", Summary: "Create a custom role", Request: RoleRequest{}, Response: models.Role{}, Status: http.StatusCreated})
+	g.Describe(UpdateRole, openapi.Operation{Tag: "roles", Summary: "Update a custom role", Request: RoleRequest{}, Response: models.Role{}})
+	g.Describe(DeleteRole, openapi.Operation{Tag: "roles", Summary: "Delete a custom role", Response: MessageResponse{}})
+	g.Describe(AssignOrganizationMemberRole, openapi.Operation{Tag: "roles", Summary: "Assign an organization role to a member, or remove it", Request: AssignRoleRequest{}, Response: MessageResponse{}})
+	g.Describe(AssignTeamMemberRole, openapi.Operation{Tag: "roles", Summary: "Assign a team role to a team member, or remove it", Request: AssignRoleRequest{}, Response: MessageResponse{}})
+
+	// Break-glass recovery
+	g.Describe(GetRecoveryEscrow, openapi.Operation{Tag: "recovery", Summary: "Get the recovery escrow and its officers", Response: RecoveryEscrowResponse{}})
+	g.Describe(PutRecoveryEscrow, openapi.Operation{Tag: "recovery", Summary: "Escrow the organization key as Shamir shares for recovery officers", Request: PutRecoveryEscrowRequest{}, Response: models.RecoveryEscrow{}, Parameters: []openapi.Parameter{twoFactor}})
+	g.Describe(DeleteRecoveryEscrow, openapi.Operation{Tag: "recovery", Summary: "Delete the recovery escrow", Response: MessageResponse{}, Parameters: []openapi.Parameter{twoFactor}})
+	g.Describe(GetMyRecoveryShare, openapi.Operation{Tag: "recovery", Summary: "Get the current user's encrypted share", Response: models.RecoveryShare{}})
+	g.Describe(GetRecoveryRequests, openapi.Operation{Tag: "recovery", Summary: "List recovery requests", Response: []RecoveryRequestResponse{}})
+	g.Describe(CreateRecoveryRequest, openapi.Operation{Tag: "recovery", Summary: "Ask the recovery officers to release their shares", Request: CreateRecoveryRequestRequest{}, Response: models.RecoveryRequest{}, Status: http.StatusCreated})
+	g.Describe(ReleaseRecoveryShare, openapi.Operation{Tag: "recovery", Summary: "Release a share, encrypted to the requester", Request: ReleaseRecoveryShareRequest{}, Response: models.RecoveryRequest{}, Parameters: []openapi.Parameter{twoFactor}})
+	g.Describe(GetRecoveryShares, openapi.Operation{Tag: "recovery", Summary: "Collect the released shares of an approved request", Response: RecoverySharesResponse{}})
+	g.Describe(CompleteRecovery, openapi.Operation{Tag: "recovery", Summary: "Store the recovered organization key", Request: CompleteRecoveryRequest{}, Response: models.RecoveryRequest{}})
+	g.Describe(CancelRecoveryRequest, openapi.Operation{Tag: "recovery", Summary: "Cancel a recovery request", Response: MessageResponse{}})
+	g.Describe(GetAuditEvents, openapi.Operation{Tag: "organizations", Summary: "List the audit log of bulk actions, newest first", Response: AuditEventPage{}, Parameters: page})
+	g.Describe(ExportAuditEvents, openapi.Operation{Tag: "organizations", Summary: "Export the audit log for a time range", Description: "Streams every audit event recorded from `from` (inclusive) to `to` (exclusive), at most 366 days, oldest first and read events included. `format` is ndjson (the default, one event per line as the audit stream sends them), json (an array) or csv with the columns id, created_at, action, actor_id, token_id, project_id, client_ip, detail and count.", Parameters: []openapi.Parameter{
+		openapi.QueryParam("from", "Start of the range, a timestamp", true),
+		openapi.QueryParam("to", "End of the range, a timestamp", true),
+		openapi.QueryParam("format", "ndjson, json or csv", false),
+	}})
+	g.Describe(GetAuditStream, openapi.Operation{Tag: "organizations", Summary: "Get where the audit log is streamed and how delivery is going", Response: AuditStreamResponse{}})
+	g.Describe(PutAuditStream, openapi.Operation{Tag: "organizations", Summary: "Stream the audit log to an HTTPS endpoint, syslog server or S3 bucket", Description: "The signing secret is returned when the stream is created and when rotateSecret is set, and never again.", Request: AuditStreamRequest{}, Response: AuditStreamResponse{}})
+	g.Describe(DeleteAuditStream, openapi.Operation{Tag: "organizations", Summary: "Stop streaming the audit log", Response: MessageResponse{}})
+	g.Describe(GetReadEvents, openapi.Operation{Tag: "organizations", Summary: "List file downloads and CLI config reads, newest first", Response: AuditEventPage{}, Parameters: append([]openapi.Parameter{
+		openapi.QueryParam("projectId", "Only reads of this project", false),
+		openapi.QueryParam("actorId", "Only reads by this user or the tokens they created", false),
+		openapi.QueryParam("tokenId", "Only reads by this CLI token", false),
+		openapi.QueryParam("action", "file_downloaded or config_read", false),
+	}, page...)})
+	g.Describe(GetOrganizationActivity, openapi.Operation{Tag: "organizations", Summary: "List recent changes in the organization, newest first",
+		Description: "Projects created, members added, key rotations committed and tokens issued or rotated, from the audit log. Members see organization-wide changes and those of projects their teams can access.",
+		Response:    ActivityPage{},
+		Parameters: append([]openapi.Parameter{
+			openapi.QueryParam("since", "Only changes after this timestamp", false),
+			openapi.QueryParam("action", "Comma-separated actions to keep: project_created, member_added, key_rotation_committed, token_issued, token_rotated", false),
+		}, page...)})
+	g.Describe(GetRecoveryEvents, openapi.Operation{Tag: "recovery", Summary: "List the recovery audit trail, newest first", Response: RecoveryEventPage{}, Parameters: page})
+
+	// Teams
+	g.Describe(CreateTeam, openapi.Operation{Tag: "teams", Summary: "Create a team", Request: CreateTeamRequest{}, Response: models.Team{}, Status: http.StatusCreated})
+	g.Describe(GetTeams, openapi.Operation{Tag: "teams", Summary: "List teams of an organization", Parameters: []openapi.Parameter{openapi.QueryParam("organizationId", "Organization to list teams for", true)}})
+	g.Describe(GetMyTeams, openapi.Operation{Tag: "teams", Summary: "List the current user's teams with encrypted keys"})
+	g.Describe(UpdateMyTeamKey, openapi.Operation{Tag: "teams", Summary: "Replace the current user's encrypted team key", Request: UpdateMyTeamKeyRequest{}, Response: MessageResponse{}})
+	g.Describe(GetTeamMembers, openapi.Operation{Tag: "teams", Summary: "List team members"})
+	g.Describe(AddTeamMember, openapi.Operation{Tag: "teams", Summary: "Add a team member", Request: AddTeamMemberRequest{}, Response: MessageResponse{}, Status: http.StatusCreated})
+	g.Describe(GetKeyGrants, openapi.Operation{Tag: "teams", Summary: "List team members still waiting for their team key", Response: []KeyGrantResponse{}})
+	g.Describe(FulfillKeyGrants, openapi.Operation{Tag: "teams", Summary: "Store team keys encrypted for waiting members", Request: FulfillKeyGrantsRequest{}, Response: FulfillKeyGrantsResponse{}})
+	g.Describe(UpdateTeamMember, openapi.Operation{Tag: "teams", Summary: "Change a team member's role", Request: UpdateTeamMemberRequest{}, Response: MessageResponse{}})
+	g.Describe(RemoveTeamMember, openapi.Operation{Tag: "teams", Summary: "Remove a team member", Response: MessageResponse{}})
+
+	// CLI
+	cli := func(op openapi.Operation) openapi.Operation {
+		op.Tag = "cli"
+		op.Security = openapi.SecurityCLIIdentity
+		return op
+	}
+	g.Describe(VerifyCLIIdentity, cli(openapi.Operation{Summary: "Verify a CLI token identity", Response: CLIVerifyResponse{}}))
+	g.Describe(GetCLIProjectConfig, cli(openapi.Operation{Summary: "Get the encrypted project config", Response: CLIProjectConfigResponse{}}))
+	g.Describe(GetCLIConfigChecksum, cli(openapi.Operation{Summary: "Get the config checksum", Response: CLIConfigChecksumResponse{}}))
+	g.Describe(GetCLIConfigDiff, cli(openapi.Operation{Summary: "List the config items changed since a checksum or snapshot", Response: ConfigDiff{}, Parameters: diffStates}))
+	g.Describe(GetCLIProjectSchema, cli(openapi.Operation{Summary: "List the variables the project requires", Response: ProjectSchemaResponse{}}))
+	g.Describe(GetCLIProjectFiles, cli(openapi.Operation{Summary: "List project files with the encrypted project key", Response: CLIProjectFilesResponse{}}))
+	g.Describe(DownloadCLIProjectFile, cli(openapi.Operation{Summary: "Download an encrypted file", Response: FileDownloadResponse{}}))
+	g.Describe(UploadCLIProjectFile, cli(openapi.Operation{Summary: "Upload an encrypted file (multipart/form-data)", Description: "Needs a token with the files.write scope. The file is attributed to the token's creator.", Response: UploadFileResponse{}, Status: http.StatusCreated}))
+	g.Describe(GetCLIProjectStatus, cli(openapi.Operation{Summary: "Get the config checksum, key version and pending rotation", Response: CLIProjectStatusResponse{}}))
+	g.Describe(WaitCLIConfigChange, cli(openapi.Operation{Summary: "Wait for a config change", Response: CLIConfigWaitResponse{}, Parameters: []openapi.Parameter{
+		openapi.QueryParam("checksum", "Checksum the client has, returns as soon as the stored one differs", false),
+		openapi.QueryParam("timeout", "Seconds to wait, 30 by default and at most 60", false),
+	}}))
+	g.Describe(WriteCLICanary, cli(openapi.Operation{Summary: "Rewrite the smoke test canary value", Request: WriteCLICanaryRequest{}, Response: CLIConfigChecksumResponse{}}))
+	g.Describe(GetCLIDeploymentTargets, cli(openapi.Operation{Summary: "List deployment targets", Response: []CLIDeploymentTarget{}}))
+	g.Describe(CreateCLIDeploymentSync, cli(openapi.Operation{Summary: "Start a sync run", Response: models.DeploymentSync{}, Status: http.StatusCreated}))
+	g.Describe(ReportCLIDeploymentSync, cli(openapi.Operation{Summary: "Report the result of a sync run", Request: ReportDeploymentSyncRequest{}, Response: models.DeploymentSync{}}))
+
+	// Resource API
+	idempotent := []openapi.Parameter{{Name: "Idempotency-Key", In: "header", Description: "Replays the stored response when the same key is reused", Schema: openapi.Schema{Type: "string"}}}
+	g.Describe(CreateProjectResource, openapi.Operation{Tag: "resources", Summary: "Create a project", Request: CreateProjectRequest{}, Response: ProjectResource{}, Status: http.StatusCreated, Parameters: idempotent})
+	g.Describe(GetProjectResource, openapi.Operation{Tag: "resources", Summary: "Get a project", Response: ProjectResource{}})
+	g.Describe(PutProjectResource, openapi.Operation{Tag: "resources", Summary: "Update a project", Request: UpdateProjectRequest{}, Response: ProjectResource{}, Parameters: idempotent})
+	g.Describe(DeleteProjectResource, openapi.Operation{Tag: "resources", Summary: "Delete a project", Status: http.StatusNoContent, Parameters: idempotent})
+	g.Describe(GetConfigItemResources, openapi.Operation{Tag: "resources", Summary: "List config items", Response: []ConfigItemResource{}})
+	g.Describe(GetConfigItemResource, openapi.Operation{Tag: "resources", Summary: "Get a config item", Response: ConfigItemResource{}})
+	g.Describe(PutConfigItemResource, openapi.Operation{Tag: "resources", Summary: "Create or replace a config item", Request: PutConfigItemRequest{}, Response: ConfigItemResource{}, Parameters: idempotent})
+	g.Describe(DeleteConfigItemResource, openapi.Operation{Tag: "resources", Summary: "Delete a config item", Status: http.StatusNoContent, Parameters: idempotent})
+	g.Describe(CreateProjectTokenResource, openapi.Operation{Tag: "resources", Summary: "Create a project token", Request: CreateProjectTokenRequest{}, Response: ProjectTokenResource{}, Status: http.StatusCreated, Parameters: []openapi.Parameter{idempotent[0], twoFactor}})
+	g.Describe(GetProjectTokenResource, openapi.Operation{Tag: "resources", Summary: "Get a project token", Response: ProjectTokenResource{}})
+	g.Describe(PutProjectTokenResource, openapi.Operation{Tag: "resources", Summary: "Update a project token", Request: UpdateProjectTokenRequest{}, Response: ProjectTokenResource{}, Parameters: idempotent})
+	g.Describe(DeleteProjectTokenResource, openapi.Operation{Tag: "resources", Summary: "Revoke a project token", Status: http.StatusNoContent, Parameters: idempotent})
+	g.Describe(CreateTeamResource, openapi.Operation{Tag: "resources", Summary: "Create a team", Request: CreateTeamRequest{}, Response: TeamResource{}, Status: http.StatusCreated, Parameters: idempotent})
+	g.Describe(GetTeamResource, openapi.Operation{Tag: "resources", Summary: "Get a team", Response: TeamResource{}})
+	g.Describe(PutTeamResource, openapi.Operation{Tag: "resources", Summary: "Update a team", Request: UpdateTeamRequest{}, Response: TeamResource{}, Parameters: idempotent})
+	g.Describe(DeleteTeamResource, openapi.Operation{Tag: "resources", Summary: "Delete a team", Status: http.StatusNoContent, Parameters: idempotent})
+}
@@ -6,80 +6,100 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type CreateOrganizationRequest struct {
-	Name                        string `json:"name" binding:"required"`
-	EncryptedOrganizationKey    string `json:"encryptedOrganizationKey" binding:"required"`    // org master encrypted with user private key
-	GeneralTeamEncryptedKey     string `json:"generalTeamEncryptedKey" binding:"required"`     // encrypted first team key
-	GeneralTeamUserEncryptedKey string `json:"generalTeamUserEncryptedKey" binding:"required"` // encrypted first user to first team binding key
+	Name                        string `json:"name" binding:"required,max=255,name"`
+	EncryptedOrganizationKey    string `json:"encryptedOrganizationKey" binding:"required,ciphertext"`    // org master encrypted with user private key
+	GeneralTeamEncryptedKey     string `json:"generalTeamEncryptedKey" binding:"required,ciphertext"`     // encrypted first team key
+	GeneralTeamUserEncryptedKey string `json:"generalTeamUserEncryptedKey" binding:"required,ciphertext"` // encrypted first user to first team binding key
 }
 
-func CreateOrganization(c *gin.Context) {
-	uid, ok := GetAuthUserID(c)
-	if !ok {
-		return
-	}
+// OrganizationListItem - an organization with the current user's role
+type OrganizationListItem struct {
+	models.Organization
+	Role         string `json:"role"`
+	ProjectCount int64  `json:"projectCount"`
+	MemberCount  int64  `json:"memberCount"`
+}
 
-	var req CreateOrganizationRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		RespondBadRequest(c, err.Error())
-		return
-	}
+// OrganizationDetailResponse - an organization with the current user's role and wrapped key
+type OrganizationDetailResponse struct {
+	Organization             models.Organization `json:"organization"`
+	Role                     string              `json:"role"`
+	EncryptedOrganizationKey *string             `json:"encryptedOrganizationKey"`
+	StorageUsedBytes         int64               `json:"storageUsedBytes"` // against Organization.StorageQuotaBytes
+}
 
-	tx := database.DB.Begin()
+// OrganizationUser - an organization member with their role
+type OrganizationUser struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	AvatarURL string    `json:"avatarUrl"`
+	PublicKey *string   `json:"publicKey"`
+	CreatedAt string    `json:"createdAt"`
+	UpdatedAt string    `json:"updatedAt"`
+	Role      string    `json:"role"`
+}
 
-	org := models.Organization{
-		Name: req.Name,
-	}
+// OrganizationMemberResponse - result of adding, updating or removing a member
+type OrganizationMemberResponse struct {
+	Message string    `json:"message"`
+	UserID  uuid.UUID `json:"userId"`
+	Role    string    `json:"role,omitempty"`
+}
 
-	if err := tx.Create(&org).Error; err != nil {
-		tx.Rollback()
-		RespondInternalError(c, "Failed to create organization")
+func CreateOrganization(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
 		return
 	}
 
-	orgUser := models.OrganizationUser{
-		OrganizationID:           org.ID,
-		UserID:                   uid,
-		Role:                     "owner",
-		EncryptedOrganizationKey: &req.EncryptedOrganizationKey,
-	}
-
-	if err := tx.Create(&orgUser).Error; err != nil {
-		tx.Rollback()
-		RespondInternalError(c, "Failed to add user to organization")
+	var req CreateOrganizationRequest
+	if !BindJSON(c, &req) {
 		return
 	}
 
-	generalTeam := models.Team{
-		OrganizationID: org.ID,
-		Name:           "General",
-		EncryptedKey:   req.GeneralTeamEncryptedKey,
-	}
-
-	if err := tx.Create(&generalTeam).Error; err != nil {
-		tx.Rollback()
-		RespondInternalError(c, "Failed to create general team")
-		return
-	}
+	var org models.Organization
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		org = models.Organization{
+			Name: req.Name,
+		}
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
 
-	teamUser := models.TeamUser{
-		TeamID:           generalTeam.ID,
-		UserID:           uid,
-		Role:             "owner",
-		EncryptedTeamKey: req.GeneralTeamUserEncryptedKey,
-	}
+		orgUser := models.OrganizationUser{
+			OrganizationID:           org.ID,
+			UserID:                   uid,
+			Role:                     "owner",
+			EncryptedOrganizationKey: &req.EncryptedOrganizationKey,
+		}
+		if err := tx.Create(&orgUser).Error; err != nil {
+			return err
+		}
 
-	if err := tx.Create(&teamUser).Error; err != nil {
-		tx.Rollback()
-		RespondInternalError(c, "Failed to add user to general team")
-		return
-	}
+		generalTeam := models.Team{
+			OrganizationID: org.ID,
+			Name:           "General",
+			EncryptedKey:   req.GeneralTeamEncryptedKey,
+		}
+		if err := tx.Create(&generalTeam).Error; err != nil {
+			return err
+		}
 
-	if err := tx.Commit().Error; err != nil {
-		tx.Rollback()
-		RespondInternalError(c, "Failed to commit transaction")
+		teamUser := models.TeamUser{
+			TeamID:           generalTeam.ID,
+			UserID:           uid,
+			Role:             "owner",
+			EncryptedTeamKey: req.GeneralTeamUserEncryptedKey,
+		}
+		return tx.Create(&teamUser).Error
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to create organization")
 		return
 	}
 
@@ -92,15 +112,8 @@ func GetOrganizations(c *gin.Context) {
 		return
 	}
 
-	type OrganizationResponse struct {
-		models.Organization
-		Role         string `json:"role"`
-		ProjectCount int64  `json:"projectCount"`
-		MemberCount  int64  `json:"memberCount"`
-	}
-
-	var response []OrganizationResponse
-	if err := database.DB.Raw(`
+	var response []OrganizationListItem
+	if err := requestDB(c).Raw(`
 		SELECT
 			organizations.*, organization_users.role as role,
 			COUNT(DISTINCT(projects.id)) as project_count,
@@ -135,7 +148,7 @@ func GetOrganization(c *gin.Context) {
 		EncryptedOrganizationKey *string
 	}
 	var result OrgWithUserInfo
-	err := database.DB.Model(&models.Organization{}).
+	err := requestDB(c).Model(&models.Organization{}).
 		Select("organizations.*, organization_users.role, organization_users.encrypted_organization_key").
 		Joins("JOIN organization_users ON organization_users.organization_id = organizations.id").
 		Where("organizations.id = ? AND organization_users.user_id = ?", orgID, uid).
@@ -146,15 +159,22 @@ func GetOrganization(c *gin.Context) {
 		return
 	}
 
-	RespondOK(c, gin.H{
-		"organization":             result.Organization,
-		"role":                     result.Role,
-		"encryptedOrganizationKey": result.EncryptedOrganizationKey,
+	used, err := orgStorageUsage(requestDB(c), orgID)
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch storage usage")
+		return
+	}
+
+	RespondOK(c, OrganizationDetailResponse{
+		Organization:             result.Organization,
+		Role:                     result.Role,
+		EncryptedOrganizationKey: result.EncryptedOrganizationKey,
+		StorageUsedBytes:         used,
 	})
 }
 
 type UpdateOrganizationRequest struct {
-	Name string `json:"name" binding:"required"`
+	Name string `json:"name" binding:"required,max=255,name"`
 }
 
 func UpdateOrganization(c *gin.Context) {
@@ -169,8 +189,7 @@ func UpdateOrganization(c *gin.Context) {
 	}
 
 	var req UpdateOrganizationRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		RespondBadRequest(c, err.Error())
+	if !BindJSON(c, &req) {
 		return
 	}
 
@@ -179,7 +198,7 @@ func UpdateOrganization(c *gin.Context) {
 		return
 	}
 
-	if err := database.DB.Model(&models.Organization{}).Where("id = ?", orgID).Update("name", req.Name).Error; err != nil {
+	if err := requestDB(c).Model(&models.Organization{}).Where("id = ?", orgID).Update("name", req.Name).Error; err != nil {
 		RespondInternalError(c, "Failed to update organization")
 		return
 	}
@@ -203,20 +222,14 @@ func GetOrganizationUsers(c *gin.Context) {
 		return
 	}
 
+	fields, ok := RequestedFields(c, OrganizationUser{})
+	if !ok {
+		return
+	}
+
 	// Single query to get users with their roles
-	type UserWithRole struct {
-		ID        uuid.UUID `json:"id"`
-		Name      string    `json:"name"`
-		Email     string    `json:"email"`
-		AvatarURL string    `json:"avatarUrl"`
-		PublicKey *string   `json:"publicKey"`
-		CreatedAt string    `json:"createdAt"`
-		UpdatedAt string    `json:"updatedAt"`
-		Role      string    `json:"role"`
-	}
-
-	var users []UserWithRole
-	if err := database.DB.Model(&models.User{}).
+	var users []OrganizationUser
+	if err := requestDB(c).Model(&models.User{}).
 		Select("users.id, users.name, users.email, users.avatar_url, users.public_key, users.created_at, users.updated_at, organization_users.role").
 		Joins("JOIN organization_users ON organization_users.user_id = users.id").
 		Where("organization_users.organization_id = ?", orgID).
@@ -225,13 +238,13 @@ func GetOrganizationUsers(c *gin.Context) {
 		return
 	}
 
-	RespondOK(c, users)
+	RespondFields(c, fields, users)
 }
 
 type AddOrganizationMemberRequest struct {
 	UserID                   uuid.UUID `json:"userId" binding:"required"`
 	Role                     string    `json:"role"`
-	EncryptedOrganizationKey *string   `json:"encryptedOrganizationKey"`
+	EncryptedOrganizationKey *string   `json:"encryptedOrganizationKey" binding:"omitempty,ciphertext"`
 }
 
 func AddOrganizationMember(c *gin.Context) {
@@ -246,8 +259,7 @@ func AddOrganizationMember(c *gin.Context) {
 	}
 
 	var req AddOrganizationMemberRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		RespondBadRequest(c, err.Error())
+	if !BindJSON(c, &req) {
 		return
 	}
 
@@ -272,7 +284,7 @@ func AddOrganizationMember(c *gin.Context) {
 
 	// Verify target user exists and has public key
 	var targetUser models.User
-	if err := database.DB.First(&targetUser, "id = ?", req.UserID).Error; err != nil {
+	if err := requestDB(c).First(&targetUser, "id = ?", req.UserID).Error; err != nil {
 		RespondNotFound(c, "Target user not found")
 		return
 	}
@@ -283,7 +295,7 @@ func AddOrganizationMember(c *gin.Context) {
 	}
 
 	var existingMembership models.OrganizationUser
-	if err := database.DB.Where("organization_id = ? AND user_id = ?", orgID, req.UserID).First(&existingMembership).Error; err == nil {
+	if err := requestDB(c).Where("organization_id = ? AND user_id = ?", orgID, req.UserID).First(&existingMembership).Error; err == nil {
 		RespondConflict(c, "User is already a member of this organization")
 		return
 	}
@@ -293,6 +305,11 @@ func AddOrganizationMember(c *gin.Context) {
 		return
 	}
 
+	if err := checkMemberLimit(requestDB(c), orgID); err != nil {
+		RespondAPIError(c, err, "Failed to check the member limit")
+		return
+	}
+
 	orgUser := models.OrganizationUser{
 		OrganizationID:           orgID,
 		UserID:                   req.UserID,
@@ -300,15 +317,21 @@ func AddOrganizationMember(c *gin.Context) {
 		EncryptedOrganizationKey: req.EncryptedOrganizationKey,
 	}
 
-	if err := database.DB.Create(&orgUser).Error; err != nil {
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Create(&orgUser).Error; err != nil {
+			return err
+		}
+		return recordAuditEvent(tx, orgID, nil, requesterUID, models.AuditMemberAdded, targetUser.Email+" as "+req.Role, 1)
+	})
+	if err != nil {
 		RespondInternalError(c, "Failed to add member to organization")
 		return
 	}
 
-	RespondCreated(c, gin.H{
-		"message": "Member added successfully",
-		"userId":  req.UserID,
-		"role":    req.Role,
+	RespondCreated(c, OrganizationMemberResponse{
+		Message: "Member added successfully",
+		UserID:  req.UserID,
+		Role:    req.Role,
 	})
 }
 
@@ -334,8 +357,7 @@ func UpdateOrganizationMember(c *gin.Context) {
 	}
 
 	var req UpdateOrganizationMemberRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		RespondBadRequest(c, err.Error())
+	if !BindJSON(c, &req) {
 		return
 	}
 
@@ -350,7 +372,7 @@ func UpdateOrganizationMember(c *gin.Context) {
 	}
 
 	var targetOrgUser models.OrganizationUser
-	if err := database.DB.Where("organization_id = ? AND user_id = ?", orgID, targetUserID).First(&targetOrgUser).Error; err != nil {
+	if err := requestDB(c).Where("organization_id = ? AND user_id = ?", orgID, targetUserID).First(&targetOrgUser).Error; err != nil {
 		RespondNotFound(c, "Member not found")
 		return
 	}
@@ -362,7 +384,7 @@ func UpdateOrganizationMember(c *gin.Context) {
 
 	if requesterUID == targetUserID && IsOwner(targetOrgUser.Role) && req.Role != "owner" {
 		var ownerCount int64
-		database.DB.Model(&models.OrganizationUser{}).Where("organization_id = ? AND role = ?", orgID, "owner").Count(&ownerCount)
+		requestDB(c).Model(&models.OrganizationUser{}).Where("organization_id = ? AND role = ?", orgID, "owner").Count(&ownerCount)
 		if ownerCount <= 1 {
 			RespondBadRequest(c, "Cannot demote the last owner")
 			return
@@ -376,6 +398,11 @@ func UpdateOrganizationMember(c *gin.Context) {
 		}
 	}
 
+	elevated := (req.Role == "owner" && !IsOwner(targetOrgUser.Role)) || (req.Role == "admin" && targetOrgUser.Role == "member")
+	if elevated && !RequireTwoFactor(c, requesterUID, TwoFactorActionElevateOrgRole) {
+		return
+	}
+
 	updates := map[string]any{"role": req.Role}
 	if req.Role == "member" {
 		updates["encrypted_organization_key"] = nil
@@ -383,15 +410,15 @@ func UpdateOrganizationMember(c *gin.Context) {
 		updates["encrypted_organization_key"] = *req.EncryptedOrganizationKey
 	}
 
-	if err := database.DB.Model(&targetOrgUser).Updates(updates).Error; err != nil {
+	if err := requestDB(c).Model(&targetOrgUser).Updates(updates).Error; err != nil {
 		RespondInternalError(c, "Failed to update member")
 		return
 	}
 
-	RespondOK(c, gin.H{
-		"message": "Member updated successfully",
-		"userId":  targetUserID,
-		"role":    req.Role,
+	RespondOK(c, OrganizationMemberResponse{
+		Message: "Member updated successfully",
+		UserID:  targetUserID,
+		Role:    req.Role,
 	})
 }
 
@@ -411,52 +438,56 @@ func RemoveOrganizationMember(c *gin.Context) {
 		return
 	}
 
-	requesterOrgUser, ok := RequireOrgAdmin(c, requesterUID, orgID)
+	targetOrgUser, ok := requireRemovableMember(c, requesterUID, orgID, targetUserID)
 	if !ok {
 		return
 	}
 
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND team_id IN (SELECT id FROM teams WHERE organization_id = ?)", targetUserID, orgID).Delete(&models.TeamUser{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(targetOrgUser).Error
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to remove member")
+		return
+	}
+
+	RespondOK(c, OrganizationMemberResponse{
+		Message: "Member removed successfully",
+		UserID:  targetUserID,
+	})
+}
+
+// requireRemovableMember checks that the requester may remove the target from the
+// organization and returns the target's membership. If not, it sends the error
+// response automatically.
+func requireRemovableMember(c *gin.Context, requesterUID, orgID, targetUserID uuid.UUID) (*models.OrganizationUser, bool) {
+	requesterOrgUser, ok := RequireOrgAdmin(c, requesterUID, orgID)
+	if !ok {
+		return nil, false
+	}
+
 	var targetOrgUser models.OrganizationUser
-	if err := database.DB.Where("organization_id = ? AND user_id = ?", orgID, targetUserID).First(&targetOrgUser).Error; err != nil {
+	if err := requestDB(c).Where("organization_id = ? AND user_id = ?", orgID, targetUserID).First(&targetOrgUser).Error; err != nil {
 		RespondNotFound(c, "Member not found")
-		return
+		return nil, false
 	}
 
 	if IsOwner(targetOrgUser.Role) && !IsOwner(requesterOrgUser.Role) {
 		RespondForbidden(c, "Only organization owners can remove other owners")
-		return
+		return nil, false
 	}
 
 	if requesterUID == targetUserID && IsOwner(targetOrgUser.Role) {
 		var ownerCount int64
-		database.DB.Model(&models.OrganizationUser{}).Where("organization_id = ? AND role = ?", orgID, "owner").Count(&ownerCount)
+		requestDB(c).Model(&models.OrganizationUser{}).Where("organization_id = ? AND role = ?", orgID, "owner").Count(&ownerCount)
 		if ownerCount <= 1 {
 			RespondBadRequest(c, "Cannot remove the last owner")
-			return
+			return nil, false
 		}
 	}
 
-	tx := database.DB.Begin()
-
-	if err := tx.Where("user_id = ? AND team_id IN (SELECT id FROM teams WHERE organization_id = ?)", targetUserID, orgID).Delete(&models.TeamUser{}).Error; err != nil {
-		tx.Rollback()
-		RespondInternalError(c, "Failed to remove member from teams")
-		return
-	}
-
-	if err := tx.Delete(&targetOrgUser).Error; err != nil {
-		tx.Rollback()
-		RespondInternalError(c, "Failed to remove member")
-		return
-	}
-
-	if err := tx.Commit().Error; err != nil {
-		RespondInternalError(c, "Failed to commit transaction")
-		return
-	}
-
-	RespondOK(c, gin.H{
-		"message": "Member removed successfully",
-		"userId":  targetUserID,
-	})
+	return &targetOrgUser, true
 }
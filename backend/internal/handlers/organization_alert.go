@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"net/url"
+
+	"envie-backend/internal/alerts"
+	"envie-backend/internal/models"
+	"envie-backend/internal/settings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const maxAlertsPerOrganization = 50
+
+type CreateOrganizationAlertRequest struct {
+	Metric    string `json:"metric" binding:"required"`
+	Threshold int64  `json:"threshold" binding:"min=1"`
+	Channel   string `json:"channel" binding:"required"`
+	Target    string `json:"target" binding:"required"`
+	Enabled   *bool  `json:"enabled"`
+}
+
+type UpdateOrganizationAlertRequest struct {
+	Threshold *int64  `json:"threshold" binding:"omitempty,min=1"`
+	Channel   *string `json:"channel"`
+	Target    *string `json:"target"`
+	Enabled   *bool   `json:"enabled"`
+}
+
+// validateAlertTarget is alerts.ValidateTarget plus the egress rules that don't
+// need DNS, so a webhook the server may not reach is refused when configured
+// rather than when it fires
+func validateAlertTarget(channel, target string) error {
+	if err := alerts.ValidateTarget(channel, target); err != nil {
+		return err
+	}
+	if channel != models.AlertChannelWebhook {
+		return nil
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	return settings.EgressPolicy().CheckHost(u.Hostname())
+}
+
+func requireOrganizationAlert(c *gin.Context, orgID uuid.UUID) (*models.OrganizationAlert, bool) {
+	alertID, ok := ParseUUIDParam(c, "alertId", "alert")
+	if !ok {
+		return nil, false
+	}
+
+	var alert models.OrganizationAlert
+	if err := requestDB(c).Where("id = ? AND organization_id = ?", alertID, orgID).First(&alert).Error; err != nil {
+		RespondNotFound(c, "Alert not found")
+		return nil, false
+	}
+	return &alert, true
+}
+
+func GetOrganizationAlerts(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	var list []models.OrganizationAlert
+	if err := requestDB(c).Where("organization_id = ?", orgID).Order("created_at asc").Find(&list).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch alerts")
+		return
+	}
+
+	RespondOK(c, list)
+}
+
+func CreateOrganizationAlert(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	var req CreateOrganizationAlertRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	if !alerts.Metrics[req.Metric] {
+		RespondBadRequest(c, "Invalid metric. Must be token_count, storage_bytes, member_count, failed_auth, or token_anomalies")
+		return
+	}
+	if err := validateAlertTarget(req.Channel, req.Target); err != nil {
+		RespondBadRequest(c, "Invalid alert: "+err.Error())
+		return
+	}
+
+	var count int64
+	if err := requestDB(c).Model(&models.OrganizationAlert{}).Where("organization_id = ?", orgID).Count(&count).Error; err != nil {
+		RespondInternalError(c, "Failed to create alert")
+		return
+	}
+	if count >= maxAlertsPerOrganization {
+		RespondConflict(c, "Organization already has the maximum number of alerts")
+		return
+	}
+
+	alert := models.OrganizationAlert{
+		OrganizationID: orgID,
+		Metric:         req.Metric,
+		Threshold:      req.Threshold,
+		Channel:        req.Channel,
+		Target:         req.Target,
+		Enabled:        req.Enabled == nil || *req.Enabled,
+		CreatedByID:    uid,
+	}
+	if err := requestDB(c).Create(&alert).Error; err != nil {
+		RespondInternalError(c, "Failed to create alert")
+		return
+	}
+
+	RespondCreated(c, alert)
+}
+
+func UpdateOrganizationAlert(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	var req UpdateOrganizationAlertRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	alert, ok := requireOrganizationAlert(c, orgID)
+	if !ok {
+		return
+	}
+
+	updates := map[string]any{}
+	if req.Threshold != nil && *req.Threshold != alert.Threshold {
+		alert.Threshold = *req.Threshold
+		updates["threshold"] = alert.Threshold
+		// A new threshold is evaluated afresh, notifying if it's already exceeded
+		alert.Triggered = false
+		updates["triggered"] = false
+	}
+	if req.Channel != nil {
+		alert.Channel = *req.Channel
+		updates["channel"] = alert.Channel
+	}
+	if req.Target != nil {
+		alert.Target = *req.Target
+		updates["target"] = alert.Target
+	}
+	if req.Channel != nil || req.Target != nil {
+		if err := validateAlertTarget(alert.Channel, alert.Target); err != nil {
+			RespondBadRequest(c, "Invalid alert: "+err.Error())
+			return
+		}
+		alert.LastNotifyError = nil
+		updates["last_notify_error"] = nil
+	}
+	if req.Enabled != nil {
+		alert.Enabled = *req.Enabled
+		updates["enabled"] = alert.Enabled
+	}
+
+	if len(updates) > 0 {
+		if err := requestDB(c).Model(alert).Updates(updates).Error; err != nil {
+			RespondInternalError(c, "Failed to update alert")
+			return
+		}
+	}
+
+	RespondOK(c, alert)
+}
+
+func DeleteOrganizationAlert(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	alert, ok := requireOrganizationAlert(c, orgID)
+	if !ok {
+		return
+	}
+
+	if err := requestDB(c).Delete(alert).Error; err != nil {
+		RespondInternalError(c, "Failed to delete alert")
+		return
+	}
+
+	RespondMessage(c, "Alert deleted")
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// pageCursor is the position after the last row of a page. Lists are ordered
+// newest first by created_at, then id, so the pair is unique and stable.
+type pageCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"i"`
+}
+
+// PageRequest is the page a client asked for with the limit and cursor query
+// parameters. Cursors are opaque: clients pass back the nextCursor of the
+// previous page.
+type PageRequest struct {
+	Limit int
+	after *pageCursor
+}
+
+// RequestedPage parses the limit and cursor query parameters. limit defaults to
+// 50 and is capped at 200. If a parameter is invalid, it sends a 400 response
+// automatically.
+func RequestedPage(c *gin.Context) (PageRequest, bool) {
+	page := PageRequest{Limit: defaultPageSize}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			RespondBadRequest(c, "limit must be a positive number")
+			return page, false
+		}
+		page.Limit = min(limit, maxPageSize)
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		after, err := decodeCursor(value)
+		if err != nil {
+			RespondBadRequest(c, "Invalid cursor")
+			return page, false
+		}
+		page.after = after
+	}
+	return page, true
+}
+
+// Apply orders query newest first and restricts it to the requested page. It
+// fetches one row more than the limit, which tells Next there is another page.
+func (p PageRequest) Apply(query *gorm.DB, table string) *gorm.DB {
+	if p.after != nil {
+		query = query.Where("("+table+".created_at, "+table+".id) < (?, ?)", p.after.CreatedAt, p.after.ID)
+	}
+	return query.Order(table + ".created_at DESC").Order(table + ".id DESC").Limit(p.Limit + 1)
+}
+
+// pageItems trims the rows fetched by PageRequest.Apply to the page and returns
+// the cursor of the next page, "" on the last one. key returns the created_at
+// and id of a row.
+func pageItems[T any](p PageRequest, rows []T, key func(*T) (time.Time, uuid.UUID)) ([]T, string) {
+	if rows == nil {
+		rows = []T{}
+	}
+	if len(rows) <= p.Limit {
+		return rows, ""
+	}
+
+	rows = rows[:p.Limit]
+	createdAt, id := key(&rows[len(rows)-1])
+	return rows, encodeCursor(pageCursor{CreatedAt: createdAt, ID: id})
+}
+
+func encodeCursor(cursor pageCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"envie-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestRequestedPage(t *testing.T) {
+	tests := []struct {
+		query  string
+		limit  int
+		status int
+	}{
+		{"", defaultPageSize, http.StatusOK},
+		{"?limit=10", 10, http.StatusOK},
+		{"?limit=5000", maxPageSize, http.StatusOK},
+		{"?limit=0", 0, http.StatusBadRequest},
+		{"?cursor=not-a-cursor", 0, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		c, w := fieldsContext(tt.query)
+		page, ok := RequestedPage(c)
+		if ok != (tt.status == http.StatusOK) || w.Code != tt.status {
+			t.Errorf("%q: ok = %v, status %d", tt.query, ok, w.Code)
+		} else if ok && page.Limit != tt.limit {
+			t.Errorf("%q: limit = %d, want %d", tt.query, page.Limit, tt.limit)
+		}
+	}
+}
+
+func TestPageItems(t *testing.T) {
+	start := time.Date(2026, 10, 16, 12, 0, 0, 123456000, time.UTC)
+	events := make([]models.TwoFactorEvent, 3)
+	for i := range events {
+		events[i] = models.TwoFactorEvent{ID: uuid.New(), CreatedAt: start.Add(-time.Duration(i) * time.Minute)}
+	}
+	key := func(e *models.TwoFactorEvent) (time.Time, uuid.UUID) { return e.CreatedAt, e.ID }
+
+	items, next := pageItems(PageRequest{Limit: 2}, events, key)
+	if len(items) != 2 || next == "" {
+		t.Fatalf("got %d items, cursor %q", len(items), next)
+	}
+
+	c, _ := fieldsContext("?cursor=" + next)
+	page, ok := RequestedPage(c)
+	if !ok || !page.after.CreatedAt.Equal(events[1].CreatedAt) || page.after.ID != events[1].ID {
+		t.Errorf("cursor decodes to %+v, want the last item of the page", page.after)
+	}
+
+	items, next = pageItems(PageRequest{Limit: 3}, events, key)
+	if len(items) != 3 || next != "" {
+		t.Errorf("last page: %d items, cursor %q", len(items), next)
+	}
+	if items, _ := pageItems[models.TwoFactorEvent](PageRequest{Limit: 3}, nil, key); items == nil {
+		t.Error("empty page encodes as null")
+	}
+}
+
+func TestPageRequestApply(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page := PageRequest{Limit: 20, after: &pageCursor{CreatedAt: time.Now(), ID: uuid.New()}}
+	var events []models.TwoFactorEvent
+	sql := page.Apply(db.Where("user_id = ?", uuid.New()), "two_factor_events").Find(&events).Statement.SQL.String()
+
+	for _, want := range []string{
+		"(two_factor_events.created_at, two_factor_events.id) < ($2, $3)",
+		"ORDER BY two_factor_events.created_at DESC,two_factor_events.id DESC",
+		"LIMIT $4",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("query %q lacks %q", sql, want)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"envie-backend/internal/apierror"
+	"envie-backend/internal/auth"
+	"envie-backend/internal/middleware"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type StartPairingRequest struct {
+	DeviceName string `json:"deviceName" binding:"required,max=255,name"`
+
+	// Optional, proven like with POST /auth/exchange
+	DevicePublicKey   string `json:"devicePublicKey"`
+	ChallengeToken    string `json:"challengeToken"`
+	ChallengeResponse string `json:"challengeResponse"`
+}
+
+// PairingStarted - what the new device shows and keeps. QRPayload (with the
+// approval code) goes into the QR code; PollSecret never leaves the device.
+type PairingStarted struct {
+	ID         uuid.UUID `json:"id"`
+	Code       string    `json:"code"`
+	QRPayload  string    `json:"qrPayload"`
+	PollSecret string    `json:"pollSecret"`
+	Interval   int       `json:"interval"` // seconds between polls
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+type PairingTokenRequest struct {
+	PollSecret string `json:"pollSecret" binding:"required"`
+}
+
+type PairingDecisionRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// StartPairing registers a device waiting to be approved by a signed-in user
+func StartPairing(c *gin.Context) {
+	var req StartPairingRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	now := time.Now()
+	if req.DevicePublicKey != "" {
+		if err := auth.VerifyDeviceChallenge(req.ChallengeToken, req.DevicePublicKey, req.ChallengeResponse, now); err != nil {
+			c.JSON(http.StatusUnauthorized, apierror.H(apierror.CodeDeviceChallengeRequired,
+				"The device key is not proven: answer a challenge from POST /auth/device-challenge",
+				gin.H{"deviceChallengeRequired": true}))
+			return
+		}
+	}
+
+	code, codeHash, err := auth.GeneratePairingSecret()
+	if err != nil {
+		RespondInternalError(c, "Failed to start pairing")
+		return
+	}
+	pollSecret, pollSecretHash, err := auth.GeneratePairingSecret()
+	if err != nil {
+		RespondInternalError(c, "Failed to start pairing")
+		return
+	}
+
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	pairing := models.DevicePairing{
+		CodeHash:        codeHash,
+		PollSecretHash:  pollSecretHash,
+		Status:          models.PairingPending,
+		DeviceName:      req.DeviceName,
+		DevicePublicKey: req.DevicePublicKey,
+		ClientIP:        middleware.ClientIP(c),
+		UserAgent:       userAgent,
+		ExpiresAt:       now.Add(auth.PairingDuration),
+	}
+
+	// Clean pairings nobody finished
+	requestDB(c).Where("expires_at < ?", now.Add(-time.Hour)).Delete(&models.DevicePairing{})
+
+	if err := requestDB(c).Create(&pairing).Error; err != nil {
+		RespondInternalError(c, "Failed to start pairing")
+		return
+	}
+
+	c.JSON(http.StatusCreated, PairingStarted{
+		ID:         pairing.ID,
+		Code:       code,
+		QRPayload:  fmt.Sprintf("%s?id=%s&code=%s", auth.PairingQRScheme, pairing.ID, code),
+		PollSecret: pollSecret,
+		Interval:   int(auth.PairingPollInterval.Seconds()),
+		ExpiresAt:  pairing.ExpiresAt,
+	})
+}
+
+// PairingToken is polled by the new device. Once the pairing is approved it
+// responds, once, with the tokens of a new session like POST /auth/exchange.
+func PairingToken(c *gin.Context) {
+	pairingID, ok := ParseUUIDParam(c, "id", "pairing")
+	if !ok {
+		return
+	}
+
+	var req PairingTokenRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	var pairing models.DevicePairing
+	err := requestDB(c).First(&pairing, "id = ?", pairingID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		RespondInternalError(c, "Failed to fetch pairing")
+		return
+	}
+	if err != nil || !auth.PairingSecretMatches(pairing.PollSecretHash, req.PollSecret) {
+		RespondNotFound(c, "Pairing not found")
+		return
+	}
+
+	now := time.Now()
+	switch {
+	case pairing.Status == models.PairingDenied:
+		c.JSON(http.StatusForbidden, apierror.H(apierror.CodeForbidden, "The pairing was denied", gin.H{"status": pairing.Status}))
+		return
+	case pairing.Status == models.PairingCompleted:
+		RespondError(c, http.StatusGone, "The pairing was already completed")
+		return
+	case !now.Before(pairing.ExpiresAt):
+		RespondError(c, http.StatusGone, "The pairing expired, start a new one")
+		return
+	case pairing.Status == models.PairingPending:
+		c.JSON(http.StatusAccepted, gin.H{"status": pairing.Status, "interval": int(auth.PairingPollInterval.Seconds())})
+		return
+	}
+
+	// Conditional, so two polls at once start one session
+	claimed := requestDB(c).Model(&pairing).Where("status = ?", models.PairingApproved).Update("status", models.PairingCompleted)
+	if claimed.Error != nil {
+		RespondInternalError(c, "Failed to complete pairing")
+		return
+	}
+	if claimed.RowsAffected != 1 || pairing.UserID == nil {
+		RespondError(c, http.StatusGone, "The pairing was already completed")
+		return
+	}
+
+	log.Printf("Completed pairing %s for user %s", pairing.ID, *pairing.UserID)
+	completeSignIn(c, *pairing.UserID, pairing.SSOOrganizationID, pairing.DevicePublicKey)
+}
+
+// loadPairing returns the pending pairing a QR code points at. If there is none,
+// it sends the error response automatically.
+func loadPairing(c *gin.Context, code string) (*models.DevicePairing, bool) {
+	pairingID, ok := ParseUUIDParam(c, "id", "pairing")
+	if !ok {
+		return nil, false
+	}
+
+	var pairing models.DevicePairing
+	if err := requestDB(c).First(&pairing, "id = ?", pairingID).Error; err != nil || !auth.PairingSecretMatches(pairing.CodeHash, code) {
+		RespondNotFound(c, "Pairing not found")
+		return nil, false
+	}
+	if pairing.Status != models.PairingPending {
+		RespondConflict(c, "The pairing was already "+pairing.Status)
+		return nil, false
+	}
+	if !time.Now().Before(pairing.ExpiresAt) {
+		RespondError(c, http.StatusGone, "The pairing expired")
+		return nil, false
+	}
+	return &pairing, true
+}
+
+// GetPairing shows the device waiting for approval, so the user can check it
+// is theirs
+func GetPairing(c *gin.Context) {
+	if _, ok := GetAuthUserID(c); !ok {
+		return
+	}
+
+	pairing, ok := loadPairing(c, c.Query("code"))
+	if !ok {
+		return
+	}
+
+	RespondOK(c, pairing)
+}
+
+// ApprovePairing signs the waiting device in as the caller. The new session
+// shares the single sign-on of the approving one.
+func ApprovePairing(c *gin.Context) {
+	decidePairing(c, models.PairingApproved)
+}
+
+// DenyPairing refuses the waiting device
+func DenyPairing(c *gin.Context) {
+	decidePairing(c, models.PairingDenied)
+}
+
+func decidePairing(c *gin.Context, status string) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	var req PairingDecisionRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	if status == models.PairingApproved && !RequireTwoFactor(c, uid, TwoFactorActionApprovePairing) {
+		return
+	}
+
+	pairing, ok := loadPairing(c, req.Code)
+	if !ok {
+		return
+	}
+
+	var ssoOrgID *uuid.UUID
+	if status == models.PairingApproved {
+		var session models.RefreshToken
+		err := requestDB(c).Select("sso_organization_id").Where("family_id = ? AND user_id = ?", currentSessionID(c), uid).
+			Limit(1).Find(&session).Error
+		if err != nil {
+			RespondInternalError(c, "Failed to fetch the session")
+			return
+		}
+		ssoOrgID = session.SSOOrganizationID
+	}
+
+	now := time.Now()
+	decided := requestDB(c).Model(pairing).Where("status = ?", models.PairingPending).Updates(map[string]any{
+		"status":              status,
+		"user_id":             uid,
+		"sso_organization_id": ssoOrgID,
+		"decided_at":          now,
+	})
+	if decided.Error != nil {
+		RespondInternalError(c, "Failed to update pairing")
+		return
+	}
+	if decided.RowsAffected != 1 {
+		RespondConflict(c, "The pairing was already decided")
+		return
+	}
+
+	pairing.Status, pairing.UserID, pairing.SSOOrganizationID, pairing.DecidedAt = status, &uid, ssoOrgID, &now
+	RespondOK(c, pairing)
+}
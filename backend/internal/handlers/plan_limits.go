@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"envie-backend/internal/apierror"
+	"envie-backend/internal/database"
+	"envie-backend/internal/limits"
+	"envie-backend/internal/models"
+	"envie-backend/internal/settings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UsageLimit - how much of something an organization uses, and its limit; a
+// nil limit is unlimited
+type UsageLimit struct {
+	Used  int64  `json:"used"`
+	Limit *int64 `json:"limit"`
+}
+
+// OrganizationUsage - an organization's usage against the instance's limits
+// with its overrides. TokensPerProject uses the project with the most active
+// tokens.
+type OrganizationUsage struct {
+	Projects         UsageLimit `json:"projects"`
+	Members          UsageLimit `json:"members"`
+	TokensPerProject UsageLimit `json:"tokensPerProject"`
+	StorageBytes     UsageLimit `json:"storageBytes"`
+}
+
+// UpdatePlanLimitsRequest replaces an organization's overrides; nil fields use
+// the instance's limits, 0 is unlimited
+type UpdatePlanLimitsRequest struct {
+	MaxProjects         *int   `json:"maxProjects" binding:"omitempty,min=0"`
+	MaxMembers          *int   `json:"maxMembers" binding:"omitempty,min=0"`
+	MaxTokensPerProject *int   `json:"maxTokensPerProject" binding:"omitempty,min=0"`
+	MaxStorageBytes     *int64 `json:"maxStorageBytes" binding:"omitempty,min=0"`
+}
+
+// orgLimits returns the instance's limits with the organization's overrides
+func orgLimits(db *gorm.DB, orgID uuid.UUID) (limits.Limits, error) {
+	var org models.Organization
+	if err := db.Select("id, plan_max_projects, plan_max_members, plan_max_tokens_per_project, plan_max_storage_bytes").
+		First(&org, "id = ?", orgID).Error; err != nil {
+		return limits.Limits{}, err
+	}
+	return settings.Current().Limits.With(org.PlanLimits), nil
+}
+
+// planLimitError fails with a CodePlanLimit error when one more would take used
+// past limit
+func planLimitError(what string, used int64, limit int, advice string) error {
+	if limit == 0 || used < int64(limit) {
+		return nil
+	}
+	return apierror.New(http.StatusPaymentRequired, apierror.CodePlanLimit,
+		fmt.Sprintf("Limit reached: the plan allows %d %s and %d are in use. %s or ask the instance administrator to raise the limit", limit, what, used, advice))
+}
+
+// activeTokens is the tokens that count toward the token limit: expired ones
+// can't be used and are only kept until purged
+func activeTokens(db *gorm.DB, now time.Time) *gorm.DB {
+	return db.Model(&models.ProjectToken{}).Where("(project_tokens.expires_at IS NULL OR project_tokens.expires_at > ?)", now)
+}
+
+// checkProjectLimit fails with a CodePlanLimit error when the organization
+// can't have another project
+func checkProjectLimit(db *gorm.DB, orgID uuid.UUID) error {
+	l, err := orgLimits(db, orgID)
+	if err != nil || l.ProjectsPerOrg == 0 {
+		return err
+	}
+	var used int64
+	if err := db.Model(&models.Project{}).Where("organization_id = ?", orgID).Count(&used).Error; err != nil {
+		return err
+	}
+	return planLimitError("projects per organization", used, l.ProjectsPerOrg, "Delete a project")
+}
+
+// checkMemberLimit fails with a CodePlanLimit error when the organization
+// can't have another member
+func checkMemberLimit(db *gorm.DB, orgID uuid.UUID) error {
+	l, err := orgLimits(db, orgID)
+	if err != nil || l.MembersPerOrg == 0 {
+		return err
+	}
+	var used int64
+	if err := db.Model(&models.OrganizationUser{}).Where("organization_id = ?", orgID).Count(&used).Error; err != nil {
+		return err
+	}
+	return planLimitError("members per organization", used, l.MembersPerOrg, "Remove a member")
+}
+
+// checkTokenLimit fails with a CodePlanLimit error when the project can't have
+// another active token
+func checkTokenLimit(db *gorm.DB, orgID, projectID uuid.UUID) error {
+	l, err := orgLimits(db, orgID)
+	if err != nil || l.TokensPerProject == 0 {
+		return err
+	}
+	var used int64
+	if err := activeTokens(db, time.Now()).Where("project_tokens.project_id = ?", projectID).Count(&used).Error; err != nil {
+		return err
+	}
+	return planLimitError("active CLI tokens per project", used, l.TokensPerProject, "Delete unused tokens")
+}
+
+// planStorageError is storageQuotaError for the plan's storage limit
+func planStorageError(used, adding, limit int64) error {
+	if limit == 0 || used+adding <= limit {
+		return nil
+	}
+	return apierror.New(http.StatusPaymentRequired, apierror.CodePlanLimit,
+		fmt.Sprintf("Storage limit reached: the plan allows %d bytes, %d are used and the file needs %d more. Delete files or ask the instance administrator to raise the limit", limit, used, adding))
+}
+
+func usageLimit(used, limit int64) UsageLimit {
+	usage := UsageLimit{Used: used}
+	if limit > 0 {
+		usage.Limit = &limit
+	}
+	return usage
+}
+
+// GetOrganizationUsage reports the organization's usage against its limits
+func GetOrganizationUsage(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	db := requestDB(c)
+	l, err := orgLimits(db, orgID)
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch usage")
+		return
+	}
+
+	var projects, members int64
+	var busiest struct{ Count int64 }
+	if err := db.Model(&models.Project{}).Where("organization_id = ?", orgID).Count(&projects).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch usage")
+		return
+	}
+	if err := db.Model(&models.OrganizationUser{}).Where("organization_id = ?", orgID).Count(&members).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch usage")
+		return
+	}
+	if err := activeTokens(db, time.Now()).
+		Joins("JOIN projects ON projects.id = project_tokens.project_id AND projects.deleted_at IS NULL").
+		Where("projects.organization_id = ?", orgID).
+		Select("COUNT(*) AS count").
+		Group("project_tokens.project_id").
+		Order("count DESC").
+		Limit(1).
+		Scan(&busiest).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch usage")
+		return
+	}
+	storage, err := orgStorageUsage(db, orgID)
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch usage")
+		return
+	}
+
+	RespondOK(c, OrganizationUsage{
+		Projects:         usageLimit(projects, int64(l.ProjectsPerOrg)),
+		Members:          usageLimit(members, int64(l.MembersPerOrg)),
+		TokensPerProject: usageLimit(busiest.Count, int64(l.TokensPerProject)),
+		StorageBytes:     usageLimit(storage, l.StorageBytesPerOrg),
+	})
+}
+
+// UpdateOrganizationPlanLimits sets an organization's overrides of the
+// instance's limits (superadmins). Lowering a limit below the usage keeps what
+// exists and refuses adding more.
+func UpdateOrganizationPlanLimits(c *gin.Context) {
+	uid, ok := requireSuperadminUser(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	var req UpdatePlanLimitsRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	var org models.Organization
+	if err := requestDB(c).First(&org, "id = ?", orgID).Error; err != nil {
+		RespondNotFound(c, "Organization not found")
+		return
+	}
+
+	org.PlanLimits = models.PlanLimits(req)
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Model(&org).Updates(map[string]any{
+			"plan_max_projects":           req.MaxProjects,
+			"plan_max_members":            req.MaxMembers,
+			"plan_max_tokens_per_project": req.MaxTokensPerProject,
+			"plan_max_storage_bytes":      req.MaxStorageBytes,
+		}).Error; err != nil {
+			return err
+		}
+		return recordInstanceEvent(tx, uid, models.InstancePlanLimitsChanged, nil, org.Name+" ("+org.ID.String()+"): "+settings.Current().Limits.With(org.PlanLimits).String(), 0)
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to update limits")
+		return
+	}
+
+	RespondOK(c, org.PlanLimits)
+}
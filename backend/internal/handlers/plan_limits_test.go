@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"envie-backend/internal/apierror"
+)
+
+func TestPlanLimitError(t *testing.T) {
+	if err := planLimitError("projects per organization", 9, 10, "Delete a project"); err != nil {
+		t.Errorf("below the limit: %v", err)
+	}
+	if err := planLimitError("projects per organization", 500, 0, "Delete a project"); err != nil {
+		t.Errorf("unlimited: %v", err)
+	}
+	err := planLimitError("projects per organization", 10, 10, "Delete a project")
+	var apiErr *apierror.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != apierror.CodePlanLimit || apiErr.Status != http.StatusPaymentRequired {
+		t.Fatalf("at the limit: err = %v", err)
+	}
+	if want := "the plan allows 10 projects per organization and 10 are in use. Delete a project"; !strings.Contains(err.Error(), want) {
+		t.Errorf("message %q doesn't contain %q", err.Error(), want)
+	}
+}
+
+func TestPlanStorageError(t *testing.T) {
+	if err := planStorageError(900, 100, 1000); err != nil {
+		t.Errorf("filling the limit exactly: %v", err)
+	}
+	if err := planStorageError(900, 101, 0); err != nil {
+		t.Errorf("unlimited: %v", err)
+	}
+	if err := planStorageError(900, 101, 1000); apierror.CodeOf(err) != apierror.CodePlanLimit {
+		t.Errorf("past the limit: err = %v", err)
+	}
+}
+
+func TestUsageLimit(t *testing.T) {
+	if usage := usageLimit(3, 0); usage.Limit != nil {
+		t.Errorf("unlimited usage has limit %d", *usage.Limit)
+	}
+	if usage := usageLimit(3, 5); usage.Limit == nil || *usage.Limit != 5 || usage.Used != 3 {
+		t.Errorf("usageLimit(3, 5) = %+v", usage)
+	}
+}
@@ -2,7 +2,11 @@ package handlers
 
 import (
 	"errors"
+	"net/http"
+	"time"
 
+	"envie-backend/internal/apierror"
+	"envie-backend/internal/apitime"
 	"envie-backend/internal/database"
 	"envie-backend/internal/models"
 
@@ -12,44 +16,69 @@ import (
 )
 
 type CreateProjectRequest struct {
-	Name           string    `json:"name" binding:"required"`
-	EncryptedKey   string    `json:"encryptedKey" binding:"required"`
+	Name           string    `json:"name" binding:"required,max=255,name"`
+	EncryptedKey   string    `json:"encryptedKey" binding:"required,ciphertext"`
 	OrganizationID uuid.UUID `json:"organizationId" binding:"required"`
 	TeamID         uuid.UUID `json:"teamId" binding:"required"`
+	Sandbox        bool      `json:"sandbox"` // a test-mode project, see models.Project.Sandbox
 }
 
 type UpdateProjectRequest struct {
-	Name string `json:"name" binding:"required"`
+	Name              string `json:"name" binding:"required,max=255,name"`
+	RestrictSensitive *bool  `json:"restrictSensitive"` // unchanged when omitted
 }
 
 type ProjectResponse struct {
-	ID                  uuid.UUID `json:"id"`
-	Name                string    `json:"name"`
-	OrganizationID      uuid.UUID `json:"organizationId"`
-	OrganizationName    string    `json:"organizationName"`
-	CreatedAt           string    `json:"createdAt"`
-	UpdatedAt           string    `json:"updatedAt"`
-	EncryptedProjectKey string    `json:"encryptedProjectKey"`
-	EncryptedTeamKey    string    `json:"encryptedTeamKey,omitempty"`
-	TeamID              uuid.UUID `json:"teamId"`
-	TeamName            string    `json:"teamName"`
-	TeamRole            string    `json:"teamRole,omitempty"`
-	OrgRole             string    `json:"orgRole,omitempty"`
-	CanEdit             bool      `json:"canEdit"`
-	CanDelete           bool      `json:"canDelete"`
-	KeyVersion          int       `json:"keyVersion"`
-	ConfigChecksum      string    `json:"configChecksum,omitempty"`
+	ID                  uuid.UUID           `json:"id"`
+	Name                string              `json:"name"`
+	Slug                string              `json:"slug"`
+	OrganizationID      uuid.UUID           `json:"organizationId"`
+	OrganizationName    string              `json:"organizationName"`
+	CreatedAt           apitime.Time        `json:"createdAt"`
+	UpdatedAt           apitime.Time        `json:"updatedAt"`
+	EncryptedProjectKey string              `json:"encryptedProjectKey"`
+	EncryptedTeamKey    string              `json:"encryptedTeamKey,omitempty"`
+	TeamID              uuid.UUID           `json:"teamId"`
+	TeamName            string              `json:"teamName"`
+	TeamRole            string              `json:"teamRole,omitempty"`
+	OrgRole             string              `json:"orgRole,omitempty"`
+	CanEdit             bool                `json:"canEdit"`
+	CanDelete           bool                `json:"canDelete"`
+	RestrictSensitive   bool                `json:"restrictSensitive"`
+	CanRevealSensitive  bool                `json:"canRevealSensitive"`
+	Sandbox             bool                `json:"sandbox"`
+	Permissions         []string            `json:"permissions"`
+	Capabilities        ProjectCapabilities `json:"capabilities"`
+	KeyVersion          int                 `json:"keyVersion"`
+	ConfigChecksum      string              `json:"configChecksum,omitempty"`
+	Tags                []string            `json:"tags"`
+	Favorite            bool                `json:"favorite"` // of the requesting user
+
+	// LegacyConfigChecksum is ConfigChecksum in version 1, during the migration
+	// window, to compare checksums recorded before it with
+	ChecksumVersion      int    `json:"checksumVersion"`
+	LegacyConfigChecksum string `json:"legacyConfigChecksum,omitempty"`
 }
 
 type ProjectListItem struct {
-	ID               uuid.UUID `json:"id"`
-	Name             string    `json:"name"`
-	OrganizationID   uuid.UUID `json:"organizationId"`
-	OrganizationName string    `json:"organizationName"`
-	KeyVersion       int       `json:"keyVersion"`
-	ConfigChecksum   string    `json:"configChecksum,omitempty"`
-	CreatedAt        string    `json:"createdAt"`
-	UpdatedAt        string    `json:"updatedAt"`
+	ID               uuid.UUID           `json:"id"`
+	Name             string              `json:"name"`
+	Slug             string              `json:"slug"`
+	OrganizationID   uuid.UUID           `json:"organizationId"`
+	OrganizationName string              `json:"organizationName"`
+	KeyVersion       int                 `json:"keyVersion"`
+	ConfigChecksum   string              `json:"configChecksum,omitempty"`
+	Sandbox          bool                `json:"sandbox"`
+	Tags             []string            `json:"tags"`
+	Favorite         bool                `json:"favorite"` // of the requesting user
+	Capabilities     ProjectCapabilities `json:"capabilities"`
+	CreatedAt        apitime.Time        `json:"createdAt"`
+	UpdatedAt        apitime.Time        `json:"updatedAt"`
+
+	// LegacyConfigChecksum is ConfigChecksum in version 1, during the migration
+	// window
+	ChecksumVersion      int    `json:"checksumVersion"`
+	LegacyConfigChecksum string `json:"legacyConfigChecksum,omitempty"`
 }
 
 type projectWithOrg struct {
@@ -68,17 +97,33 @@ func mapProjectsToListItems(results []projectWithOrg) []ProjectListItem {
 		projects = append(projects, ProjectListItem{
 			ID:               r.ID,
 			Name:             r.Name,
+			Slug:             r.Slug,
 			OrganizationID:   r.OrganizationID,
 			OrganizationName: r.Organization.Name,
 			KeyVersion:       r.KeyVersion,
 			ConfigChecksum:   configChecksum,
-			CreatedAt:        r.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-			UpdatedAt:        r.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+			Sandbox:          r.Sandbox,
+			CreatedAt:        apitime.New(r.CreatedAt),
+			UpdatedAt:        apitime.New(r.UpdatedAt),
+
+			ChecksumVersion:      models.ConfigChecksumVersion,
+			LegacyConfigChecksum: legacyConfigChecksum(&r.Project),
 		})
 	}
 	return projects
 }
 
+// projectListItems lists results with their tags, whether the user favorited them
+// and what they may do in them. If unsuccessful, it sends an error response
+// automatically.
+func projectListItems(c *gin.Context, uid uuid.UUID, results []projectWithOrg) ([]ProjectListItem, bool) {
+	projects, ok := withProjectTags(c, uid, mapProjectsToListItems(results))
+	if !ok {
+		return nil, false
+	}
+	return withProjectCapabilities(c, uid, results, projects)
+}
+
 func CreateProject(c *gin.Context) {
 	uid, ok := GetAuthUserID(c)
 	if !ok {
@@ -86,87 +131,127 @@ func CreateProject(c *gin.Context) {
 	}
 
 	var req CreateProjectRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		RespondBadRequest(c, err.Error())
+	if !BindJSON(c, &req) {
 		return
 	}
 
+	projectData, ok := createProjectInTeam(c, uid, req)
+	if !ok {
+		return
+	}
+
+	RespondCreated(c, gin.H{
+		"id":             projectData.ID,
+		"name":           projectData.Name,
+		"slug":           projectData.Slug,
+		"organizationId": projectData.OrganizationID,
+	})
+}
+
+// createProjectInTeam checks permissions and creates the project with its first team
+// assignment. If unsuccessful, it sends an error response automatically.
+func createProjectInTeam(c *gin.Context, uid uuid.UUID, req CreateProjectRequest) (*models.Project, bool) {
 	var orgUser models.OrganizationUser
-	if err := database.DB.Where("user_id = ? AND organization_id = ?", uid, req.OrganizationID).First(&orgUser).Error; err != nil {
+	if err := requestDB(c).Where("user_id = ? AND organization_id = ?", uid, req.OrganizationID).First(&orgUser).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			RespondForbidden(c, "You don't have access to this organization")
 		} else {
 			RespondInternalError(c, "Internal error when checking access")
 		}
-		return
+		return nil, false
 	}
 
 	var team models.Team
-	if err := database.DB.Where("id = ? AND organization_id = ?", req.TeamID, req.OrganizationID).First(&team).Error; err != nil {
+	if err := requestDB(c).Where("id = ? AND organization_id = ?", req.TeamID, req.OrganizationID).First(&team).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			RespondNotFound(c, "Requested team not found in organization")
 		} else {
 			RespondInternalError(c, "Internal error when checking team access")
 		}
-		return
+		return nil, false
 	}
 
 	canCreate, err := CanUserCreateProjectInTeam(uid, req.TeamID, req.OrganizationID)
 	if err != nil {
 		RespondInternalError(c, "Internal error when checking permissions")
-		return
+		return nil, false
 	}
 
 	if !canCreate {
 		RespondForbidden(c, "You don't have permissions to create projects in this team")
-		return
+		return nil, false
 	}
 
-	tx := database.DB.Begin()
-
-	projectData := models.Project{
-		Name:           req.Name,
-		OrganizationID: req.OrganizationID,
+	if err := checkProjectLimit(requestDB(c), req.OrganizationID); err != nil {
+		RespondAPIError(c, err, "Failed to check the project limit")
+		return nil, false
 	}
 
-	if err := tx.Create(&projectData).Error; err != nil {
-		tx.Rollback()
+	var projectData models.Project
+	err = database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		projectData = models.Project{
+			Name:           req.Name,
+			OrganizationID: req.OrganizationID,
+			Sandbox:        req.Sandbox,
+		}
+		if err := tx.Create(&projectData).Error; err != nil {
+			return err
+		}
+
+		teamProjectData := models.TeamProject{
+			TeamID:              req.TeamID,
+			ProjectID:           projectData.ID,
+			EncryptedProjectKey: req.EncryptedKey,
+		}
+		if err := tx.Create(&teamProjectData).Error; err != nil {
+			return err
+		}
+
+		return recordAuditEvent(tx, req.OrganizationID, &projectData.ID, uid, models.AuditProjectCreated, projectData.Name, 0)
+	})
+	if err != nil {
 		RespondInternalError(c, "Failed to create project")
-		return
+		return nil, false
 	}
 
-	teamProjectData := models.TeamProject{
-		TeamID:              req.TeamID,
-		ProjectID:           projectData.ID,
-		EncryptedProjectKey: req.EncryptedKey,
+	return &projectData, true
+}
+
+func GetProjects(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
 	}
 
-	if err := tx.Create(&teamProjectData).Error; err != nil {
-		tx.Rollback()
-		RespondInternalError(c, "Failed adding project to team")
+	fields, ok := RequestedFields(c, ProjectListItem{})
+	if !ok {
 		return
 	}
 
-	if err := tx.Commit().Error; err != nil {
-		RespondInternalError(c, "Failed creating project")
+	results, err := userProjects(requestDB(c), uid)
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch projects")
 		return
 	}
 
-	RespondCreated(c, gin.H{
-		"id":             projectData.ID,
-		"name":           projectData.Name,
-		"organizationId": projectData.OrganizationID,
-	})
-}
+	results, ok = filterProjectsByLabel(c, results)
+	if !ok {
+		return
+	}
 
-func GetProjects(c *gin.Context) {
-	uid, ok := GetAuthUserID(c)
+	projects, ok := projectListItems(c, uid, results)
 	if !ok {
 		return
 	}
 
+	RespondList(c, fields, projects)
+}
+
+// userProjects lists the projects the user can access, through their teams or as
+// an organization admin, most recently updated first
+func userProjects(db *gorm.DB, uid uuid.UUID) ([]projectWithOrg, error) {
 	var results []projectWithOrg
-	err := database.DB.Raw(`
+	err := db.Raw(`
 		SELECT projects.*, organizations.id as org_id, organizations.name as org_name
 		FROM projects
 		JOIN organizations ON organizations.id = projects.organization_id
@@ -185,13 +270,7 @@ func GetProjects(c *gin.Context) {
 
 		ORDER BY updated_at DESC
 	`, uid, uid).Scan(&results).Error
-
-	if err != nil {
-		RespondInternalError(c, "Failed to fetch projects")
-		return
-	}
-
-	RespondOK(c, mapProjectsToListItems(results))
+	return results, err
 }
 
 func GetOrganizationProjects(c *gin.Context) {
@@ -204,8 +283,13 @@ func GetOrganizationProjects(c *gin.Context) {
 		return
 	}
 
+	fields, ok := RequestedFields(c, ProjectListItem{})
+	if !ok {
+		return
+	}
+
 	var results []projectWithOrg
-	err := database.DB.Raw(`
+	err := requestDB(c).Raw(`
 		SELECT projects.*, organizations.id as org_id, organizations.name as org_name
 		FROM projects
 		JOIN organizations ON organizations.id = projects.organization_id
@@ -230,35 +314,31 @@ func GetOrganizationProjects(c *gin.Context) {
 		return
 	}
 
-	RespondOK(c, mapProjectsToListItems(results))
-}
-
-func GetProject(c *gin.Context) {
-	uid, ok := GetAuthUserID(c)
+	results, ok = filterProjectsByLabel(c, results)
 	if !ok {
 		return
 	}
 
-	projectID, ok := ParseUUIDParam(c, "id", "project")
+	projects, ok := projectListItems(c, uid, results)
 	if !ok {
 		return
 	}
 
-	access, err := GetUserProjectAccess(uid, projectID)
-	if err != nil {
-		if err.Error() == "project not found" {
-			RespondNotFound(c, "Project not found")
-		} else if err.Error() == "access denied" {
-			RespondForbidden(c, "Access denied")
-		} else {
-			RespondInternalError(c, "Failed to check access")
-		}
+	RespondList(c, fields, projects)
+}
+
+func GetProject(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
 		return
 	}
 
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID
+
 	var org models.Organization
 	orgName := ""
-	if err := database.DB.Where("id = ?", access.Project.OrganizationID).First(&org).Error; err == nil {
+	if err := requestDB(c).Where("id = ?", access.Project.OrganizationID).First(&org).Error; err == nil {
 		orgName = org.Name
 	}
 
@@ -270,20 +350,45 @@ func GetProject(c *gin.Context) {
 	response := ProjectResponse{
 		ID:                  access.Project.ID,
 		Name:                access.Project.Name,
+		Slug:                access.Project.Slug,
 		OrganizationID:      access.Project.OrganizationID,
 		OrganizationName:    orgName,
-		CreatedAt:           access.Project.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		UpdatedAt:           access.Project.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		CreatedAt:           apitime.New(access.Project.CreatedAt),
+		UpdatedAt:           apitime.New(access.Project.UpdatedAt),
 		EncryptedProjectKey: access.EncryptedProjectKey,
 		EncryptedTeamKey:    access.EncryptedTeamKey,
 		TeamRole:            access.TeamRole,
 		OrgRole:             access.OrgRole,
 		CanEdit:             access.CanEdit,
 		CanDelete:           access.CanDelete,
+		RestrictSensitive:   access.Project.RestrictSensitive,
+		CanRevealSensitive:  !access.MasksSensitive(),
+		Sandbox:             access.Project.Sandbox,
+		Permissions:         access.Permissions.List(),
+		Capabilities:        access.Capabilities(),
 		KeyVersion:          access.Project.KeyVersion,
 		ConfigChecksum:      configChecksum,
+
+		ChecksumVersion:      models.ConfigChecksumVersion,
+		LegacyConfigChecksum: legacyConfigChecksum(access.Project),
 	}
 
+	tags, err := loadProjectTags(requestDB(c), []uuid.UUID{projectID})
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch project tags")
+		return
+	}
+	favorites, err := loadFavoriteProjects(requestDB(c), uid, []uuid.UUID{projectID})
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch favorite projects")
+		return
+	}
+	response.Tags = tags[projectID]
+	if response.Tags == nil {
+		response.Tags = []string{}
+	}
+	response.Favorite = favorites[projectID]
+
 	if access.Team != nil {
 		response.TeamID = access.Team.ID
 		response.TeamName = access.Team.Name
@@ -298,86 +403,233 @@ func UpdateProject(c *gin.Context) {
 		return
 	}
 
-	projectID, ok := ParseUUIDParam(c, "id", "project")
-	if !ok {
-		return
-	}
+	access := CurrentProjectAccess(c)
 
 	var req UpdateProjectRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		RespondBadRequest(c, err.Error())
+	if !BindJSON(c, &req) {
 		return
 	}
 
-	access, err := GetUserProjectAccess(uid, projectID)
-	if err != nil {
-		if err.Error() == "access denied" {
-			RespondForbidden(c, "Access denied")
-		} else {
-			RespondInternalError(c, "Failed to verify access")
-		}
-		return
-	}
-
-	if !access.CanEdit {
-		RespondForbidden(c, "You don't have permission to edit this project")
+	// Only those who can read sensitive values decide who else can
+	if req.RestrictSensitive != nil && *req.RestrictSensitive != access.Project.RestrictSensitive && !access.Can(models.PermissionSecretsReveal) {
+		RespondForbidden(c, "Only members with "+models.PermissionSecretsReveal+" can change whether sensitive values are restricted")
 		return
 	}
 
-	if err := database.DB.Model(&models.Project{}).Where("id = ?", projectID).Update("name", req.Name).Error; err != nil {
+	if err := renameProject(requestDB(c), access.Project, req.Name, uid); err != nil {
 		RespondInternalError(c, "Failed to update project")
 		return
 	}
+	if req.RestrictSensitive != nil && *req.RestrictSensitive != access.Project.RestrictSensitive {
+		if err := requestDB(c).Model(access.Project).Update("restrict_sensitive", *req.RestrictSensitive).Error; err != nil {
+			RespondInternalError(c, "Failed to update project")
+			return
+		}
+	}
 
 	RespondMessage(c, "Project updated")
 }
 
-func DeleteProject(c *gin.Context) {
-	uid, ok := GetAuthUserID(c)
+// renameProject changes the project's display name and records the rename. The
+// slug stays, so clients resolving the project by slug keep working.
+func renameProject(db *gorm.DB, project *models.Project, name string, userID uuid.UUID) error {
+	if project.Name == name {
+		return nil
+	}
+	return database.Transaction(db, func(tx *gorm.DB) error {
+		if err := tx.Create(&models.ProjectRename{
+			ProjectID: project.ID,
+			OldName:   project.Name,
+			NewName:   name,
+			RenamedBy: userID,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(project).Update("name", name).Error
+	})
+}
+
+// ProjectRenamePage - a page of renames, newest first
+type ProjectRenamePage struct {
+	Items      []ProjectRenameResponse `json:"items"`
+	NextCursor string                  `json:"nextCursor,omitempty"`
+}
+
+type ProjectRenameResponse struct {
+	OldName       string    `json:"oldName"`
+	NewName       string    `json:"newName"`
+	RenamedBy     uuid.UUID `json:"renamedBy"`
+	RenamedByName string    `json:"renamedByName"`
+	RenamedAt     time.Time `json:"renamedAt"`
+}
+
+// GetProjectRenames lists the project's past names, newest first
+func GetProjectRenames(c *gin.Context) {
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	page, ok := RequestedPage(c)
 	if !ok {
 		return
 	}
 
-	projectID, ok := ParseUUIDParam(c, "id", "project")
-	if !ok {
+	var renames []models.ProjectRename
+	if err := page.Apply(requestDB(c).Preload("Renamer").Where("project_id = ?", projectID), "project_renames").Find(&renames).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch project renames")
 		return
 	}
 
-	access, err := GetUserProjectAccess(uid, projectID)
-	if err != nil {
-		if err.Error() == "access denied" {
-			RespondForbidden(c, "Access denied")
-		} else {
-			RespondInternalError(c, "Failed to verify access")
+	renames, nextCursor := pageItems(page, renames, func(r *models.ProjectRename) (time.Time, uuid.UUID) {
+		return r.CreatedAt, r.ID
+	})
+	response := ProjectRenamePage{Items: make([]ProjectRenameResponse, len(renames)), NextCursor: nextCursor}
+	for i, r := range renames {
+		response.Items[i] = ProjectRenameResponse{
+			OldName:       r.OldName,
+			NewName:       r.NewName,
+			RenamedBy:     r.RenamedBy,
+			RenamedByName: r.Renamer.Name,
+			RenamedAt:     r.CreatedAt,
 		}
+	}
+	RespondOK(c, response)
+}
+
+func DeleteProject(c *gin.Context) {
+	projectID := CurrentProjectAccess(c).Project.ID
+	if !checkProjectDeletable(c, projectID) {
 		return
 	}
 
-	if !access.CanDelete {
-		RespondForbidden(c, "Only team owners or organization owners can delete projects")
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("project_id = ?", projectID).Delete(&models.TeamProject{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.Project{}, "id = ?", projectID).Error
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to delete project")
 		return
 	}
 
-	tx := database.DB.Begin()
+	RespondMessage(c, "Project deleted")
+}
+
+const (
+	// recentCLIReadWindow is how long after a token read its project counts as in use
+	recentCLIReadWindow = 7 * 24 * time.Hour
 
-	if err := tx.Unscoped().Where("project_id = ?", projectID).Delete(&models.TeamProject{}).Error; err != nil {
-		tx.Rollback()
-		RespondInternalError(c, "Failed to delete project associations")
-		return
+	// projectDeletionConfirmWindow is how long a second owner has to confirm a
+	// blocked project deletion
+	projectDeletionConfirmWindow = 24 * time.Hour
+)
+
+// ProjectDeletionToken is a token that blocks deleting its project
+type ProjectDeletionToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+// ProjectDeletionBlockedResponse is returned with 409 when a project still in
+// use is deleted without confirmation
+type ProjectDeletionBlockedResponse struct {
+	Error              string                 `json:"error"`
+	Code               apierror.Code          `json:"code"`
+	ActiveTokens       int                    `json:"activeTokens"`
+	RecentlyReadTokens int                    `json:"recentlyReadTokens"`
+	Tokens             []ProjectDeletionToken `json:"tokens"`
+	RequestedBy        uuid.UUID              `json:"requestedBy"`
+	ConfirmationUntil  time.Time              `json:"confirmationUntil"`
+}
+
+// checkProjectDeletable answers 409 and returns false when the project is still
+// in use and neither a second owner confirmed its deletion nor the request set
+// force=true
+func checkProjectDeletable(c *gin.Context, projectID uuid.UUID) bool {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return false
+	}
+	if c.Query("force") == "true" {
+		return true
 	}
 
-	if err := tx.Unscoped().Delete(&models.Project{}, "id = ?", projectID).Error; err != nil {
-		tx.Rollback()
-		RespondInternalError(c, "Failed to delete project")
-		return
+	blocked, err := checkProjectDeletion(requestDB(c), projectID, uid, time.Now())
+	if err != nil {
+		RespondInternalError(c, "Failed to check project usage")
+		return false
+	}
+	if blocked != nil {
+		c.JSON(http.StatusConflict, blocked)
+		return false
 	}
+	return true
+}
 
-	if err := tx.Commit().Error; err != nil {
-		RespondInternalError(c, "Failed to delete project")
-		return
+// checkProjectDeletion returns nil when the project can be deleted: it has no
+// active tokens and no token read it recently, or another owner already asked
+// to delete it. Otherwise it records the user's request for a second owner to
+// confirm and returns what blocks the deletion.
+func checkProjectDeletion(db *gorm.DB, projectID, userID uuid.UUID, now time.Time) (*ProjectDeletionBlockedResponse, error) {
+	var tokens []models.ProjectToken
+	if err := db.Where("project_id = ?", projectID).
+		Where("expires_at IS NULL OR expires_at > ? OR last_used_at > ?", now, now.Add(-recentCLIReadWindow)).
+		Order("created_at").
+		Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	var pending models.PendingProjectDeletion
+	err := db.Where("project_id = ?", projectID).First(&pending).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	found := err == nil && now.Before(pending.ExpiresAt)
+	if found && pending.RequestedBy != userID {
+		return nil, nil
+	}
+	if !found {
+		pending = models.PendingProjectDeletion{
+			ProjectID:   projectID,
+			RequestedBy: userID,
+			ExpiresAt:   now.Add(projectDeletionConfirmWindow),
+		}
+		if err := database.Transaction(db, func(tx *gorm.DB) error {
+			if err := tx.Where("project_id = ?", projectID).Delete(&models.PendingProjectDeletion{}).Error; err != nil {
+				return err
+			}
+			return tx.Create(&pending).Error
+		}); err != nil {
+			return nil, err
+		}
 	}
 
-	RespondMessage(c, "Project deleted")
+	blocked := &ProjectDeletionBlockedResponse{
+		Error:             "Project is in use: another owner must confirm the deletion, or retry with force=true",
+		Code:              apierror.CodeProjectInUse,
+		Tokens:            make([]ProjectDeletionToken, len(tokens)),
+		RequestedBy:       pending.RequestedBy,
+		ConfirmationUntil: pending.ExpiresAt,
+	}
+	for i, token := range tokens {
+		if token.ExpiresAt == nil || token.ExpiresAt.After(now) {
+			blocked.ActiveTokens++
+		}
+		if token.LastUsedAt != nil && token.LastUsedAt.After(now.Add(-recentCLIReadWindow)) {
+			blocked.RecentlyReadTokens++
+		}
+		blocked.Tokens[i] = ProjectDeletionToken{
+			ID:         token.ID,
+			Name:       token.Name,
+			ExpiresAt:  token.ExpiresAt,
+			LastUsedAt: token.LastUsedAt,
+		}
+	}
+	return blocked, nil
 }
 
 type TeamWithUsers struct {
@@ -414,21 +666,8 @@ type ProjectAccessResponse struct {
 }
 
 func GetProjectTeams(c *gin.Context) {
-	uid, ok := GetAuthUserID(c)
-	if !ok {
-		return
-	}
-
-	projectID, ok := ParseUUIDParam(c, "id", "project")
-	if !ok {
-		return
-	}
-
-	access, err := GetUserProjectAccess(uid, projectID)
-	if err != nil {
-		RespondForbidden(c, "Access denied")
-		return
-	}
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID
 
 	orgID := access.Project.OrganizationID
 
@@ -442,7 +681,7 @@ func GetProjectTeams(c *gin.Context) {
 		UserAvatarURL *string    `gorm:"column:user_avatar_url"`
 	}
 	var rows []teamUserRow
-	if err := database.DB.Raw(`
+	if err := requestDB(c).Raw(`
 		SELECT teams.*, team_users.role, users.id as user_id, users.name as user_name,
 		       users.email as user_email, users.avatar_url as user_avatar_url
 		FROM teams
@@ -496,12 +735,12 @@ func GetProjectTeams(c *gin.Context) {
 
 	var availableTeams []AvailableTeam
 	if len(teamIDs) > 0 {
-		database.DB.Model(&models.Team{}).
+		requestDB(c).Model(&models.Team{}).
 			Select("id, name").
 			Where("organization_id = ? AND id NOT IN ?", orgID, teamIDs).
 			Scan(&availableTeams)
 	} else {
-		database.DB.Model(&models.Team{}).
+		requestDB(c).Model(&models.Team{}).
 			Select("id, name").
 			Where("organization_id = ?", orgID).
 			Scan(&availableTeams)
@@ -516,7 +755,7 @@ func GetProjectTeams(c *gin.Context) {
 		models.User
 	}
 	var adminRows []orgAdminRow
-	database.DB.Raw(`
+	requestDB(c).Raw(`
 		SELECT organization_users.role as org_role, users.*
 		FROM organization_users
 		JOIN users ON users.id = organization_users.user_id
@@ -550,45 +789,26 @@ func GetProjectTeams(c *gin.Context) {
 
 type AddTeamToProjectRequest struct {
 	TeamID              uuid.UUID `json:"teamId" binding:"required"`
-	EncryptedProjectKey string    `json:"encryptedProjectKey" binding:"required"`
+	EncryptedProjectKey string    `json:"encryptedProjectKey" binding:"required,ciphertext"`
 }
 
 func AddTeamToProject(c *gin.Context) {
-	uid, ok := GetAuthUserID(c)
-	if !ok {
-		return
-	}
-
-	projectID, ok := ParseUUIDParam(c, "id", "project")
-	if !ok {
-		return
-	}
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID
 
 	var req AddTeamToProjectRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		RespondBadRequest(c, err.Error())
-		return
-	}
-
-	access, err := GetUserProjectAccess(uid, projectID)
-	if err != nil {
-		RespondForbidden(c, "Access denied")
-		return
-	}
-
-	if !access.CanEdit {
-		RespondForbidden(c, "You don't have permission to modify this project")
+	if !BindJSON(c, &req) {
 		return
 	}
 
 	var team models.Team
-	if err := database.DB.Where("id = ? AND organization_id = ?", req.TeamID, access.Project.OrganizationID).First(&team).Error; err != nil {
+	if err := requestDB(c).Where("id = ? AND organization_id = ?", req.TeamID, access.Project.OrganizationID).First(&team).Error; err != nil {
 		RespondBadRequest(c, "Team not found in this organization")
 		return
 	}
 
 	var existing models.TeamProject
-	if err := database.DB.Where("team_id = ? AND project_id = ?", req.TeamID, projectID).First(&existing).Error; err == nil {
+	if err := requestDB(c).Where("team_id = ? AND project_id = ?", req.TeamID, projectID).First(&existing).Error; err == nil {
 		RespondConflict(c, "Team already has access to this project")
 		return
 	}
@@ -599,7 +819,7 @@ func AddTeamToProject(c *gin.Context) {
 		EncryptedProjectKey: req.EncryptedProjectKey,
 	}
 
-	if err := database.DB.Create(&teamProject).Error; err != nil {
+	if err := requestDB(c).Create(&teamProject).Error; err != nil {
 		RespondInternalError(c, "Failed to add team to project")
 		return
 	}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"regexp"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type ProjectSchemaVariableRequest struct {
+	Name        string  `json:"name" binding:"required,max=255"`
+	Type        string  `json:"type" binding:"omitempty,oneof=string number boolean url json"` // string when omitted
+	Pattern     *string `json:"pattern" binding:"omitempty,max=500"`
+	Description *string `json:"description" binding:"omitempty,max=500"`
+}
+
+type SetProjectSchemaRequest struct {
+	Variables []ProjectSchemaVariableRequest `json:"variables" binding:"max=500,dive"`
+}
+
+// ProjectSchemaResponse - the variables a project's config must define, in order
+type ProjectSchemaResponse struct {
+	ProjectID uuid.UUID                      `json:"projectId"`
+	Variables []models.ProjectSchemaVariable `json:"variables"`
+}
+
+// GetProjectSchema lists the variables the project requires
+func GetProjectSchema(c *gin.Context) {
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	respondProjectSchema(c, projectID)
+}
+
+// PutProjectSchema replaces the variables the project requires. Config syncs
+// missing any of them still succeed, with the missing names in the response.
+func PutProjectSchema(c *gin.Context) {
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	var req SetProjectSchemaRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	variables := make([]models.ProjectSchemaVariable, len(req.Variables))
+	seen := map[string]bool{}
+	for i, v := range req.Variables {
+		if seen[v.Name] {
+			RespondBadRequest(c, "Duplicate variable: "+v.Name)
+			return
+		}
+		seen[v.Name] = true
+
+		if v.Pattern != nil {
+			if _, err := regexp.Compile(*v.Pattern); err != nil {
+				RespondBadRequest(c, "Invalid pattern for "+v.Name+": "+err.Error())
+				return
+			}
+		}
+
+		variables[i] = models.ProjectSchemaVariable{
+			ProjectID:   projectID,
+			Name:        v.Name,
+			Type:        v.Type,
+			Pattern:     v.Pattern,
+			Description: v.Description,
+			Position:    i,
+		}
+		if variables[i].Type == "" {
+			variables[i].Type = models.VariableTypeString
+		}
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Where("project_id = ?", projectID).Delete(&models.ProjectSchemaVariable{}).Error; err != nil {
+			return err
+		}
+		if len(variables) == 0 {
+			return nil
+		}
+		return tx.Create(&variables).Error
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to update schema")
+		return
+	}
+
+	respondProjectSchema(c, projectID)
+}
+
+// GetCLIProjectSchema lists the variables the token's project requires, for
+// `envie check`
+func GetCLIProjectSchema(c *gin.Context) {
+	_, projectID, ok := requireCLIProjectToken(c)
+	if !ok {
+		return
+	}
+
+	respondProjectSchema(c, projectID)
+}
+
+func respondProjectSchema(c *gin.Context, projectID uuid.UUID) {
+	variables, err := loadProjectSchema(requestDB(c), projectID)
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch schema")
+		return
+	}
+
+	RespondOK(c, ProjectSchemaResponse{ProjectID: projectID, Variables: variables})
+}
+
+func loadProjectSchema(db *gorm.DB, projectID uuid.UUID) ([]models.ProjectSchemaVariable, error) {
+	variables := []models.ProjectSchemaVariable{}
+	err := db.Where("project_id = ?", projectID).Order("position").Find(&variables).Error
+	return variables, err
+}
+
+// missingSchemaVariables returns the names of the schema's variables that aren't
+// among the config items, in schema order
+func missingSchemaVariables(schema []models.ProjectSchemaVariable, items []models.ConfigItem) []string {
+	defined := make(map[string]bool, len(items))
+	for _, item := range items {
+		defined[item.Name] = true
+	}
+
+	var missing []string
+	for _, variable := range schema {
+		if !defined[variable.Name] {
+			missing = append(missing, variable.Name)
+		}
+	}
+	return missing
+}
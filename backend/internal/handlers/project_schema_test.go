@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+
+	"envie-backend/internal/models"
+)
+
+func TestMissingSchemaVariables(t *testing.T) {
+	schema := []models.ProjectSchemaVariable{{Name: "DATABASE_URL"}, {Name: "PORT"}, {Name: "API_KEY"}}
+	items := []models.ConfigItem{{Name: "PORT"}, {Name: "DEBUG"}}
+
+	if got, want := missingSchemaVariables(schema, items), []string{"DATABASE_URL", "API_KEY"}; !slices.Equal(got, want) {
+		t.Errorf("missing = %v, want %v", got, want)
+	}
+	if got := missingSchemaVariables(nil, items); got != nil {
+		t.Errorf("missing without a schema = %v, want nil", got)
+	}
+}
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxProjectTags = 20
+
+var projectTagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,49}$`)
+
+type SetProjectTagsRequest struct {
+	Tags []string `json:"tags" binding:"max=20"`
+}
+
+type ProjectTagsResponse struct {
+	Tags []string `json:"tags"`
+}
+
+// normalizeProjectTags lowercases, deduplicates and sorts tags, rejecting those
+// that aren't lowercase letters, digits, dots, dashes and underscores
+func normalizeProjectTags(tags []string) ([]string, string) {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !projectTagPattern.MatchString(tag) {
+			return nil, "Invalid tag: " + tag + ". Tags are up to 50 letters, digits, dots, dashes and underscores"
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) > maxProjectTags {
+		return nil, "A project can have at most 20 tags"
+	}
+	sort.Strings(normalized)
+	return normalized, ""
+}
+
+// SetProjectTags replaces the tags of a project
+func SetProjectTags(c *gin.Context) {
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	var req SetProjectTagsRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+	tags, message := normalizeProjectTags(req.Tags)
+	if message != "" {
+		RespondBadRequest(c, message)
+		return
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Where("project_id = ?", projectID).Delete(&models.ProjectTag{}).Error; err != nil {
+			return err
+		}
+		if len(tags) == 0 {
+			return nil
+		}
+		rows := make([]models.ProjectTag, len(tags))
+		for i, tag := range tags {
+			rows[i] = models.ProjectTag{ProjectID: projectID, Name: tag}
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to update tags")
+		return
+	}
+
+	RespondOK(c, ProjectTagsResponse{Tags: tags})
+}
+
+// FavoriteProject pins a project to the top of the user's lists
+func FavoriteProject(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	favorite := models.ProjectFavorite{UserID: uid, ProjectID: projectID}
+	if err := requestDB(c).Clauses(clause.OnConflict{DoNothing: true}).Create(&favorite).Error; err != nil {
+		RespondInternalError(c, "Failed to add favorite")
+		return
+	}
+
+	RespondMessage(c, "Project added to favorites")
+}
+
+// UnfavoriteProject removes a project from the user's favorites
+func UnfavoriteProject(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	if err := requestDB(c).Where("user_id = ? AND project_id = ?", uid, projectID).Delete(&models.ProjectFavorite{}).Error; err != nil {
+		RespondInternalError(c, "Failed to remove favorite")
+		return
+	}
+
+	RespondMessage(c, "Project removed from favorites")
+}
+
+// SearchProjects finds projects the user can access by name, slug or tag. q
+// matches a part of any of them, case-insensitively; tag (comma separated) keeps
+// projects carrying all the given tags. Favorites come first, then the most
+// recently updated.
+func SearchProjects(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	q := strings.ToLower(strings.TrimSpace(c.Query("q")))
+	var tags []string
+	if value := c.Query("tag"); value != "" {
+		var message string
+		if tags, message = normalizeProjectTags(strings.Split(value, ",")); message != "" {
+			RespondBadRequest(c, message)
+			return
+		}
+	}
+	if q == "" && len(tags) == 0 {
+		RespondBadRequest(c, "q or tag is required")
+		return
+	}
+
+	fields, ok := RequestedFields(c, ProjectListItem{})
+	if !ok {
+		return
+	}
+
+	results, err := userProjects(requestDB(c), uid)
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch projects")
+		return
+	}
+
+	projects, ok := projectListItems(c, uid, results)
+	if !ok {
+		return
+	}
+
+	RespondFields(c, fields, searchProjects(projects, q, tags))
+}
+
+// searchProjects keeps the projects matching q and carrying all tags, favorites
+// first and otherwise in their original order
+func searchProjects(projects []ProjectListItem, q string, tags []string) []ProjectListItem {
+	matches := []ProjectListItem{}
+	for _, project := range projects {
+		if projectMatches(project, q, tags) {
+			matches = append(matches, project)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Favorite && !matches[j].Favorite
+	})
+	return matches
+}
+
+func projectMatches(project ProjectListItem, q string, tags []string) bool {
+	for _, tag := range tags {
+		if !slices.Contains(project.Tags, tag) {
+			return false
+		}
+	}
+	if q == "" {
+		return true
+	}
+	if strings.Contains(strings.ToLower(project.Name), q) || strings.Contains(project.Slug, q) {
+		return true
+	}
+	for _, tag := range project.Tags {
+		if strings.Contains(tag, q) {
+			return true
+		}
+	}
+	return false
+}
+
+// withProjectTags fills in the tags of the listed projects and whether the user
+// favorited them. If unsuccessful, it sends an error response automatically.
+func withProjectTags(c *gin.Context, uid uuid.UUID, projects []ProjectListItem) ([]ProjectListItem, bool) {
+	ids := make([]uuid.UUID, len(projects))
+	for i, project := range projects {
+		ids[i] = project.ID
+	}
+
+	tags, err := loadProjectTags(requestDB(c), ids)
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch project tags")
+		return nil, false
+	}
+	favorites, err := loadFavoriteProjects(requestDB(c), uid, ids)
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch favorite projects")
+		return nil, false
+	}
+
+	for i := range projects {
+		projects[i].Tags = tags[projects[i].ID]
+		if projects[i].Tags == nil {
+			projects[i].Tags = []string{}
+		}
+		projects[i].Favorite = favorites[projects[i].ID]
+	}
+	return projects, true
+}
+
+// loadProjectTags returns the sorted tags of each of the projects
+func loadProjectTags(db *gorm.DB, projectIDs []uuid.UUID) (map[uuid.UUID][]string, error) {
+	tags := map[uuid.UUID][]string{}
+	if len(projectIDs) == 0 {
+		return tags, nil
+	}
+
+	var rows []models.ProjectTag
+	if err := db.Where("project_id IN ?", projectIDs).Order("name").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		tags[row.ProjectID] = append(tags[row.ProjectID], row.Name)
+	}
+	return tags, nil
+}
+
+// loadFavoriteProjects returns which of the projects the user favorited
+func loadFavoriteProjects(db *gorm.DB, userID uuid.UUID, projectIDs []uuid.UUID) (map[uuid.UUID]bool, error) {
+	favorites := map[uuid.UUID]bool{}
+	if len(projectIDs) == 0 {
+		return favorites, nil
+	}
+
+	var ids []uuid.UUID
+	if err := db.Model(&models.ProjectFavorite{}).
+		Where("user_id = ? AND project_id IN ?", userID, projectIDs).
+		Pluck("project_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		favorites[id] = true
+	}
+	return favorites, nil
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestNormalizeProjectTags(t *testing.T) {
+	tags, message := normalizeProjectTags([]string{" Prod", "backend", "prod", "team.api"})
+	if message != "" || !slices.Equal(tags, []string{"backend", "prod", "team.api"}) {
+		t.Errorf("got %v %q", tags, message)
+	}
+	for _, invalid := range []string{"", "-prod", "two words", "ünicode"} {
+		if _, message := normalizeProjectTags([]string{invalid}); message == "" {
+			t.Errorf("%q accepted", invalid)
+		}
+	}
+	if tags, _ := normalizeProjectTags(nil); tags == nil {
+		t.Error("no tags gives nil, want []")
+	}
+}
+
+func TestSearchProjects(t *testing.T) {
+	projects := []ProjectListItem{
+		{ID: uuid.New(), Name: "Billing API", Slug: "billing-api", Tags: []string{"backend", "prod"}},
+		{ID: uuid.New(), Name: "Web", Slug: "web", Tags: []string{"frontend", "prod"}},
+		{ID: uuid.New(), Name: "Payments", Slug: "payments", Tags: []string{"backend"}, Favorite: true},
+	}
+
+	names := func(items []ProjectListItem) []string {
+		result := []string{}
+		for _, item := range items {
+			result = append(result, item.Name)
+		}
+		return result
+	}
+
+	tests := []struct {
+		q    string
+		tags []string
+		want []string
+	}{
+		{"api", nil, []string{"Billing API"}},
+		{"back", nil, []string{"Payments", "Billing API"}}, // favorites first
+		{"", []string{"prod"}, []string{"Billing API", "Web"}},
+		{"", []string{"backend", "prod"}, []string{"Billing API"}},
+		{"web", []string{"backend"}, []string{}},
+	}
+	for _, tt := range tests {
+		if got := names(searchProjects(projects, tt.q, tt.tags)); !slices.Equal(got, tt.want) {
+			t.Errorf("search(%q, %v) = %v, want %v", tt.q, tt.tags, got, tt.want)
+		}
+	}
+}
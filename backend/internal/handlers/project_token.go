@@ -2,8 +2,13 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
 	"time"
 
+	"envie-backend/internal/apitime"
+	"envie-backend/internal/crypto"
 	"envie-backend/internal/database"
 	"envie-backend/internal/models"
 
@@ -13,30 +18,61 @@ import (
 )
 
 type CreateProjectTokenRequest struct {
-	Name                string    `json:"name" binding:"required,min=1,max=255"`
-	ExpiresAt           time.Time `json:"expiresAt" binding:"required"`
-	TokenPrefix         string    `json:"tokenPrefix" binding:"required,len=3"`
-	IdentityIDHash      string    `json:"identityIdHash" binding:"required,len=64"`
-	EncryptedProjectKey string    `json:"encryptedProjectKey" binding:"required"`
+	Name                string       `json:"name" binding:"required,max=255,name"`
+	ExpiresAt           apitime.Time `json:"expiresAt"`
+	TokenPrefix         string       `json:"tokenPrefix" binding:"required,len=3"`
+	IdentityIDHash      string       `json:"identityIdHash" binding:"required,len=64,hexadecimal"`
+	EncryptedProjectKey string       `json:"encryptedProjectKey" binding:"required,ciphertext"`
+	EnvelopeVersion     int          `json:"envelopeVersion"` // defaults to 1
+	Scopes              []string     `json:"scopes" binding:"omitempty,dive,oneof=secrets.reveal files.write"`
+	AllowedCIDRs        []string     `json:"allowedCidrs" binding:"max=50"` // addresses or CIDR ranges, any address when empty
 }
 
 type CreateProjectTokenResponse struct {
-	ID          uuid.UUID `json:"id"`
-	Name        string    `json:"name"`
-	TokenPrefix string    `json:"tokenPrefix"`
-	ExpiresAt   time.Time `json:"expiresAt"`
-	CreatedAt   time.Time `json:"createdAt"`
+	ID           uuid.UUID `json:"id"`
+	Name         string    `json:"name"`
+	TokenPrefix  string    `json:"tokenPrefix"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	Scopes       []string  `json:"scopes"`
+	AllowedCIDRs []string  `json:"allowedCidrs"`
+	CreatedAt    time.Time `json:"createdAt"`
 }
 
 type ProjectTokenResponse struct {
-	ID          uuid.UUID  `json:"id"`
-	Name        string     `json:"name"`
-	TokenPrefix string     `json:"tokenPrefix"`
-	ExpiresAt   *time.Time `json:"expiresAt"`
-	LastUsedAt  *time.Time `json:"lastUsedAt"`
-	CreatedBy   uuid.UUID  `json:"createdBy"`
-	CreatorName string     `json:"creatorName"`
-	CreatedAt   time.Time  `json:"createdAt"`
+	ID              uuid.UUID  `json:"id"`
+	Name            string     `json:"name"`
+	TokenPrefix     string     `json:"tokenPrefix"`
+	EnvelopeVersion int        `json:"envelopeVersion"`
+	ExpiresAt       *time.Time `json:"expiresAt"`
+	LastUsedAt      *time.Time `json:"lastUsedAt"`
+	Scopes          []string   `json:"scopes"`
+	AllowedCIDRs    []string   `json:"allowedCidrs"`
+	ReplacedByID    *uuid.UUID `json:"replacedById"`
+	CreatedBy       uuid.UUID  `json:"createdBy"`
+	CreatorName     string     `json:"creatorName"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
+
+func toProjectTokenResponse(token *models.ProjectToken) ProjectTokenResponse {
+	creatorName := token.Creator.Name
+	if creatorName == "" {
+		creatorName = token.Creator.Email
+	}
+
+	return ProjectTokenResponse{
+		ID:              token.ID,
+		Name:            token.Name,
+		TokenPrefix:     token.TokenPrefix,
+		EnvelopeVersion: token.EnvelopeVersion,
+		ExpiresAt:       token.ExpiresAt,
+		LastUsedAt:      token.LastUsedAt,
+		Scopes:          token.Scopes,
+		AllowedCIDRs:    token.AllowedCIDRs,
+		ReplacedByID:    token.ReplacedByID,
+		CreatedBy:       token.CreatedBy,
+		CreatorName:     creatorName,
+		CreatedAt:       token.CreatedAt,
+	}
 }
 
 func CreateProjectToken(c *gin.Context) {
@@ -45,42 +81,91 @@ func CreateProjectToken(c *gin.Context) {
 		return
 	}
 
-	projectID, ok := ParseUUIDParam(c, "id", "project")
-	if !ok {
+	access := CurrentProjectAccess(c)
+
+	var req CreateProjectTokenRequest
+	if !BindJSON(c, &req) {
 		return
 	}
 
-	access, err := GetUserProjectAccess(uid, projectID)
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) || err.Error() == "access denied" || err.Error() == "project not found" {
-			RespondForbidden(c, "Project not found or access denied")
-		} else {
-			RespondInternalError(c, "Failed to check access")
-		}
+	token, ok := createProjectToken(c, uid, access, req, models.AuditTokenIssued)
+	if !ok {
 		return
 	}
 
-	if !access.CanEdit {
-		RespondForbidden(c, "Only admins and owners can create project tokens")
-		return
+	RespondCreated(c, CreateProjectTokenResponse{
+		ID:           token.ID,
+		Name:         token.Name,
+		TokenPrefix:  token.TokenPrefix,
+		ExpiresAt:    req.ExpiresAt.Time,
+		Scopes:       token.Scopes,
+		AllowedCIDRs: token.AllowedCIDRs,
+		CreatedAt:    token.CreatedAt,
+	})
+}
+
+// createProjectToken validates and stores a new project token, recording action in
+// the audit log. The caller must have verified edit access. If unsuccessful, it
+// sends an error response automatically.
+func createProjectToken(c *gin.Context, uid uuid.UUID, access *ProjectAccess, req CreateProjectTokenRequest, action string) (*models.ProjectToken, bool) {
+	projectID := access.Project.ID
+	if req.ExpiresAt.IsZero() {
+		RespondBadRequest(c, "expiresAt is required")
+		return nil, false
+	}
+	if req.ExpiresAt.Before(time.Now()) {
+		RespondBadRequest(c, "Expiration date must be in the future")
+		return nil, false
 	}
 
-	var req CreateProjectTokenRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	envelopeVersion := req.EnvelopeVersion
+	if envelopeVersion == 0 {
+		envelopeVersion = crypto.EnvelopeV1
+	}
+	if !crypto.IsSupportedEnvelopeVersion(envelopeVersion) {
+		RespondBadRequest(c, "Unsupported envelope version")
+		return nil, false
+	}
+	if crypto.EnvelopeVersion(req.EncryptedProjectKey) != envelopeVersion {
+		RespondBadRequest(c, "Encrypted project key does not match the envelope version")
+		return nil, false
+	}
+
+	allowedCIDRs, err := normalizeAllowedCIDRs(req.AllowedCIDRs)
+	if err != nil {
 		RespondBadRequest(c, err.Error())
-		return
+		return nil, false
 	}
 
-	if req.ExpiresAt.Before(time.Now()) {
-		RespondBadRequest(c, "Expiration date must be in the future")
-		return
+	scopes := NewPermissionSet(req.Scopes)
+	// A token can't read more than its creator
+	if scopes.Has(models.TokenScopeSecretsReveal) && !access.Can(models.PermissionSecretsReveal) {
+		RespondForbidden(c, "Only members with "+models.PermissionSecretsReveal+" can create tokens with that scope")
+		return nil, false
+	}
+	if scopes.Has(models.TokenScopeFilesWrite) && !access.Can(models.PermissionFilesWrite) {
+		RespondForbidden(c, "Only members with "+models.PermissionFilesWrite+" can create tokens with that scope")
+		return nil, false
+	}
+
+	// A rotated token replaces one that expires, so rotations don't count
+	// against the limit
+	if action == models.AuditTokenIssued {
+		if err := checkTokenLimit(requestDB(c), access.Project.OrganizationID, projectID); err != nil {
+			RespondAPIError(c, err, "Failed to check the token limit")
+			return nil, false
+		}
+	}
+
+	if !RequireTwoFactor(c, uid, TwoFactorActionCreateProjectToken) {
+		return nil, false
 	}
 
 	// Check for duplicate identity hash
 	var existing models.ProjectToken
-	if err := database.DB.Where("identity_id_hash = ?", req.IdentityIDHash).First(&existing).Error; err == nil {
+	if err := requestDB(c).Where("identity_id_hash = ?", req.IdentityIDHash).First(&existing).Error; err == nil {
 		RespondConflict(c, "Token already exists")
-		return
+		return nil, false
 	}
 
 	token := models.ProjectToken{
@@ -89,119 +174,531 @@ func CreateProjectToken(c *gin.Context) {
 		TokenPrefix:         req.TokenPrefix,
 		IdentityIDHash:      req.IdentityIDHash,
 		EncryptedProjectKey: req.EncryptedProjectKey,
-		ExpiresAt:           &req.ExpiresAt,
+		EnvelopeVersion:     envelopeVersion,
+		ExpiresAt:           req.ExpiresAt.Ptr(),
+		Scopes:              scopes.List(),
+		AllowedCIDRs:        allowedCIDRs,
 		CreatedBy:           uid,
 	}
 
-	if err := database.DB.Create(&token).Error; err != nil {
+	err = database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Create(&token).Error; err != nil {
+			return err
+		}
+		return recordAuditEvent(tx, access.Project.OrganizationID, &projectID, uid, action, token.Name, 0)
+	})
+	if err != nil {
 		RespondInternalError(c, "Failed to create token")
-		return
+		return nil, false
 	}
 
-	RespondCreated(c, CreateProjectTokenResponse{
-		ID:          token.ID,
-		Name:        token.Name,
-		TokenPrefix: token.TokenPrefix,
-		ExpiresAt:   req.ExpiresAt,
-		CreatedAt:   token.CreatedAt,
-	})
+	return &token, true
+}
+
+// normalizeAllowedCIDRs validates the allowed ranges of a token or organization
+// and stores them as masked CIDRs, a bare address becoming a range of one
+func normalizeAllowedCIDRs(values []string) ([]string, error) {
+	cidrs := []string{}
+	seen := map[string]bool{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		var prefix netip.Prefix
+		if strings.Contains(value, "/") {
+			parsed, err := netip.ParsePrefix(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR range %q", value)
+			}
+			prefix = parsed.Masked()
+		} else {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q", value)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		if !seen[prefix.String()] {
+			seen[prefix.String()] = true
+			cidrs = append(cidrs, prefix.String())
+		}
+	}
+	return cidrs, nil
 }
 
 func GetProjectTokens(c *gin.Context) {
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID
+
+	var tokens []models.ProjectToken
+	if err := requestDB(c).Preload("Creator").Where("project_id = ?", projectID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch tokens")
+		return
+	}
+
+	response := make([]ProjectTokenResponse, len(tokens))
+	for i := range tokens {
+		response[i] = toProjectTokenResponse(&tokens[i])
+	}
+
+	RespondOK(c, response)
+}
+
+func DeleteProjectToken(c *gin.Context) {
 	uid, ok := GetAuthUserID(c)
 	if !ok {
 		return
 	}
 
-	projectID, ok := ParseUUIDParam(c, "id", "project")
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID
+
+	tokenID, ok := ParseUUIDParam(c, "tokenId", "token")
 	if !ok {
 		return
 	}
 
-	access, err := GetUserProjectAccess(uid, projectID)
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) || err.Error() == "access denied" || err.Error() == "project not found" {
-			RespondForbidden(c, "Project not found or access denied")
+	var token models.ProjectToken
+	if err := requestDB(c).Where("id = ? AND project_id = ?", tokenID, projectID).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			RespondNotFound(c, "Token not found")
 		} else {
-			RespondInternalError(c, "Failed to check access")
+			RespondInternalError(c, "Failed to fetch token")
 		}
 		return
 	}
 
-	if !access.CanEdit {
-		RespondForbidden(c, "Only admins and owners can view project tokens")
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Delete(&token).Error; err != nil {
+			return err
+		}
+		return recordAuditEvent(tx, access.Project.OrganizationID, &projectID, uid, models.AuditTokenDeleted, token.Name, 0)
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to delete token")
 		return
 	}
 
-	var tokens []models.ProjectToken
-	if err := database.DB.Preload("Creator").Where("project_id = ?", projectID).Order("created_at DESC").Find(&tokens).Error; err != nil {
-		RespondInternalError(c, "Failed to fetch tokens")
-		return
+	RespondMessage(c, "Token deleted successfully")
+}
+
+const defaultTokenRotationGrace = 24 * time.Hour
+
+type RenewProjectTokenRequest struct {
+	ExpiresAt apitime.Time `json:"expiresAt"`
+}
+
+type SetTokenAllowedCIDRsRequest struct {
+	AllowedCIDRs []string `json:"allowedCidrs" binding:"max=50"` // empty allows any address
+}
+
+// RotateProjectTokenRequest carries the new token, generated by the client like
+// for CreateProjectToken. Name, scopes and expiry default to those of the rotated
+// token, the expiry to the same lifetime from now.
+type RotateProjectTokenRequest struct {
+	Name                string       `json:"name" binding:"omitempty,max=255,name"`
+	ExpiresAt           apitime.Time `json:"expiresAt"`
+	TokenPrefix         string       `json:"tokenPrefix" binding:"required,len=3"`
+	IdentityIDHash      string       `json:"identityIdHash" binding:"required,len=64,hexadecimal"`
+	EncryptedProjectKey string       `json:"encryptedProjectKey" binding:"required,ciphertext"`
+	EnvelopeVersion     int          `json:"envelopeVersion"`
+	Scopes              []string     `json:"scopes" binding:"omitempty,dive,oneof=secrets.reveal files.write"`
+	AllowedCIDRs        []string     `json:"allowedCidrs" binding:"max=50"`                    // the old token's when omitted
+	GraceMinutes        *int         `json:"graceMinutes" binding:"omitempty,min=0,max=43200"` // defaults to a day
+}
+
+type RotateProjectTokenResponse struct {
+	Token    CreateProjectTokenResponse `json:"token"`
+	Previous ProjectTokenResponse       `json:"previous"` // valid until its expiresAt
+}
+
+// requireProjectToken loads the token in the :tokenId param of the project
+// AuthorizeProject resolved. If unsuccessful, it sends an error response
+// automatically.
+func requireProjectToken(c *gin.Context) (uuid.UUID, *ProjectAccess, *models.ProjectToken, bool) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return uuid.Nil, nil, nil, false
 	}
 
-	response := make([]ProjectTokenResponse, len(tokens))
-	for i, token := range tokens {
-		creatorName := token.Creator.Name
-		if creatorName == "" {
-			creatorName = token.Creator.Email
+	tokenID, ok := ParseUUIDParam(c, "tokenId", "token")
+	if !ok {
+		return uuid.Nil, nil, nil, false
+	}
+
+	access := CurrentProjectAccess(c)
+	var token models.ProjectToken
+	if err := requestDB(c).Preload("Creator").Where("id = ? AND project_id = ?", tokenID, access.Project.ID).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			RespondNotFound(c, "Token not found")
+		} else {
+			RespondInternalError(c, "Failed to fetch token")
 		}
+		return uuid.Nil, nil, nil, false
+	}
 
-		response[i] = ProjectTokenResponse{
-			ID:          token.ID,
-			Name:        token.Name,
-			TokenPrefix: token.TokenPrefix,
-			ExpiresAt:   token.ExpiresAt,
-			LastUsedAt:  token.LastUsedAt,
-			CreatedBy:   token.CreatedBy,
-			CreatorName: creatorName,
-			CreatedAt:   token.CreatedAt,
+	return uid, access, &token, true
+}
+
+// RenewProjectToken moves a token's expiry later, also reviving an expired token
+func RenewProjectToken(c *gin.Context) {
+	uid, access, token, ok := requireProjectToken(c)
+	if !ok {
+		return
+	}
+
+	var req RenewProjectTokenRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+	if req.ExpiresAt.IsZero() {
+		RespondBadRequest(c, "expiresAt is required")
+		return
+	}
+	if !req.ExpiresAt.After(time.Now()) {
+		RespondBadRequest(c, "Expiration date must be in the future")
+		return
+	}
+	if token.ExpiresAt != nil && !req.ExpiresAt.After(*token.ExpiresAt) {
+		RespondBadRequest(c, "Expiration date must be later than the current one")
+		return
+	}
+	// Renewing a rotated token would undo the rotation
+	if token.ReplacedByID != nil {
+		RespondConflict(c, "Token was rotated, renew its replacement instead")
+		return
+	}
+
+	if !RequireTwoFactor(c, uid, TwoFactorActionRenewProjectToken) {
+		return
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Model(token).Update("expires_at", req.ExpiresAt.Ptr()).Error; err != nil {
+			return err
 		}
+		return recordAuditEvent(tx, access.Project.OrganizationID, &token.ProjectID, uid, models.AuditTokenRenewed, token.Name, 0)
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to renew token")
+		return
 	}
+	token.ExpiresAt = req.ExpiresAt.Ptr()
 
-	RespondOK(c, response)
+	RespondOK(c, toProjectTokenResponse(token))
 }
 
-func DeleteProjectToken(c *gin.Context) {
-	uid, ok := GetAuthUserID(c)
+// SetTokenAllowedCIDRs replaces the address ranges a token may be used from
+func SetTokenAllowedCIDRs(c *gin.Context) {
+	_, _, token, ok := requireProjectToken(c)
 	if !ok {
 		return
 	}
 
-	projectID, ok := ParseUUIDParam(c, "id", "project")
+	var req SetTokenAllowedCIDRsRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+	allowedCIDRs, err := normalizeAllowedCIDRs(req.AllowedCIDRs)
+	if err != nil {
+		RespondBadRequest(c, err.Error())
+		return
+	}
+
+	token.AllowedCIDRs = allowedCIDRs
+	if err := requestDB(c).Model(token).Select("allowed_cidrs").Updates(token).Error; err != nil {
+		RespondInternalError(c, "Failed to update token")
+		return
+	}
+
+	RespondOK(c, toProjectTokenResponse(token))
+}
+
+// RotateProjectToken stores a replacement for a token and shortens the old token's
+// expiry to the grace window, so pipelines can switch to the new one before the
+// old stops working
+func RotateProjectToken(c *gin.Context) {
+	uid, access, old, ok := requireProjectToken(c)
 	if !ok {
 		return
 	}
 
-	tokenID, ok := ParseUUIDParam(c, "tokenId", "token")
+	var req RotateProjectTokenRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+	if old.ReplacedByID != nil {
+		RespondConflict(c, "Token was already rotated")
+		return
+	}
+
+	grace := defaultTokenRotationGrace
+	if req.GraceMinutes != nil {
+		grace = time.Duration(*req.GraceMinutes) * time.Minute
+	}
+
+	create := CreateProjectTokenRequest{
+		Name:                req.Name,
+		ExpiresAt:           req.ExpiresAt,
+		TokenPrefix:         req.TokenPrefix,
+		IdentityIDHash:      req.IdentityIDHash,
+		EncryptedProjectKey: req.EncryptedProjectKey,
+		EnvelopeVersion:     req.EnvelopeVersion,
+		Scopes:              req.Scopes,
+		AllowedCIDRs:        req.AllowedCIDRs,
+	}
+	if create.Name == "" {
+		create.Name = old.Name
+	}
+	if create.Scopes == nil {
+		create.Scopes = old.Scopes
+	}
+	if create.AllowedCIDRs == nil {
+		create.AllowedCIDRs = old.AllowedCIDRs
+	}
+	if create.ExpiresAt.IsZero() && old.ExpiresAt != nil {
+		create.ExpiresAt = apitime.New(time.Now().Add(old.ExpiresAt.Sub(old.CreatedAt)))
+	}
+
+	token, ok := createProjectToken(c, uid, access, create, models.AuditTokenRotated)
 	if !ok {
 		return
 	}
 
-	access, err := GetUserProjectAccess(uid, projectID)
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) || err.Error() == "access denied" || err.Error() == "project not found" {
-			RespondForbidden(c, "Project not found or access denied")
+	graceEnd := rotationGraceEnd(old.ExpiresAt, time.Now(), grace)
+	result := requestDB(c).Model(old).Where("replaced_by_id IS NULL").Updates(map[string]any{"expires_at": graceEnd, "replaced_by_id": token.ID})
+	if result.Error != nil || result.RowsAffected == 0 {
+		// A concurrent rotation won, or the old token can't be retired: drop the new one
+		requestDB(c).Delete(token)
+		if result.Error != nil {
+			RespondInternalError(c, "Failed to expire the rotated token")
 		} else {
-			RespondInternalError(c, "Failed to check access")
+			RespondConflict(c, "Token was already rotated")
 		}
 		return
 	}
+	old.ExpiresAt = &graceEnd
+	old.ReplacedByID = &token.ID
+
+	RespondCreated(c, RotateProjectTokenResponse{
+		Token: CreateProjectTokenResponse{
+			ID:           token.ID,
+			Name:         token.Name,
+			TokenPrefix:  token.TokenPrefix,
+			ExpiresAt:    *token.ExpiresAt,
+			Scopes:       token.Scopes,
+			AllowedCIDRs: token.AllowedCIDRs,
+			CreatedAt:    token.CreatedAt,
+		},
+		Previous: toProjectTokenResponse(old),
+	})
+}
+
+// rotationGraceEnd is when a rotated token stops working: after the grace window,
+// or at its own expiry if that comes first
+func rotationGraceEnd(expiresAt *time.Time, now time.Time, grace time.Duration) time.Time {
+	end := now.Add(grace)
+	if expiresAt != nil && expiresAt.Before(end) {
+		return *expiresAt
+	}
+	return end
+}
+
+// ExpiredToken is a token removed, or to be removed, by an expired token purge
+type ExpiredToken struct {
+	ID          uuid.UUID  `json:"id"`
+	ProjectID   uuid.UUID  `json:"projectId"`
+	Name        string     `json:"name"`
+	TokenPrefix string     `json:"tokenPrefix"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	LastUsedAt  *time.Time `json:"lastUsedAt"`
+	CreatedBy   uuid.UUID  `json:"createdBy"`
+}
 
-	if !access.CanEdit {
-		RespondForbidden(c, "Only admins and owners can delete project tokens")
+type ExpiredTokenPurgeResponse struct {
+	Deleted int            `json:"deleted"`
+	Tokens  []ExpiredToken `json:"tokens"`
+}
+
+// ExpiredTokenProject groups the expired tokens of one project in the org report
+type ExpiredTokenProject struct {
+	ProjectID   uuid.UUID      `json:"projectId"`
+	ProjectName string         `json:"projectName"`
+	Tokens      []ExpiredToken `json:"tokens"`
+}
+
+// ExpiredTokenReport lists the expired tokens of an organization. Purged is false
+// for the report GET returns and true once DELETE removed them.
+type ExpiredTokenReport struct {
+	Purged   bool                  `json:"purged"`
+	Total    int                   `json:"total"`
+	Projects []ExpiredTokenProject `json:"projects"`
+}
+
+// DeleteProjectTokens removes the project's expired tokens. expiredOnly=true is
+// required so a missing parameter can't revoke every CI pipeline at once.
+func DeleteProjectTokens(c *gin.Context) {
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID
+
+	if c.Query("expiredOnly") != "true" {
+		RespondBadRequest(c, "Only expired tokens can be deleted in bulk, pass expiredOnly=true")
 		return
 	}
 
-	result := database.DB.Where("id = ? AND project_id = ?", tokenID, projectID).Delete(&models.ProjectToken{})
-	if result.Error != nil {
-		RespondInternalError(c, "Failed to delete token")
+	tokens, err := purgeExpiredTokens(requestDB(c), requestDB(c).Where("project_id = ?", projectID), time.Now())
+	if err != nil {
+		RespondInternalError(c, "Failed to delete expired tokens")
 		return
 	}
 
-	if result.RowsAffected == 0 {
-		RespondNotFound(c, "Token not found")
+	RespondOK(c, ExpiredTokenPurgeResponse{Deleted: len(tokens), Tokens: tokens})
+}
+
+// GetExpiredTokenReport lists the expired tokens across the organization's projects
+func GetExpiredTokenReport(c *gin.Context) {
+	orgID, ok := requireExpiredTokenAdmin(c)
+	if !ok {
 		return
 	}
 
-	RespondMessage(c, "Token deleted successfully")
+	tokens, err := findExpiredTokens(orgExpiredTokens(requestDB(c), orgID), time.Now())
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch expired tokens")
+		return
+	}
+
+	report, err := buildExpiredTokenReport(requestDB(c), tokens)
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch expired tokens")
+		return
+	}
+	RespondOK(c, report)
+}
+
+// PurgeExpiredTokens removes the expired tokens across the organization's
+// projects and reports what was removed
+func PurgeExpiredTokens(c *gin.Context) {
+	orgID, ok := requireExpiredTokenAdmin(c)
+	if !ok {
+		return
+	}
+
+	tokens, err := purgeExpiredTokens(requestDB(c), orgExpiredTokens(requestDB(c), orgID), time.Now())
+	if err != nil {
+		RespondInternalError(c, "Failed to delete expired tokens")
+		return
+	}
+
+	report, err := buildExpiredTokenReport(requestDB(c), tokens)
+	if err != nil {
+		RespondInternalError(c, "Failed to build the purge report")
+		return
+	}
+	report.Purged = true
+	RespondOK(c, report)
+}
+
+func requireExpiredTokenAdmin(c *gin.Context) (uuid.UUID, bool) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return uuid.Nil, false
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return uuid.Nil, false
+	}
+
+	if _, _, ok := RequireOrgPermission(c, uid, orgID, models.PermissionTokenManage); !ok {
+		return uuid.Nil, false
+	}
+	return orgID, true
+}
+
+// orgExpiredTokens scopes a token query to the live projects of an organization
+func orgExpiredTokens(db *gorm.DB, orgID uuid.UUID) *gorm.DB {
+	return db.Where("project_id IN (?)", db.Model(&models.Project{}).Select("id").Where("organization_id = ?", orgID))
+}
+
+// findExpiredTokens returns the tokens matched by scope that expired by now
+func findExpiredTokens(scope *gorm.DB, now time.Time) ([]ExpiredToken, error) {
+	var tokens []models.ProjectToken
+	err := scope.Model(&models.ProjectToken{}).
+		Where("expires_at IS NOT NULL AND expires_at <= ?", now).
+		Order("expires_at").
+		Find(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+
+	expired := make([]ExpiredToken, len(tokens))
+	for i, token := range tokens {
+		expired[i] = ExpiredToken{
+			ID:          token.ID,
+			ProjectID:   token.ProjectID,
+			Name:        token.Name,
+			TokenPrefix: token.TokenPrefix,
+			ExpiresAt:   *token.ExpiresAt,
+			LastUsedAt:  token.LastUsedAt,
+			CreatedBy:   token.CreatedBy,
+		}
+	}
+	return expired, nil
+}
+
+// purgeExpiredTokens deletes the tokens matched by scope that expired by now and
+// returns them
+func purgeExpiredTokens(db, scope *gorm.DB, now time.Time) ([]ExpiredToken, error) {
+	tokens, err := findExpiredTokens(scope, now)
+	if err != nil || len(tokens) == 0 {
+		return tokens, err
+	}
+
+	ids := make([]uuid.UUID, len(tokens))
+	for i, token := range tokens {
+		ids[i] = token.ID
+	}
+	// The expiry is checked again so a token renewed in the meantime survives
+	if err := db.Where("id IN ? AND expires_at <= ?", ids, now).Delete(&models.ProjectToken{}).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func buildExpiredTokenReport(db *gorm.DB, tokens []ExpiredToken) (ExpiredTokenReport, error) {
+	projectIDs := make([]uuid.UUID, 0, len(tokens))
+	for _, token := range tokens {
+		projectIDs = append(projectIDs, token.ProjectID)
+	}
+
+	names := make(map[uuid.UUID]string)
+	if len(projectIDs) > 0 {
+		var projects []models.Project
+		if err := db.Select("id", "name").Where("id IN ?", projectIDs).Find(&projects).Error; err != nil {
+			return ExpiredTokenReport{}, err
+		}
+		for _, project := range projects {
+			names[project.ID] = project.Name
+		}
+	}
+
+	return groupExpiredTokens(tokens, names), nil
+}
+
+// groupExpiredTokens groups tokens by project, in the order projects first appear
+func groupExpiredTokens(tokens []ExpiredToken, projectNames map[uuid.UUID]string) ExpiredTokenReport {
+	report := ExpiredTokenReport{Total: len(tokens), Projects: []ExpiredTokenProject{}}
+	index := make(map[uuid.UUID]int)
+	for _, token := range tokens {
+		i, ok := index[token.ProjectID]
+		if !ok {
+			i = len(report.Projects)
+			index[token.ProjectID] = i
+			report.Projects = append(report.Projects, ExpiredTokenProject{
+				ProjectID:   token.ProjectID,
+				ProjectName: projectNames[token.ProjectID],
+			})
+		}
+		report.Projects[i].Tokens = append(report.Projects[i].Tokens, token)
+	}
+	return report
 }
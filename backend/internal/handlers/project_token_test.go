@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"envie-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestGroupExpiredTokens(t *testing.T) {
+	api, worker := uuid.New(), uuid.New()
+	expired := time.Now().Add(-time.Hour)
+	tokens := []ExpiredToken{
+		{ID: uuid.New(), ProjectID: api, Name: "ci-1", ExpiresAt: expired},
+		{ID: uuid.New(), ProjectID: worker, Name: "ci-2", ExpiresAt: expired},
+		{ID: uuid.New(), ProjectID: api, Name: "ci-3", ExpiresAt: expired},
+	}
+
+	report := groupExpiredTokens(tokens, map[uuid.UUID]string{api: "api", worker: "worker"})
+	if report.Total != 3 || len(report.Projects) != 2 {
+		t.Fatalf("report = %+v, want 3 tokens in 2 projects", report)
+	}
+	if p := report.Projects[0]; p.ProjectName != "api" || len(p.Tokens) != 2 || p.Tokens[1].Name != "ci-3" {
+		t.Errorf("first project = %+v", p)
+	}
+	if p := report.Projects[1]; p.ProjectName != "worker" || len(p.Tokens) != 1 {
+		t.Errorf("second project = %+v", p)
+	}
+
+	if empty := groupExpiredTokens(nil, nil); empty.Projects == nil || empty.Total != 0 {
+		t.Errorf("empty report = %+v, want no projects", empty)
+	}
+}
+
+func TestRotationGraceEnd(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	later := now.Add(7 * 24 * time.Hour)
+	soon := now.Add(time.Hour)
+
+	if got := rotationGraceEnd(&later, now, 24*time.Hour); !got.Equal(now.Add(24 * time.Hour)) {
+		t.Errorf("grace end = %v, want a day from now", got)
+	}
+	if got := rotationGraceEnd(&soon, now, 24*time.Hour); !got.Equal(soon) {
+		t.Errorf("grace end = %v, want the token's own earlier expiry", got)
+	}
+	if got := rotationGraceEnd(nil, now, 0); !got.Equal(now) {
+		t.Errorf("grace end = %v, want now for no grace", got)
+	}
+}
+
+func TestNormalizeAllowedCIDRs(t *testing.T) {
+	got, err := normalizeAllowedCIDRs([]string{" 10.1.2.3/16", "192.0.2.7", "2001:db8::1/32", "10.1.0.0/16", "::ffff:198.51.100.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"10.1.0.0/16", "192.0.2.7/32", "2001:db8::/32", "198.51.100.1/32"}
+	if !slices.Equal(got, want) {
+		t.Errorf("cidrs = %v, want %v", got, want)
+	}
+
+	for _, invalid := range []string{"10.0.0.0/33", "example.com", ""} {
+		if _, err := normalizeAllowedCIDRs([]string{invalid}); err == nil {
+			t.Errorf("%q accepted", invalid)
+		}
+	}
+}
+
+func TestTokenAllowsAddress(t *testing.T) {
+	token := models.ProjectToken{}
+	if !token.AllowsAddress("203.0.113.9") {
+		t.Error("token without ranges rejected an address")
+	}
+
+	token.AllowedCIDRs = []string{"10.1.0.0/16", "2001:db8::/32"}
+	for ip, want := range map[string]bool{
+		"10.1.200.3":      true,
+		"::ffff:10.1.0.1": true,
+		"2001:db8:5::1":   true,
+		"10.2.0.1":        false,
+		"2001:db9::1":     false,
+		"not an address":  false,
+		"":                false,
+	} {
+		if got := token.AllowsAddress(ip); got != want {
+			t.Errorf("AllowsAddress(%q) = %v, want %v", ip, got, want)
+		}
+	}
+}
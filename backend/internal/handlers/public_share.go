@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"envie-backend/internal/apitime"
+	"envie-backend/internal/auth"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	maxPublicShareItems       = 200
+	maxPublicShareValueBytes  = 64 * 1024
+	maxPublicSharesPerProject = 20
+)
+
+// PublicShareItem is the plaintext of one non-sensitive config item
+type PublicShareItem struct {
+	Name  string `json:"name" binding:"required"`
+	Value string `json:"value"`
+}
+
+// publicShareEntry is how an item is stored in PublicShare.Items
+type publicShareEntry struct {
+	Name       string `json:"name"`
+	Value      string `json:"value"`
+	SourceHash string `json:"sourceHash"`
+}
+
+type CreatePublicShareRequest struct {
+	Name      string            `json:"name" binding:"required,max=100,name"`
+	Items     []PublicShareItem `json:"items" binding:"required,min=1"`
+	ExpiresAt *apitime.Time     `json:"expiresAt"`
+}
+
+// UpdatePublicShareRequest replaces the published items when Items is set, e.g.
+// after their values changed
+type UpdatePublicShareRequest struct {
+	Name      string             `json:"name" binding:"omitempty,max=100,name"`
+	Items     *[]PublicShareItem `json:"items"`
+	ExpiresAt *apitime.Time      `json:"expiresAt"`
+}
+
+// PublicShareResponse describes a share to project members. Values are not
+// returned; the app shows them from the decrypted config.
+type PublicShareResponse struct {
+	ID             uuid.UUID  `json:"id"`
+	ProjectID      uuid.UUID  `json:"projectId"`
+	Name           string     `json:"name"`
+	ItemNames      []string   `json:"itemNames"`
+	URL            string     `json:"url"` // path of the signed URL, relative to the API base URL
+	ExpiresAt      *time.Time `json:"expiresAt"`
+	LastAccessedAt *time.Time `json:"lastAccessedAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+// PublicShareContent is served at the signed URL. Items whose config value
+// changed, was deleted or marked sensitive since publishing are left out and
+// named in StaleItems.
+type PublicShareContent struct {
+	Name       string            `json:"name"`
+	Items      []PublicShareItem `json:"items"`
+	StaleItems []string          `json:"staleItems"`
+	UpdatedAt  time.Time         `json:"updatedAt"`
+}
+
+func hashEncryptedValue(value string) string {
+	hash := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(hash[:])
+}
+
+// publicShareURL is the signed path of a share; it stays valid until the share
+// expires or is deleted
+func publicShareURL(share *models.PublicShare) string {
+	var expires int64
+	if share.ExpiresAt != nil {
+		expires = share.ExpiresAt.Unix()
+	}
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", auth.SignPublicShare(share.ID, expires))
+	return "/v1/public/shares/" + share.ID.String() + "?" + query.Encode()
+}
+
+func toPublicShareResponse(share *models.PublicShare) PublicShareResponse {
+	var entries []publicShareEntry
+	json.Unmarshal([]byte(share.Items), &entries)
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name
+	}
+	return PublicShareResponse{
+		ID:             share.ID,
+		ProjectID:      share.ProjectID,
+		Name:           share.Name,
+		ItemNames:      names,
+		URL:            publicShareURL(share),
+		ExpiresAt:      share.ExpiresAt,
+		LastAccessedAt: share.LastAccessedAt,
+		CreatedAt:      share.CreatedAt,
+		UpdatedAt:      share.UpdatedAt,
+	}
+}
+
+// buildPublicShareItems checks every item is a non-sensitive config item of the
+// project and records the encrypted value it was published from
+func buildPublicShareItems(c *gin.Context, projectID uuid.UUID, items []PublicShareItem) (string, error) {
+	if len(items) > maxPublicShareItems {
+		return "", &ValidationError{fmt.Sprintf("A share can contain at most %d items", maxPublicShareItems)}
+	}
+
+	var configItems []models.ConfigItem
+	if err := requestDB(c).Where("project_id = ?", projectID).Find(&configItems).Error; err != nil {
+		return "", err
+	}
+	byName := make(map[string]models.ConfigItem, len(configItems))
+	for _, item := range configItems {
+		byName[item.Name] = item
+	}
+
+	seen := make(map[string]bool)
+	entries := make([]publicShareEntry, 0, len(items))
+	for _, item := range items {
+		if seen[item.Name] {
+			return "", &ValidationError{"Duplicate item: " + item.Name}
+		}
+		seen[item.Name] = true
+
+		configItem, ok := byName[item.Name]
+		if !ok {
+			return "", &ValidationError{"Unknown config item: " + item.Name}
+		}
+		if configItem.Sensitive {
+			return "", &ValidationError{"Sensitive config items can't be shared: " + item.Name}
+		}
+		if len(item.Value) > maxPublicShareValueBytes {
+			return "", &ValidationError{"Value too large: " + item.Name}
+		}
+		entries = append(entries, publicShareEntry{
+			Name:       item.Name,
+			Value:      item.Value,
+			SourceHash: hashEncryptedValue(configItem.Value),
+		})
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func requirePublicShare(c *gin.Context, projectID uuid.UUID) (*models.PublicShare, bool) {
+	shareID, ok := ParseUUIDParam(c, "shareId", "share")
+	if !ok {
+		return nil, false
+	}
+
+	var share models.PublicShare
+	if err := requestDB(c).Where("id = ? AND project_id = ?", shareID, projectID).First(&share).Error; err != nil {
+		RespondNotFound(c, "Share not found")
+		return nil, false
+	}
+	return &share, true
+}
+
+func GetPublicShares(c *gin.Context) {
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	var shares []models.PublicShare
+	if err := requestDB(c).Where("project_id = ?", projectID).Order("created_at asc").Find(&shares).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch public shares")
+		return
+	}
+
+	response := make([]PublicShareResponse, len(shares))
+	for i := range shares {
+		response[i] = toPublicShareResponse(&shares[i])
+	}
+	RespondOK(c, response)
+}
+
+func CreatePublicShare(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	var req CreatePublicShareRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		RespondBadRequest(c, "expiresAt must be in the future")
+		return
+	}
+
+	var count int64
+	if err := requestDB(c).Model(&models.PublicShare{}).Where("project_id = ?", projectID).Count(&count).Error; err != nil {
+		RespondInternalError(c, "Failed to create public share")
+		return
+	}
+	if count >= maxPublicSharesPerProject {
+		RespondConflict(c, "Project already has the maximum number of public shares")
+		return
+	}
+
+	items, err := buildPublicShareItems(c, projectID, req.Items)
+	if err != nil {
+		if _, ok := err.(*ValidationError); ok {
+			RespondBadRequest(c, err.Error())
+			return
+		}
+		RespondInternalError(c, "Failed to create public share")
+		return
+	}
+
+	share := models.PublicShare{
+		ProjectID:   projectID,
+		Name:        req.Name,
+		Items:       items,
+		ExpiresAt:   req.ExpiresAt.Ptr(),
+		CreatedByID: uid,
+		UpdatedByID: uid,
+	}
+	if err := requestDB(c).Create(&share).Error; err != nil {
+		RespondInternalError(c, "Failed to create public share")
+		return
+	}
+
+	RespondCreated(c, toPublicShareResponse(&share))
+}
+
+func UpdatePublicShare(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	share, ok := requirePublicShare(c, projectID)
+	if !ok {
+		return
+	}
+
+	var req UpdatePublicShareRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	if req.Name != "" {
+		share.Name = req.Name
+	}
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			RespondBadRequest(c, "expiresAt must be in the future")
+			return
+		}
+		share.ExpiresAt = req.ExpiresAt.Ptr()
+	}
+	if req.Items != nil {
+		if len(*req.Items) == 0 {
+			RespondBadRequest(c, "A share needs at least one item")
+			return
+		}
+		items, err := buildPublicShareItems(c, projectID, *req.Items)
+		if err != nil {
+			if _, ok := err.(*ValidationError); ok {
+				RespondBadRequest(c, err.Error())
+				return
+			}
+			RespondInternalError(c, "Failed to update public share")
+			return
+		}
+		share.Items = items
+	}
+	share.UpdatedByID = uid
+
+	if err := requestDB(c).Save(share).Error; err != nil {
+		RespondInternalError(c, "Failed to update public share")
+		return
+	}
+
+	RespondOK(c, toPublicShareResponse(share))
+}
+
+func DeletePublicShare(c *gin.Context) {
+	projectID := CurrentProjectAccess(c).Project.ID
+
+	share, ok := requirePublicShare(c, projectID)
+	if !ok {
+		return
+	}
+
+	if err := requestDB(c).Delete(share).Error; err != nil {
+		RespondInternalError(c, "Failed to delete public share")
+		return
+	}
+
+	RespondMessage(c, "Public share deleted")
+}
+
+// GetPublicShareContent serves a share at its signed URL without authentication.
+// Add ?format=env for a dotenv file.
+func GetPublicShareContent(c *gin.Context) {
+	shareID, err := uuid.Parse(c.Param("shareId"))
+	expires, expiresErr := strconv.ParseInt(c.Query("expires"), 10, 64)
+	// Unknown shares and bad signatures look the same
+	if err != nil || expiresErr != nil || !auth.VerifyPublicShare(shareID, expires, c.Query("signature")) {
+		RespondNotFound(c, "Share not found")
+		return
+	}
+
+	var share models.PublicShare
+	if err := requestDB(c).Where("id = ?", shareID).First(&share).Error; err != nil {
+		RespondNotFound(c, "Share not found")
+		return
+	}
+	// A URL signed for an earlier expiry stops working when the expiry changes
+	var shareExpires int64
+	if share.ExpiresAt != nil {
+		shareExpires = share.ExpiresAt.Unix()
+	}
+	if expires != shareExpires {
+		RespondNotFound(c, "Share not found")
+		return
+	}
+	if share.IsExpired() {
+		RespondError(c, http.StatusGone, "Share has expired")
+		return
+	}
+
+	var entries []publicShareEntry
+	if err := json.Unmarshal([]byte(share.Items), &entries); err != nil {
+		RespondInternalError(c, "Failed to read public share")
+		return
+	}
+
+	var configItems []models.ConfigItem
+	if err := requestDB(c).Select("name", "value", "sensitive").Where("project_id = ?", share.ProjectID).Find(&configItems).Error; err != nil {
+		RespondInternalError(c, "Failed to read public share")
+		return
+	}
+	current := make(map[string]models.ConfigItem, len(configItems))
+	for _, item := range configItems {
+		current[item.Name] = item
+	}
+
+	content := PublicShareContent{Name: share.Name, Items: []PublicShareItem{}, StaleItems: []string{}, UpdatedAt: share.UpdatedAt}
+	for _, entry := range entries {
+		item, ok := current[entry.Name]
+		if !ok || item.Sensitive || hashEncryptedValue(item.Value) != entry.SourceHash {
+			content.StaleItems = append(content.StaleItems, entry.Name)
+			continue
+		}
+		content.Items = append(content.Items, PublicShareItem{Name: entry.Name, Value: entry.Value})
+	}
+
+	now := time.Now()
+	requestDB(c).Model(&share).UpdateColumn("last_accessed_at", now)
+
+	if c.Query("format") == "env" {
+		if len(content.StaleItems) > 0 {
+			c.Header("X-Envie-Stale-Items", strings.Join(content.StaleItems, ","))
+		}
+		c.String(http.StatusOK, formatDotenv(content.Items))
+		return
+	}
+	RespondOK(c, content)
+}
+
+// formatDotenv renders items as NAME=value lines, quoting values that need it
+func formatDotenv(items []PublicShareItem) string {
+	var b strings.Builder
+	for _, item := range items {
+		value := item.Value
+		if strings.ContainsAny(value, " \t\r\n\"'#$\\=") {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(item.Name + "=" + value + "\n")
+	}
+	return b.String()
+}
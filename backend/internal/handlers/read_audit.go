@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/middleware"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ReadAuditSettings - how long file download and config read events are kept
+type ReadAuditSettings struct {
+	RetentionDays int `json:"retentionDays" binding:"required,min=1,max=3650"`
+}
+
+// recordRead stores a read event. The read is served even if that fails; the
+// failure is logged and the access log still has the request.
+func recordRead(db *gorm.DB, event *models.AuditEvent, clientIP string) {
+	if clientIP != "" {
+		event.ClientIP = &clientIP
+	}
+	if err := db.Create(event).Error; err != nil {
+		log.Printf("Failed to record %s audit event: %v", event.Action, err)
+	}
+}
+
+// recordFileDownload records a member, or the creator of tokenID, downloading
+// a file
+func recordFileDownload(c *gin.Context, orgID uuid.UUID, file *models.ProjectFile, actorID uuid.UUID, tokenID *uuid.UUID) {
+	recordRead(requestDB(c), &models.AuditEvent{
+		OrganizationID: orgID,
+		ProjectID:      &file.ProjectID,
+		ActorID:        actorID,
+		TokenID:        tokenID,
+		Action:         models.AuditFileDownloaded,
+		Detail:         filePath(file.Folder, file.Name),
+		Count:          1,
+	}, middleware.ClientIP(c))
+}
+
+// RecordCLIConfigRead records a CLI token fetching its project's config of
+// items values, over REST or gRPC. The token's creator is the actor.
+func RecordCLIConfigRead(db *gorm.DB, token *models.ProjectToken, clientIP string, items int) {
+	var project models.Project
+	if err := db.Select("id, organization_id").First(&project, "id = ?", token.ProjectID).Error; err != nil {
+		log.Printf("Failed to record %s audit event: %v", models.AuditConfigRead, err)
+		return
+	}
+	recordRead(db, &models.AuditEvent{
+		OrganizationID: project.OrganizationID,
+		ProjectID:      &project.ID,
+		ActorID:        token.CreatedBy,
+		TokenID:        &token.ID,
+		Action:         models.AuditConfigRead,
+		Detail:         token.Name,
+		Count:          items,
+	}, clientIP)
+}
+
+// GetReadEvents lists who downloaded files and fetched config through the CLI,
+// newest first. projectId, actorId, tokenId and action (file_downloaded or
+// config_read) narrow it down.
+func GetReadEvents(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	page, ok := RequestedPage(c)
+	if !ok {
+		return
+	}
+
+	actions := models.AuditReadActions
+	if value := c.Query("action"); value != "" {
+		if !slices.Contains(models.AuditReadActions, value) {
+			RespondBadRequest(c, "Unknown action: "+value+". Must be one of "+strings.Join(models.AuditReadActions, ", "))
+			return
+		}
+		actions = []string{value}
+	}
+
+	query := requestDB(c).Where("organization_id = ? AND action IN ?", orgID, actions)
+	for _, filter := range []struct{ param, column string }{{"projectId", "project_id"}, {"actorId", "actor_id"}, {"tokenId", "token_id"}} {
+		value := c.Query(filter.param)
+		if value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			RespondBadRequest(c, "Invalid "+filter.param)
+			return
+		}
+		query = query.Where(filter.column+" = ?", id)
+	}
+
+	var events []models.AuditEvent
+	if err := page.Apply(query, "audit_events").Find(&events).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch read events")
+		return
+	}
+
+	var response AuditEventPage
+	response.Items, response.NextCursor = pageItems(page, events, func(e *models.AuditEvent) (time.Time, uuid.UUID) {
+		return e.CreatedAt, e.ID
+	})
+	RespondOK(c, response)
+}
+
+func GetReadAuditSettings(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	var org models.Organization
+	if err := requestDB(c).Select("id, read_audit_retention_days").First(&org, "id = ?", orgID).Error; err != nil {
+		RespondNotFound(c, "Organization not found")
+		return
+	}
+
+	RespondOK(c, ReadAuditSettings{RetentionDays: org.ReadAuditRetentionDays})
+}
+
+// UpdateReadAuditSettings changes the retention of read events. Shortening it
+// drops events at the next prune, so the change is itself audited.
+func UpdateReadAuditSettings(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	var req ReadAuditSettings
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Organization{}).Where("id = ?", orgID).Update("read_audit_retention_days", req.RetentionDays).Error; err != nil {
+			return err
+		}
+		return recordAuditEvent(tx, orgID, nil, uid, models.AuditReadRetention, fmt.Sprintf("%d days", req.RetentionDays), 0)
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to update read audit settings")
+		return
+	}
+
+	RespondOK(c, req)
+}
+
+// StartReadEventPrune deletes read events past their organization's retention
+// each interval in the background
+func StartReadEventPrune(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := pruneReadEvents(database.DB, time.Now()); err != nil {
+				log.Printf("Failed to prune read events: %v", err)
+			} else if n > 0 {
+				log.Printf("Pruned %d read events", n)
+			}
+		}
+	}()
+}
+
+// pruneReadEvents deletes once per retention in use rather than joining
+// organizations, which SQLite can't do in a DELETE
+func pruneReadEvents(db *gorm.DB, now time.Time) (int64, error) {
+	var retentions []int
+	if err := db.Model(&models.Organization{}).Unscoped().Distinct("read_audit_retention_days").Pluck("read_audit_retention_days", &retentions).Error; err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	for _, days := range retentions {
+		orgs := db.Model(&models.Organization{}).Unscoped().Select("id").Where("read_audit_retention_days = ?", days)
+		result := db.Where("organization_id IN (?) AND action IN ? AND created_at < ?", orgs, models.AuditReadActions, now.AddDate(0, 0, -days)).
+			Delete(&models.AuditEvent{})
+		if result.Error != nil {
+			return deleted, result.Error
+		}
+		deleted += result.RowsAffected
+	}
+	return deleted, nil
+}
@@ -0,0 +1,764 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// recoveryRequestTTL is how long officers have to release their shares
+const recoveryRequestTTL = 72 * time.Hour
+
+type RecoveryShareInput struct {
+	OfficerID      uuid.UUID `json:"officerId" binding:"required"`
+	ShareIndex     int       `json:"shareIndex" binding:"required,min=1,max=255"`
+	EncryptedShare string    `json:"encryptedShare" binding:"required,ciphertext"` // encrypted with the officer's public key
+}
+
+type PutRecoveryEscrowRequest struct {
+	Threshold int                  `json:"threshold" binding:"required,min=2"`
+	Shares    []RecoveryShareInput `json:"shares" binding:"required,min=2,max=16,dive"`
+}
+
+type RecoveryOfficer struct {
+	UserID     uuid.UUID `json:"userId"`
+	Name       string    `json:"name"`
+	Email      string    `json:"email"`
+	ShareIndex int       `json:"shareIndex"`
+}
+
+// RecoveryEscrowResponse - the escrow and its officers, without their shares
+type RecoveryEscrowResponse struct {
+	ID        uuid.UUID         `json:"id"`
+	Threshold int               `json:"threshold"`
+	Officers  []RecoveryOfficer `json:"officers"`
+	CreatedBy uuid.UUID         `json:"createdBy"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+type CreateRecoveryRequestRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+type ReleaseRecoveryShareRequest struct {
+	EncryptedShare string `json:"encryptedShare" binding:"required,ciphertext"` // encrypted with the requester's public key
+}
+
+type CompleteRecoveryRequest struct {
+	EncryptedOrganizationKey string `json:"encryptedOrganizationKey" binding:"required,ciphertext"` // encrypted with the requester's public key
+}
+
+// RecoveryRequestResponse - a recovery request and how far its quorum is
+type RecoveryRequestResponse struct {
+	models.RecoveryRequest
+	RequesterName  string `json:"requesterName"`
+	RequesterEmail string `json:"requesterEmail"`
+	Threshold      int    `json:"threshold"`
+	Released       int    `json:"released"`
+	ReleasedByMe   bool   `json:"releasedByMe"`
+}
+
+// ReleasedShare - a share released to the requester
+type ReleasedShare struct {
+	ShareIndex     int    `json:"shareIndex"`
+	EncryptedShare string `json:"encryptedShare"`
+}
+
+type RecoverySharesResponse struct {
+	Threshold int             `json:"threshold"`
+	Shares    []ReleasedShare `json:"shares"`
+}
+
+// RecoveryEventPage - a page of the organization's recovery audit trail, newest
+// first
+type RecoveryEventPage struct {
+	Items      []models.RecoveryEvent `json:"items"`
+	NextCursor string                 `json:"nextCursor,omitempty"`
+}
+
+func recordRecoveryEvent(db *gorm.DB, orgID uuid.UUID, requestID *uuid.UUID, actorID uuid.UUID, action, detail string) error {
+	return db.Create(&models.RecoveryEvent{
+		OrganizationID: orgID,
+		RequestID:      requestID,
+		ActorID:        actorID,
+		Action:         action,
+		Detail:         detail,
+	}).Error
+}
+
+// expireRecoveryRequests marks the organization's open requests past their
+// deadline as expired
+func expireRecoveryRequests(db *gorm.DB, orgID uuid.UUID, now time.Time) error {
+	return db.Model(&models.RecoveryRequest{}).
+		Where("organization_id = ? AND status IN ? AND expires_at < ?", orgID, []string{models.RecoveryPending, models.RecoveryApproved}, now).
+		Update("status", models.RecoveryExpired).Error
+}
+
+// requireRecoveryRequest loads the request named by the requestId parameter,
+// expiring it first if its deadline passed
+func requireRecoveryRequest(c *gin.Context, orgID uuid.UUID) (*models.RecoveryRequest, bool) {
+	requestID, ok := ParseUUIDParam(c, "requestId", "recovery request")
+	if !ok {
+		return nil, false
+	}
+
+	if err := expireRecoveryRequests(requestDB(c), orgID, time.Now()); err != nil {
+		RespondInternalError(c, "Failed to fetch recovery request")
+		return nil, false
+	}
+
+	var request models.RecoveryRequest
+	if err := requestDB(c).Where("id = ? AND organization_id = ?", requestID, orgID).First(&request).Error; err != nil {
+		RespondNotFound(c, "Recovery request not found")
+		return nil, false
+	}
+	return &request, true
+}
+
+func GetRecoveryEscrow(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgMembership(c, uid, orgID); !ok {
+		return
+	}
+
+	var escrow models.RecoveryEscrow
+	if err := requestDB(c).Where("organization_id = ?", orgID).First(&escrow).Error; err != nil {
+		RespondNotFound(c, "No recovery escrow configured")
+		return
+	}
+
+	response := RecoveryEscrowResponse{
+		ID:        escrow.ID,
+		Threshold: escrow.Threshold,
+		Officers:  []RecoveryOfficer{},
+		CreatedBy: escrow.CreatedBy,
+		CreatedAt: escrow.CreatedAt,
+	}
+	if err := requestDB(c).Table("recovery_shares").
+		Select("users.id AS user_id, users.name, users.email, recovery_shares.share_index").
+		Joins("JOIN users ON users.id = recovery_shares.officer_id").
+		Where("recovery_shares.escrow_id = ?", escrow.ID).
+		Order("recovery_shares.share_index").Scan(&response.Officers).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch recovery officers")
+		return
+	}
+
+	RespondOK(c, response)
+}
+
+// PutRecoveryEscrow replaces the organization's escrow with shares a client
+// split from the organization key. Open recovery requests of the previous
+// escrow are dropped, their shares can't be combined with the new ones.
+func PutRecoveryEscrow(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	var req PutRecoveryEscrowRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	if req.Threshold > len(req.Shares) {
+		RespondBadRequest(c, "threshold can't exceed the number of shares")
+		return
+	}
+
+	officerIDs := make([]uuid.UUID, len(req.Shares))
+	officers, indexes := map[uuid.UUID]bool{}, map[int]bool{}
+	for i, share := range req.Shares {
+		if officers[share.OfficerID] || indexes[share.ShareIndex] {
+			RespondBadRequest(c, "Each officer holds one share, and each share has its own index")
+			return
+		}
+		officers[share.OfficerID], indexes[share.ShareIndex] = true, true
+		officerIDs[i] = share.OfficerID
+
+		if err := validateEncryptedBlob(share.EncryptedShare); err != nil {
+			RespondBadRequest(c, fmt.Sprintf("Invalid encryptedShare for officer %s: %v", share.OfficerID, err))
+			return
+		}
+	}
+
+	if _, ok := RequireOrgOwner(c, uid, orgID); !ok {
+		return
+	}
+
+	var members int64
+	if err := requestDB(c).Table("organization_users").
+		Joins("JOIN users ON users.id = organization_users.user_id").
+		Where("organization_users.organization_id = ? AND organization_users.user_id IN ? AND users.public_key IS NOT NULL", orgID, officerIDs).
+		Count(&members).Error; err != nil {
+		RespondInternalError(c, "Failed to check recovery officers")
+		return
+	}
+	if int(members) != len(officerIDs) {
+		RespondBadRequest(c, "Recovery officers must be organization members with a public key")
+		return
+	}
+
+	if !RequireTwoFactor(c, uid, TwoFactorActionConfigureEscrow) {
+		return
+	}
+
+	escrow := models.RecoveryEscrow{OrganizationID: orgID, Threshold: req.Threshold, CreatedBy: uid}
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ?", orgID).Delete(&models.RecoveryEscrow{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&escrow).Error; err != nil {
+			return err
+		}
+		for _, share := range req.Shares {
+			if err := tx.Create(&models.RecoveryShare{
+				EscrowID:       escrow.ID,
+				OfficerID:      share.OfficerID,
+				ShareIndex:     share.ShareIndex,
+				EncryptedShare: share.EncryptedShare,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		detail := fmt.Sprintf("%d of %d shares", req.Threshold, len(req.Shares))
+		return recordRecoveryEvent(tx, orgID, nil, uid, models.RecoveryEventEscrowConfigured, detail)
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to configure recovery escrow")
+		return
+	}
+
+	RespondOK(c, escrow)
+}
+
+func DeleteRecoveryEscrow(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgOwner(c, uid, orgID); !ok {
+		return
+	}
+
+	if !RequireTwoFactor(c, uid, TwoFactorActionConfigureEscrow) {
+		return
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		result := tx.Where("organization_id = ?", orgID).Delete(&models.RecoveryEscrow{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return recordRecoveryEvent(tx, orgID, nil, uid, models.RecoveryEventEscrowRemoved, "")
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		RespondNotFound(c, "No recovery escrow configured")
+		return
+	}
+	if err != nil {
+		RespondInternalError(c, "Failed to delete recovery escrow")
+		return
+	}
+
+	RespondMessage(c, "Recovery escrow deleted")
+}
+
+// GetMyRecoveryShare returns the requester's own share, encrypted with their
+// public key, for their client to re-encrypt when releasing it
+func GetMyRecoveryShare(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgMembership(c, uid, orgID); !ok {
+		return
+	}
+
+	var share models.RecoveryShare
+	if err := requestDB(c).Joins("JOIN recovery_escrows ON recovery_escrows.id = recovery_shares.escrow_id").
+		Where("recovery_escrows.organization_id = ? AND recovery_shares.officer_id = ?", orgID, uid).
+		First(&share).Error; err != nil {
+		RespondNotFound(c, "You are not a recovery officer of this organization")
+		return
+	}
+
+	RespondOK(c, share)
+}
+
+// CreateRecoveryRequest asks the recovery officers to release their shares to
+// an owner or admin who lost the organization key. Shares are released to the
+// requester's current public key.
+func CreateRecoveryRequest(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	var req CreateRecoveryRequestRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	var user models.User
+	if err := requestDB(c).Select("id, name, email, public_key").First(&user, "id = ?", uid).Error; err != nil {
+		RespondNotFound(c, "User not found")
+		return
+	}
+	if user.PublicKey == nil || *user.PublicKey == "" {
+		RespondBadRequest(c, "Set a public key before requesting recovery")
+		return
+	}
+
+	var escrow models.RecoveryEscrow
+	if err := requestDB(c).Where("organization_id = ?", orgID).First(&escrow).Error; err != nil {
+		RespondNotFound(c, "No recovery escrow configured")
+		return
+	}
+
+	now := time.Now()
+	if err := expireRecoveryRequests(requestDB(c), orgID, now); err != nil {
+		RespondInternalError(c, "Failed to create recovery request")
+		return
+	}
+
+	var open int64
+	requestDB(c).Model(&models.RecoveryRequest{}).
+		Where("organization_id = ? AND requested_by = ? AND status IN ?", orgID, uid, []string{models.RecoveryPending, models.RecoveryApproved}).
+		Count(&open)
+	if open > 0 {
+		RespondBadRequest(c, "You already have an open recovery request")
+		return
+	}
+
+	request := models.RecoveryRequest{
+		OrganizationID:     orgID,
+		EscrowID:           escrow.ID,
+		RequestedBy:        uid,
+		RequesterPublicKey: *user.PublicKey,
+		Reason:             req.Reason,
+		Status:             models.RecoveryPending,
+		ExpiresAt:          now.Add(recoveryRequestTTL),
+	}
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Create(&request).Error; err != nil {
+			return err
+		}
+		if err := recordRecoveryEvent(tx, orgID, &request.ID, uid, models.RecoveryEventRequested, req.Reason); err != nil {
+			return err
+		}
+
+		var officerIDs []uuid.UUID
+		if err := tx.Model(&models.RecoveryShare{}).Where("escrow_id = ? AND officer_id <> ?", escrow.ID, uid).
+			Pluck("officer_id", &officerIDs).Error; err != nil {
+			return err
+		}
+		notifications := make([]models.Notification, len(officerIDs))
+		for i, officerID := range officerIDs {
+			notifications[i] = models.Notification{
+				UserID:         officerID,
+				Kind:           models.NotificationRecoveryRequested,
+				Title:          "Organization key recovery requested by " + user.Name,
+				Body:           fmt.Sprintf("%s (%s) asks recovery officers to release their share: %s", user.Name, user.Email, req.Reason),
+				OrganizationID: &orgID,
+			}
+		}
+		if len(notifications) == 0 {
+			return nil
+		}
+		return tx.Create(&notifications).Error
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to create recovery request")
+		return
+	}
+
+	RespondCreated(c, request)
+}
+
+// GetRecoveryRequests lists the organization's recovery requests, to its admins
+// and recovery officers
+func GetRecoveryRequests(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	orgUser, ok := RequireOrgMembership(c, uid, orgID)
+	if !ok {
+		return
+	}
+
+	var escrow models.RecoveryEscrow
+	hasEscrow := requestDB(c).Where("organization_id = ?", orgID).First(&escrow).Error == nil
+	if !IsAdminOrOwner(orgUser.Role) {
+		var shares int64
+		if hasEscrow {
+			requestDB(c).Model(&models.RecoveryShare{}).Where("escrow_id = ? AND officer_id = ?", escrow.ID, uid).Count(&shares)
+		}
+		if shares == 0 {
+			RespondForbidden(c, "Only organization admins and recovery officers can list recovery requests")
+			return
+		}
+	}
+
+	if err := expireRecoveryRequests(requestDB(c), orgID, time.Now()); err != nil {
+		RespondInternalError(c, "Failed to fetch recovery requests")
+		return
+	}
+
+	var rows []struct {
+		models.RecoveryRequest
+		RequesterName  string
+		RequesterEmail string
+		Threshold      int
+		Released       int
+		ReleasedByMe   bool
+	}
+	if err := requestDB(c).Table("recovery_requests").
+		Select(`recovery_requests.*, users.name AS requester_name, users.email AS requester_email, recovery_escrows.threshold,
+			(SELECT COUNT(*) FROM recovery_approvals WHERE recovery_approvals.request_id = recovery_requests.id) AS released,
+			EXISTS (SELECT 1 FROM recovery_approvals WHERE recovery_approvals.request_id = recovery_requests.id AND recovery_approvals.officer_id = ?) AS released_by_me`, uid).
+		Joins("JOIN users ON users.id = recovery_requests.requested_by").
+		Joins("JOIN recovery_escrows ON recovery_escrows.id = recovery_requests.escrow_id").
+		Where("recovery_requests.organization_id = ?", orgID).
+		Order("recovery_requests.created_at DESC").Scan(&rows).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch recovery requests")
+		return
+	}
+
+	requests := make([]RecoveryRequestResponse, len(rows))
+	for i, row := range rows {
+		requests[i] = RecoveryRequestResponse{
+			RecoveryRequest: row.RecoveryRequest,
+			RequesterName:   row.RequesterName,
+			RequesterEmail:  row.RequesterEmail,
+			Threshold:       row.Threshold,
+			Released:        row.Released,
+			ReleasedByMe:    row.ReleasedByMe,
+		}
+	}
+
+	RespondOK(c, requests)
+}
+
+// ReleaseRecoveryShare records an officer's share, re-encrypted by their client
+// to the requester's public key. The request is approved once the escrow's
+// threshold of shares was released.
+func ReleaseRecoveryShare(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	var req ReleaseRecoveryShareRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+	if err := validateEncryptedBlob(req.EncryptedShare); err != nil {
+		RespondBadRequest(c, "Invalid encryptedShare: "+err.Error())
+		return
+	}
+
+	if _, ok := RequireOrgMembership(c, uid, orgID); !ok {
+		return
+	}
+
+	request, ok := requireRecoveryRequest(c, orgID)
+	if !ok {
+		return
+	}
+	if request.Status != models.RecoveryPending {
+		RespondBadRequest(c, "Recovery request is "+request.Status)
+		return
+	}
+	if request.RequestedBy == uid {
+		RespondForbidden(c, "You can't release your share to your own request")
+		return
+	}
+
+	var share models.RecoveryShare
+	if err := requestDB(c).Where("escrow_id = ? AND officer_id = ?", request.EscrowID, uid).First(&share).Error; err != nil {
+		RespondForbidden(c, "You are not a recovery officer of this organization")
+		return
+	}
+
+	var released int64
+	requestDB(c).Model(&models.RecoveryApproval{}).Where("request_id = ? AND officer_id = ?", request.ID, uid).Count(&released)
+	if released > 0 {
+		RespondBadRequest(c, "You already released your share")
+		return
+	}
+
+	if !RequireTwoFactor(c, uid, TwoFactorActionReleaseShare) {
+		return
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Create(&models.RecoveryApproval{
+			RequestID:      request.ID,
+			OfficerID:      uid,
+			ShareIndex:     share.ShareIndex,
+			EncryptedShare: req.EncryptedShare,
+		}).Error; err != nil {
+			return err
+		}
+		if err := recordRecoveryEvent(tx, orgID, &request.ID, uid, models.RecoveryEventShareReleased, fmt.Sprintf("share %d", share.ShareIndex)); err != nil {
+			return err
+		}
+
+		var escrow models.RecoveryEscrow
+		if err := tx.Select("threshold").First(&escrow, "id = ?", request.EscrowID).Error; err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&models.RecoveryApproval{}).Where("request_id = ?", request.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) < escrow.Threshold {
+			return nil
+		}
+		request.Status = models.RecoveryApproved
+		return tx.Model(request).Update("status", models.RecoveryApproved).Error
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to release share")
+		return
+	}
+
+	RespondOK(c, request)
+}
+
+// GetRecoveryShares returns the released shares of an approved request to its
+// requester, whose client decrypts and combines them into the organization key
+func GetRecoveryShares(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	request, ok := requireRecoveryRequest(c, orgID)
+	if !ok {
+		return
+	}
+	if request.RequestedBy != uid {
+		RespondForbidden(c, "Only the requester can collect released shares")
+		return
+	}
+	if request.Status != models.RecoveryApproved {
+		RespondBadRequest(c, "Recovery request is "+request.Status)
+		return
+	}
+
+	var escrow models.RecoveryEscrow
+	if err := requestDB(c).Select("threshold").First(&escrow, "id = ?", request.EscrowID).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch recovery escrow")
+		return
+	}
+
+	response := RecoverySharesResponse{Threshold: escrow.Threshold, Shares: []ReleasedShare{}}
+	if err := requestDB(c).Model(&models.RecoveryApproval{}).Select("share_index, encrypted_share").
+		Where("request_id = ?", request.ID).Order("share_index").Scan(&response.Shares).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch released shares")
+		return
+	}
+
+	if err := recordRecoveryEvent(requestDB(c), orgID, &request.ID, uid, models.RecoveryEventSharesCollected, ""); err != nil {
+		RespondInternalError(c, "Failed to record recovery event")
+		return
+	}
+
+	RespondOK(c, response)
+}
+
+// CompleteRecovery stores the recovered organization key, encrypted with the
+// requester's public key, as their copy of it and closes the request
+func CompleteRecovery(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	var req CompleteRecoveryRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	orgUser, ok := RequireOrgAdmin(c, uid, orgID)
+	if !ok {
+		return
+	}
+
+	request, ok := requireRecoveryRequest(c, orgID)
+	if !ok {
+		return
+	}
+	if request.RequestedBy != uid {
+		RespondForbidden(c, "Only the requester can complete a recovery")
+		return
+	}
+	if request.Status != models.RecoveryApproved {
+		RespondBadRequest(c, "Recovery request is "+request.Status)
+		return
+	}
+
+	now := time.Now()
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Model(orgUser).Update("encrypted_organization_key", req.EncryptedOrganizationKey).Error; err != nil {
+			return err
+		}
+		request.Status, request.CompletedAt = models.RecoveryCompleted, &now
+		if err := tx.Model(request).Updates(map[string]any{"status": request.Status, "completed_at": now}).Error; err != nil {
+			return err
+		}
+		return recordRecoveryEvent(tx, orgID, &request.ID, uid, models.RecoveryEventCompleted, "")
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to complete recovery")
+		return
+	}
+
+	RespondOK(c, request)
+}
+
+// CancelRecoveryRequest cancels an open request, by its requester or an owner
+func CancelRecoveryRequest(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	orgUser, ok := RequireOrgMembership(c, uid, orgID)
+	if !ok {
+		return
+	}
+
+	request, ok := requireRecoveryRequest(c, orgID)
+	if !ok {
+		return
+	}
+	if request.RequestedBy != uid && !IsOwner(orgUser.Role) {
+		RespondForbidden(c, "Only the requester or an organization owner can cancel a recovery request")
+		return
+	}
+	if request.Status != models.RecoveryPending && request.Status != models.RecoveryApproved {
+		RespondBadRequest(c, "Recovery request is "+request.Status)
+		return
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Model(request).Update("status", models.RecoveryCancelled).Error; err != nil {
+			return err
+		}
+		return recordRecoveryEvent(tx, orgID, &request.ID, uid, models.RecoveryEventCancelled, "")
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to cancel recovery request")
+		return
+	}
+
+	RespondMessage(c, "Recovery request cancelled")
+}
+
+// GetRecoveryEvents lists the organization's recovery audit trail
+func GetRecoveryEvents(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	page, ok := RequestedPage(c)
+	if !ok {
+		return
+	}
+
+	var events []models.RecoveryEvent
+	if err := page.Apply(requestDB(c).Where("organization_id = ?", orgID), "recovery_events").Find(&events).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch recovery events")
+		return
+	}
+
+	var response RecoveryEventPage
+	response.Items, response.NextCursor = pageItems(page, events, func(e *models.RecoveryEvent) (time.Time, uuid.UUID) {
+		return e.CreatedAt, e.ID
+	})
+	RespondOK(c, response)
+}
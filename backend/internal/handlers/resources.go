@@ -0,0 +1,637 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"envie-backend/internal/apitime"
+	"envie-backend/internal/configwatch"
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Resource API
+//
+// Stable CRUD endpoints under /v1 for declarative tooling such as a Terraform provider.
+// Every resource follows the same rules:
+//   - POST creates and returns 201 with the full resource
+//   - GET returns the full resource, 404 once it no longer exists
+//   - PUT replaces the mutable fields and returns the full resource
+//   - DELETE returns 204
+//
+// Mutating requests may carry an Idempotency-Key header (see middleware.IdempotencyMiddleware).
+// Config values are stored exactly as sent - clients encrypt them with the project key.
+
+type ProjectResource struct {
+	ID             uuid.UUID `json:"id"`
+	Name           string    `json:"name"`
+	Slug           string    `json:"slug"`
+	OrganizationID uuid.UUID `json:"organizationId"`
+	KeyVersion     int       `json:"keyVersion"`
+	ConfigChecksum *string   `json:"configChecksum"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+type ConfigItemResource struct {
+	ID            uuid.UUID  `json:"id"`
+	ProjectID     uuid.UUID  `json:"projectId"`
+	Name          string     `json:"name"`
+	Value         string     `json:"value"` // encrypted with the project key
+	Sensitive     bool       `json:"sensitive"`
+	Masked        bool       `json:"masked,omitempty"` // value omitted, see Project.RestrictSensitive
+	Position      int        `json:"position"`
+	ValueType     string     `json:"valueType"`
+	HasReferences bool       `json:"hasReferences"`
+	Category      *string    `json:"category"`
+	Description   *string    `json:"description"`
+	ExpiresAt     *time.Time `json:"expiresAt"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+type PutConfigItemRequest struct {
+	Value         string        `json:"value" binding:"required"`
+	Sensitive     bool          `json:"sensitive"`
+	Position      *int          `json:"position"` // omitted on create appends to the end
+	Category      *string       `json:"category"`
+	Description   *string       `json:"description"`
+	ExpiresAt     *apitime.Time `json:"expiresAt"`
+	ValueType     string        `json:"valueType" binding:"omitempty,oneof=string number boolean url json"`
+	HasReferences bool          `json:"hasReferences"`
+}
+
+type TeamResource struct {
+	ID             uuid.UUID `json:"id"`
+	Name           string    `json:"name"`
+	OrganizationID uuid.UUID `json:"organizationId"`
+	EncryptedKey   string    `json:"encryptedKey"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+type UpdateTeamRequest struct {
+	Name string `json:"name" binding:"required,max=255,name"`
+}
+
+type ProjectTokenResource struct {
+	ID              uuid.UUID  `json:"id"`
+	ProjectID       uuid.UUID  `json:"projectId"`
+	Name            string     `json:"name"`
+	TokenPrefix     string     `json:"tokenPrefix"`
+	EnvelopeVersion int        `json:"envelopeVersion"`
+	ExpiresAt       *time.Time `json:"expiresAt"`
+	LastUsedAt      *time.Time `json:"lastUsedAt"`
+	Scopes          []string   `json:"scopes"`
+	AllowedCIDRs    []string   `json:"allowedCidrs"`
+	CreatedBy       uuid.UUID  `json:"createdBy"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+}
+
+type UpdateProjectTokenRequest struct {
+	Name         string    `json:"name" binding:"required,max=255,name"`
+	AllowedCIDRs *[]string `json:"allowedCidrs" binding:"omitempty,max=50"` // unchanged when omitted
+}
+
+func toProjectResource(p *models.Project) ProjectResource {
+	return ProjectResource{
+		ID:             p.ID,
+		Name:           p.Name,
+		Slug:           p.Slug,
+		OrganizationID: p.OrganizationID,
+		KeyVersion:     p.KeyVersion,
+		ConfigChecksum: p.ConfigChecksum,
+		CreatedAt:      p.CreatedAt,
+		UpdatedAt:      p.UpdatedAt,
+	}
+}
+
+func toConfigItemResource(item *models.ConfigItem) ConfigItemResource {
+	return ConfigItemResource{
+		ID:            item.ID,
+		ProjectID:     item.ProjectID,
+		Name:          item.Name,
+		Value:         item.Value,
+		Sensitive:     item.Sensitive,
+		Masked:        item.Masked,
+		Position:      item.Position,
+		ValueType:     item.ValueType,
+		HasReferences: item.HasReferences,
+		Category:      item.Category,
+		Description:   item.Description,
+		ExpiresAt:     item.ExpiresAt,
+		CreatedAt:     item.CreatedAt,
+		UpdatedAt:     item.UpdatedAt,
+	}
+}
+
+func toTeamResource(t *models.Team) TeamResource {
+	return TeamResource{
+		ID:             t.ID,
+		Name:           t.Name,
+		OrganizationID: t.OrganizationID,
+		EncryptedKey:   t.EncryptedKey,
+		CreatedAt:      t.CreatedAt,
+		UpdatedAt:      t.UpdatedAt,
+	}
+}
+
+func toProjectTokenResource(t *models.ProjectToken) ProjectTokenResource {
+	return ProjectTokenResource{
+		ID:              t.ID,
+		ProjectID:       t.ProjectID,
+		Name:            t.Name,
+		TokenPrefix:     t.TokenPrefix,
+		EnvelopeVersion: t.EnvelopeVersion,
+		ExpiresAt:       t.ExpiresAt,
+		LastUsedAt:      t.LastUsedAt,
+		Scopes:          t.Scopes,
+		AllowedCIDRs:    t.AllowedCIDRs,
+		CreatedBy:       t.CreatedBy,
+		CreatedAt:       t.CreatedAt,
+		UpdatedAt:       t.UpdatedAt,
+	}
+}
+
+// Projects
+
+func CreateProjectResource(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	var req CreateProjectRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	project, ok := createProjectInTeam(c, uid, req)
+	if !ok {
+		return
+	}
+
+	RespondCreated(c, toProjectResource(project))
+}
+
+func GetProjectResource(c *gin.Context) {
+	access := CurrentProjectAccess(c)
+
+	RespondOK(c, toProjectResource(access.Project))
+}
+
+func PutProjectResource(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+	access := CurrentProjectAccess(c)
+
+	var req UpdateProjectRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	if err := renameProject(requestDB(c), access.Project, req.Name, uid); err != nil {
+		RespondInternalError(c, "Failed to update project")
+		return
+	}
+
+	RespondOK(c, toProjectResource(access.Project))
+}
+
+func DeleteProjectResource(c *gin.Context) {
+	access := CurrentProjectAccess(c)
+	if !checkProjectDeletable(c, access.Project.ID) {
+		return
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("project_id = ?", access.Project.ID).Delete(&models.TeamProject{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.Project{}, "id = ?", access.Project.ID).Error
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to delete project")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Config items (addressed by key name, values encrypted client-side)
+
+func GetConfigItemResources(c *gin.Context) {
+	access := CurrentProjectAccess(c)
+
+	var items []models.ConfigItem
+	if err := requestDB(c).Where("project_id = ?", access.Project.ID).Order("position asc").Find(&items).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch config items")
+		return
+	}
+	if access.MasksSensitive() {
+		maskSensitiveItems(items)
+	}
+
+	response := make([]ConfigItemResource, len(items))
+	for i := range items {
+		response[i] = toConfigItemResource(&items[i])
+	}
+
+	RespondOK(c, response)
+}
+
+func GetConfigItemResource(c *gin.Context) {
+	access := CurrentProjectAccess(c)
+
+	var item models.ConfigItem
+	if err := requestDB(c).Where("project_id = ? AND name = ?", access.Project.ID, c.Param("name")).First(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			RespondNotFound(c, "Config item not found")
+		} else {
+			RespondInternalError(c, "Failed to fetch config item")
+		}
+		return
+	}
+	if access.MasksSensitive() {
+		maskSensitiveItem(&item)
+	}
+
+	RespondOK(c, toConfigItemResource(&item))
+}
+
+// PutConfigItemResource creates or replaces the config item with the given name
+func PutConfigItemResource(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+	access := CurrentProjectAccess(c)
+
+	name := c.Param("name")
+	if name == "" || len(name) > 255 {
+		RespondBadRequest(c, "Invalid config key name")
+		return
+	}
+
+	var req PutConfigItemRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	if err := validateEncryptedBlob(req.Value); err != nil {
+		RespondBadRequest(c, "Invalid encrypted value: "+err.Error())
+		return
+	}
+
+	projectID := access.Project.ID
+	status := http.StatusOK
+	var item models.ConfigItem
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		err := tx.Where("project_id = ? AND name = ?", projectID, name).First(&item).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusCreated
+
+			position := 0
+			if req.Position != nil {
+				position = *req.Position
+			} else {
+				var maxPosition *int
+				if err := tx.Model(&models.ConfigItem{}).Where("project_id = ?", projectID).Select("MAX(position)").Scan(&maxPosition).Error; err != nil {
+					return err
+				}
+				if maxPosition != nil {
+					position = *maxPosition + 1
+				}
+			}
+
+			item = models.ConfigItem{
+				ProjectID: projectID,
+				Name:      name,
+				Position:  position,
+				CreatedBy: uid,
+			}
+		} else {
+			if item.Sensitive && !req.Sensitive && access.MasksSensitive() {
+				return &ValidationError{Message: "Only members with " + models.PermissionSecretsReveal + " can unmark a sensitive item"}
+			}
+			if req.Position != nil {
+				item.Position = *req.Position
+			}
+		}
+
+		item.Value = req.Value
+		item.Sensitive = req.Sensitive
+		item.ValueType = req.ValueType
+		item.HasReferences = req.HasReferences
+		if item.ValueType == "" {
+			item.ValueType = models.VariableTypeString
+		}
+		item.Category = req.Category
+		item.Description = req.Description
+		item.ExpiresAt = req.ExpiresAt.Ptr()
+		item.UpdatedBy = uid
+
+		if err := tx.Omit("Project", "Creator", "Updater", "SecretManagerConfig").Save(&item).Error; err != nil {
+			return err
+		}
+
+		detail := "updated " + name
+		if status == http.StatusCreated {
+			detail = "created " + name
+		}
+		return updateConfigChecksum(tx, projectID, configChange{ActorID: uid, Detail: detail, Count: 1})
+	})
+	if err != nil {
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			RespondForbidden(c, validationErr.Message)
+			return
+		}
+		RespondInternalError(c, "Failed to save config item")
+		return
+	}
+	configwatch.Publish(projectID)
+
+	if access.MasksSensitive() {
+		maskSensitiveItem(&item)
+	}
+	c.JSON(status, toConfigItemResource(&item))
+}
+
+func DeleteConfigItemResource(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+	access := CurrentProjectAccess(c)
+
+	projectID := access.Project.ID
+	var deleted int64
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		result := tx.Where("project_id = ? AND name = ?", projectID, c.Param("name")).Delete(&models.ConfigItem{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		if deleted == 0 {
+			return nil
+		}
+		return updateConfigChecksum(tx, projectID, configChange{ActorID: uid, Detail: "deleted " + c.Param("name"), Count: 1})
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to delete config item")
+		return
+	}
+
+	if deleted == 0 {
+		RespondNotFound(c, "Config item not found")
+		return
+	}
+	configwatch.Publish(projectID)
+
+	c.Status(http.StatusNoContent)
+}
+
+// Teams
+
+// requireTeamResource loads the team in the :id param and checks the caller belongs to
+// its organization. If unsuccessful, it sends an error response automatically.
+func requireTeamResource(c *gin.Context) (uuid.UUID, *models.Team, bool) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return uuid.Nil, nil, false
+	}
+
+	teamID, ok := ParseUUIDParam(c, "id", "team")
+	if !ok {
+		return uuid.Nil, nil, false
+	}
+
+	var team models.Team
+	if err := requestDB(c).First(&team, "id = ?", teamID).Error; err != nil {
+		RespondNotFound(c, "Team not found")
+		return uuid.Nil, nil, false
+	}
+
+	if _, ok := RequireOrgMembership(c, uid, team.OrganizationID); !ok {
+		return uuid.Nil, nil, false
+	}
+
+	return uid, &team, true
+}
+
+func CreateTeamResource(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	var req CreateTeamRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	team, ok := createTeamInOrg(c, uid, req)
+	if !ok {
+		return
+	}
+
+	RespondCreated(c, toTeamResource(team))
+}
+
+func GetTeamResource(c *gin.Context) {
+	_, team, ok := requireTeamResource(c)
+	if !ok {
+		return
+	}
+
+	RespondOK(c, toTeamResource(team))
+}
+
+func PutTeamResource(c *gin.Context) {
+	uid, team, ok := requireTeamResource(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateTeamRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	canManage, err := canManageTeam(uid, team.ID, team.OrganizationID)
+	if err != nil || !canManage {
+		RespondForbidden(c, "You don't have permission to manage this team")
+		return
+	}
+
+	if err := requestDB(c).Model(team).Update("name", req.Name).Error; err != nil {
+		RespondInternalError(c, "Failed to update team")
+		return
+	}
+
+	RespondOK(c, toTeamResource(team))
+}
+
+func DeleteTeamResource(c *gin.Context) {
+	uid, team, ok := requireTeamResource(c)
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, team.OrganizationID); !ok {
+		return
+	}
+
+	// Refuse to orphan projects that are only reachable through this team
+	var orphaned int64
+	if err := requestDB(c).Raw(`
+		SELECT COUNT(*) FROM team_projects tp
+		WHERE tp.team_id = ?
+		AND NOT EXISTS (
+			SELECT 1 FROM team_projects other
+			WHERE other.project_id = tp.project_id AND other.team_id <> tp.team_id
+		)
+	`, team.ID).Scan(&orphaned).Error; err != nil {
+		RespondInternalError(c, "Failed to check team projects")
+		return
+	}
+
+	if orphaned > 0 {
+		RespondConflict(c, "Team is the only team with access to one or more projects")
+		return
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Where("team_id = ?", team.ID).Delete(&models.TeamProject{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("team_id = ?", team.ID).Delete(&models.TeamUser{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(team).Error
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to delete team")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Project tokens (the token secret is generated client-side, only its identity hash is sent)
+
+func findProjectTokenResource(c *gin.Context, projectID uuid.UUID) (*models.ProjectToken, bool) {
+	tokenID, ok := ParseUUIDParam(c, "tokenId", "token")
+	if !ok {
+		return nil, false
+	}
+
+	var token models.ProjectToken
+	if err := requestDB(c).Where("id = ? AND project_id = ?", tokenID, projectID).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			RespondNotFound(c, "Token not found")
+		} else {
+			RespondInternalError(c, "Failed to fetch token")
+		}
+		return nil, false
+	}
+
+	return &token, true
+}
+
+func CreateProjectTokenResource(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+	access := CurrentProjectAccess(c)
+
+	var req CreateProjectTokenRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	token, ok := createProjectToken(c, uid, access, req, models.AuditTokenIssued)
+	if !ok {
+		return
+	}
+
+	RespondCreated(c, toProjectTokenResource(token))
+}
+
+func GetProjectTokenResource(c *gin.Context) {
+	access := CurrentProjectAccess(c)
+
+	token, ok := findProjectTokenResource(c, access.Project.ID)
+	if !ok {
+		return
+	}
+
+	RespondOK(c, toProjectTokenResource(token))
+}
+
+// PutProjectTokenResource renames a token and replaces its allowed ranges. Key
+// material and expiry are immutable, so changing them requires replacing the token.
+func PutProjectTokenResource(c *gin.Context) {
+	access := CurrentProjectAccess(c)
+
+	token, ok := findProjectTokenResource(c, access.Project.ID)
+	if !ok {
+		return
+	}
+
+	var req UpdateProjectTokenRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	columns := []string{"name"}
+	if req.AllowedCIDRs != nil {
+		allowedCIDRs, err := normalizeAllowedCIDRs(*req.AllowedCIDRs)
+		if err != nil {
+			RespondBadRequest(c, err.Error())
+			return
+		}
+		token.AllowedCIDRs = allowedCIDRs
+		columns = append(columns, "allowed_cidrs")
+	}
+	token.Name = req.Name
+
+	if err := requestDB(c).Model(token).Select(columns).Updates(token).Error; err != nil {
+		RespondInternalError(c, "Failed to update token")
+		return
+	}
+
+	RespondOK(c, toProjectTokenResource(token))
+}
+
+func DeleteProjectTokenResource(c *gin.Context) {
+	access := CurrentProjectAccess(c)
+
+	token, ok := findProjectTokenResource(c, access.Project.ID)
+	if !ok {
+		return
+	}
+
+	if err := requestDB(c).Delete(token).Error; err != nil {
+		RespondInternalError(c, "Failed to delete token")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,397 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type RoleRequest struct {
+	Name        string   `json:"name" binding:"required,max=50,name"`
+	Scope       string   `json:"scope" binding:"required,oneof=organization team"`
+	Description *string  `json:"description" binding:"omitempty,max=255"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+type AssignRoleRequest struct {
+	RoleID *uuid.UUID `json:"roleId"` // null restores the built-in role's permissions
+}
+
+type RolesResponse struct {
+	Permissions  []string            `json:"permissions"`
+	BuiltinRoles map[string][]string `json:"builtinRoles"`
+	Roles        []models.Role       `json:"roles"`
+}
+
+// validatePermissions returns permissions without duplicates, in the order of
+// models.AllPermissions, or an error naming an unknown one
+func validatePermissions(permissions []string) ([]string, error) {
+	known := NewPermissionSet(models.AllPermissions)
+	set := NewPermissionSet(permissions)
+	for permission := range set {
+		if !known.Has(permission) {
+			return nil, fmt.Errorf("unknown permission %q", permission)
+		}
+	}
+	return set.List(), nil
+}
+
+// bindRoleRequest binds and validates a role, answering the request if invalid
+func bindRoleRequest(c *gin.Context) (RoleRequest, bool) {
+	var req RoleRequest
+	if !BindJSON(c, &req) {
+		return req, false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		RespondBadRequest(c, "Role name required")
+		return req, false
+	}
+	if _, builtin := models.BuiltinRolePermissions[strings.ToLower(req.Name)]; builtin {
+		RespondBadRequest(c, "Role name is taken by a built-in role")
+		return req, false
+	}
+	permissions, err := validatePermissions(req.Permissions)
+	if err != nil {
+		RespondBadRequest(c, err.Error())
+		return req, false
+	}
+	req.Permissions = permissions
+	return req, true
+}
+
+// GetRoles lists the permissions, the built-in roles and the custom roles of an
+// organization
+func GetRoles(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgMembership(c, uid, orgID); !ok {
+		return
+	}
+
+	roles := []models.Role{}
+	if err := requestDB(c).Where("organization_id = ?", orgID).Order("name").Find(&roles).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch roles")
+		return
+	}
+
+	RespondOK(c, RolesResponse{
+		Permissions:  models.AllPermissions,
+		BuiltinRoles: models.BuiltinRolePermissions,
+		Roles:        roles,
+	})
+}
+
+// CreateRole creates a custom role. Only permissions the caller has themselves
+// can be granted.
+func CreateRole(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	req, ok := bindRoleRequest(c)
+	if !ok {
+		return
+	}
+
+	_, permissions, ok := RequireOrgPermission(c, uid, orgID, models.PermissionMembersManage)
+	if !ok {
+		return
+	}
+	if !permissions.Covers(req.Permissions) {
+		RespondForbidden(c, "You can't grant permissions you don't have")
+		return
+	}
+
+	var count int64
+	requestDB(c).Model(&models.Role{}).Where("organization_id = ? AND name = ?", orgID, req.Name).Count(&count)
+	if count > 0 {
+		RespondConflict(c, "A role with this name already exists")
+		return
+	}
+
+	role := models.Role{
+		OrganizationID: orgID,
+		Name:           req.Name,
+		Scope:          req.Scope,
+		Description:    req.Description,
+		Permissions:    req.Permissions,
+	}
+	if err := requestDB(c).Create(&role).Error; err != nil {
+		RespondInternalError(c, "Failed to create role")
+		return
+	}
+
+	RespondCreated(c, role)
+}
+
+// UpdateRole changes a custom role, and so the permissions of everyone it is
+// assigned to. Its scope can't change.
+func UpdateRole(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	roleID, ok := ParseUUIDParam(c, "roleId", "role")
+	if !ok {
+		return
+	}
+
+	req, ok := bindRoleRequest(c)
+	if !ok {
+		return
+	}
+
+	_, permissions, ok := RequireOrgPermission(c, uid, orgID, models.PermissionMembersManage)
+	if !ok {
+		return
+	}
+
+	var role models.Role
+	if err := requestDB(c).First(&role, "id = ? AND organization_id = ?", roleID, orgID).Error; err != nil {
+		RespondNotFound(c, "Role not found")
+		return
+	}
+	if req.Scope != role.Scope {
+		RespondBadRequest(c, "The scope of a role can't change")
+		return
+	}
+	if !permissions.Covers(role.Permissions) || !permissions.Covers(req.Permissions) {
+		RespondForbidden(c, "You can't change roles with permissions you don't have")
+		return
+	}
+
+	var count int64
+	requestDB(c).Model(&models.Role{}).Where("organization_id = ? AND name = ? AND id <> ?", orgID, req.Name, roleID).Count(&count)
+	if count > 0 {
+		RespondConflict(c, "A role with this name already exists")
+		return
+	}
+
+	role.Name = req.Name
+	role.Description = req.Description
+	role.Permissions = req.Permissions
+	if err := requestDB(c).Save(&role).Error; err != nil {
+		RespondInternalError(c, "Failed to update role")
+		return
+	}
+
+	RespondOK(c, role)
+}
+
+// DeleteRole deletes a custom role. Its members fall back to the permissions
+// of their built-in roles.
+func DeleteRole(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	roleID, ok := ParseUUIDParam(c, "roleId", "role")
+	if !ok {
+		return
+	}
+
+	_, permissions, ok := RequireOrgPermission(c, uid, orgID, models.PermissionMembersManage)
+	if !ok {
+		return
+	}
+
+	var role models.Role
+	if err := requestDB(c).First(&role, "id = ? AND organization_id = ?", roleID, orgID).Error; err != nil {
+		RespondNotFound(c, "Role not found")
+		return
+	}
+	if !permissions.Covers(role.Permissions) {
+		RespondForbidden(c, "You can't delete roles with permissions you don't have")
+		return
+	}
+
+	if err := requestDB(c).Delete(&role).Error; err != nil {
+		RespondInternalError(c, "Failed to delete role")
+		return
+	}
+
+	RespondMessage(c, "Role deleted")
+}
+
+// checkAssignableRole checks the custom role to assign, answering the request if it
+// doesn't exist, has another scope or grants more than the caller has. A nil
+// roleID unassigns and always succeeds.
+func checkAssignableRole(c *gin.Context, roleID *uuid.UUID, orgID uuid.UUID, scope string, permissions PermissionSet) bool {
+	if roleID == nil {
+		return true
+	}
+	var role models.Role
+	if err := requestDB(c).First(&role, "id = ? AND organization_id = ?", *roleID, orgID).Error; err != nil {
+		RespondBadRequest(c, "Role not found in this organization")
+		return false
+	}
+	if role.Scope != scope {
+		RespondBadRequest(c, "Role can't be assigned at this scope")
+		return false
+	}
+	if !permissions.Covers(role.Permissions) {
+		RespondForbidden(c, "You can't assign roles with permissions you don't have")
+		return false
+	}
+	return true
+}
+
+// AssignOrganizationMemberRole assigns an organization-scoped custom role to a
+// member, or removes it. Owners always keep every permission.
+func AssignOrganizationMemberRole(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	memberID, ok := ParseUUIDParam(c, "userId", "user")
+	if !ok {
+		return
+	}
+
+	var req AssignRoleRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	_, permissions, ok := RequireOrgPermission(c, uid, orgID, models.PermissionMembersManage)
+	if !ok {
+		return
+	}
+
+	var member models.OrganizationUser
+	if err := requestDB(c).Where("organization_id = ? AND user_id = ?", orgID, memberID).First(&member).Error; err != nil {
+		RespondNotFound(c, "Member not found")
+		return
+	}
+	if IsOwner(member.Role) {
+		RespondBadRequest(c, "Owners always have every permission")
+		return
+	}
+	current, err := loadCustomRole(member.RoleID)
+	if err != nil {
+		RespondInternalError(c, "Failed to load role")
+		return
+	}
+	if !permissions.Covers(membershipPermissions(member.Role, current)) {
+		RespondForbidden(c, "You can't change the permissions of members with more access than you")
+		return
+	}
+
+	if !checkAssignableRole(c, req.RoleID, orgID, models.RoleScopeOrganization, permissions) {
+		return
+	}
+
+	if err := requestDB(c).Model(&member).Update("role_id", req.RoleID).Error; err != nil {
+		RespondInternalError(c, "Failed to assign role")
+		return
+	}
+
+	RespondMessage(c, "Role assigned")
+}
+
+// AssignTeamMemberRole assigns a team-scoped custom role to a team member, or
+// removes it
+func AssignTeamMemberRole(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	teamID, ok := ParseUUIDParam(c, "id", "team")
+	if !ok {
+		return
+	}
+
+	memberID, ok := ParseUUIDParam(c, "userId", "user")
+	if !ok {
+		return
+	}
+
+	var req AssignRoleRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	var team models.Team
+	if err := requestDB(c).First(&team, "id = ?", teamID).Error; err != nil {
+		RespondNotFound(c, "Team not found")
+		return
+	}
+
+	permissions, err := GetUserTeamPermissions(uid, teamID, team.OrganizationID)
+	if err != nil {
+		RespondInternalError(c, "Failed to check permissions")
+		return
+	}
+	if !permissions.Has(models.PermissionMembersManage) {
+		RespondForbidden(c, "You don't have permission to manage this team")
+		return
+	}
+
+	var member models.TeamUser
+	if err := requestDB(c).Where("team_id = ? AND user_id = ?", teamID, memberID).First(&member).Error; err != nil {
+		RespondNotFound(c, "Team member not found")
+		return
+	}
+	if IsOwner(member.Role) {
+		RespondBadRequest(c, "Owners always have every permission")
+		return
+	}
+	current, err := loadCustomRole(member.RoleID)
+	if err != nil {
+		RespondInternalError(c, "Failed to load role")
+		return
+	}
+	if !permissions.Covers(membershipPermissions(member.Role, current)) {
+		RespondForbidden(c, "You can't change the permissions of members with more access than you")
+		return
+	}
+
+	if !checkAssignableRole(c, req.RoleID, team.OrganizationID, models.RoleScopeTeam, permissions) {
+		return
+	}
+
+	if err := requestDB(c).Model(&member).Update("role_id", req.RoleID).Error; err != nil {
+		RespondInternalError(c, "Failed to assign role")
+		return
+	}
+
+	RespondMessage(c, "Role assigned")
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// rotationConsumerWindow is how far back reads count a machine as a consumer of
+// the tokens a rotation invalidates
+const rotationConsumerWindow = 30 * 24 * time.Hour
+
+// RotationImpact - what committing a rotation breaks or rewrites, for approvers to
+// weigh before they vote
+type RotationImpact struct {
+	RotationID uuid.UUID `json:"rotationId"`
+	NewVersion int       `json:"newVersion"`
+
+	TokensInvalidated    int                           `json:"tokensInvalidated"`
+	Tokens               []RotationImpactToken         `json:"tokens"`
+	Teams                []RotationImpactTeam          `json:"teams"`                // whose copy of the project key is replaced
+	SecretManagerConfigs []RotationImpactSecretManager `json:"secretManagerConfigs"` // whose synced items get new values
+	CLIConsumers         []RotationCLIConsumer         `json:"cliConsumers"`         // read the project with one of Tokens in the last 30 days
+}
+
+// RotationImpactToken - a project token deleted when the rotation commits
+type RotationImpactToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+// RotationImpactTeam - a team whose members get the new project key
+type RotationImpactTeam struct {
+	ID      uuid.UUID `json:"id"`
+	Name    string    `json:"name"`
+	Members int       `json:"members"`
+}
+
+// RotationImpactSecretManager - a secret manager config and the items synced
+// from it
+type RotationImpactSecretManager struct {
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	LinkedItems int        `json:"linkedItems"`
+	LastSyncAt  *time.Time `json:"lastSyncAt"`
+}
+
+// RotationCLIConsumer - reads of the project through one token from one address,
+// from the read audit log
+type RotationCLIConsumer struct {
+	TokenID    uuid.UUID `json:"tokenId"`
+	TokenName  string    `json:"tokenName"`
+	ClientIP   *string   `json:"clientIp"`
+	Reads      int       `json:"reads"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+}
+
+// GetRotationImpact summarizes what a pending or stale rotation affects once it
+// commits. Open to its approvers and to those who can initiate rotations.
+func GetRotationImpact(c *gin.Context) {
+	access := CurrentProjectAccess(c)
+	if !access.Can(models.PermissionRotationApprove) && !access.Can(models.PermissionConfigWrite) {
+		RespondForbidden(c, "Viewing the impact of a rotation requires "+models.PermissionRotationApprove+" or "+models.PermissionConfigWrite)
+		return
+	}
+	rotation, ok := loadProjectRotation(c)
+	if !ok {
+		return
+	}
+	if rotation.Status != "pending" && rotation.Status != "stale" {
+		RespondConflict(c, "The rotation is "+rotation.Status+"; only pending and stale rotations have an impact to report")
+		return
+	}
+
+	impact, err := rotationImpact(requestDB(c), rotation, time.Now())
+	if err != nil {
+		RespondInternalError(c, "Failed to compute the rotation impact")
+		return
+	}
+	RespondOK(c, impact)
+}
+
+// rotationImpact collects the tokens, teams, secret manager configs and recent
+// CLI consumers a rotation affects as of now
+func rotationImpact(db *gorm.DB, rotation *models.PendingKeyRotation, now time.Time) (*RotationImpact, error) {
+	impact := &RotationImpact{
+		RotationID:           rotation.ID,
+		NewVersion:           rotation.NewVersion,
+		Tokens:               []RotationImpactToken{},
+		Teams:                []RotationImpactTeam{},
+		SecretManagerConfigs: []RotationImpactSecretManager{},
+		CLIConsumers:         []RotationCLIConsumer{},
+	}
+
+	// Every token of the project is deleted at commit, as in commitRotation
+	var tokens []models.ProjectToken
+	if err := db.Select("id, name, expires_at, last_used_at").
+		Where("project_id = ?", rotation.ProjectID).
+		Order("name").
+		Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	tokenNames := make(map[uuid.UUID]string, len(tokens))
+	tokenIDs := make([]uuid.UUID, len(tokens))
+	for i, token := range tokens {
+		impact.Tokens = append(impact.Tokens, RotationImpactToken{
+			ID:         token.ID,
+			Name:       token.Name,
+			ExpiresAt:  token.ExpiresAt,
+			LastUsedAt: token.LastUsedAt,
+		})
+		tokenNames[token.ID] = token.Name
+		tokenIDs[i] = token.ID
+	}
+	impact.TokensInvalidated = len(tokens)
+
+	var teamKeys []TeamEncryptedKeyEntry
+	json.Unmarshal([]byte(rotation.TeamEncryptedKeys), &teamKeys)
+	teamIDs := make([]string, len(teamKeys))
+	for i, entry := range teamKeys {
+		teamIDs[i] = entry.TeamID
+	}
+	if len(teamIDs) > 0 {
+		var teams []models.Team
+		if err := db.Select("id, name").Where("id IN ?", teamIDs).Order("name").Find(&teams).Error; err != nil {
+			return nil, err
+		}
+		var members []struct {
+			TeamID  uuid.UUID
+			Members int
+		}
+		if err := db.Model(&models.TeamUser{}).
+			Select("team_id, COUNT(*) AS members").
+			Where("team_id IN ?", teamIDs).
+			Group("team_id").
+			Scan(&members).Error; err != nil {
+			return nil, err
+		}
+		memberCounts := make(map[uuid.UUID]int, len(members))
+		for _, row := range members {
+			memberCounts[row.TeamID] = row.Members
+		}
+		for _, team := range teams {
+			impact.Teams = append(impact.Teams, RotationImpactTeam{ID: team.ID, Name: team.Name, Members: memberCounts[team.ID]})
+		}
+	}
+
+	var secretManagerConfigs []models.SecretManagerConfig
+	if err := db.Select("id, name").Where("project_id = ?", rotation.ProjectID).Order("name").Find(&secretManagerConfigs).Error; err != nil {
+		return nil, err
+	}
+	if len(secretManagerConfigs) > 0 {
+		var linked []models.ConfigItem
+		if err := db.Select("secret_manager_config_id, secret_manager_last_sync_at").
+			Where("project_id = ? AND secret_manager_config_id IS NOT NULL", rotation.ProjectID).
+			Find(&linked).Error; err != nil {
+			return nil, err
+		}
+		impact.SecretManagerConfigs = make([]RotationImpactSecretManager, len(secretManagerConfigs))
+		byConfig := make(map[uuid.UUID]*RotationImpactSecretManager, len(secretManagerConfigs))
+		for i, smc := range secretManagerConfigs {
+			impact.SecretManagerConfigs[i] = RotationImpactSecretManager{ID: smc.ID, Name: smc.Name}
+			byConfig[smc.ID] = &impact.SecretManagerConfigs[i]
+		}
+		for _, item := range linked {
+			smc := byConfig[*item.SecretManagerConfigID]
+			if smc == nil {
+				continue
+			}
+			smc.LinkedItems++
+			if item.SecretManagerLastSyncAt != nil && (smc.LastSyncAt == nil || item.SecretManagerLastSyncAt.After(*smc.LastSyncAt)) {
+				smc.LastSyncAt = item.SecretManagerLastSyncAt
+			}
+		}
+	}
+
+	if len(tokenIDs) == 0 {
+		return impact, nil
+	}
+	var reads []models.AuditEvent
+	if err := db.Select("token_id, client_ip, created_at").
+		Where("project_id = ? AND action IN ? AND token_id IN ? AND created_at > ?", rotation.ProjectID, models.AuditReadActions, tokenIDs, now.Add(-rotationConsumerWindow)).
+		Find(&reads).Error; err != nil {
+		return nil, err
+	}
+	type consumerKey struct {
+		tokenID  uuid.UUID
+		clientIP string
+	}
+	consumers := map[consumerKey]*RotationCLIConsumer{}
+	for _, read := range reads {
+		key := consumerKey{tokenID: *read.TokenID}
+		if read.ClientIP != nil {
+			key.clientIP = *read.ClientIP
+		}
+		consumer := consumers[key]
+		if consumer == nil {
+			consumer = &RotationCLIConsumer{TokenID: key.tokenID, TokenName: tokenNames[key.tokenID], ClientIP: read.ClientIP}
+			consumers[key] = consumer
+		}
+		consumer.Reads++
+		if read.CreatedAt.After(consumer.LastSeenAt) {
+			consumer.LastSeenAt = read.CreatedAt
+		}
+	}
+	for _, consumer := range consumers {
+		impact.CLIConsumers = append(impact.CLIConsumers, *consumer)
+	}
+	sort.Slice(impact.CLIConsumers, func(i, j int) bool {
+		return impact.CLIConsumers[i].LastSeenAt.After(impact.CLIConsumers[j].LastSeenAt)
+	})
+	return impact, nil
+}
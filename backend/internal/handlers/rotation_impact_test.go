@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestRotationImpact(t *testing.T) {
+	f := newAccessFixture(t)
+	db := database.DB
+	now := time.Now()
+
+	lastUsed := now.Add(-time.Hour)
+	deploy := models.ProjectToken{ProjectID: f.project.ID, Name: "deploy", TokenPrefix: "abc", IdentityIDHash: "deploy", EncryptedProjectKey: "a2V5", CreatedBy: f.member.ID, LastUsedAt: &lastUsed}
+	idle := models.ProjectToken{ProjectID: f.project.ID, Name: "idle", TokenPrefix: "def", IdentityIDHash: "idle", EncryptedProjectKey: "a2V5", CreatedBy: f.member.ID}
+	other := models.ProjectToken{ProjectID: f.sandbox.ID, Name: "sandbox", TokenPrefix: "ghi", IdentityIDHash: "sandbox", EncryptedProjectKey: "a2V5", CreatedBy: f.member.ID}
+	vault := models.SecretManagerConfig{ProjectID: f.project.ID, Name: "vault", EncryptedKey: "a2V5", CreatedByID: f.member.ID, UpdatedByID: f.member.ID}
+	for _, row := range []any{&deploy, &idle, &other, &vault} {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	synced := now.Add(-2 * time.Hour)
+	db.Create(&models.ConfigItem{ProjectID: f.project.ID, Name: "DB_URL", Value: "dXJs", CreatedBy: f.member.ID, UpdatedBy: f.member.ID, SecretManagerConfigID: &vault.ID, SecretManagerLastSyncAt: &synced})
+	db.Create(&models.ConfigItem{ProjectID: f.project.ID, Name: "PORT", Value: "ODA4MA==", CreatedBy: f.member.ID, UpdatedBy: f.member.ID})
+
+	ci, laptop := "10.0.0.1", "10.0.0.2"
+	read := func(token *models.ProjectToken, ip *string, at time.Time) {
+		db.Create(&models.AuditEvent{OrganizationID: f.project.OrganizationID, ProjectID: &token.ProjectID, ActorID: f.member.ID, TokenID: &token.ID, ClientIP: ip, Action: models.AuditConfigRead, CreatedAt: at})
+	}
+	read(&deploy, &ci, now.Add(-3*time.Hour))
+	read(&deploy, &ci, now.Add(-time.Hour))
+	read(&deploy, &laptop, now.Add(-48*time.Hour))
+	read(&deploy, &laptop, now.Add(-40*24*time.Hour)) // outside the window
+	read(&other, &ci, now.Add(-time.Hour))            // another project
+
+	teamKeys, _ := json.Marshal([]TeamEncryptedKeyEntry{{TeamID: f.backend.ID.String(), EncryptedProjectKey: "a2V5"}})
+	rotation := models.PendingKeyRotation{ID: uuid.New(), ProjectID: f.project.ID, NewVersion: 2, TeamEncryptedKeys: string(teamKeys)}
+
+	impact, err := rotationImpact(db, &rotation, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if impact.TokensInvalidated != 2 || impact.Tokens[0].Name != "deploy" || impact.Tokens[1].Name != "idle" {
+		t.Errorf("tokens %+v", impact.Tokens)
+	}
+	if len(impact.Teams) != 1 || impact.Teams[0].Name != "Backend" || impact.Teams[0].Members != 1 {
+		t.Errorf("teams %+v", impact.Teams)
+	}
+	if len(impact.SecretManagerConfigs) != 1 || impact.SecretManagerConfigs[0].LinkedItems != 1 ||
+		impact.SecretManagerConfigs[0].LastSyncAt == nil || !impact.SecretManagerConfigs[0].LastSyncAt.Equal(synced) {
+		t.Errorf("secret manager configs %+v", impact.SecretManagerConfigs)
+	}
+
+	consumers := impact.CLIConsumers
+	if len(consumers) != 2 {
+		t.Fatalf("consumers %+v", consumers)
+	}
+	if *consumers[0].ClientIP != ci || consumers[0].Reads != 2 || consumers[0].TokenName != "deploy" {
+		t.Errorf("first consumer %+v", consumers[0])
+	}
+	if *consumers[1].ClientIP != laptop || consumers[1].Reads != 1 {
+		t.Errorf("second consumer %+v", consumers[1])
+	}
+}
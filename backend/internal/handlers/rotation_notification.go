@@ -0,0 +1,409 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"envie-backend/internal/alerts"
+	"envie-backend/internal/apierror"
+	"envie-backend/internal/database"
+	"envie-backend/internal/keypolicy"
+	"envie-backend/internal/models"
+	"envie-backend/internal/settings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RotationNotifier delivers rotation notifications outside the notification
+// center
+type RotationNotifier interface {
+	keypolicy.Webhook
+	SendEmail(to, subject, body string) error
+}
+
+// rotationNotifier emails rotation notifications and posts their events to the
+// policy webhook of the project; nil leaves only the notification center
+var rotationNotifier RotationNotifier = &alerts.Channels{
+	EmailSource:  func() *alerts.EmailConfig { return settings.Current().Email },
+	EgressPolicy: settings.EgressPolicy,
+}
+
+// Rotation events posted to the key rotation policy webhook of the project. A
+// committed rotation posts project.key_rotated instead (see keypolicy).
+const (
+	RotationEventPending  = "project.rotation_pending"
+	RotationEventExpiring = "project.rotation_expiring"
+	RotationEventExtended = "project.rotation_extended"
+	RotationEventRejected = "project.rotation_rejected"
+	RotationEventExpired  = "project.rotation_expired"
+)
+
+// Reminders approvers get before a rotation expires, see rotationReminderStage
+const (
+	rotationReminderHalfway = 1
+	rotationReminderFinal   = 2
+)
+
+// RotationEvent is the body of the rotation webhooks
+type RotationEvent struct {
+	Event             string    `json:"event"`
+	Text              string    `json:"text"` // for chat webhooks such as Slack's
+	RotationID        uuid.UUID `json:"rotationId"`
+	ProjectID         uuid.UUID `json:"projectId"`
+	ProjectName       string    `json:"projectName"`
+	OrganizationID    uuid.UUID `json:"organizationId"`
+	NewVersion        int       `json:"newVersion"`
+	InitiatedBy       uuid.UUID `json:"initiatedBy"`
+	RequiredApprovals int       `json:"requiredApprovals"`
+	Approvals         int64     `json:"approvals"`
+	ExpiresAt         time.Time `json:"expiresAt"`
+}
+
+// rotationNotice is a notification about a rotation: an entry in the notification
+// center of its recipients, an email to them, and a webhook event when event is
+// set
+type rotationNotice struct {
+	kind  string
+	title string
+	body  string
+	event string
+}
+
+// StartRotationReminders reminds approvers of pending rotations nearing their
+// expiry, and extends or expires the ones past it, every interval in the
+// background
+func StartRotationReminders(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := remindRotationApprovers(database.DB, time.Now()); err != nil {
+				log.Printf("Failed to send key rotation reminders: %v", err)
+			}
+		}
+	}()
+}
+
+// rotationReminderStage is how many reminders the approvers of a rotation should
+// have had at now: one when half its approval window is left, and a last one,
+// also posted to the webhook, when an eighth is left
+func rotationReminderStage(rotation *models.PendingKeyRotation, now time.Time) int {
+	window := rotation.ExpiresAt.Sub(rotation.CreatedAt)
+	left := rotation.ExpiresAt.Sub(now)
+	switch {
+	case left <= window/8:
+		return rotationReminderFinal
+	case left <= window/2:
+		return rotationReminderHalfway
+	default:
+		return 0
+	}
+}
+
+// remindRotationApprovers settles the pending rotations past their expiry and
+// sends the reminders due for the others. Reminders are claimed with a
+// conditional update, so with several instances running each is sent once.
+func remindRotationApprovers(db *gorm.DB, now time.Time) error {
+	var rotations []models.PendingKeyRotation
+	if err := db.Preload("Project").Where("status = ?", "pending").Find(&rotations).Error; err != nil {
+		return err
+	}
+
+	for i := range rotations {
+		rotation := &rotations[i]
+		if rotation.Project.ID == uuid.Nil {
+			continue // the project was deleted
+		}
+		if !now.Before(rotation.ExpiresAt) {
+			if _, err := settleExpiredRotation(db, rotation, &rotation.Project, now); err != nil {
+				log.Printf("Failed to settle expired key rotation %s: %v", rotation.ID, err)
+			}
+			continue
+		}
+		if isStale, _ := checkRotationStaleness(rotation); isStale {
+			db.Model(rotation).Update("status", "stale")
+			continue
+		}
+
+		stage := rotationReminderStage(rotation, now)
+		if stage <= rotation.RemindersSent {
+			continue
+		}
+		claim := db.Model(&models.PendingKeyRotation{}).
+			Where("id = ? AND reminders_sent = ?", rotation.ID, rotation.RemindersSent).
+			UpdateColumn("reminders_sent", stage)
+		if claim.Error != nil {
+			log.Printf("Failed to claim the reminder of key rotation %s: %v", rotation.ID, claim.Error)
+			continue
+		}
+		if claim.RowsAffected != 1 {
+			continue
+		}
+		rotation.RemindersSent = stage
+
+		if err := notifyRotationReminder(db, rotation, &rotation.Project, stage == rotationReminderFinal); err != nil {
+			log.Printf("Failed to remind the approvers of key rotation %s: %v", rotation.ID, err)
+		}
+	}
+	return nil
+}
+
+// expireRotation marks a rotation past its expiry as expired and tells its
+// initiator. The status is claimed with a conditional update, so the initiator
+// hears once whether a reminder run or an approval noticed first.
+func expireRotation(db *gorm.DB, rotation *models.PendingKeyRotation, project *models.Project) error {
+	claim := db.Model(&models.PendingKeyRotation{}).
+		Where("id = ? AND status = ?", rotation.ID, "pending").
+		Update("status", "expired")
+	if claim.Error != nil || claim.RowsAffected != 1 {
+		return claim.Error
+	}
+	rotation.Status = "expired"
+
+	initiator, err := rotationUsers(db, []uuid.UUID{rotation.InitiatedBy})
+	if err != nil {
+		return err
+	}
+	return deliverRotationNotice(db, rotation, project, initiator, rotationNotice{
+		kind:  models.NotificationRotationExpired,
+		title: "Key rotation of " + project.Name + " expired",
+		body: fmt.Sprintf("The rotation of project %s to key version %d expired at %s without enough approvals. Initiate it again to rotate the key.",
+			project.Name, rotation.NewVersion, rotation.ExpiresAt.UTC().Format(time.RFC1123)),
+		event: RotationEventExpired,
+	})
+}
+
+// notifyRotationPending tells the approvers of a rotation that was just initiated
+func notifyRotationPending(db *gorm.DB, rotation *models.PendingKeyRotation, project *models.Project) error {
+	approvers, err := rotationApprovers(db, rotation)
+	if err != nil {
+		return err
+	}
+	initiator := initiatorName(db, rotation)
+	return deliverRotationNotice(db, rotation, project, approvers, rotationNotice{
+		kind:  models.NotificationRotationPending,
+		title: "Key rotation of " + project.Name + " awaits your approval",
+		body: fmt.Sprintf("%s started rotating the key of project %s to version %d. It needs %d approvals and expires at %s.",
+			initiator, project.Name, rotation.NewVersion, rotation.RequiredApprovals, rotation.ExpiresAt.UTC().Format(time.RFC1123)),
+		event: RotationEventPending,
+	})
+}
+
+// notifyRotationReminder reminds the approvers yet to vote on a rotation; the
+// final reminder also goes to the webhook
+func notifyRotationReminder(db *gorm.DB, rotation *models.PendingKeyRotation, project *models.Project, final bool) error {
+	approvers, err := rotationApprovers(db, rotation)
+	if err != nil {
+		return err
+	}
+	var approvals int64
+	if err := db.Model(&models.KeyRotationApproval{}).
+		Where("rotation_id = ? AND approved = ?", rotation.ID, true).
+		Count(&approvals).Error; err != nil {
+		return err
+	}
+
+	notice := rotationNotice{
+		kind:  models.NotificationRotationReminder,
+		title: "Key rotation of " + project.Name + " expires soon",
+		body: fmt.Sprintf("The rotation of project %s to key version %d, started by %s, still needs %d approvals and expires at %s. If it expires, it has to be initiated again.",
+			project.Name, rotation.NewVersion, initiatorName(db, rotation), int64(rotation.RequiredApprovals)-approvals, rotation.ExpiresAt.UTC().Format(time.RFC1123)),
+	}
+	if final {
+		notice.title = "Last reminder: key rotation of " + project.Name + " expires soon"
+		notice.event = RotationEventExpiring
+	}
+	return deliverRotationNotice(db, rotation, project, approvers, notice)
+}
+
+// notifyRotationExtended tells the initiator and the approvers yet to vote that a
+// rotation with some approvals was extended at expiry
+func notifyRotationExtended(db *gorm.DB, rotation *models.PendingKeyRotation, project *models.Project, approvals int64) error {
+	users, err := rotationApprovers(db, rotation)
+	if err != nil {
+		return err
+	}
+	initiator, err := rotationUsers(db, []uuid.UUID{rotation.InitiatedBy})
+	if err != nil {
+		return err
+	}
+	return deliverRotationNotice(db, rotation, project, append(users, initiator...), rotationNotice{
+		kind:  models.NotificationRotationExtended,
+		title: "Key rotation of " + project.Name + " extended",
+		body: fmt.Sprintf("The rotation of project %s to key version %d had %d of %d approvals when it expired, so it was extended until %s.",
+			project.Name, rotation.NewVersion, approvals, rotation.RequiredApprovals, rotation.ExpiresAt.UTC().Format(time.RFC1123)),
+		event: RotationEventExtended,
+	})
+}
+
+// notifyRotationApproved tells the initiator that their rotation was approved and
+// committed. The webhook gets project.key_rotated from commitRotation.
+func notifyRotationApproved(db *gorm.DB, rotation *models.PendingKeyRotation, project *models.Project) error {
+	initiator, err := rotationUsers(db, []uuid.UUID{rotation.InitiatedBy})
+	if err != nil {
+		return err
+	}
+	return deliverRotationNotice(db, rotation, project, initiator, rotationNotice{
+		kind:  models.NotificationRotationApproved,
+		title: "Key rotation of " + project.Name + " approved",
+		body:  fmt.Sprintf("The rotation of project %s to key version %d was approved and committed. CLI tokens of the project were revoked.", project.Name, rotation.NewVersion),
+	})
+}
+
+// notifyRotationRejected tells the initiator who rejected their rotation and why
+func notifyRotationRejected(db *gorm.DB, rotation *models.PendingKeyRotation, project *models.Project, rejectedBy uuid.UUID, comment string) error {
+	users, err := rotationUsers(db, []uuid.UUID{rotation.InitiatedBy, rejectedBy})
+	if err != nil {
+		return err
+	}
+	var initiator []models.User
+	rejecter := "An approver"
+	for _, user := range users {
+		if user.ID == rotation.InitiatedBy {
+			initiator = append(initiator, user)
+		} else {
+			rejecter = user.Name
+		}
+	}
+
+	body := fmt.Sprintf("%s rejected the rotation of project %s to key version %d.", rejecter, project.Name, rotation.NewVersion)
+	if comment != "" {
+		body += " Comment: " + comment
+	}
+	return deliverRotationNotice(db, rotation, project, initiator, rotationNotice{
+		kind:  models.NotificationRotationRejected,
+		title: "Key rotation of " + project.Name + " rejected",
+		body:  body,
+		event: RotationEventRejected,
+	})
+}
+
+// rotationApprovers lists the users who can still vote on a rotation: those with
+// rotation.approve in its project, other than the initiator and who already voted
+func rotationApprovers(db *gorm.DB, rotation *models.PendingKeyRotation) ([]models.User, error) {
+	var project models.Project
+	if err := db.Select("organization_id").First(&project, "id = ?", rotation.ProjectID).Error; err != nil {
+		return nil, err
+	}
+
+	var candidates []uuid.UUID
+	if err := db.Model(&models.OrganizationUser{}).Where("organization_id = ?", project.OrganizationID).
+		Pluck("user_id", &candidates).Error; err != nil {
+		return nil, err
+	}
+	var voters []uuid.UUID
+	if err := db.Model(&models.KeyRotationApproval{}).Where("rotation_id = ?", rotation.ID).
+		Pluck("user_id", &voters).Error; err != nil {
+		return nil, err
+	}
+	excluded := map[uuid.UUID]bool{rotation.InitiatedBy: true}
+	for _, voter := range voters {
+		excluded[voter] = true
+	}
+
+	var approverIDs []uuid.UUID
+	for _, userID := range candidates {
+		if excluded[userID] {
+			continue
+		}
+		access, err := GetUserProjectAccess(userID, rotation.ProjectID)
+		if errors.Is(err, apierror.ErrProjectAccessDenied) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if access.Can(models.PermissionRotationApprove) {
+			approverIDs = append(approverIDs, userID)
+		}
+	}
+	return rotationUsers(db, approverIDs)
+}
+
+// rotationUsers loads the users with the given IDs, leaving out deleted accounts
+func rotationUsers(db *gorm.DB, ids []uuid.UUID) ([]models.User, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var users []models.User
+	if err := db.Select("id, name, email").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func initiatorName(db *gorm.DB, rotation *models.PendingKeyRotation) string {
+	var user models.User
+	if err := db.Select("name").First(&user, "id = ?", rotation.InitiatedBy).Error; err != nil {
+		return "A project admin"
+	}
+	return user.Name
+}
+
+// deliverRotationNotice adds the notice to the notification center of users, then
+// emails them and posts its webhook event in the background
+func deliverRotationNotice(db *gorm.DB, rotation *models.PendingKeyRotation, project *models.Project, users []models.User, notice rotationNotice) error {
+	if len(users) > 0 {
+		notifications := make([]models.Notification, len(users))
+		for i, user := range users {
+			notifications[i] = models.Notification{
+				UserID:         user.ID,
+				Kind:           notice.kind,
+				Title:          notice.title,
+				Body:           notice.body,
+				OrganizationID: &project.OrganizationID,
+				ProjectID:      &project.ID,
+			}
+		}
+		if err := db.Create(&notifications).Error; err != nil {
+			return err
+		}
+	}
+
+	if rotationNotifier == nil {
+		return nil
+	}
+	event := RotationEvent{
+		Event:             notice.event,
+		Text:              "Envie: " + notice.body,
+		RotationID:        rotation.ID,
+		ProjectID:         project.ID,
+		ProjectName:       project.Name,
+		OrganizationID:    project.OrganizationID,
+		NewVersion:        rotation.NewVersion,
+		InitiatedBy:       rotation.InitiatedBy,
+		RequiredApprovals: rotation.RequiredApprovals,
+		ExpiresAt:         rotation.ExpiresAt,
+	}
+	go func() {
+		for _, user := range users {
+			err := rotationNotifier.SendEmail(user.Email, notice.title, notice.body)
+			if errors.Is(err, alerts.ErrEmailNotConfigured) {
+				break
+			}
+			if err != nil {
+				log.Printf("Failed to email key rotation notification to user %s: %v", user.ID, err)
+			}
+		}
+
+		if event.Event == "" {
+			return
+		}
+		webhookURL, err := keypolicy.WebhookURL(database.DB, project)
+		if err == nil && webhookURL != nil {
+			err = database.DB.Model(&models.KeyRotationApproval{}).
+				Where("rotation_id = ? AND approved = ?", rotation.ID, true).
+				Count(&event.Approvals).Error
+		}
+		if err == nil && webhookURL != nil {
+			err = rotationNotifier.PostWebhook(*webhookURL, event)
+		}
+		if err != nil {
+			log.Printf("Failed to post %s webhook for project %s: %v", event.Event, project.ID, err)
+		}
+	}()
+	return nil
+}
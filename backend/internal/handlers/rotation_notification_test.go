@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+)
+
+func TestRotationReminderStage(t *testing.T) {
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	rotation := &models.PendingKeyRotation{CreatedAt: created, ExpiresAt: created.Add(24 * time.Hour)}
+
+	tests := []struct {
+		elapsed time.Duration
+		want    int
+	}{
+		{time.Hour, 0},
+		{11 * time.Hour, 0},
+		{12 * time.Hour, rotationReminderHalfway},
+		{20 * time.Hour, rotationReminderHalfway},
+		{21 * time.Hour, rotationReminderFinal},
+		{23 * time.Hour, rotationReminderFinal},
+	}
+	for _, tt := range tests {
+		if got := rotationReminderStage(rotation, created.Add(tt.elapsed)); got != tt.want {
+			t.Errorf("after %s: stage %d, want %d", tt.elapsed, got, tt.want)
+		}
+	}
+}
+
+func TestRotationNotifications(t *testing.T) {
+	f := newAccessFixture(t)
+	previous := rotationNotifier
+	rotationNotifier = nil
+	t.Cleanup(func() { rotationNotifier = previous })
+
+	now := time.Now()
+	rotation := createTestRotation(t, f, now)
+
+	received := func(kind string) map[string]int {
+		var notifications []models.Notification
+		if err := database.DB.Where("kind = ?", kind).Find(&notifications).Error; err != nil {
+			t.Fatal(err)
+		}
+		users := map[string]int{}
+		for _, n := range notifications {
+			switch n.UserID {
+			case f.member.ID:
+				users["member"]++
+			case f.admin.ID:
+				users["admin"]++
+			default:
+				users["other"]++
+			}
+		}
+		return users
+	}
+
+	// Only the admin holds rotation.approve; the initiator never votes
+	if err := notifyRotationPending(database.DB, &rotation, &f.project); err != nil {
+		t.Fatal(err)
+	}
+	if got := received(models.NotificationRotationPending); len(got) != 1 || got["admin"] != 1 {
+		t.Errorf("pending notifications went to %v, want the admin only", got)
+	}
+
+	for _, at := range []time.Duration{time.Hour, 13 * time.Hour, 14 * time.Hour, 22 * time.Hour, 23 * time.Hour} {
+		if err := remindRotationApprovers(database.DB, now.Add(at)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := received(models.NotificationRotationReminder); len(got) != 1 || got["admin"] != 2 {
+		t.Errorf("reminders went to %v, want two to the admin", got)
+	}
+
+	if err := remindRotationApprovers(database.DB, now.Add(25*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := remindRotationApprovers(database.DB, now.Add(26*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := received(models.NotificationRotationExpired); len(got) != 1 || got["member"] != 1 {
+		t.Errorf("expiry notifications went to %v, want one to the initiator", got)
+	}
+	var status string
+	database.DB.Model(&models.PendingKeyRotation{}).Where("id = ?", rotation.ID).Pluck("status", &status)
+	if status != "expired" {
+		t.Errorf("status %q, want expired", status)
+	}
+}
+
+// createTestRotation creates a rotation of the fixture's project by the member,
+// initiated at now and waiting a day for one approval
+func createTestRotation(t *testing.T, f accessFixture, now time.Time) models.PendingKeyRotation {
+	t.Helper()
+	items, teamIDs, secretManagerConfigIDs, hash := getProjectSnapshot(f.project.ID)
+	itemIDs, _ := json.Marshal(extractConfigItemIDs(items))
+	teams, _ := json.Marshal(teamIDs)
+	secretManagerConfigs, _ := json.Marshal(secretManagerConfigIDs)
+
+	rotation := models.PendingKeyRotation{
+		ProjectID:         f.project.ID,
+		InitiatedBy:       f.member.ID,
+		NewVersion:        2,
+		Status:            "pending",
+		RequiredApprovals: 1,
+		ExpiresAt:         now.Add(24 * time.Hour),
+		CreatedAt:         now,
+
+		SnapshotConfigItemIDs:        string(itemIDs),
+		SnapshotTeamIDs:              string(teams),
+		SnapshotSecretManagerConfIDs: string(secretManagerConfigs),
+		SnapshotConfigItemsHash:      hash,
+	}
+	if err := database.DB.Create(&rotation).Error; err != nil {
+		t.Fatal(err)
+	}
+	return rotation
+}
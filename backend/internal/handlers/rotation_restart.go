@@ -0,0 +1,383 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RotationChanges - what changed in a project since a rotation took its snapshot.
+// Restarting a stale rotation takes values for the added and changed items, keys
+// for the added teams and files, and reuses the rest of the stale payload.
+type RotationChanges struct {
+	RotationID uuid.UUID `json:"rotationId"`
+	Status     string    `json:"status"`
+	Stale      bool      `json:"stale"`
+	Reason     string    `json:"reason,omitempty"`
+	NewVersion int       `json:"newVersion"`
+
+	AddedConfigItems            []RotationResource `json:"addedConfigItems"`
+	ChangedConfigItems          []RotationResource `json:"changedConfigItems"`
+	RemovedConfigItems          []RotationResource `json:"removedConfigItems"`
+	AddedTeams                  []RotationResource `json:"addedTeams"`
+	RemovedTeams                []RotationResource `json:"removedTeams"`
+	AddedFiles                  []RotationResource `json:"addedFiles"`
+	RemovedFiles                []RotationResource `json:"removedFiles"`
+	AddedSecretManagerConfigs   []RotationResource `json:"addedSecretManagerConfigs"`   // snapshotted only, nothing to re-encrypt
+	RemovedSecretManagerConfigs []RotationResource `json:"removedSecretManagerConfigs"` // snapshotted only, nothing to re-encrypt
+}
+
+// RestartRotationRequest - the changes of a stale rotation, encrypted with the key
+// it introduced: values of the added and changed items, the project key for the
+// added teams and keys of added files
+type RestartRotationRequest struct {
+	TeamEncryptedKeys      []TeamEncryptedKeyEntry `json:"teamEncryptedKeys" binding:"dive"`
+	ReEncryptedConfigItems []ReEncryptedConfigItem `json:"reEncryptedConfigItems" binding:"dive"`
+	ReEncryptedFileFEKs    []ReEncryptedFileFEK    `json:"reEncryptedFileFEKs" binding:"dive"`
+	ExpiresInHours         int                     `json:"expiresInHours" binding:"min=0"`
+}
+
+// GetRotationChanges lists what changed in the project since a pending or stale
+// rotation took its snapshot
+func GetRotationChanges(c *gin.Context) {
+	rotation, ok := loadProjectRotation(c)
+	if !ok {
+		return
+	}
+	if rotation.Status != "pending" && rotation.Status != "stale" {
+		RespondConflict(c, "The rotation is "+rotation.Status+"; only pending and stale rotations are compared with the project")
+		return
+	}
+
+	changes, err := rotationChanges(requestDB(c), rotation)
+	if err != nil {
+		RespondInternalError(c, "Failed to compare the rotation with the project")
+		return
+	}
+	RespondOK(c, changes)
+}
+
+// RestartKeyRotation replaces a stale rotation with a new pending one, taking
+// only what changed since its snapshot (see GetRotationChanges). Approvals of the
+// stale rotation don't carry over.
+func RestartKeyRotation(c *gin.Context) {
+	access := CurrentProjectAccess(c)
+	userID, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	if access.MasksSensitive() {
+		RespondForbidden(c, "Rotating the key of a project that restricts sensitive values requires "+models.PermissionSecretsReveal)
+		return
+	}
+
+	rotation, ok := loadProjectRotation(c)
+	if !ok {
+		return
+	}
+	if rotation.InitiatedBy != userID {
+		RespondForbidden(c, "Only the initiator can restart a rotation")
+		return
+	}
+	if rotation.Status == "pending" {
+		if isStale, _ := checkRotationStaleness(rotation); isStale {
+			requestDB(c).Model(rotation).Update("status", "stale")
+			rotation.Status = "stale"
+		}
+	}
+	if rotation.Status != "stale" {
+		RespondConflict(c, "The rotation is "+rotation.Status+"; only stale rotations can be restarted")
+		return
+	}
+	// The stale payload is encrypted with the key after the one the project had
+	if rotation.NewVersion != access.Project.KeyVersion+1 {
+		RespondConflict(c, "The project key changed since the rotation; initiate a new one")
+		return
+	}
+	if !requireNoPendingRotation(c, access.Project.ID) {
+		return
+	}
+
+	var req RestartRotationRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	changes, err := rotationChanges(requestDB(c), rotation)
+	if err != nil {
+		RespondInternalError(c, "Failed to compare the rotation with the project")
+		return
+	}
+	merged, message := mergeRotationChanges(rotation, changes, req)
+	if message != "" {
+		RespondBadRequest(c, message)
+		return
+	}
+
+	startRotation(c, userID, merged, &rotation.ID)
+}
+
+// loadProjectRotation loads the rotation of the rotationId parameter in the
+// current project. If it fails, it sends an error response automatically.
+func loadProjectRotation(c *gin.Context) (*models.PendingKeyRotation, bool) {
+	rotationID, ok := ParseUUIDParam(c, "rotationId", "rotation")
+	if !ok {
+		return nil, false
+	}
+	var rotation models.PendingKeyRotation
+	err := requestDB(c).First(&rotation, "id = ? AND project_id = ?", rotationID, CurrentProjectAccess(c).Project.ID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		RespondNotFound(c, "Rotation not found")
+		return nil, false
+	}
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch rotation")
+		return nil, false
+	}
+	return &rotation, true
+}
+
+// rotationChanges compares the snapshot of a rotation with its project. Changed
+// items are told apart by their hashes; rotations from before those were kept
+// count every item updated since they were initiated.
+func rotationChanges(db *gorm.DB, rotation *models.PendingKeyRotation) (RotationChanges, error) {
+	changes := RotationChanges{
+		RotationID:                  rotation.ID,
+		Status:                      rotation.Status,
+		Stale:                       rotation.Status == "stale",
+		NewVersion:                  rotation.NewVersion,
+		AddedConfigItems:            []RotationResource{},
+		ChangedConfigItems:          []RotationResource{},
+		AddedTeams:                  []RotationResource{},
+		AddedFiles:                  []RotationResource{},
+		AddedSecretManagerConfigs:   []RotationResource{},
+		RemovedSecretManagerConfigs: []RotationResource{},
+	}
+	if isStale, reason := checkRotationStaleness(rotation); isStale {
+		changes.Stale, changes.Reason = true, reason
+	}
+
+	items, teamIDs, secretManagerConfigIDs, _ := getProjectSnapshot(rotation.ProjectID)
+
+	var snapshotItemIDs, snapshotTeamIDs, snapshotSecretManagerConfigIDs []string
+	json.Unmarshal([]byte(rotation.SnapshotConfigItemIDs), &snapshotItemIDs)
+	json.Unmarshal([]byte(rotation.SnapshotTeamIDs), &snapshotTeamIDs)
+	json.Unmarshal([]byte(rotation.SnapshotSecretManagerConfIDs), &snapshotSecretManagerConfigIDs)
+	var snapshotHashes map[string]string
+	json.Unmarshal([]byte(rotation.SnapshotConfigItemHashes), &snapshotHashes)
+	var snapshotFEKs []ReEncryptedFileFEK
+	json.Unmarshal([]byte(rotation.EncryptedFileFEKsSnapshot), &snapshotFEKs)
+	snapshotFileIDs := make([]string, len(snapshotFEKs))
+	for i, fek := range snapshotFEKs {
+		snapshotFileIDs[i] = fek.ID
+	}
+
+	inSnapshot := stringSet(snapshotItemIDs)
+	currentHashes := configItemHashes(items)
+	currentItemIDs := make([]string, len(items))
+	for i, item := range items {
+		id := item.ID.String()
+		currentItemIDs[i] = id
+		resource := RotationResource{ID: id, Name: item.Name}
+		switch {
+		case !inSnapshot[id]:
+			changes.AddedConfigItems = append(changes.AddedConfigItems, resource)
+		case snapshotHashes != nil && snapshotHashes[id] != currentHashes[id]:
+			changes.ChangedConfigItems = append(changes.ChangedConfigItems, resource)
+		case snapshotHashes == nil && item.UpdatedAt.After(rotation.CreatedAt):
+			changes.ChangedConfigItems = append(changes.ChangedConfigItems, resource)
+		}
+	}
+	sortRotationResources(changes.AddedConfigItems)
+	sortRotationResources(changes.ChangedConfigItems)
+
+	var files []models.ProjectFile
+	if err := db.Select("id, name").Where("project_id = ?", rotation.ProjectID).Find(&files).Error; err != nil {
+		return changes, err
+	}
+	fileIDs := make([]string, len(files))
+	for i, file := range files {
+		fileIDs[i] = file.ID.String()
+	}
+
+	var err error
+	if changes.RemovedConfigItems, err = removedRotationResources(db, &models.ConfigItem{}, snapshotItemIDs, currentItemIDs); err != nil {
+		return changes, err
+	}
+	if changes.AddedTeams, err = removedRotationResources(db, &models.Team{}, teamIDs, snapshotTeamIDs); err != nil {
+		return changes, err
+	}
+	if changes.RemovedTeams, err = removedRotationResources(db, &models.Team{}, snapshotTeamIDs, teamIDs); err != nil {
+		return changes, err
+	}
+	if changes.AddedFiles, err = removedRotationResources(db, &models.ProjectFile{}, fileIDs, snapshotFileIDs); err != nil {
+		return changes, err
+	}
+	if changes.RemovedFiles, err = removedRotationResources(db, &models.ProjectFile{}, snapshotFileIDs, fileIDs); err != nil {
+		return changes, err
+	}
+	if changes.AddedSecretManagerConfigs, err = removedRotationResources(db, &models.SecretManagerConfig{}, secretManagerConfigIDs, snapshotSecretManagerConfigIDs); err != nil {
+		return changes, err
+	}
+	if changes.RemovedSecretManagerConfigs, err = removedRotationResources(db, &models.SecretManagerConfig{}, snapshotSecretManagerConfigIDs, secretManagerConfigIDs); err != nil {
+		return changes, err
+	}
+	return changes, nil
+}
+
+// removedRotationResources returns the IDs in from that aren't in to, named after
+// the rows of model they identify, deleted ones included
+func removedRotationResources(db *gorm.DB, model any, from, to []string) ([]RotationResource, error) {
+	kept := stringSet(to)
+	var ids []string
+	for _, id := range from {
+		if !kept[id] {
+			ids = append(ids, id)
+		}
+	}
+	resources := make([]RotationResource, len(ids))
+	if len(ids) == 0 {
+		return resources, nil
+	}
+
+	var rows []struct {
+		ID   uuid.UUID
+		Name string
+	}
+	if err := db.Unscoped().Model(model).Select("id, name").Where("id IN ?", ids).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(rows))
+	for _, row := range rows {
+		names[row.ID.String()] = row.Name
+	}
+	for i, id := range ids {
+		resources[i] = RotationResource{ID: id, Name: names[id]}
+	}
+	sortRotationResources(resources)
+	return resources, nil
+}
+
+// mergeRotationChanges applies a restart request to the payload of a stale
+// rotation: removed items, teams and files are dropped, and the request's entries
+// are added or replace the stale ones. Every added or changed item and added
+// team needs an entry; the message says which doesn't.
+func mergeRotationChanges(rotation *models.PendingKeyRotation, changes RotationChanges, req RestartRotationRequest) (InitiateRotationRequest, string) {
+	var items []ReEncryptedConfigItem
+	json.Unmarshal([]byte(rotation.EncryptedConfigsSnapshot), &items)
+	var teams []TeamEncryptedKeyEntry
+	json.Unmarshal([]byte(rotation.TeamEncryptedKeys), &teams)
+	var feks []ReEncryptedFileFEK
+	json.Unmarshal([]byte(rotation.EncryptedFileFEKsSnapshot), &feks)
+
+	itemValues := map[string]string{}
+	for _, item := range items {
+		itemValues[item.ID] = item.Value
+	}
+	for _, removed := range changes.RemovedConfigItems {
+		delete(itemValues, removed.ID)
+	}
+	submitted := map[string]bool{}
+	for _, item := range req.ReEncryptedConfigItems {
+		itemValues[item.ID] = item.Value
+		submitted[item.ID] = true
+	}
+	for _, resource := range append(changes.AddedConfigItems, changes.ChangedConfigItems...) {
+		if !submitted[resource.ID] {
+			return InitiateRotationRequest{}, "Missing re-encrypted value for " + resource.Name
+		}
+	}
+
+	teamKeys := map[string]string{}
+	for _, team := range teams {
+		teamKeys[team.TeamID] = team.EncryptedProjectKey
+	}
+	for _, removed := range changes.RemovedTeams {
+		delete(teamKeys, removed.ID)
+	}
+	submitted = map[string]bool{}
+	for _, team := range req.TeamEncryptedKeys {
+		teamKeys[team.TeamID] = team.EncryptedProjectKey
+		submitted[team.TeamID] = true
+	}
+	for _, resource := range changes.AddedTeams {
+		if !submitted[resource.ID] {
+			return InitiateRotationRequest{}, "Missing encrypted key for team: " + resource.Name
+		}
+	}
+
+	fileKeys := map[string]string{}
+	for _, fek := range feks {
+		fileKeys[fek.ID] = fek.EncryptedFEK
+	}
+	for _, removed := range changes.RemovedFiles {
+		delete(fileKeys, removed.ID)
+	}
+	for _, fek := range req.ReEncryptedFileFEKs {
+		fileKeys[fek.ID] = fek.EncryptedFEK
+	}
+
+	merged := InitiateRotationRequest{
+		TeamEncryptedKeys:      []TeamEncryptedKeyEntry{},
+		ReEncryptedConfigItems: []ReEncryptedConfigItem{},
+		ReEncryptedFileFEKs:    []ReEncryptedFileFEK{},
+		ExpiresInHours:         req.ExpiresInHours,
+	}
+	for _, id := range sortedKeys(itemValues) {
+		merged.ReEncryptedConfigItems = append(merged.ReEncryptedConfigItems, ReEncryptedConfigItem{ID: id, Value: itemValues[id]})
+	}
+	for _, id := range sortedKeys(teamKeys) {
+		merged.TeamEncryptedKeys = append(merged.TeamEncryptedKeys, TeamEncryptedKeyEntry{TeamID: id, EncryptedProjectKey: teamKeys[id]})
+	}
+	for _, id := range sortedKeys(fileKeys) {
+		merged.ReEncryptedFileFEKs = append(merged.ReEncryptedFileFEKs, ReEncryptedFileFEK{ID: id, EncryptedFEK: fileKeys[id]})
+	}
+	return merged, ""
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortRotationResources(resources []RotationResource) {
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].Name < resources[j].Name
+	})
+}
+
+// restartableRotationID returns the latest stale rotation of the project that
+// can still be restarted: not expired, not restarted yet, and meant for the key
+// version after the project's
+func restartableRotationID(db *gorm.DB, project *models.Project) *uuid.UUID {
+	var rotation models.PendingKeyRotation
+	err := db.Select("id").
+		Where("project_id = ? AND status = ? AND new_version = ? AND expires_at > ?", project.ID, "stale", project.KeyVersion+1, time.Now()).
+		Where("id NOT IN (?)", db.Model(&models.PendingKeyRotation{}).Select("restarted_from_id").Where("restarted_from_id IS NOT NULL")).
+		Order("created_at DESC").
+		First(&rotation).Error
+	if err != nil {
+		return nil
+	}
+	return &rotation.ID
+}
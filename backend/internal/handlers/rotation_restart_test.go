@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestRotationChanges(t *testing.T) {
+	f := newAccessFixture(t)
+	db := database.DB
+
+	kept := models.ConfigItem{ID: uuid.New(), ProjectID: f.project.ID, Name: "KEPT", Value: "a2VwdA==", CreatedBy: f.member.ID, UpdatedBy: f.member.ID}
+	changed := models.ConfigItem{ID: uuid.New(), ProjectID: f.project.ID, Name: "CHANGED", Value: "b2xk", CreatedBy: f.member.ID, UpdatedBy: f.member.ID}
+	removed := models.ConfigItem{ID: uuid.New(), ProjectID: f.project.ID, Name: "REMOVED", Value: "Z29uZQ==", CreatedBy: f.member.ID, UpdatedBy: f.member.ID}
+	file := models.ProjectFile{ID: uuid.New(), ProjectID: f.project.ID, Name: "cert.pem", S3Key: "k", EncryptedFEK: "ZmVr", UploadedBy: f.member.ID}
+	for _, row := range []any{&kept, &changed, &removed, &file} {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The rotation as InitiateKeyRotation stores it
+	items, teamIDs, secretManagerConfigIDs, hash := getProjectSnapshot(f.project.ID)
+	itemIDs, _ := json.Marshal(extractConfigItemIDs(items))
+	hashes, _ := json.Marshal(configItemHashes(items))
+	teams, _ := json.Marshal(teamIDs)
+	secretManagerConfigs, _ := json.Marshal(secretManagerConfigIDs)
+	payload, _ := json.Marshal([]ReEncryptedConfigItem{{ID: kept.ID.String(), Value: "new-kept"}, {ID: changed.ID.String(), Value: "new-old"}, {ID: removed.ID.String(), Value: "new-gone"}})
+	teamKeys, _ := json.Marshal([]TeamEncryptedKeyEntry{{TeamID: f.backend.ID.String(), EncryptedProjectKey: "backend-key"}})
+	rotation := models.PendingKeyRotation{
+		ProjectID:                    f.project.ID,
+		InitiatedBy:                  f.member.ID,
+		NewVersion:                   f.project.KeyVersion + 1,
+		Status:                       "pending",
+		ExpiresAt:                    time.Now().Add(time.Hour),
+		EncryptedConfigsSnapshot:     string(payload),
+		TeamEncryptedKeys:            string(teamKeys),
+		EncryptedFileFEKsSnapshot:    "[]",
+		SnapshotConfigItemIDs:        string(itemIDs),
+		SnapshotConfigItemHashes:     string(hashes),
+		SnapshotTeamIDs:              string(teams),
+		SnapshotSecretManagerConfIDs: string(secretManagerConfigs),
+		SnapshotConfigItemsHash:      hash,
+	}
+	if err := db.Create(&rotation).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Then the config changes and the Ops team gets access
+	added := models.ConfigItem{ID: uuid.New(), ProjectID: f.project.ID, Name: "ADDED", Value: "bmV3", CreatedBy: f.member.ID, UpdatedBy: f.member.ID}
+	db.Create(&added)
+	db.Model(&changed).Update("value", "Y2hhbmdlZA==")
+	db.Delete(&removed)
+	db.Create(&models.TeamProject{TeamID: f.ops.ID, ProjectID: f.project.ID, EncryptedProjectKey: "a2V5"})
+
+	changes, err := rotationChanges(db, &rotation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := func(resources []RotationResource) string {
+		list := make([]string, len(resources))
+		for i, resource := range resources {
+			list[i] = resource.Name
+		}
+		return strings.Join(list, ",")
+	}
+	if !changes.Stale || names(changes.AddedConfigItems) != "ADDED" || names(changes.ChangedConfigItems) != "CHANGED" ||
+		names(changes.RemovedConfigItems) != "REMOVED" || names(changes.AddedTeams) != "Ops" || len(changes.RemovedTeams) != 0 ||
+		names(changes.AddedFiles) != "cert.pem" {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+
+	// Every added and changed item needs a value, and added teams a key
+	req := RestartRotationRequest{
+		ReEncryptedConfigItems: []ReEncryptedConfigItem{{ID: added.ID.String(), Value: "new-added"}},
+		TeamEncryptedKeys:      []TeamEncryptedKeyEntry{{TeamID: f.ops.ID.String(), EncryptedProjectKey: "ops-key"}},
+	}
+	if _, message := mergeRotationChanges(&rotation, changes, req); !strings.Contains(message, "CHANGED") {
+		t.Errorf("missing changed item: %q", message)
+	}
+	req.ReEncryptedConfigItems = append(req.ReEncryptedConfigItems, ReEncryptedConfigItem{ID: changed.ID.String(), Value: "new-changed"})
+	req.ReEncryptedFileFEKs = []ReEncryptedFileFEK{{ID: file.ID.String(), EncryptedFEK: "new-fek"}}
+	merged, message := mergeRotationChanges(&rotation, changes, req)
+	if message != "" {
+		t.Fatal(message)
+	}
+
+	values := map[string]string{}
+	for _, item := range merged.ReEncryptedConfigItems {
+		values[item.ID] = item.Value
+	}
+	if len(values) != 3 || values[kept.ID.String()] != "new-kept" || values[changed.ID.String()] != "new-changed" || values[added.ID.String()] != "new-added" {
+		t.Errorf("merged items %v", values)
+	}
+	current, currentTeams, _, _ := getProjectSnapshot(f.project.ID)
+	if err := validateConfigItemsComplete(merged.ReEncryptedConfigItems, current); err != nil {
+		t.Error(err)
+	}
+	if err := validateTeamsComplete(merged.TeamEncryptedKeys, currentTeams); err != nil {
+		t.Error(err)
+	}
+	if len(merged.ReEncryptedFileFEKs) != 1 {
+		t.Errorf("merged file keys %v", merged.ReEncryptedFileFEKs)
+	}
+
+	// Once marked stale, the rotation is offered for a restart until replaced
+	db.Model(&rotation).Update("status", "stale")
+	if id := restartableRotationID(db, &f.project); id == nil || *id != rotation.ID {
+		t.Errorf("restartable rotation %v, want %s", id, rotation.ID)
+	}
+	db.Create(&models.PendingKeyRotation{ProjectID: f.project.ID, InitiatedBy: f.member.ID, NewVersion: rotation.NewVersion, Status: "pending", RestartedFromID: &rotation.ID})
+	if id := restartableRotationID(db, &f.project); id != nil {
+		t.Errorf("restarted rotation still offered: %s", id)
+	}
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"envie-backend/internal/keypolicy"
+	"envie-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultRotationWindow is how long rotations wait for approval unless a
+	// policy sets otherwise
+	defaultRotationWindow = 24 * time.Hour
+
+	// maxRotationExtensions bounds how often a partially approved rotation is
+	// extended at expiry
+	maxRotationExtensions = 3
+)
+
+// rotationWindows returns the approval window rotations get under a policy, which
+// may be nil, and the longest one a rotation may ask for
+func rotationWindows(policy *models.KeyRotationPolicy) (window, longest time.Duration) {
+	window = defaultRotationWindow
+	if policy != nil && policy.ApprovalWindowHours > 0 {
+		window = time.Duration(policy.ApprovalWindowHours) * time.Hour
+	}
+	longest = window
+	if policy != nil && time.Duration(policy.MaxApprovalWindowHours)*time.Hour > longest {
+		longest = time.Duration(policy.MaxApprovalWindowHours) * time.Hour
+	}
+	return window, longest
+}
+
+// rotationWindow returns the approval window of a rotation asking for
+// requestedHours, 0 for the policy's. The message is set when the policy doesn't
+// allow a window that long.
+func rotationWindow(policy *models.KeyRotationPolicy, requestedHours int) (time.Duration, string) {
+	window, longest := rotationWindows(policy)
+	if requestedHours == 0 {
+		return window, ""
+	}
+	requested := time.Duration(requestedHours) * time.Hour
+	if requested > longest {
+		return 0, fmt.Sprintf("expiresInHours can be at most %d in this project", int(longest.Hours()))
+	}
+	return requested, ""
+}
+
+// secondsLeft is the whole seconds from now until expiresAt, 0 once it passed
+func secondsLeft(expiresAt, now time.Time) int {
+	if !now.Before(expiresAt) {
+		return 0
+	}
+	return int(expiresAt.Sub(now).Seconds())
+}
+
+// settleExpiredRotation extends a rotation past its expiry when its policy allows
+// (see extendRotation) and expires it otherwise. It reports whether the rotation
+// is still pending.
+func settleExpiredRotation(db *gorm.DB, rotation *models.PendingKeyRotation, project *models.Project, now time.Time) (bool, error) {
+	extended, err := extendRotation(db, rotation, project, now)
+	if err != nil || extended {
+		return extended, err
+	}
+	return false, expireRotation(db, rotation, project)
+}
+
+// extendRotation pushes the expiry of a rotation with some but not all of its
+// approvals AutoExtendHours of its policy past now, at most maxRotationExtensions
+// times, and tells the initiator and approvers. It reports whether the rotation
+// is pending again; the extension is claimed with a conditional update, and a
+// lost claim reports what the winner left.
+func extendRotation(db *gorm.DB, rotation *models.PendingKeyRotation, project *models.Project, now time.Time) (bool, error) {
+	if rotation.Extensions >= maxRotationExtensions {
+		return false, nil
+	}
+	policy, err := keypolicy.PolicyFor(db, project)
+	if err != nil || policy == nil || policy.AutoExtendHours == 0 {
+		return false, err
+	}
+	var approvals int64
+	if err := db.Model(&models.KeyRotationApproval{}).
+		Where("rotation_id = ? AND approved = ?", rotation.ID, true).
+		Count(&approvals).Error; err != nil {
+		return false, err
+	}
+	if approvals == 0 {
+		return false, nil
+	}
+
+	// The last reminder is still due before the new expiry
+	expiresAt := now.Add(time.Duration(policy.AutoExtendHours) * time.Hour)
+	claim := db.Model(&models.PendingKeyRotation{}).
+		Where("id = ? AND status = ? AND extensions = ?", rotation.ID, "pending", rotation.Extensions).
+		UpdateColumns(map[string]any{
+			"expires_at":     expiresAt,
+			"extensions":     rotation.Extensions + 1,
+			"reminders_sent": rotationReminderHalfway,
+		})
+	if claim.Error != nil {
+		return false, claim.Error
+	}
+	if claim.RowsAffected != 1 {
+		if err := db.First(rotation, "id = ?", rotation.ID).Error; err != nil {
+			return false, err
+		}
+		return rotation.Status == "pending" && now.Before(rotation.ExpiresAt), nil
+	}
+	rotation.ExpiresAt = expiresAt
+	rotation.Extensions++
+	rotation.RemindersSent = rotationReminderHalfway
+
+	return true, notifyRotationExtended(db, rotation, project, approvals)
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+)
+
+func TestRotationWindow(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    *models.KeyRotationPolicy
+		requested int
+		want      time.Duration
+		rejected  bool
+	}{
+		{"default", nil, 0, 24 * time.Hour, false},
+		{"shorter", nil, 4, 4 * time.Hour, false},
+		{"longer without a policy", nil, 48, 0, true},
+		{"policy window", &models.KeyRotationPolicy{ApprovalWindowHours: 8}, 0, 8 * time.Hour, false},
+		{"within the policy maximum", &models.KeyRotationPolicy{ApprovalWindowHours: 8, MaxApprovalWindowHours: 72}, 72, 72 * time.Hour, false},
+		{"past the policy maximum", &models.KeyRotationPolicy{ApprovalWindowHours: 8, MaxApprovalWindowHours: 72}, 73, 0, true},
+		{"maximum defaults to the window", &models.KeyRotationPolicy{ApprovalWindowHours: 8}, 9, 0, true},
+	}
+	for _, tt := range tests {
+		got, message := rotationWindow(tt.policy, tt.requested)
+		if got != tt.want || (message != "") != tt.rejected {
+			t.Errorf("%s: got %s %q, want %s rejected=%v", tt.name, got, message, tt.want, tt.rejected)
+		}
+	}
+}
+
+func TestRotationAutoExtension(t *testing.T) {
+	f := newAccessFixture(t)
+	previous := rotationNotifier
+	rotationNotifier = nil
+	t.Cleanup(func() { rotationNotifier = previous })
+
+	policy := models.KeyRotationPolicy{OrganizationID: f.project.OrganizationID, AutoExtendHours: 12}
+	if err := database.DB.Create(&policy).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	unapproved := createTestRotation(t, f, now)
+	approved := createTestRotation(t, f, now)
+	database.DB.Model(&approved).Update("required_approvals", 2)
+	database.DB.Create(&models.KeyRotationApproval{RotationID: approved.ID, UserID: f.admin.ID, Approved: true})
+
+	load := func(id models.PendingKeyRotation) models.PendingKeyRotation {
+		var rotation models.PendingKeyRotation
+		if err := database.DB.First(&rotation, "id = ?", id.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return rotation
+	}
+
+	at := now.Add(25 * time.Hour)
+	for i := 0; i <= maxRotationExtensions; i++ {
+		if err := remindRotationApprovers(database.DB, at); err != nil {
+			t.Fatal(err)
+		}
+		if got := load(unapproved); got.Status != "expired" {
+			t.Fatalf("rotation without approvals is %s, want expired", got.Status)
+		}
+
+		got := load(approved)
+		if i == maxRotationExtensions {
+			if got.Status != "expired" || got.Extensions != maxRotationExtensions {
+				t.Errorf("after %d extensions the rotation is %s, want expired", got.Extensions, got.Status)
+			}
+			break
+		}
+		if got.Status != "pending" || got.Extensions != i+1 || !got.ExpiresAt.Equal(at.Add(12*time.Hour)) {
+			t.Fatalf("extension %d: %s with %d extensions until %s", i+1, got.Status, got.Extensions, got.ExpiresAt)
+		}
+		at = got.ExpiresAt.Add(time.Minute)
+	}
+
+	var extended int64
+	database.DB.Model(&models.Notification{}).
+		Where("kind = ? AND user_id = ?", models.NotificationRotationExtended, f.member.ID).
+		Count(&extended)
+	if extended != maxRotationExtensions {
+		t.Errorf("the initiator heard of %d extensions, want %d", extended, maxRotationExtensions)
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SandboxFixture is a generated config item for a sandbox project. Values are
+// encrypted client-side like any other, so the client encrypts the fixtures with
+// the project key and saves them with the config sync.
+type SandboxFixture struct {
+	Name        string `json:"name"`
+	Value       string `json:"value"`
+	Sensitive   bool   `json:"sensitive"`
+	Category    string `json:"category"`
+	Description string `json:"description"`
+}
+
+// randomHex returns n random bytes as hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// sandboxFixtures generates a fresh set of fake secrets. They are shaped like the
+// real thing, so tools parsing them work, but carry test markers and point at
+// reserved example hosts.
+func sandboxFixtures() []SandboxFixture {
+	jwt := make([]byte, 48)
+	rand.Read(jwt)
+
+	return []SandboxFixture{
+		{Name: "DATABASE_URL", Value: "postgres://sandbox:" + randomHex(12) + "@db.example.com:5432/sandbox", Sensitive: true, Category: "Database", Description: "Fake connection string"},
+		{Name: "REDIS_URL", Value: "redis://:" + randomHex(12) + "@cache.example.com:6379/0", Sensitive: true, Category: "Database", Description: "Fake connection string"},
+		{Name: "STRIPE_SECRET_KEY", Value: "sk_test_sandbox_" + randomHex(16), Sensitive: true, Category: "Payments", Description: "Fake test-mode key"},
+		{Name: "API_KEY", Value: "sandbox_" + randomHex(20), Sensitive: true, Category: "Integrations", Description: "Fake API key"},
+		{Name: "JWT_SECRET", Value: base64.RawURLEncoding.EncodeToString(jwt), Sensitive: true, Category: "Auth", Description: "Fake signing secret"},
+		{Name: "APP_URL", Value: "https://sandbox.example.com", Category: "App"},
+		{Name: "LOG_LEVEL", Value: "debug", Category: "App"},
+	}
+}
+
+// GetSandboxFixtures returns generated fake config items for a sandbox project,
+// for trying rotations, tokens and webhooks without real secrets
+func GetSandboxFixtures(c *gin.Context) {
+	access := CurrentProjectAccess(c)
+	if !access.Project.Sandbox {
+		RespondBadRequest(c, "Fixtures are only generated for sandbox projects")
+		return
+	}
+
+	RespondOK(c, sandboxFixtures())
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSandboxFixtures(t *testing.T) {
+	first, second := sandboxFixtures(), sandboxFixtures()
+	names := map[string]bool{}
+	for i, fixture := range first {
+		if names[fixture.Name] {
+			t.Errorf("duplicate fixture %s", fixture.Name)
+		}
+		names[fixture.Name] = true
+
+		if fixture.Sensitive && fixture.Value == second[i].Value {
+			t.Errorf("%s repeated its value %q", fixture.Name, fixture.Value)
+		}
+		if strings.Contains(fixture.Value, "://") && !strings.Contains(fixture.Value, "example.com") {
+			t.Errorf("%s points outside the example domain: %s", fixture.Name, fixture.Value)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"time"
+
+	"envie-backend/internal/auth"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SessionDevice - the registered device a session signed in on
+type SessionDevice struct {
+	ID         uuid.UUID `json:"id"`
+	Name       string    `json:"name"`
+	LastActive time.Time `json:"lastActive"`
+}
+
+// SessionResponse - a signed-in session, i.e. a refresh token family
+type SessionResponse struct {
+	ID                uuid.UUID      `json:"id"`
+	Current           bool           `json:"current"` // the session of the calling access token
+	Device            *SessionDevice `json:"device"`
+	ClientIP          string         `json:"clientIp"`
+	UserAgent         string         `json:"userAgent"`
+	SSOOrganizationID *uuid.UUID     `json:"ssoOrganizationId"`
+	SignedInAt        time.Time      `json:"signedInAt"`
+	LastActiveAt      time.Time      `json:"lastActiveAt"` // the last sign-in or refresh, at most an access token lifetime ago while in use
+	ExpiresAt         time.Time      `json:"expiresAt"`
+}
+
+// currentSessionID returns the session of the calling access token, uuid.Nil for
+// tokens issued before sessions were tracked
+func currentSessionID(c *gin.Context) uuid.UUID {
+	if value, ok := c.Get("session_id"); ok {
+		if sessionID, ok := value.(uuid.UUID); ok {
+			return sessionID
+		}
+	}
+	return uuid.Nil
+}
+
+// bindSessionToDevice records that the caller's session runs on deviceID, so
+// deleting the device signs it out
+func bindSessionToDevice(db *gorm.DB, c *gin.Context, userID, deviceID uuid.UUID) error {
+	sessionID := currentSessionID(c)
+	if sessionID == uuid.Nil {
+		return nil
+	}
+	return db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("device_id", deviceID).Error
+}
+
+// GetSessions lists the caller's active sessions, most recently active first
+func GetSessions(c *gin.Context) {
+	userID, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	var tokens []models.RefreshToken
+	if err := requestDB(c).Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("created_at DESC").Find(&tokens).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch sessions")
+		return
+	}
+
+	// A family has one active token; keep the newest should a race leave two
+	var active []models.RefreshToken
+	var familyIDs, deviceIDs []uuid.UUID
+	seen := map[uuid.UUID]bool{}
+	for _, token := range tokens {
+		if seen[token.FamilyID] {
+			continue
+		}
+		seen[token.FamilyID] = true
+		active = append(active, token)
+		familyIDs = append(familyIDs, token.FamilyID)
+		if token.DeviceID != nil {
+			deviceIDs = append(deviceIDs, *token.DeviceID)
+		}
+	}
+
+	signedIn := map[uuid.UUID]time.Time{}
+	if len(familyIDs) > 0 {
+		var starts []struct {
+			FamilyID   uuid.UUID
+			SignedInAt time.Time
+		}
+		if err := requestDB(c).Model(&models.RefreshToken{}).Select("family_id, MIN(created_at) AS signed_in_at").
+			Where("family_id IN ?", familyIDs).Group("family_id").Scan(&starts).Error; err != nil {
+			RespondInternalError(c, "Failed to fetch sessions")
+			return
+		}
+		for _, start := range starts {
+			signedIn[start.FamilyID] = start.SignedInAt
+		}
+	}
+
+	devices := map[uuid.UUID]*SessionDevice{}
+	if len(deviceIDs) > 0 {
+		var identities []models.UserIdentity
+		if err := requestDB(c).Select("id, name, last_active").Where("user_id = ? AND id IN ?", userID, deviceIDs).
+			Find(&identities).Error; err != nil {
+			RespondInternalError(c, "Failed to fetch sessions")
+			return
+		}
+		for _, identity := range identities {
+			devices[identity.ID] = &SessionDevice{ID: identity.ID, Name: identity.Name, LastActive: identity.LastActive}
+		}
+	}
+
+	current := currentSessionID(c)
+	sessions := make([]SessionResponse, 0, len(active))
+	for _, token := range active {
+		session := SessionResponse{
+			ID:                token.FamilyID,
+			Current:           token.FamilyID == current,
+			ClientIP:          token.ClientIP,
+			UserAgent:         token.UserAgent,
+			SSOOrganizationID: token.SSOOrganizationID,
+			SignedInAt:        signedIn[token.FamilyID],
+			LastActiveAt:      token.CreatedAt,
+			ExpiresAt:         token.ExpiresAt,
+		}
+		if token.DeviceID != nil {
+			session.Device = devices[*token.DeviceID]
+		}
+		sessions = append(sessions, session)
+	}
+
+	RespondOK(c, sessions)
+}
+
+// RevokeSession signs out one of the caller's sessions. Its refresh token stops
+// working at once; access tokens already issued stay valid until they expire.
+func RevokeSession(c *gin.Context) {
+	userID, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	sessionID, ok := ParseUUIDParam(c, "id", "session")
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	var active int64
+	if err := requestDB(c).Model(&models.RefreshToken{}).
+		Where("family_id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, userID, now).
+		Count(&active).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch session")
+		return
+	}
+	if active == 0 {
+		RespondNotFound(c, "Session not found")
+		return
+	}
+
+	if err := auth.DBRefreshTokenStore.RevokeFamily(sessionID, auth.RevokedSession, now); err != nil {
+		RespondInternalError(c, "Failed to revoke session")
+		return
+	}
+
+	RespondOK(c, MessageResponse{Message: "Session revoked"})
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"envie-backend/internal/auth"
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SessionPolicy - the maximum token lifetimes for the organization's members; a
+// member of several organizations gets the shortest. Null keeps the deployment's
+// lifetime, which can only be shortened.
+type SessionPolicy struct {
+	AccessTokenLifetimeMinutes *int `json:"accessTokenLifetimeMinutes" binding:"omitempty,min=1,max=1440"`
+	RefreshTokenLifetimeHours  *int `json:"refreshTokenLifetimeHours" binding:"omitempty,min=1,max=8760"`
+}
+
+// SessionPolicyResponse - the organization's policy and the deployment's
+// lifetimes it shortens
+type SessionPolicyResponse struct {
+	SessionPolicy
+	DeploymentAccessTokenLifetimeMinutes int `json:"deploymentAccessTokenLifetimeMinutes"`
+	DeploymentRefreshTokenLifetimeHours  int `json:"deploymentRefreshTokenLifetimeHours"`
+}
+
+func sessionPolicyResponse(policy SessionPolicy) SessionPolicyResponse {
+	return SessionPolicyResponse{
+		SessionPolicy:                        policy,
+		DeploymentAccessTokenLifetimeMinutes: int(auth.DefaultLifetimes.Access / time.Minute),
+		DeploymentRefreshTokenLifetimeHours:  int(auth.DefaultLifetimes.Refresh / time.Hour),
+	}
+}
+
+// tokenLifetimes returns the lifetimes of the tokens issued to userID: the
+// deployment's, capped by the policies of the user's organizations
+func tokenLifetimes(db *gorm.DB, userID uuid.UUID) (auth.TokenLifetimes, error) {
+	var policy struct {
+		AccessMinutes *int
+		RefreshHours  *int
+	}
+	err := db.Model(&models.Organization{}).
+		Select("MIN(organizations.access_token_lifetime_minutes) AS access_minutes, MIN(organizations.refresh_token_lifetime_hours) AS refresh_hours").
+		Joins("JOIN organization_users ON organization_users.organization_id = organizations.id").
+		Where("organization_users.user_id = ?", userID).
+		Scan(&policy).Error
+	if err != nil {
+		return auth.TokenLifetimes{}, err
+	}
+
+	var access, refresh *time.Duration
+	if policy.AccessMinutes != nil {
+		d := time.Duration(*policy.AccessMinutes) * time.Minute
+		access = &d
+	}
+	if policy.RefreshHours != nil {
+		d := time.Duration(*policy.RefreshHours) * time.Hour
+		refresh = &d
+	}
+	return auth.DefaultLifetimes.Cap(access, refresh), nil
+}
+
+func GetSessionPolicy(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	var org models.Organization
+	if err := requestDB(c).Select("id, access_token_lifetime_minutes, refresh_token_lifetime_hours").First(&org, "id = ?", orgID).Error; err != nil {
+		RespondNotFound(c, "Organization not found")
+		return
+	}
+
+	RespondOK(c, sessionPolicyResponse(SessionPolicy{
+		AccessTokenLifetimeMinutes: org.AccessTokenLifetimeMinutes,
+		RefreshTokenLifetimeHours:  org.RefreshTokenLifetimeHours,
+	}))
+}
+
+// UpdateSessionPolicy replaces the organization's session policy. Sessions pick
+// it up at their next refresh; access tokens already issued run out as issued.
+func UpdateSessionPolicy(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	var req SessionPolicy
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Organization{}).Where("id = ?", orgID).Updates(map[string]any{
+			"access_token_lifetime_minutes": req.AccessTokenLifetimeMinutes,
+			"refresh_token_lifetime_hours":  req.RefreshTokenLifetimeHours,
+		}).Error; err != nil {
+			return err
+		}
+		return recordAuditEvent(tx, orgID, nil, uid, models.AuditSessionPolicy, describeSessionPolicy(req), 0)
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to update the session policy")
+		return
+	}
+
+	RespondOK(c, sessionPolicyResponse(req))
+}
+
+func describeSessionPolicy(policy SessionPolicy) string {
+	describe := func(value *int, unit string) string {
+		if value == nil {
+			return "default"
+		}
+		return fmt.Sprintf("%d%s", *value, unit)
+	}
+	return fmt.Sprintf("access tokens %s, refresh tokens %s",
+		describe(policy.AccessTokenLifetimeMinutes, "m"), describe(policy.RefreshTokenLifetimeHours, "h"))
+}
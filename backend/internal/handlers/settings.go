@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"log"
+	"strings"
+	"time"
+
+	"envie-backend/internal/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReloadSettingsResponse struct {
+	Message  string    `json:"message"`
+	LoadedAt time.Time `json:"loadedAt"`
+}
+
+// ReloadSettings reloads the settings of this instance, like SIGHUP does. It
+// answers 404 unless ADMIN_TOKEN is set, and needs it as a bearer token.
+func ReloadSettings(c *gin.Context) {
+	token := settings.Current().AdminToken
+	if token == "" {
+		RespondNotFound(c, "Not found")
+		return
+	}
+
+	bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+		RespondUnauthorized(c, "Invalid admin token")
+		return
+	}
+
+	reloaded, err := settings.Reload()
+	if err != nil {
+		RespondBadRequest(c, "Settings not reloaded: "+err.Error())
+		return
+	}
+	log.Printf("Settings reloaded: %s", reloaded)
+
+	RespondOK(c, ReloadSettingsResponse{Message: "Settings reloaded", LoadedAt: reloaded.LoadedAt})
+}
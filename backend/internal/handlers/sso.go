@@ -0,0 +1,579 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"envie-backend/internal/auth"
+	"envie-backend/internal/database"
+	"envie-backend/internal/egress"
+	"envie-backend/internal/middleware"
+	"envie-backend/internal/models"
+	"envie-backend/internal/settings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+const (
+	// ssoNonceCookie carries the sign-in nonce, so only the browser that started
+	// a sign-in can finish it
+	ssoNonceCookie = "envie_sso_nonce"
+
+	ssoHTTPTimeout = 10 * time.Second
+)
+
+// OrganizationSSOResponse - an organization's provider, without its client secret
+type OrganizationSSOResponse struct {
+	models.OrganizationSSO
+	LoginURL      string `json:"loginUrl"`
+	Members       int64  `json:"members"`
+	LinkedMembers int64  `json:"linkedMembers"` // members who signed in at the provider at least once
+}
+
+type PutOrganizationSSORequest struct {
+	Issuer       string `json:"issuer" binding:"required,max=500"`
+	ClientID     string `json:"clientId" binding:"required,max=255"`
+	ClientSecret string `json:"clientSecret" binding:"max=1024"` // empty keeps the current secret
+	RequireSSO   bool   `json:"requireSso"`
+}
+
+// SSOLinkResponse - where to send the browser to link an identity at the provider
+type SSOLinkResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// ssoHTTPClient reaches providers under the egress rules, as their URLs come
+// from organization admins
+func ssoHTTPClient() *http.Client {
+	return egress.NewClient(ssoHTTPTimeout, settings.EgressPolicy)
+}
+
+// ssoLoginURL returns where members start signing in at orgID's provider, on the
+// host of SSO_REDIRECT_URL. It is empty when SSO_REDIRECT_URL isn't set.
+func ssoLoginURL(orgID uuid.UUID, query url.Values) string {
+	redirect := os.Getenv("SSO_REDIRECT_URL")
+	if redirect == "" {
+		return ""
+	}
+	u, err := url.Parse(redirect)
+	if err != nil {
+		return ""
+	}
+	u.Path = "/auth/sso/" + orgID.String() + "/login"
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// missingSSO returns an organization of the user that requires SSO, unless the
+// sign-in went through the provider of one of them (ssoOrgID). A member of
+// several such organizations satisfies all of them with any one.
+func missingSSO(db *gorm.DB, userID uuid.UUID, ssoOrgID *uuid.UUID) (*models.OrganizationSSO, error) {
+	var required []models.OrganizationSSO
+	if err := db.Preload("Organization").
+		Joins("JOIN organization_users ON organization_users.organization_id = organization_ssos.organization_id").
+		Where("organization_users.user_id = ? AND organization_ssos.require_sso", userID).
+		Find(&required).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range required {
+		if ssoOrgID != nil && required[i].OrganizationID == *ssoOrgID {
+			return nil, nil
+		}
+	}
+	if len(required) == 0 {
+		return nil, nil
+	}
+	return &required[0], nil
+}
+
+func ssoRequiredMessage(required *models.OrganizationSSO) string {
+	message := required.Organization.Name + " requires single sign-on"
+	if loginURL := ssoLoginURL(required.OrganizationID, nil); loginURL != "" {
+		message += ", sign in at " + loginURL
+	}
+	return message
+}
+
+// ssoSignInAllowed renders an error page and returns false when an organization
+// of the user requires SSO and the sign-in didn't go through it
+func ssoSignInAllowed(c *gin.Context, userID uuid.UUID, ssoOrgID *uuid.UUID) bool {
+	required, err := missingSSO(requestDB(c), userID, ssoOrgID)
+	if err != nil {
+		writeAuthErrorPage(c, "Failed to check single sign-on requirements")
+		return false
+	}
+	if required != nil {
+		nonce := middleware.SetPageContentSecurityPolicy(c)
+		c.Data(http.StatusForbidden, "text/html; charset=utf-8", []byte(renderErrorPage(ssoRequiredMessage(required), nonce)))
+		return false
+	}
+	return true
+}
+
+// loadSSOProvider returns the organization's provider with its discovered
+// endpoints, rendering an error page when it can't
+func loadSSOProvider(c *gin.Context, orgID uuid.UUID) (*models.OrganizationSSO, *auth.OIDCProvider, bool) {
+	if os.Getenv("SSO_REDIRECT_URL") == "" {
+		writeAuthErrorPage(c, "Single sign-on is not set up on this server")
+		return nil, nil, false
+	}
+
+	var sso models.OrganizationSSO
+	if err := requestDB(c).First(&sso, "organization_id = ?", orgID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeAuthErrorPage(c, "This organization has no single sign-on provider")
+		} else {
+			writeAuthErrorPage(c, "Failed to load the single sign-on provider")
+		}
+		return nil, nil, false
+	}
+
+	provider, err := auth.DiscoverOIDC(c.Request.Context(), ssoHTTPClient(), sso.Issuer)
+	if err != nil {
+		writeAuthErrorPage(c, "Failed to reach the single sign-on provider: "+err.Error())
+		return nil, nil, false
+	}
+	return &sso, provider, true
+}
+
+// SSOLogin starts signing in at an organization's provider. With a link token
+// from StartSSOLink, the identity is linked to the account that requested it.
+func SSOLogin(c *gin.Context) {
+	orgID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		writeAuthErrorPage(c, "Invalid organization ID")
+		return
+	}
+
+	now := time.Now()
+	var linkUserID *uuid.UUID
+	if link := c.Query("link"); link != "" {
+		userID, err := auth.ParseSSOLink(link, orgID, now)
+		if err != nil {
+			writeAuthErrorPage(c, "This link has expired, start linking again from the app")
+			return
+		}
+		linkUserID = &userID
+	}
+
+	sso, provider, ok := loadSSOProvider(c, orgID)
+	if !ok {
+		return
+	}
+
+	nonce, err := auth.NewSSONonce()
+	if err != nil {
+		writeAuthErrorPage(c, "Failed to start signing in")
+		return
+	}
+	state, err := auth.SignSSOState(orgID, nonce, linkUserID, now)
+	if err != nil {
+		writeAuthErrorPage(c, "Failed to start signing in")
+		return
+	}
+
+	setSSONonceCookie(c, nonce, int(auth.SSOStateDuration.Seconds()))
+	config := auth.OIDCConfig(provider, sso.ClientID, sso.ClientSecret)
+	c.Redirect(http.StatusTemporaryRedirect, config.AuthCodeURL(state, oauth2.SetAuthURLParam("nonce", nonce)))
+}
+
+// SSOCallback finishes signing in at an organization's provider and renders the
+// linking code page
+func SSOCallback(c *gin.Context) {
+	if providerError := c.Query("error"); providerError != "" {
+		if description := c.Query("error_description"); description != "" {
+			providerError = description
+		}
+		writeAuthErrorPage(c, "The provider refused the sign-in: "+providerError)
+		return
+	}
+
+	now := time.Now()
+	state, err := auth.ParseSSOState(c.Query("state"), now)
+	if err != nil {
+		writeAuthErrorPage(c, "This sign-in has expired, start again")
+		return
+	}
+	cookie, err := c.Cookie(ssoNonceCookie)
+	if err != nil || !hmac.Equal([]byte(cookie), []byte(state.Nonce)) {
+		writeAuthErrorPage(c, "This sign-in was started in another browser, start again")
+		return
+	}
+	setSSONonceCookie(c, "", -1)
+
+	sso, provider, ok := loadSSOProvider(c, state.OrganizationID)
+	if !ok {
+		return
+	}
+
+	ctx := context.WithValue(c.Request.Context(), oauth2.HTTPClient, ssoHTTPClient())
+	token, err := auth.OIDCConfig(provider, sso.ClientID, sso.ClientSecret).Exchange(ctx, c.Query("code"))
+	if err != nil {
+		writeAuthErrorPage(c, "Authentication failed: "+err.Error())
+		return
+	}
+	rawIDToken, err := auth.IDTokenFrom(token)
+	if err != nil {
+		writeAuthErrorPage(c, "Authentication failed: "+err.Error())
+		return
+	}
+	claims, err := auth.ValidateIDToken(rawIDToken, sso.Issuer, sso.ClientID, state.Nonce, now)
+	if err != nil {
+		writeAuthErrorPage(c, "Authentication failed: "+err.Error())
+		return
+	}
+
+	user, ok := ssoUser(c, sso, claims, state.LinkUserID)
+	if !ok {
+		return
+	}
+	if !ssoSignInAllowed(c, user.ID, &sso.OrganizationID) {
+		return
+	}
+
+	log.Printf("User %s signed in with the SSO provider of organization %s", user.ID, sso.OrganizationID)
+	writeLinkingCodePage(c, user, &sso.OrganizationID)
+}
+
+// ssoUser returns the account of the identity in claims. An unknown identity is
+// linked to linkUserID when linking, and otherwise gets a new account. It is
+// never matched to an existing account by email: the provider is run by the
+// organization, which mustn't be able to sign in as anyone with a known address.
+func ssoUser(c *gin.Context, sso *models.OrganizationSSO, claims *auth.IDTokenClaims, linkUserID *uuid.UUID) (*models.User, bool) {
+	db := requestDB(c)
+	now := time.Now()
+
+	var identity models.UserSSOIdentity
+	err := db.Where("organization_id = ? AND subject = ?", sso.OrganizationID, claims.Subject).First(&identity).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		writeAuthErrorPage(c, "Failed to check for user existence")
+		return nil, false
+	}
+
+	var user models.User
+	if err == nil {
+		if linkUserID != nil && *linkUserID != identity.UserID {
+			writeAuthErrorPage(c, "This identity is already linked to another Envie account")
+			return nil, false
+		}
+		if err := db.First(&user, "id = ?", identity.UserID).Error; err != nil {
+			writeAuthErrorPage(c, "Failed to load the linked account")
+			return nil, false
+		}
+		db.Model(&models.UserSSOIdentity{}).Where("organization_id = ? AND subject = ?", identity.OrganizationID, identity.Subject).
+			Update("last_login_at", now)
+		return &user, true
+	}
+
+	identity = models.UserSSOIdentity{OrganizationID: sso.OrganizationID, Subject: claims.Subject, LastLoginAt: &now}
+
+	if linkUserID != nil {
+		if err := db.First(&user, "id = ?", *linkUserID).Error; err != nil {
+			writeAuthErrorPage(c, "The account to link no longer exists")
+			return nil, false
+		}
+		identity.UserID = user.ID
+		if err := db.Create(&identity).Error; err != nil {
+			writeAuthErrorPage(c, "Failed to link the identity: "+err.Error())
+			return nil, false
+		}
+		return &user, true
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		writeAuthErrorPage(c, "The provider didn't share a verified email address")
+		return nil, false
+	}
+	var existing int64
+	if err := db.Model(&models.User{}).Where("email = ?", claims.Email).Count(&existing).Error; err != nil {
+		writeAuthErrorPage(c, "Failed to check for user existence")
+		return nil, false
+	}
+	if existing > 0 {
+		writeAuthErrorPage(c, fmt.Sprintf("An Envie account already uses %s. Sign in as usual and link it to single sign-on from the organization settings first.", claims.Email))
+		return nil, false
+	}
+
+	user = models.User{Name: claims.Name, Email: claims.Email, AvatarURL: claims.Picture}
+	if user.Name == "" {
+		user.Name = claims.Email
+	}
+	err = database.Transaction(db, func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		identity.UserID = user.ID
+		return tx.Create(&identity).Error
+	})
+	if err != nil {
+		writeAuthErrorPage(c, "Failed to create user: "+err.Error())
+		return nil, false
+	}
+	return &user, true
+}
+
+func setSSONonceCookie(c *gin.Context, value string, maxAge int) {
+	secure := false
+	if u, err := url.Parse(os.Getenv("SSO_REDIRECT_URL")); err == nil {
+		secure = u.Scheme == "https"
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(ssoNonceCookie, value, maxAge, "/auth/sso", "", secure, true)
+}
+
+func ssoResponse(db *gorm.DB, sso *models.OrganizationSSO) (*OrganizationSSOResponse, error) {
+	response := &OrganizationSSOResponse{OrganizationSSO: *sso, LoginURL: ssoLoginURL(sso.OrganizationID, nil)}
+	if err := db.Model(&models.OrganizationUser{}).Where("organization_id = ?", sso.OrganizationID).
+		Count(&response.Members).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(&models.OrganizationUser{}).
+		Where("organization_id = ? AND user_id IN (?)", sso.OrganizationID,
+			db.Model(&models.UserSSOIdentity{}).Select("user_id").Where("organization_id = ?", sso.OrganizationID)).
+		Count(&response.LinkedMembers).Error; err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// GetOrganizationSSO returns the organization's provider
+func GetOrganizationSSO(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	var sso models.OrganizationSSO
+	if err := requestDB(c).First(&sso, "organization_id = ?", orgID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			RespondNotFound(c, "Single sign-on is not configured")
+		} else {
+			RespondInternalError(c, "Failed to fetch single sign-on settings")
+		}
+		return
+	}
+
+	response, err := ssoResponse(requestDB(c), &sso)
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch single sign-on settings")
+		return
+	}
+	RespondOK(c, response)
+}
+
+// PutOrganizationSSO configures the organization's provider. Requiring SSO takes
+// a sign-in at the provider by the owner first, so a misconfigured provider can't
+// lock the organization out; changing the issuer unlinks every identity.
+func PutOrganizationSSO(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	var req PutOrganizationSSORequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	if _, ok := RequireOrgOwner(c, uid, orgID); !ok {
+		return
+	}
+
+	if os.Getenv("SSO_REDIRECT_URL") == "" {
+		RespondError(c, http.StatusNotImplemented, "Single sign-on is not set up on this server (SSO_REDIRECT_URL)")
+		return
+	}
+
+	var existing *models.OrganizationSSO
+	var current models.OrganizationSSO
+	if err := requestDB(c).First(&current, "organization_id = ?", orgID).Error; err == nil {
+		existing = &current
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		RespondInternalError(c, "Failed to fetch single sign-on settings")
+		return
+	}
+
+	sso := models.OrganizationSSO{
+		OrganizationID: orgID,
+		Issuer:         req.Issuer,
+		ClientID:       req.ClientID,
+		ClientSecret:   req.ClientSecret,
+		RequireSSO:     req.RequireSSO,
+	}
+	if sso.ClientSecret == "" {
+		if existing == nil {
+			RespondBadRequest(c, "clientSecret is required")
+			return
+		}
+		sso.ClientSecret = existing.ClientSecret
+	}
+	issuerChanged := existing == nil || existing.Issuer != sso.Issuer
+
+	if err := auth.ValidateIssuer(sso.Issuer); err != nil {
+		RespondBadRequest(c, err.Error())
+		return
+	}
+	if _, err := auth.DiscoverOIDC(c.Request.Context(), ssoHTTPClient(), sso.Issuer); err != nil {
+		RespondBadRequest(c, "Failed to reach the provider: "+err.Error())
+		return
+	}
+
+	if sso.RequireSSO && (existing == nil || !existing.RequireSSO) {
+		var linked int64
+		if !issuerChanged {
+			if err := requestDB(c).Model(&models.UserSSOIdentity{}).
+				Where("organization_id = ? AND user_id = ?", orgID, uid).Count(&linked).Error; err != nil {
+				RespondInternalError(c, "Failed to check your identity")
+				return
+			}
+		}
+		if linked == 0 {
+			RespondConflict(c, "Sign in at the provider once before requiring single sign-on")
+			return
+		}
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if existing != nil && issuerChanged {
+			if err := tx.Where("organization_id = ?", orgID).Delete(&models.UserSSOIdentity{}).Error; err != nil {
+				return err
+			}
+		}
+		if existing == nil {
+			if err := tx.Create(&sso).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Model(&sso).Select("issuer", "client_id", "client_secret", "require_sso").Updates(&sso).Error; err != nil {
+			return err
+		}
+		return recordAuditEvent(tx, orgID, nil, uid, models.AuditSSOConfigured,
+			fmt.Sprintf("issuer %s, client %s, required: %t", sso.Issuer, sso.ClientID, sso.RequireSSO), 0)
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to save single sign-on settings")
+		return
+	}
+
+	if err := requestDB(c).First(&sso, "organization_id = ?", orgID).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch single sign-on settings")
+		return
+	}
+	response, err := ssoResponse(requestDB(c), &sso)
+	if err != nil {
+		RespondInternalError(c, "Failed to fetch single sign-on settings")
+		return
+	}
+	RespondOK(c, response)
+}
+
+// DeleteOrganizationSSO removes the organization's provider and unlinks every
+// identity at it
+func DeleteOrganizationSSO(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgOwner(c, uid, orgID); !ok {
+		return
+	}
+
+	var deleted int64
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		result := tx.Where("organization_id = ?", orgID).Delete(&models.OrganizationSSO{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if deleted = result.RowsAffected; deleted == 0 {
+			return nil
+		}
+		if err := tx.Where("organization_id = ?", orgID).Delete(&models.UserSSOIdentity{}).Error; err != nil {
+			return err
+		}
+		return recordAuditEvent(tx, orgID, nil, uid, models.AuditSSORemoved, "", 0)
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to remove single sign-on")
+		return
+	}
+	if deleted == 0 {
+		RespondNotFound(c, "Single sign-on is not configured")
+		return
+	}
+
+	RespondOK(c, MessageResponse{Message: "Single sign-on removed"})
+}
+
+// StartSSOLink returns a URL that links the caller's account to their identity at
+// the organization's provider. Members who joined with GitHub or Google need it
+// once before they can sign in with SSO.
+func StartSSOLink(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgMembership(c, uid, orgID); !ok {
+		return
+	}
+
+	var sso models.OrganizationSSO
+	if err := requestDB(c).Select("organization_id").First(&sso, "organization_id = ?", orgID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			RespondNotFound(c, "Single sign-on is not configured")
+		} else {
+			RespondInternalError(c, "Failed to fetch single sign-on settings")
+		}
+		return
+	}
+
+	now := time.Now()
+	link, err := auth.SignSSOLink(orgID, uid, now)
+	if err != nil {
+		RespondInternalError(c, "Failed to create the link")
+		return
+	}
+	loginURL := ssoLoginURL(orgID, url.Values{"link": {link}})
+	if loginURL == "" {
+		RespondError(c, http.StatusNotImplemented, "Single sign-on is not set up on this server (SSO_REDIRECT_URL)")
+		return
+	}
+
+	RespondOK(c, SSOLinkResponse{URL: loginURL, ExpiresAt: now.Add(auth.SSOStateDuration)})
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"envie-backend/internal/apierror"
+	"envie-backend/internal/models"
+	"envie-backend/internal/settings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultLargestFiles = 20
+	maxLargestFiles     = 100
+)
+
+// LargestFile - a file of the organization, for finding what to clean up
+type LargestFile struct {
+	ID          uuid.UUID    `json:"id"`
+	ProjectID   uuid.UUID    `json:"projectId"`
+	ProjectName string       `json:"projectName"`
+	Name        string       `json:"name"`
+	Folder      string       `json:"folder"`
+	SizeBytes   int64        `json:"sizeBytes"`
+	UploadedBy  FileUploader `json:"uploadedBy" gorm:"embedded;embeddedPrefix:uploaded_by_"`
+	CreatedAt   time.Time    `json:"createdAt"`
+}
+
+// orgStorageFiles is the files of the organization's projects that count
+// toward its storage. Unlike the storage_bytes alert it includes sandbox
+// projects, their files are stored all the same.
+func orgStorageFiles(db *gorm.DB, orgID uuid.UUID) *gorm.DB {
+	return db.Model(&models.ProjectFile{}).
+		Joins("JOIN projects ON projects.id = project_files.project_id AND projects.deleted_at IS NULL").
+		Where("projects.organization_id = ?", orgID)
+}
+
+// orgStorageUsage returns the total size of the organization's files
+func orgStorageUsage(db *gorm.DB, orgID uuid.UUID) (int64, error) {
+	var used int64
+	err := orgStorageFiles(db, orgID).Select("COALESCE(SUM(project_files.size_bytes), 0)").Scan(&used).Error
+	return used, err
+}
+
+// checkStorageQuota fails with a CodeStorageQuota error when adding bytes would
+// take the organization past its quota, and with a CodePlanLimit error past the
+// storage limit of its plan
+func checkStorageQuota(db *gorm.DB, orgID uuid.UUID, adding int64) error {
+	var org models.Organization
+	if err := db.Select("id, storage_quota_bytes, plan_max_storage_bytes").First(&org, "id = ?", orgID).Error; err != nil {
+		return err
+	}
+	limit := settings.Current().Limits.With(org.PlanLimits).StorageBytesPerOrg
+	if org.StorageQuotaBytes == nil && limit == 0 {
+		return nil
+	}
+
+	used, err := orgStorageUsage(db, orgID)
+	if err != nil {
+		return err
+	}
+	if err := planStorageError(used, adding, limit); err != nil {
+		return err
+	}
+	if org.StorageQuotaBytes == nil {
+		return nil
+	}
+	return storageQuotaError(used, adding, *org.StorageQuotaBytes)
+}
+
+func storageQuotaError(used, adding, quota int64) error {
+	if used+adding <= quota {
+		return nil
+	}
+	return apierror.New(http.StatusConflict, apierror.CodeStorageQuota,
+		fmt.Sprintf("Storage quota exceeded: %d of %d bytes used, the file needs %d more. Delete files or ask an admin to raise the quota", used, quota, adding))
+}
+
+// ListLargestFiles lists the organization's largest files across its projects,
+// for admins cleaning up storage. limit defaults to 20, at most 100.
+func ListLargestFiles(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	limit := defaultLargestFiles
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxLargestFiles {
+			RespondBadRequest(c, fmt.Sprintf("limit must be between 1 and %d", maxLargestFiles))
+			return
+		}
+		limit = n
+	}
+
+	files := []LargestFile{}
+	if err := orgStorageFiles(requestDB(c), orgID).
+		Select("project_files.id, project_files.project_id, projects.name AS project_name, project_files.name, project_files.folder, " +
+			"project_files.size_bytes, project_files.created_at, users.id AS uploaded_by_id, users.name AS uploaded_by_name, users.email AS uploaded_by_email").
+		Joins("LEFT JOIN users ON users.id = project_files.uploaded_by").
+		Order("project_files.size_bytes DESC, project_files.created_at").
+		Limit(limit).
+		Scan(&files).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch files")
+		return
+	}
+
+	RespondOK(c, files)
+}
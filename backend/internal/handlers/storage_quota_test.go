@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"envie-backend/internal/apierror"
+)
+
+func TestStorageQuotaError(t *testing.T) {
+	if err := storageQuotaError(900, 100, 1000); err != nil {
+		t.Errorf("filling the quota exactly: %v", err)
+	}
+	err := storageQuotaError(900, 101, 1000)
+	if apierror.CodeOf(err) != apierror.CodeStorageQuota {
+		t.Fatalf("past the quota: err = %v", err)
+	}
+	if want := "900 of 1000 bytes used, the file needs 101 more"; !strings.Contains(err.Error(), want) {
+		t.Errorf("message %q doesn't contain %q", err.Error(), want)
+	}
+}
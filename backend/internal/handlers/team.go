@@ -1,18 +1,22 @@
 package handlers
 
 import (
+	"errors"
+
 	"envie-backend/internal/database"
 	"envie-backend/internal/models"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type CreateTeamRequest struct {
-	Name             string    `json:"name" binding:"required"`
+	Name             string    `json:"name" binding:"required,max=255,name"`
 	OrganizationID   uuid.UUID `json:"organizationId" binding:"required"`
-	EncryptedKey     string    `json:"encryptedKey" binding:"required"`     // encrypted with org master key
-	UserEncryptedKey string    `json:"userEncryptedKey" binding:"required"` // encrypted with user PK
+	EncryptedKey     string    `json:"encryptedKey" binding:"required,ciphertext"`     // encrypted with org master key
+	UserEncryptedKey string    `json:"userEncryptedKey" binding:"required,ciphertext"` // encrypted with user PK
 }
 
 func CreateTeam(c *gin.Context) {
@@ -22,39 +26,45 @@ func CreateTeam(c *gin.Context) {
 	}
 
 	var req CreateTeamRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		RespondBadRequest(c, err.Error())
+	if !BindJSON(c, &req) {
 		return
 	}
 
-	tx := database.DB.Begin()
-
-	var orgUser models.OrganizationUser
-	if err := tx.Where("organization_id = ? AND user_id = ?", req.OrganizationID, uid).First(&orgUser).Error; err != nil {
-		tx.Rollback()
-		RespondForbidden(c, "You are not a member of this organization")
+	team, ok := createTeamInOrg(c, uid, req)
+	if !ok {
 		return
 	}
 
-	team := models.Team{
-		Name:           req.Name,
-		OrganizationID: req.OrganizationID,
-		EncryptedKey:   req.EncryptedKey,
-	}
+	RespondCreated(c, team)
+}
 
-	if err := tx.Create(&team).Error; err != nil {
-		tx.Rollback()
-		RespondInternalError(c, "Failed to create team")
-		return
-	}
+// createTeamInOrg creates a team in an organization the user belongs to.
+// If unsuccessful, it sends an error response automatically.
+func createTeamInOrg(c *gin.Context, uid uuid.UUID, req CreateTeamRequest) (*models.Team, bool) {
+	var team models.Team
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		var orgUser models.OrganizationUser
+		if err := tx.Where("organization_id = ? AND user_id = ?", req.OrganizationID, uid).First(&orgUser).Error; err != nil {
+			return err
+		}
 
-	if err := tx.Commit().Error; err != nil {
-		tx.Rollback()
-		RespondInternalError(c, "Failed to commit transaction")
-		return
+		team = models.Team{
+			Name:           req.Name,
+			OrganizationID: req.OrganizationID,
+			EncryptedKey:   req.EncryptedKey,
+		}
+		return tx.Create(&team).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		RespondForbidden(c, "You are not a member of this organization")
+		return nil, false
+	}
+	if err != nil {
+		RespondInternalError(c, "Failed to create team")
+		return nil, false
 	}
 
-	RespondCreated(c, team)
+	return &team, true
 }
 
 func GetTeams(c *gin.Context) {
@@ -74,7 +84,7 @@ func GetTeams(c *gin.Context) {
 	}
 
 	var teams []models.Team
-	if err := database.DB.Where("organization_id = ?", orgID).Find(&teams).Error; err != nil {
+	if err := requestDB(c).Where("organization_id = ?", orgID).Find(&teams).Error; err != nil {
 		RespondInternalError(c, "Failed to fetch teams")
 		return
 	}
@@ -94,7 +104,7 @@ func GetTeams(c *gin.Context) {
 		Count  int64
 	}
 	var memberCounts []CountResult
-	database.DB.Model(&models.TeamUser{}).
+	requestDB(c).Model(&models.TeamUser{}).
 		Select("team_id, COUNT(*) as count").
 		Where("team_id IN ?", teamIDs).
 		Group("team_id").
@@ -106,7 +116,7 @@ func GetTeams(c *gin.Context) {
 	}
 
 	var projectCounts []CountResult
-	database.DB.Model(&models.TeamProject{}).
+	requestDB(c).Model(&models.TeamProject{}).
 		Select("team_id, COUNT(*) as count").
 		Where("team_id IN ?", teamIDs).
 		Group("team_id").
@@ -122,7 +132,7 @@ func GetTeams(c *gin.Context) {
 		EncryptedTeamKey string
 	}
 	var teamKeys []TeamKeyResult
-	database.DB.Model(&models.TeamUser{}).
+	requestDB(c).Model(&models.TeamUser{}).
 		Select("team_id, encrypted_team_key").
 		Where("team_id IN ? AND user_id = ?", teamIDs, uid).
 		Scan(&teamKeys)
@@ -141,7 +151,7 @@ func GetTeams(c *gin.Context) {
 		AvatarURL string `gorm:"column:avatar_url"`
 	}
 	var teamUserResults []TeamUserResult
-	database.DB.Model(&models.TeamUser{}).
+	requestDB(c).Model(&models.TeamUser{}).
 		Select("team_users.team_id, users.id, users.name, users.email, users.avatar_url").
 		Joins("JOIN users ON users.id = team_users.user_id").
 		Where("team_users.team_id IN ?", teamIDs).
@@ -198,7 +208,7 @@ func GetTeamMembers(c *gin.Context) {
 	}
 
 	var team models.Team
-	if err := database.DB.First(&team, "id = ?", teamID).Error; err != nil {
+	if err := requestDB(c).First(&team, "id = ?", teamID).Error; err != nil {
 		RespondNotFound(c, "Team not found")
 		return
 	}
@@ -218,7 +228,7 @@ func GetTeamMembers(c *gin.Context) {
 	}
 
 	var members []MemberResponse
-	database.DB.Model(&models.TeamUser{}).
+	requestDB(c).Model(&models.TeamUser{}).
 		Select("team_users.user_id, users.name, users.email, users.avatar_url, team_users.role, team_users.created_at as joined_at").
 		Joins("JOIN users ON users.id = team_users.user_id").
 		Where("team_users.team_id = ?", teamID).
@@ -229,7 +239,7 @@ func GetTeamMembers(c *gin.Context) {
 
 type AddTeamMemberRequest struct {
 	UserID           uuid.UUID `json:"userId" binding:"required"`
-	EncryptedTeamKey string    `json:"encryptedTeamKey" binding:"required"`
+	EncryptedTeamKey string    `json:"encryptedTeamKey" binding:"omitempty,ciphertext"` // empty queues a PendingKeyGrant
 	Role             string    `json:"role"`
 }
 
@@ -246,13 +256,12 @@ func AddTeamMember(c *gin.Context) {
 	}
 
 	var req AddTeamMemberRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		RespondBadRequest(c, err.Error())
+	if !BindJSON(c, &req) {
 		return
 	}
 
 	var team models.Team
-	if err := database.DB.First(&team, "id = ?", teamID).Error; err != nil {
+	if err := requestDB(c).First(&team, "id = ?", teamID).Error; err != nil {
 		RespondNotFound(c, "Team not found")
 		return
 	}
@@ -264,13 +273,13 @@ func AddTeamMember(c *gin.Context) {
 	}
 
 	var targetOrgUser models.OrganizationUser
-	if err := database.DB.Where("organization_id = ? AND user_id = ?", team.OrganizationID, req.UserID).First(&targetOrgUser).Error; err != nil {
+	if err := requestDB(c).Where("organization_id = ? AND user_id = ?", team.OrganizationID, req.UserID).First(&targetOrgUser).Error; err != nil {
 		RespondBadRequest(c, "User is not a member of this organization")
 		return
 	}
 
 	var existingMember models.TeamUser
-	if err := database.DB.Where("team_id = ? AND user_id = ?", teamID, req.UserID).First(&existingMember).Error; err == nil {
+	if err := requestDB(c).Where("team_id = ? AND user_id = ?", teamID, req.UserID).First(&existingMember).Error; err == nil {
 		RespondConflict(c, "User is already a member of this team")
 		return
 	}
@@ -287,11 +296,33 @@ func AddTeamMember(c *gin.Context) {
 		Role:             role,
 	}
 
-	if err := database.DB.Create(&teamUser).Error; err != nil {
+	err = database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Create(&teamUser).Error; err != nil {
+			return err
+		}
+		if req.EncryptedTeamKey != "" {
+			return nil
+		}
+		// A grant left over from an earlier membership is taken over
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "team_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"requested_by", "created_at"}),
+		}).Create(&models.PendingKeyGrant{
+			OrganizationID: team.OrganizationID,
+			TeamID:         teamID,
+			UserID:         req.UserID,
+			RequestedBy:    uid,
+		}).Error
+	})
+	if err != nil {
 		RespondInternalError(c, "Failed to add member to team")
 		return
 	}
 
+	if req.EncryptedTeamKey == "" {
+		RespondCreated(c, gin.H{"message": "Member added, their team key is pending"})
+		return
+	}
 	RespondCreated(c, gin.H{"message": "Member added successfully"})
 }
 
@@ -316,13 +347,12 @@ func UpdateTeamMember(c *gin.Context) {
 	}
 
 	var req UpdateTeamMemberRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		RespondBadRequest(c, err.Error())
+	if !BindJSON(c, &req) {
 		return
 	}
 
 	var team models.Team
-	if err := database.DB.First(&team, "id = ?", teamID).Error; err != nil {
+	if err := requestDB(c).First(&team, "id = ?", teamID).Error; err != nil {
 		RespondNotFound(c, "Team not found")
 		return
 	}
@@ -335,10 +365,10 @@ func UpdateTeamMember(c *gin.Context) {
 
 	if memberID == uid && req.Role != "owner" {
 		var ownerCount int64
-		database.DB.Model(&models.TeamUser{}).Where("team_id = ? AND role = ?", teamID, "owner").Count(&ownerCount)
+		requestDB(c).Model(&models.TeamUser{}).Where("team_id = ? AND role = ?", teamID, "owner").Count(&ownerCount)
 		if ownerCount <= 1 {
 			var currentMember models.TeamUser
-			if err := database.DB.Where("team_id = ? AND user_id = ?", teamID, uid).First(&currentMember).Error; err == nil {
+			if err := requestDB(c).Where("team_id = ? AND user_id = ?", teamID, uid).First(&currentMember).Error; err == nil {
 				if currentMember.Role == "owner" {
 					RespondBadRequest(c, "Cannot demote yourself as you are the only team owner")
 					return
@@ -347,7 +377,7 @@ func UpdateTeamMember(c *gin.Context) {
 		}
 	}
 
-	result := database.DB.Model(&models.TeamUser{}).
+	result := requestDB(c).Model(&models.TeamUser{}).
 		Where("team_id = ? AND user_id = ?", teamID, memberID).
 		Update("role", req.Role)
 
@@ -376,7 +406,7 @@ func RemoveTeamMember(c *gin.Context) {
 	}
 
 	var team models.Team
-	if err := database.DB.First(&team, "id = ?", teamID).Error; err != nil {
+	if err := requestDB(c).First(&team, "id = ?", teamID).Error; err != nil {
 		RespondNotFound(c, "Team not found")
 		return
 	}
@@ -390,21 +420,21 @@ func RemoveTeamMember(c *gin.Context) {
 	}
 
 	var memberToRemove models.TeamUser
-	if err := database.DB.Where("team_id = ? AND user_id = ?", teamID, memberID).First(&memberToRemove).Error; err != nil {
+	if err := requestDB(c).Where("team_id = ? AND user_id = ?", teamID, memberID).First(&memberToRemove).Error; err != nil {
 		RespondNotFound(c, "Team member not found")
 		return
 	}
 
 	if memberToRemove.Role == "owner" {
 		var ownerCount int64
-		database.DB.Model(&models.TeamUser{}).Where("team_id = ? AND role = ?", teamID, "owner").Count(&ownerCount)
+		requestDB(c).Model(&models.TeamUser{}).Where("team_id = ? AND role = ?", teamID, "owner").Count(&ownerCount)
 		if ownerCount <= 1 {
 			RespondBadRequest(c, "Cannot remove the only team owner. Transfer ownership first.")
 			return
 		}
 	}
 
-	result := database.DB.Where("team_id = ? AND user_id = ?", teamID, memberID).Delete(&models.TeamUser{})
+	result := requestDB(c).Where("team_id = ? AND user_id = ?", teamID, memberID).Delete(&models.TeamUser{})
 	if result.RowsAffected == 0 {
 		RespondNotFound(c, "Team member not found")
 		return
@@ -414,7 +444,7 @@ func RemoveTeamMember(c *gin.Context) {
 }
 
 type UpdateMyTeamKeyRequest struct {
-	EncryptedTeamKey string `json:"encryptedTeamKey" binding:"required"`
+	EncryptedTeamKey string `json:"encryptedTeamKey" binding:"required,ciphertext"`
 }
 
 func UpdateMyTeamKey(c *gin.Context) {
@@ -429,12 +459,11 @@ func UpdateMyTeamKey(c *gin.Context) {
 	}
 
 	var req UpdateMyTeamKeyRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		RespondBadRequest(c, err.Error())
+	if !BindJSON(c, &req) {
 		return
 	}
 
-	result := database.DB.Model(&models.TeamUser{}).
+	result := requestDB(c).Model(&models.TeamUser{}).
 		Where("team_id = ? AND user_id = ?", teamID, uid).
 		Update("encrypted_team_key", req.EncryptedTeamKey)
 
@@ -456,12 +485,12 @@ func GetMyTeams(c *gin.Context) {
 		TeamID           uuid.UUID `json:"teamId"`
 		TeamName         string    `json:"teamName"`
 		OrganizationID   uuid.UUID `json:"organizationId"`
-		EncryptedTeamKey string    `json:"encryptedTeamKey"`
+		EncryptedTeamKey string    `json:"encryptedTeamKey" binding:"omitempty,ciphertext"`
 		EncryptedKey     string    `json:"encryptedKey"`
 	}
 
 	var teams []TeamWithKey
-	database.DB.Model(&models.TeamUser{}).
+	requestDB(c).Model(&models.TeamUser{}).
 		Select("team_users.team_id, teams.name as team_name, teams.organization_id, team_users.encrypted_team_key, teams.encrypted_key").
 		Joins("JOIN teams ON teams.id = team_users.team_id").
 		Where("team_users.user_id = ?", uid).
@@ -471,19 +500,9 @@ func GetMyTeams(c *gin.Context) {
 }
 
 func canManageTeam(userID uuid.UUID, teamID uuid.UUID, orgID uuid.UUID) (bool, error) {
-	var teamUser models.TeamUser
-	if err := database.DB.Where("team_id = ? AND user_id = ?", teamID, userID).First(&teamUser).Error; err == nil {
-		if teamUser.Role == "owner" || teamUser.Role == "admin" {
-			return true, nil
-		}
-	}
-
-	var orgUser models.OrganizationUser
-	if err := database.DB.Where("organization_id = ? AND user_id = ?", orgID, userID).First(&orgUser).Error; err == nil {
-		if orgUser.Role == "owner" || orgUser.Role == "admin" {
-			return true, nil
-		}
+	permissions, err := GetUserTeamPermissions(userID, teamID, orgID)
+	if err != nil {
+		return false, err
 	}
-
-	return false, nil
+	return permissions.Has(models.PermissionMembersManage), nil
 }
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TokenAnomalyPage - a page of a project's token anomalies, newest first
+type TokenAnomalyPage struct {
+	Items      []models.TokenAnomaly `json:"items"`
+	NextCursor string                `json:"nextCursor,omitempty"`
+}
+
+// GetTokenAnomalies lists a project's token anomalies. status is "open" (the
+// default), "acknowledged" or "all".
+func GetTokenAnomalies(c *gin.Context) {
+	access := CurrentProjectAccess(c)
+
+	query := requestDB(c).Where("project_id = ?", access.Project.ID)
+	switch c.DefaultQuery("status", "open") {
+	case "open":
+		query = query.Where("acknowledged_at IS NULL")
+	case "acknowledged":
+		query = query.Where("acknowledged_at IS NOT NULL")
+	case "all":
+	default:
+		RespondBadRequest(c, "status must be open, acknowledged or all")
+		return
+	}
+
+	page, ok := RequestedPage(c)
+	if !ok {
+		return
+	}
+
+	var anomalies []models.TokenAnomaly
+	if err := page.Apply(query, "token_anomalies").Find(&anomalies).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch token anomalies")
+		return
+	}
+
+	var response TokenAnomalyPage
+	response.Items, response.NextCursor = pageItems(page, anomalies, func(a *models.TokenAnomaly) (time.Time, uuid.UUID) {
+		return a.CreatedAt, a.ID
+	})
+	RespondOK(c, response)
+}
+
+// AcknowledgeTokenAnomaly marks an anomaly as reviewed, which takes it out of the
+// token_anomalies alert metric
+func AcknowledgeTokenAnomaly(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+	access := CurrentProjectAccess(c)
+
+	anomalyID, ok := ParseUUIDParam(c, "anomalyId", "anomaly")
+	if !ok {
+		return
+	}
+
+	var anomaly models.TokenAnomaly
+	if err := requestDB(c).Where("id = ? AND project_id = ?", anomalyID, access.Project.ID).First(&anomaly).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			RespondNotFound(c, "Anomaly not found")
+		} else {
+			RespondInternalError(c, "Failed to fetch anomaly")
+		}
+		return
+	}
+	if anomaly.AcknowledgedAt != nil {
+		RespondConflict(c, "Anomaly was already acknowledged")
+		return
+	}
+
+	now := time.Now()
+	result := requestDB(c).Model(&anomaly).Where("acknowledged_at IS NULL").
+		Updates(map[string]any{"acknowledged_at": now, "acknowledged_by_id": uid})
+	if result.Error != nil {
+		RespondInternalError(c, "Failed to acknowledge anomaly")
+		return
+	}
+	if result.RowsAffected == 0 {
+		RespondConflict(c, "Anomaly was already acknowledged")
+		return
+	}
+	anomaly.AcknowledgedAt = &now
+	anomaly.AcknowledgedByID = &uid
+
+	RespondOK(c, anomaly)
+}
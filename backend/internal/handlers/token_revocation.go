@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RevokeTokensRequest selects the tokens to revoke. Filters combine, so
+// createdBy with neverUsed revokes that user's unused tokens. At least one is
+// required; all revokes every token.
+type RevokeTokensRequest struct {
+	All           bool       `json:"all"`
+	CreatedBy     *uuid.UUID `json:"createdBy"`
+	OlderThanDays *int       `json:"olderThanDays" binding:"omitempty,min=0"` // created more than this many days ago
+	NeverUsed     bool       `json:"neverUsed"`
+}
+
+type RevokeTokensResponse struct {
+	Revoked  int         `json:"revoked"`
+	TokenIDs []uuid.UUID `json:"tokenIds"`
+}
+
+// AuditEventPage - a page of the organization's audit log, newest first
+type AuditEventPage struct {
+	Items      []models.AuditEvent `json:"items"`
+	NextCursor string              `json:"nextCursor,omitempty"`
+}
+
+func (r RevokeTokensRequest) empty() bool {
+	return !r.All && r.CreatedBy == nil && r.OlderThanDays == nil && !r.NeverUsed
+}
+
+// apply narrows a token query to the filters
+func (r RevokeTokensRequest) apply(query *gorm.DB, now time.Time) *gorm.DB {
+	if r.CreatedBy != nil {
+		query = query.Where("project_tokens.created_by = ?", *r.CreatedBy)
+	}
+	if r.OlderThanDays != nil {
+		query = query.Where("project_tokens.created_at < ?", now.AddDate(0, 0, -*r.OlderThanDays))
+	}
+	if r.NeverUsed {
+		query = query.Where("project_tokens.last_used_at IS NULL")
+	}
+	return query
+}
+
+// describe renders the filters for the audit log
+func (r RevokeTokensRequest) describe() string {
+	if r.All {
+		return "all tokens"
+	}
+	var filters []string
+	if r.CreatedBy != nil {
+		filters = append(filters, "created by "+r.CreatedBy.String())
+	}
+	if r.OlderThanDays != nil {
+		filters = append(filters, "older than "+strconv.Itoa(*r.OlderThanDays)+" days")
+	}
+	if r.NeverUsed {
+		filters = append(filters, "never used")
+	}
+	return "tokens " + strings.Join(filters, ", ")
+}
+
+// RevokeProjectTokens revokes the project's tokens matching the filters
+func RevokeProjectTokens(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	access := CurrentProjectAccess(c)
+	projectID := access.Project.ID
+
+	req, ok := bindRevokeTokensRequest(c)
+	if !ok {
+		return
+	}
+
+	revokeTokens(c, uid, access.Project.OrganizationID, &projectID, req, func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("project_tokens.project_id = ?", projectID)
+	})
+}
+
+// RevokeOrganizationTokens revokes the tokens matching the filters across all
+// projects of the organization (organization owners)
+func RevokeOrganizationTokens(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	req, ok := bindRevokeTokensRequest(c)
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgOwner(c, uid, orgID); !ok {
+		return
+	}
+
+	revokeTokens(c, uid, orgID, nil, req, func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("project_tokens.project_id IN (?)", tx.Model(&models.Project{}).Select("id").Where("organization_id = ?", orgID))
+	})
+}
+
+func bindRevokeTokensRequest(c *gin.Context) (RevokeTokensRequest, bool) {
+	var req RevokeTokensRequest
+	if !BindJSON(c, &req) {
+		return req, false
+	}
+	if req.empty() {
+		RespondBadRequest(c, "Set all, createdBy, olderThanDays or neverUsed")
+		return req, false
+	}
+	if req.All && !(req.CreatedBy == nil && req.OlderThanDays == nil && !req.NeverUsed) {
+		RespondBadRequest(c, "all can't be combined with other filters")
+		return req, false
+	}
+	return req, true
+}
+
+// revokeTokens deletes the tokens selected by scope that match the filters and
+// records the revocation in the audit log, in one transaction. It sends the
+// response.
+func revokeTokens(c *gin.Context, uid, orgID uuid.UUID, projectID *uuid.UUID, req RevokeTokensRequest, scope func(tx *gorm.DB) *gorm.DB) {
+	var ids []uuid.UUID
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		query := scope(tx.Model(&models.ProjectToken{}))
+		if err := req.apply(query, time.Now()).Pluck("project_tokens.id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			if err := tx.Where("id IN ?", ids).Delete(&models.ProjectToken{}).Error; err != nil {
+				return err
+			}
+		}
+		return recordAuditEvent(tx, orgID, projectID, uid, models.AuditTokensRevoked, "Revoked "+req.describe(), len(ids))
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to revoke tokens")
+		return
+	}
+
+	if ids == nil {
+		ids = []uuid.UUID{}
+	}
+	RespondOK(c, RevokeTokensResponse{Revoked: len(ids), TokenIDs: ids})
+}
+
+func recordAuditEvent(db *gorm.DB, orgID uuid.UUID, projectID *uuid.UUID, actorID uuid.UUID, action, detail string, count int) error {
+	return db.Create(&models.AuditEvent{
+		OrganizationID: orgID,
+		ProjectID:      projectID,
+		ActorID:        actorID,
+		Action:         action,
+		Detail:         detail,
+		Count:          count,
+	}).Error
+}
+
+// GetAuditEvents lists the organization's audit log, without the read events
+func GetAuditEvents(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := ParseUUIDParam(c, "id", "organization")
+	if !ok {
+		return
+	}
+
+	if _, ok := RequireOrgAdmin(c, uid, orgID); !ok {
+		return
+	}
+
+	page, ok := RequestedPage(c)
+	if !ok {
+		return
+	}
+
+	var events []models.AuditEvent
+	// Read events have their own listing, see GetReadEvents
+	query := requestDB(c).Where("organization_id = ? AND action NOT IN ?", orgID, models.AuditReadActions)
+	if err := page.Apply(query, "audit_events").Find(&events).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch audit events")
+		return
+	}
+
+	var response AuditEventPage
+	response.Items, response.NextCursor = pageItems(page, events, func(e *models.AuditEvent) (time.Time, uuid.UUID) {
+		return e.CreatedAt, e.ID
+	})
+	RespondOK(c, response)
+}
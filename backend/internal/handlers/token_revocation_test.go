@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestRevokeTokensRequestDescribe(t *testing.T) {
+	days := 90
+	user := uuid.MustParse("7f0c3a52-52f4-4d3c-9a43-61b5b1f7e0aa")
+	tests := []struct {
+		req  RevokeTokensRequest
+		want string
+	}{
+		{RevokeTokensRequest{All: true}, "all tokens"},
+		{RevokeTokensRequest{NeverUsed: true}, "tokens never used"},
+		{RevokeTokensRequest{CreatedBy: &user, OlderThanDays: &days}, "tokens created by 7f0c3a52-52f4-4d3c-9a43-61b5b1f7e0aa, older than 90 days"},
+	}
+	for _, tt := range tests {
+		if got := tt.req.describe(); got != tt.want {
+			t.Errorf("describe() = %q, want %q", got, tt.want)
+		}
+	}
+	if !(RevokeTokensRequest{}).empty() {
+		t.Error("a request without filters is not empty")
+	}
+}
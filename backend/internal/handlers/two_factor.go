@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"envie-backend/internal/apierror"
+	"envie-backend/internal/auth"
+	"envie-backend/internal/database"
+	"envie-backend/internal/middleware"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TwoFactorCodeHeader carries the TOTP or recovery code for sensitive operations
+const TwoFactorCodeHeader = "X-2FA-Code"
+
+// Events recorded in models.TwoFactorEvent
+const (
+	TwoFactorEventEnrollStarted    = "enroll_started"
+	TwoFactorEventEnabled          = "enabled"
+	TwoFactorEventDisabled         = "disabled"
+	TwoFactorEventVerified         = "verified"
+	TwoFactorEventRecoveryCodeUsed = "recovery_code_used"
+	TwoFactorEventCodesRegenerated = "recovery_codes_regenerated"
+	TwoFactorEventFailed           = "failed"
+)
+
+// Sensitive actions that require a second factor once it is enabled
+const (
+	TwoFactorActionRotateMasterKey    = "rotate_master_key"
+	TwoFactorActionDeleteDevice       = "delete_device"
+	TwoFactorActionDeleteAllDevices   = "delete_all_devices"
+	TwoFactorActionCreateProjectToken = "create_project_token"
+	TwoFactorActionRenewProjectToken  = "renew_project_token"
+	TwoFactorActionElevateOrgRole     = "elevate_org_role"
+	TwoFactorActionDisable            = "disable_2fa"
+	TwoFactorActionRegenerateCodes    = "regenerate_recovery_codes"
+	TwoFactorActionConfigureEscrow    = "configure_recovery_escrow"
+	TwoFactorActionReleaseShare       = "release_recovery_share"
+	TwoFactorActionDeleteAccount      = "delete_account"
+	TwoFactorActionApprovePairing     = "approve_pairing"
+)
+
+const (
+	twoFactorMaxFailures   = 5
+	twoFactorFailureWindow = 15 * time.Minute
+)
+
+var errTwoFactorThrottled = errors.New("too many failed two-factor attempts")
+
+type TwoFactorStatusResponse struct {
+	Enabled                bool  `json:"enabled" binding:"required"`
+	RecoveryCodesRemaining int64 `json:"recoveryCodesRemaining" binding:"required"`
+}
+
+type TwoFactorSetupResponse struct {
+	Secret          string `json:"secret" binding:"required"`
+	ProvisioningURI string `json:"provisioningUri" binding:"required"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes" binding:"required"`
+}
+
+func GetTwoFactorStatus(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	var user models.User
+	if err := requestDB(c).First(&user, "id = ?", uid).Error; err != nil {
+		RespondNotFound(c, "User not found")
+		return
+	}
+
+	var remaining int64
+	if user.TwoFactorEnabled {
+		requestDB(c).Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", uid).Count(&remaining)
+	}
+
+	RespondOK(c, TwoFactorStatusResponse{Enabled: user.TwoFactorEnabled, RecoveryCodesRemaining: remaining})
+}
+
+// SetupTwoFactor starts enrollment with a new secret. 2FA is enabled only once a
+// code from the authenticator app is confirmed with EnableTwoFactor.
+func SetupTwoFactor(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	var user models.User
+	if err := requestDB(c).First(&user, "id = ?", uid).Error; err != nil {
+		RespondNotFound(c, "User not found")
+		return
+	}
+	if user.TwoFactorEnabled {
+		RespondConflict(c, "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		RespondInternalError(c, "Failed to generate secret")
+		return
+	}
+	if err := requestDB(c).Model(&user).Updates(map[string]any{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+		RespondInternalError(c, "Failed to save secret")
+		return
+	}
+
+	recordTwoFactorEvent(c, uid, TwoFactorEventEnrollStarted, "")
+	RespondOK(c, TwoFactorSetupResponse{Secret: secret, ProvisioningURI: auth.TOTPProvisioningURI(secret, user.Email)})
+}
+
+// EnableTwoFactor confirms enrollment with a code and returns the recovery codes,
+// which are never shown again
+func EnableTwoFactor(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	var user models.User
+	if err := requestDB(c).First(&user, "id = ?", uid).Error; err != nil {
+		RespondNotFound(c, "User not found")
+		return
+	}
+	if user.TwoFactorEnabled {
+		RespondConflict(c, "Two-factor authentication is already enabled")
+		return
+	}
+	if user.TOTPSecret == nil {
+		RespondBadRequest(c, "Start two-factor setup first")
+		return
+	}
+	if twoFactorThrottled(uid) {
+		RespondError(c, http.StatusTooManyRequests, "Too many failed two-factor attempts, try again later")
+		return
+	}
+
+	step, err := auth.ValidateTOTP(*user.TOTPSecret, normalizeTwoFactorCode(req.Code), time.Now(), user.TOTPLastStep)
+	if err != nil {
+		recordTwoFactorEvent(c, uid, TwoFactorEventFailed, "")
+		RespondBadRequest(c, "Invalid two-factor code")
+		return
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		RespondInternalError(c, "Failed to generate recovery codes")
+		return
+	}
+
+	err = database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]any{"two_factor_enabled": true, "totp_last_step": step}).Error; err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, uid, hashes)
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to enable two-factor authentication")
+		return
+	}
+
+	recordTwoFactorEvent(c, uid, TwoFactorEventEnabled, "")
+	RespondOK(c, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func DisableTwoFactor(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+	if !checkTwoFactorCode(c, uid, req.Code, TwoFactorActionDisable) {
+		return
+	}
+
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", uid).
+			Updates(map[string]any{"two_factor_enabled": false, "totp_secret": nil, "totp_last_step": 0}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", uid).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		RespondInternalError(c, "Failed to disable two-factor authentication")
+		return
+	}
+
+	recordTwoFactorEvent(c, uid, TwoFactorEventDisabled, "")
+	RespondMessage(c, "Two-factor authentication disabled")
+}
+
+// RegenerateRecoveryCodes replaces every recovery code, used or not
+func RegenerateRecoveryCodes(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+	if !checkTwoFactorCode(c, uid, req.Code, TwoFactorActionRegenerateCodes) {
+		return
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		RespondInternalError(c, "Failed to generate recovery codes")
+		return
+	}
+	if err := database.Transaction(requestDB(c), func(tx *gorm.DB) error { return replaceRecoveryCodes(tx, uid, hashes) }); err != nil {
+		RespondInternalError(c, "Failed to save recovery codes")
+		return
+	}
+
+	recordTwoFactorEvent(c, uid, TwoFactorEventCodesRegenerated, "")
+	RespondOK(c, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// TwoFactorEventPage - a page of 2FA events, newest first
+type TwoFactorEventPage struct {
+	Items      []models.TwoFactorEvent `json:"items"`
+	NextCursor string                  `json:"nextCursor,omitempty"`
+}
+
+func GetTwoFactorEvents(c *gin.Context) {
+	uid, ok := GetAuthUserID(c)
+	if !ok {
+		return
+	}
+
+	page, ok := RequestedPage(c)
+	if !ok {
+		return
+	}
+
+	var events []models.TwoFactorEvent
+	if err := page.Apply(requestDB(c).Where("user_id = ?", uid), "two_factor_events").Find(&events).Error; err != nil {
+		RespondInternalError(c, "Failed to fetch two-factor events")
+		return
+	}
+
+	var response TwoFactorEventPage
+	response.Items, response.NextCursor = pageItems(page, events, func(e *models.TwoFactorEvent) (time.Time, uuid.UUID) {
+		return e.CreatedAt, e.ID
+	})
+	RespondOK(c, response)
+}
+
+// RequireTwoFactor checks the second factor before a sensitive action. Users
+// without 2FA pass; the others must send a valid code in TwoFactorCodeHeader.
+// If unsuccessful, it sends an error response automatically.
+func RequireTwoFactor(c *gin.Context, userID uuid.UUID, action string) bool {
+	var user models.User
+	if err := requestDB(c).Select("id", "two_factor_enabled").First(&user, "id = ?", userID).Error; err != nil {
+		RespondNotFound(c, "User not found")
+		return false
+	}
+	if !user.TwoFactorEnabled {
+		return true
+	}
+
+	code := c.GetHeader(TwoFactorCodeHeader)
+	if code == "" {
+		middleware.SkipIdempotencyRecord(c)
+		c.JSON(http.StatusForbidden, apierror.H(apierror.CodeTwoFactorRequired, "Two-factor code required", gin.H{"twoFactorRequired": true}))
+		return false
+	}
+	return checkTwoFactorCode(c, userID, code, action)
+}
+
+// checkTwoFactorCode verifies and consumes a TOTP or recovery code, auditing the
+// outcome. If unsuccessful, it sends an error response automatically.
+func checkTwoFactorCode(c *gin.Context, userID uuid.UUID, code, action string) bool {
+	event, err := verifyTwoFactorCode(userID, normalizeTwoFactorCode(code), time.Now())
+	switch {
+	case errors.Is(err, errTwoFactorThrottled):
+		middleware.SkipIdempotencyRecord(c)
+		RespondError(c, http.StatusTooManyRequests, "Too many failed two-factor attempts, try again later")
+		return false
+	case errors.Is(err, auth.ErrInvalidTwoFactorCode):
+		recordTwoFactorEvent(c, userID, TwoFactorEventFailed, action)
+		middleware.SkipIdempotencyRecord(c)
+		c.JSON(http.StatusForbidden, apierror.H(apierror.CodeTwoFactorInvalid, "Invalid two-factor code", gin.H{"twoFactorRequired": true}))
+		return false
+	case err != nil:
+		RespondInternalError(c, "Failed to verify two-factor code")
+		return false
+	}
+
+	recordTwoFactorEvent(c, userID, event, action)
+	return true
+}
+
+// verifyTwoFactorCode accepts a TOTP code or an unused recovery code and marks it
+// used, returning the event to audit
+func verifyTwoFactorCode(userID uuid.UUID, code string, now time.Time) (string, error) {
+	if twoFactorThrottled(userID) {
+		return "", errTwoFactorThrottled
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, "id = ?", userID).Error; err != nil {
+		return "", err
+	}
+	if !user.TwoFactorEnabled || user.TOTPSecret == nil {
+		return "", auth.ErrInvalidTwoFactorCode
+	}
+
+	if isTOTPCode(code) {
+		step, err := auth.ValidateTOTP(*user.TOTPSecret, code, now, user.TOTPLastStep)
+		if err != nil {
+			return "", err
+		}
+		// Conditional update so two requests can't both spend the same code
+		result := database.DB.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", userID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return "", result.Error
+		}
+		if result.RowsAffected != 1 {
+			return "", auth.ErrInvalidTwoFactorCode
+		}
+		return TwoFactorEventVerified, nil
+	}
+
+	result := database.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, auth.HashRecoveryCode(code)).
+		Update("used_at", now)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected != 1 {
+		return "", auth.ErrInvalidTwoFactorCode
+	}
+	return TwoFactorEventRecoveryCodeUsed, nil
+}
+
+func twoFactorThrottled(userID uuid.UUID) bool {
+	var failures int64
+	database.DB.Model(&models.TwoFactorEvent{}).
+		Where("user_id = ? AND event = ? AND created_at > ?", userID, TwoFactorEventFailed, time.Now().Add(-twoFactorFailureWindow)).
+		Count(&failures)
+	return failures >= twoFactorMaxFailures
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uuid.UUID, hashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]models.RecoveryCode, len(hashes))
+	for i, hash := range hashes {
+		codes[i] = models.RecoveryCode{UserID: userID, CodeHash: hash}
+	}
+	return tx.Create(&codes).Error
+}
+
+func recordTwoFactorEvent(c *gin.Context, userID uuid.UUID, event, action string) {
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+	requestDB(c).Create(&models.TwoFactorEvent{
+		UserID:    userID,
+		Event:     event,
+		Action:    action,
+		IPAddress: middleware.ClientIP(c),
+		UserAgent: userAgent,
+	})
+}
+
+func normalizeTwoFactorCode(code string) string {
+	return strings.TrimSpace(code)
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != auth.TOTPDigits {
+		return false
+	}
+	for _, r := range code {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
+	"envie-backend/internal/apierror"
 	"envie-backend/internal/database"
 	"envie-backend/internal/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 func GetMe(c *gin.Context) {
@@ -16,7 +19,7 @@ func GetMe(c *gin.Context) {
 	}
 
 	var user models.User
-	if err := database.DB.First(&user, "id = ?", uid).Error; err != nil {
+	if err := requestDB(c).First(&user, "id = ?", uid).Error; err != nil {
 		RespondNotFound(c, "User not found")
 		return
 	}
@@ -24,23 +27,23 @@ func GetMe(c *gin.Context) {
 	RespondOK(c, user)
 }
 
+type SetPublicKeyRequest struct {
+	PublicKey string `json:"publicKey" binding:"required"`
+}
+
 func SetPublicKey(c *gin.Context) {
 	uid, exists := GetAuthUserID(c)
 	if !exists {
 		return
 	}
 
-	var req struct {
-		PublicKey string `json:"publicKey" binding:"required"`
-	}
-
-	if err := c.ShouldBindJSON(&req); err != nil {
-		RespondBadRequest(c, "Public key is required")
+	var req SetPublicKeyRequest
+	if !BindJSON(c, &req) {
 		return
 	}
 
 	var user models.User
-	if err := database.DB.First(&user, "id = ?", uid).Error; err != nil {
+	if err := requestDB(c).First(&user, "id = ?", uid).Error; err != nil {
 		RespondNotFound(c, "User not found")
 		return
 	}
@@ -54,7 +57,7 @@ func SetPublicKey(c *gin.Context) {
 	}
 
 	user.PublicKey = &req.PublicKey
-	if err := database.DB.Save(&user).Error; err != nil {
+	if err := requestDB(c).Save(&user).Error; err != nil {
 		RespondInternalError(c, "Failed to save public key")
 		return
 	}
@@ -67,8 +70,8 @@ func SetPublicKey(c *gin.Context) {
 
 type RotateMasterKeyRequest struct {
 	NewPublicKey string            `json:"newPublicKey" binding:"required"`
-	IdentityKeys map[string]string `json:"identityKeys" binding:"required"`
-	TeamKeys     map[string]string `json:"teamKeys" binding:"required"`
+	IdentityKeys map[string]string `json:"identityKeys" binding:"required,dive,keys,uuid,endkeys,ciphertext"`
+	TeamKeys     map[string]string `json:"teamKeys" binding:"required,dive,keys,uuid,endkeys,ciphertext"`
 }
 
 func RotateMasterKey(c *gin.Context) {
@@ -78,97 +81,84 @@ func RotateMasterKey(c *gin.Context) {
 	}
 
 	var req RotateMasterKeyRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+	if !BindJSON(c, &req) {
 		return
 	}
 
-	// Start transaction
-	tx := database.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
-	// Get user
-	var user models.User
-	if err := tx.First(&user, "id = ?", uid).Error; err != nil {
-		tx.Rollback()
-		RespondNotFound(c, "User not found")
+	if !RequireTwoFactor(c, uid, TwoFactorActionRotateMasterKey) {
 		return
 	}
 
+	var user models.User
 	var identities []models.UserIdentity
-	if err := tx.Where("user_id = ? AND encrypted_master_key IS NOT NULL", uid).Find(&identities).Error; err != nil {
-		tx.Rollback()
-		RespondInternalError(c, "Failed to fetch identities")
-		return
-	}
+	var teamUsers []models.TeamUser
+	err := database.Transaction(requestDB(c), func(tx *gorm.DB) error {
+		user, identities, teamUsers = models.User{}, nil, nil
+		if err := tx.First(&user, "id = ?", uid).Error; err != nil {
+			return err
+		}
 
-	// Validate all identities are covered
-	for _, identity := range identities {
-		if _, ok := req.IdentityKeys[identity.ID.String()]; !ok {
-			tx.Rollback()
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":      "Missing key for identity",
-				"identityId": identity.ID.String(),
-				"name":       identity.Name,
-			})
-			return
+		if err := tx.Where("user_id = ? AND encrypted_master_key IS NOT NULL", uid).Find(&identities).Error; err != nil {
+			return err
 		}
-	}
 
-	var teamUsers []models.TeamUser
-	if err := tx.Where("user_id = ?", uid).Find(&teamUsers).Error; err != nil {
-		tx.Rollback()
-		RespondInternalError(c, "Failed to fetch team memberships")
-		return
-	}
+		// Validate all identities are covered
+		for _, identity := range identities {
+			if _, ok := req.IdentityKeys[identity.ID.String()]; !ok {
+				return &missingKeyError{"Missing key for identity", gin.H{
+					"identityId": identity.ID.String(),
+					"name":       identity.Name,
+				}}
+			}
+		}
 
-	for _, tu := range teamUsers {
-		if _, ok := req.TeamKeys[tu.TeamID.String()]; !ok {
-			tx.Rollback()
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":  "Missing key for team",
-				"teamId": tu.TeamID.String(),
-			})
-			return
+		if err := tx.Where("user_id = ?", uid).Find(&teamUsers).Error; err != nil {
+			return err
 		}
-	}
 
-	user.PublicKey = &req.NewPublicKey
-	user.MasterKeyVersion++
-	if err := tx.Save(&user).Error; err != nil {
-		tx.Rollback()
-		RespondInternalError(c, "Failed to update user")
-		return
-	}
+		for _, tu := range teamUsers {
+			if _, ok := req.TeamKeys[tu.TeamID.String()]; !ok {
+				return &missingKeyError{"Missing key for team", gin.H{
+					"teamId": tu.TeamID.String(),
+				}}
+			}
+		}
 
-	for _, identity := range identities {
-		newEncryptedKey := req.IdentityKeys[identity.ID.String()]
-		if err := tx.Model(&models.UserIdentity{}).
-			Where("id = ?", identity.ID).
-			Update("encrypted_master_key", newEncryptedKey).Error; err != nil {
-			tx.Rollback()
-			RespondInternalError(c, "Failed to update identity key")
-			return
+		user.PublicKey = &req.NewPublicKey
+		user.MasterKeyVersion++
+		if err := tx.Save(&user).Error; err != nil {
+			return err
 		}
-	}
 
-	for _, tu := range teamUsers {
-		newEncryptedTeamKey := req.TeamKeys[tu.TeamID.String()]
-		if err := tx.Model(&models.TeamUser{}).
-			Where("team_id = ? AND user_id = ?", tu.TeamID, uid).
-			Update("encrypted_team_key", newEncryptedTeamKey).Error; err != nil {
-			tx.Rollback()
-			RespondInternalError(c, "Failed to update team key")
-			return
+		for _, identity := range identities {
+			newEncryptedKey := req.IdentityKeys[identity.ID.String()]
+			if err := tx.Model(&models.UserIdentity{}).
+				Where("id = ?", identity.ID).
+				Update("encrypted_master_key", newEncryptedKey).Error; err != nil {
+				return err
+			}
 		}
-	}
 
-	if err := tx.Commit().Error; err != nil {
-		RespondInternalError(c, "Failed to commit transaction")
+		for _, tu := range teamUsers {
+			newEncryptedTeamKey := req.TeamKeys[tu.TeamID.String()]
+			if err := tx.Model(&models.TeamUser{}).
+				Where("team_id = ? AND user_id = ?", tu.TeamID, uid).
+				Update("encrypted_team_key", newEncryptedTeamKey).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	var missing *missingKeyError
+	switch {
+	case errors.As(err, &missing):
+		c.JSON(http.StatusBadRequest, apierror.H(apierror.CodeBadRequest, missing.message, missing.details))
+		return
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		RespondNotFound(c, "User not found")
+		return
+	case err != nil:
+		RespondInternalError(c, "Failed to rotate master key")
 		return
 	}
 
@@ -181,16 +171,25 @@ func RotateMasterKey(c *gin.Context) {
 	})
 }
 
+// missingKeyError rejects a master key rotation that leaves out a key the user
+// holds
+type missingKeyError struct {
+	message string
+	details gin.H
+}
+
+func (e *missingKeyError) Error() string { return e.message }
+
 func SearchUserByEmail(c *gin.Context) {
 	email := c.Query("email")
 	if email == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "email query parameter required"})
+		RespondError(c, http.StatusBadRequest, "email query parameter required")
 		return
 	}
 
 	var user models.User
-	if err := database.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	if err := requestDB(c).Where("email = ?", email).First(&user).Error; err != nil {
+		RespondError(c, http.StatusNotFound, "User not found")
 		return
 	}
 
@@ -0,0 +1,169 @@
+// Package ipallowlist keeps members of organizations with an IP allowlist from
+// using the application API outside the allowed ranges.
+//
+// The allowlists and their organizations' members are held in memory and
+// reloaded at most every refreshInterval, so checking a request costs no query.
+// Changing an allowlist reloads it on the instance that made the change; other
+// instances, and membership changes, catch up within refreshInterval.
+package ipallowlist
+
+import (
+	"log"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"envie-backend/internal/apierror"
+	"envie-backend/internal/database"
+	"envie-backend/internal/middleware"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const refreshInterval = 30 * time.Second
+
+// exemptRoutes can be used from anywhere, so a rejected member can still see who
+// they are signed in as, which organizations they belong to, and sign out
+var exemptRoutes = map[string]bool{
+	"GET /me":            true,
+	"GET /organizations": true,
+	"POST /auth/logout":  true,
+}
+
+// Restriction is the allowlist of one organization
+type Restriction struct {
+	OrganizationID uuid.UUID
+	Name           string
+	Ranges         []netip.Prefix
+}
+
+// Allows reports whether the client address ip is inside the allowlist
+func (r *Restriction) Allows(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range r.Ranges {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	mu       sync.Mutex
+	loadedAt time.Time
+	byUser   map[uuid.UUID][]*Restriction
+)
+
+// Invalidate makes the next check reload the allowlists
+func Invalidate() {
+	mu.Lock()
+	defer mu.Unlock()
+	loadedAt = time.Time{}
+}
+
+// Blocking returns the allowlist of an organization of userID that doesn't allow
+// ip, or nil if every one of them does
+func Blocking(db *gorm.DB, userID uuid.UUID, ip string, now time.Time) (*Restriction, error) {
+	restrictions, err := restrictionsOf(db, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	for _, restriction := range restrictions {
+		if !restriction.Allows(ip) {
+			return restriction, nil
+		}
+	}
+	return nil, nil
+}
+
+func restrictionsOf(db *gorm.DB, userID uuid.UUID, now time.Time) ([]*Restriction, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if now.Sub(loadedAt) >= refreshInterval {
+		loaded, err := load(db)
+		if err != nil {
+			return nil, err
+		}
+		byUser, loadedAt = loaded, now
+	}
+	return byUser[userID], nil
+}
+
+// load reads every organization with an allowlist and its members
+func load(db *gorm.DB) (map[uuid.UUID][]*Restriction, error) {
+	var orgs []models.Organization
+	if err := db.Select("id, name, allowed_cidrs").
+		Where("allowed_cidrs IS NOT NULL AND allowed_cidrs NOT IN ('', 'null', '[]')").
+		Find(&orgs).Error; err != nil {
+		return nil, err
+	}
+
+	restrictions := map[uuid.UUID]*Restriction{}
+	var orgIDs []uuid.UUID
+	for _, org := range orgs {
+		restriction := &Restriction{OrganizationID: org.ID, Name: org.Name}
+		for _, cidr := range org.AllowedCIDRs {
+			if prefix, err := netip.ParsePrefix(cidr); err == nil {
+				restriction.Ranges = append(restriction.Ranges, prefix)
+			}
+		}
+		restrictions[org.ID] = restriction
+		orgIDs = append(orgIDs, org.ID)
+	}
+
+	loaded := map[uuid.UUID][]*Restriction{}
+	if len(orgIDs) == 0 {
+		return loaded, nil
+	}
+
+	var members []models.OrganizationUser
+	if err := db.Select("organization_id, user_id").Where("organization_id IN ?", orgIDs).Find(&members).Error; err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		loaded[member.UserID] = append(loaded[member.UserID], restrictions[member.OrganizationID])
+	}
+	return loaded, nil
+}
+
+// Middleware rejects requests of members of an organization from outside its
+// allowlist. Place it after the authentication middleware.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid, ok := c.Get("user_id")
+		userID, isUUID := uid.(uuid.UUID)
+		if !ok || !isUUID || exempt(c.Request.Method, c.FullPath()) {
+			c.Next()
+			return
+		}
+
+		ip := middleware.ClientIP(c)
+		blocking, err := Blocking(database.DB, userID, ip, time.Now())
+		if err != nil {
+			log.Printf("Failed to check organization IP allowlists: %v", err)
+			apierror.Abort(c, apierror.New(http.StatusInternalServerError, apierror.CodeInternal, "Failed to check the organization IP allowlist"))
+			return
+		}
+		if blocking != nil {
+			log.Printf("Request of user %s from %s rejected: outside the IP allowlist of organization %s", userID, ip, blocking.OrganizationID)
+			c.AbortWithStatusJSON(http.StatusForbidden, apierror.H(apierror.CodeIPNotAllowed,
+				blocking.Name+" doesn't allow access from "+ip, gin.H{"ipNotAllowed": true}))
+			return
+		}
+		c.Next()
+	}
+}
+
+// exempt reports whether a route template, versioned or not, is in exemptRoutes
+func exempt(method, route string) bool {
+	return exemptRoutes[method+" "+strings.TrimPrefix(route, "/v1")]
+}
@@ -0,0 +1,34 @@
+package ipallowlist
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestRestrictionAllows(t *testing.T) {
+	r := &Restriction{Ranges: []netip.Prefix{
+		netip.MustParsePrefix("203.0.113.0/24"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}}
+	for ip, want := range map[string]bool{
+		"203.0.113.9":        true,
+		"::ffff:203.0.113.9": true,
+		"2001:db8::1":        true,
+		"198.51.100.1":       false,
+		"":                   false,
+		"not-an-ip":          false,
+	} {
+		if got := r.Allows(ip); got != want {
+			t.Errorf("Allows(%q) = %v, want %v", ip, got, want)
+		}
+	}
+}
+
+func TestExempt(t *testing.T) {
+	if !exempt("GET", "/v1/me") || !exempt("GET", "/me") || !exempt("POST", "/v1/auth/logout") {
+		t.Error("exempt route not exempt")
+	}
+	if exempt("PUT", "/v1/me/public-key") || exempt("GET", "/v1/organizations/:id") || exempt("POST", "/v1/organizations") {
+		t.Error("route exempt by mistake")
+	}
+}
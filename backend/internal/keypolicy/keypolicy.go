@@ -0,0 +1,226 @@
+// Package keypolicy flags projects whose key is older than their key rotation
+// policy allows, and tells the project admins through their notification center
+// and the policy's webhook. The webhook also hears about every committed
+// rotation, with the steps automation has to take afterwards.
+//
+// A project is flagged once per overdue period: the flag is claimed with a
+// conditional update, so with several instances running each project is still
+// notified once, and it is cleared when a rotation commits.
+package keypolicy
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	checkIntervalEnv = "KEY_AGE_CHECK_INTERVAL"
+
+	defaultInterval = time.Hour
+)
+
+// OverdueProject is a project whose key is older than its policy allows
+type OverdueProject struct {
+	ProjectID      uuid.UUID  `json:"projectId"`
+	ProjectName    string     `json:"projectName"`
+	OrganizationID uuid.UUID  `json:"organizationId"`
+	KeyVersion     int        `json:"keyVersion"`
+	KeyChangedAt   time.Time  `json:"keyChangedAt"` // last rotation, or creation before the first one
+	MaxKeyAgeDays  int        `json:"maxKeyAgeDays"`
+	DueAt          time.Time  `json:"dueAt"`
+	FlaggedAt      *time.Time `json:"flaggedAt"` // when the admins were notified
+
+	webhookURL *string
+}
+
+// Webhook posts a JSON payload to a policy webhook
+type Webhook interface {
+	PostWebhook(target string, payload any) error
+}
+
+// IntervalFromEnv reads KEY_AGE_CHECK_INTERVAL, a duration such as 1h. Unset
+// means hourly, 0 disables the check.
+func IntervalFromEnv() (time.Duration, error) {
+	value := os.Getenv(checkIntervalEnv)
+	if value == "" {
+		return defaultInterval, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval < 0 {
+		return 0, fmt.Errorf("invalid %s %q", checkIntervalEnv, value)
+	}
+	return interval, nil
+}
+
+// StartChecker flags overdue projects each interval in the background
+func StartChecker(interval time.Duration, webhook Webhook) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := Check(database.DB, webhook, time.Now()); err != nil {
+				log.Printf("Failed to check key rotation policies: %v", err)
+			}
+		}
+	}()
+}
+
+// dueAt is when a key changed at keyChangedAt outgrows a policy
+func dueAt(keyChangedAt time.Time, maxKeyAgeDays int) time.Time {
+	return keyChangedAt.AddDate(0, 0, maxKeyAgeDays)
+}
+
+// Overdue lists the projects of an organization, or of every organization when
+// orgID is nil, whose key is older than their policy allows, oldest key first
+func Overdue(db *gorm.DB, orgID *uuid.UUID, now time.Time) ([]OverdueProject, error) {
+	var rows []struct {
+		ProjectID            uuid.UUID
+		ProjectName          string
+		OrganizationID       uuid.UUID
+		KeyVersion           int
+		KeyChangedAt         time.Time
+		MaxKeyAgeDays        int
+		WebhookURL           *string
+		KeyRotationOverdueAt *time.Time
+	}
+
+	// A project policy replaces the organization policy, webhook included
+	query := db.Table("projects").
+		Select(`projects.id AS project_id, projects.name AS project_name, projects.organization_id, projects.key_version,
+			COALESCE(projects.key_rotated_at, projects.created_at) AS key_changed_at,
+			COALESCE(project_policy.max_key_age_days, org_policy.max_key_age_days) AS max_key_age_days,
+			CASE WHEN project_policy.id IS NULL THEN org_policy.webhook_url ELSE project_policy.webhook_url END AS webhook_url,
+			projects.key_rotation_overdue_at`).
+		Joins("LEFT JOIN key_rotation_policies project_policy ON project_policy.project_id = projects.id").
+		Joins("LEFT JOIN key_rotation_policies org_policy ON org_policy.organization_id = projects.organization_id AND org_policy.project_id IS NULL").
+		Where("projects.deleted_at IS NULL").
+		Where("project_policy.id IS NOT NULL OR org_policy.id IS NOT NULL").
+		Where("projects.organization_id IN (?)", db.Model(&models.Organization{}).Select("id"))
+	if orgID != nil {
+		query = query.Where("projects.organization_id = ?", *orgID)
+	}
+	if err := query.Order("key_changed_at").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	overdue := []OverdueProject{}
+	for _, row := range rows {
+		if row.MaxKeyAgeDays == 0 {
+			continue // the policy only has a webhook
+		}
+		due := dueAt(row.KeyChangedAt, row.MaxKeyAgeDays)
+		if !now.After(due) {
+			continue
+		}
+		overdue = append(overdue, OverdueProject{
+			ProjectID:      row.ProjectID,
+			ProjectName:    row.ProjectName,
+			OrganizationID: row.OrganizationID,
+			KeyVersion:     row.KeyVersion,
+			KeyChangedAt:   row.KeyChangedAt,
+			MaxKeyAgeDays:  row.MaxKeyAgeDays,
+			DueAt:          due,
+			FlaggedAt:      row.KeyRotationOverdueAt,
+			webhookURL:     row.WebhookURL,
+		})
+	}
+	return overdue, nil
+}
+
+// Check flags the overdue projects that aren't flagged yet and notifies their
+// admins and policy webhook
+func Check(db *gorm.DB, webhook Webhook, now time.Time) error {
+	overdue, err := Overdue(db, nil, now)
+	if err != nil {
+		return err
+	}
+
+	for i := range overdue {
+		project := &overdue[i]
+		if project.FlaggedAt != nil {
+			continue
+		}
+
+		// Claim the project first, so only one instance notifies it. UpdateColumn
+		// leaves updated_at, which orders the project lists, alone.
+		claim := db.Model(&models.Project{}).
+			Where("id = ? AND key_rotation_overdue_at IS NULL", project.ProjectID).
+			UpdateColumn("key_rotation_overdue_at", now)
+		if claim.Error != nil {
+			log.Printf("Failed to flag project %s: %v", project.ProjectID, claim.Error)
+			continue
+		}
+		if claim.RowsAffected != 1 {
+			continue
+		}
+		project.FlaggedAt = &now
+
+		if err := notifyAdmins(db, project); err != nil {
+			log.Printf("Failed to notify admins of project %s: %v", project.ProjectID, err)
+		}
+		if project.webhookURL != nil && webhook != nil {
+			if err := webhook.PostWebhook(*project.webhookURL, webhookPayload{
+				Event:          "project.key_rotation_overdue",
+				Text:           describe(project),
+				OverdueProject: *project,
+			}); err != nil {
+				log.Printf("Failed to post key rotation webhook for project %s: %v", project.ProjectID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// webhookPayload is the JSON body posted to policy webhooks
+type webhookPayload struct {
+	Event string `json:"event"`
+	Text  string `json:"text"` // for chat webhooks such as Slack's
+	OverdueProject
+}
+
+func describe(project *OverdueProject) string {
+	return fmt.Sprintf("Envie: the key of project %s is older than %d days, rotate it (due %s)",
+		project.ProjectName, project.MaxKeyAgeDays, project.DueAt.UTC().Format("2006-01-02"))
+}
+
+// notifyAdmins adds a notification for every organization admin and every admin
+// of a team with access to the project
+func notifyAdmins(db *gorm.DB, project *OverdueProject) error {
+	var userIDs []uuid.UUID
+	if err := db.Raw(`
+		SELECT user_id FROM organization_users
+		WHERE organization_id = ? AND (role = 'owner' OR role = 'Owner' OR role = 'admin')
+
+		UNION
+
+		SELECT team_users.user_id FROM team_users
+		JOIN team_projects ON team_projects.team_id = team_users.team_id
+		WHERE team_projects.project_id = ? AND (team_users.role = 'owner' OR team_users.role = 'admin')
+	`, project.OrganizationID, project.ProjectID).Scan(&userIDs).Error; err != nil {
+		return err
+	}
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	notifications := make([]models.Notification, len(userIDs))
+	for i, userID := range userIDs {
+		notifications[i] = models.Notification{
+			UserID:         userID,
+			Kind:           models.NotificationKeyRotationOverdue,
+			Title:          "Key rotation overdue for " + project.ProjectName,
+			Body:           describe(project),
+			OrganizationID: &project.OrganizationID,
+			ProjectID:      &project.ProjectID,
+		}
+	}
+	return db.Create(&notifications).Error
+}
@@ -0,0 +1,67 @@
+package keypolicy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"envie-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestDueAt(t *testing.T) {
+	changed := time.Date(2026, 1, 31, 9, 30, 0, 0, time.UTC)
+	if got, want := dueAt(changed, 90), time.Date(2026, 5, 1, 9, 30, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("dueAt = %s, want %s", got, want)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	project := &OverdueProject{ProjectName: "api", MaxKeyAgeDays: 30, DueAt: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)}
+	if got := describe(project); got != "Envie: the key of project api is older than 30 days, rotate it (due 2026-10-01)" {
+		t.Errorf("describe = %q", got)
+	}
+}
+
+func TestIntervalFromEnv(t *testing.T) {
+	t.Setenv(checkIntervalEnv, "")
+	if interval, err := IntervalFromEnv(); err != nil || interval != defaultInterval {
+		t.Errorf("IntervalFromEnv = %s, %v", interval, err)
+	}
+	t.Setenv(checkIntervalEnv, "0")
+	if interval, err := IntervalFromEnv(); err != nil || interval != 0 {
+		t.Errorf("IntervalFromEnv = %s, %v", interval, err)
+	}
+	t.Setenv(checkIntervalEnv, "-1h")
+	if _, err := IntervalFromEnv(); err == nil {
+		t.Error("negative interval accepted")
+	}
+}
+
+func TestRotationCompleted(t *testing.T) {
+	project := &models.Project{ID: uuid.New(), Name: "api", Slug: "api", KeyVersion: 3}
+	tokens := []models.ProjectToken{{ID: uuid.New(), Name: "ci"}, {ID: uuid.New(), Name: "prod"}}
+	targets := []models.DeploymentTarget{{ID: uuid.New(), Name: "web", Provider: "vercel"}}
+
+	event := rotationCompleted(project, 2, time.Now(), tokens, targets)
+	if event.Event != "project.key_rotated" || event.KeyVersion != 3 || event.PreviousKeyVersion != 2 {
+		t.Errorf("event = %+v", event)
+	}
+	if len(event.RevokedTokens) != 2 || event.RevokedTokens[0].Name != "ci" {
+		t.Errorf("revokedTokens = %+v", event.RevokedTokens)
+	}
+
+	var actions []string
+	for _, action := range event.ActionsRequired {
+		actions = append(actions, action.Action+":"+action.Name)
+	}
+	if got := strings.Join(actions, ","); got != "replace_token:ci,replace_token:prod,redeploy:web" {
+		t.Errorf("actionsRequired = %s", got)
+	}
+
+	// Without revoked tokens nothing has to be redeployed
+	if event := rotationCompleted(project, 2, time.Now(), nil, targets); len(event.ActionsRequired) != 0 || event.RevokedTokens == nil {
+		t.Errorf("no tokens: actionsRequired = %+v, revokedTokens = %v", event.ActionsRequired, event.RevokedTokens)
+	}
+}
@@ -0,0 +1,133 @@
+package keypolicy
+
+import (
+	"fmt"
+	"time"
+
+	"envie-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Actions listed in RotationCompleted.ActionsRequired
+const (
+	ActionReplaceToken = "replace_token" // mint a token to replace a revoked one
+	ActionRedeploy     = "redeploy"      // redeploy a deployment target, which read the revoked tokens
+)
+
+// RequiredAction is a step automation has to take after a rotation. ResourceID
+// and Name identify the revoked token or the deployment target.
+type RequiredAction struct {
+	Action     string    `json:"action"`
+	ResourceID uuid.UUID `json:"resourceId"`
+	Name       string    `json:"name"`
+	Provider   string    `json:"provider,omitempty"` // deployment targets only
+}
+
+// RevokedToken is a CLI token deleted by a rotation
+type RevokedToken struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+// RotationCompleted is the body of the project.key_rotated webhook, posted to the
+// policy webhook when a rotation commits
+type RotationCompleted struct {
+	Event              string           `json:"event"`
+	Text               string           `json:"text"` // for chat webhooks such as Slack's
+	ProjectID          uuid.UUID        `json:"projectId"`
+	ProjectName        string           `json:"projectName"`
+	ProjectSlug        string           `json:"projectSlug"`
+	Sandbox            bool             `json:"sandbox"` // a test-mode project
+	OrganizationID     uuid.UUID        `json:"organizationId"`
+	KeyVersion         int              `json:"keyVersion"`
+	PreviousKeyVersion int              `json:"previousKeyVersion"`
+	RotatedAt          time.Time        `json:"rotatedAt"`
+	RevokedTokens      []RevokedToken   `json:"revokedTokens"`
+	ActionsRequired    []RequiredAction `json:"actionsRequired"`
+}
+
+// PolicyFor returns the policy covering a project, nil when there is none. A
+// project policy replaces the organization policy, webhook included.
+func PolicyFor(db *gorm.DB, project *models.Project) (*models.KeyRotationPolicy, error) {
+	var policies []models.KeyRotationPolicy
+	if err := db.Where("organization_id = ? AND (project_id = ? OR project_id IS NULL)", project.OrganizationID, project.ID).
+		Find(&policies).Error; err != nil {
+		return nil, err
+	}
+
+	var policy *models.KeyRotationPolicy
+	for i := range policies {
+		if policies[i].ProjectID != nil {
+			return &policies[i], nil
+		}
+		policy = &policies[i]
+	}
+	return policy, nil
+}
+
+// WebhookURL returns the webhook of the policy covering a project, nil when the
+// policy has none or there is no policy
+func WebhookURL(db *gorm.DB, project *models.Project) (*string, error) {
+	policy, err := PolicyFor(db, project)
+	if err != nil || policy == nil {
+		return nil, err
+	}
+	return policy.WebhookURL, nil
+}
+
+// NotifyRotated posts the project.key_rotated event to the policy webhook of a
+// project whose rotation to its current key version committed at rotatedAt. The
+// tokens the rotation revoked are the ones deleted since rotatedAt.
+func NotifyRotated(db *gorm.DB, webhook Webhook, project *models.Project, previousVersion int, rotatedAt time.Time) error {
+	webhookURL, err := WebhookURL(db, project)
+	if err != nil || webhookURL == nil {
+		return err
+	}
+
+	var tokens []models.ProjectToken
+	if err := db.Unscoped().Select("id, name").
+		Where("project_id = ? AND deleted_at >= ?", project.ID, rotatedAt).
+		Order("name").Find(&tokens).Error; err != nil {
+		return err
+	}
+
+	var targets []models.DeploymentTarget
+	if err := db.Select("id, name, provider").Where("project_id = ?", project.ID).
+		Order("name").Find(&targets).Error; err != nil {
+		return err
+	}
+
+	return webhook.PostWebhook(*webhookURL, rotationCompleted(project, previousVersion, rotatedAt, tokens, targets))
+}
+
+func rotationCompleted(project *models.Project, previousVersion int, rotatedAt time.Time, tokens []models.ProjectToken, targets []models.DeploymentTarget) RotationCompleted {
+	event := RotationCompleted{
+		Event:              "project.key_rotated",
+		Text:               fmt.Sprintf("Envie: the key of project %s was rotated to version %d, %d CLI tokens were revoked", project.Name, project.KeyVersion, len(tokens)),
+		ProjectID:          project.ID,
+		ProjectName:        project.Name,
+		ProjectSlug:        project.Slug,
+		Sandbox:            project.Sandbox,
+		OrganizationID:     project.OrganizationID,
+		KeyVersion:         project.KeyVersion,
+		PreviousKeyVersion: previousVersion,
+		RotatedAt:          rotatedAt,
+		RevokedTokens:      make([]RevokedToken, len(tokens)),
+		ActionsRequired:    make([]RequiredAction, 0, len(tokens)+len(targets)),
+	}
+
+	for i, token := range tokens {
+		event.RevokedTokens[i] = RevokedToken{ID: token.ID, Name: token.Name}
+		event.ActionsRequired = append(event.ActionsRequired, RequiredAction{Action: ActionReplaceToken, ResourceID: token.ID, Name: token.Name})
+	}
+	// Deployments keep running with the values they were given, but the next
+	// sync needs a new token, so they only need a redeploy when tokens were revoked
+	if len(tokens) > 0 {
+		for _, target := range targets {
+			event.ActionsRequired = append(event.ActionsRequired, RequiredAction{Action: ActionRedeploy, ResourceID: target.ID, Name: target.Name, Provider: target.Provider})
+		}
+	}
+	return event
+}
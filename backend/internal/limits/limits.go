@@ -0,0 +1,90 @@
+// Package limits holds the usage limits of the instance: how many projects and
+// members an organization may have, how many active CLI tokens a project and how
+// much file storage an organization. They are groundwork for hosted plans; a
+// self-hosted instance leaves them unset, which is unlimited. Instance
+// administrators can override them per organization.
+package limits
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"envie-backend/internal/models"
+)
+
+const (
+	projectsEnv = "LIMIT_PROJECTS_PER_ORG"
+	membersEnv  = "LIMIT_MEMBERS_PER_ORG"
+	tokensEnv   = "LIMIT_TOKENS_PER_PROJECT"
+	storageEnv  = "LIMIT_STORAGE_BYTES_PER_ORG"
+)
+
+// Limits are maximums; 0 is unlimited
+type Limits struct {
+	ProjectsPerOrg     int
+	MembersPerOrg      int
+	TokensPerProject   int
+	StorageBytesPerOrg int64
+}
+
+// From reads the LIMIT_* variables through getenv
+func From(getenv func(string) string) (Limits, error) {
+	var l Limits
+	var err error
+	if l.ProjectsPerOrg, err = parse[int](getenv, projectsEnv); err != nil {
+		return l, err
+	}
+	if l.MembersPerOrg, err = parse[int](getenv, membersEnv); err != nil {
+		return l, err
+	}
+	if l.TokensPerProject, err = parse[int](getenv, tokensEnv); err != nil {
+		return l, err
+	}
+	if l.StorageBytesPerOrg, err = parse[int64](getenv, storageEnv); err != nil {
+		return l, err
+	}
+	return l, nil
+}
+
+func parse[T int | int64](getenv func(string) string, name string) (T, error) {
+	value := strings.TrimSpace(getenv(name))
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a number of at least 0, got %q", name, value)
+	}
+	return T(n), nil
+}
+
+// With returns the limits with an organization's overrides applied
+func (l Limits) With(o models.PlanLimits) Limits {
+	if o.MaxProjects != nil {
+		l.ProjectsPerOrg = *o.MaxProjects
+	}
+	if o.MaxMembers != nil {
+		l.MembersPerOrg = *o.MaxMembers
+	}
+	if o.MaxTokensPerProject != nil {
+		l.TokensPerProject = *o.MaxTokensPerProject
+	}
+	if o.MaxStorageBytes != nil {
+		l.StorageBytesPerOrg = *o.MaxStorageBytes
+	}
+	return l
+}
+
+// String describes the limits for the log
+func (l Limits) String() string {
+	return fmt.Sprintf("%s projects and %s members per organization, %s tokens per project, %s storage bytes per organization",
+		describe(int64(l.ProjectsPerOrg)), describe(int64(l.MembersPerOrg)), describe(int64(l.TokensPerProject)), describe(l.StorageBytesPerOrg))
+}
+
+func describe(limit int64) string {
+	if limit == 0 {
+		return "unlimited"
+	}
+	return strconv.FormatInt(limit, 10)
+}
@@ -0,0 +1,33 @@
+package limits
+
+import (
+	"testing"
+
+	"envie-backend/internal/models"
+)
+
+func TestFrom(t *testing.T) {
+	env := map[string]string{projectsEnv: "10", tokensEnv: " 5 ", storageEnv: "1073741824"}
+	l, err := From(func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Limits{ProjectsPerOrg: 10, TokensPerProject: 5, StorageBytesPerOrg: 1 << 30}); l != want {
+		t.Errorf("From() = %+v, want %+v", l, want)
+	}
+
+	for _, value := range []string{"-1", "ten", "1.5"} {
+		env := map[string]string{membersEnv: value}
+		if _, err := From(func(name string) string { return env[name] }); err == nil {
+			t.Errorf("%s=%s accepted", membersEnv, value)
+		}
+	}
+}
+
+func TestWith(t *testing.T) {
+	zero, twenty := 0, 20
+	l := Limits{ProjectsPerOrg: 10, MembersPerOrg: 5, TokensPerProject: 3}.With(models.PlanLimits{MaxProjects: &zero, MaxMembers: &twenty})
+	if want := (Limits{ProjectsPerOrg: 0, MembersPerOrg: 20, TokensPerProject: 3}); l != want {
+		t.Errorf("With() = %+v, want %+v", l, want)
+	}
+}
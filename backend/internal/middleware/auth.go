@@ -5,11 +5,13 @@ import (
 	"strconv"
 	"strings"
 
+	"envie-backend/internal/apierror"
 	"envie-backend/internal/auth"
 	"envie-backend/internal/database"
 	"envie-backend/internal/models"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 func AuthMiddleware() gin.HandlerFunc {
@@ -19,31 +21,36 @@ func AuthMiddleware() gin.HandlerFunc {
 			// Try Authorization header as fallback
 			authHeader := c.GetHeader("Authorization")
 			if authHeader == "" {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization token required"})
-				c.Abort()
+				apierror.Abort(c, apierror.New(http.StatusUnauthorized, apierror.CodeTokenMissing, "Authorization token required"))
 				return
 			}
 			parts := strings.Split(authHeader, " ")
 			if len(parts) != 2 || parts[0] != "Bearer" {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
-				c.Abort()
+				apierror.Abort(c, apierror.New(http.StatusUnauthorized, apierror.CodeTokenInvalid, "Invalid authorization header format"))
 				return
 			}
 			tokenString = parts[1]
 		}
 
-		claims, err := auth.ValidateToken(tokenString)
+		claims, err := auth.ValidateAccessToken(tokenString)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
+			apierror.Abort(c, apierror.New(http.StatusUnauthorized, apierror.CodeTokenInvalid, "Invalid token"))
 			return
 		}
 
 		c.Set("user_id", claims.UserID)
+		if claims.SessionID != uuid.Nil {
+			c.Set("session_id", claims.SessionID)
+		}
 
 		// TODO: This doesn't have to run in every request
 		var user models.User
-		if err := database.DB.Select("master_key_version").First(&user, "id = ?", claims.UserID).Error; err == nil {
+		if err := database.DB.Select("master_key_version, disabled_at").First(&user, "id = ?", claims.UserID).Error; err == nil {
+			// Disabling revokes refresh tokens; this ends the access tokens too
+			if user.DisabledAt != nil {
+				apierror.Abort(c, apierror.New(http.StatusForbidden, apierror.CodeAccountDisabled, "Account has been disabled"))
+				return
+			}
 			c.Header("X-Master-Key-Version", strconv.Itoa(user.MasterKeyVersion))
 		}
 
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"envie-backend/internal/apierror"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DefaultBodyLimit caps request bodies on routes without a limit of their own
+	DefaultBodyLimit int64 = 1 << 20
+	// BulkBodyLimit is for routes carrying every value or key of a project, such as
+	// a config sync or a key rotation
+	BulkBodyLimit int64 = 16 << 20
+)
+
+// BodyLimitMiddleware caps the size of request bodies at the limit limitFor
+// returns for the request. Requests announcing a larger Content-Length are
+// rejected with 413 before the body is read; reading past the limit of a body
+// without one fails with an *http.MaxBytesError, which handlers.BindJSON also
+// turns into a 413.
+//
+// It has to run before anything that reads the body, and limitFor before the
+// route's handlers, so it takes the route from c.FullPath rather than being
+// attached to individual routes.
+func BodyLimitMiddleware(limitFor func(c *gin.Context) int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+
+		limit := limitFor(c)
+		if c.Request.ContentLength > limit {
+			apierror.Abort(c, apierror.New(http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge,
+				fmt.Sprintf("Request body too large. Max size is %d bytes", limit)))
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"envie-backend/internal/apierror"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	chaosLatencyPercentEnv = "CHAOS_LATENCY_PERCENT"
+	chaosMaxLatencyEnv     = "CHAOS_MAX_LATENCY"
+	chaosErrorPercentEnv   = "CHAOS_ERROR_PERCENT"
+
+	ChaosInjectedHeader = "X-Chaos-Injected"
+)
+
+// ChaosConfig injects faults into a share of requests so client retries, caching
+// and offline mode get exercised against a staging instance. Never enable it in
+// production.
+type ChaosConfig struct {
+	LatencyPercent float64       // share of requests delayed by up to MaxLatency
+	MaxLatency     time.Duration // the delay is uniform between 0 and MaxLatency
+	ErrorPercent   float64       // share of requests answered with 503
+}
+
+// Enabled reports whether any fault is injected
+func (cfg ChaosConfig) Enabled() bool {
+	return (cfg.LatencyPercent > 0 && cfg.MaxLatency > 0) || cfg.ErrorPercent > 0
+}
+
+func (cfg ChaosConfig) String() string {
+	return fmt.Sprintf("%g%% of requests delayed up to %s, %g%% failed", cfg.LatencyPercent, cfg.MaxLatency, cfg.ErrorPercent)
+}
+
+// ChaosConfigFromEnv reads CHAOS_LATENCY_PERCENT, CHAOS_MAX_LATENCY (a duration,
+// default 2s) and CHAOS_ERROR_PERCENT. Unset means no faults.
+func ChaosConfigFromEnv() (ChaosConfig, error) {
+	return ChaosConfigFrom(os.Getenv)
+}
+
+// ChaosConfigFrom is ChaosConfigFromEnv reading variables through getenv
+func ChaosConfigFrom(getenv func(string) string) (ChaosConfig, error) {
+	cfg := ChaosConfig{MaxLatency: 2 * time.Second}
+	var err error
+	if cfg.LatencyPercent, err = percentFrom(getenv, chaosLatencyPercentEnv); err != nil {
+		return ChaosConfig{}, err
+	}
+	if cfg.ErrorPercent, err = percentFrom(getenv, chaosErrorPercentEnv); err != nil {
+		return ChaosConfig{}, err
+	}
+	if value := getenv(chaosMaxLatencyEnv); value != "" {
+		if cfg.MaxLatency, err = time.ParseDuration(value); err != nil || cfg.MaxLatency < 0 {
+			return ChaosConfig{}, fmt.Errorf("invalid %s %q", chaosMaxLatencyEnv, value)
+		}
+	}
+	return cfg, nil
+}
+
+func percentFrom(getenv func(string) string, name string) (float64, error) {
+	value := strings.TrimSuffix(getenv(name), "%")
+	if value == "" {
+		return 0, nil
+	}
+	percent, err := strconv.ParseFloat(value, 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return 0, fmt.Errorf("invalid %s %q: want a percentage between 0 and 100", name, value)
+	}
+	return percent, nil
+}
+
+// ChaosMiddleware delays or fails requests at random according to cfg. Failures
+// are 503s with Retry-After, the response clients treat as transient, and every
+// injected fault is marked with X-Chaos-Injected so it can be told apart from a
+// real one. Health checks are left alone so the instance stays in rotation.
+func ChaosMiddleware(cfg ChaosConfig) gin.HandlerFunc {
+	return chaosMiddleware(cfg, rand.Float64, time.Sleep)
+}
+
+// ReloadableChaosMiddleware is ChaosMiddleware with the config looked up on every
+// request, so a settings reload can turn faults on or off
+func ReloadableChaosMiddleware(config func() ChaosConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg := config(); cfg.Enabled() {
+			chaosMiddleware(cfg, rand.Float64, time.Sleep)(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+func chaosMiddleware(cfg ChaosConfig, random func() float64, sleep func(time.Duration)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.URL.Path {
+		case "/ping", "/health":
+			c.Next()
+			return
+		}
+
+		if cfg.MaxLatency > 0 && random()*100 < cfg.LatencyPercent {
+			c.Writer.Header().Add(ChaosInjectedHeader, "latency")
+			sleep(time.Duration(random() * float64(cfg.MaxLatency)))
+		}
+		if random()*100 < cfg.ErrorPercent {
+			c.Writer.Header().Add(ChaosInjectedHeader, "error")
+			c.Header("Retry-After", "1")
+			apierror.Abort(c, apierror.New(http.StatusServiceUnavailable, apierror.CodeUnavailable, "Injected failure (chaos testing)"))
+			return
+		}
+		c.Next()
+	}
+}
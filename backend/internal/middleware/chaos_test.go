@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestChaosConfigFromEnv(t *testing.T) {
+	t.Setenv(chaosLatencyPercentEnv, "25%")
+	t.Setenv(chaosErrorPercentEnv, "5")
+	t.Setenv(chaosMaxLatencyEnv, "500ms")
+
+	cfg, err := ChaosConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg != (ChaosConfig{LatencyPercent: 25, MaxLatency: 500 * time.Millisecond, ErrorPercent: 5}) || !cfg.Enabled() {
+		t.Errorf("config = %+v", cfg)
+	}
+
+	for env, value := range map[string]string{chaosErrorPercentEnv: "150", chaosLatencyPercentEnv: "lots", chaosMaxLatencyEnv: "-1s"} {
+		t.Run(env+"="+value, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := ChaosConfigFromEnv(); err == nil {
+				t.Error("invalid value accepted")
+			}
+		})
+	}
+}
+
+func TestChaosConfigDisabledByDefault(t *testing.T) {
+	cfg, err := ChaosConfigFromEnv()
+	if err != nil || cfg.Enabled() {
+		t.Errorf("config = %+v, %v", cfg, err)
+	}
+}
+
+func TestChaosMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := ChaosConfig{LatencyPercent: 50, MaxLatency: time.Second, ErrorPercent: 50}
+
+	tests := []struct {
+		name    string
+		path    string
+		rolls   []float64
+		status  int
+		delay   time.Duration
+		injects []string
+	}{
+		{"untouched", "/v1/me", []float64{0.9, 0.9}, http.StatusOK, 0, nil},
+		{"delayed", "/v1/me", []float64{0.1, 0.25, 0.9}, http.StatusOK, 250 * time.Millisecond, []string{"latency"}},
+		{"failed", "/v1/me", []float64{0.9, 0.1}, http.StatusServiceUnavailable, 0, []string{"error"}},
+		{"delayed and failed", "/v1/me", []float64{0.1, 0.5, 0.1}, http.StatusServiceUnavailable, 500 * time.Millisecond, []string{"latency", "error"}},
+		{"health check", "/health", []float64{0, 0, 0}, http.StatusOK, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rolls := tt.rolls
+			random := func() float64 {
+				roll := rolls[0]
+				rolls = rolls[1:]
+				return roll
+			}
+			var slept time.Duration
+			sleep := func(d time.Duration) { slept += d }
+
+			r := gin.New()
+			r.Use(chaosMiddleware(cfg, random, sleep))
+			r.GET("/v1/me", func(c *gin.Context) { c.Status(http.StatusOK) })
+			r.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if w.Code != tt.status || slept != tt.delay {
+				t.Errorf("status %d after %s, want %d after %s", w.Code, slept, tt.status, tt.delay)
+			}
+			injected := w.Header().Values(ChaosInjectedHeader)
+			if len(injected) != len(tt.injects) {
+				t.Fatalf("%s = %v, want %v", ChaosInjectedHeader, injected, tt.injects)
+			}
+			for i := range injected {
+				if injected[i] != tt.injects[i] {
+					t.Errorf("%s = %v, want %v", ChaosInjectedHeader, injected, tt.injects)
+				}
+			}
+			if tt.status == http.StatusServiceUnavailable && w.Header().Get("Retry-After") != "1" {
+				t.Error("injected failure has no Retry-After")
+			}
+		})
+	}
+}
@@ -1,12 +1,17 @@
 package middleware
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"time"
 
+	"envie-backend/internal/apierror"
+	"envie-backend/internal/authcache"
 	"envie-backend/internal/crypto"
 	"envie-backend/internal/database"
 	"envie-backend/internal/models"
+	"envie-backend/internal/tokenwatch"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,45 +21,86 @@ const (
 	CLITokenContextKey = "cli_token"
 )
 
-func CLIAuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		identityID := c.GetHeader(CLIIdentityHeader)
-		if identityID == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing X-CLI-Identity header"})
-			c.Abort()
-			return
-		}
+var (
+	ErrMissingCLIIdentity = errors.New("missing X-CLI-Identity header")
+	ErrInvalidCLIIdentity = errors.New("invalid identity ID format")
+	ErrUnknownCLIToken    = errors.New("invalid or unknown token")
+	ErrExpiredCLIToken    = errors.New("token has expired")
+	ErrCLITokenAddress    = errors.New("token can't be used from this address")
+)
 
-		identityIDHash, err := crypto.HashIdentityID(identityID)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid identity ID format"})
-			c.Abort()
-			return
-		}
+// cliAuthErrorCodes are the error codes the CLI authentication errors are
+// reported with
+var cliAuthErrorCodes = map[error]apierror.Code{
+	ErrMissingCLIIdentity: apierror.CodeTokenMissing,
+	ErrInvalidCLIIdentity: apierror.CodeTokenInvalid,
+	ErrUnknownCLIToken:    apierror.CodeTokenInvalid,
+	ErrExpiredCLIToken:    apierror.CodeTokenExpired,
+	ErrCLITokenAddress:    apierror.CodeTokenAddressDenied,
+}
+
+// AuthenticateCLIIdentity resolves a CLI identity ID to its project token.
+// It is shared by the REST middleware and the gRPC service.
+func AuthenticateCLIIdentity(identityID string) (*models.ProjectToken, error) {
+	if identityID == "" {
+		return nil, ErrMissingCLIIdentity
+	}
 
+	identityIDHash, err := crypto.HashIdentityID(identityID)
+	if err != nil {
+		return nil, ErrInvalidCLIIdentity
+	}
+
+	token, err := authcache.Lookup("cli_token:"+identityIDHash, func() (models.ProjectToken, error) {
 		var token models.ProjectToken
-		if err := database.DB.Where("identity_id_hash = ?", identityIDHash).First(&token).Error; err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or unknown token"})
-			c.Abort()
+		err := database.DB.Where("identity_id_hash = ?", identityIDHash).First(&token).Error
+		return token, err
+	})
+	if err != nil {
+		return nil, ErrUnknownCLIToken
+	}
+
+	if token.IsExpired() {
+		return nil, ErrExpiredCLIToken
+	}
+
+	go func() {
+		now := time.Now()
+		authcache.SkipInvalidation(database.DB).Model(&token).Update("last_used_at", now)
+	}()
+
+	return &token, nil
+}
+
+func CLIAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, err := AuthenticateCLIIdentity(c.GetHeader(CLIIdentityHeader))
+		if err != nil {
+			apierror.Abort(c, apierror.New(http.StatusUnauthorized, cliAuthErrorCodes[err], err.Error()))
 			return
 		}
-
-		if token.IsExpired() {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has expired"})
-			c.Abort()
+		if err := CheckCLITokenAddress(token, ClientIP(c)); err != nil {
+			apierror.Abort(c, apierror.New(http.StatusForbidden, cliAuthErrorCodes[err], err.Error()))
 			return
 		}
+		tokenwatch.ObserveInBackground(token, ClientIP(c))
 
-		go func() {
-			now := time.Now()
-			database.DB.Model(&token).Update("last_used_at", now)
-		}()
-
-		c.Set(CLITokenContextKey, &token)
+		c.Set(CLITokenContextKey, token)
 		c.Next()
 	}
 }
 
+// CheckCLITokenAddress rejects a token used from outside its allowed ranges. ip
+// is the client address after trusted proxies (see ClientIPResolver). Every
+// rejection is logged, so a leaked token being tried elsewhere can be alerted on.
+func CheckCLITokenAddress(token *models.ProjectToken, ip string) error {
+	if token.AllowsAddress(ip) {
+		return nil
+	}
+	log.Printf("CLI token %s of project %s rejected from %s: outside its allowed ranges", token.ID, token.ProjectID, ip)
+	return ErrCLITokenAddress
+}
+
 func GetCLIToken(c *gin.Context) *models.ProjectToken {
 	token, exists := c.Get(CLITokenContextKey)
 	if !exists {
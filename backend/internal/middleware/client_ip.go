@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	clientIPKey        = "client_ip"
+	forwardedForHeader = "X-Forwarded-For"
+	trustedProxiesEnv  = "TRUSTED_PROXIES"
+	clientIPHeaderEnv  = "CLIENT_IP_HEADER"
+)
+
+// ClientIPResolver determines the address of the client behind reverse proxies.
+// Forwarding headers are only believed when the connection comes from a trusted
+// proxy; otherwise any client could set them and pose as another address.
+type ClientIPResolver struct {
+	trusted []netip.Prefix
+	header  string // single address header set by the platform's edge, e.g. Fly-Client-IP
+}
+
+// NewClientIPResolver trusts the given proxy addresses or CIDR ranges. When header
+// is set, a trusted proxy's value for it wins over X-Forwarded-For.
+func NewClientIPResolver(trustedProxies []string, header string) (*ClientIPResolver, error) {
+	r := &ClientIPResolver{header: header}
+	for _, proxy := range trustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			r.trusted = append(r.trusted, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy range %q: %w", proxy, err)
+		}
+		r.trusted = append(r.trusted, prefix.Masked())
+	}
+	return r, nil
+}
+
+// ClientIPResolverFromEnv reads TRUSTED_PROXIES (comma separated addresses and CIDR
+// ranges) and CLIENT_IP_HEADER. Without TRUSTED_PROXIES no header is believed and
+// the connection's address is used.
+func ClientIPResolverFromEnv() (*ClientIPResolver, error) {
+	var proxies []string
+	if value := os.Getenv(trustedProxiesEnv); value != "" {
+		proxies = strings.Split(value, ",")
+	}
+	return NewClientIPResolver(proxies, os.Getenv(clientIPHeaderEnv))
+}
+
+// Resolve returns the client address for a connection from remoteAddr. values
+// returns every value of a request header or metadata key.
+func (r *ClientIPResolver) Resolve(remoteAddr string, values func(name string) []string) string {
+	remote, ok := parseIP(remoteAddr)
+	if !ok {
+		host, _, err := net.SplitHostPort(remoteAddr)
+		if err != nil {
+			return remoteAddr
+		}
+		if remote, ok = parseIP(host); !ok {
+			return host
+		}
+	}
+	if !r.isTrusted(remote) {
+		return remote.String()
+	}
+
+	if r.header != "" {
+		for _, value := range values(r.header) {
+			if ip, ok := parseIP(value); ok {
+				return ip.String()
+			}
+		}
+	}
+
+	// Walk X-Forwarded-For from the nearest hop; the first address that isn't one of
+	// our proxies is the client. Anything further left was supplied by the client.
+	var hops []string
+	for _, value := range values(forwardedForHeader) {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip, ok := parseIP(hops[i])
+		if !ok {
+			break
+		}
+		client = ip
+		if !r.isTrusted(ip) {
+			break
+		}
+	}
+	return client.String()
+}
+
+func (r *ClientIPResolver) isTrusted(ip netip.Addr) bool {
+	for _, prefix := range r.trusted {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseIP(value string) (netip.Addr, bool) {
+	ip, err := netip.ParseAddr(strings.TrimSpace(value))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
+
+// ClientIPMiddleware resolves the client address once per request for ClientIP
+func ClientIPMiddleware(resolver *ClientIPResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(clientIPKey, resolver.Resolve(c.Request.RemoteAddr, c.Request.Header.Values))
+		c.Next()
+	}
+}
+
+// ClientIP returns the address resolved by ClientIPMiddleware. Use it instead of
+// gin's c.ClientIP, which is configured to ignore forwarding headers.
+func ClientIP(c *gin.Context) string {
+	if ip := c.GetString(clientIPKey); ip != "" {
+		return ip
+	}
+	return c.RemoteIP()
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	resolver, err := NewClientIPResolver([]string{"10.0.0.0/8", " 192.0.2.1", "fdaa::/16"}, "Fly-Client-IP")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string][]string
+		want    string
+	}{
+		{"direct connection", "203.0.113.7:4711", nil, "203.0.113.7"},
+		{"untrusted peer sends X-Forwarded-For", "203.0.113.7:4711", map[string][]string{"X-Forwarded-For": {"198.51.100.1"}}, "203.0.113.7"},
+		{"untrusted peer sends platform header", "203.0.113.7:4711", map[string][]string{"Fly-Client-IP": {"198.51.100.1"}}, "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:80", map[string][]string{"X-Forwarded-For": {"198.51.100.1"}}, "198.51.100.1"},
+		{"spoofed hop left of the client", "10.1.2.3:80", map[string][]string{"X-Forwarded-For": {"1.1.1.1, 198.51.100.1, 10.9.9.9"}}, "198.51.100.1"},
+		{"multiple header lines", "10.1.2.3:80", map[string][]string{"X-Forwarded-For": {"1.1.1.1", "198.51.100.1"}}, "198.51.100.1"},
+		{"only proxies", "10.1.2.3:80", map[string][]string{"X-Forwarded-For": {"10.0.0.5, 192.0.2.1"}}, "10.0.0.5"},
+		{"invalid hop", "10.1.2.3:80", map[string][]string{"X-Forwarded-For": {"198.51.100.1, garbage"}}, "10.1.2.3"},
+		{"platform header wins", "[fdaa::3]:443", map[string][]string{"Fly-Client-IP": {"2001:db8::1"}, "X-Forwarded-For": {"198.51.100.1"}}, "2001:db8::1"},
+		{"invalid platform header", "192.0.2.1:443", map[string][]string{"Fly-Client-IP": {"nope"}, "X-Forwarded-For": {"198.51.100.1"}}, "198.51.100.1"},
+		{"IPv4-mapped peer", "[::ffff:10.1.2.3]:80", map[string][]string{"X-Forwarded-For": {"198.51.100.1"}}, "198.51.100.1"},
+		{"address without port", "203.0.113.7", nil, "203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for name, values := range tt.headers {
+				for _, v := range values {
+					header.Add(name, v)
+				}
+			}
+			if got := resolver.Resolve(tt.remote, header.Values); got != tt.want {
+				t.Errorf("Resolve = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPResolverWithoutTrustedProxies(t *testing.T) {
+	resolver, err := NewClientIPResolver(nil, "Fly-Client-IP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{"X-Forwarded-For": {"198.51.100.1"}, "Fly-Client-IP": {"198.51.100.2"}}
+	if got := resolver.Resolve("10.1.2.3:80", header.Values); got != "10.1.2.3" {
+		t.Errorf("Resolve = %s, want the peer address", got)
+	}
+}
+
+func TestNewClientIPResolverRejectsInvalidProxies(t *testing.T) {
+	for _, proxy := range []string{"not-an-ip", "10.0.0.0/33"} {
+		if _, err := NewClientIPResolver([]string{proxy}, ""); err == nil {
+			t.Errorf("%q: expected an error", proxy)
+		}
+	}
+}
+
+func TestClientIPMiddleware(t *testing.T) {
+	resolver, _ := NewClientIPResolver([]string{"10.0.0.0/8"}, "")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ClientIPMiddleware(resolver))
+	r.GET("/ip", func(c *gin.Context) { c.String(http.StatusOK, ClientIP(c)) })
+
+	req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+	req.RemoteAddr = "10.1.2.3:80"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Body.String() != "198.51.100.1" {
+		t.Errorf("ClientIP = %s, want 198.51.100.1", w.Body.String())
+	}
+}
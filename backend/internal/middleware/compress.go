@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// minCompressSize is the smallest first write worth compressing; below it the
+	// encoding overhead outweighs the savings. Handlers write a JSON response in
+	// one go, and streamed ones through a buffer, so the first write tells.
+	minCompressSize = 1024
+
+	// brotliLevel trades ratio for speed, responses are compressed per request
+	brotliLevel = 4
+)
+
+var (
+	gzipWriters   = sync.Pool{New: func() any { w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression); return w }}
+	brotliWriters = sync.Pool{New: func() any { return brotli.NewWriterLevel(nil, brotliLevel) }}
+)
+
+// CompressionMiddleware compresses the JSON responses of GET requests with br or
+// gzip, whichever the client prefers in Accept-Encoding, br on a tie.
+//
+// Only reads are compressed: a response that mixes a secret with input from the
+// request could leak the secret through its compressed size (BREACH), and reads
+// carry ciphertext and metadata rather than tokens. It has to wrap the writer
+// before the middleware that record responses, so they see them uncompressed.
+func CompressionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet {
+			c.Next()
+			return
+		}
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" {
+			c.Next()
+			return
+		}
+
+		w := &compressWriter{ResponseWriter: c.Writer, encoding: encoding}
+		c.Writer = w
+		defer w.close()
+		c.Next()
+	}
+}
+
+// negotiateEncoding picks br or gzip from an Accept-Encoding header, or "" when
+// the client accepts neither
+func negotiateEncoding(header string) string {
+	quality := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		quality[strings.ToLower(strings.TrimSpace(name))] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range []string{"br", "gzip"} {
+		q, ok := quality[encoding]
+		if !ok {
+			q, ok = quality["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compressWriter decides on the first write whether to compress: JSON of at
+// least minCompressSize without an encoding of its own
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	decided  bool
+	encoder  io.WriteCloser
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.decide(len(data))
+	}
+	if w.encoder == nil {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.encoder.Write(data)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *compressWriter) decide(size int) {
+	w.decided = true
+	h := w.Header()
+	status := w.Status()
+	if size < minCompressSize || h.Get("Content-Encoding") != "" ||
+		!strings.HasPrefix(h.Get("Content-Type"), "application/json") ||
+		status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return
+	}
+
+	h.Set("Content-Encoding", w.encoding)
+	h.Del("Content-Length")
+	switch w.encoding {
+	case "br":
+		encoder := brotliWriters.Get().(*brotli.Writer)
+		encoder.Reset(w.ResponseWriter)
+		w.encoder = encoder
+	case "gzip":
+		encoder := gzipWriters.Get().(*gzip.Writer)
+		encoder.Reset(w.ResponseWriter)
+		w.encoder = encoder
+	}
+}
+
+// Flush sends what was compressed so far, for streamed responses
+func (w *compressWriter) Flush() {
+	switch encoder := w.encoder.(type) {
+	case *brotli.Writer:
+		encoder.Flush()
+	case *gzip.Writer:
+		encoder.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) close() {
+	if w.encoder == nil {
+		return
+	}
+	w.encoder.Close()
+	switch encoder := w.encoder.(type) {
+	case *brotli.Writer:
+		brotliWriters.Put(encoder)
+	case *gzip.Writer:
+		gzipWriters.Put(encoder)
+	}
+	w.encoder = nil
+}
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                           "",
+		"identity":                   "",
+		"gzip":                       "gzip",
+		"gzip, deflate, br":          "br",
+		"br;q=0.5, gzip":             "gzip",
+		"GZIP;q=0.8":                 "gzip",
+		"*":                          "br",
+		"br;q=0, *;q=0.3":            "gzip",
+		"gzip;q=invalid, br;q=0":     "",
+		"deflate, gzip;q=1.0, *;q=0": "gzip",
+	}
+	for header, want := range tests {
+		if got := negotiateEncoding(header); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+// largeJSON is a response body well above minCompressSize
+func largeJSON(items int) []map[string]string {
+	body := make([]map[string]string, items)
+	for i := range body {
+		body[i] = map[string]string{"name": fmt.Sprintf("SERVICE_%d_URL", i), "value": "AQIDBAUGBwgJCgsMDQ4PEBESExQVFhcYGRobHB0eHyAh"}
+	}
+	return body
+}
+
+func compressRouter(body any) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(CompressionMiddleware())
+	r.GET("/config", func(c *gin.Context) { c.JSON(http.StatusOK, body) })
+	r.POST("/config", func(c *gin.Context) { c.JSON(http.StatusOK, body) })
+	return r
+}
+
+func compressRequest(r http.Handler, method, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/config", nil)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	body := largeJSON(100)
+	want, _ := json.Marshal(body)
+	r := compressRouter(body)
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"br":   func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+	}
+	for encoding, decode := range decoders {
+		w := compressRequest(r, http.MethodGet, encoding)
+		if got := w.Header().Get("Content-Encoding"); got != encoding {
+			t.Fatalf("Content-Encoding = %q, want %q", got, encoding)
+		}
+		if w.Body.Len() >= len(want) {
+			t.Errorf("%s response is %d bytes, uncompressed %d", encoding, w.Body.Len(), len(want))
+		}
+		reader, err := decode(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := io.ReadAll(reader)
+		if err != nil || !bytes.Equal(decoded, want) {
+			t.Errorf("%s round trip = %q, %v", encoding, decoded, err)
+		}
+		if !strings.Contains(w.Header().Get("Vary"), "Accept-Encoding") {
+			t.Errorf("Vary = %q", w.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestCompressionMiddlewareSkips(t *testing.T) {
+	large := compressRouter(largeJSON(100))
+	small := compressRouter(largeJSON(1))
+
+	tests := map[string]*httptest.ResponseRecorder{
+		"small response":       compressRequest(small, http.MethodGet, "gzip"),
+		"write request":        compressRequest(large, http.MethodPost, "gzip"),
+		"no accepted encoding": compressRequest(large, http.MethodGet, "identity"),
+	}
+	for name, w := range tests {
+		if got := w.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("%s: Content-Encoding = %q", name, got)
+		}
+		var decoded []map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &decoded); err != nil {
+			t.Errorf("%s: body is not plain JSON: %v", name, err)
+		}
+	}
+}
+
+func benchmarkCompression(b *testing.B, encoding string) {
+	r := compressRouter(largeJSON(5000))
+	b.ReportAllocs()
+	b.ResetTimer()
+	size := 0
+	for i := 0; i < b.N; i++ {
+		w := compressRequest(r, http.MethodGet, encoding)
+		size = w.Body.Len()
+	}
+	b.ReportMetric(float64(size), "bytes/response")
+}
+
+func BenchmarkCompressionNone(b *testing.B)   { benchmarkCompression(b, "identity") }
+func BenchmarkCompressionGzip(b *testing.B)   { benchmarkCompression(b, "gzip") }
+func BenchmarkCompressionBrotli(b *testing.B) { benchmarkCompression(b, "br") }
@@ -0,0 +1,242 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"envie-backend/internal/apierror"
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// IdempotencyStore persists idempotency records. The default implementation uses
+// database.DB; tests substitute an in-memory store.
+type IdempotencyStore interface {
+	// Find returns the unexpired record for a user's key, or nil if there is none
+	Find(userID uuid.UUID, key string, now time.Time) (*models.IdempotencyKey, error)
+	// Create inserts a new in-flight record and fails if the key already exists
+	Create(record *models.IdempotencyKey) error
+	// Complete stores the response of the original request
+	Complete(record *models.IdempotencyKey, statusCode int, contentType, body string) error
+	// Delete removes a record so the key can be retried
+	Delete(record *models.IdempotencyKey) error
+	// PurgeExpired removes every record that expired before now
+	PurgeExpired(now time.Time) (int64, error)
+}
+
+type gormIdempotencyStore struct{}
+
+func (gormIdempotencyStore) Find(userID uuid.UUID, key string, now time.Time) (*models.IdempotencyKey, error) {
+	// An expired record would still hold the unique index, so drop it first
+	database.DB.Where("user_id = ? AND key = ? AND expires_at <= ?", userID, key, now).Delete(&models.IdempotencyKey{})
+
+	var existing models.IdempotencyKey
+	result := database.DB.Where("user_id = ? AND key = ?", userID, key).Limit(1).Find(&existing)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &existing, nil
+}
+
+func (gormIdempotencyStore) Create(record *models.IdempotencyKey) error {
+	return database.DB.Create(record).Error
+}
+
+func (gormIdempotencyStore) Complete(record *models.IdempotencyKey, statusCode int, contentType, body string) error {
+	return database.DB.Model(record).Updates(map[string]any{
+		"status_code":   statusCode,
+		"content_type":  contentType,
+		"response_body": body,
+	}).Error
+}
+
+func (gormIdempotencyStore) Delete(record *models.IdempotencyKey) error {
+	return database.DB.Delete(record).Error
+}
+
+func (gormIdempotencyStore) PurgeExpired(now time.Time) (int64, error) {
+	result := database.DB.Where("expires_at <= ?", now).Delete(&models.IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
+
+// StartIdempotencyKeyPurge deletes expired idempotency records every interval.
+// Keys are also dropped individually when reused, but keys that are never
+// retried would otherwise stay in the table forever.
+func StartIdempotencyKeyPurge(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := (gormIdempotencyStore{}).PurgeExpired(time.Now()); err != nil {
+				log.Printf("Failed to purge expired idempotency keys: %v", err)
+			} else if n > 0 {
+				log.Printf("Purged %d expired idempotency keys", n)
+			}
+		}
+	}()
+}
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotent-Replayed"
+
+	idempotencyKeyTTL       = 24 * time.Hour
+	idempotencyKeyMaxLength = 255
+
+	idempotencySkipKey = "idempotency_skip"
+)
+
+var errIdempotencyKeyInProgress = apierror.New(http.StatusConflict, apierror.CodeIdempotencyKeyInProgress, "A request with this idempotency key is still in progress")
+
+// SkipIdempotencyRecord keeps the current response out of the idempotency store,
+// for rejections the client fixes with headers the request hash doesn't cover
+// (e.g. a missing 2FA code), so a retry with the same key runs the handler again
+func SkipIdempotencyRecord(c *gin.Context) {
+	c.Set(idempotencySkipKey, true)
+}
+
+type idempotencyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware makes mutating requests safe to retry. When a request carries
+// an Idempotency-Key header, the first response is stored per user (or CLI token)
+// and replayed for any retry with the same key. Reusing a key for a different
+// request is rejected. Must run after AuthMiddleware or CLIAuthMiddleware.
+func IdempotencyMiddleware() gin.HandlerFunc {
+	return idempotencyMiddleware(gormIdempotencyStore{}, time.Now)
+}
+
+func idempotencyMiddleware(store IdempotencyStore, now func() time.Time) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || !isMutatingMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+
+		if len(key) > idempotencyKeyMaxLength {
+			apierror.Abort(c, apierror.New(http.StatusBadRequest, apierror.CodeBadRequest, "Idempotency key is too long"))
+			return
+		}
+
+		uid, ok := idempotencyOwner(c)
+		if !ok {
+			apierror.Abort(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized"))
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apierror.Abort(c, apierror.New(http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge,
+				fmt.Sprintf("Request body too large. Max size is %d bytes", tooLarge.Limit)))
+			return
+		}
+		if err != nil {
+			apierror.Abort(c, apierror.New(http.StatusBadRequest, apierror.CodeBadRequest, "Failed to read request body"))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n"))
+		hash.Write(body)
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+
+		requestTime := now()
+		existing, err := store.Find(uid, key, requestTime)
+		if err != nil {
+			apierror.Abort(c, apierror.New(http.StatusInternalServerError, apierror.CodeInternal, "Failed to look up idempotency key"))
+			return
+		}
+		if existing != nil {
+			if existing.RequestHash != requestHash {
+				apierror.Abort(c, apierror.New(http.StatusUnprocessableEntity, apierror.CodeIdempotencyKeyReused, "Idempotency key was already used for a different request"))
+				return
+			}
+			if !existing.IsCompleted() {
+				apierror.Abort(c, errIdempotencyKeyInProgress)
+				return
+			}
+
+			contentType := existing.ContentType
+			if contentType == "" {
+				// Stored before the content type was
+				contentType = "application/json; charset=utf-8"
+			}
+			c.Header(IdempotencyReplayedHeader, "true")
+			c.Data(existing.StatusCode, contentType, []byte(existing.ResponseBody))
+			c.Abort()
+			return
+		}
+
+		record := models.IdempotencyKey{
+			UserID:      uid,
+			Key:         key,
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.Path,
+			RequestHash: requestHash,
+			ExpiresAt:   requestTime.Add(idempotencyKeyTTL),
+		}
+		if err := store.Create(&record); err != nil {
+			// Lost the race against a concurrent request with the same key
+			apierror.Abort(c, errIdempotencyKeyInProgress)
+			return
+		}
+
+		recorder := &idempotencyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		c.Next()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError || c.GetBool(idempotencySkipKey) {
+			// Server errors are not cached so the client can retry with the same key
+			store.Delete(&record)
+			return
+		}
+
+		store.Complete(&record, status, recorder.Header().Get("Content-Type"), recorder.body.String())
+	}
+}
+
+// idempotencyOwner returns whose keys the request's key is looked up among: the
+// signed-in user or the CLI token
+func idempotencyOwner(c *gin.Context) (uuid.UUID, bool) {
+	if userID, ok := c.Get("user_id"); ok {
+		return userID.(uuid.UUID), true
+	}
+	if token, ok := c.Get(CLITokenContextKey); ok {
+		return token.(*models.ProjectToken).ID, true
+	}
+	return uuid.Nil, false
+}
+
+func isMutatingMethod(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch || method == http.MethodDelete
+}
@@ -0,0 +1,264 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// memoryIdempotencyStore is an in-memory IdempotencyStore keyed by user and key
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*models.IdempotencyKey
+}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{records: map[string]*models.IdempotencyKey{}}
+}
+
+func storeKey(userID uuid.UUID, key string) string {
+	return userID.String() + "/" + key
+}
+
+func (s *memoryIdempotencyStore) Find(userID uuid.UUID, key string, now time.Time) (*models.IdempotencyKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[storeKey(userID, key)]
+	if !ok {
+		return nil, nil
+	}
+	if !record.ExpiresAt.After(now) {
+		delete(s.records, storeKey(userID, key))
+		return nil, nil
+	}
+	copied := *record
+	return &copied, nil
+}
+
+func (s *memoryIdempotencyStore) Create(record *models.IdempotencyKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := storeKey(record.UserID, record.Key)
+	if _, exists := s.records[k]; exists {
+		return errors.New("duplicate key")
+	}
+	copied := *record
+	s.records[k] = &copied
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Complete(record *models.IdempotencyKey, statusCode int, contentType, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := s.records[storeKey(record.UserID, record.Key)]
+	stored.StatusCode = statusCode
+	stored.ContentType = contentType
+	stored.ResponseBody = body
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Delete(record *models.IdempotencyKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, storeKey(record.UserID, record.Key))
+	return nil
+}
+
+func (s *memoryIdempotencyStore) PurgeExpired(now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for k, record := range s.records {
+		if !record.ExpiresAt.After(now) {
+			delete(s.records, k)
+			n++
+		}
+	}
+	return n, nil
+}
+
+type idempotencyTest struct {
+	router *gin.Engine
+	store  *memoryIdempotencyStore
+	now    time.Time
+	calls  int
+	status int
+	skip   bool
+}
+
+func newIdempotencyTest() *idempotencyTest {
+	gin.SetMode(gin.TestMode)
+	it := &idempotencyTest{store: newMemoryIdempotencyStore(), now: time.Now(), status: http.StatusCreated}
+	userID := uuid.New()
+
+	it.router = gin.New()
+	it.router.Use(func(c *gin.Context) { c.Set("user_id", userID) })
+	it.router.Use(idempotencyMiddleware(it.store, func() time.Time { return it.now }))
+	it.router.POST("/things", func(c *gin.Context) {
+		it.calls++
+		if it.skip {
+			SkipIdempotencyRecord(c)
+		}
+		c.JSON(it.status, gin.H{"call": it.calls})
+	})
+	return it
+}
+
+func (it *idempotencyTest) post(key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/things", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	it.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyReplaysCompletedRequest(t *testing.T) {
+	it := newIdempotencyTest()
+
+	first := it.post("key-1", `{"name":"a"}`)
+	second := it.post("key-1", `{"name":"a"}`)
+
+	if it.calls != 1 {
+		t.Fatalf("handler ran %d times, want 1", it.calls)
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+		t.Errorf("replay = %d %s, want %d %s", second.Code, second.Body, first.Code, first.Body)
+	}
+	if second.Header().Get(IdempotencyReplayedHeader) != "true" {
+		t.Error("replayed response is missing the Idempotent-Replayed header")
+	}
+	if first.Header().Get(IdempotencyReplayedHeader) != "" {
+		t.Error("original response must not be marked as replayed")
+	}
+}
+
+func TestIdempotencyRejectsDifferentBodyForSameKey(t *testing.T) {
+	it := newIdempotencyTest()
+
+	it.post("key-1", `{"name":"a"}`)
+	w := it.post("key-1", `{"name":"b"}`)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want 422", w.Code)
+	}
+	if it.calls != 1 {
+		t.Errorf("handler ran %d times, want 1", it.calls)
+	}
+}
+
+func TestIdempotencyKeyExpires(t *testing.T) {
+	it := newIdempotencyTest()
+
+	it.post("key-1", `{}`)
+	it.now = it.now.Add(idempotencyKeyTTL + time.Second)
+	w := it.post("key-1", `{}`)
+
+	if it.calls != 2 {
+		t.Fatalf("handler ran %d times after expiry, want 2", it.calls)
+	}
+	if w.Header().Get(IdempotencyReplayedHeader) != "" {
+		t.Error("request after expiry must not be replayed")
+	}
+}
+
+func TestIdempotencyDoesNotCacheServerErrors(t *testing.T) {
+	it := newIdempotencyTest()
+	it.status = http.StatusInternalServerError
+
+	it.post("key-1", `{}`)
+	it.status = http.StatusCreated
+	w := it.post("key-1", `{}`)
+
+	if it.calls != 2 || w.Code != http.StatusCreated {
+		t.Errorf("retry after server error: calls=%d status=%d", it.calls, w.Code)
+	}
+}
+
+func TestIdempotencySkippedRecord(t *testing.T) {
+	it := newIdempotencyTest()
+	it.status = http.StatusForbidden
+	it.skip = true
+
+	it.post("key-1", `{}`)
+	it.status = http.StatusCreated
+	it.skip = false
+	w := it.post("key-1", `{}`)
+
+	if it.calls != 2 || w.Code != http.StatusCreated {
+		t.Errorf("retry after skipped record: calls=%d status=%d", it.calls, w.Code)
+	}
+}
+
+func TestIdempotencyWithoutKeyAlwaysRuns(t *testing.T) {
+	it := newIdempotencyTest()
+
+	it.post("", `{}`)
+	it.post("", `{}`)
+
+	if it.calls != 2 {
+		t.Errorf("handler ran %d times, want 2", it.calls)
+	}
+}
+
+func TestIdempotencyPurgeExpired(t *testing.T) {
+	it := newIdempotencyTest()
+	it.post("old", `{}`)
+	it.now = it.now.Add(idempotencyKeyTTL + time.Second)
+	it.post("new", `{}`)
+
+	n, _ := it.store.PurgeExpired(it.now)
+	if n != 1 || len(it.store.records) != 1 {
+		t.Errorf("purged %d, %d left; want 1 purged, 1 left", n, len(it.store.records))
+	}
+}
+
+func TestIdempotencyScopedToCLIToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := newMemoryIdempotencyStore()
+	calls := 0
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(CLITokenContextKey, &models.ProjectToken{ID: uuid.MustParse(c.GetHeader("X-Token"))})
+	})
+	router.Use(idempotencyMiddleware(store, time.Now))
+	router.POST("/syncs", func(c *gin.Context) {
+		calls++
+		c.String(http.StatusCreated, "sync %d", calls)
+	})
+
+	post := func(token uuid.UUID) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/syncs", strings.NewReader(`{}`))
+		req.Header.Set(IdempotencyKeyHeader, "deploy-42")
+		req.Header.Set("X-Token", token.String())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	token, other := uuid.New(), uuid.New()
+	post(token)
+	replay := post(token)
+	if calls != 1 || replay.Body.String() != "sync 1" {
+		t.Fatalf("retry with the same token: calls=%d body=%q", calls, replay.Body)
+	}
+	if got := replay.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain") {
+		t.Errorf("replayed content type = %q, want the original's", got)
+	}
+
+	post(other)
+	if calls != 2 {
+		t.Errorf("another token's key was replayed: calls=%d", calls)
+	}
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"envie-backend/internal/redact"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	logPayloadsEnv = "LOG_PAYLOADS"
+
+	// payloadLogLimit caps how much of each body is logged
+	payloadLogLimit = 4096
+)
+
+// PayloadLoggingEnabled reports whether LOG_PAYLOADS=true asks for request and
+// response bodies to be logged, for debugging clients
+func PayloadLoggingEnabled() bool {
+	return PayloadLoggingEnabledFrom(os.Getenv)
+}
+
+// PayloadLoggingEnabledFrom is PayloadLoggingEnabled reading LOG_PAYLOADS
+// through getenv
+func PayloadLoggingEnabledFrom(getenv func(string) string) bool {
+	return getenv(logPayloadsEnv) == "true"
+}
+
+type payloadRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *payloadRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *payloadRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// PayloadLogMiddleware logs the JSON request and response bodies of every request
+// to logger, with ciphertext, tokens and secret values redacted
+func PayloadLogMiddleware(logger *log.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request []byte
+		if c.Request.Body != nil {
+			body, err := io.ReadAll(c.Request.Body)
+			if err == nil {
+				request = body
+			}
+			// A failed read, such as a body over its limit, fails the handler's read too
+			c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+		}
+
+		recorder := &payloadRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		logger.Printf("%s %s %d request=%s response=%s",
+			c.Request.Method, redact.URL(c.Request.URL.RequestURI()), c.Writer.Status(),
+			loggablePayload(c.ContentType(), request), loggablePayload(recorder.Header().Get("Content-Type"), recorder.body.Bytes()))
+	}
+}
+
+// ReloadablePayloadLogMiddleware is PayloadLogMiddleware while enabled reports
+// true, checked on every request so a settings reload can turn it on or off
+func ReloadablePayloadLogMiddleware(logger *log.Logger, enabled func() bool) gin.HandlerFunc {
+	logPayloads := PayloadLogMiddleware(logger)
+	return func(c *gin.Context) {
+		if enabled() {
+			logPayloads(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// loggablePayload redacts a JSON body; other bodies (files, HTML pages) are only
+// described by their size
+func loggablePayload(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return "-"
+	}
+	if !strings.HasPrefix(contentType, "application/json") {
+		return "<" + contentType + ", " + strconv.Itoa(len(body)) + " bytes>"
+	}
+	redacted := redact.JSON(body)
+	if len(redacted) > payloadLogLimit {
+		return string(redacted[:payloadLogLimit]) + "...(truncated)"
+	}
+	return string(redacted)
+}
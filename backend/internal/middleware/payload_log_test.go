@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPayloadLogMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var out bytes.Buffer
+	r := gin.New()
+	r.Use(PayloadLogMiddleware(log.New(&out, "", 0)))
+	r.POST("/v1/projects/:id/config", func(c *gin.Context) {
+		var body map[string]any
+		if err := c.ShouldBindJSON(&body); err != nil || body["value"] != "plaintext-secret" {
+			t.Errorf("handler got %v (%v)", body, err)
+		}
+		c.JSON(http.StatusOK, gin.H{"key": "DB_URL", "encryptedValue": "Y2lwaGVydGV4dA=="})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/projects/1/config?token=envie_abc",
+		strings.NewReader(`{"key": "DB_URL", "value": "plaintext-secret"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if !strings.Contains(w.Body.String(), "Y2lwaGVydGV4dA==") {
+		t.Errorf("response body was altered: %s", w.Body.String())
+	}
+
+	logged := out.String()
+	for _, secret := range []string{"plaintext-secret", "Y2lwaGVydGV4dA==", "envie_abc"} {
+		if strings.Contains(logged, secret) {
+			t.Errorf("log contains %q: %s", secret, logged)
+		}
+	}
+	if !strings.Contains(logged, `"key":"DB_URL"`) || !strings.Contains(logged, " 200 ") {
+		t.Errorf("log is missing the request details: %s", logged)
+	}
+}
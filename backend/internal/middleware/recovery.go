@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"envie-backend/internal/apierror"
+	"envie-backend/internal/errorreport"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RecoveryMiddleware replaces gin's recovery: a panic is logged, reported and
+// answered with a plain 500, and every other 5xx response is reported with the
+// errors handlers attached to the context. reporter may be nil when reporting
+// isn't configured.
+func RecoveryMiddleware(reporter *errorreport.Reporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			value := recover()
+			if value == nil {
+				return
+			}
+			if err, ok := value.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(value)
+			}
+
+			stack := make([]uintptr, 64)
+			stack = stack[:runtime.Callers(3, stack)]
+			log.Printf("Panic serving %s %s: %v\n%s", c.Request.Method, c.FullPath(), value, debug.Stack())
+			reporter.CapturePanic(value, stack, reportedRequest(c, http.StatusInternalServerError))
+
+			if !c.Writer.Written() {
+				c.JSON(http.StatusInternalServerError, apierror.Body{Error: "Internal server error", Code: apierror.CodeInternal})
+			}
+			c.Abort()
+		}()
+
+		c.Next()
+
+		if status := c.Writer.Status(); status >= http.StatusInternalServerError {
+			err := c.Errors.Last()
+			if err == nil {
+				reporter.CaptureError(fmt.Errorf("%d %s", status, http.StatusText(status)), reportedRequest(c, status))
+				return
+			}
+			reporter.CaptureError(err.Err, reportedRequest(c, status))
+		}
+	}
+}
+
+// reportedRequest describes c by its route pattern, so IDs in the path and the
+// query string never reach the report, and by who made it: the user or CLI
+// token, never their credentials
+func reportedRequest(c *gin.Context, status int) *errorreport.Request {
+	route := c.FullPath()
+	if route == "" {
+		route = "(unmatched)"
+	}
+	req := &errorreport.Request{Method: c.Request.Method, Route: route, Status: status}
+	if userID, ok := c.Get("user_id"); ok {
+		req.UserID = fmt.Sprint(userID)
+	}
+	if token := GetCLIToken(c); token != nil {
+		req.TokenID = token.ID.String()
+	}
+	if span := trace.SpanContextFromContext(c.Request.Context()); span.IsValid() {
+		req.TraceID, req.SpanID = span.TraceID().String(), span.SpanID().String()
+	}
+	return req
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"envie-backend/internal/errorreport"
+	"envie-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRecoveryMiddleware(t *testing.T) {
+	var mu sync.Mutex
+	var events []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var event map[string]any
+		json.Unmarshal(body, &event)
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	reporter, err := errorreport.New(strings.Replace(server.URL, "://", "://key@", 1)+"/1", errorreport.Options{Release: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokenID := uuid.New()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RecoveryMiddleware(reporter))
+	r.GET("/v1/projects/:id", func(c *gin.Context) { panic("nil map") })
+	r.GET("/v1/teams/:id", func(c *gin.Context) {
+		c.Set("user_id", "7d2f")
+		c.Set(CLITokenContextKey, &models.ProjectToken{ID: tokenID})
+		c.Error(errors.New("Failed to fetch team"))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch team"})
+	})
+	r.GET("/v1/me", func(c *gin.Context) { c.Status(http.StatusNotFound) })
+
+	for path, status := range map[string]int{
+		"/v1/projects/5f1c?token=secret": http.StatusInternalServerError,
+		"/v1/teams/7":                    http.StatusInternalServerError,
+		"/v1/me":                         http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer envie_secret")
+		r.ServeHTTP(w, req)
+		if w.Code != status {
+			t.Errorf("GET %s = %d, want %d", path, w.Code, status)
+		}
+	}
+
+	reporter.Flush(5 * time.Second)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 {
+		t.Fatalf("reported %d events, want 2", len(events))
+	}
+	transactions := map[string]bool{}
+	for _, event := range events {
+		transactions[event["transaction"].(string)] = true
+		raw, _ := json.Marshal(event)
+		if strings.Contains(string(raw), "5f1c") || strings.Contains(string(raw), "secret") {
+			t.Errorf("event contains request details: %s", raw)
+		}
+		if event["transaction"] != "GET /v1/teams/:id" {
+			continue
+		}
+		user, _ := event["user"].(map[string]any)
+		tags, _ := event["tags"].(map[string]any)
+		if user["id"] != "7d2f" || tags["cli.token_id"] != tokenID.String() {
+			t.Errorf("caller = %v, tags = %v", user, tags)
+		}
+	}
+	if !transactions["GET /v1/projects/:id"] || !transactions["GET /v1/teams/:id"] {
+		t.Errorf("transactions = %v", transactions)
+	}
+}
+
+// Behind otelgin, a report carries the request's span, which continues the
+// caller's trace
+func TestRecoveryReportsTrace(t *testing.T) {
+	events := make(chan map[string]any, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event map[string]any
+		json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+	}))
+	defer server.Close()
+	reporter, err := errorreport.New(strings.Replace(server.URL, "://", "://key@", 1)+"/1", errorreport.Options{Release: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(otelgin.Middleware("envie-backend",
+		otelgin.WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))),
+		otelgin.WithPropagators(propagation.TraceContext{}),
+	))
+	r.Use(RecoveryMiddleware(reporter))
+	r.GET("/v1/projects/:id", func(c *gin.Context) { panic("nil map") })
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/projects/5f1c", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	reporter.Flush(5 * time.Second)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Parent().SpanID().String() != "00f067aa0ba902b7" || spans[0].Name() != "GET /v1/projects/:id" {
+		t.Fatalf("spans = %v", spans)
+	}
+	event := <-events
+	contexts, _ := event["contexts"].(map[string]any)
+	trace, _ := contexts["trace"].(map[string]any)
+	if trace["trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" || trace["span_id"] != spans[0].SpanContext().SpanID().String() {
+		t.Errorf("trace context = %v", contexts)
+	}
+}
@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultAllowedOrigins are the origins of the desktop app: the Tauri webview on
+// each platform and the Vite dev server
+var DefaultAllowedOrigins = []string{
+	"tauri://localhost",
+	"http://tauri.localhost",
+	"https://tauri.localhost",
+	"http://localhost:1420",
+}
+
+const (
+	corsAllowedOriginsEnv = "CORS_ALLOWED_ORIGINS"
+	corsMaxAge            = "600"
+
+	// apiContentSecurityPolicy applies to everything but the HTML pages, which set
+	// their own policy with SetPageContentSecurityPolicy
+	apiContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'"
+
+	corsAllowedMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+	corsAllowedHeaders = "Content-Type, Content-Length, Accept-Encoding, Authorization, Accept, Origin, Cache-Control, X-Requested-With, Idempotency-Key, X-API-Version, X-2FA-Code"
+	corsExposedHeaders = "X-Master-Key-Version, Idempotent-Replayed, X-API-Version, X-API-Supported-Versions, Deprecation, Sunset, Link, X-Chaos-Injected"
+)
+
+// AllowedOriginsFromEnv reads CORS_ALLOWED_ORIGINS, a comma separated list of
+// origins; "*" allows any origin. Unset means DefaultAllowedOrigins.
+func AllowedOriginsFromEnv() []string {
+	return AllowedOriginsFrom(os.Getenv)
+}
+
+// AllowedOriginsFrom is AllowedOriginsFromEnv reading variables through getenv
+func AllowedOriginsFrom(getenv func(string) string) []string {
+	value := getenv(corsAllowedOriginsEnv)
+	if value == "" {
+		return DefaultAllowedOrigins
+	}
+	var origins []string
+	for _, origin := range strings.Split(value, ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// CORSMiddleware answers preflight requests and allows cross-origin reads for the
+// given origins. The API authenticates with bearer tokens rather than cookies, so
+// credentialed requests are never allowed.
+func CORSMiddleware(allowedOrigins []string) gin.HandlerFunc {
+	return ReloadableCORSMiddleware(func() []string { return allowedOrigins })
+}
+
+// ReloadableCORSMiddleware is CORSMiddleware with the origins looked up on every
+// request, so a settings reload applies to the next one
+func ReloadableCORSMiddleware(origins func() []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		allowedOrigins := origins()
+		allowAny := slices.Contains(allowedOrigins, "*")
+		c.Writer.Header().Add("Vary", "Origin")
+		allowed := allowAny || slices.Contains(allowedOrigins, origin)
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if !allowed {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			// Without CORS headers the browser keeps the response from the page
+			c.Next()
+			return
+		}
+
+		if allowAny {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+
+		if preflight {
+			c.Header("Access-Control-Allow-Methods", corsAllowedMethods)
+			c.Header("Access-Control-Allow-Headers", corsAllowedHeaders)
+			c.Header("Access-Control-Max-Age", corsMaxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Header("Access-Control-Expose-Headers", corsExposedHeaders)
+		c.Next()
+	}
+}
+
+// SecurityHeadersMiddleware sets the standard hardening headers on every response
+func SecurityHeadersMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h := c.Writer.Header()
+		h.Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "no-referrer")
+		h.Set("Content-Security-Policy", apiContentSecurityPolicy)
+		c.Next()
+	}
+}
+
+// NoStoreMiddleware marks every response as not cacheable. Configs, tokens and files
+// are secret material even when encrypted, so nothing is cached unless a handler
+// declares its own policy, as public endpoints do with CachePolicy.
+func NoStoreMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h := c.Writer.Header()
+		h.Set("Cache-Control", "no-store")
+		h.Set("Pragma", "no-cache")
+		c.Next()
+	}
+}
+
+// CachePolicy replaces the default no-store policy for the public routes it is
+// registered on
+func CachePolicy(cacheControl string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h := c.Writer.Header()
+		h.Set("Cache-Control", cacheControl)
+		h.Del("Pragma")
+		c.Next()
+	}
+}
+
+// SetPageContentSecurityPolicy replaces the API policy for an HTML page and returns
+// the nonce its inline <style> and <script> elements must carry
+func SetPageContentSecurityPolicy(c *gin.Context) string {
+	raw := make([]byte, 16)
+	rand.Read(raw)
+	nonce := base64.StdEncoding.EncodeToString(raw)
+
+	c.Header("Content-Security-Policy", "default-src 'none'; "+
+		"style-src 'nonce-"+nonce+"'; script-src 'nonce-"+nonce+"'; img-src data:; "+
+		"base-uri 'none'; form-action 'none'; frame-ancestors 'none'")
+	return nonce
+}
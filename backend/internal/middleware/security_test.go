@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newCORSEngine(origins []string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(CORSMiddleware(origins))
+	r.GET("/v1/me", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	r := newCORSEngine(DefaultAllowedOrigins)
+
+	tests := []struct {
+		name        string
+		method      string
+		origin      string
+		preflight   bool
+		status      int
+		allowOrigin string
+	}{
+		{"allowed origin", http.MethodGet, "tauri://localhost", false, http.StatusOK, "tauri://localhost"},
+		{"other origin", http.MethodGet, "https://evil.example", false, http.StatusOK, ""},
+		{"no origin", http.MethodGet, "", false, http.StatusOK, ""},
+		{"allowed preflight", http.MethodOptions, "http://tauri.localhost", true, http.StatusNoContent, "http://tauri.localhost"},
+		{"rejected preflight", http.MethodOptions, "https://evil.example", true, http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/v1/me", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.allowOrigin)
+			}
+			if w.Header().Get("Access-Control-Allow-Credentials") != "" {
+				t.Error("credentials must not be allowed")
+			}
+			if tt.origin != "" && w.Header().Get("Vary") != "Origin" {
+				t.Errorf("Vary = %q, want Origin", w.Header().Get("Vary"))
+			}
+			if tt.status == http.StatusNoContent && !strings.Contains(w.Header().Get("Access-Control-Allow-Headers"), "Idempotency-Key") {
+				t.Errorf("Access-Control-Allow-Headers = %q", w.Header().Get("Access-Control-Allow-Headers"))
+			}
+		})
+	}
+}
+
+func TestCORSMiddlewareAnyOrigin(t *testing.T) {
+	r := newCORSEngine([]string{"*"})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/me", nil)
+	req.Header.Set("Origin", "https://app.example")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+}
+
+func TestAllowedOriginsFromEnv(t *testing.T) {
+	t.Setenv(corsAllowedOriginsEnv, "")
+	if got := AllowedOriginsFromEnv(); len(got) != len(DefaultAllowedOrigins) {
+		t.Errorf("unset: %v, want the defaults", got)
+	}
+
+	t.Setenv(corsAllowedOriginsEnv, " https://a.example/, ,https://b.example")
+	got := AllowedOriginsFromEnv()
+	if len(got) != 2 || got[0] != "https://a.example" || got[1] != "https://b.example" {
+		t.Errorf("AllowedOriginsFromEnv = %v", got)
+	}
+}
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(SecurityHeadersMiddleware())
+	r.GET("/v1/me", func(c *gin.Context) { c.Status(http.StatusOK) })
+	var nonce string
+	r.GET("/auth/callback", func(c *gin.Context) {
+		nonce = SetPageContentSecurityPolicy(c)
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/me", nil))
+	for header, want := range map[string]string{
+		"Strict-Transport-Security": "max-age=63072000; includeSubDomains",
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "DENY",
+		"Content-Security-Policy":   apiContentSecurityPolicy,
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/callback", nil))
+	csp := w.Header().Get("Content-Security-Policy")
+	if nonce == "" || !strings.Contains(csp, "script-src 'nonce-"+nonce+"'") || strings.Contains(csp, "unsafe-inline") {
+		t.Errorf("page Content-Security-Policy = %q", csp)
+	}
+}
+
+func TestCachePolicies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(NoStoreMiddleware())
+	r.GET("/v1/projects/:id/config", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/openapi.json", CachePolicy("public, max-age=300"), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/projects/p1/config", nil))
+	if w.Header().Get("Cache-Control") != "no-store" || w.Header().Get("Pragma") != "no-cache" {
+		t.Errorf("secret response: Cache-Control %q, Pragma %q", w.Header().Get("Cache-Control"), w.Header().Get("Pragma"))
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if w.Header().Get("Cache-Control") != "public, max-age=300" || w.Header().Get("Pragma") != "" {
+		t.Errorf("public response: Cache-Control %q, Pragma %q", w.Header().Get("Cache-Control"), w.Header().Get("Pragma"))
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	requestTimeoutEnv = "REQUEST_TIMEOUT"
+
+	// DefaultRequestTimeout leaves room for the longest long-poll, see
+	// handlers.WaitCLIConfigChange
+	DefaultRequestTimeout = 65 * time.Second
+)
+
+// RequestTimeoutFromEnv reads REQUEST_TIMEOUT, a duration such as 30s. Unset is
+// DefaultRequestTimeout, 0 disables the deadline.
+func RequestTimeoutFromEnv() (time.Duration, error) {
+	value := os.Getenv(requestTimeoutEnv)
+	if value == "" {
+		return DefaultRequestTimeout, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid %s %q", requestTimeoutEnv, value)
+	}
+	return timeout, nil
+}
+
+// RequestTimeoutMiddleware puts a deadline of timeout on the request's context.
+// Handlers run their database work with that context, so a request stuck behind
+// slow queries gives up and frees its connection instead of piling up with the
+// ones that follow it. Work that must outlive the request detaches with
+// context.WithoutCancel.
+func RequestTimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
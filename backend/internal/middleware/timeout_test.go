@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestTimeoutMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, timeout := range []time.Duration{time.Minute, 0} {
+		r := gin.New()
+		r.Use(RequestTimeoutMiddleware(timeout))
+		var deadline time.Time
+		var hasDeadline bool
+		r.GET("/", func(c *gin.Context) {
+			deadline, hasDeadline = c.Request.Context().Deadline()
+		})
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if hasDeadline != (timeout > 0) {
+			t.Errorf("timeout %s: deadline set = %v", timeout, hasDeadline)
+		}
+		if hasDeadline && time.Until(deadline) > timeout {
+			t.Errorf("timeout %s: deadline %s away", timeout, time.Until(deadline))
+		}
+	}
+}
+
+func TestRequestTimeoutFromEnv(t *testing.T) {
+	t.Setenv("REQUEST_TIMEOUT", "")
+	if timeout, err := RequestTimeoutFromEnv(); err != nil || timeout != DefaultRequestTimeout {
+		t.Errorf("unset = %s, %v", timeout, err)
+	}
+	t.Setenv("REQUEST_TIMEOUT", "15s")
+	if timeout, err := RequestTimeoutFromEnv(); err != nil || timeout != 15*time.Second {
+		t.Errorf("15s = %s, %v", timeout, err)
+	}
+	t.Setenv("REQUEST_TIMEOUT", "soon")
+	if _, err := RequestTimeoutFromEnv(); err == nil {
+		t.Error("invalid timeout accepted")
+	}
+}
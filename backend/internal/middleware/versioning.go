@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"envie-backend/internal/apierror"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	APIVersionHeader           = "X-API-Version"
+	APISupportedVersionsHeader = "X-API-Supported-Versions"
+
+	// CurrentAPIVersion is the version served under /v1
+	CurrentAPIVersion = "1"
+)
+
+// SupportedAPIVersions lists every version a client may request, oldest first
+var SupportedAPIVersions = []string{CurrentAPIVersion}
+
+// APIVersionMiddleware negotiates the API version. Clients may send X-API-Version
+// with the version they were built against; unsupported versions are rejected with
+// 400 so an outdated desktop app can tell the user to update instead of failing
+// on a changed response shape. Every response carries the served version.
+func APIVersionMiddleware() gin.HandlerFunc {
+	supported := strings.Join(SupportedAPIVersions, ", ")
+
+	return func(c *gin.Context) {
+		c.Header(APIVersionHeader, CurrentAPIVersion)
+		c.Header(APISupportedVersionsHeader, supported)
+
+		requested := c.GetHeader(APIVersionHeader)
+		if requested != "" && !slices.Contains(SupportedAPIVersions, requested) {
+			apierror.Abort(c, apierror.New(http.StatusBadRequest, apierror.CodeAPIVersionUnsupported, "Unsupported API version "+requested+", supported: "+supported))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// DeprecatedRouteMiddleware marks responses from legacy routes with the Deprecation,
+// Sunset and Link headers (RFC 8594). successorPrefix is prepended to the request
+// path to point clients at the replacement route.
+func DeprecatedRouteMiddleware(successorPrefix string, sunset time.Time) gin.HandlerFunc {
+	sunsetValue := sunset.UTC().Format(http.TimeFormat)
+
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Sunset", sunsetValue)
+		c.Header("Link", "<"+successorPrefix+c.Request.URL.Path+`>; rel="successor-version"`)
+		c.Next()
+	}
+}
+
+// LegacyCLIRewrite forwards CLI requests that use the pre-versioning paths
+// (/v1/projects/...) to their current location under /v1/cli. Those paths now belong
+// to the application API, so requests are told apart by the X-CLI-Identity header.
+// The path is rewritten before engine routes the request, and only when it matches
+// a registered /v1/cli route, so everything else reaches the application API as is.
+// Wrap the engine after every route is registered.
+func LegacyCLIRewrite(engine *gin.Engine, sunset time.Time) http.Handler {
+	sunsetValue := sunset.UTC().Format(http.TimeFormat)
+
+	var cliRoutes gin.RoutesInfo
+	for _, route := range engine.Routes() {
+		if strings.HasPrefix(route.Path, "/v1/cli/") {
+			cliRoutes = append(cliRoutes, route)
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(CLIIdentityHeader) == "" || r.Header.Get("Authorization") != "" || !strings.HasPrefix(r.URL.Path, "/v1/") {
+			engine.ServeHTTP(w, r)
+			return
+		}
+
+		path := "/v1/cli" + strings.TrimPrefix(r.URL.Path, "/v1")
+		if !matchesRoute(cliRoutes, r.Method, path) {
+			engine.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Sunset", sunsetValue)
+		w.Header().Set("Link", "<"+path+`>; rel="successor-version"`)
+
+		// Shallow copy like http.StripPrefix, the caller's request stays untouched
+		rewritten := new(http.Request)
+		*rewritten = *r
+		rewritten.URL = new(url.URL)
+		*rewritten.URL = *r.URL
+		rewritten.URL.Path = path
+		rewritten.URL.RawPath = ""
+		engine.ServeHTTP(w, rewritten)
+	})
+}
+
+// matchesRoute reports whether method and path match one of routes, treating
+// :param segments as wildcards
+func matchesRoute(routes gin.RoutesInfo, method, path string) bool {
+	segments := strings.Split(path, "/")
+	for _, route := range routes {
+		if route.Method != method {
+			continue
+		}
+		pattern := strings.Split(route.Path, "/")
+		if len(pattern) != len(segments) {
+			continue
+		}
+		matched := true
+		for i, part := range pattern {
+			if strings.HasPrefix(part, ":") {
+				matched = segments[i] != ""
+			} else {
+				matched = part == segments[i]
+			}
+			if !matched {
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var testSunset = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+
+func TestAPIVersionMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/v1/me", APIVersionMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name      string
+		requested string
+		status    int
+	}{
+		{"no version", "", http.StatusOK},
+		{"current version", CurrentAPIVersion, http.StatusOK},
+		{"unsupported version", "2", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/me", nil)
+			if tt.requested != "" {
+				req.Header.Set(APIVersionHeader, tt.requested)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get(APIVersionHeader); got != CurrentAPIVersion {
+				t.Errorf("%s = %q, want %q", APIVersionHeader, got, CurrentAPIVersion)
+			}
+			if got := w.Header().Get(APISupportedVersionsHeader); got != "1" {
+				t.Errorf("%s = %q, want 1", APISupportedVersionsHeader, got)
+			}
+		})
+	}
+}
+
+func TestDeprecatedRouteMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/projects/:id", DeprecatedRouteMiddleware("/v1", testSunset), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/projects/abc", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	want := map[string]string{
+		"Deprecation": "true",
+		"Sunset":      "Fri, 30 Apr 2027 00:00:00 GMT",
+		"Link":        `</v1/projects/abc>; rel="successor-version"`,
+	}
+	for header, value := range want {
+		if got := w.Header().Get(header); got != value {
+			t.Errorf("%s = %q, want %q", header, got, value)
+		}
+	}
+}
+
+// newLegacyCLIEngine mirrors the router layout: the CLI API under /v1/cli and the
+// application API under /v1, with a global middleware counting its runs
+func newLegacyCLIEngine(globalRuns *int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		*globalRuns++
+		c.Next()
+	})
+
+	handler := func(name string) gin.HandlerFunc {
+		return func(c *gin.Context) { c.String(http.StatusOK, name+" "+c.Param("id")) }
+	}
+	r.GET("/v1/cli/verify", handler("cli-verify"))
+	r.GET("/v1/cli/projects/:id/config", handler("cli-config"))
+	r.GET("/v1/projects/:id/config", handler("app-config"))
+	r.PUT("/v1/projects/:id/config", handler("app-sync"))
+	return r
+}
+
+func TestLegacyCLIRewrite(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		identity   string
+		auth       string
+		body       string
+		deprecated bool
+	}{
+		{"legacy CLI path", http.MethodGet, "/v1/projects/p1/config", "identity", "", "cli-config p1", true},
+		{"legacy verify", http.MethodGet, "/v1/verify", "identity", "", "cli-verify ", true},
+		{"current CLI path", http.MethodGet, "/v1/cli/projects/p1/config", "identity", "", "cli-config p1", false},
+		{"app request", http.MethodGet, "/v1/projects/p1/config", "", "Bearer jwt", "app-config p1", false},
+		{"identity with JWT", http.MethodGet, "/v1/projects/p1/config", "identity", "Bearer jwt", "app-config p1", false},
+		{"no matching CLI route", http.MethodPut, "/v1/projects/p1/config", "identity", "", "app-sync p1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			globalRuns := 0
+			handler := LegacyCLIRewrite(newLegacyCLIEngine(&globalRuns), testSunset)
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.identity != "" {
+				req.Header.Set(CLIIdentityHeader, tt.identity)
+			}
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK || w.Body.String() != tt.body {
+				t.Errorf("got %d %q, want 200 %q", w.Code, w.Body.String(), tt.body)
+			}
+			if globalRuns != 1 {
+				t.Errorf("global middleware ran %d times, want 1", globalRuns)
+			}
+			if req.URL.Path != tt.path {
+				t.Errorf("caller's request path changed to %s", req.URL.Path)
+			}
+
+			deprecated := w.Header().Get("Deprecation") == "true"
+			if deprecated != tt.deprecated {
+				t.Errorf("Deprecation header set = %v, want %v", deprecated, tt.deprecated)
+			}
+			if tt.deprecated {
+				want := `</v1/cli` + tt.path[len("/v1"):] + `>; rel="successor-version"`
+				if got := w.Header().Get("Link"); got != want {
+					t.Errorf("Link = %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Access log levels an organization can choose
+const (
+	AccessLogFull     = "full"     // every request, with path, client IP and user agent
+	AccessLogMetadata = "metadata" // every request, but only the route and who made it
+	AccessLogWrites   = "writes"   // full entries for changes, reads are not logged
+
+	DefaultAccessLogRetentionDays = 90
+)
+
+// AccessLog is an authenticated request to an organization's resources
+type AccessLog struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	OrganizationID uuid.UUID  `gorm:"type:uuid;not null;index:idx_access_log_org_time" json:"organizationId"`
+	ProjectID      *uuid.UUID `gorm:"type:uuid" json:"projectId,omitempty"`
+	UserID         *uuid.UUID `gorm:"type:uuid" json:"userId,omitempty"`
+	TokenID        *uuid.UUID `gorm:"type:uuid" json:"tokenId,omitempty"` // CLI token
+
+	Method string `gorm:"size:10;not null" json:"method"`
+	Route  string `gorm:"size:255;not null" json:"route"` // e.g. /v1/projects/:id/config
+	Status int    `gorm:"not null" json:"status"`
+
+	// Left out at the metadata level
+	Path      *string `gorm:"size:2048" json:"path,omitempty"`
+	ClientIP  *string `gorm:"size:45" json:"clientIp,omitempty"`
+	UserAgent *string `gorm:"size:255" json:"userAgent,omitempty"`
+
+	Organization Organization `gorm:"foreignKey:OrganizationID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	CreatedAt time.Time `gorm:"index:idx_access_log_org_time" json:"createdAt"`
+}
+
+func (l *AccessLog) BeforeCreate(tx *gorm.DB) (err error) {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Audit actions
+const (
+	AuditTokensRevoked    = "tokens_revoked"
+	AuditSSOConfigured    = "sso_configured"
+	AuditSSORemoved       = "sso_removed"
+	AuditIPAllowlist      = "ip_allowlist_changed"
+	AuditMemberDeleted    = "member_account_deleted"
+	AuditSessionPolicy    = "session_policy_changed"
+	AuditFilePolicy       = "file_policy_changed"
+	AuditReadRetention    = "read_audit_retention_changed"
+	AuditTrashRetention   = "config_trash_retention_changed"
+	AuditStreamConfigured = "audit_stream_configured"
+	AuditStreamRemoved    = "audit_stream_removed"
+
+	AuditProjectCreated    = "project_created"
+	AuditMemberAdded       = "member_added"
+	AuditRotationCommitted = "key_rotation_committed"
+	AuditTokenIssued       = "token_issued"
+
+	AuditConfigSynced      = "config_synced"
+	AuditFileUploaded      = "file_uploaded"
+	AuditFileDeleted       = "file_deleted"
+	AuditFileMoved         = "file_moved"
+	AuditFileShared        = "file_shared"
+	AuditFileShareRevoked  = "file_share_revoked"
+	AuditTokenRotated      = "token_rotated"
+	AuditTokenRenewed      = "token_renewed"
+	AuditTokenDeleted      = "token_deleted"
+	AuditRotationInitiated = "key_rotation_initiated"
+
+	AuditFileDownloaded = "file_downloaded"
+	AuditConfigRead     = "config_read"
+)
+
+// AuditReadActions are the audit events recording who read secrets rather than
+// changed them. They're kept for the organization's ReadAuditRetentionDays.
+var AuditReadActions = []string{AuditFileDownloaded, AuditConfigRead}
+
+// AuditEvent is an entry in an organization's audit log of bulk and incident
+// response actions, and of the changes its activity feed shows. It outlives the
+// projects it refers to.
+type AuditEvent struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	OrganizationID uuid.UUID  `gorm:"type:uuid;not null;index:idx_audit_event_org_time" json:"organizationId"`
+	ProjectID      *uuid.UUID `gorm:"type:uuid" json:"projectId"` // nil for organization-wide actions
+	ActorID        uuid.UUID  `gorm:"type:uuid;not null" json:"actorId"`
+	Action         string     `gorm:"size:50;not null" json:"action"`
+	Detail         string     `gorm:"size:500" json:"detail"`
+	Count          int        `gorm:"not null;default:0" json:"count"` // items affected
+
+	// The CLI token behind the action, whose creator is the actor, and the
+	// address the request came from; set on read events
+	TokenID  *uuid.UUID `gorm:"type:uuid" json:"tokenId,omitempty"`
+	ClientIP *string    `gorm:"size:45" json:"clientIp,omitempty"`
+
+	// The project's config checksum before and after a config_synced event
+	ChecksumBefore *string `gorm:"size:64" json:"checksumBefore,omitempty"`
+	ChecksumAfter  *string `gorm:"size:64" json:"checksumAfter,omitempty"`
+
+	Organization Organization `gorm:"foreignKey:OrganizationID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	CreatedAt time.Time `gorm:"index:idx_audit_event_org_time" json:"createdAt"`
+}
+
+func (e *AuditEvent) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return
+}
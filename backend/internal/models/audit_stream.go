@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audit stream destinations
+const (
+	AuditStreamHTTPS  = "https"  // NDJSON POSTed to URL
+	AuditStreamSyslog = "syslog" // RFC 5424 messages over TLS to Address
+	AuditStreamS3     = "s3"     // an NDJSON object per batch in Bucket
+)
+
+// AuditStream ships an organization's audit events to its SIEM as they are
+// recorded. Events after the cursor (CursorAt, CursorID) are shipped next; the
+// cursor starts at the stream's creation and older events are exported instead.
+type AuditStream struct {
+	OrganizationID uuid.UUID `gorm:"type:uuid;primaryKey" json:"organizationId"`
+	Destination    string    `gorm:"size:20;not null" json:"destination"` // https, syslog, s3
+	Enabled        bool      `gorm:"not null" json:"enabled"`
+	// IncludeReads also ships file_downloaded and config_read events
+	IncludeReads bool `gorm:"not null;default:false" json:"includeReads"`
+
+	URL     string `gorm:"size:500" json:"url,omitempty"`     // https
+	Address string `gorm:"size:255" json:"address,omitempty"` // syslog, host:port
+
+	// s3; Endpoint is empty for AWS
+	Bucket          string `gorm:"size:255" json:"bucket,omitempty"`
+	Prefix          string `gorm:"size:255" json:"prefix,omitempty"`
+	Region          string `gorm:"size:50" json:"region,omitempty"`
+	Endpoint        string `gorm:"size:500" json:"endpoint,omitempty"`
+	AccessKeyID     string `gorm:"size:255" json:"accessKeyId,omitempty"`
+	SecretAccessKey string `gorm:"size:1024" json:"-"`
+
+	// SigningSecret keys the HMAC-SHA256 signature of every batch
+	SigningSecret string `gorm:"size:64;not null" json:"-"`
+
+	CursorAt  time.Time  `gorm:"not null" json:"cursorAt"`
+	CursorID  uuid.UUID  `gorm:"type:uuid;not null" json:"cursorId"`
+	LeaseEnds *time.Time `json:"-"` // set while an instance ships the stream
+
+	LastShippedAt *time.Time `json:"lastShippedAt"`
+	LastError     *string    `gorm:"type:text" json:"lastError"`
+	LastErrorAt   *time.Time `json:"lastErrorAt"`
+
+	Organization Organization `gorm:"foreignKey:OrganizationID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	CreatedByID uuid.UUID `gorm:"type:uuid" json:"createdById"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ComplianceLabel is an organization's tag for data under a compliance regime,
+// such as PCI, HIPAA or internal-only. Labels are metadata: they don't change
+// how values are encrypted or who can decrypt them.
+type ComplianceLabel struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	OrganizationID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_compliance_label_name" json:"organizationId"`
+	Name           string    `gorm:"size:50;not null;uniqueIndex:idx_compliance_label_name" json:"name"`
+	Description    *string   `gorm:"size:255" json:"description"`
+
+	Organization Organization `gorm:"foreignKey:OrganizationID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (l *ComplianceLabel) BeforeCreate(tx *gorm.DB) (err error) {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return
+}
+
+// ProjectComplianceLabel tags a project, and so each of its config items
+type ProjectComplianceLabel struct {
+	ProjectID uuid.UUID `gorm:"type:uuid;primaryKey" json:"projectId"`
+	LabelID   uuid.UUID `gorm:"type:uuid;primaryKey;index" json:"labelId"`
+
+	Project Project         `gorm:"foreignKey:ProjectID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Label   ComplianceLabel `gorm:"foreignKey:LabelID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// ConfigItemComplianceLabel tags a single config item
+type ConfigItemComplianceLabel struct {
+	ConfigItemID uuid.UUID `gorm:"type:uuid;primaryKey" json:"configItemId"`
+	LabelID      uuid.UUID `gorm:"type:uuid;primaryKey;index" json:"labelId"`
+
+	ConfigItem ConfigItem      `gorm:"foreignKey:ConfigItemID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Label      ComplianceLabel `gorm:"foreignKey:LabelID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
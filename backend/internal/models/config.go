@@ -1,6 +1,10 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,15 +13,22 @@ import (
 
 type ConfigItem struct {
 	ID          uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	ProjectID   uuid.UUID  `gorm:"type:uuid;index;not null" json:"projectId"`
+	ProjectID   uuid.UUID  `gorm:"type:uuid;not null;index:idx_config_item_project_position" json:"projectId"`
 	Name        string     `gorm:"size:255;not null" json:"name"`
 	Value       string     `gorm:"type:text;not null" json:"value"`
 	Sensitive   bool       `gorm:"default:false" json:"sensitive"`
-	Position    int        `gorm:"default:0" json:"position"`
+	Position    int        `gorm:"default:0;index:idx_config_item_project_position" json:"position"`
 	Category    *string    `gorm:"size:255" json:"category"`
 	Description *string    `gorm:"type:text" json:"description"`
 	ExpiresAt   *time.Time `gorm:"type:timestamp" json:"expiresAt"`
 
+	// ValueType is one of VariableTypes. The server only stores it: clients check
+	// the value against it before encrypting and may export typed values.
+	ValueType string `gorm:"size:20;not null;default:'string'" json:"valueType"`
+	// HasReferences marks a value containing ${KEY} references to other items,
+	// which the CLI expands when exporting
+	HasReferences bool `gorm:"not null;default:false" json:"hasReferences"`
+
 	CreatedBy uuid.UUID `gorm:"type:uuid" json:"createdBy"`
 	UpdatedBy uuid.UUID `gorm:"type:uuid" json:"updatedBy"`
 
@@ -34,6 +45,53 @@ type ConfigItem struct {
 	SecretManagerName       *string             `json:"secretManagerName"`
 	SecretManagerLastSyncAt *time.Time          `json:"secretManagerLastSyncAt"`
 	SecretManagerVersion    *string             `json:"secretManagerVersion"`
+
+	// Masked is set in responses whose value was omitted because the project
+	// restricts sensitive values. Syncing a masked item keeps its stored value.
+	Masked bool `gorm:"-" json:"masked,omitempty"`
+}
+
+// ConfigChecksumVersion is the format of ConfigChecksum. Version 1, kept as
+// LegacyConfigChecksum, joined "name=value" lines, so a value containing a
+// newline could hash like two items.
+const ConfigChecksumVersion = 2
+
+// configChecksumTag starts the hashed serialization of version 2
+const configChecksumTag = "envie-config-checksum-v2"
+
+// ConfigChecksum is the checksum of a project's config, over its items' names and
+// encrypted values in position order. Each field is prefixed with its length, as
+// is the item count, so no two configs serialize alike.
+func ConfigChecksum(items []ConfigItem) string {
+	hash := sha256.New()
+	var length [8]byte
+	write := func(field string) {
+		binary.BigEndian.PutUint64(length[:], uint64(len(field)))
+		hash.Write(length[:])
+		hash.Write([]byte(field))
+	}
+
+	hash.Write([]byte(configChecksumTag))
+	binary.BigEndian.PutUint64(length[:], uint64(len(items)))
+	hash.Write(length[:])
+	for _, item := range items {
+		write(item.Name)
+		write(item.Value)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// LegacyConfigChecksum is ConfigChecksum in version 1, still served next to it
+// until the migration window closes
+func LegacyConfigChecksum(items []ConfigItem) string {
+	var lines []string
+	for _, item := range items {
+		lines = append(lines, item.Name+"="+item.Value)
+	}
+
+	content := strings.Join(lines, "\n")
+	hash := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(hash[:])
 }
 
 func (c *ConfigItem) BeforeCreate(tx *gorm.DB) (err error) {
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Statuses of a config draft
+const (
+	DraftOpen      = "open"
+	DraftApplied   = "applied"
+	DraftRejected  = "rejected"
+	DraftDiscarded = "discarded" // withdrawn by its author
+)
+
+// ConfigDraft is a full config staged for review instead of synced to the live
+// config. Its values are encrypted with the project key of KeyVersion like the
+// config items, and it is based on the live config of checksum BaseChecksum: it
+// can only be applied while the live config and key are unchanged.
+type ConfigDraft struct {
+	ID           uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ProjectID    uuid.UUID `gorm:"type:uuid;not null;index:idx_config_draft_project_status" json:"projectId"`
+	Title        string    `gorm:"size:255;not null" json:"title"`
+	Status       string    `gorm:"size:20;not null;default:'open';index:idx_config_draft_project_status" json:"status"`
+	BaseChecksum string    `gorm:"size:64" json:"baseChecksum"`
+	KeyVersion   int       `gorm:"not null" json:"keyVersion"`
+
+	Items []ConfigSnapshotItem `gorm:"serializer:json;type:text" json:"items,omitempty"`
+
+	CreatedBy       uuid.UUID  `gorm:"type:uuid;not null" json:"createdBy"`
+	ReviewedBy      *uuid.UUID `gorm:"type:uuid" json:"reviewedBy,omitempty"`
+	ReviewedAt      *time.Time `json:"reviewedAt,omitempty"`
+	RejectionReason *string    `gorm:"type:text" json:"rejectionReason,omitempty"`
+
+	Project  Project `gorm:"foreignKey:ProjectID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Author   User    `gorm:"foreignKey:CreatedBy" json:"author"`
+	Reviewer *User   `gorm:"foreignKey:ReviewedBy" json:"reviewer,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (d *ConfigDraft) BeforeCreate(tx *gorm.DB) (err error) {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Reasons a config snapshot was taken
+const (
+	SnapshotManual   = "manual"
+	SnapshotSync     = "sync"     // before a sync changed the config
+	SnapshotRotation = "rotation" // the config a key rotation committed, under the new key
+	SnapshotRestore  = "restore"  // before another snapshot was restored
+)
+
+// ConfigSnapshot is a copy of a project's full config at a point in time. The
+// values stay encrypted as clients synced them, under the project key of
+// KeyVersion, so a snapshot can only be restored until the next key rotation.
+type ConfigSnapshot struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ProjectID  uuid.UUID `gorm:"type:uuid;not null;index:idx_config_snapshot_project_time" json:"projectId"`
+	Name       string    `gorm:"size:255;not null" json:"name"`
+	Reason     string    `gorm:"size:20;not null" json:"reason"`
+	KeyVersion int       `gorm:"not null" json:"keyVersion"`
+	ItemCount  int       `gorm:"not null" json:"itemCount"`
+	Checksum   string    `gorm:"size:64;not null" json:"checksum"` // ConfigChecksum of the items
+
+	// LegacyChecksum is LegacyConfigChecksum of the items, for clients that still
+	// record checksums in version 1
+	LegacyChecksum string `gorm:"size:64" json:"-"`
+
+	Items []ConfigSnapshotItem `gorm:"serializer:json;type:text" json:"items,omitempty"`
+
+	// Restorable is set in responses: the snapshot is under the current project key
+	Restorable bool `gorm:"-" json:"restorable"`
+
+	CreatedBy uuid.UUID `gorm:"type:uuid;not null" json:"createdBy"`
+	Project   Project   `gorm:"foreignKey:ProjectID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	CreatedAt time.Time `gorm:"index:idx_config_snapshot_project_time" json:"createdAt"`
+}
+
+// ConfigSnapshotItem is a config item as a snapshot keeps it
+type ConfigSnapshotItem struct {
+	ID            uuid.UUID  `json:"id"`
+	Name          string     `json:"name"`
+	Value         string     `json:"value"`
+	Sensitive     bool       `json:"sensitive"`
+	Position      int        `json:"position"`
+	Category      *string    `json:"category"`
+	Description   *string    `json:"description"`
+	ExpiresAt     *time.Time `json:"expiresAt"`
+	ValueType     string     `json:"valueType"`
+	HasReferences bool       `json:"hasReferences"`
+
+	SecretManagerConfigID   *uuid.UUID `json:"secretManagerConfigId"`
+	SecretManagerName       *string    `json:"secretManagerName"`
+	SecretManagerLastSyncAt *time.Time `json:"secretManagerLastSyncAt"`
+	SecretManagerVersion    *string    `json:"secretManagerVersion"`
+
+	CreatedBy uuid.UUID `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Masked is set in responses whose value was omitted, as on ConfigItem
+	Masked bool `json:"masked,omitempty"`
+}
+
+// ConfigItems are the snapshot's items as config items, with only the fields
+// checksums cover
+func (s *ConfigSnapshot) ConfigItems() []ConfigItem {
+	items := make([]ConfigItem, len(s.Items))
+	for i, item := range s.Items {
+		items[i] = ConfigItem{ID: item.ID, Name: item.Name, Value: item.Value, Position: item.Position}
+	}
+	return items
+}
+
+func (s *ConfigSnapshot) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Deployment target providers
+const (
+	DeploymentProviderVercel  = "vercel"
+	DeploymentProviderNetlify = "netlify"
+	DeploymentProviderFly     = "fly"
+)
+
+// Deployment sync statuses
+const (
+	DeploymentSyncPending   = "pending"
+	DeploymentSyncRunning   = "running"
+	DeploymentSyncSucceeded = "succeeded"
+	DeploymentSyncFailed    = "failed"
+)
+
+type DeploymentTarget struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ProjectID uuid.UUID `gorm:"type:uuid;index;not null" json:"projectId"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	Provider  string    `gorm:"size:20;not null" json:"provider"` // vercel, netlify, fly
+
+	ExternalID   string  `gorm:"size:255;not null" json:"externalId"` // vercel project, netlify site, fly app
+	ExternalTeam *string `gorm:"size:255" json:"externalTeam"`        // vercel team id, netlify account id
+
+	// Provider API token encrypted with the project key, decrypted on the client only
+	EncryptedCredentials string `gorm:"type:text;not null" json:"encryptedCredentials"`
+
+	KeyMapping   string `gorm:"type:text" json:"keyMapping"`  // JSON array of {source, target}, empty means all keys as-is
+	Environments string `gorm:"size:255" json:"environments"` // comma separated provider environments, e.g. production,preview
+
+	LastSyncStatus *string    `gorm:"size:20" json:"lastSyncStatus"`
+	LastSyncAt     *time.Time `json:"lastSyncAt"`
+	LastSyncError  *string    `gorm:"type:text" json:"lastSyncError"`
+
+	Project Project `gorm:"foreignKey:ProjectID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	CreatedByID uuid.UUID `gorm:"type:uuid" json:"createdById"`
+	CreatedBy   User      `json:"createdBy"`
+	UpdatedByID uuid.UUID `gorm:"type:uuid" json:"updatedById"`
+	UpdatedBy   User      `json:"updatedBy"`
+
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+func (d *DeploymentTarget) BeforeCreate(tx *gorm.DB) (err error) {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return
+}
+
+type DeploymentSync struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	TargetID  uuid.UUID `gorm:"type:uuid;index;not null" json:"targetId"`
+	ProjectID uuid.UUID `gorm:"type:uuid;index;not null" json:"projectId"`
+	Status    string    `gorm:"size:20;default:'pending'" json:"status"` // pending, running, succeeded, failed
+
+	TriggeredByUserID  *uuid.UUID `gorm:"type:uuid" json:"triggeredByUserId"`
+	TriggeredByTokenID *uuid.UUID `gorm:"type:uuid" json:"triggeredByTokenId"`
+
+	ConfigChecksum *string    `gorm:"size:64" json:"configChecksum"`
+	KeysPushed     int        `gorm:"default:0" json:"keysPushed"`
+	Error          *string    `gorm:"type:text" json:"error"`
+	FinishedAt     *time.Time `json:"finishedAt"`
+
+	Target DeploymentTarget `gorm:"foreignKey:TargetID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (d *DeploymentSync) BeforeCreate(tx *gorm.DB) (err error) {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return
+}
+
+func (d *DeploymentSync) IsFinished() bool {
+	return d.Status == DeploymentSyncSucceeded || d.Status == DeploymentSyncFailed
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Pairing statuses
+const (
+	PairingPending   = "pending"
+	PairingApproved  = "approved"
+	PairingDenied    = "denied"
+	PairingCompleted = "completed" // the device received its tokens
+)
+
+// DevicePairing is a new device waiting for a signed-in user to approve it from
+// another device. The QR code the device shows carries the ID and the approval
+// code; the device polls with the poll secret. Both are stored as SHA-256 hashes.
+type DevicePairing struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	CodeHash       string    `gorm:"size:64;not null" json:"-"`
+	PollSecretHash string    `gorm:"size:64;not null" json:"-"`
+	Status         string    `gorm:"size:16;not null;default:'pending'" json:"status"`
+
+	// The device, as it described itself; the key is proven (see auth.VerifyDeviceChallenge)
+	DeviceName      string `gorm:"size:255" json:"deviceName"`
+	DevicePublicKey string `gorm:"type:text" json:"devicePublicKey"`
+	ClientIP        string `gorm:"size:45" json:"clientIp"`
+	UserAgent       string `gorm:"size:255" json:"userAgent"`
+
+	// Set on approval or denial
+	UserID            *uuid.UUID `gorm:"type:uuid;index" json:"userId"`
+	SSOOrganizationID *uuid.UUID `gorm:"type:uuid" json:"-"` // of the approving session
+	DecidedAt         *time.Time `json:"decidedAt"`
+
+	ExpiresAt time.Time `gorm:"not null;index" json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (p *DevicePairing) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return
+}
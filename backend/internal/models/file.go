@@ -11,6 +11,7 @@ type ProjectFile struct {
 	ID           uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
 	ProjectID    uuid.UUID `gorm:"type:uuid;index;not null" json:"projectId"`
 	Name         string    `gorm:"size:255;not null" json:"name"`
+	Folder       string    `gorm:"size:500;not null;default:''" json:"folder"` // slash-separated path, "" for the top level
 	SizeBytes    int64     `gorm:"not null" json:"sizeBytes"`
 	MimeType     string    `gorm:"size:100" json:"mimeType"`
 	S3Key        string    `gorm:"size:500;not null" json:"s3Key"`
@@ -26,3 +27,27 @@ type ProjectFile struct {
 	UpdatedAt time.Time      `json:"updatedAt"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
+
+// FileUpload is a direct-to-storage upload the client was given a URL for but
+// hasn't finalized yet. Finalizing turns it into a ProjectFile; uploads left
+// past ExpiresAt are purged along with whatever was uploaded.
+type FileUpload struct {
+	ID            uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ProjectID     uuid.UUID `gorm:"type:uuid;index;not null" json:"projectId"`
+	Name          string    `gorm:"size:255;not null" json:"name"`
+	Folder        string    `gorm:"size:500;not null;default:''" json:"folder"`
+	SizeBytes     int64     `gorm:"not null" json:"sizeBytes"`
+	EncryptedSize int64     `gorm:"not null" json:"encryptedSize"` // exact size the stored object must have
+	MimeType      string    `gorm:"size:100" json:"mimeType"`
+	S3Key         string    `gorm:"size:500;not null" json:"s3Key"`
+	EncryptedFEK  string    `gorm:"type:text;not null" json:"encryptedFek"`
+	Checksum      string    `gorm:"size:64" json:"checksum"`
+	KeyVersion    int       `gorm:"not null" json:"keyVersion"` // project key the FEK is encrypted with
+
+	UploadedBy uuid.UUID `gorm:"type:uuid;not null" json:"uploadedBy"`
+
+	Project Project `gorm:"foreignKey:ProjectID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	ExpiresAt time.Time `gorm:"index;not null" json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
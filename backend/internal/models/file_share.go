@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileShare hands one encrypted file to someone outside the project at a signed
+// URL. The server can't decrypt the file's FEK, so the member sharing it wraps
+// the FEK with a key of its own and passes that key to the recipient out of
+// band; the app puts it in the URL fragment, which browsers don't send.
+type FileShare struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ProjectID uuid.UUID `gorm:"type:uuid;index;not null" json:"projectId"`
+	FileID    uuid.UUID `gorm:"type:uuid;index;not null" json:"fileId"`
+
+	WrappedFEK string `gorm:"type:text;not null" json:"-"`
+
+	ExpiresAt time.Time  `gorm:"not null" json:"expiresAt"`
+	SingleUse bool       `gorm:"not null;default:false" json:"singleUse"`
+	UsedAt    *time.Time `json:"usedAt"` // first download
+	RevokedAt *time.Time `json:"revokedAt"`
+
+	Project Project     `gorm:"foreignKey:ProjectID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	File    ProjectFile `gorm:"foreignKey:FileID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	CreatedByID uuid.UUID `gorm:"type:uuid;not null" json:"createdById"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// File share access outcomes
+const (
+	FileShareDownloaded = "downloaded"
+	FileShareExpired    = "expired"
+	FileShareUsed       = "already_used"
+	FileShareRevoked    = "revoked"
+)
+
+// FileShareAccess is an attempt to download a file share with a valid
+// signature, including the ones refused because the share was spent
+type FileShareAccess struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ShareID   uuid.UUID `gorm:"type:uuid;index;not null" json:"shareId"`
+	Outcome   string    `gorm:"size:20;not null" json:"outcome"`
+	IPAddress string    `gorm:"size:45" json:"ipAddress"`
+	UserAgent string    `gorm:"size:255" json:"userAgent"`
+
+	Share FileShare `gorm:"foreignKey:ShareID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// IdempotencyKey stores the response of a mutating request so retries carrying the
+// same Idempotency-Key header replay it instead of applying the change twice
+type IdempotencyKey struct {
+	ID uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	// UserID is the user who sent the request, or the CLI token for requests
+	// made with one
+	UserID      uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_idempotency_user_key" json:"userId"`
+	Key         string    `gorm:"size:255;not null;uniqueIndex:idx_idempotency_user_key" json:"key"`
+	Method      string    `gorm:"size:10;not null" json:"method"`
+	Path        string    `gorm:"size:512;not null" json:"path"`
+	RequestHash string    `gorm:"size:64;not null" json:"-"` // SHA256 of method, path and body
+
+	StatusCode   int    `gorm:"default:0" json:"statusCode"` // 0 while the original request is in flight
+	ContentType  string `gorm:"size:100" json:"-"`
+	ResponseBody string `gorm:"type:text" json:"-"`
+
+	ExpiresAt time.Time `gorm:"index;not null" json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (k *IdempotencyKey) BeforeCreate(tx *gorm.DB) (err error) {
+	if k.ID == uuid.Nil {
+		k.ID = uuid.New()
+	}
+	return
+}
+
+func (k *IdempotencyKey) IsCompleted() bool {
+	return k.StatusCode != 0
+}
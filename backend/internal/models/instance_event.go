@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Instance audit actions
+const (
+	InstanceUserDisabled      = "user_disabled"
+	InstanceUserEnabled       = "user_enabled"
+	InstanceRoleChanged       = "instance_role_changed"
+	InstanceTokensRevoked     = "tokens_revoked"
+	InstancePlanLimitsChanged = "plan_limits_changed"
+)
+
+// InstanceEvent is an entry in the instance's audit log of what superadmins
+// did. Unlike AuditEvent it belongs to no organization.
+type InstanceEvent struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ActorID      uuid.UUID  `gorm:"type:uuid;not null" json:"actorId"`
+	Action       string     `gorm:"size:50;not null" json:"action"`
+	TargetUserID *uuid.UUID `gorm:"type:uuid" json:"targetUserId,omitempty"`
+	Detail       string     `gorm:"size:500" json:"detail"`
+	Count        int        `gorm:"not null;default:0" json:"count"` // items affected
+	CreatedAt    time.Time  `gorm:"index" json:"createdAt"`
+}
+
+func (e *InstanceEvent) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return
+}
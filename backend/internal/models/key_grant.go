@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PendingKeyGrant is a team member whose copy of the team key hasn't been
+// encrypted yet, because whoever added them didn't encrypt it at the time. Until
+// it is fulfilled the member can't decrypt the team's projects. Fulfilling the
+// grant deletes it.
+type PendingKeyGrant struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	OrganizationID uuid.UUID `gorm:"type:uuid;not null;index" json:"organizationId"`
+	TeamID         uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_key_grant_member" json:"teamId"`
+	UserID         uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_key_grant_member" json:"userId"`
+	RequestedBy    uuid.UUID `gorm:"type:uuid;not null" json:"requestedBy"`
+
+	Team Team `gorm:"foreignKey:TeamID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	User User `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (g *PendingKeyGrant) BeforeCreate(tx *gorm.DB) (err error) {
+	if g.ID == uuid.Nil {
+		g.ID = uuid.New()
+	}
+	return
+}
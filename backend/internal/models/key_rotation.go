@@ -15,6 +15,9 @@ type PendingKeyRotation struct {
 	Status            string    `gorm:"size:50;default:'pending'" json:"status"` // pending, approved, rejected, expired, stale
 	RequiredApprovals int       `gorm:"default:1" json:"requiredApprovals"`
 	ExpiresAt         time.Time `json:"expiresAt"`
+	RemindersSent     int       `gorm:"not null;default:0" json:"remindersSent"` // reminders approvers got, see handlers.rotationReminderStage
+	Extensions        int       `gorm:"not null;default:0" json:"extensions"`    // times ExpiresAt was pushed back for partial approvals
+	ExpiresIn         int       `gorm:"-" json:"expiresIn"`                      // seconds left to approve, set in responses
 
 	EncryptedConfigsSnapshot string `gorm:"type:text" json:"encryptedConfigsSnapshot"`
 
@@ -26,6 +29,9 @@ type PendingKeyRotation struct {
 	SnapshotTeamIDs              string `gorm:"type:text" json:"snapshotTeamIds"`
 	SnapshotSecretManagerConfIDs string `gorm:"type:text" json:"snapshotSecretManagerConfIds"`
 	SnapshotConfigItemsHash      string `gorm:"type:text" json:"snapshotConfigItemsHash"`
+	SnapshotConfigItemHashes     string `gorm:"type:text" json:"-"` // JSON object of item ID to hash, to tell changed items apart
+
+	RestartedFromID *uuid.UUID `gorm:"type:uuid" json:"restartedFromId,omitempty"` // the stale rotation this one replaced
 
 	Project   Project `gorm:"foreignKey:ProjectID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
 	Initiator User    `gorm:"foreignKey:InitiatedBy" json:"initiator"`
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// KeyRotationPolicy sets the maximum age of project keys in an organization and
+// how long rotations wait for approval. A policy without ProjectID covers every
+// project of the organization; one with ProjectID overrides it for that project.
+type KeyRotationPolicy struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	OrganizationID uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_key_rotation_policy_scope" json:"organizationId"`
+	ProjectID      *uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_key_rotation_policy_scope" json:"projectId"`
+	MaxKeyAgeDays  int        `gorm:"not null" json:"maxKeyAgeDays"` // 0 means no limit
+	WebhookURL     *string    `gorm:"size:500" json:"webhookUrl"`    // notified when a project becomes overdue and when a rotation commits
+
+	ApprovalWindowHours    int `gorm:"not null;default:0" json:"approvalWindowHours"`    // how long rotations wait for approval, 0 means 24
+	MaxApprovalWindowHours int `gorm:"not null;default:0" json:"maxApprovalWindowHours"` // the longest window a rotation may ask for, 0 means the approval window
+	AutoExtendHours        int `gorm:"not null;default:0" json:"autoExtendHours"`        // extension of a partially approved rotation at expiry, 0 means none
+
+	Organization Organization `gorm:"foreignKey:OrganizationID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Project      *Project     `gorm:"foreignKey:ProjectID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	UpdatedByID uuid.UUID `gorm:"type:uuid" json:"updatedById"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (p *KeyRotationPolicy) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return
+}
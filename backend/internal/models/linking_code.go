@@ -7,13 +7,25 @@ import (
 	"gorm.io/gorm"
 )
 
+// LinkingCode is a code shown after signing in in the browser, exchanged by a
+// client for tokens. Code holds the SHA-256 hash of the normalized code, and
+// Selector its first group, which the exchange looks it up by.
 type LinkingCode struct {
 	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	Code      string     `gorm:"size:32;uniqueIndex;not null" json:"code"`
+	Code      string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	Selector  string     `gorm:"size:4;index" json:"-"`
 	UserID    uuid.UUID  `gorm:"type:uuid;not null" json:"userId"`
 	ExpiresAt time.Time  `gorm:"not null" json:"expiresAt"`
 	UsedAt    *time.Time `json:"usedAt"`
 	CreatedAt time.Time  `json:"createdAt"`
+
+	// Wrong attempts at the code; it is locked once they reach the maximum
+	FailedAttempts int        `gorm:"not null;default:0" json:"failedAttempts"`
+	LockedAt       *time.Time `json:"lockedAt"`
+
+	// SSOOrganizationID is the organization whose provider the user signed in
+	// at, nil for GitHub and Google
+	SSOOrganizationID *uuid.UUID `gorm:"type:uuid" json:"ssoOrganizationId"`
 }
 
 func (lc *LinkingCode) BeforeCreate(tx *gorm.DB) (err error) {
@@ -24,19 +36,50 @@ func (lc *LinkingCode) BeforeCreate(tx *gorm.DB) (err error) {
 }
 
 func (lc *LinkingCode) IsValid() bool {
-	return lc.UsedAt == nil && time.Now().Before(lc.ExpiresAt)
+	return lc.UsedAt == nil && lc.LockedAt == nil && time.Now().Before(lc.ExpiresAt)
+}
+
+// LinkingCodeFailure records a failed linking code exchange. Failures from a
+// client address are counted to throttle it; LinkingCodeID and UserID are set
+// when the attempt hit a live code.
+type LinkingCodeFailure struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ClientIP      string     `gorm:"size:45;not null;index:idx_linking_code_failure_client_time" json:"clientIp"`
+	UserAgent     string     `gorm:"size:255" json:"userAgent"`
+	Reason        string     `gorm:"size:16;not null" json:"reason"`
+	LinkingCodeID *uuid.UUID `gorm:"type:uuid" json:"linkingCodeId,omitempty"`
+	UserID        *uuid.UUID `gorm:"type:uuid;index" json:"userId,omitempty"`
+	CreatedAt     time.Time  `gorm:"index:idx_linking_code_failure_client_time" json:"createdAt"`
+}
+
+func (f *LinkingCodeFailure) BeforeCreate(tx *gorm.DB) (err error) {
+	if f.ID == uuid.Nil {
+		f.ID = uuid.New()
+	}
+	return
 }
 
+// RefreshToken is a stored refresh token. Token holds the SHA-256 hash of the
+// opaque token sent to the client, never the token itself.
 type RefreshToken struct {
-	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	Token     string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
-	UserID    uuid.UUID  `gorm:"type:uuid;not null" json:"userId"`
-	User      User       `gorm:"foreignKey:UserID" json:"-"`
-	DeviceID  *uuid.UUID `gorm:"type:uuid" json:"deviceId"`
-	FamilyID  uuid.UUID  `gorm:"type:uuid;not null" json:"familyId"`
-	ExpiresAt time.Time  `gorm:"not null" json:"expiresAt"`
-	RevokedAt *time.Time `json:"revokedAt"` // null -> active
-	CreatedAt time.Time  `json:"createdAt"`
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Token         string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	UserID        uuid.UUID  `gorm:"type:uuid;not null;index" json:"userId"`
+	User          User       `gorm:"foreignKey:UserID" json:"-"`
+	DeviceID      *uuid.UUID `gorm:"type:uuid;index" json:"deviceId"`
+	FamilyID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"familyId"`
+	ExpiresAt     time.Time  `gorm:"not null" json:"expiresAt"`
+	RevokedAt     *time.Time `json:"revokedAt"` // null -> active
+	RevokedReason string     `gorm:"size:16" json:"revokedReason,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+
+	// SSOOrganizationID is the organization whose provider the family's sign-in
+	// went through, nil for GitHub and Google
+	SSOOrganizationID *uuid.UUID `gorm:"type:uuid" json:"ssoOrganizationId"`
+
+	// The client the token was issued to, at sign-in or refresh
+	ClientIP  string `gorm:"size:45" json:"clientIp"`
+	UserAgent string `gorm:"size:255" json:"userAgent"`
 }
 
 func (rt *RefreshToken) BeforeCreate(tx *gorm.DB) (err error) {
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Notification kinds
+const (
+	NotificationKeyRotationOverdue = "key_rotation_overdue"
+	NotificationRecoveryRequested  = "recovery_requested"
+	NotificationTokenAnomaly       = "token_anomaly"
+	NotificationRotationPending    = "rotation_pending"  // to approvers, when a rotation is initiated
+	NotificationRotationReminder   = "rotation_reminder" // to approvers yet to vote, as the rotation nears expiry
+	NotificationRotationExtended   = "rotation_extended" // to the initiator and approvers yet to vote
+	NotificationRotationApproved   = "rotation_approved" // to the initiator
+	NotificationRotationRejected   = "rotation_rejected" // to the initiator
+	NotificationRotationExpired    = "rotation_expired"  // to the initiator
+)
+
+// Notification is an entry in a user's notification center
+type Notification struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID         uuid.UUID  `gorm:"type:uuid;not null;index:idx_notification_user_time" json:"-"`
+	Kind           string     `gorm:"size:50;not null" json:"kind"`
+	Title          string     `gorm:"size:255;not null" json:"title"`
+	Body           string     `gorm:"type:text" json:"body"`
+	OrganizationID *uuid.UUID `gorm:"type:uuid" json:"organizationId,omitempty"`
+	ProjectID      *uuid.UUID `gorm:"type:uuid" json:"projectId,omitempty"`
+	ReadAt         *time.Time `json:"readAt"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	CreatedAt time.Time `gorm:"index:idx_notification_user_time" json:"createdAt"`
+}
+
+func (n *Notification) BeforeCreate(tx *gorm.DB) (err error) {
+	if n.ID == uuid.Nil {
+		n.ID = uuid.New()
+	}
+	return
+}
@@ -27,6 +27,33 @@ type Organization struct {
 	ID   uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
 	Name string    `gorm:"size:255;not null" json:"name"`
 
+	AccessLogLevel         string `gorm:"size:20;not null;default:'full'" json:"accessLogLevel"`
+	AccessLogRetentionDays int    `gorm:"not null;default:90" json:"accessLogRetentionDays"`
+	// ReadAuditRetentionDays is how long file download and config read events
+	// stay in the audit log; the rest of it is kept
+	ReadAuditRetentionDays int `gorm:"not null;default:365" json:"readAuditRetentionDays"`
+	// ConfigTrashRetentionDays is how long deleted config items can be restored
+	// before they are purged
+	ConfigTrashRetentionDays int `gorm:"not null;default:30" json:"configTrashRetentionDays"`
+
+	// AllowedCIDRs limits where members may use the API from; empty allows anywhere
+	AllowedCIDRs []string `gorm:"column:allowed_cidrs;serializer:json;type:text" json:"allowedCidrs"`
+
+	// Maximum token lifetimes for members, shorter than the deployment's; nil
+	// keeps the deployment's
+	AccessTokenLifetimeMinutes *int `json:"accessTokenLifetimeMinutes"`
+	RefreshTokenLifetimeHours  *int `json:"refreshTokenLifetimeHours"`
+
+	// MaxFileSizeBytes caps the encrypted size of uploaded files; nil keeps the
+	// deployment's default
+	MaxFileSizeBytes *int64 `json:"maxFileSizeBytes"`
+	// StorageQuotaBytes caps the total size of the organization's files; nil
+	// is unlimited
+	StorageQuotaBytes *int64 `json:"storageQuotaBytes"`
+
+	// PlanLimits override the instance's usage limits, set by instance administrators
+	PlanLimits PlanLimits `gorm:"embedded;embeddedPrefix:plan_" json:"planLimits"`
+
 	Teams []Team             `json:"teams,omitempty"`
 	Users []OrganizationUser `json:"users,omitempty"`
 
@@ -35,14 +62,25 @@ type Organization struct {
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deletedAt"`
 }
 
+// PlanLimits override the instance's usage limits for one organization. Nil
+// fields keep the instance's limit, 0 is unlimited.
+type PlanLimits struct {
+	MaxProjects         *int   `json:"maxProjects"`
+	MaxMembers          *int   `json:"maxMembers"`
+	MaxTokensPerProject *int   `json:"maxTokensPerProject"` // active CLI tokens
+	MaxStorageBytes     *int64 `json:"maxStorageBytes"`
+}
+
 type OrganizationUser struct {
-	OrganizationID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"organizationId"`
-	UserID                   uuid.UUID `gorm:"type:uuid;primaryKey" json:"userId"`
-	Role                     string    `gorm:"size:50;default:'member'" json:"role"`      // 'owner', 'admin', 'member'
-	EncryptedOrganizationKey *string   `gorm:"type:text" json:"encryptedOrganizationKey"` // only owner + admin have this, encrypted org master key with their pk
+	OrganizationID           uuid.UUID  `gorm:"type:uuid;primaryKey" json:"organizationId"`
+	UserID                   uuid.UUID  `gorm:"type:uuid;primaryKey;index:idx_organization_user_user_role" json:"userId"`
+	Role                     string     `gorm:"size:50;default:'member';index:idx_organization_user_user_role" json:"role"` // 'owner', 'admin', 'member'
+	EncryptedOrganizationKey *string    `gorm:"type:text" json:"encryptedOrganizationKey"` // only owner + admin have this, encrypted org master key with their pk
+	RoleID                   *uuid.UUID `gorm:"type:uuid;index" json:"roleId"`             // custom role replacing the permissions of Role
 
 	Organization Organization `gorm:"foreignKey:OrganizationID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"organization"`
 	User         User         `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"user"`
+	CustomRole   *Role        `gorm:"foreignKey:RoleID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
 
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Organization alert metrics
+const (
+	AlertMetricTokenCount   = "token_count"   // unexpired CLI tokens across the organization's projects
+	AlertMetricStorageBytes = "storage_bytes" // total size of the organization's project files
+	AlertMetricMemberCount  = "member_count"
+	AlertMetricFailedAuth   = "failed_auth" // failed 2FA verifications by members in the last 24 hours
+
+	AlertMetricTokenAnomalies = "token_anomalies" // unacknowledged token usage anomalies
+)
+
+// Organization alert channels
+const (
+	AlertChannelEmail   = "email"
+	AlertChannelWebhook = "webhook"
+)
+
+// OrganizationAlert notifies Target once when Metric reaches Threshold. It is
+// re-armed when the metric drops below the threshold again.
+type OrganizationAlert struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	OrganizationID uuid.UUID `gorm:"type:uuid;index;not null" json:"organizationId"`
+	Metric         string    `gorm:"size:32;not null" json:"metric"`
+	Threshold      int64     `gorm:"not null" json:"threshold"`
+	Channel        string    `gorm:"size:20;not null" json:"channel"` // email, webhook
+	Target         string    `gorm:"size:500;not null" json:"target"` // email address or https URL
+	Enabled        bool      `gorm:"not null" json:"enabled"`
+
+	Triggered       bool       `gorm:"not null;default:false" json:"triggered"`
+	LastValue       *int64     `json:"lastValue"`
+	LastEvaluatedAt *time.Time `json:"lastEvaluatedAt"`
+	LastTriggeredAt *time.Time `json:"lastTriggeredAt"`
+	LastNotifyError *string    `gorm:"type:text" json:"lastNotifyError"`
+
+	Organization Organization `gorm:"foreignKey:OrganizationID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	CreatedByID uuid.UUID `gorm:"type:uuid" json:"createdById"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (a *OrganizationAlert) BeforeCreate(tx *gorm.DB) (err error) {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OrganizationSSO is an organization's own OpenID Connect provider
+type OrganizationSSO struct {
+	OrganizationID uuid.UUID `gorm:"type:uuid;primaryKey" json:"organizationId"`
+	Issuer         string    `gorm:"size:500;not null" json:"issuer"`
+	ClientID       string    `gorm:"size:255;not null" json:"clientId"`
+	ClientSecret   string    `gorm:"size:1024;not null" json:"-"`
+	// RequireSSO refuses GitHub and Google sign-ins of the organization's members,
+	// and refreshing sessions that didn't start at this provider
+	RequireSSO bool `gorm:"default:false;not null" json:"requireSso"`
+
+	Organization Organization `gorm:"foreignKey:OrganizationID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// UserSSOIdentity links the subject of an organization's provider to an account
+type UserSSOIdentity struct {
+	OrganizationID uuid.UUID  `gorm:"type:uuid;primaryKey" json:"organizationId"`
+	Subject        string     `gorm:"size:255;primaryKey" json:"subject"`
+	UserID         uuid.UUID  `gorm:"type:uuid;not null;index" json:"userId"`
+	LastLoginAt    *time.Time `json:"lastLoginAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,10 +12,29 @@ import (
 type Project struct {
 	ID             uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
 	Name           string    `gorm:"size:255;not null" json:"name"`
+	Slug           string    `gorm:"size:100;uniqueIndex" json:"slug"` // set at creation, kept across renames
 	OrganizationID uuid.UUID `gorm:"type:uuid;index" json:"organizationId"`
 
 	KeyVersion     int     `gorm:"default:1" json:"keyVersion"`
 	ConfigChecksum *string `gorm:"size:64" json:"configChecksum"`
+	// LegacyConfigChecksum is the config checksum in version 1, served next to
+	// ConfigChecksum while clients move to version 2
+	LegacyConfigChecksum *string `gorm:"size:64" json:"-"`
+
+	KeyRotatedAt         *time.Time `json:"keyRotatedAt"`         // last committed rotation, nil before the first
+	KeyRotationOverdueAt *time.Time `json:"keyRotationOverdueAt"` // when the key outgrew its policy, cleared by a rotation
+
+	// Set when someone who could decrypt the key lost access, cleared by a rotation
+	KeyRotationRequiredAt     *time.Time `json:"keyRotationRequiredAt"`
+	KeyRotationRequiredReason *string    `gorm:"size:255" json:"keyRotationRequiredReason"`
+
+	// Sensitive values are only returned to members with secrets.reveal and
+	// tokens with that scope
+	RestrictSensitive bool `gorm:"default:false" json:"restrictSensitive"`
+
+	// Sandbox projects hold generated test data: they can't link secret managers
+	// and don't count toward usage. Set at creation only.
+	Sandbox bool `gorm:"default:false;not null" json:"sandbox"`
 
 	CreatedAt            time.Time             `json:"createdAt"`
 	UpdatedAt            time.Time             `json:"updatedAt"`
@@ -25,5 +46,94 @@ func (p *Project) BeforeCreate(tx *gorm.DB) (err error) {
 	if p.ID == uuid.Nil {
 		p.ID = uuid.New()
 	}
+	if p.Slug == "" {
+		err = p.AssignSlug(tx)
+	}
+	return
+}
+
+var slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugBase turns a project name into a slug, e.g. "My API (prod)" into "my-api-prod"
+func slugBase(name string) string {
+	slug := strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if len(slug) > 60 {
+		slug = strings.TrimRight(slug[:60], "-")
+	}
+	// A slug must never be mistaken for a project ID
+	if _, err := uuid.Parse(slug); slug == "" || err == nil {
+		slug = "project-" + slug
+	}
+	return strings.TrimRight(slug, "-")
+}
+
+// AssignSlug derives the project's slug from its name, suffixed with the start
+// of its ID when another project already uses it
+func (p *Project) AssignSlug(tx *gorm.DB) error {
+	slug := slugBase(p.Name)
+
+	var count int64
+	if err := tx.Session(&gorm.Session{NewDB: true}).Unscoped().
+		Model(&Project{}).Where("slug = ?", slug).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		slug += "-" + p.ID.String()[:8]
+	}
+	p.Slug = slug
+	return nil
+}
+
+// PendingProjectDeletion is a blocked request to delete a project that still has
+// active tokens or recent CLI reads. Another user who can delete the project
+// confirms it by deleting the project before ExpiresAt.
+type PendingProjectDeletion struct {
+	ProjectID   uuid.UUID `gorm:"type:uuid;primaryKey" json:"projectId"`
+	RequestedBy uuid.UUID `gorm:"type:uuid;not null" json:"requestedBy"`
+	ExpiresAt   time.Time `gorm:"not null" json:"expiresAt"`
+
+	Project Project `gorm:"foreignKey:ProjectID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ProjectRename records a change of a project's display name
+type ProjectRename struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ProjectID uuid.UUID `gorm:"type:uuid;index;not null" json:"projectId"`
+	OldName   string    `gorm:"size:255;not null" json:"oldName"`
+	NewName   string    `gorm:"size:255;not null" json:"newName"`
+	RenamedBy uuid.UUID `gorm:"type:uuid;not null" json:"renamedBy"`
+
+	Project Project `gorm:"foreignKey:ProjectID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Renamer User    `gorm:"foreignKey:RenamedBy" json:"renamer"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (r *ProjectRename) BeforeCreate(tx *gorm.DB) (err error) {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
 	return
 }
+
+// ProjectTag is a free-form tag on a project, such as "backend" or "prod", to
+// find it by in search
+type ProjectTag struct {
+	ProjectID uuid.UUID `gorm:"type:uuid;primaryKey" json:"projectId"`
+	Name      string    `gorm:"size:50;primaryKey;index" json:"name"`
+
+	Project Project `gorm:"foreignKey:ProjectID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// ProjectFavorite marks a project a user pinned to the top of their lists
+type ProjectFavorite struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey" json:"userId"`
+	ProjectID uuid.UUID `gorm:"type:uuid;primaryKey;index" json:"projectId"`
+
+	User    User    `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Project Project `gorm:"foreignKey:ProjectID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Types a schema variable or config item can require of its value. The server
+// never sees values, so clients check them.
+const (
+	VariableTypeString  = "string"
+	VariableTypeNumber  = "number"
+	VariableTypeBoolean = "boolean"
+	VariableTypeURL     = "url"
+	VariableTypeJSON    = "json"
+)
+
+// VariableTypes lists the valid ProjectSchemaVariable and ConfigItem value types
+var VariableTypes = []string{VariableTypeString, VariableTypeNumber, VariableTypeBoolean, VariableTypeURL, VariableTypeJSON}
+
+// IsVariableType reports whether t is one of VariableTypes
+func IsVariableType(t string) bool {
+	return slices.Contains(VariableTypes, t)
+}
+
+// ProjectSchemaVariable is a config item a project must define, such as
+// DATABASE_URL. Type and Pattern are hints for clients checking the decrypted
+// value.
+type ProjectSchemaVariable struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ProjectID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_project_schema_variable_name" json:"projectId"`
+	Name        string    `gorm:"size:255;not null;uniqueIndex:idx_project_schema_variable_name" json:"name"`
+	Type        string    `gorm:"size:20;not null;default:'string'" json:"type"`
+	Pattern     *string   `gorm:"size:500" json:"pattern"` // a Go regular expression the whole value must match
+	Description *string   `gorm:"size:500" json:"description"`
+	Position    int       `gorm:"not null;default:0" json:"position"`
+
+	Project Project `gorm:"foreignKey:ProjectID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (v *ProjectSchemaVariable) BeforeCreate(tx *gorm.DB) (err error) {
+	if v.ID == uuid.Nil {
+		v.ID = uuid.New()
+	}
+	return
+}
@@ -1,12 +1,19 @@
 package models
 
 import (
+	"net/netip"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// Token scopes, granted at creation on top of reading the project's config
+const (
+	TokenScopeSecretsReveal = PermissionSecretsReveal // read sensitive values of a project that restricts them
+	TokenScopeFilesWrite    = PermissionFilesWrite    // upload project files
+)
+
 type ProjectToken struct {
 	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
 	ProjectID uuid.UUID `gorm:"type:uuid;index;not null" json:"projectId"`
@@ -15,10 +22,19 @@ type ProjectToken struct {
 	TokenPrefix         string `gorm:"size:10;not null" json:"tokenPrefix"`          // first 3 chars after "envie_"
 	IdentityIDHash      string `gorm:"size:64;uniqueIndex;not null" json:"-"`        // SHA256 of derived identity ID
 	EncryptedProjectKey string `gorm:"type:text;not null" json:"-"`                  // project key encrypted to token's public key
+	EnvelopeVersion     int    `gorm:"default:1" json:"envelopeVersion"`           // 1 = X25519, 2 = hybrid X25519 + ML-KEM-768
 
 	ExpiresAt  *time.Time `gorm:"index" json:"expiresAt"`
 	LastUsedAt *time.Time `json:"lastUsedAt"`
 
+	Scopes []string `gorm:"serializer:json;type:text" json:"scopes"` // TokenScope* values
+
+	// Client address ranges the token may be used from, any address when empty
+	AllowedCIDRs []string `gorm:"column:allowed_cidrs;serializer:json;type:text" json:"allowedCidrs"`
+
+	// Set when the token was rotated; it stays valid until the grace window ends
+	ReplacedByID *uuid.UUID `gorm:"type:uuid" json:"replacedById"`
+
 	CreatedBy uuid.UUID `gorm:"type:uuid;not null" json:"createdBy"`
 	Creator   User      `gorm:"foreignKey:CreatedBy" json:"creator"`
 
@@ -42,3 +58,30 @@ func (t *ProjectToken) IsExpired() bool {
 	}
 	return time.Now().After(*t.ExpiresAt)
 }
+
+func (t *ProjectToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAddress reports whether the token may be used from the client address ip
+func (t *ProjectToken) AllowsAddress(ip string) bool {
+	if len(t.AllowedCIDRs) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, cidr := range t.AllowedCIDRs {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PublicShare publishes the plaintext of chosen non-sensitive config items at a
+// signed URL, for build pipelines that can't hold a CLI token. The server can't
+// decrypt config, so the plaintext is supplied by a member when publishing.
+type PublicShare struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ProjectID uuid.UUID `gorm:"type:uuid;index;not null" json:"projectId"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+
+	// JSON array of {name, value, sourceHash}; sourceHash is the SHA-256 of the
+	// encrypted value the plaintext was published from
+	Items string `gorm:"type:text;not null" json:"-"`
+
+	ExpiresAt      *time.Time `json:"expiresAt"`
+	LastAccessedAt *time.Time `json:"lastAccessedAt"`
+
+	Project Project `gorm:"foreignKey:ProjectID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	CreatedByID uuid.UUID `gorm:"type:uuid" json:"createdById"`
+	UpdatedByID uuid.UUID `gorm:"type:uuid" json:"updatedById"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (s *PublicShare) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return
+}
+
+func (s *PublicShare) IsExpired() bool {
+	if s.ExpiresAt == nil {
+		return false
+	}
+	return time.Now().After(*s.ExpiresAt)
+}
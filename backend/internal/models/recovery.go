@@ -0,0 +1,131 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Recovery request statuses
+const (
+	RecoveryPending   = "pending"   // waiting for officers to release their shares
+	RecoveryApproved  = "approved"  // enough shares were released, the requester can collect them
+	RecoveryCompleted = "completed" // the requester stored the recovered organization key
+	RecoveryCancelled = "cancelled"
+	RecoveryExpired   = "expired"
+)
+
+// Recovery audit actions
+const (
+	RecoveryEventEscrowConfigured = "escrow_configured"
+	RecoveryEventEscrowRemoved    = "escrow_removed"
+	RecoveryEventRequested        = "requested"
+	RecoveryEventShareReleased    = "share_released"
+	RecoveryEventSharesCollected  = "shares_collected"
+	RecoveryEventCompleted        = "completed"
+	RecoveryEventCancelled        = "cancelled"
+)
+
+// RecoveryEscrow is an organization's break-glass escrow: the organization
+// master key split by a client into Shamir shares, any Threshold of which
+// rebuild it. Each share is encrypted to one recovery officer's public key, so
+// the server never sees the key or a share.
+type RecoveryEscrow struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	OrganizationID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex" json:"organizationId"`
+	Threshold      int       `gorm:"not null" json:"threshold"`
+	CreatedBy      uuid.UUID `gorm:"type:uuid;not null" json:"createdBy"`
+
+	Organization Organization    `gorm:"foreignKey:OrganizationID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Shares       []RecoveryShare `gorm:"foreignKey:EscrowID" json:"-"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (e *RecoveryEscrow) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return
+}
+
+// RecoveryShare is one officer's share of the escrowed key
+type RecoveryShare struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	EscrowID       uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_recovery_share_officer" json:"escrowId"`
+	OfficerID      uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_recovery_share_officer" json:"officerId"`
+	ShareIndex     int       `gorm:"not null" json:"shareIndex"`               // the x coordinate of the share, 1-255
+	EncryptedShare string    `gorm:"type:text;not null" json:"encryptedShare"` // encrypted with the officer's public key
+
+	Escrow  RecoveryEscrow `gorm:"foreignKey:EscrowID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Officer User           `gorm:"foreignKey:OfficerID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+func (s *RecoveryShare) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return
+}
+
+// RecoveryRequest asks the officers of an escrow to release their shares to an
+// organization owner or admin who lost the organization key
+type RecoveryRequest struct {
+	ID                 uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	OrganizationID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"organizationId"`
+	EscrowID           uuid.UUID  `gorm:"type:uuid;not null;index" json:"escrowId"`
+	RequestedBy        uuid.UUID  `gorm:"type:uuid;not null" json:"requestedBy"`
+	RequesterPublicKey string     `gorm:"type:text;not null" json:"requesterPublicKey"` // officers encrypt released shares to this key
+	Reason             string     `gorm:"size:500" json:"reason"`
+	Status             string     `gorm:"size:20;not null;default:'pending'" json:"status"`
+	ExpiresAt          time.Time  `json:"expiresAt"`
+	CompletedAt        *time.Time `json:"completedAt"`
+
+	Escrow    RecoveryEscrow     `gorm:"foreignKey:EscrowID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Approvals []RecoveryApproval `gorm:"foreignKey:RequestID" json:"-"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (r *RecoveryRequest) BeforeCreate(tx *gorm.DB) (err error) {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return
+}
+
+// RecoveryApproval is an officer's share, re-encrypted by their client to the
+// requester's public key
+type RecoveryApproval struct {
+	RequestID      uuid.UUID `gorm:"type:uuid;primaryKey" json:"requestId"`
+	OfficerID      uuid.UUID `gorm:"type:uuid;primaryKey" json:"officerId"`
+	ShareIndex     int       `gorm:"not null" json:"shareIndex"`
+	EncryptedShare string    `gorm:"type:text;not null" json:"encryptedShare"`
+
+	Request RecoveryRequest `gorm:"foreignKey:RequestID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// RecoveryEvent is an entry in an organization's recovery audit trail. It
+// outlives the escrow and requests it refers to.
+type RecoveryEvent struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	OrganizationID uuid.UUID  `gorm:"type:uuid;not null;index:idx_recovery_event_org_time" json:"organizationId"`
+	RequestID      *uuid.UUID `gorm:"type:uuid" json:"requestId"`
+	ActorID        uuid.UUID  `gorm:"type:uuid;not null" json:"actorId"`
+	Action         string     `gorm:"size:50;not null" json:"action"`
+	Detail         string     `gorm:"size:500" json:"detail"`
+
+	Organization Organization `gorm:"foreignKey:OrganizationID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	CreatedAt time.Time `gorm:"index:idx_recovery_event_org_time" json:"createdAt"`
+}
+
+func (e *RecoveryEvent) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Permissions granted by roles
+const (
+	PermissionProjectCreate   = "project.create"
+	PermissionProjectDelete   = "project.delete"
+	PermissionConfigWrite     = "config.write"
+	PermissionTokenManage     = "token.manage"
+	PermissionFilesWrite      = "files.write"
+	PermissionRotationApprove = "rotation.approve"
+	PermissionMembersManage   = "members.manage"
+	PermissionSecretsReveal   = "secrets.reveal" // read sensitive values of projects that restrict them
+)
+
+// AllPermissions lists every permission a role can grant
+var AllPermissions = []string{
+	PermissionProjectCreate,
+	PermissionProjectDelete,
+	PermissionConfigWrite,
+	PermissionTokenManage,
+	PermissionFilesWrite,
+	PermissionRotationApprove,
+	PermissionMembersManage,
+	PermissionSecretsReveal,
+}
+
+// BuiltinRolePermissions are the permissions of the built-in roles, the same for
+// organization and team membership. Only owners can delete projects.
+var BuiltinRolePermissions = map[string][]string{
+	"owner": AllPermissions,
+	"admin": {
+		PermissionProjectCreate,
+		PermissionConfigWrite,
+		PermissionTokenManage,
+		PermissionFilesWrite,
+		PermissionRotationApprove,
+		PermissionMembersManage,
+		PermissionSecretsReveal,
+	},
+	"member": {},
+}
+
+// Role scopes
+const (
+	RoleScopeOrganization = "organization" // assigned to organization members, applies to all their projects
+	RoleScopeTeam         = "team"         // assigned to team members, applies to the team and its projects
+)
+
+// Role is a custom role of an organization. A member assigned one has its
+// permissions instead of those of their built-in role, which still decides who
+// holds the organization key. Owners always keep every permission.
+type Role struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	OrganizationID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_role_name" json:"organizationId"`
+	Name           string    `gorm:"size:50;not null;uniqueIndex:idx_role_name" json:"name"`
+	Scope          string    `gorm:"size:20;not null" json:"scope"`
+	Description    *string   `gorm:"size:255" json:"description"`
+	Permissions    []string  `gorm:"type:text;serializer:json;not null" json:"permissions"`
+
+	Organization Organization `gorm:"foreignKey:OrganizationID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (r *Role) BeforeCreate(tx *gorm.DB) (err error) {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return
+}
@@ -36,21 +36,25 @@ type Team struct {
 }
 
 type TeamUser struct {
-	TeamID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"teamId"`
-	UserID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"userId"`
-	EncryptedTeamKey string    `gorm:"type:text;not null" json:"encryptedTeamKey"` // encrypted with user mk
-	Role             string    `gorm:"size:50;default:'member'" json:"role"`
+	// The primary key leads with the team, access checks start from the user
+	TeamID           uuid.UUID  `gorm:"type:uuid;primaryKey;index:idx_team_user_user_team,priority:2" json:"teamId"`
+	UserID           uuid.UUID  `gorm:"type:uuid;primaryKey;index:idx_team_user_user_team,priority:1" json:"userId"`
+	EncryptedTeamKey string     `gorm:"type:text;not null" json:"encryptedTeamKey"` // encrypted with user mk
+	Role             string     `gorm:"size:50;default:'member'" json:"role"`
+	RoleID           *uuid.UUID `gorm:"type:uuid;index" json:"roleId"` // custom role replacing the permissions of Role
 
-	Team Team `gorm:"foreignKey:TeamID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"team"`
-	User User `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"user"`
+	Team       Team  `gorm:"foreignKey:TeamID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"team"`
+	User       User  `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"user"`
+	CustomRole *Role `gorm:"foreignKey:RoleID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
 
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
 
 type TeamProject struct {
-	TeamID              uuid.UUID `gorm:"type:uuid;primaryKey" json:"teamId"`
-	ProjectID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"projectId"`
+	// The primary key leads with the team, access checks start from the project
+	TeamID              uuid.UUID `gorm:"type:uuid;primaryKey;index:idx_team_project_project_team,priority:2" json:"teamId"`
+	ProjectID           uuid.UUID `gorm:"type:uuid;primaryKey;index:idx_team_project_project_team,priority:1" json:"projectId"`
 	EncryptedProjectKey string    `gorm:"type:text;not null" json:"encryptedProjectKey"` // encrypted with decrypted team key
 
 	Team    Team    `gorm:"foreignKey:TeamID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"team"`
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Token anomaly kinds
+const (
+	TokenAnomalyNewNetwork  = "new_network"  // first use from a network the token wasn't used from before
+	TokenAnomalyVolumeSpike = "volume_spike" // requests in an hour far above the token's usual rate
+	TokenAnomalyDormantUse  = "dormant_use"  // first use after a long dormancy
+)
+
+// TokenAnomaly is unusual use of a CLI token, kept until someone acknowledges it
+type TokenAnomaly struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	OrganizationID uuid.UUID `gorm:"type:uuid;not null;index" json:"organizationId"`
+	ProjectID      uuid.UUID `gorm:"type:uuid;not null;index:idx_token_anomaly_project_time" json:"projectId"`
+	TokenID        uuid.UUID `gorm:"type:uuid;not null;index" json:"tokenId"`
+	TokenName      string    `gorm:"size:255;not null" json:"tokenName"`
+	Kind           string    `gorm:"size:32;not null" json:"kind"`
+	Detail         string    `gorm:"size:500" json:"detail"`
+	ClientIP       string    `gorm:"size:45" json:"clientIp"`
+
+	AcknowledgedAt   *time.Time `json:"acknowledgedAt"`
+	AcknowledgedByID *uuid.UUID `gorm:"type:uuid" json:"acknowledgedById"`
+
+	Project Project `gorm:"foreignKey:ProjectID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	CreatedAt time.Time `gorm:"index:idx_token_anomaly_project_time" json:"createdAt"`
+}
+
+func (a *TokenAnomaly) BeforeCreate(tx *gorm.DB) (err error) {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return
+}
+
+// TokenNetwork is a network a CLI token was used from, the baseline new networks
+// are compared against
+type TokenNetwork struct {
+	TokenID     uuid.UUID `gorm:"type:uuid;primaryKey" json:"tokenId"`
+	Network     string    `gorm:"size:64;primaryKey" json:"network"` // e.g. 203.0.113.0/24
+	FirstSeenAt time.Time `gorm:"not null" json:"firstSeenAt"`
+}
+
+// TokenUsageBucket counts a CLI token's requests in one hour
+type TokenUsageBucket struct {
+	TokenID uuid.UUID `gorm:"type:uuid;primaryKey" json:"tokenId"`
+	Hour    time.Time `gorm:"primaryKey" json:"hour"`
+	Count   int64     `gorm:"not null;default:0" json:"count"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RecoveryCode is a single-use 2FA recovery code. CodeHash holds the SHA-256 hash
+// of the code shown to the user once, never the code itself.
+type RecoveryCode struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"userId"`
+	CodeHash  string     `gorm:"size:64;not null;index" json:"-"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+func (rc *RecoveryCode) BeforeCreate(tx *gorm.DB) (err error) {
+	if rc.ID == uuid.Nil {
+		rc.ID = uuid.New()
+	}
+	return
+}
+
+// TwoFactorEvent is the audit trail of 2FA enrollment and verification
+type TwoFactorEvent struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index:idx_two_factor_event_user_time" json:"userId"`
+	Event     string    `gorm:"size:32;not null" json:"event"`
+	Action    string    `gorm:"size:64" json:"action,omitempty"` // sensitive operation the code was checked for
+	IPAddress string    `gorm:"size:64" json:"ipAddress"`
+	UserAgent string    `gorm:"size:512" json:"userAgent"`
+	CreatedAt time.Time `gorm:"index:idx_two_factor_event_user_time" json:"createdAt"`
+}
+
+func (e *TwoFactorEvent) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return
+}
@@ -16,11 +16,23 @@ type User struct {
 	GoogleID         string         `gorm:"uniqueIndex" json:"googleId"`
 	PublicKey        *string        `gorm:"type:text" json:"publicKey"`
 	MasterKeyVersion int            `gorm:"default:1" json:"masterKeyVersion"`
+	TwoFactorEnabled bool           `gorm:"default:false" json:"twoFactorEnabled"`
+	TOTPSecret       *string        `gorm:"size:64" json:"-"`   // set while enrolling and once enabled
+	TOTPLastStep     int64          `gorm:"default:0" json:"-"` // last accepted time step, against replays
 	CreatedAt        time.Time      `json:"createdAt"`
 	UpdatedAt        time.Time      `json:"updatedAt"`
 	DeletedAt        gorm.DeletedAt `gorm:"index" json:"deletedAt"`
+	PurgedAt         *time.Time     `json:"-"` // personal data erased after the deletion grace period
+
+	// Set by instance administrators. A disabled account can't sign in and its
+	// sessions are refused.
+	InstanceRole string     `gorm:"size:20;not null;default:''" json:"instanceRole"` // "" or superadmin
+	DisabledAt   *time.Time `json:"disabledAt,omitempty"`
 }
 
+// Instance roles
+const InstanceRoleSuperadmin = "superadmin"
+
 func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
 	if u.ID == uuid.Nil {
 		u.ID = uuid.New()
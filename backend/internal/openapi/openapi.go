@@ -0,0 +1,215 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"envie-backend/internal/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Security schemes used by the API
+const (
+	SecurityBearer      = "bearerAuth"  // user JWT (Authorization header or auth_token cookie)
+	SecurityCLIIdentity = "cliIdentity" // X-CLI-Identity header derived from a project token
+)
+
+// Operation describes a single handler. Request and Response are zero values of the
+// actual request/response types, e.g. CreateProjectRequest{} - schemas are generated
+// from their json and binding tags.
+type Operation struct {
+	Summary     string
+	Description string
+	Tag         string
+	Request     any
+	Response    any
+	Status      int // success status, defaults to 200
+	Parameters  []Parameter
+	Security    string // defaults to SecurityBearer
+	Public      bool   // no authentication
+	Deprecated  bool
+}
+
+type Parameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required"`
+	Schema      Schema `json:"schema"`
+}
+
+// QueryParam is a shorthand for a string query parameter
+func QueryParam(name, description string, required bool) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Required: required, Schema: Schema{Type: "string"}}
+}
+
+// Generator builds an OpenAPI 3 document from gin's route table and operation metadata
+// registered per handler function.
+type Generator struct {
+	title      string
+	version    string
+	operations map[string]Operation
+	schemas    *schemaRegistry
+}
+
+func NewGenerator(title, version string) *Generator {
+	return &Generator{
+		title:      title,
+		version:    version,
+		operations: make(map[string]Operation),
+		schemas:    newSchemaRegistry(),
+	}
+}
+
+// Describe attaches metadata to a handler. Routes whose handler has no metadata
+// are left out of the document.
+func (g *Generator) Describe(handler gin.HandlerFunc, op Operation) {
+	g.operations[handlerName(handler)] = op
+}
+
+// Build generates the document for the given routes (usually router.Routes())
+func (g *Generator) Build(routes gin.RoutesInfo) *Document {
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info:    Info{Title: g.title, Version: g.version},
+		Paths:   make(map[string]PathItem),
+		Components: Components{
+			Schemas: g.schemas.schemas,
+			SecuritySchemes: map[string]SecurityScheme{
+				SecurityBearer:      {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+				SecurityCLIIdentity: {Type: "apiKey", In: "header", Name: "X-CLI-Identity"},
+			},
+		},
+	}
+
+	sorted := make(gin.RoutesInfo, len(routes))
+	copy(sorted, routes)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Path != sorted[j].Path {
+			return sorted[i].Path < sorted[j].Path
+		}
+		return sorted[i].Method < sorted[j].Method
+	})
+
+	tags := map[string]bool{}
+	for _, route := range sorted {
+		op, ok := g.operations[route.Handler]
+		if !ok {
+			continue
+		}
+
+		path, params := convertPath(route.Path)
+		item := doc.Paths[path]
+		if item == nil {
+			item = PathItem{}
+			doc.Paths[path] = item
+		}
+
+		item[strings.ToLower(route.Method)] = g.buildOperation(route, op, params)
+		if op.Tag != "" {
+			tags[op.Tag] = true
+		}
+	}
+
+	for tag := range tags {
+		doc.Tags = append(doc.Tags, Tag{Name: tag})
+	}
+	sort.Slice(doc.Tags, func(i, j int) bool { return doc.Tags[i].Name < doc.Tags[j].Name })
+
+	return doc
+}
+
+// Undescribed returns the routes whose handler has no metadata
+func (g *Generator) Undescribed(routes gin.RoutesInfo) gin.RoutesInfo {
+	var missing gin.RoutesInfo
+	for _, route := range routes {
+		if _, ok := g.operations[route.Handler]; !ok {
+			missing = append(missing, route)
+		}
+	}
+	return missing
+}
+
+func (g *Generator) buildOperation(route gin.RouteInfo, op Operation, params []Parameter) *OperationObject {
+	name := route.Handler[strings.LastIndex(route.Handler, ".")+1:]
+	result := &OperationObject{
+		OperationID: name,
+		Summary:     op.Summary,
+		Description: op.Description,
+		Deprecated:  op.Deprecated,
+		Parameters:  append(params, op.Parameters...),
+		Responses:   map[string]Response{},
+	}
+	if op.Tag != "" {
+		result.Tags = []string{op.Tag}
+	}
+
+	if !op.Public {
+		security := op.Security
+		if security == "" {
+			security = SecurityBearer
+		}
+		result.Security = []map[string][]string{{security: {}}}
+	}
+
+	if op.Request != nil {
+		result.RequestBody = &RequestBody{
+			Required: true,
+			Content: map[string]MediaType{
+				"application/json": {Schema: g.schemas.schemaFor(reflect.TypeOf(op.Request))},
+			},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := Response{Description: http.StatusText(status)}
+	if op.Response != nil && status != http.StatusNoContent {
+		success.Content = map[string]MediaType{
+			"application/json": {Schema: g.schemas.schemaFor(reflect.TypeOf(op.Response))},
+		}
+	}
+	result.Responses[strconv.Itoa(status)] = success
+
+	errorSchema := g.schemas.schemaFor(reflect.TypeOf(ErrorResponse{}))
+	result.Responses["default"] = Response{
+		Description: "Error",
+		Content:     map[string]MediaType{"application/json": {Schema: errorSchema}},
+	}
+
+	return result
+}
+
+// ErrorResponse is the body of every error response: a message for people and a
+// stable code for programs (see package apierror)
+type ErrorResponse struct {
+	Error string `json:"error" binding:"required"`
+	Code  string `json:"code" binding:"required"`
+	// Fields lists what failed in a request rejected with ENVIE_VALIDATION_FAILED
+	Fields []validation.FieldError `json:"fields,omitempty"`
+}
+
+// convertPath turns a gin path (/projects/:id) into an OpenAPI path (/projects/{id})
+func convertPath(path string) (string, []Parameter) {
+	segments := strings.Split(path, "/")
+	var params []Parameter
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			name := segment[1:]
+			segments[i] = "{" + name + "}"
+			params = append(params, Parameter{Name: name, In: "path", Required: true, Schema: Schema{Type: "string"}})
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func handlerName(handler gin.HandlerFunc) string {
+	return runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+}
@@ -0,0 +1,253 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type testItem struct {
+	ID        uuid.UUID      `json:"id"`
+	Name      string         `json:"name" binding:"required"`
+	Note      *string        `json:"note"`
+	Tags      []string       `json:"tags,omitempty" binding:"required"`
+	Data      []byte         `json:"data"`
+	CreatedAt time.Time      `json:"createdAt"`
+	Parent    *testItem      `json:"parent"`
+	Labels    map[string]int `json:"labels"`
+	internal  string
+	Skipped   string `json:"-"`
+}
+
+type testBase struct {
+	Version int `json:"version"`
+}
+
+type testEmbedding struct {
+	testBase
+	Title string `json:"title"`
+}
+
+type testRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+func listItems(c *gin.Context)   {}
+func createItem(c *gin.Context)  {}
+func deleteItem(c *gin.Context)  {}
+func getVersion(c *gin.Context)  {}
+func undescribed(c *gin.Context) {}
+
+func testRoutes() gin.RoutesInfo {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/items", listItems)
+	r.POST("/items", createItem)
+	r.DELETE("/items/:id", deleteItem)
+	r.GET("/files/*path", getVersion)
+	r.GET("/internal", undescribed)
+	return r.Routes()
+}
+
+func testGenerator() *Generator {
+	g := NewGenerator("Test API", "1.2.3")
+	g.Describe(listItems, Operation{Tag: "items", Summary: "List items", Response: []testItem{}, Public: true})
+	g.Describe(createItem, Operation{Tag: "items", Summary: "Create an item", Request: testRequest{}, Response: testItem{}, Status: http.StatusCreated})
+	g.Describe(deleteItem, Operation{Tag: "items", Summary: "Delete an item", Response: testItem{}, Status: http.StatusNoContent, Security: SecurityCLIIdentity, Deprecated: true})
+	g.Describe(getVersion, Operation{Tag: "files", Response: testEmbedding{}, Parameters: []Parameter{QueryParam("at", "Point in time", false)}})
+	return g
+}
+
+func TestBuildSkipsUndescribedRoutes(t *testing.T) {
+	doc := testGenerator().Build(testRoutes())
+
+	if _, ok := doc.Paths["/internal"]; ok {
+		t.Error("undescribed route was included in the spec")
+	}
+	if len(doc.Paths) != 3 {
+		t.Errorf("got %d paths, want 3", len(doc.Paths))
+	}
+	if doc.OpenAPI != "3.0.3" || doc.Info.Title != "Test API" || doc.Info.Version != "1.2.3" {
+		t.Errorf("unexpected document header: %+v %+v", doc.OpenAPI, doc.Info)
+	}
+	if got := []Tag{{Name: "files"}, {Name: "items"}}; !reflect.DeepEqual(doc.Tags, got) {
+		t.Errorf("tags = %v, want %v", doc.Tags, got)
+	}
+}
+
+func TestUndescribed(t *testing.T) {
+	missing := testGenerator().Undescribed(testRoutes())
+	if len(missing) != 1 || missing[0].Path != "/internal" {
+		t.Fatalf("Undescribed = %v, want only /internal", missing)
+	}
+}
+
+func TestBuildPathParameters(t *testing.T) {
+	doc := testGenerator().Build(testRoutes())
+
+	op := doc.Paths["/items/{id}"]["delete"]
+	if op == nil {
+		t.Fatal("missing DELETE /items/{id}")
+	}
+	if len(op.Parameters) != 1 || op.Parameters[0].Name != "id" || op.Parameters[0].In != "path" || !op.Parameters[0].Required {
+		t.Errorf("parameters = %+v, want required path parameter id", op.Parameters)
+	}
+
+	op = doc.Paths["/files/{path}"]["get"]
+	if op == nil {
+		t.Fatal("missing GET /files/{path}")
+	}
+	if len(op.Parameters) != 2 || op.Parameters[0].Name != "path" || op.Parameters[1].Name != "at" || op.Parameters[1].In != "query" {
+		t.Errorf("parameters = %+v, want path then query parameter", op.Parameters)
+	}
+}
+
+func TestBuildOperation(t *testing.T) {
+	doc := testGenerator().Build(testRoutes())
+
+	list := doc.Paths["/items"]["get"]
+	if list.OperationID != "listItems" {
+		t.Errorf("operationId = %q, want listItems", list.OperationID)
+	}
+	if list.Security != nil {
+		t.Errorf("public operation has security %v", list.Security)
+	}
+	if schema := list.Responses["200"].Content["application/json"].Schema; schema.Type != "array" || schema.Items.Ref != "#/components/schemas/testItem" {
+		t.Errorf("list response schema = %+v", schema)
+	}
+
+	create := doc.Paths["/items"]["post"]
+	if !reflect.DeepEqual(create.Security, []map[string][]string{{SecurityBearer: {}}}) {
+		t.Errorf("security = %v, want bearer by default", create.Security)
+	}
+	if create.RequestBody == nil || !create.RequestBody.Required {
+		t.Fatal("missing required request body")
+	}
+	if _, ok := create.Responses["201"]; !ok {
+		t.Errorf("responses = %v, want 201", create.Responses)
+	}
+	if def := create.Responses["default"]; def.Content["application/json"].Schema.Ref != "#/components/schemas/ErrorResponse" {
+		t.Errorf("default response = %+v, want ErrorResponse", def)
+	}
+
+	del := doc.Paths["/items/{id}"]["delete"]
+	if !del.Deprecated {
+		t.Error("operation not marked deprecated")
+	}
+	if !reflect.DeepEqual(del.Security, []map[string][]string{{SecurityCLIIdentity: {}}}) {
+		t.Errorf("security = %v, want CLI identity", del.Security)
+	}
+	if resp := del.Responses["204"]; resp.Content != nil {
+		t.Errorf("204 response has content %+v", resp.Content)
+	}
+}
+
+func TestSchemas(t *testing.T) {
+	doc := testGenerator().Build(testRoutes())
+
+	item := doc.Components.Schemas["testItem"]
+	if item == nil {
+		t.Fatal("testItem not registered as a component")
+	}
+	if !reflect.DeepEqual(item.Required, []string{"name"}) {
+		t.Errorf("required = %v, want [name] (omitempty fields are optional)", item.Required)
+	}
+
+	want := map[string]Schema{
+		"id":        {Type: "string", Format: "uuid"},
+		"name":      {Type: "string"},
+		"note":      {Type: "string", Nullable: true},
+		"data":      {Type: "string", Format: "byte"},
+		"createdAt": {Type: "string", Format: "date-time"},
+		"parent":    {Ref: "#/components/schemas/testItem"},
+	}
+	for name, schema := range want {
+		if got := item.Properties[name]; got == nil || !reflect.DeepEqual(*got, schema) {
+			t.Errorf("%s = %+v, want %+v", name, got, schema)
+		}
+	}
+	if tags := item.Properties["tags"]; tags.Type != "array" || tags.Items.Type != "string" {
+		t.Errorf("tags = %+v, want array of strings", tags)
+	}
+	if labels := item.Properties["labels"]; labels.Type != "object" || labels.AdditionalProperties.Type != "integer" {
+		t.Errorf("labels = %+v, want map of integers", labels)
+	}
+	for _, name := range []string{"internal", "Skipped", "-"} {
+		if _, ok := item.Properties[name]; ok {
+			t.Errorf("unexpected property %s", name)
+		}
+	}
+
+	embedding := doc.Components.Schemas["testEmbedding"]
+	if _, ok := embedding.Properties["version"]; !ok {
+		t.Errorf("embedded fields not flattened: %v", embedding.Properties)
+	}
+}
+
+func TestSpecHandler(t *testing.T) {
+	doc := testGenerator().Build(testRoutes())
+
+	r := gin.New()
+	r.GET("/openapi.json", SpecHandler(doc))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	var decoded Document
+	if err := json.Unmarshal(w.Body.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if _, ok := decoded.Paths["/items"]["post"]; !ok {
+		t.Error("served spec is missing POST /items")
+	}
+}
+
+func TestSwaggerUIServesLocalAssets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "swagger-ui-bundle.js"), []byte("// bundle"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterSwaggerUI(r, "/docs", "/openapi.json", dir)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	page := w.Body.String()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if strings.Contains(page, "https://") {
+		t.Error("docs page loads remote assets")
+	}
+	if !strings.Contains(page, `src="/docs/assets/swagger-ui-bundle.js"`) || !strings.Contains(page, `src="/docs/init.js"`) {
+		t.Errorf("unexpected page:\n%s", page)
+	}
+	if strings.Contains(page, "<script>") {
+		t.Error("docs page has an inline script, which its Content-Security-Policy blocks")
+	}
+	if csp := w.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "default-src 'self'") {
+		t.Errorf("Content-Security-Policy = %q", csp)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs/init.js", nil))
+	if !strings.Contains(w.Body.String(), `"/openapi.json"`) {
+		t.Errorf("init script does not load the spec: %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs/assets/swagger-ui-bundle.js", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "// bundle" {
+		t.Errorf("asset: status %d body %q", w.Code, w.Body.String())
+	}
+}
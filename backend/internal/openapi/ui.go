@@ -0,0 +1,59 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SwaggerUIVersion is the swagger-ui-dist release installed by the Dockerfile.
+// Bump both together.
+const SwaggerUIVersion = "5.18.2"
+
+// SpecHandler serves the generated document as JSON
+func SpecHandler(doc *Document) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, doc)
+	}
+}
+
+// swaggerUIContentSecurityPolicy only allows same-origin scripts. Swagger UI sets
+// inline style attributes, so styles can't be locked down further.
+const swaggerUIContentSecurityPolicy = "default-src 'self'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; base-uri 'none'; form-action 'none'; frame-ancestors 'none'"
+
+// RegisterSwaggerUI serves a Swagger UI page at path for the spec at specURL.
+// The swagger-ui-dist assets are served from assetsDir under path + "/assets",
+// so the page loads no third-party scripts, and the page has no inline script.
+func RegisterSwaggerUI(r gin.IRoutes, path, specURL, assetsDir string) {
+	assetsPath := path + "/assets"
+	page := fmt.Sprintf(swaggerUIPage, assetsPath, assetsPath, path)
+	script := fmt.Sprintf(swaggerUIInitScript, specURL)
+
+	r.Static(assetsPath, assetsDir)
+	r.GET(path, func(c *gin.Context) {
+		c.Header("Content-Security-Policy", swaggerUIContentSecurityPolicy)
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+	})
+	r.GET(path+"/init.js", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/javascript; charset=utf-8", []byte(script))
+	})
+}
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Envie API</title>
+  <link rel="stylesheet" href="%s/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="%s/swagger-ui-bundle.js"></script>
+  <script src="%s/init.js"></script>
+</body>
+</html>
+`
+
+const swaggerUIInitScript = `window.ui = SwaggerUIBundle({ url: %q, dom_id: "#swagger-ui" });
+`
@@ -0,0 +1,144 @@
+// Package redact strips ciphertext and secrets from anything that ends up in logs
+// or error reports. Encrypted values are useless to an attacker on their own, but
+// log pipelines are retained and shared far more widely than the database, so
+// neither they nor tokens, codes or plaintext values should ever reach them.
+package redact
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Placeholder replaces every redacted value
+const Placeholder = "[REDACTED]"
+
+// sensitiveKeys are field, query parameter and header names, lowercased, whose
+// values are always redacted. Any name containing "encrypted" or ending in
+// "token" or "secret" is redacted too.
+var sensitiveKeys = map[string]bool{
+	"value":           true,
+	"token":           true,
+	"code":            true,
+	"secret":          true,
+	"password":        true,
+	"state":           true,
+	"recoverycodes":   true,
+	"provisioninguri": true,
+	"authorization":   true,
+	"x-cli-identity":  true,
+	"x-2fa-code":      true,
+}
+
+// IsSensitiveKey reports whether values under name must not be logged
+func IsSensitiveKey(name string) bool {
+	lower := strings.ToLower(name)
+	return sensitiveKeys[lower] ||
+		strings.Contains(lower, "encrypted") ||
+		strings.HasSuffix(lower, "token") ||
+		strings.HasSuffix(lower, "secret")
+}
+
+// JSON returns body with the value of every sensitive field replaced, at any depth.
+// Bodies that aren't JSON are replaced entirely, since there's no telling what
+// they contain.
+func JSON(body []byte) []byte {
+	if len(body) == 0 {
+		return body
+	}
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return []byte(Placeholder)
+	}
+	out, err := json.Marshal(Value(v))
+	if err != nil {
+		return []byte(Placeholder)
+	}
+	return out
+}
+
+// Value redacts a decoded JSON value (maps, slices and scalars) in place and
+// returns it
+func Value(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, field := range v {
+			if IsSensitiveKey(key) {
+				v[key] = Placeholder
+			} else {
+				v[key] = Value(field)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = Value(v[i])
+		}
+	}
+	return v
+}
+
+// URL returns rawURL with sensitive query parameters redacted, e.g. the OAuth
+// code and state on callbacks
+func URL(rawURL string) string {
+	path, query, found := strings.Cut(rawURL, "?")
+	if !found {
+		return rawURL
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return path + "?" + Placeholder
+	}
+	for key := range values {
+		if IsSensitiveKey(key) {
+			values[key] = []string{Placeholder}
+		}
+	}
+	return path + "?" + values.Encode()
+}
+
+var (
+	// "name": "string" in JSON embedded in a log line
+	jsonFieldPattern = regexp.MustCompile(`"([A-Za-z0-9_-]+)"(\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	// name=value in query strings and key=value style log lines
+	pairPattern = regexp.MustCompile(`\b([A-Za-z0-9_-]+)=([^&\s"',;]+)`)
+)
+
+// Text redacts sensitive "name": "value" JSON fields and name=value pairs in free
+// text, such as a formatted log line. It can't see the field names of nested
+// objects, so prefer JSON and Value for structured data.
+func Text(s string) string {
+	s = jsonFieldPattern.ReplaceAllStringFunc(s, func(match string) string {
+		m := jsonFieldPattern.FindStringSubmatch(match)
+		if !IsSensitiveKey(m[1]) {
+			return match
+		}
+		return `"` + m[1] + `"` + m[2] + `"` + Placeholder + `"`
+	})
+	return pairPattern.ReplaceAllStringFunc(s, func(match string) string {
+		m := pairPattern.FindStringSubmatch(match)
+		if !IsSensitiveKey(m[1]) {
+			return match
+		}
+		return m[1] + "=" + Placeholder
+	})
+}
+
+type writer struct {
+	w io.Writer
+}
+
+// NewWriter returns a writer that passes everything through Text before writing
+// it to w. The standard logger, gin and GORM all write whole lines, so it is
+// installed as their output.
+func NewWriter(w io.Writer) io.Writer {
+	return writer{w: w}
+}
+
+func (w writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, Text(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
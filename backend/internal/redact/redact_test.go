@@ -0,0 +1,95 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestIsSensitiveKey(t *testing.T) {
+	sensitive := []string{"value", "Value", "token", "accessToken", "refreshToken", "code", "secret",
+		"encryptedKey", "encryptedProjectKey", "userEncryptedKey", "reEncryptedConfigItems", "recoveryCodes",
+		"Authorization", "X-CLI-Identity", "state"}
+	for _, key := range sensitive {
+		if !IsSensitiveKey(key) {
+			t.Errorf("IsSensitiveKey(%q) = false", key)
+		}
+	}
+
+	plain := []string{"id", "name", "key", "tokenId", "tokenName", "tokenPrefix", "publicKey", "keyVersion", "error"}
+	for _, key := range plain {
+		if IsSensitiveKey(key) {
+			t.Errorf("IsSensitiveKey(%q) = true", key)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	body := `{
+		"items": [{"key": "DB_URL", "value": "postgres://secret", "sensitive": true}],
+		"encryptedProjectKey": "AQID",
+		"teams": [{"id": "1", "encryptedKey": {"nested": "AQID"}}],
+		"token": "envie_abc",
+		"name": "api"
+	}`
+
+	var got map[string]any
+	if err := json.Unmarshal(JSON([]byte(body)), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	item := got["items"].([]any)[0].(map[string]any)
+	if item["key"] != "DB_URL" || item["value"] != Placeholder || item["sensitive"] != true {
+		t.Errorf("item = %v", item)
+	}
+	team := got["teams"].([]any)[0].(map[string]any)
+	if team["id"] != "1" || team["encryptedKey"] != Placeholder {
+		t.Errorf("team = %v", team)
+	}
+	if got["encryptedProjectKey"] != Placeholder || got["token"] != Placeholder || got["name"] != "api" {
+		t.Errorf("body = %v", got)
+	}
+
+	if string(JSON([]byte("not json value=1"))) != Placeholder {
+		t.Error("non-JSON body was not replaced")
+	}
+}
+
+func TestURL(t *testing.T) {
+	got := URL("/auth/github/callback?code=abc123&state=xyz&mode=link")
+	if strings.Contains(got, "abc123") || strings.Contains(got, "xyz") || !strings.Contains(got, "mode=link") {
+		t.Errorf("URL = %q", got)
+	}
+	if got := URL("/v1/projects"); got != "/v1/projects" {
+		t.Errorf("URL without query = %q", got)
+	}
+}
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`payload {"encryptedKey": "AQID", "name": "x"}`, `payload {"encryptedKey": "[REDACTED]", "name": "x"}`},
+		{`{"value":"a \"quoted\" secret"}`, `{"value":"[REDACTED]"}`},
+		{`GET /auth/callback?code=abc&state=def&x=1`, `GET /auth/callback?code=[REDACTED]&state=[REDACTED]&x=1`},
+		{`refresh failed token=envie_123, retrying`, `refresh failed token=[REDACTED], retrying`},
+		{`project=api env=prod`, `project=api env=prod`},
+	}
+	for _, tt := range tests {
+		if got := Text(tt.in); got != tt.want {
+			t.Errorf("Text(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var out bytes.Buffer
+	logger := log.New(NewWriter(&out), "", 0)
+	logger.Printf(`sync failed for {"encryptedValue": "c2VjcmV0"}`)
+
+	if strings.Contains(out.String(), "c2VjcmV0") || !strings.Contains(out.String(), Placeholder) {
+		t.Errorf("logged %q", out.String())
+	}
+}
@@ -0,0 +1,513 @@
+package router
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"envie-backend/internal/accesslog"
+	"envie-backend/internal/configsign"
+	"envie-backend/internal/database"
+	"envie-backend/internal/errorreport"
+	"envie-backend/internal/handlers"
+	"envie-backend/internal/ipallowlist"
+	"envie-backend/internal/middleware"
+	"envie-backend/internal/models"
+	"envie-backend/internal/openapi"
+	"envie-backend/internal/settings"
+	"envie-backend/internal/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+// LegacyRoutesSunset is when the unversioned application routes and the old CLI
+// paths stop being served. Announced to clients through the Sunset header.
+var LegacyRoutesSunset = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+
+// Version and Commit identify the running build on /version. main sets them from
+// its ldflags.
+var (
+	Version = "dev"
+	Commit  = "unknown"
+)
+
+// New builds the HTTP router with every route registered.
+//
+// Layout:
+//   - /auth/*, /ping, /health, /version, /openapi.json, /docs  public, unversioned (/docs needs SWAGGER_UI_DIR)
+//   - /admin/reload    operator endpoint, ADMIN_TOKEN bearer
+//   - /v1/*            application API (desktop app, user JWT)
+//   - /v1/cli/*        CLI API (X-CLI-Identity)
+//   - /v1/resources/*  resource API for Terraform and other declarative clients
+//   - /v1/public/*     signed URLs, no authentication
+//
+// A breaking change gets a new /v2 group registered next to /v1 - never change
+// a versioned route in place.
+//
+// Panics and 5xx responses are sent to reporter, which may be nil.
+func New(reporter *errorreport.Reporter) *gin.Engine {
+	clientIPs, err := middleware.ClientIPResolverFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid proxy configuration: %v", err)
+	}
+	requestTimeout, err := middleware.RequestTimeoutFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid request timeout: %v", err)
+	}
+	// CORS origins, payload logging and chaos testing are looked up per request,
+	// so a settings reload applies without rebuilding the router
+	current, err := settings.Init()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	r := gin.New()
+	r.Use(gin.Logger())
+	if tracing.Enabled() {
+		// Outside recovery, so a panic is recorded as the 500 it turns into
+		r.Use(otelgin.Middleware(tracing.ServiceName))
+	}
+	r.Use(middleware.RecoveryMiddleware(reporter))
+	// Client addresses come from middleware.ClientIP; gin's own resolution would
+	// believe X-Forwarded-For from anyone
+	r.SetTrustedProxies(nil)
+	r.Use(
+		middleware.ClientIPMiddleware(clientIPs),
+		middleware.BodyLimitMiddleware(bodyLimit),
+		middleware.RequestTimeoutMiddleware(requestTimeout),
+		middleware.SecurityHeadersMiddleware(),
+		middleware.NoStoreMiddleware(),
+		middleware.ReloadableCORSMiddleware(func() []string { return settings.Current().AllowedOrigins }),
+		// Before payload logging, which has to record responses uncompressed
+		middleware.CompressionMiddleware(),
+		middleware.ReloadablePayloadLogMiddleware(log.Default(), func() bool { return settings.Current().LogPayloads }),
+		middleware.ReloadableChaosMiddleware(func() middleware.ChaosConfig { return settings.Current().Chaos }),
+	)
+	if current.Chaos.Enabled() {
+		log.Printf("WARNING: chaos testing enabled: %s", current.Chaos)
+	}
+
+	registerPublicRoutes(r)
+
+	v1 := r.Group("/v1")
+	v1.Use(middleware.APIVersionMiddleware())
+	{
+		// Signed, tokenless links to published non-sensitive config
+		v1.GET("/public/shares/:shareId", handlers.GetPublicShareContent)
+		// Signed, expiring links to one encrypted file
+		v1.GET("/public/files/:shareId", handlers.GetFileShareContent)
+
+		cli := v1.Group("/cli")
+		cli.Use(middleware.CLIAuthMiddleware(), accesslog.Middleware(), middleware.IdempotencyMiddleware())
+		registerCLIRoutes(cli)
+
+		resources := v1.Group("/resources")
+		resources.Use(middleware.AuthMiddleware(), accesslog.Middleware(), ipallowlist.Middleware(), middleware.IdempotencyMiddleware())
+		registerResourceRoutes(resources)
+
+		app := v1.Group("")
+		app.Use(middleware.AuthMiddleware(), accesslog.Middleware(), ipallowlist.Middleware(), middleware.IdempotencyMiddleware())
+		registerAppRoutes(app)
+	}
+
+	// The spec only covers the versioned routes, so build it before the legacy aliases
+	spec := openapi.NewGenerator("Envie API", "1.0.0")
+	handlers.DescribeAPI(spec)
+	doc := spec.Build(r.Routes())
+
+	// Temporary unversioned aliases for desktop clients released before /v1
+	legacy := r.Group("/")
+	legacy.Use(middleware.DeprecatedRouteMiddleware("/v1", LegacyRoutesSunset), middleware.AuthMiddleware(), accesslog.Middleware(), ipallowlist.Middleware(), middleware.IdempotencyMiddleware())
+	registerAppRoutes(legacy)
+
+	// The spec and docs only change with a deploy; everything else is no-store
+	public := r.Group("", middleware.CachePolicy("public, max-age=300"))
+	public.GET("/openapi.json", openapi.SpecHandler(doc))
+	if dir := os.Getenv("SWAGGER_UI_DIR"); dir != "" {
+		openapi.RegisterSwaggerUI(public, "/docs", "/openapi.json", dir)
+	}
+
+	return r
+}
+
+// bulkRoutes take bodies up to middleware.BulkBodyLimit: they carry a value or a
+// key for every item, file or team of a project. Paths are those of the app
+// routes, without the /v1 prefix.
+var bulkRoutes = map[string]bool{
+	"PUT /projects/:id/config":                        true,
+	"POST /projects/:id/config/drafts":                true,
+	"PUT /projects/:id/config/drafts/:draftId":        true,
+	"PUT /projects/:id/files-feks":                    true,
+	"POST /projects/:id/rotation":                     true,
+	"POST /projects/:id/rotation/validate":            true,
+	"POST /projects/:id/rotation/:rotationId/restart": true,
+	"POST /me/rotate-master-key":                      true,
+	"POST /organizations/:id/key-grants/fulfill":      true,
+}
+
+// bodyLimit returns the maximum request body size of the route c matched
+func bodyLimit(c *gin.Context) int64 {
+	route := c.Request.Method + " " + strings.TrimPrefix(c.FullPath(), "/v1")
+	switch {
+	case route == "POST /projects/:id/files", route == "POST /cli/projects/:id/files":
+		// The encrypted file and the other form fields. The handler holds the
+		// file to its organization's limit as it streams it to storage.
+		return handlers.MaxFileSizeLimit + middleware.DefaultBodyLimit
+	case bulkRoutes[route]:
+		return middleware.BulkBodyLimit
+	}
+	return middleware.DefaultBodyLimit
+}
+
+// Handler wraps the router with the rewrites that have to happen before routing,
+// currently the pre-versioning CLI paths (see middleware.LegacyCLIRewrite)
+func Handler(r *gin.Engine) http.Handler {
+	return middleware.LegacyCLIRewrite(r, LegacyRoutesSunset)
+}
+
+func registerPublicRoutes(r *gin.Engine) {
+	r.GET("/auth/login", handlers.AuthLogin)
+	r.GET("/auth/callback", handlers.AuthCallback)
+	r.GET("/auth/login/google", handlers.AuthLoginGoogle)
+	r.GET("/auth/callback/google", handlers.AuthCallbackGoogle)
+	r.GET("/auth/sso/:id/login", handlers.SSOLogin)
+	r.GET("/auth/sso/callback", handlers.SSOCallback)
+	r.POST("/auth/device-challenge", handlers.AuthDeviceChallenge)
+	r.POST("/auth/exchange", handlers.AuthExchange)
+	r.POST("/auth/pairing", handlers.StartPairing)
+	r.POST("/auth/pairing/:id/token", handlers.PairingToken)
+	r.POST("/auth/refresh", handlers.AuthRefresh)
+	r.GET("/ping", func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"message": "pong",
+		})
+	})
+	r.GET("/health", func(c *gin.Context) {
+		sqlDB, err := database.DB.DB()
+		if err != nil {
+			c.String(503, "Database connection unavailable")
+			return
+		}
+		if err := sqlDB.Ping(); err != nil {
+			c.String(503, "Database connection failed")
+			return
+		}
+		c.String(200, "OK")
+	})
+	r.GET("/version", func(c *gin.Context) {
+		response := gin.H{
+			"version":              Version,
+			"commit":               Commit,
+			"apiVersion":           middleware.CurrentAPIVersion,
+			"supportedApiVersions": middleware.SupportedAPIVersions,
+		}
+		if signer := configsign.Current; signer != nil {
+			response["configSigningKey"] = gin.H{"keyId": signer.KeyID(), "algorithm": configsign.Algorithm, "publicKey": signer.PublicKey()}
+		}
+		c.JSON(200, response)
+	})
+	r.POST("/admin/reload", handlers.ReloadSettings)
+}
+
+// registerAppRoutes registers the application API. Called for /v1 and for the
+// legacy unversioned aliases, so the group must already carry AuthMiddleware.
+func registerAppRoutes(g *gin.RouterGroup) {
+	// Routes of a project declare the permission they need in it; any member
+	// of the project may use the others. See handlers.AuthorizeProject.
+	member := handlers.AuthorizeProject()
+	configWrite := handlers.AuthorizeProject(models.PermissionConfigWrite)
+	projectDelete := handlers.AuthorizeProject(models.PermissionProjectDelete)
+	tokenManage := handlers.AuthorizeProject(models.PermissionTokenManage)
+	filesWrite := handlers.AuthorizeProject(models.PermissionFilesWrite)
+	rotationApprove := handlers.AuthorizeProject(models.PermissionRotationApprove)
+
+	g.GET("/me", handlers.GetMe)
+	g.DELETE("/me", handlers.DeleteAccount)
+	g.GET("/me/export", handlers.ExportAccount)
+	g.PUT("/me/public-key", handlers.SetPublicKey)
+	g.POST("/me/rotate-master-key", handlers.RotateMasterKey)
+	g.POST("/auth/logout", handlers.AuthLogout)
+
+	// Two-factor authentication
+	g.GET("/me/2fa", handlers.GetTwoFactorStatus)
+	g.POST("/me/2fa/setup", handlers.SetupTwoFactor)
+	g.POST("/me/2fa/enable", handlers.EnableTwoFactor)
+	g.POST("/me/2fa/disable", handlers.DisableTwoFactor)
+	g.POST("/me/2fa/recovery-codes", handlers.RegenerateRecoveryCodes)
+	g.GET("/me/2fa/events", handlers.GetTwoFactorEvents)
+
+	// Notification center
+	g.GET("/me/notifications", handlers.GetNotifications)
+	g.POST("/me/notifications/:id/read", handlers.MarkNotificationRead)
+
+	// Pairing new devices
+	g.GET("/pairings/:id", handlers.GetPairing)
+	g.POST("/pairings/:id/approve", handlers.ApprovePairing)
+	g.POST("/pairings/:id/deny", handlers.DenyPairing)
+
+	// Sessions
+	g.GET("/me/sessions", handlers.GetSessions)
+	g.DELETE("/me/sessions/:id", handlers.RevokeSession)
+
+	// Identity
+	g.POST("/devices", handlers.RegisterDevice)
+	g.GET("/devices", handlers.GetDevices)
+	g.DELETE("/devices", handlers.DeleteAllDevices)
+	g.DELETE("/devices/:id", handlers.DeleteDevice)
+	g.PUT("/devices/:id", handlers.UpdateDevice)
+
+	// Project Routes
+	g.POST("/projects", handlers.CreateProject)
+	g.GET("/projects", handlers.GetProjects)
+	g.GET("/projects/organization/:id", handlers.GetOrganizationProjects)
+	g.GET("/projects/search", handlers.SearchProjects)
+	g.GET("/projects/:id", member, handlers.GetProject)
+	g.PUT("/projects/:id", configWrite, handlers.UpdateProject)
+	g.GET("/projects/:id/renames", member, handlers.GetProjectRenames)
+	g.GET("/projects/:id/activity", member, handlers.GetProjectActivity)
+	g.PUT("/projects/:id/tags", configWrite, handlers.SetProjectTags)
+	g.GET("/projects/:id/schema", member, handlers.GetProjectSchema)
+	g.PUT("/projects/:id/schema", configWrite, handlers.PutProjectSchema)
+	g.PUT("/projects/:id/favorite", member, handlers.FavoriteProject)
+	g.DELETE("/projects/:id/favorite", member, handlers.UnfavoriteProject)
+	g.GET("/projects/:id/sandbox/fixtures", member, handlers.GetSandboxFixtures)
+	// Config Items
+	g.GET("/projects/:id/config", member, handlers.GetConfigItems)
+	g.PUT("/projects/:id/config", member, handlers.SyncConfigItems)
+	g.GET("/projects/:id/config/trash", member, handlers.GetConfigTrash)
+	g.POST("/projects/:id/config/trash/:itemId/restore", member, handlers.RestoreConfigItem)
+	g.GET("/projects/:id/config/diff", member, handlers.GetConfigDiff)
+	g.GET("/projects/:id/config/snapshots", member, handlers.GetConfigSnapshots)
+	g.POST("/projects/:id/config/snapshots", member, handlers.CreateConfigSnapshot)
+	g.GET("/projects/:id/config/snapshots/:snapshotId", member, handlers.GetConfigSnapshot)
+	g.POST("/projects/:id/config/snapshots/:snapshotId/restore", configWrite, handlers.RestoreConfigSnapshot)
+	g.DELETE("/projects/:id/config/snapshots/:snapshotId", configWrite, handlers.DeleteConfigSnapshot)
+	g.GET("/projects/:id/config/drafts", member, handlers.GetConfigDrafts)
+	g.POST("/projects/:id/config/drafts", member, handlers.CreateConfigDraft)
+	g.GET("/projects/:id/config/drafts/:draftId", member, handlers.GetConfigDraft)
+	g.PUT("/projects/:id/config/drafts/:draftId", member, handlers.UpdateConfigDraft)
+	g.POST("/projects/:id/config/drafts/:draftId/approve", configWrite, handlers.ApproveConfigDraft)
+	g.POST("/projects/:id/config/drafts/:draftId/reject", configWrite, handlers.RejectConfigDraft)
+	g.DELETE("/projects/:id/config/drafts/:draftId", member, handlers.DiscardConfigDraft)
+	g.DELETE("/projects/:id", projectDelete, handlers.DeleteProject)
+
+	// Secret Manager Configs
+	g.GET("/projects/:id/secret-managers", member, handlers.GetSecretManagerConfigs)
+	g.POST("/projects/:id/secret-managers", configWrite, handlers.CreateSecretManagerConfig)
+	g.PUT("/projects/:id/secret-managers/:configId", configWrite, handlers.UpdateSecretManagerConfig)
+	g.DELETE("/projects/:id/secret-managers/:configId", configWrite, handlers.DeleteSecretManagerConfig)
+
+	// Deployment Targets (Vercel, Netlify, Fly.io)
+	g.GET("/projects/:id/deployment-targets", member, handlers.GetDeploymentTargets)
+	g.POST("/projects/:id/deployment-targets", configWrite, handlers.CreateDeploymentTarget)
+	g.PUT("/projects/:id/deployment-targets/:targetId", configWrite, handlers.UpdateDeploymentTarget)
+	g.DELETE("/projects/:id/deployment-targets/:targetId", configWrite, handlers.DeleteDeploymentTarget)
+	g.GET("/projects/:id/deployment-targets/:targetId/syncs", member, handlers.GetDeploymentSyncs)
+	g.PUT("/projects/:id/deployment-targets/:targetId/syncs/:syncId", configWrite, handlers.ReportDeploymentSync)
+
+	// Compliance labels
+	g.GET("/projects/:id/compliance-labels", member, handlers.GetProjectComplianceLabels)
+	g.PUT("/projects/:id/compliance-labels", configWrite, handlers.SetProjectComplianceLabels)
+	g.PUT("/projects/:id/config-items/:itemId/compliance-labels", configWrite, handlers.SetConfigItemComplianceLabels)
+	g.GET("/projects/:id/key-holders", configWrite, handlers.GetProjectKeyHolders)
+
+	// Project Access (Teams)
+	g.GET("/projects/:id/teams", member, handlers.GetProjectTeams)
+	g.POST("/projects/:id/teams", configWrite, handlers.AddTeamToProject)
+
+	// Key Rotation
+	g.GET("/projects/:id/rotation", member, handlers.GetPendingRotation)
+	g.POST("/projects/:id/rotation", configWrite, handlers.InitiateKeyRotation)
+	g.POST("/projects/:id/rotation/validate", configWrite, handlers.ValidateKeyRotation)
+	g.POST("/projects/:id/rotation/:rotationId/approve", rotationApprove, handlers.ApproveKeyRotation)
+	g.POST("/projects/:id/rotation/:rotationId/reject", rotationApprove, handlers.RejectKeyRotation)
+	g.GET("/projects/:id/rotation/:rotationId/impact", member, handlers.GetRotationImpact)
+	g.GET("/projects/:id/rotation/:rotationId/changes", configWrite, handlers.GetRotationChanges)
+	g.POST("/projects/:id/rotation/:rotationId/restart", configWrite, handlers.RestartKeyRotation)
+	g.DELETE("/projects/:id/rotation/:rotationId", member, handlers.CancelKeyRotation)
+	g.GET("/pending-rotations", handlers.GetUserPendingRotations)
+
+	// Key rotation policies
+	g.GET("/organizations/:id/key-rotation-policies", handlers.GetKeyRotationPolicies)
+	g.PUT("/organizations/:id/key-rotation-policy", handlers.PutOrganizationKeyRotationPolicy)
+	g.DELETE("/organizations/:id/key-rotation-policy", handlers.DeleteOrganizationKeyRotationPolicy)
+	g.GET("/organizations/:id/overdue-key-rotations", handlers.GetOverdueKeyRotations)
+	g.PUT("/projects/:id/key-rotation-policy", configWrite, handlers.PutProjectKeyRotationPolicy)
+	g.DELETE("/projects/:id/key-rotation-policy", configWrite, handlers.DeleteProjectKeyRotationPolicy)
+
+	// Public shares of non-sensitive config
+	g.GET("/projects/:id/public-shares", member, handlers.GetPublicShares)
+	g.POST("/projects/:id/public-shares", configWrite, handlers.CreatePublicShare)
+	g.PUT("/projects/:id/public-shares/:shareId", configWrite, handlers.UpdatePublicShare)
+	g.DELETE("/projects/:id/public-shares/:shareId", configWrite, handlers.DeletePublicShare)
+
+	// Project Tokens (CLI tokens for CI/CD)
+	g.POST("/projects/:id/tokens", tokenManage, handlers.CreateProjectToken)
+	g.GET("/projects/:id/tokens", tokenManage, handlers.GetProjectTokens)
+	g.DELETE("/projects/:id/tokens/:tokenId", tokenManage, handlers.DeleteProjectToken)
+	g.POST("/projects/:id/tokens/:tokenId/renew", tokenManage, handlers.RenewProjectToken)
+	g.POST("/projects/:id/tokens/:tokenId/rotate", tokenManage, handlers.RotateProjectToken)
+	g.PUT("/projects/:id/tokens/:tokenId/allowed-cidrs", tokenManage, handlers.SetTokenAllowedCIDRs)
+	g.GET("/projects/:id/token-anomalies", tokenManage, handlers.GetTokenAnomalies)
+	g.POST("/projects/:id/token-anomalies/:anomalyId/acknowledge", tokenManage, handlers.AcknowledgeTokenAnomaly)
+	g.POST("/projects/:id/tokens/revoke", tokenManage, handlers.RevokeProjectTokens)
+	g.POST("/organizations/:id/tokens/revoke", handlers.RevokeOrganizationTokens)
+	g.DELETE("/projects/:id/tokens", tokenManage, handlers.DeleteProjectTokens)
+	g.GET("/organizations/:id/expired-tokens", handlers.GetExpiredTokenReport)
+	g.DELETE("/organizations/:id/expired-tokens", handlers.PurgeExpiredTokens)
+
+	// Project Files
+	g.GET("/projects/:id/files", member, handlers.ListProjectFiles)
+	g.POST("/projects/:id/files", filesWrite, handlers.UploadProjectFile)
+	g.GET("/projects/:id/files/folders", member, handlers.ListFileFolders)
+	g.POST("/projects/:id/files/folders/move", filesWrite, handlers.MoveFileFolder)
+	g.POST("/projects/:id/files/uploads", filesWrite, handlers.CreateFileUpload)
+	g.POST("/projects/:id/files/uploads/:uploadId/finalize", filesWrite, handlers.FinalizeFileUpload)
+	g.GET("/projects/:id/files/:fileId", member, handlers.DownloadProjectFile)
+	g.PATCH("/projects/:id/files/:fileId", filesWrite, handlers.UpdateProjectFile)
+	g.DELETE("/projects/:id/files/:fileId", filesWrite, handlers.DeleteProjectFile)
+	g.POST("/projects/:id/files/:fileId/share", configWrite, handlers.CreateFileShare)
+	g.GET("/projects/:id/file-shares", configWrite, handlers.GetFileShares)
+	g.GET("/projects/:id/file-shares/:shareId/accesses", configWrite, handlers.GetFileShareAccesses)
+	g.DELETE("/projects/:id/file-shares/:shareId", configWrite, handlers.RevokeFileShare)
+	g.GET("/projects/:id/files-feks", member, handlers.GetProjectFilesForRotation)
+	g.PUT("/projects/:id/files-feks", configWrite, handlers.UpdateFileFEKs)
+
+	// Organizations
+	g.POST("/organizations", handlers.CreateOrganization)
+	g.GET("/organizations", handlers.GetOrganizations)
+	g.GET("/organizations/:id", handlers.GetOrganization)
+	g.PUT("/organizations/:id", handlers.UpdateOrganization)
+	g.GET("/organizations/:id/users", handlers.GetOrganizationUsers)
+	g.POST("/organizations/:id/members", handlers.AddOrganizationMember)
+	g.PUT("/organizations/:id/members/:userId", handlers.UpdateOrganizationMember)
+	g.DELETE("/organizations/:id/members/:userId", handlers.RemoveOrganizationMember)
+	g.POST("/organizations/:id/members/:userId/offboard", handlers.OffboardOrganizationMember)
+	g.PUT("/organizations/:id/members/:userId/custom-role", handlers.AssignOrganizationMemberRole)
+	g.GET("/organizations/:id/roles", handlers.GetRoles)
+	g.POST("/organizations/:id/roles", handlers.CreateRole)
+	g.PUT("/organizations/:id/roles/:roleId", handlers.UpdateRole)
+	g.DELETE("/organizations/:id/roles/:roleId", handlers.DeleteRole)
+	g.GET("/organizations/:id/key-grants", handlers.GetKeyGrants)
+	g.POST("/organizations/:id/key-grants/fulfill", handlers.FulfillKeyGrants)
+	g.GET("/organizations/:id/recovery-escrow", handlers.GetRecoveryEscrow)
+	g.PUT("/organizations/:id/recovery-escrow", handlers.PutRecoveryEscrow)
+	g.DELETE("/organizations/:id/recovery-escrow", handlers.DeleteRecoveryEscrow)
+	g.GET("/organizations/:id/recovery-escrow/share", handlers.GetMyRecoveryShare)
+	g.GET("/organizations/:id/recovery-requests", handlers.GetRecoveryRequests)
+	g.POST("/organizations/:id/recovery-requests", handlers.CreateRecoveryRequest)
+	g.POST("/organizations/:id/recovery-requests/:requestId/release", handlers.ReleaseRecoveryShare)
+	g.GET("/organizations/:id/recovery-requests/:requestId/shares", handlers.GetRecoveryShares)
+	g.POST("/organizations/:id/recovery-requests/:requestId/complete", handlers.CompleteRecovery)
+	g.DELETE("/organizations/:id/recovery-requests/:requestId", handlers.CancelRecoveryRequest)
+	g.GET("/organizations/:id/recovery-events", handlers.GetRecoveryEvents)
+	g.GET("/organizations/:id/audit-events", handlers.GetAuditEvents)
+	g.GET("/organizations/:id/audit-events/export", handlers.ExportAuditEvents)
+	g.GET("/organizations/:id/read-events", handlers.GetReadEvents)
+	g.GET("/organizations/:id/audit-stream", handlers.GetAuditStream)
+	g.PUT("/organizations/:id/audit-stream", handlers.PutAuditStream)
+	g.DELETE("/organizations/:id/audit-stream", handlers.DeleteAuditStream)
+	g.GET("/organizations/:id/activity", handlers.GetOrganizationActivity)
+	g.GET("/organizations/:id/alerts", handlers.GetOrganizationAlerts)
+	g.POST("/organizations/:id/alerts", handlers.CreateOrganizationAlert)
+	g.PUT("/organizations/:id/alerts/:alertId", handlers.UpdateOrganizationAlert)
+	g.DELETE("/organizations/:id/alerts/:alertId", handlers.DeleteOrganizationAlert)
+	g.GET("/organizations/:id/compliance-labels", handlers.GetComplianceLabels)
+	g.POST("/organizations/:id/compliance-labels", handlers.CreateComplianceLabel)
+	g.DELETE("/organizations/:id/compliance-labels/:labelId", handlers.DeleteComplianceLabel)
+	g.GET("/organizations/:id/compliance-report", handlers.GetComplianceReport)
+	g.GET("/organizations/:id/access-logs", handlers.GetAccessLogs)
+	g.GET("/organizations/:id/access-matrix.csv", handlers.GetAccessMatrix)
+	g.GET("/organizations/:id/sso", handlers.GetOrganizationSSO)
+	g.PUT("/organizations/:id/sso", handlers.PutOrganizationSSO)
+	g.DELETE("/organizations/:id/sso", handlers.DeleteOrganizationSSO)
+	g.POST("/organizations/:id/sso/link", handlers.StartSSOLink)
+	g.GET("/organizations/:id/ip-allowlist", handlers.GetIPAllowlist)
+	g.PUT("/organizations/:id/ip-allowlist", handlers.UpdateIPAllowlist)
+	g.GET("/organizations/:id/access-log-settings", handlers.GetAccessLogSettings)
+	g.PUT("/organizations/:id/access-log-settings", handlers.UpdateAccessLogSettings)
+	g.GET("/organizations/:id/read-audit-settings", handlers.GetReadAuditSettings)
+	g.PUT("/organizations/:id/read-audit-settings", handlers.UpdateReadAuditSettings)
+	g.GET("/organizations/:id/config-trash-settings", handlers.GetConfigTrashSettings)
+	g.PUT("/organizations/:id/config-trash-settings", handlers.UpdateConfigTrashSettings)
+	g.GET("/organizations/:id/session-policy", handlers.GetSessionPolicy)
+	g.PUT("/organizations/:id/session-policy", handlers.UpdateSessionPolicy)
+	g.GET("/organizations/:id/file-policy", handlers.GetFilePolicy)
+	g.PUT("/organizations/:id/file-policy", handlers.UpdateFilePolicy)
+	g.GET("/organizations/:id/files/largest", handlers.ListLargestFiles)
+	g.GET("/organizations/:id/usage", handlers.GetOrganizationUsage)
+
+	// Users
+	g.GET("/users/search", handlers.SearchUserByEmail)
+
+	// Instance administration (superadmins)
+	g.GET("/instance/metrics", handlers.GetInstanceMetrics)
+	g.GET("/instance/organizations", handlers.ListInstanceOrganizations)
+	g.PUT("/instance/organizations/:id/limits", handlers.UpdateOrganizationPlanLimits)
+	g.GET("/instance/users", handlers.ListInstanceUsers)
+	g.POST("/instance/users/:userId/disable", handlers.DisableInstanceUser)
+	g.POST("/instance/users/:userId/enable", handlers.EnableInstanceUser)
+	g.PUT("/instance/users/:userId/role", handlers.UpdateInstanceUserRole)
+	g.POST("/instance/tokens/revoke", handlers.RevokeInstanceTokens)
+	g.GET("/instance/events", handlers.GetInstanceEvents)
+
+	// Teams
+	g.POST("/teams", handlers.CreateTeam)
+	g.GET("/teams", handlers.GetTeams)
+	g.GET("/teams/my", handlers.GetMyTeams)
+	g.PUT("/teams/:id/my-key", handlers.UpdateMyTeamKey)
+	g.GET("/teams/:id/members", handlers.GetTeamMembers)
+	g.POST("/teams/:id/members", handlers.AddTeamMember)
+	g.PUT("/teams/:id/members/:userId", handlers.UpdateTeamMember)
+	g.PUT("/teams/:id/members/:userId/custom-role", handlers.AssignTeamMemberRole)
+	g.DELETE("/teams/:id/members/:userId", handlers.RemoveTeamMember)
+}
+
+func registerCLIRoutes(g *gin.RouterGroup) {
+	g.GET("/verify", handlers.VerifyCLIIdentity)
+	g.GET("/projects/:id/config", handlers.GetCLIProjectConfig)
+	g.GET("/projects/:id/config/checksum", handlers.GetCLIConfigChecksum)
+	g.GET("/projects/:id/config/diff", handlers.GetCLIConfigDiff)
+	g.GET("/projects/:id/schema", handlers.GetCLIProjectSchema)
+	g.GET("/projects/:id/files", handlers.GetCLIProjectFiles)
+	g.POST("/projects/:id/files", handlers.UploadCLIProjectFile)
+	g.GET("/projects/:id/files/:fileId", handlers.DownloadCLIProjectFile)
+	g.GET("/projects/:id/status", handlers.GetCLIProjectStatus)
+	g.GET("/projects/:id/config/wait", handlers.WaitCLIConfigChange)
+	g.PUT("/projects/:id/canary", handlers.WriteCLICanary)
+	g.GET("/projects/:id/deployment-targets", handlers.GetCLIDeploymentTargets)
+	g.POST("/projects/:id/deployment-targets/:targetId/syncs", handlers.CreateCLIDeploymentSync)
+	g.PUT("/projects/:id/deployment-targets/:targetId/syncs/:syncId", handlers.ReportCLIDeploymentSync)
+}
+
+// registerResourceRoutes registers the stable CRUD surface for Terraform and other
+// declarative clients
+func registerResourceRoutes(g *gin.RouterGroup) {
+	member := handlers.AuthorizeProjectResource()
+	configWrite := handlers.AuthorizeProjectResource(models.PermissionConfigWrite)
+	projectDelete := handlers.AuthorizeProjectResource(models.PermissionProjectDelete)
+	tokenManage := handlers.AuthorizeProjectResource(models.PermissionTokenManage)
+
+	g.POST("/projects", handlers.CreateProjectResource)
+	g.GET("/projects/:id", member, handlers.GetProjectResource)
+	g.PUT("/projects/:id", configWrite, handlers.PutProjectResource)
+	g.DELETE("/projects/:id", projectDelete, handlers.DeleteProjectResource)
+
+	g.GET("/projects/:id/config-items", member, handlers.GetConfigItemResources)
+	g.GET("/projects/:id/config-items/:name", member, handlers.GetConfigItemResource)
+	g.PUT("/projects/:id/config-items/:name", member, handlers.PutConfigItemResource)
+	g.DELETE("/projects/:id/config-items/:name", member, handlers.DeleteConfigItemResource)
+
+	g.POST("/projects/:id/tokens", tokenManage, handlers.CreateProjectTokenResource)
+	g.GET("/projects/:id/tokens/:tokenId", tokenManage, handlers.GetProjectTokenResource)
+	g.PUT("/projects/:id/tokens/:tokenId", tokenManage, handlers.PutProjectTokenResource)
+	g.DELETE("/projects/:id/tokens/:tokenId", tokenManage, handlers.DeleteProjectTokenResource)
+
+	g.POST("/teams", handlers.CreateTeamResource)
+	g.GET("/teams/:id", handlers.GetTeamResource)
+	g.PUT("/teams/:id", handlers.PutTeamResource)
+	g.DELETE("/teams/:id", handlers.DeleteTeamResource)
+}
@@ -0,0 +1,281 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"envie-backend/internal/auth"
+	"envie-backend/internal/database"
+	"envie-backend/internal/handlers"
+	"envie-backend/internal/models"
+	"envie-backend/internal/openapi"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// undocumentedRoutes are served on purpose without OpenAPI metadata
+var undocumentedRoutes = map[string]bool{
+	"GET /ping":          true,
+	"GET /health":        true,
+	"GET /version":       true,
+	"GET /openapi.json":  true,
+	"POST /admin/reload": true,
+}
+
+func TestEveryRouteIsDescribed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	spec := openapi.NewGenerator("Envie API", "1.0.0")
+	handlers.DescribeAPI(spec)
+
+	for _, route := range spec.Undescribed(New(nil).Routes()) {
+		key := route.Method + " " + route.Path
+		if undocumentedRoutes[key] || strings.HasPrefix(route.Path, "/docs") {
+			continue
+		}
+		t.Errorf("%s (%s) has no metadata in handlers.DescribeAPI", key, route.Handler)
+	}
+}
+
+func TestResponseHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := New(nil)
+
+	tests := []struct {
+		path         string
+		cacheControl string
+	}{
+		{"/v1/projects/p1/config", "no-store"},
+		{"/v1/cli/projects/p1/config", "no-store"},
+		{"/v1/projects/p1/files/f1", "no-store"},
+		{"/openapi.json", "public, max-age=300"},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if got := w.Header().Get("Cache-Control"); got != tt.cacheControl {
+			t.Errorf("%s: Cache-Control = %q, want %q", tt.path, got, tt.cacheControl)
+		}
+		if w.Header().Get("Strict-Transport-Security") == "" || w.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("%s: missing security headers", tt.path)
+		}
+	}
+}
+
+func TestVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Version, Commit = "1.4.0", "abc123"
+	defer func() { Version, Commit = "dev", "unknown" }()
+
+	w := httptest.NewRecorder()
+	New(nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	var body struct {
+		Version    string `json:"version"`
+		Commit     string `json:"commit"`
+		APIVersion string `json:"apiVersion"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("status %d, %v: %s", w.Code, err, w.Body)
+	}
+	if body.Version != "1.4.0" || body.Commit != "abc123" || body.APIVersion == "" {
+		t.Errorf("body = %+v", body)
+	}
+}
+
+// The browser preflight allows every method a route is registered with, such as
+// the PATCH that renames and moves files
+func TestPreflightAllowsEveryMethod(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := New(nil)
+
+	methods := map[string]bool{}
+	for _, route := range r.Routes() {
+		methods[route.Method] = true
+	}
+	for method := range methods {
+		req := httptest.NewRequest(http.MethodOptions, "/v1/projects/p1/files/f1", nil)
+		req.Header.Set("Origin", "tauri://localhost")
+		req.Header.Set("Access-Control-Request-Method", method)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		allowed := strings.Split(w.Header().Get("Access-Control-Allow-Methods"), ", ")
+		if w.Code != http.StatusNoContent || !slices.Contains(allowed, method) {
+			t.Errorf("preflight for %s = %d, allowing %v", method, w.Code, allowed)
+		}
+	}
+}
+
+func TestBulkRoutesAreRegistered(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	registered := map[string]bool{}
+	for _, route := range New(nil).Routes() {
+		registered[route.Method+" "+route.Path] = true
+	}
+	for route := range bulkRoutes {
+		method, path, _ := strings.Cut(route, " ")
+		if !registered[method+" /v1"+path] {
+			t.Errorf("bulk route %s is not registered", route)
+		}
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := New(nil)
+
+	tests := []struct {
+		method, path string
+		size         int64
+		want         int
+	}{
+		{http.MethodPost, "/v1/projects", 2 << 20, http.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/projects", 2 << 20, http.StatusRequestEntityTooLarge},
+		// Within the limit, the request carries on to authentication
+		{http.MethodPost, "/v1/projects", 1 << 10, http.StatusUnauthorized},
+		{http.MethodPut, "/v1/projects/p1/config", 2 << 20, http.StatusUnauthorized},
+		{http.MethodPut, "/v1/projects/p1/config", 32 << 20, http.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/v1/projects/p1/files", 64 << 20, http.StatusUnauthorized},
+		{http.MethodPost, "/v1/projects/p1/files", handlers.MaxFileSizeLimit + 2<<20, http.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/v1/projects/p1/files/uploads", 2 << 20, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader("{}"))
+		req.ContentLength = tt.size
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s %s with %d bytes: status = %d, want %d", tt.method, tt.path, tt.size, w.Code, tt.want)
+		}
+	}
+}
+
+// A custom role with config.write but not token.manage can't manage CLI tokens
+// through the resource API any more than through the app API
+func TestTokenRoutesRequireTokenManage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("DB_DRIVER", database.DriverSQLite)
+	t.Setenv("DB_DSN", t.TempDir()+"/envie.db")
+	previous := database.DB
+	database.Connect()
+	t.Cleanup(func() { database.DB = previous })
+
+	org := models.Organization{Name: "Acme"}
+	editor := models.User{ID: uuid.New(), Name: "Editor", Email: "editor@example.com", GithubID: 1, GoogleID: "1"}
+	keeper := models.User{ID: uuid.New(), Name: "Keeper", Email: "keeper@example.com", GithubID: 2, GoogleID: "2"}
+	seed := func(rows ...any) {
+		for _, row := range rows {
+			if err := database.DB.Create(row).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	seed(&org, &editor, &keeper)
+	team := models.Team{ID: uuid.New(), OrganizationID: org.ID, Name: "Backend"}
+	project := models.Project{ID: uuid.New(), OrganizationID: org.ID, Name: "API", Slug: "api"}
+	writer := models.Role{OrganizationID: org.ID, Name: "Writer", Scope: models.RoleScopeTeam, Permissions: []string{models.PermissionConfigWrite}}
+	tokenKeeper := models.Role{OrganizationID: org.ID, Name: "Token keeper", Scope: models.RoleScopeTeam, Permissions: []string{models.PermissionTokenManage}}
+	seed(&team, &project, &writer, &tokenKeeper)
+	token := models.ProjectToken{ID: uuid.New(), ProjectID: project.ID, Name: "CI", TokenPrefix: "abc", IdentityIDHash: "hash", EncryptedProjectKey: "a2V5", CreatedBy: keeper.ID}
+	seed(&models.OrganizationUser{OrganizationID: org.ID, UserID: editor.ID, Role: "member"},
+		&models.OrganizationUser{OrganizationID: org.ID, UserID: keeper.ID, Role: "member"},
+		&models.TeamUser{TeamID: team.ID, UserID: editor.ID, EncryptedTeamKey: "a2V5", Role: "member", RoleID: &writer.ID},
+		&models.TeamUser{TeamID: team.ID, UserID: keeper.ID, EncryptedTeamKey: "a2V5", Role: "member", RoleID: &tokenKeeper.ID},
+		&models.TeamProject{TeamID: team.ID, ProjectID: project.ID, EncryptedProjectKey: "a2V5"},
+		&token)
+
+	r := New(nil)
+	request := func(user models.User, method, path string) int {
+		accessToken, err := auth.GenerateAccessToken(user.ID, uuid.Nil, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"name": "CI"}`))
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	tokens := "/projects/" + project.ID.String() + "/tokens"
+	for _, route := range []struct{ method, path string }{
+		{http.MethodPost, "/v1/resources" + tokens},
+		{http.MethodGet, "/v1/resources" + tokens + "/" + token.ID.String()},
+		{http.MethodPut, "/v1/resources" + tokens + "/" + token.ID.String()},
+		{http.MethodDelete, "/v1/resources" + tokens + "/" + token.ID.String()},
+		{http.MethodGet, "/v1" + tokens},
+	} {
+		if status := request(editor, route.method, route.path); status != http.StatusForbidden {
+			t.Errorf("%s %s with config.write = %d, want 403", route.method, route.path, status)
+		}
+	}
+
+	if status := request(keeper, http.MethodGet, "/v1/resources"+tokens+"/"+token.ID.String()); status != http.StatusOK {
+		t.Errorf("GET token resource with token.manage = %d, want 200", status)
+	}
+}
+
+func TestResourceProjectDeletionRequiresConfirmation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("DB_DRIVER", database.DriverSQLite)
+	t.Setenv("DB_DSN", t.TempDir()+"/envie.db")
+	previous := database.DB
+	database.Connect()
+	t.Cleanup(func() { database.DB = previous })
+
+	org := models.Organization{Name: "Acme"}
+	owner := models.User{ID: uuid.New(), Name: "Owner", Email: "owner@example.com", GithubID: 1, GoogleID: "1"}
+	seed := func(rows ...any) {
+		for _, row := range rows {
+			if err := database.DB.Create(row).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	seed(&org, &owner)
+	team := models.Team{ID: uuid.New(), OrganizationID: org.ID, Name: "Backend"}
+	project := models.Project{ID: uuid.New(), OrganizationID: org.ID, Name: "API", Slug: "api"}
+	seed(&team, &project,
+		&models.OrganizationUser{OrganizationID: org.ID, UserID: owner.ID, Role: "member"},
+		&models.TeamUser{TeamID: team.ID, UserID: owner.ID, EncryptedTeamKey: "a2V5", Role: "owner"},
+		&models.TeamProject{TeamID: team.ID, ProjectID: project.ID, EncryptedProjectKey: "a2V5"},
+		&models.ProjectToken{ID: uuid.New(), ProjectID: project.ID, Name: "CI", TokenPrefix: "abc", IdentityIDHash: "hash", EncryptedProjectKey: "a2V5", CreatedBy: owner.ID})
+
+	r := New(nil)
+	accessToken, err := auth.GenerateAccessToken(owner.ID, uuid.Nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := func(path string) int {
+		req := httptest.NewRequest(http.MethodDelete, path, nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	path := "/v1/resources/projects/" + project.ID.String()
+	if status := request(path); status != http.StatusConflict {
+		t.Fatalf("DELETE %s with an active token = %d, want 409", path, status)
+	}
+	if err := database.DB.First(&models.Project{}, "id = ?", project.ID).Error; err != nil {
+		t.Fatalf("project deleted despite the conflict: %v", err)
+	}
+	if status := request(path + "?force=true"); status != http.StatusNoContent {
+		t.Errorf("DELETE %s?force=true = %d, want 204", path, status)
+	}
+}
@@ -0,0 +1,78 @@
+package seed
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+
+	"envie-backend/internal/crypto"
+)
+
+func openAESGCM(t *testing.T, key, body []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := gcm.Open(nil, body[:crypto.IVSize], body[crypto.IVSize:], nil)
+	if err != nil {
+		t.Fatalf("decrypting: %v", err)
+	}
+	return plaintext
+}
+
+func TestEncryptValue(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	blob, err := EncryptValue(key, "postgres://localhost/demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alg, body, err := crypto.DecodeBlob(blob, crypto.AlgAESGCM)
+	if err != nil || alg != crypto.AlgAESGCM {
+		t.Fatalf("DecodeBlob = %v, %v", alg, err)
+	}
+	if got := string(openAESGCM(t, key, body)); got != "postgres://localhost/demo" {
+		t.Errorf("decrypted %q", got)
+	}
+}
+
+func TestWrapKey(t *testing.T) {
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	blob, err := WrapKey(private.PublicKey().Bytes(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alg, body, err := crypto.DecodeBlob(blob, crypto.AlgX25519SHA256)
+	if err != nil || alg != crypto.AlgX25519SHA256 {
+		t.Fatalf("DecodeBlob = %v, %v", alg, err)
+	}
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(body[:32])
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, err := private.ECDH(ephemeral)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aesKey := sha256.Sum256(shared)
+	if got := openAESGCM(t, aesKey[:], body[32:]); !bytes.Equal(got, key) {
+		t.Error("unwrapped a different key")
+	}
+}
@@ -0,0 +1,243 @@
+// Package settings holds the backend settings that can change without a
+// restart: the CORS origins, payload logging, chaos testing, the SMTP server
+// alerts are emailed through, the egress rules for webhooks, the admin token, the
+// superadmin emails and the usage limits.
+// Everything else is read once at startup.
+//
+// Reload reads .env, the config file and the environment again, validates the
+// result and swaps it in atomically, so a request sees either the old settings or the new ones.
+// It runs on SIGHUP and on POST /admin/reload. Invalid settings are rejected
+// and the current ones stay in use.
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"envie-backend/internal/alerts"
+	"envie-backend/internal/config"
+	"envie-backend/internal/egress"
+	"envie-backend/internal/limits"
+	"envie-backend/internal/middleware"
+
+	"github.com/joho/godotenv"
+)
+
+const (
+	dotenvFile    = ".env"
+	adminTokenEnv = "ADMIN_TOKEN"
+	superadminEnv = "SUPERADMIN_EMAILS"
+)
+
+// Settings are the reloadable settings
+type Settings struct {
+	AllowedOrigins []string
+	LogPayloads    bool
+	Chaos          middleware.ChaosConfig
+	Email          *alerts.EmailConfig // nil when SMTP_HOST is not set
+	Egress         *egress.Policy      // where webhooks may connect
+	AdminToken     string              // enables POST /admin/reload; empty disables it
+	// SuperadminEmails are instance administrators on top of the accounts given
+	// the role, lowercased
+	SuperadminEmails []string
+	Limits           limits.Limits // usage limits, overridable per organization
+	LoadedAt         time.Time
+}
+
+var (
+	current atomic.Pointer[Settings]
+	// reloads serializes loading, so concurrent reloads can't swap in stale
+	// settings after fresh ones
+	reloads sync.Mutex
+
+	// processEnv are the variables the process was started with, which take
+	// precedence over .env as with godotenv.Load. Nil until LoadDotenv.
+	processEnv map[string]bool
+	// configFile is the file LoadConfigFile read, empty without one
+	configFile string
+)
+
+// defaults are the settings in use before Init, as with an empty environment
+var defaults = &Settings{AllowedOrigins: middleware.DefaultAllowedOrigins}
+
+// LoadDotenv loads .env into the environment for the settings read at startup,
+// remembering which variables were set before so reloads keep them first
+func LoadDotenv() error {
+	processEnv = map[string]bool{}
+	for _, variable := range os.Environ() {
+		name, _, _ := strings.Cut(variable, "=")
+		processEnv[name] = true
+	}
+	return godotenv.Load(dotenvFile)
+}
+
+// LoadConfigFile loads the config file at path into the environment, below
+// the variables already set and .env, and remembers it for reloads. It is
+// called after LoadDotenv.
+func LoadConfigFile(path string) error {
+	values, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	for name, value := range values {
+		if _, set := os.LookupEnv(name); !set {
+			os.Setenv(name, value)
+		}
+	}
+	configFile = path
+	return nil
+}
+
+// FromEnv reads the settings through getenv
+func FromEnv(getenv func(string) string) (*Settings, error) {
+	chaos, err := middleware.ChaosConfigFrom(getenv)
+	if err != nil {
+		return nil, fmt.Errorf("chaos configuration: %w", err)
+	}
+	email, err := alerts.EmailConfigFrom(getenv)
+	if err != nil {
+		return nil, fmt.Errorf("SMTP configuration: %w", err)
+	}
+	egressPolicy, err := egress.PolicyFrom(getenv)
+	if err != nil {
+		return nil, fmt.Errorf("egress configuration: %w", err)
+	}
+	usageLimits, err := limits.From(getenv)
+	if err != nil {
+		return nil, fmt.Errorf("usage limits: %w", err)
+	}
+	return &Settings{
+		AllowedOrigins:   middleware.AllowedOriginsFrom(getenv),
+		LogPayloads:      middleware.PayloadLoggingEnabledFrom(getenv),
+		Chaos:            chaos,
+		Email:            email,
+		Egress:           egressPolicy,
+		AdminToken:       getenv(adminTokenEnv),
+		SuperadminEmails: superadminEmails(getenv(superadminEnv)),
+		Limits:           usageLimits,
+		LoadedAt:         time.Now(),
+	}, nil
+}
+
+// superadminEmails parses the comma-separated SUPERADMIN_EMAILS
+func superadminEmails(value string) []string {
+	var emails []string
+	for _, email := range strings.Split(value, ",") {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			emails = append(emails, email)
+		}
+	}
+	return emails
+}
+
+// Init reads the settings from the environment unless they were already
+func Init() (*Settings, error) {
+	reloads.Lock()
+	defer reloads.Unlock()
+
+	if s := current.Load(); s != nil {
+		return s, nil
+	}
+	s, err := FromEnv(os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+	current.Store(s)
+	return s, nil
+}
+
+// Current returns the settings in use
+func Current() *Settings {
+	if s := current.Load(); s != nil {
+		return s
+	}
+	return defaults
+}
+
+// EgressPolicy returns the egress rules in use, for clients to ask on every
+// connection
+func EgressPolicy() *egress.Policy {
+	return Current().Egress
+}
+
+// Reload reads .env, the config file and the environment again and swaps in
+// the new settings if they are valid
+func Reload() (*Settings, error) {
+	reloads.Lock()
+	defer reloads.Unlock()
+
+	dotenv, err := godotenv.Read(dotenvFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		dotenv, err = map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", dotenvFile, err)
+	}
+
+	file := map[string]string{}
+	if configFile != "" {
+		if file, err = config.Load(configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	s, err := FromEnv(lookup(dotenv, file))
+	if err != nil {
+		return nil, err
+	}
+	current.Store(s)
+	return s, nil
+}
+
+// lookup reads a variable from the process environment, or when the process
+// wasn't started with it from dotenv, then from the config file
+func lookup(dotenv, file map[string]string) func(string) string {
+	return func(name string) string {
+		if processEnv == nil || processEnv[name] {
+			return os.Getenv(name)
+		}
+		if value, ok := dotenv[name]; ok {
+			return value
+		}
+		return file[name]
+	}
+}
+
+// ReloadOnSignal reloads the settings whenever the process receives SIGHUP
+func ReloadOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			s, err := Reload()
+			if err != nil {
+				log.Printf("Settings not reloaded: %v", err)
+				continue
+			}
+			log.Printf("Settings reloaded: %s", s)
+		}
+	}()
+}
+
+// String describes the settings without secrets, for the log
+func (s *Settings) String() string {
+	email := "off"
+	if s.Email != nil {
+		email = "via " + s.Email.Host
+	}
+	chaos := "off"
+	if s.Chaos.Enabled() {
+		chaos = s.Chaos.String()
+	}
+	return fmt.Sprintf("CORS origins %s, payload logging %t, email %s, egress to %s, admin reload %t, %d superadmin emails, limits %s, chaos %s",
+		strings.Join(s.AllowedOrigins, ","), s.LogPayloads, email, s.Egress, s.AdminToken != "", len(s.SuperadminEmails), s.Limits, chaos)
+}
@@ -0,0 +1,101 @@
+package settings
+
+import (
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv(adminTokenEnv, "from-process")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "")
+	t.Setenv("LOG_PAYLOADS", "")
+	t.Cleanup(func() { current.Store(nil); processEnv = nil })
+
+	write := func(dotenv string) {
+		if err := os.WriteFile(dotenvFile, []byte(dotenv), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("CORS_ALLOWED_ORIGINS=https://old.example.com\nADMIN_TOKEN=from-file\n")
+	os.Unsetenv("CORS_ALLOWED_ORIGINS")
+	os.Unsetenv("LOG_PAYLOADS")
+	if err := LoadDotenv(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	write("CORS_ALLOWED_ORIGINS=https://new.example.com\nLOG_PAYLOADS=true\nADMIN_TOKEN=from-file\n")
+	s, err := Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(s.AllowedOrigins, []string{"https://new.example.com"}) || !s.LogPayloads || Current() != s {
+		t.Errorf("reloaded settings = %s", s)
+	}
+	if s.AdminToken != "from-process" {
+		t.Errorf("AdminToken = %q, the process environment should win over .env", s.AdminToken)
+	}
+
+	write("CHAOS_ERROR_PERCENT=200\n")
+	if _, err := Reload(); err == nil {
+		t.Error("invalid settings accepted")
+	}
+	if Current() != s {
+		t.Error("invalid settings replaced the current ones")
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv(adminTokenEnv, "from-process")
+	t.Setenv(superadminEnv, "")
+	t.Setenv("LOG_PAYLOADS", "")
+	t.Cleanup(func() { current.Store(nil); processEnv = nil; configFile = "" })
+	os.Unsetenv(superadminEnv)
+	os.Unsetenv("LOG_PAYLOADS")
+
+	if err := os.WriteFile(dotenvFile, []byte("LOG_PAYLOADS=false\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	write := func(content string) {
+		if err := os.WriteFile("envie.yaml", []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("admin_token: from-config\nlog_payloads: true\nsuperadmin_emails: [ops@example.com]\n")
+	if err := LoadDotenv(); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfigFile("envie.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.AdminToken != "from-process" || s.LogPayloads || !slices.Equal(s.SuperadminEmails, []string{"ops@example.com"}) {
+		t.Errorf("settings = %s, want the environment over .env over the config file", s)
+	}
+
+	write("superadmin_emails: [ops@example.com, admin@example.com]\n")
+	if s, err = Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.SuperadminEmails) != 2 {
+		t.Errorf("SuperadminEmails = %v after editing the config file", s.SuperadminEmails)
+	}
+}
+
+func TestSuperadminEmails(t *testing.T) {
+	got := superadminEmails(" Ops@Example.com, ,admin@example.com,")
+	if want := []string{"ops@example.com", "admin@example.com"}; !slices.Equal(got, want) {
+		t.Errorf("superadminEmails() = %v, want %v", got, want)
+	}
+	if got := superadminEmails(""); got != nil {
+		t.Errorf("superadminEmails(\"\") = %v", got)
+	}
+}
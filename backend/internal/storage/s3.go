@@ -12,6 +12,11 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var S3Client *s3.Client
@@ -51,34 +56,73 @@ func InitS3() error {
 	return nil
 }
 
+var tracer = otel.Tracer("envie-backend/internal/storage")
+
+// startSpan records an S3 call as a child of the span in ctx. Object keys are
+// recorded, they are IDs without user content.
+func startSpan(ctx context.Context, operation, key string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "S3 "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "aws-api"),
+			attribute.String("rpc.service", "S3"),
+			attribute.String("rpc.method", operation),
+			attribute.String("aws.s3.bucket", BucketName),
+			attribute.String("aws.s3.key", key),
+		),
+	)
+}
+
+// recordError marks span as failed unless err is nil
+func recordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
 func UploadFile(ctx context.Context, key string, data []byte, contentType string) error {
+	ctx, span := startSpan(ctx, "PutObject", key)
+	defer span.End()
+
 	_, err := S3Client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:      aws.String(BucketName),
 		Key:         aws.String(key),
 		Body:        bytes.NewReader(data),
 		ContentType: aws.String(contentType),
 	})
+	recordError(span, err)
 	return err
 }
 
 func DownloadFile(ctx context.Context, key string) ([]byte, error) {
+	ctx, span := startSpan(ctx, "GetObject", key)
+	defer span.End()
+
 	result, err := S3Client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(BucketName),
 		Key:    aws.String(key),
 	})
 	if err != nil {
+		recordError(span, err)
 		return nil, err
 	}
 	defer result.Body.Close()
 
-	return io.ReadAll(result.Body)
+	data, err := io.ReadAll(result.Body)
+	recordError(span, err)
+	return data, err
 }
 
 func DeleteFile(ctx context.Context, key string) error {
+	ctx, span := startSpan(ctx, "DeleteObject", key)
+	defer span.End()
+
 	_, err := S3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(BucketName),
 		Key:    aws.String(key),
 	})
+	recordError(span, err)
 	return err
 }
 
@@ -95,3 +139,120 @@ func GetPresignedURL(ctx context.Context, key string, expireSeconds int64) (stri
 
 	return request.URL, nil
 }
+
+// PartSize is the size of the parts UploadStream sends. S3 needs at least 5 MB
+// for all but the last part; one part is buffered at a time.
+const PartSize = 8 << 20
+
+// UploadStream uploads body without holding it in memory whole and returns the
+// number of bytes uploaded. Bodies up to PartSize go in a single PutObject,
+// larger ones as a multipart upload, which is aborted if reading body or
+// sending a part fails.
+func UploadStream(ctx context.Context, key string, body io.Reader, contentType string) (int64, error) {
+	buf := make([]byte, PartSize)
+	n, err := io.ReadFull(body, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return int64(n), UploadFile(ctx, key, buf[:n], contentType)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return uploadMultipart(ctx, key, body, buf, contentType)
+}
+
+// uploadMultipart sends first, a full part already read from body, and the
+// rest of body as a multipart upload
+func uploadMultipart(ctx context.Context, key string, body io.Reader, first []byte, contentType string) (int64, error) {
+	ctx, span := startSpan(ctx, "MultipartUpload", key)
+	defer span.End()
+
+	upload, err := S3Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(BucketName),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		recordError(span, err)
+		return 0, err
+	}
+
+	abort := func(err error) (int64, error) {
+		recordError(span, err)
+		// The upload's parts are billed until it's completed or aborted
+		S3Client.AbortMultipartUpload(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(BucketName),
+			Key:      aws.String(key),
+			UploadId: upload.UploadId,
+		})
+		return 0, err
+	}
+
+	var parts []types.CompletedPart
+	var total int64
+	part := first
+	for number := int32(1); len(part) > 0; number++ {
+		result, err := S3Client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(BucketName),
+			Key:        aws.String(key),
+			UploadId:   upload.UploadId,
+			PartNumber: aws.Int32(number),
+			Body:       bytes.NewReader(part),
+		})
+		if err != nil {
+			return abort(err)
+		}
+		parts = append(parts, types.CompletedPart{ETag: result.ETag, PartNumber: aws.Int32(number)})
+		total += int64(len(part))
+
+		n, err := io.ReadFull(body, first)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return abort(err)
+		}
+		part = first[:n]
+	}
+
+	_, err = S3Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(BucketName),
+		Key:             aws.String(key),
+		UploadId:        upload.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return abort(err)
+	}
+	return total, nil
+}
+
+// PresignUpload returns a URL that accepts a PUT of exactly size bytes to key,
+// so clients can upload large files without passing them through the backend
+func PresignUpload(ctx context.Context, key string, size int64, expires time.Duration) (string, error) {
+	presignClient := s3.NewPresignClient(S3Client)
+
+	request, err := presignClient.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(BucketName),
+		Key:           aws.String(key),
+		ContentLength: aws.Int64(size),
+		ContentType:   aws.String("application/octet-stream"),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", err
+	}
+
+	return request.URL, nil
+}
+
+// FileSize returns the size of the object at key
+func FileSize(ctx context.Context, key string) (int64, error) {
+	ctx, span := startSpan(ctx, "HeadObject", key)
+	defer span.End()
+
+	result, err := S3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(BucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		recordError(span, err)
+		return 0, err
+	}
+	return aws.ToInt64(result.ContentLength), nil
+}
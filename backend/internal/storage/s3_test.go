@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestRecordError(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	_, failed := tracer.Start(context.Background(), "S3 GetObject")
+	recordError(failed, errors.New("NoSuchKey"))
+	failed.End()
+	_, succeeded := tracer.Start(context.Background(), "S3 PutObject")
+	recordError(succeeded, nil)
+	succeeded.End()
+
+	spans := recorder.Ended()
+	if status := spans[0].Status(); status.Code != codes.Error || status.Description != "NoSuchKey" || len(spans[0].Events()) != 1 {
+		t.Errorf("failed span: status %+v, events %v", status, spans[0].Events())
+	}
+	if status := spans[1].Status(); status.Code != codes.Unset || len(spans[1].Events()) != 0 {
+		t.Errorf("succeeded span: status %+v, events %v", status, spans[1].Events())
+	}
+
+	// Spans are no-ops while tracing is disabled
+	_, span := noop.NewTracerProvider().Tracer("test").Start(context.Background(), "S3 DeleteObject")
+	recordError(span, errors.New("AccessDenied"))
+}
@@ -0,0 +1,246 @@
+// Package tokenwatch flags unusual use of CLI tokens as it happens: the first use
+// from a network the token wasn't used from before, an hour with far more
+// requests than the token usually makes, and use after a long dormancy.
+//
+// Each anomaly is stored for review and acknowledgement and notifies the project's
+// admins in the notification center. Organizations reach email and webhooks
+// through an organization alert on models.AlertMetricTokenAnomalies.
+//
+// Networks are IPv4 /24 and IPv6 /48 ranges. A country or ASN change would need
+// a GeoIP database, which the server doesn't ship; a new range is the closest
+// signal available from the address alone.
+package tokenwatch
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"time"
+
+	"envie-backend/internal/database"
+	"envie-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// DormancyPeriod is how long a token has to go unused for its next use to
+	// be flagged
+	DormancyPeriod = 30 * 24 * time.Hour
+
+	// A spike is an hour with at least spikeMinimum requests and spikeFactor
+	// times the token's average over baselineWindow
+	spikeMinimum   = 100
+	spikeFactor    = 10
+	baselineWindow = 7 * 24 * time.Hour
+)
+
+// Observe records a request made with token from ip and flags what is unusual
+// about it. Call it in the background after the token was authenticated; token
+// must still carry the LastUsedAt from before this request.
+func Observe(db *gorm.DB, token *models.ProjectToken, ip string, now time.Time) error {
+	var anomalies []models.TokenAnomaly
+	flag := func(kind, detail string) {
+		anomalies = append(anomalies, models.TokenAnomaly{Kind: kind, Detail: detail})
+	}
+
+	if Dormant(token.LastUsedAt, now) {
+		open, err := flaggedSince(db, token.ID, models.TokenAnomalyDormantUse, *token.LastUsedAt)
+		if err != nil {
+			return err
+		}
+		if !open {
+			flag(models.TokenAnomalyDormantUse, fmt.Sprintf("First use in %d days", int(now.Sub(*token.LastUsedAt).Hours()/24)))
+		}
+	}
+
+	if network, ok := NetworkOf(ip); ok {
+		isNew, err := recordNetwork(db, token.ID, network, now)
+		if err != nil {
+			return err
+		}
+		if isNew {
+			flag(models.TokenAnomalyNewNetwork, "First use from "+network)
+		}
+	}
+
+	count, baseline, err := recordRequest(db, token.ID, now)
+	if err != nil {
+		return err
+	}
+	if IsSpike(count, baseline) {
+		hour := now.UTC().Truncate(time.Hour)
+		open, err := flaggedSince(db, token.ID, models.TokenAnomalyVolumeSpike, hour)
+		if err != nil {
+			return err
+		}
+		if !open {
+			flag(models.TokenAnomalyVolumeSpike, fmt.Sprintf("%d requests this hour, usually %.1f", count, baseline))
+		}
+	}
+
+	if len(anomalies) == 0 {
+		return nil
+	}
+	return report(db, token, ip, anomalies)
+}
+
+// ObserveInBackground runs Observe without delaying the request, logging failures
+func ObserveInBackground(token *models.ProjectToken, ip string) {
+	now := time.Now()
+	go func() {
+		if err := Observe(database.DB, token, ip, now); err != nil {
+			log.Printf("Failed to check use of CLI token %s: %v", token.ID, err)
+		}
+	}()
+}
+
+// Dormant reports whether a token last used at lastUsedAt was dormant until now.
+// A token's first use isn't dormant.
+func Dormant(lastUsedAt *time.Time, now time.Time) bool {
+	return lastUsedAt != nil && now.Sub(*lastUsedAt) > DormancyPeriod
+}
+
+// NetworkOf returns the /24 (IPv4) or /48 (IPv6) range containing ip
+func NetworkOf(ip string) (string, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", false
+	}
+	addr = addr.Unmap()
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return "", false
+	}
+	return prefix.String(), true
+}
+
+// IsSpike reports whether count requests in an hour is a spike for a token that
+// averages baseline requests an hour
+func IsSpike(count int64, baseline float64) bool {
+	return count >= spikeMinimum && float64(count) > spikeFactor*baseline
+}
+
+// recordNetwork adds network to the token's networks and reports whether it is
+// new for a token that was already used from another one
+func recordNetwork(db *gorm.DB, tokenID uuid.UUID, network string, now time.Time) (bool, error) {
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.TokenNetwork{TokenID: tokenID, Network: network, FirstSeenAt: now})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+
+	var networks int64
+	if err := db.Model(&models.TokenNetwork{}).Where("token_id = ?", tokenID).Count(&networks).Error; err != nil {
+		return false, err
+	}
+	return networks > 1, nil
+}
+
+// recordRequest counts a request in the token's current hour and returns that
+// hour's count with the token's hourly average over the baseline window before it
+func recordRequest(db *gorm.DB, tokenID uuid.UUID, now time.Time) (int64, float64, error) {
+	hour := now.UTC().Truncate(time.Hour)
+	bucket := models.TokenUsageBucket{TokenID: tokenID, Hour: hour, Count: 1}
+	err := db.Clauses(
+		clause.OnConflict{
+			Columns:   []clause.Column{{Name: "token_id"}, {Name: "hour"}},
+			DoUpdates: clause.Assignments(map[string]any{"count": gorm.Expr("token_usage_buckets.count + 1")}),
+		},
+		clause.Returning{Columns: []clause.Column{{Name: "count"}}},
+	).Create(&bucket).Error
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if bucket.Count == 1 {
+		// A new hour: drop the buckets that left the window
+		if err := db.Where("token_id = ? AND hour < ?", tokenID, hour.Add(-baselineWindow)).Delete(&models.TokenUsageBucket{}).Error; err != nil {
+			return 0, 0, err
+		}
+	}
+	if bucket.Count < spikeMinimum {
+		return bucket.Count, 0, nil // can't be a spike, skip the baseline
+	}
+
+	var total int64
+	if err := db.Model(&models.TokenUsageBucket{}).Select("COALESCE(SUM(count), 0)").
+		Where("token_id = ? AND hour >= ? AND hour < ?", tokenID, hour.Add(-baselineWindow), hour).
+		Scan(&total).Error; err != nil {
+		return 0, 0, err
+	}
+	return bucket.Count, float64(total) / baselineWindow.Hours(), nil
+}
+
+// flaggedSince reports whether the token has an anomaly of kind since the time
+func flaggedSince(db *gorm.DB, tokenID uuid.UUID, kind string, since time.Time) (bool, error) {
+	var anomaly models.TokenAnomaly
+	err := db.Select("id").Where("token_id = ? AND kind = ? AND created_at >= ?", tokenID, kind, since).First(&anomaly).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// report stores the anomalies and notifies the project's admins
+func report(db *gorm.DB, token *models.ProjectToken, ip string, anomalies []models.TokenAnomaly) error {
+	var project models.Project
+	if err := db.Select("id, name, organization_id").First(&project, "id = ?", token.ProjectID).Error; err != nil {
+		return err
+	}
+
+	for i := range anomalies {
+		anomalies[i].OrganizationID = project.OrganizationID
+		anomalies[i].ProjectID = project.ID
+		anomalies[i].TokenID = token.ID
+		anomalies[i].TokenName = token.Name
+		anomalies[i].ClientIP = ip
+	}
+	if err := db.Create(&anomalies).Error; err != nil {
+		return err
+	}
+	return notifyAdmins(db, &project, token, anomalies)
+}
+
+// notifyAdmins adds a notification per anomaly for every organization admin and
+// every admin of a team with access to the project
+func notifyAdmins(db *gorm.DB, project *models.Project, token *models.ProjectToken, anomalies []models.TokenAnomaly) error {
+	var userIDs []uuid.UUID
+	if err := db.Raw(`
+		SELECT user_id FROM organization_users
+		WHERE organization_id = ? AND (role = 'owner' OR role = 'Owner' OR role = 'admin')
+
+		UNION
+
+		SELECT team_users.user_id FROM team_users
+		JOIN team_projects ON team_projects.team_id = team_users.team_id
+		WHERE team_projects.project_id = ? AND (team_users.role = 'owner' OR team_users.role = 'admin')
+	`, project.OrganizationID, project.ID).Scan(&userIDs).Error; err != nil {
+		return err
+	}
+
+	var notifications []models.Notification
+	for _, userID := range userIDs {
+		for _, anomaly := range anomalies {
+			notifications = append(notifications, models.Notification{
+				UserID:         userID,
+				Kind:           models.NotificationTokenAnomaly,
+				Title:          fmt.Sprintf("Unusual use of token %s in %s", token.Name, project.Name),
+				Body:           anomaly.Detail + " (" + anomaly.ClientIP + ")",
+				OrganizationID: &project.OrganizationID,
+				ProjectID:      &project.ID,
+			})
+		}
+	}
+	if len(notifications) == 0 {
+		return nil
+	}
+	return db.Create(&notifications).Error
+}
@@ -0,0 +1,47 @@
+package tokenwatch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNetworkOf(t *testing.T) {
+	for ip, want := range map[string]string{
+		"203.0.113.77":        "203.0.113.0/24",
+		"::ffff:203.0.113.77": "203.0.113.0/24",
+		"2001:db8:1234:5::9":  "2001:db8:1234::/48",
+	} {
+		if got, ok := NetworkOf(ip); !ok || got != want {
+			t.Errorf("NetworkOf(%q) = %q, %v, want %q", ip, got, ok, want)
+		}
+	}
+	if _, ok := NetworkOf("unknown"); ok {
+		t.Error("invalid address has a network")
+	}
+}
+
+func TestIsSpike(t *testing.T) {
+	tests := []struct {
+		count    int64
+		baseline float64
+		want     bool
+	}{
+		{99, 0, false},   // below the minimum, even for an idle token
+		{100, 0, true},   // a burst from a token that is never used
+		{500, 60, false}, // a busy token having a busy hour
+		{700, 60, true},
+	}
+	for _, tt := range tests {
+		if got := IsSpike(tt.count, tt.baseline); got != tt.want {
+			t.Errorf("IsSpike(%d, %.1f) = %v, want %v", tt.count, tt.baseline, got, tt.want)
+		}
+	}
+}
+
+func TestDormant(t *testing.T) {
+	now := time.Now()
+	recent, old := now.Add(-24*time.Hour), now.Add(-DormancyPeriod-time.Hour)
+	if Dormant(nil, now) || Dormant(&recent, now) || !Dormant(&old, now) {
+		t.Error("dormancy misjudged")
+	}
+}
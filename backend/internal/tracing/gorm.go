@@ -0,0 +1,13 @@
+package tracing
+
+import (
+	"github.com/uptrace/opentelemetry-go-extra/otelgorm"
+	"gorm.io/gorm"
+)
+
+// RegisterCallbacks records a client span for every GORM statement, as a child
+// of the span in its context, i.e. through db.WithContext(ctx), or in a trace of
+// its own. The recorded SQL has its bound values masked.
+func RegisterCallbacks(db *gorm.DB) error {
+	return db.Use(otelgorm.NewPlugin(otelgorm.WithoutQueryVariables(), otelgorm.WithoutMetrics()))
+}
@@ -0,0 +1,89 @@
+// Package tracing sets up OpenTelemetry tracing, exporting spans to a collector
+// over OTLP/HTTP.
+//
+// Spans travel in the context: otelgin starts a server span for each request,
+// continuing the caller's W3C traceparent, and GORM statements and S3 calls made
+// with that context become its children. Span attributes never carry request
+// bodies, query strings, bound SQL values or config values.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	otlpEndpointEnv       = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	otlpTracesEndpointEnv = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	samplerArgEnv         = "OTEL_TRACES_SAMPLER_ARG"
+
+	// ServiceName is the default service.name, OTEL_SERVICE_NAME overrides it
+	ServiceName = "envie-backend"
+)
+
+var enabled atomic.Bool
+
+// Enabled reports whether a tracer provider is installed
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// SetTracerProvider installs tp as the global tracer provider, propagating W3C
+// trace context
+func SetTracerProvider(tp trace.TracerProvider) {
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	enabled.Store(true)
+}
+
+// FromEnv returns a tracer provider configured by the standard OTEL_* variables,
+// or nil when neither OTEL_EXPORTER_OTLP_TRACES_ENDPOINT nor
+// OTEL_EXPORTER_OTLP_ENDPOINT is set. The exporter reads the endpoint and
+// headers itself.
+func FromEnv(version string) (*sdktrace.TracerProvider, error) {
+	if os.Getenv(otlpTracesEndpointEnv) == "" && os.Getenv(otlpEndpointEnv) == "" {
+		return nil, nil
+	}
+
+	ratio := 1.0
+	if value := os.Getenv(samplerArgEnv); value != "" {
+		var err error
+		ratio, err = strconv.ParseFloat(value, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return nil, fmt.Errorf("invalid %s %q: must be between 0 and 1", samplerArgEnv, value)
+		}
+	}
+
+	ctx := context.Background()
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(ServiceName), semconv.ServiceVersion(version)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tracing resource: %w", err)
+	}
+
+	// Requests that arrive with a traceparent follow the caller's sampling
+	// decision
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	), nil
+}
@@ -0,0 +1,162 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"gorm.io/gorm"
+)
+
+// install records spans in memory through the global tracer provider
+func install(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		enabled.Store(false)
+	})
+	return recorder
+}
+
+func attributes(s sdktrace.ReadOnlySpan) map[attribute.Key]string {
+	attrs := map[attribute.Key]string{}
+	for _, kv := range s.Attributes() {
+		attrs[kv.Key] = kv.Value.Emit()
+	}
+	for _, kv := range s.Resource().Attributes() {
+		attrs[kv.Key] = kv.Value.Emit()
+	}
+	return attrs
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv(otlpEndpointEnv, "")
+	t.Setenv(otlpTracesEndpointEnv, "")
+	if provider, err := FromEnv("dev"); provider != nil || err != nil {
+		t.Errorf("FromEnv without an endpoint = %v, %v", provider, err)
+	}
+
+	var mu sync.Mutex
+	var paths, teams []string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, r.URL.Path)
+		teams = append(teams, r.Header.Get("x-team"))
+	}))
+	defer collector.Close()
+
+	t.Setenv(otlpEndpointEnv, collector.URL+"/")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "x-api-key=secret,x-team=core")
+	t.Setenv("OTEL_SERVICE_NAME", "envie-staging")
+	provider, err := FromEnv("1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	provider.RegisterSpanProcessor(recorder)
+	_, span := provider.Tracer("test").Start(context.Background(), "GET /v1/projects")
+	span.End()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := provider.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if len(paths) != 1 || paths[0] != "/v1/traces" || teams[0] != "core" {
+		t.Errorf("collector received %v with x-team %v", paths, teams)
+	}
+	mu.Unlock()
+	attrs := attributes(recorder.Ended()[0])
+	if attrs["service.name"] != "envie-staging" || attrs["service.version"] != "1.0.0" {
+		t.Errorf("resource = %v", attrs)
+	}
+
+	for _, value := range []string{"2", "-0.5", "half"} {
+		t.Setenv(samplerArgEnv, value)
+		if _, err := FromEnv("dev"); err == nil {
+			t.Errorf("%s=%s accepted", samplerArgEnv, value)
+		}
+	}
+}
+
+// New traces are sampled by ratio, requests with a traceparent follow the caller
+func TestSampling(t *testing.T) {
+	t.Setenv(otlpEndpointEnv, "http://127.0.0.1:0")
+	t.Setenv(samplerArgEnv, "0")
+	provider, err := FromEnv("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer := provider.Tracer("test")
+
+	_, root := tracer.Start(context.Background(), "GET /v1/projects")
+	if root.SpanContext().IsSampled() {
+		t.Error("new trace sampled at ratio 0")
+	}
+
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	_, child := tracer.Start(trace.ContextWithRemoteSpanContext(context.Background(), parent), "GET /v1/projects")
+	if !child.SpanContext().IsSampled() || child.SpanContext().TraceID() != parent.TraceID() {
+		t.Errorf("child of a sampled caller = %+v", child.SpanContext())
+	}
+}
+
+func TestGormCallbacks(t *testing.T) {
+	recorder := install(t)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterCallbacks(db); err != nil {
+		t.Fatal(err)
+	}
+	type project struct {
+		ID   uint
+		Name string
+	}
+	if err := db.AutoMigrate(&project{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, root := otel.Tracer("test").Start(context.Background(), "GET /v1/projects")
+	db.WithContext(ctx).Where("name = ?", "api").Find(&[]project{})
+	root.End()
+
+	var query sdktrace.ReadOnlySpan
+	for _, s := range recorder.Ended() {
+		if s.Name() == "gorm.Query" {
+			query = s
+		}
+	}
+	if query == nil || query.Parent().SpanID() != root.SpanContext().SpanID() {
+		t.Fatalf("query span = %v", query)
+	}
+	for key, value := range attributes(query) {
+		if strings.Contains(value, "api") {
+			t.Errorf("bound value recorded in %s: %s", key, value)
+		}
+	}
+	if statement := attributes(query)["db.statement"]; !strings.Contains(statement, "name =") {
+		t.Errorf("db.statement = %s", statement)
+	}
+}
@@ -0,0 +1,144 @@
+// Package validation adds the request rules of the API to gin's binding validator
+// and describes failed validations field by field.
+//
+// Besides the validator's built-in tags (required, max, uuid, oneof...), request
+// structs can use:
+//   - ciphertext: an encrypted blob, "$" + base64 of a known algorithm or legacy
+//     plain base64 (see crypto.DecodeBlob)
+//   - name: a display name without control characters or surrounding spaces
+//
+// Importing the package registers them.
+package validation
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"envie-backend/internal/crypto"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	engine, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		panic("validation: gin's validator is not go-playground/validator")
+	}
+	Register(engine)
+}
+
+// Register adds the API's tags to v and makes it report fields by their JSON name
+func Register(v *validator.Validate) {
+	v.RegisterTagNameFunc(jsonName)
+	v.RegisterValidation("ciphertext", func(fl validator.FieldLevel) bool {
+		return IsCiphertext(fl.Field().String())
+	})
+	v.RegisterValidation("name", func(fl validator.FieldLevel) bool {
+		return IsName(fl.Field().String())
+	})
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	}
+	return name
+}
+
+// IsCiphertext reports whether s has the shape of an encrypted blob. Empty
+// strings don't; pair the tag with omitempty for optional fields.
+func IsCiphertext(s string) bool {
+	if s == "" {
+		return false
+	}
+	if crypto.IsVersionedBlob(s) {
+		_, _, err := crypto.DecodeBlob(s, 0)
+		return err == nil
+	}
+	_, err := base64.StdEncoding.DecodeString(s)
+	return err == nil
+}
+
+// IsName reports whether s is usable as a display name: not blank, no control
+// characters and no leading or trailing whitespace. Length is left to max.
+func IsName(s string) bool {
+	if strings.TrimSpace(s) != s || s == "" {
+		return false
+	}
+	for _, r := range s {
+		if unicode.IsControl(r) || r == unicode.ReplacementChar {
+			return false
+		}
+	}
+	return true
+}
+
+// FieldError is a field of a request that failed validation
+type FieldError struct {
+	Field   string `json:"field"` // JSON path, such as grants[2].encryptedTeamKey
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Fields describes the failed validations of err, or returns nil when err isn't
+// a validation error
+func Fields(err error) []FieldError {
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+	fields := make([]FieldError, 0, len(errs))
+	for _, e := range errs {
+		field := e.Namespace()
+		// The namespace starts with the Go name of the request struct
+		if _, rest, ok := strings.Cut(field, "."); ok {
+			field = rest
+		}
+		fields = append(fields, FieldError{Field: field, Rule: e.Tag(), Message: message(field, e)})
+	}
+	return fields
+}
+
+func message(field string, e validator.FieldError) string {
+	unit := "characters"
+	switch e.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit = "items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		unit = ""
+	}
+
+	switch e.Tag() {
+	case "required":
+		return field + " is required"
+	case "max", "lte":
+		if unit == "" {
+			return fmt.Sprintf("%s must be at most %s", field, e.Param())
+		}
+		return fmt.Sprintf("%s must have at most %s %s", field, e.Param(), unit)
+	case "min", "gte":
+		if unit == "" {
+			return fmt.Sprintf("%s must be at least %s", field, e.Param())
+		}
+		return fmt.Sprintf("%s must have at least %s %s", field, e.Param(), unit)
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", field, strings.ReplaceAll(e.Param(), " ", ", "))
+	case "uuid":
+		return field + " must be a UUID"
+	case "ciphertext":
+		return field + " must be base64 encoded ciphertext"
+	case "name":
+		return field + " must not be blank, start or end with spaces, or contain control characters"
+	}
+	return field + " is invalid"
+}
@@ -0,0 +1,76 @@
+package validation
+
+import (
+	"testing"
+
+	"envie-backend/internal/crypto"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+func TestIsCiphertext(t *testing.T) {
+	for value, want := range map[string]bool{
+		crypto.EncodeBlob(crypto.AlgAESGCM, []byte("body")): true,
+		"bGVnYWN5IGJsb2I=": true, // legacy blobs are plain base64
+		"":                 false,
+		"$":                false,
+		"$" + "/w==":       false, // unknown algorithm 0xff
+		"not base64!":      false,
+		"bGVnYWN5IGJsb2I":  false, // missing padding
+	} {
+		if got := IsCiphertext(value); got != want {
+			t.Errorf("IsCiphertext(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestIsName(t *testing.T) {
+	for value, want := range map[string]bool{
+		"Production":    true,
+		"API keys (EU)": true,
+		"Zürich":        true,
+		"":              false,
+		"   ":           false,
+		" padded":       false,
+		"line\nbreak":   false,
+		"nul\x00":       false,
+		"bad\xffutf8":   false,
+	} {
+		if got := IsName(value); got != want {
+			t.Errorf("IsName(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	type grant struct {
+		TeamID string `json:"teamId" binding:"required,uuid"`
+		Key    string `json:"encryptedKey" binding:"required,ciphertext"`
+	}
+	type request struct {
+		Name   string  `json:"name" binding:"required,max=5,name"`
+		Grants []grant `json:"grants" binding:"required,min=1,dive"`
+	}
+
+	err := binding.Validator.ValidateStruct(&request{
+		Name:   "Too long",
+		Grants: []grant{{TeamID: "nope", Key: "bGVnYWN5"}},
+	})
+	fields := Fields(err)
+	want := []FieldError{
+		{Field: "name", Rule: "max", Message: "name must have at most 5 characters"},
+		{Field: "grants[0].teamId", Rule: "uuid", Message: "grants[0].teamId must be a UUID"},
+	}
+	if len(fields) != len(want) {
+		t.Fatalf("fields = %+v, want %+v", fields, want)
+	}
+	for i := range want {
+		if fields[i] != want[i] {
+			t.Errorf("fields[%d] = %+v, want %+v", i, fields[i], want[i])
+		}
+	}
+
+	if Fields(nil) != nil {
+		t.Error("Fields(nil) is not nil")
+	}
+}
@@ -10,9 +10,13 @@ import (
 	"github.com/stranavad/envie/cli/internal/config"
 	"github.com/stranavad/envie/cli/internal/crypto"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
-var authToken string
+var (
+	authToken   string
+	authEncrypt bool
+)
 
 var authCmd = &cobra.Command{
 	Use:   "auth",
@@ -27,8 +31,13 @@ Project tokens are created in the Envie desktop app:
 
 Note: Each token is tied to a specific project and is read-only.
 
+On shared machines, use --encrypt to protect the stored token with a
+passphrase (Argon2id + AES-GCM). The passphrase is prompted for on each use,
+or read from ENVIE_PASSPHRASE.
+
 Usage:
   envie auth --token envie_xxxxx
+  envie auth --encrypt
   envie auth  # Interactive prompt`,
 	RunE: runAuth,
 }
@@ -53,6 +62,7 @@ func init() {
 	rootCmd.AddCommand(whoamiCmd)
 
 	authCmd.Flags().StringVar(&authToken, "token", "", "CLI identity token")
+	authCmd.Flags().BoolVar(&authEncrypt, "encrypt", false, "Protect the stored token with a passphrase")
 }
 
 func runAuth(cmd *cobra.Command, args []string) error {
@@ -101,6 +111,17 @@ func runAuth(cmd *cobra.Command, args []string) error {
 	creds := &config.Credentials{
 		Token: tokenValue,
 	}
+	if authEncrypt {
+		passphrase, err := readPassphrase("Choose a passphrase: ", true)
+		if err != nil {
+			return err
+		}
+		envelope, err := crypto.EncryptWithPassphrase([]byte(tokenValue), passphrase)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt token: %w", err)
+		}
+		creds = &config.Credentials{EncryptedToken: envelope}
+	}
 	if err := config.StoreCredentials(creds); err != nil {
 		return fmt.Errorf("failed to store credentials: %w", err)
 	}
@@ -115,6 +136,9 @@ func runAuth(cmd *cobra.Command, args []string) error {
 		fmt.Printf("  Expires: never\n")
 	}
 	fmt.Printf("  Credentials saved to: %s\n", credsPath)
+	if authEncrypt {
+		fmt.Printf("  Token is encrypted with your passphrase\n")
+	}
 
 	return nil
 }
@@ -128,15 +152,9 @@ func runLogout(cmd *cobra.Command, args []string) error {
 }
 
 func runWhoami(cmd *cobra.Command, args []string) error {
-	// Get token
 	tokenValue, err := getToken()
 	if err != nil {
-		// Try loading from credentials file
-		creds, err := config.LoadCredentials()
-		if err != nil {
-			return fmt.Errorf("not authenticated: run 'envie auth' first")
-		}
-		tokenValue = creds.Token
+		return err
 	}
 
 	// Parse and verify
@@ -153,6 +171,9 @@ func runWhoami(cmd *cobra.Command, args []string) error {
 
 	fmt.Printf("Project:    %s\n", info.ProjectName)
 	fmt.Printf("Project ID: %s\n", info.ProjectID)
+	if info.ProjectSlug != "" {
+		fmt.Printf("Slug:       %s\n", info.ProjectSlug)
+	}
 	fmt.Printf("Token:      %s\n", info.TokenName)
 	if info.ExpiresAt != nil {
 		fmt.Printf("Expires:    %s\n", *info.ExpiresAt)
@@ -162,3 +183,44 @@ func runWhoami(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// readPassphrase returns ENVIE_PASSPHRASE if set, otherwise prompts on the terminal
+// without echo. With confirm set, a new passphrase is being chosen and must be
+// entered twice; otherwise it unlocks the stored token.
+func readPassphrase(prompt string, confirm bool) (string, error) {
+	if envPassphrase := os.Getenv("ENVIE_PASSPHRASE"); envPassphrase != "" {
+		return envPassphrase, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		if confirm {
+			return "", fmt.Errorf("no terminal to choose a passphrase: set ENVIE_PASSPHRASE or run in an interactive terminal")
+		}
+		return "", fmt.Errorf("stored token is encrypted: set ENVIE_PASSPHRASE or run in an interactive terminal")
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	if len(passphrase) == 0 {
+		return "", fmt.Errorf("passphrase must not be empty")
+	}
+
+	if confirm {
+		fmt.Fprint(os.Stderr, "Confirm passphrase: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		if string(again) != string(passphrase) {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+	}
+
+	return string(passphrase), nil
+}
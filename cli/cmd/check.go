@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/stranavad/envie/cli/internal/api"
+	"github.com/stranavad/envie/cli/internal/crypto"
+	"github.com/stranavad/envie/cli/internal/dotenv"
+	"github.com/stranavad/envie/cli/internal/schema"
+)
+
+var (
+	checkEnvFile string
+	checkFormat  string
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check the project config against its required variables",
+	Long: `Fetch the project's schema and config and verify that every required variable
+is defined, not empty, of its type and matching its pattern. Values are checked
+after decrypting them on this machine. With --env-file, a local .env file is
+checked against the same schema as well.
+
+Exits non-zero when a variable is missing or invalid, so it can gate a CI
+deployment. --format json prints a report per source for other tools to read.
+
+Examples:
+  envie check --project my-api
+  envie check --project my-api --env-file .env --format json`,
+	RunE: runCheck,
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+	checkCmd.Flags().StringVar(&checkEnvFile, "env-file", "", "Also check this .env file")
+	checkCmd.Flags().StringVarP(&checkFormat, "format", "f", "text", "Output format: text, json")
+}
+
+func runCheck(cmd *cobra.Command, args []string) error {
+	if checkFormat != "text" && checkFormat != "json" {
+		return fmt.Errorf("unknown format: %s (use text or json)", checkFormat)
+	}
+
+	tokenValue, err := getToken()
+	if err != nil {
+		return err
+	}
+	projectID, err := getProject()
+	if err != nil {
+		return err
+	}
+	identity, err := crypto.ParseToken(tokenValue)
+	if err != nil {
+		return fmt.Errorf("invalid token: %w", err)
+	}
+
+	client, err := newClient(identity.IdentityID)
+	if err != nil {
+		return err
+	}
+	projectSchema, err := client.GetProjectSchema(projectID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch schema: %w", err)
+	}
+	configResp, err := client.GetProjectConfig(projectID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch config: %w", err)
+	}
+
+	values, masked, err := decryptReadableConfig(identity, configResp)
+	if err != nil {
+		return err
+	}
+	reports := []schema.Report{schema.Check("project", projectSchema.Variables, values, masked)}
+
+	if checkEnvFile != "" {
+		data, err := os.ReadFile(checkEnvFile)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", checkEnvFile, err)
+		}
+		local, err := dotenv.Parse(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", checkEnvFile, err)
+		}
+		reports = append(reports, schema.Check(checkEnvFile, projectSchema.Variables, local, nil))
+	}
+
+	if checkFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(map[string]any{"reports": reports}); err != nil {
+			return err
+		}
+	} else {
+		printCheckReports(reports)
+	}
+
+	problems := 0
+	for _, report := range reports {
+		problems += len(report.Problems)
+	}
+	if problems > 0 {
+		return fmt.Errorf("check failed: %d problem(s)", problems)
+	}
+	return nil
+}
+
+// decryptReadableConfig decrypts the config values the token can read. Sensitive
+// items masked for tokens without the secrets.reveal scope are returned by name.
+func decryptReadableConfig(identity *crypto.DerivedIdentity, configResp *api.ProjectConfigResponse) (map[string]string, []string, error) {
+	var masked []string
+	readable := *configResp
+	readable.Items = nil
+	for _, item := range configResp.Items {
+		if item.Masked {
+			masked = append(masked, item.Name)
+		} else {
+			readable.Items = append(readable.Items, item)
+		}
+	}
+
+	_, values, err := decryptProjectConfig(identity, &readable)
+	return values, masked, err
+}
+
+func printCheckReports(reports []schema.Report) {
+	for _, report := range reports {
+		if report.Checked == 0 {
+			fmt.Printf("%s: the project has no required variables\n", report.Source)
+			continue
+		}
+		for _, problem := range report.Problems {
+			fmt.Printf("✗ %s: %s %s\n", report.Source, problem.Name, problem.Detail)
+		}
+		for _, name := range report.Unchecked {
+			fmt.Printf("! %s: %s is sensitive, only checked to be defined (token lacks secrets.reveal)\n", report.Source, name)
+		}
+		if report.OK() {
+			fmt.Printf("✓ %s: all %d required variables are valid\n", report.Source, report.Checked)
+		}
+	}
+}
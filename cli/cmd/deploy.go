@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stranavad/envie/cli/internal/api"
+	"github.com/stranavad/envie/cli/internal/crypto"
+	"github.com/stranavad/envie/cli/internal/deploy"
+)
+
+var deployTarget string
+
+var deployCmd = &cobra.Command{
+	Use:   "deploy",
+	Short: "Sync secrets to deployment platforms",
+	Long: `Push project secrets to Vercel, Netlify or Fly.io environment variables.
+
+Deployment targets are configured per project in the Envie desktop app. Secrets
+are decrypted locally and sent directly to the provider's API - the Envie server
+only records the sync status.`,
+}
+
+var deployTargetsCmd = &cobra.Command{
+	Use:   "targets",
+	Short: "List deployment targets for a project",
+	RunE:  runDeployTargets,
+}
+
+var deploySyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Push secrets to deployment targets",
+	Long: `Push project secrets to every configured deployment target, or a single one.
+
+Examples:
+  envie deploy sync --project my-api
+  envie deploy sync --project my-api --target production-vercel`,
+	RunE: runDeploySync,
+}
+
+func init() {
+	rootCmd.AddCommand(deployCmd)
+	deployCmd.AddCommand(deployTargetsCmd)
+	deployCmd.AddCommand(deploySyncCmd)
+
+	deploySyncCmd.Flags().StringVar(&deployTarget, "target", "", "Only sync the target with this name or ID")
+}
+
+func newDeployClient() (*api.Client, *crypto.DerivedIdentity, string, error) {
+	tokenValue, err := getToken()
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	projectID, err := getProject()
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	identity, err := crypto.ParseToken(tokenValue)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("invalid token: %w", err)
+	}
+
+	client, err := newClient(identity.IdentityID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return client, identity, projectID, nil
+}
+
+func runDeployTargets(cmd *cobra.Command, args []string) error {
+	client, _, projectID, err := newDeployClient()
+	if err != nil {
+		return err
+	}
+
+	targets, err := client.GetDeploymentTargets(projectID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch deployment targets: %w", err)
+	}
+
+	if len(targets) == 0 {
+		fmt.Println("No deployment targets configured for this project.")
+		return nil
+	}
+
+	for _, t := range targets {
+		fmt.Printf("%-24s %-8s %s\n", t.Name, t.Provider, t.ExternalID)
+	}
+	return nil
+}
+
+func runDeploySync(cmd *cobra.Command, args []string) error {
+	client, identity, projectID, err := newDeployClient()
+	if err != nil {
+		return err
+	}
+
+	targets, err := client.GetDeploymentTargets(projectID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch deployment targets: %w", err)
+	}
+
+	if deployTarget != "" {
+		var selected []api.DeploymentTarget
+		for _, t := range targets {
+			if t.Name == deployTarget || t.ID == deployTarget {
+				selected = append(selected, t)
+			}
+		}
+		if len(selected) == 0 {
+			return fmt.Errorf("deployment target '%s' not found", deployTarget)
+		}
+		targets = selected
+	}
+
+	if len(targets) == 0 {
+		return fmt.Errorf("no deployment targets configured for this project")
+	}
+
+	configResp, err := client.GetProjectConfig(projectID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch config: %w", err)
+	}
+
+	projectKey, secrets, err := decryptProjectConfig(identity, configResp)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, target := range targets {
+		fmt.Fprintf(os.Stderr, "Syncing %s (%s)... ", target.Name, target.Provider)
+		pushed, err := syncDeploymentTarget(client, projectID, target, projectKey, secrets, configResp.ConfigChecksum)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "failed")
+			fmt.Fprintf(os.Stderr, "  %v\n", err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "ok (%d keys)\n", pushed)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d deployment targets failed to sync", failed, len(targets))
+	}
+	return nil
+}
+
+func syncDeploymentTarget(client *api.Client, projectID string, target api.DeploymentTarget, projectKey []byte, secrets map[string]string, checksum string) (int, error) {
+	run, err := client.StartDeploymentSync(projectID, target.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start sync: %w", err)
+	}
+
+	pushed, pushErr := pushToTarget(target, projectKey, secrets)
+
+	report := api.DeploymentSyncReport{
+		Status:         "succeeded",
+		KeysPushed:     pushed,
+		ConfigChecksum: &checksum,
+	}
+	if pushErr != nil {
+		msg := pushErr.Error()
+		report.Status = "failed"
+		report.Error = &msg
+	}
+
+	if err := client.ReportDeploymentSync(projectID, target.ID, run.ID, report); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to report sync status: %v\n", err)
+	}
+
+	return pushed, pushErr
+}
+
+func pushToTarget(target api.DeploymentTarget, projectKey []byte, secrets map[string]string) (int, error) {
+	credentials, err := crypto.DecryptConfigValueBase64(projectKey, target.EncryptedCredentials)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decrypt provider credentials: %w", err)
+	}
+
+	vars, err := deploy.ApplyMapping(target, secrets)
+	if err != nil {
+		return 0, err
+	}
+
+	provider, err := deploy.ForTarget(target)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	return provider.Push(ctx, target, string(credentials), vars)
+}
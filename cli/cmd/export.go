@@ -5,16 +5,24 @@ import (
 	"fmt"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/stranavad/envie/cli/internal/api"
 	"github.com/stranavad/envie/cli/internal/crypto"
+	"github.com/stranavad/envie/cli/internal/expand"
+	"github.com/stranavad/envie/cli/internal/merge"
+	"github.com/stranavad/envie/cli/internal/schema"
 	"github.com/spf13/cobra"
 )
 
 var (
 	exportFormat string
 	exportOutput string
+	exportLabel  string
+	exportTyped  bool
+
+	exportOnConflict string
 )
 
 var exportCmd = &cobra.Command{
@@ -35,6 +43,19 @@ Examples:
   # Export as JSON
   envie export --project my-api --format json
 
+  # Export as JSON with numbers, booleans and JSON values by their value type
+  envie export --project my-api --format json --typed
+
+  # Export values with ${KEY} references as written instead of expanded
+  envie export --project my-api --no-expand
+
+  # Export only the secrets under a compliance label
+  envie export --project my-api --label PCI
+
+  # Merge shared organization-wide values with the service's own; a key
+  # defined in both comes from the project listed last
+  envie export --project shared --token envie_aaaaa --project api --token envie_bbbbb
+
   # Use environment variable for token
   export ENVIE_TOKEN=envie_xxxxx
   envie export --project my-api`,
@@ -45,9 +66,19 @@ func init() {
 	rootCmd.AddCommand(exportCmd)
 	exportCmd.Flags().StringVarP(&exportFormat, "format", "f", "shell", "Output format: shell, dotenv, json")
 	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Write to file instead of stdout")
+	exportCmd.Flags().StringVar(&exportLabel, "label", "", "Only export secrets carrying this compliance label")
+	exportCmd.Flags().BoolVar(&exportTyped, "typed", false, "With --format json, emit values by their value type instead of as strings")
+	exportCmd.Flags().StringVar(&exportOnConflict, "on-conflict", merge.Last, "With several --project, which value of a key defined differently wins: last, first, or error to fail")
 }
 
 func runExport(cmd *cobra.Command, args []string) error {
+	if exportTyped && exportFormat != "json" {
+		return fmt.Errorf("--typed requires --format json")
+	}
+	if len(projects) > 1 {
+		return runMergedExport(projects)
+	}
+
 	// 1. Get token
 	tokenValue, err := getToken()
 	if err != nil {
@@ -67,35 +98,141 @@ func runExport(cmd *cobra.Command, args []string) error {
 	}
 
 	// 4. Create API client and fetch config
-	client := api.NewClient(apiURL, identity.IdentityID)
+	client, err := newClient(identity.IdentityID)
+	if err != nil {
+		return err
+	}
 	configResp, err := client.GetProjectConfig(projectID)
 	if err != nil {
 		return fmt.Errorf("failed to fetch config: %w", err)
 	}
 
-	// 5. Decrypt project key using CLI identity's private key
-	projectKey, err := crypto.DecryptWithPrivateKeyBase64(identity.PrivateKey, configResp.EncryptedProjectKey)
+	if exportLabel != "" {
+		configResp.Items = itemsWithLabel(configResp.Items, exportLabel)
+	}
+
+	// 5. Decrypt project key and config values
+	_, secrets, err := decryptProjectConfig(identity, configResp)
 	if err != nil {
-		return fmt.Errorf("failed to decrypt project key: %w", err)
+		return err
 	}
 
-	// 6. Decrypt each config value
-	secrets := make(map[string]string)
-	for _, item := range configResp.Items {
-		decrypted, err := crypto.DecryptConfigValueBase64(projectKey, item.EncryptedValue)
+	// 6. Format and write output
+	if err := writeExport(secrets, valueTypes(configResp.Items)); err != nil {
+		return err
+	}
+	rememberChecksum(configResp)
+
+	return nil
+}
+
+// tokenProject is a token and the project it belongs to
+type tokenProject struct {
+	identity *crypto.DerivedIdentity
+	client   *api.Client
+	info     *api.IdentityInfo
+}
+
+// runMergedExport exports several projects as one set of variables, merged in
+// the order given. Tokens belong to a single project, so each project is read
+// with the token for it. References are expanded after merging, so a service's
+// values can refer to shared ones.
+func runMergedExport(refs []string) error {
+	tokenValues, err := getTokens()
+	if err != nil {
+		return err
+	}
+	available := make([]tokenProject, 0, len(tokenValues))
+	for _, value := range tokenValues {
+		identity, err := crypto.ParseToken(strings.TrimSpace(value))
 		if err != nil {
-			return fmt.Errorf("failed to decrypt '%s': %w", item.Name, err)
+			return fmt.Errorf("invalid token: %w", err)
 		}
-		secrets[item.Name] = string(decrypted)
+		client, err := newClient(identity.IdentityID)
+		if err != nil {
+			return err
+		}
+		info, err := client.VerifyIdentity()
+		if err != nil {
+			return fmt.Errorf("failed to verify token: %w", err)
+		}
+		available = append(available, tokenProject{identity, client, info})
+	}
+
+	sources := make([]merge.Source, len(refs))
+	fetched := make([]*api.ProjectConfigResponse, len(refs))
+	for i, ref := range refs {
+		var token *tokenProject
+		for j := range available {
+			if info := available[j].info; ref == info.ProjectID || ref == info.ProjectSlug || ref == info.ProjectName {
+				token = &available[j]
+				break
+			}
+		}
+		if token == nil {
+			return fmt.Errorf("no token for project %s: pass a --token for each --project", ref)
+		}
+
+		configResp, err := token.client.GetProjectConfig(token.info.ProjectID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch config of %s: %w", ref, err)
+		}
+		if exportLabel != "" {
+			configResp.Items = itemsWithLabel(configResp.Items, exportLabel)
+		}
+		_, values, err := decryptConfigValues(token.identity, configResp)
+		if err != nil {
+			return fmt.Errorf("%s: %w", ref, err)
+		}
+		sources[i] = merge.Source{Project: ref, Values: values}
+		fetched[i] = configResp
+	}
+
+	result, err := merge.Merge(sources, exportOnConflict)
+	if err != nil {
+		return err
+	}
+	for _, conflict := range result.Conflicts {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", conflict)
+	}
+
+	// The metadata of each key comes from the project its value was taken from
+	items := make([]api.ConfigItem, 0, len(result.Values))
+	for i, configResp := range fetched {
+		for _, item := range configResp.Items {
+			if result.From[item.Name] == i {
+				items = append(items, item)
+			}
+		}
+	}
+	secrets, err := expandReferences(result.Values, items)
+	if err != nil {
+		return err
+	}
+
+	if err := writeExport(secrets, valueTypes(items)); err != nil {
+		return err
 	}
+	for _, configResp := range fetched {
+		rememberChecksum(configResp)
+	}
+	return nil
+}
 
-	// 7. Format output
-	output, err := formatSecrets(secrets, exportFormat)
+// writeExport formats the secrets as requested and writes them to the output
+// file or stdout
+func writeExport(secrets map[string]string, types map[string]string) error {
+	var output string
+	var err error
+	if exportTyped {
+		output, err = formatTypedJSON(secrets, types)
+	} else {
+		output, err = formatSecrets(secrets, exportFormat)
+	}
 	if err != nil {
 		return err
 	}
 
-	// 8. Write output
 	if exportOutput != "" {
 		if err := os.WriteFile(exportOutput, []byte(output), 0600); err != nil {
 			return fmt.Errorf("failed to write to file: %w", err)
@@ -104,10 +241,77 @@ func runExport(cmd *cobra.Command, args []string) error {
 	} else {
 		fmt.Print(output)
 	}
-
 	return nil
 }
 
+// decryptProjectConfig decrypts the project key with the CLI identity's private key
+// and uses it to decrypt every config value in the response. Values flagged as
+// containing references are expanded unless --no-expand is set.
+func decryptProjectConfig(identity *crypto.DerivedIdentity, configResp *api.ProjectConfigResponse) ([]byte, map[string]string, error) {
+	projectKey, secrets, err := decryptConfigValues(identity, configResp)
+	if err != nil {
+		return nil, nil, err
+	}
+	secrets, err = expandReferences(secrets, configResp.Items)
+	if err != nil {
+		return nil, nil, err
+	}
+	return projectKey, secrets, nil
+}
+
+// decryptConfigValues decrypts the project key and the config values as stored
+func decryptConfigValues(identity *crypto.DerivedIdentity, configResp *api.ProjectConfigResponse) ([]byte, map[string]string, error) {
+	projectKey, err := crypto.DecryptEnvelope(identity, configResp.EncryptedProjectKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decrypt project key: %w", err)
+	}
+
+	secrets := make(map[string]string)
+	for _, item := range configResp.Items {
+		if item.Masked {
+			return nil, nil, fmt.Errorf("'%s' is sensitive and this token lacks the secrets.reveal scope; create a token with it", item.Name)
+		}
+		decrypted, err := crypto.DecryptConfigValueBase64(projectKey, item.EncryptedValue)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decrypt '%s': %w", item.Name, err)
+		}
+		secrets[item.Name] = string(decrypted)
+	}
+
+	return projectKey, secrets, nil
+}
+
+// expandReferences expands the values of the items flagged as containing
+// references, unless --no-expand is set
+func expandReferences(secrets map[string]string, items []api.ConfigItem) (map[string]string, error) {
+	if noExpand {
+		return secrets, nil
+	}
+	refs := make(map[string]bool)
+	for _, item := range items {
+		refs[item.Name] = item.HasReferences
+	}
+	expanded, err := expand.Expand(secrets, refs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand references: %w", err)
+	}
+	return expanded, nil
+}
+
+// itemsWithLabel keeps the items carrying the compliance label
+func itemsWithLabel(items []api.ConfigItem, label string) []api.ConfigItem {
+	var labelled []api.ConfigItem
+	for _, item := range items {
+		for _, l := range item.Labels {
+			if l == label {
+				labelled = append(labelled, item)
+				break
+			}
+		}
+	}
+	return labelled
+}
+
 // formatSecrets formats the secrets map according to the specified format
 func formatSecrets(secrets map[string]string, format string) (string, error) {
 	// Sort keys for consistent output
@@ -169,6 +373,43 @@ func formatJSON(secrets map[string]string) (string, error) {
 	return string(data) + "\n", nil
 }
 
+// valueTypes maps item names to their value types
+func valueTypes(items []api.ConfigItem) map[string]string {
+	types := make(map[string]string, len(items))
+	for _, item := range items {
+		types[item.Name] = item.ValueType
+	}
+	return types
+}
+
+// formatTypedJSON formats secrets as JSON with numbers, booleans and JSON values
+// emitted as such. A value that isn't valid for its type fails the export rather
+// than being silently exported as a string.
+func formatTypedJSON(secrets map[string]string, types map[string]string) (string, error) {
+	typed := make(map[string]any, len(secrets))
+	for name, value := range secrets {
+		if err := schema.CheckType(types[name], value); err != nil {
+			return "", fmt.Errorf("'%s' is %s, but its value type is %s", name, err, types[name])
+		}
+		switch types[name] {
+		case "number":
+			typed[name] = json.Number(value)
+		case "boolean":
+			typed[name], _ = strconv.ParseBool(value)
+		case "json":
+			typed[name] = json.RawMessage(value)
+		default:
+			typed[name] = value
+		}
+	}
+
+	data, err := json.MarshalIndent(typed, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return string(data) + "\n", nil
+}
+
 // needsQuoting returns true if the value needs to be quoted in .env format
 func needsQuoting(value string) bool {
 	if value == "" {
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/stranavad/envie/cli/internal/api"
+	"github.com/stranavad/envie/cli/internal/crypto"
+	"github.com/stranavad/envie/cli/internal/files"
+)
+
+var (
+	filesFolder string
+	filesOutput string
+	filesName   string
+)
+
+var filesCmd = &cobra.Command{
+	Use:   "files",
+	Short: "List, download and upload project files",
+	Long: `Work with the encrypted files of a project: certificates, keystores and
+other secrets that aren't key-value config.
+
+Files are decrypted and encrypted locally with the project key. Uploading needs a
+token with the files.write scope.`,
+}
+
+var filesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the project's files",
+	RunE:  runFilesList,
+}
+
+var filesPullCmd = &cobra.Command{
+	Use:   "pull <file>",
+	Short: "Download and decrypt a file",
+	Long: `Download a file and decrypt it locally. The file is named by its path
+(folder/name), its name when no other file has it, or its ID.
+
+Examples:
+  envie files pull certs/prod/ca.pem --project my-api
+  envie files pull app.keytab -o /etc/app.keytab
+  envie files pull ca.pem -o - | openssl x509 -noout -text`,
+	Args: cobra.ExactArgs(1),
+	RunE: runFilesPull,
+}
+
+var filesPushCmd = &cobra.Command{
+	Use:   "push <path>",
+	Short: "Encrypt and upload a file",
+	Long: `Encrypt a local file with a new file key and upload it to the project.
+The token needs the files.write scope.
+
+Examples:
+  envie files push ./ca.pem --folder certs/prod
+  envie files push ./build/app.keytab --name app.keytab`,
+	Args: cobra.ExactArgs(1),
+	RunE: runFilesPush,
+}
+
+func init() {
+	rootCmd.AddCommand(filesCmd)
+	filesCmd.AddCommand(filesListCmd)
+	filesCmd.AddCommand(filesPullCmd)
+	filesCmd.AddCommand(filesPushCmd)
+
+	filesListCmd.Flags().StringVar(&filesFolder, "folder", "", "Only list files in this folder and its subfolders")
+	filesPullCmd.Flags().StringVarP(&filesOutput, "output", "o", "", "Where to write the file, - for stdout (default: the file's name)")
+	filesPushCmd.Flags().StringVar(&filesName, "name", "", "Name of the file in the project (default: the local file's name)")
+	filesPushCmd.Flags().StringVar(&filesFolder, "folder", "", "Folder to upload the file to")
+}
+
+func runFilesList(cmd *cobra.Command, args []string) error {
+	client, _, projectID, err := newDeployClient()
+	if err != nil {
+		return err
+	}
+
+	list, err := client.GetProjectFiles(projectID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch files: %w", err)
+	}
+
+	folder := strings.Trim(filepath.ToSlash(filesFolder), "/")
+	shown := 0
+	for _, file := range list.Files {
+		if folder != "" && file.Folder != folder && !strings.HasPrefix(file.Folder, folder+"/") {
+			continue
+		}
+		fmt.Printf("%-48s %10d  %s\n", files.Path(file), file.SizeBytes, file.MimeType)
+		shown++
+	}
+	if shown == 0 {
+		fmt.Println("No files in this project.")
+	}
+	return nil
+}
+
+func runFilesPull(cmd *cobra.Command, args []string) error {
+	client, identity, projectID, err := newDeployClient()
+	if err != nil {
+		return err
+	}
+
+	list, err := client.GetProjectFiles(projectID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch files: %w", err)
+	}
+
+	file, err := files.Find(list.Files, args[0])
+	if err != nil {
+		return err
+	}
+
+	projectKey, err := crypto.DecryptEnvelope(identity, list.EncryptedProjectKey)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt project key: %w", err)
+	}
+
+	download, err := client.DownloadFile(projectID, file.ID)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", files.Path(*file), err)
+	}
+
+	plaintext, err := files.Decrypt(projectKey, download)
+	if err != nil {
+		return fmt.Errorf("%s: %w", files.Path(*file), err)
+	}
+
+	output := filesOutput
+	if output == "" {
+		output = file.Name
+	}
+	if output == "-" {
+		_, err := os.Stdout.Write(plaintext)
+		return err
+	}
+
+	// Files hold secrets, keep them private to the user
+	if err := os.WriteFile(output, plaintext, 0600); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s to %s (%d bytes)\n", files.Path(*file), output, len(plaintext))
+	return nil
+}
+
+func runFilesPush(cmd *cobra.Command, args []string) error {
+	client, identity, projectID, err := newDeployClient()
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	name := filesName
+	if name == "" {
+		name = filepath.Base(args[0])
+	}
+	mimeType := mime.TypeByExtension(filepath.Ext(name))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(plaintext)
+	}
+
+	// The file list carries the project key encrypted to this token
+	list, err := client.GetProjectFiles(projectID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch files: %w", err)
+	}
+
+	projectKey, err := crypto.DecryptEnvelope(identity, list.EncryptedProjectKey)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt project key: %w", err)
+	}
+
+	encrypted, err := files.Encrypt(projectKey, plaintext)
+	if err != nil {
+		return err
+	}
+
+	uploaded, err := client.UploadFile(projectID, api.FileUpload{
+		Name:         name,
+		Folder:       strings.Trim(filepath.ToSlash(filesFolder), "/"),
+		MimeType:     mimeType,
+		Data:         encrypted.Data,
+		EncryptedFEK: encrypted.EncryptedFEK,
+		Checksum:     encrypted.Checksum,
+		OriginalSize: int64(len(plaintext)),
+	})
+	if err != nil {
+		var apiErr *api.Error
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusForbidden {
+			return fmt.Errorf("upload denied: the token needs the files.write scope (%w)", err)
+		}
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Uploaded %s (%d bytes)\n", files.Path(api.ProjectFile{Name: uploaded.Name, Folder: uploaded.Folder}), len(plaintext))
+	return nil
+}
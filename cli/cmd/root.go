@@ -1,17 +1,24 @@
 package cmd
 
 import (
+	"crypto/ed25519"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/stranavad/envie/cli/internal/api"
+	"github.com/stranavad/envie/cli/internal/config"
 )
 
 var (
-	// Global flags
-	token   string
-	project string
-	apiURL  string
+	// Global flags, repeatable for commands that merge several projects
+	tokens   []string
+	projects []string
+	apiURL   string
+
+	noExpand    bool
+	signingKeys []string
 
 	// Version info (set at build time via ldflags)
 	version   = "dev"
@@ -45,29 +52,100 @@ func Execute() {
 
 func init() {
 	// Global persistent flags (available to all commands)
-	rootCmd.PersistentFlags().StringVar(&token, "token", "", "CLI identity token (or set ENVIE_TOKEN)")
-	rootCmd.PersistentFlags().StringVar(&project, "project", "", "Project ID or name")
+	rootCmd.PersistentFlags().StringArrayVar(&tokens, "token", nil, "CLI identity token (or set ENVIE_TOKEN)")
+	rootCmd.PersistentFlags().StringArrayVar(&projects, "project", nil, "Project ID or slug")
 	rootCmd.PersistentFlags().StringVar(&apiURL, "api-url", "https://api.envie.sh", "Envie API URL")
+	rootCmd.PersistentFlags().BoolVar(&noExpand, "no-expand", false, "Leave ${KEY} references in values as they are")
+	rootCmd.PersistentFlags().StringArrayVar(&signingKeys, "signing-key", nil, "Server config signing public key to require (or set ENVIE_SIGNING_KEY)")
 }
 
-// getToken returns the token from flag or environment variable
+// getToken returns the token from flag, environment variable or stored credentials
 func getToken() (string, error) {
-	if token != "" {
-		return token, nil
+	if len(tokens) > 1 {
+		return "", fmt.Errorf("this command takes a single --token")
+	}
+	if len(tokens) == 1 {
+		return tokens[0], nil
 	}
 	if envToken := os.Getenv("ENVIE_TOKEN"); envToken != "" {
 		return envToken, nil
 	}
-	return "", fmt.Errorf("no token provided: use --token flag or set ENVIE_TOKEN environment variable")
+
+	creds, err := config.LoadCredentials()
+	if err != nil {
+		return "", fmt.Errorf("no token provided: use --token flag, set ENVIE_TOKEN environment variable or run 'envie auth'")
+	}
+	if !creds.IsEncrypted() {
+		return creds.Token, nil
+	}
+
+	passphrase, err := readPassphrase("Passphrase for stored token: ", false)
+	if err != nil {
+		return "", err
+	}
+	return creds.Unlock(passphrase)
+}
+
+// getTokens returns the tokens from flags, the comma-separated ENVIE_TOKEN
+// environment variable or stored credentials
+func getTokens() ([]string, error) {
+	if len(tokens) > 0 {
+		return tokens, nil
+	}
+	if envToken := os.Getenv("ENVIE_TOKEN"); envToken != "" {
+		return strings.Split(envToken, ","), nil
+	}
+	stored, err := getToken()
+	if err != nil {
+		return nil, err
+	}
+	return []string{stored}, nil
 }
 
 // getProject returns the project from flag or environment variable
 func getProject() (string, error) {
-	if project != "" {
-		return project, nil
+	if len(projects) > 1 {
+		return "", fmt.Errorf("this command takes a single --project")
+	}
+	if len(projects) == 1 {
+		return projects[0], nil
 	}
 	if envProject := os.Getenv("ENVIE_PROJECT"); envProject != "" {
 		return envProject, nil
 	}
 	return "", fmt.Errorf("no project provided: use --project flag or set ENVIE_PROJECT environment variable")
 }
+
+// getSigningKeys returns the pinned config signing keys from flags or the
+// comma-separated ENVIE_SIGNING_KEY environment variable, none when neither is set
+func getSigningKeys() ([]ed25519.PublicKey, error) {
+	values := signingKeys
+	if len(values) == 0 {
+		if envKeys := os.Getenv("ENVIE_SIGNING_KEY"); envKeys != "" {
+			values = strings.Split(envKeys, ",")
+		}
+	}
+	keys := make([]ed25519.PublicKey, 0, len(values))
+	for _, value := range values {
+		key, err := api.ParseSigningKey(value)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// newClient creates an API client for the identity that rejects configs not
+// signed by one of the pinned signing keys, if any are pinned
+func newClient(identityID string) (*api.Client, error) {
+	keys, err := getSigningKeys()
+	if err != nil {
+		return nil, err
+	}
+	client := api.NewClient(apiURL, identityID)
+	if len(keys) > 0 {
+		client.PinSigningKeys(keys)
+	}
+	return client, nil
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stranavad/envie/cli/internal/crypto"
+	"github.com/stranavad/envie/cli/internal/smoke"
+)
+
+var smokeWrite bool
+
+var smokeCmd = &cobra.Command{
+	Use:   "smoke",
+	Short: "Run an end-to-end check against the Envie service",
+	Long: `Run the path a deploy takes through Envie and exit non-zero if any step fails:
+verify the token, read the config checksum, fetch and decrypt the config, and
+compare the fetched items against the checksum. For monitoring the service.
+
+With --write, the check also writes a random value to the ENVIE_SMOKE_CANARY
+config item and reads it back. Create that item in the app first; it is the only
+item a CLI token can write. Every write changes the config, so use a dedicated
+monitoring project.
+
+Examples:
+  envie smoke --project my-api
+  ENVIE_TOKEN=envie_xxxxx envie smoke --project monitoring --write`,
+	RunE: runSmoke,
+}
+
+func init() {
+	rootCmd.AddCommand(smokeCmd)
+	smokeCmd.Flags().BoolVar(&smokeWrite, "write", false, "Also round trip a write through the "+smoke.CanaryKey+" item")
+}
+
+func runSmoke(cmd *cobra.Command, args []string) error {
+	tokenValue, err := getToken()
+	if err != nil {
+		return err
+	}
+	projectID, err := getProject()
+	if err != nil {
+		return err
+	}
+	identity, err := crypto.ParseToken(tokenValue)
+	if err != nil {
+		return fmt.Errorf("invalid token: %w", err)
+	}
+
+	client, err := newClient(identity.IdentityID)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = smoke.Run(client, identity, projectID, smoke.Options{Write: smokeWrite}, func(step smoke.Step) {
+		if step.Err != nil {
+			fmt.Printf("✗ %-10s %v (%s)\n", step.Name, step.Err, step.Duration.Round(time.Millisecond))
+			return
+		}
+		fmt.Printf("✓ %-10s %s (%s)\n", step.Name, step.Detail, step.Duration.Round(time.Millisecond))
+	})
+	if err != nil {
+		return fmt.Errorf("smoke test %w", err)
+	}
+
+	fmt.Printf("Smoke test passed in %s\n", time.Since(start).Round(time.Millisecond))
+	return nil
+}
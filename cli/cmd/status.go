@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stranavad/envie/cli/internal/api"
+	"github.com/stranavad/envie/cli/internal/config"
+	"github.com/stranavad/envie/cli/internal/crypto"
+)
+
+// tokenExpiryWarning is how close to its expiry a token is reported as expiring
+const tokenExpiryWarning = 7 * 24 * time.Hour
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show API, token and project health at a glance",
+	Long: `Check everything a pipeline depends on and print one line per check: whether
+the API is reachable and which version it runs, when the token expires, whether
+the project config changed since it was last exported on this machine, and
+whether a key rotation is pending, which revokes the token once approved.
+
+Exits non-zero when the API is unreachable or the token is rejected.
+
+Examples:
+  envie status
+  ENVIE_TOKEN=envie_xxxxx envie status`,
+	RunE: runStatus,
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+}
+
+func runStatus(cmd *cobra.Command, args []string) error {
+	identityID := ""
+	tokenValue, tokenErr := getToken()
+	var identity *crypto.DerivedIdentity
+	if tokenErr == nil {
+		identity, tokenErr = crypto.ParseToken(tokenValue)
+		if identity != nil {
+			identityID = identity.IdentityID
+		}
+	}
+	client, err := newClient(identityID)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	server, err := client.GetServerVersion()
+	if err != nil {
+		printStatus(false, "API", "%s unreachable: %v", apiURL, err)
+		return fmt.Errorf("status check failed")
+	}
+	printStatus(true, "API", "%s reachable (%s)", apiURL, time.Since(start).Round(time.Millisecond))
+	printStatus(server.APIVersion == api.APIVersion, "Server", "version %s (%s), API v%s, CLI %s built for v%s",
+		server.Version, server.Commit, server.APIVersion, version, api.APIVersion)
+	if err := printSigningStatus(server); err != nil {
+		return err
+	}
+
+	if tokenErr != nil {
+		printStatus(false, "Token", "%v", tokenErr)
+		return fmt.Errorf("status check failed")
+	}
+	info, err := client.VerifyIdentity()
+	if api.ErrorCode(err) == api.CodeTokenExpired {
+		printStatus(false, "Token", "expired, create a new token for this project in the app")
+		return fmt.Errorf("status check failed")
+	}
+	if err != nil {
+		printStatus(false, "Token", "rejected: %v", err)
+		return fmt.Errorf("status check failed")
+	}
+	printTokenStatus(info)
+
+	status, err := client.GetProjectStatus(info.ProjectID)
+	if err != nil {
+		printStatus(false, "Project", "%s: %v", info.ProjectName, err)
+		return fmt.Errorf("status check failed")
+	}
+	printStatus(true, "Project", "%s (%s), key version %d", info.ProjectName, info.ProjectSlug, status.KeyVersion)
+	printChecksumStatus(status)
+
+	switch {
+	case status.PendingRotation != nil:
+		printStatus(false, "Rotation", "rotation to key version %d pending until %s; approving it revokes this token",
+			status.PendingRotation.NewVersion, status.PendingRotation.ExpiresAt)
+	case status.RotationRequiredAt != nil:
+		printStatus(false, "Rotation", "key rotation required since %s", *status.RotationRequiredAt)
+	default:
+		printStatus(true, "Rotation", "none pending")
+	}
+
+	return nil
+}
+
+func printTokenStatus(info *api.IdentityInfo) {
+	if info.ExpiresAt == nil {
+		printStatus(true, "Token", "%s, never expires", info.TokenName)
+		return
+	}
+	expiresAt, err := time.Parse(time.RFC3339Nano, *info.ExpiresAt)
+	if err != nil {
+		printStatus(true, "Token", "%s, expires %s", info.TokenName, *info.ExpiresAt)
+		return
+	}
+	left := time.Until(expiresAt)
+	printStatus(left > tokenExpiryWarning, "Token", "%s, expires %s (in %s)",
+		info.TokenName, expiresAt.Format(time.RFC3339), left.Round(time.Minute))
+}
+
+// printSigningStatus compares the server's config signing key with the pinned
+// keys. Exports fail on their own when they don't match; this tells why.
+func printSigningStatus(server *api.ServerVersion) error {
+	keys, err := getSigningKeys()
+	if err != nil {
+		return err
+	}
+	served := server.ConfigSigningKey
+	switch {
+	case len(keys) == 0 && served == nil:
+		printStatus(true, "Signing", "configs unsigned, no key pinned")
+	case len(keys) == 0:
+		printStatus(true, "Signing", "configs signed with key %s, not pinned (--signing-key %s)", served.KeyID, served.PublicKey)
+	case served == nil:
+		printStatus(false, "Signing", "%d key(s) pinned, but the server doesn't sign configs", len(keys))
+	default:
+		pinned := false
+		for _, key := range keys {
+			pinned = pinned || api.SigningKeyID(key) == served.KeyID
+		}
+		if pinned {
+			printStatus(true, "Signing", "configs signed with pinned key %s", served.KeyID)
+		} else {
+			printStatus(false, "Signing", "configs signed with key %s, which isn't pinned", served.KeyID)
+		}
+	}
+	return nil
+}
+
+func printChecksumStatus(status *api.ProjectStatus) {
+	cached, err := config.LoadChecksum(status.ProjectID)
+	switch {
+	case err != nil:
+		printStatus(false, "Config", "checksum %s, cache unreadable: %v", shortChecksum(status.ConfigChecksum), err)
+	case cached == nil:
+		printStatus(true, "Config", "checksum %s, not exported on this machine", shortChecksum(status.ConfigChecksum))
+	case cached.Checksum == status.ConfigChecksum, cached.Checksum == status.LegacyConfigChecksum && cached.Checksum != "":
+		printStatus(true, "Config", "checksum %s, unchanged since the export at %s",
+			shortChecksum(status.ConfigChecksum), cached.FetchedAt.Format(time.RFC3339))
+	default:
+		printStatus(false, "Config", "checksum %s, changed since the export at %s (was %s)",
+			shortChecksum(status.ConfigChecksum), cached.FetchedAt.Format(time.RFC3339), shortChecksum(cached.Checksum))
+	}
+}
+
+// printStatus prints a check as "✓ Name  detail", or with ! when it needs attention
+func printStatus(ok bool, name, format string, args ...any) {
+	mark := "✓"
+	if !ok {
+		mark = "!"
+	}
+	fmt.Printf("%s %-9s %s\n", mark, name, fmt.Sprintf(format, args...))
+}
+
+func shortChecksum(checksum string) string {
+	if checksum == "" {
+		return "(none)"
+	}
+	if len(checksum) > 12 {
+		return checksum[:12]
+	}
+	return checksum
+}
+
+// rememberChecksum records the checksum of an export for 'envie status'. Failing
+// to write the cache doesn't fail the export.
+func rememberChecksum(configResp *api.ProjectConfigResponse) {
+	if err := config.RecordChecksum(configResp.ProjectID, configResp.ConfigChecksum); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stranavad/envie/cli/internal/crypto"
+)
+
+var (
+	tokenOffline         bool
+	tokenName            string
+	tokenExpiresIn       time.Duration
+	tokenProjectKey      string
+	tokenEnvelopeVersion int
+)
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Developer tools for CLI tokens",
+}
+
+var tokenGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate a token and its registration payload",
+	Long: `Generate a CLI token locally, for testing servers and local development.
+
+Prints the token and the body to POST to /v1/projects/:id/tokens to register it.
+The project key is wrapped to the token like the desktop app does; without
+--project-key a random one is generated and printed too.
+
+Production tokens should be created in the Envie desktop app.
+
+Examples:
+  envie token generate --offline
+  envie token generate --offline --project-key <base64> --envelope-version 2`,
+	RunE: runTokenGenerate,
+}
+
+func init() {
+	rootCmd.AddCommand(tokenCmd)
+	tokenCmd.AddCommand(tokenGenerateCmd)
+
+	tokenGenerateCmd.Flags().BoolVar(&tokenOffline, "offline", false, "Generate locally without contacting the server (required)")
+	tokenGenerateCmd.Flags().StringVar(&tokenName, "name", "Offline test token", "Token name in the registration payload")
+	tokenGenerateCmd.Flags().DurationVar(&tokenExpiresIn, "expires-in", 30*24*time.Hour, "Token lifetime")
+	tokenGenerateCmd.Flags().StringVar(&tokenProjectKey, "project-key", "", "Base64 project key to wrap (random if empty)")
+	tokenGenerateCmd.Flags().IntVar(&tokenEnvelopeVersion, "envelope-version", crypto.EnvelopeV1, "Envelope version for the wrapped project key (1 or 2)")
+}
+
+// tokenRegistration matches the backend's CreateProjectTokenRequest
+type tokenRegistration struct {
+	Name                string    `json:"name"`
+	ExpiresAt           time.Time `json:"expiresAt"`
+	TokenPrefix         string    `json:"tokenPrefix"`
+	IdentityIDHash      string    `json:"identityIdHash"`
+	EncryptedProjectKey string    `json:"encryptedProjectKey"`
+	EnvelopeVersion     int       `json:"envelopeVersion"`
+}
+
+type generatedToken struct {
+	Token        string            `json:"token"`
+	ProjectKey   string            `json:"projectKey,omitempty"` // only when generated here
+	Registration tokenRegistration `json:"registration"`
+}
+
+func runTokenGenerate(cmd *cobra.Command, args []string) error {
+	if !tokenOffline {
+		return fmt.Errorf("only offline generation is supported: pass --offline, or create the token in the Envie desktop app")
+	}
+	if tokenExpiresIn <= 0 {
+		return fmt.Errorf("--expires-in must be positive")
+	}
+
+	var projectKey []byte
+	generatedKey := tokenProjectKey == ""
+	if generatedKey {
+		projectKey = make([]byte, 32)
+		if err := crypto.CurrentProvider().Random(projectKey); err != nil {
+			return fmt.Errorf("failed to generate project key: %w", err)
+		}
+	} else {
+		var err error
+		projectKey, err = base64.StdEncoding.DecodeString(tokenProjectKey)
+		if err != nil {
+			return fmt.Errorf("invalid --project-key: %w", err)
+		}
+	}
+
+	tokenValue, identity, err := crypto.GenerateToken()
+	if err != nil {
+		return err
+	}
+
+	encryptedProjectKey, err := crypto.EncryptEnvelope(identity, tokenEnvelopeVersion, projectKey)
+	if err != nil {
+		return fmt.Errorf("failed to wrap project key: %w", err)
+	}
+
+	result := generatedToken{
+		Token: tokenValue,
+		Registration: tokenRegistration{
+			Name:                tokenName,
+			ExpiresAt:           time.Now().Add(tokenExpiresIn).UTC().Truncate(time.Second),
+			TokenPrefix:         crypto.TokenDisplayPrefix(tokenValue),
+			IdentityIDHash:      identity.IdentityIDHash,
+			EncryptedProjectKey: encryptedProjectKey,
+			EnvelopeVersion:     tokenEnvelopeVersion,
+		},
+	}
+	if generatedKey {
+		result.ProjectKey = base64.StdEncoding.EncodeToString(projectKey)
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), string(data))
+	return nil
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stranavad/envie/cli/internal/api"
+	"github.com/stranavad/envie/cli/internal/crypto"
+)
+
+// watchWaitSeconds is how long each long poll may wait, below the client's
+// 30 second request timeout
+const watchWaitSeconds = 25
+
+var (
+	watchFormat string
+	watchOutput string
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Re-export project secrets whenever they change",
+	Long: `Export secrets like 'envie export', then wait for config changes and export
+again after each one. Runs until interrupted.
+
+Changes are detected by long polling the server over plain HTTPS, so watch also
+works behind proxies that block streaming connections.
+
+Examples:
+  # Keep a .env file up to date
+  envie watch --project my-api --format dotenv --output .env`,
+	RunE: runWatch,
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+	watchCmd.Flags().StringVarP(&watchFormat, "format", "f", "dotenv", "Output format: shell, dotenv, json")
+	watchCmd.Flags().StringVarP(&watchOutput, "output", "o", "", "Write to file instead of stdout")
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	tokenValue, err := getToken()
+	if err != nil {
+		return err
+	}
+	projectID, err := getProject()
+	if err != nil {
+		return err
+	}
+	identity, err := crypto.ParseToken(tokenValue)
+	if err != nil {
+		return fmt.Errorf("invalid token: %w", err)
+	}
+
+	client, err := newClient(identity.IdentityID)
+	if err != nil {
+		return err
+	}
+	checksum, err := writeWatchedConfig(client, identity, projectID)
+	if err != nil {
+		return err
+	}
+
+	for {
+		wait, err := client.WaitForConfigChange(projectID, checksum, watchWaitSeconds)
+		if api.IsPermanent(err) {
+			return fmt.Errorf("waiting for changes failed: %w", err)
+		}
+		if err != nil {
+			// Ride out restarts and network blips instead of exiting
+			fmt.Fprintf(os.Stderr, "Waiting for changes failed: %v\n", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		if !wait.Changed {
+			continue
+		}
+
+		fmt.Fprintln(os.Stderr, "Config changed, exporting again")
+		if checksum, err = writeWatchedConfig(client, identity, projectID); err != nil {
+			return err
+		}
+	}
+}
+
+// writeWatchedConfig fetches, decrypts and writes the config, and returns the
+// checksum it was fetched at
+func writeWatchedConfig(client *api.Client, identity *crypto.DerivedIdentity, projectID string) (string, error) {
+	configResp, err := client.GetProjectConfig(projectID)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch config: %w", err)
+	}
+
+	_, secrets, err := decryptProjectConfig(identity, configResp)
+	if err != nil {
+		return "", err
+	}
+
+	output, err := formatSecrets(secrets, watchFormat)
+	if err != nil {
+		return "", err
+	}
+
+	if watchOutput != "" {
+		if err := os.WriteFile(watchOutput, []byte(output), 0600); err != nil {
+			return "", fmt.Errorf("failed to write to file: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %d secrets to %s\n", len(secrets), watchOutput)
+	} else {
+		fmt.Print(output)
+	}
+	rememberChecksum(configResp)
+
+	return configResp.ConfigChecksum, nil
+}
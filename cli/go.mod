@@ -1,13 +1,15 @@
 module github.com/stranavad/envie/cli
 
-go 1.22
+go 1.24
 
 require (
 	github.com/spf13/cobra v1.8.0
 	golang.org/x/crypto v0.28.0
+	golang.org/x/term v0.25.0
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
+	golang.org/x/sys v0.26.0 // indirect
 )
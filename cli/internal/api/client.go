@@ -1,27 +1,44 @@
 package api
 
 import (
+	"bytes"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
+
+	"github.com/stranavad/envie/cli/internal/crypto"
 )
 
+// APIVersion is the server API version this client was built against
+const APIVersion = "1"
+
 // Client is the Envie API client
 type Client struct {
 	baseURL    string
 	identityID string
 	httpClient *http.Client
+
+	signingKeys map[string]ed25519.PublicKey // pinned by key ID, see PinSigningKeys
 }
 
 // ConfigItem represents an encrypted config item from the API
 type ConfigItem struct {
-	ID             string  `json:"id"`
-	Name           string  `json:"name"`
-	EncryptedValue string  `json:"encryptedValue"`
-	Description    *string `json:"description,omitempty"`
-	ExpiresAt      *string `json:"expiresAt,omitempty"`
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	EncryptedValue string   `json:"encryptedValue"`
+	Masked         bool     `json:"masked,omitempty"`        // sensitive value withheld, the token lacks the secrets.reveal scope
+	ValueType      string   `json:"valueType,omitempty"`     // string, number, boolean, url or json
+	HasReferences  bool     `json:"hasReferences,omitempty"` // the value contains ${KEY} references to expand
+	Description    *string  `json:"description,omitempty"`
+	ExpiresAt      *string  `json:"expiresAt,omitempty"`
+	Labels         []string `json:"labels,omitempty"` // compliance labels, including the project's
 }
 
 // ProjectConfigResponse is the response from the config endpoint
@@ -31,6 +48,16 @@ type ProjectConfigResponse struct {
 	EncryptedProjectKey string       `json:"encryptedProjectKey"`
 	Items               []ConfigItem `json:"items"`
 	ConfigChecksum      string       `json:"configChecksum"`
+	Labels              []string     `json:"labels,omitempty"` // compliance labels of the project
+
+	// ChecksumVersion is the format of ConfigChecksum, 0 from servers before
+	// version 2. LegacyConfigChecksum is the version 1 checksum, while the server
+	// still serves it.
+	ChecksumVersion      int    `json:"checksumVersion,omitempty"`
+	LegacyConfigChecksum string `json:"legacyConfigChecksum,omitempty"`
+
+	// Signature is set by servers with a signing key, see VerifyConfigSignature
+	Signature *ConfigSignature `json:"signature,omitempty"`
 }
 
 // IdentityInfo contains information about the CLI token
@@ -39,12 +66,56 @@ type IdentityInfo struct {
 	TokenName   string  `json:"tokenName"`
 	ProjectID   string  `json:"projectId"`
 	ProjectName string  `json:"projectName"`
+	ProjectSlug string  `json:"projectSlug"`
 	ExpiresAt   *string `json:"expiresAt,omitempty"`
 }
 
 // ErrorResponse represents an API error
 type ErrorResponse struct {
 	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// Error codes the CLI acts on. Servers older than the codes send none.
+const (
+	CodeTokenMissing          = "ENVIE_TOKEN_MISSING"
+	CodeTokenInvalid          = "ENVIE_TOKEN_INVALID"
+	CodeTokenExpired          = "ENVIE_TOKEN_EXPIRED"
+	CodeTokenAddressDenied    = "ENVIE_TOKEN_ADDRESS_DENIED"
+	CodeProjectNotFound       = "ENVIE_PROJECT_NOT_FOUND"
+	CodeProjectAccessDenied   = "ENVIE_PROJECT_ACCESS_DENIED"
+	CodeAPIVersionUnsupported = "ENVIE_API_VERSION_UNSUPPORTED"
+)
+
+// Error is an error response from the API
+type Error struct {
+	StatusCode int
+	Code       string // empty when the server sent none
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (status %d)", e.Message, e.StatusCode)
+}
+
+// ErrorCode returns the API error code of err, or "" if it has none
+func ErrorCode(err error) string {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return ""
+}
+
+// IsPermanent reports whether err means the token can't make the request at all,
+// so retrying it won't help
+func IsPermanent(err error) bool {
+	switch ErrorCode(err) {
+	case CodeTokenMissing, CodeTokenInvalid, CodeTokenExpired, CodeTokenAddressDenied,
+		CodeProjectNotFound, CodeProjectAccessDenied, CodeAPIVersionUnsupported:
+		return true
+	}
+	return false
 }
 
 // NewClient creates a new API client with CLI identity authentication
@@ -60,7 +131,7 @@ func NewClient(baseURL, identityID string) *Client {
 
 // GetProjectConfig fetches the encrypted config for a project
 func (c *Client) GetProjectConfig(projectID string) (*ProjectConfigResponse, error) {
-	url := fmt.Sprintf("%s/v1/projects/%s/config", c.baseURL, projectID)
+	url := fmt.Sprintf("%s/v1/cli/projects/%s/config", c.baseURL, projectID)
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -84,6 +155,12 @@ func (c *Client) GetProjectConfig(projectID string) (*ProjectConfigResponse, err
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
+	if len(c.signingKeys) > 0 {
+		if err := c.verifyConfig(projectID, &configResp, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
 	return &configResp, nil
 }
 
@@ -116,9 +193,361 @@ func (c *Client) VerifyIdentity() (*IdentityInfo, error) {
 	return &info, nil
 }
 
+// ConfigChecksumResponse is the checksum the server recorded for a project's config
+type ConfigChecksumResponse struct {
+	ProjectID      string `json:"projectId"`
+	ConfigChecksum string `json:"configChecksum"`
+}
+
+// GetConfigChecksum fetches the config checksum without the config itself
+func (c *Client) GetConfigChecksum(projectID string) (*ConfigChecksumResponse, error) {
+	var checksum ConfigChecksumResponse
+	path := fmt.Sprintf("/v1/cli/projects/%s/config/checksum", projectID)
+	if err := c.doJSON("GET", path, nil, &checksum); err != nil {
+		return nil, err
+	}
+	return &checksum, nil
+}
+
+// SchemaVariable is a config item a project requires. Type and Pattern are checked
+// against the decrypted value.
+type SchemaVariable struct {
+	Name        string  `json:"name"`
+	Type        string  `json:"type"` // string, number, boolean, url or json
+	Pattern     *string `json:"pattern"`
+	Description *string `json:"description"`
+}
+
+// ProjectSchema lists the variables a project's config must define
+type ProjectSchema struct {
+	ProjectID string           `json:"projectId"`
+	Variables []SchemaVariable `json:"variables"`
+}
+
+// GetProjectSchema fetches the variables the project requires
+func (c *Client) GetProjectSchema(projectID string) (*ProjectSchema, error) {
+	var schema ProjectSchema
+	path := fmt.Sprintf("/v1/cli/projects/%s/schema", projectID)
+	if err := c.doJSON("GET", path, nil, &schema); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// PendingRotation is a project key rotation waiting for approval. Committing it
+// revokes every CLI token of the project.
+type PendingRotation struct {
+	ID         string `json:"id"`
+	NewVersion int    `json:"newVersion"`
+	ExpiresAt  string `json:"expiresAt"`
+}
+
+// ProjectStatus is the config checksum and key rotation state of a project
+type ProjectStatus struct {
+	ProjectID          string           `json:"projectId"`
+	ConfigChecksum     string           `json:"configChecksum"`
+	KeyVersion         int              `json:"keyVersion"`
+	PendingRotation    *PendingRotation `json:"pendingRotation,omitempty"`
+	RotationRequiredAt *string          `json:"rotationRequiredAt,omitempty"`
+
+	// LegacyConfigChecksum is ConfigChecksum in version 1, while the server still
+	// serves it, to compare checksums recorded by older CLIs with
+	LegacyConfigChecksum string `json:"legacyConfigChecksum,omitempty"`
+}
+
+// GetProjectStatus fetches the checksum, key version and pending rotation of a project
+func (c *Client) GetProjectStatus(projectID string) (*ProjectStatus, error) {
+	var status ProjectStatus
+	path := fmt.Sprintf("/v1/cli/projects/%s/status", projectID)
+	if err := c.doJSON("GET", path, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// ServerVersion identifies the build of the Envie server
+type ServerVersion struct {
+	Version              string   `json:"version"`
+	Commit               string   `json:"commit"`
+	APIVersion           string   `json:"apiVersion"`
+	SupportedAPIVersions []string `json:"supportedApiVersions"`
+
+	// ConfigSigningKey is the key the server signs configs with, nil when it
+	// serves them unsigned
+	ConfigSigningKey *ServerSigningKey `json:"configSigningKey,omitempty"`
+}
+
+// ServerSigningKey is a server's config signing key
+type ServerSigningKey struct {
+	KeyID     string `json:"keyId"`
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"publicKey"`
+}
+
+// GetServerVersion fetches the server build from the public /version endpoint
+func (c *Client) GetServerVersion() (*ServerVersion, error) {
+	var version ServerVersion
+	if err := c.doJSON("GET", "/version", nil, &version); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// ConfigWaitResponse is the result of waiting for a config change
+type ConfigWaitResponse struct {
+	ProjectID      string `json:"projectId"`
+	ConfigChecksum string `json:"configChecksum"`
+	Changed        bool   `json:"changed"`
+}
+
+// WaitForConfigChange long-polls until the config checksum differs from checksum
+// or the server gives up after timeoutSeconds. Keep timeoutSeconds below the
+// client's 30 second request timeout.
+func (c *Client) WaitForConfigChange(projectID, checksum string, timeoutSeconds int) (*ConfigWaitResponse, error) {
+	var wait ConfigWaitResponse
+	path := fmt.Sprintf("/v1/cli/projects/%s/config/wait?checksum=%s&timeout=%d", projectID, url.QueryEscape(checksum), timeoutSeconds)
+	if err := c.doJSON("GET", path, nil, &wait); err != nil {
+		return nil, err
+	}
+	return &wait, nil
+}
+
+// WriteCanary replaces the value of the project's smoke test canary item, the only
+// item a CLI token may write
+func (c *Client) WriteCanary(projectID, encryptedValue string) (*ConfigChecksumResponse, error) {
+	var checksum ConfigChecksumResponse
+	path := fmt.Sprintf("/v1/cli/projects/%s/canary", projectID)
+	body := map[string]string{"encryptedValue": encryptedValue}
+	if err := c.doJSON("PUT", path, body, &checksum); err != nil {
+		return nil, err
+	}
+	return &checksum, nil
+}
+
+// DeploymentKeyMapping maps an envie key to the provider variable name
+type DeploymentKeyMapping struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// DeploymentTarget is a Vercel, Netlify or Fly.io target configured on the project
+type DeploymentTarget struct {
+	ID                   string                 `json:"id"`
+	Name                 string                 `json:"name"`
+	Provider             string                 `json:"provider"`
+	ExternalID           string                 `json:"externalId"`
+	ExternalTeam         *string                `json:"externalTeam,omitempty"`
+	EncryptedCredentials string                 `json:"encryptedCredentials"`
+	KeyMapping           []DeploymentKeyMapping `json:"keyMapping"`
+	Environments         []string               `json:"environments"`
+}
+
+// DeploymentSync is a single sync run against a deployment target
+type DeploymentSync struct {
+	ID         string  `json:"id"`
+	TargetID   string  `json:"targetId"`
+	Status     string  `json:"status"`
+	KeysPushed int     `json:"keysPushed"`
+	Error      *string `json:"error,omitempty"`
+}
+
+// DeploymentSyncReport is sent to the server when a sync run finishes
+type DeploymentSyncReport struct {
+	Status         string  `json:"status"`
+	KeysPushed     int     `json:"keysPushed"`
+	ConfigChecksum *string `json:"configChecksum,omitempty"`
+	Error          *string `json:"error,omitempty"`
+}
+
+// GetDeploymentTargets fetches the deployment targets configured for a project
+func (c *Client) GetDeploymentTargets(projectID string) ([]DeploymentTarget, error) {
+	var targets []DeploymentTarget
+	path := fmt.Sprintf("/v1/cli/projects/%s/deployment-targets", projectID)
+	if err := c.doJSON("GET", path, nil, &targets); err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+// StartDeploymentSync records a new running sync for a deployment target
+func (c *Client) StartDeploymentSync(projectID, targetID string) (*DeploymentSync, error) {
+	var sync DeploymentSync
+	path := fmt.Sprintf("/v1/cli/projects/%s/deployment-targets/%s/syncs", projectID, targetID)
+	if err := c.doJSON("POST", path, nil, &sync); err != nil {
+		return nil, err
+	}
+	return &sync, nil
+}
+
+// ReportDeploymentSync reports the outcome of a sync run
+func (c *Client) ReportDeploymentSync(projectID, targetID, syncID string, report DeploymentSyncReport) error {
+	path := fmt.Sprintf("/v1/cli/projects/%s/deployment-targets/%s/syncs/%s", projectID, targetID, syncID)
+	return c.doJSON("PUT", path, report, nil)
+}
+
+// ProjectFile is an encrypted file of the project
+type ProjectFile struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Folder    string `json:"folder"` // slash-separated, "" for the top level
+	SizeBytes int64  `json:"sizeBytes"`
+	MimeType  string `json:"mimeType"`
+	Checksum  string `json:"checksum"` // hex SHA-256 of the plaintext
+	CreatedAt string `json:"createdAt"`
+}
+
+// ProjectFiles lists the project's files with the project key their FEKs are
+// encrypted with
+type ProjectFiles struct {
+	EncryptedProjectKey string        `json:"encryptedProjectKey"`
+	EnvelopeVersion     int           `json:"envelopeVersion"`
+	Files               []ProjectFile `json:"files"`
+}
+
+// FileDownload is an encrypted file and its encrypted FEK
+type FileDownload struct {
+	Data         string `json:"data"` // base64
+	EncryptedFEK string `json:"encryptedFek"`
+	Checksum     string `json:"checksum"`
+	Name         string `json:"name"`
+	MimeType     string `json:"mimeType"`
+}
+
+// FileUpload is a file encrypted on this machine, ready to upload
+type FileUpload struct {
+	Name         string
+	Folder       string
+	MimeType     string
+	Data         []byte // encrypted
+	EncryptedFEK string
+	Checksum     string
+	OriginalSize int64
+}
+
+// UploadedFile is the file the server stored
+type UploadedFile struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Folder    string `json:"folder"`
+	SizeBytes int64  `json:"sizeBytes"`
+}
+
+// GetProjectFiles lists the project's files
+func (c *Client) GetProjectFiles(projectID string) (*ProjectFiles, error) {
+	var files ProjectFiles
+	if err := c.doJSON("GET", fmt.Sprintf("/v1/cli/projects/%s/files", projectID), nil, &files); err != nil {
+		return nil, err
+	}
+	return &files, nil
+}
+
+// DownloadFile fetches one encrypted file
+func (c *Client) DownloadFile(projectID, fileID string) (*FileDownload, error) {
+	var download FileDownload
+	if err := c.doJSON("GET", fmt.Sprintf("/v1/cli/projects/%s/files/%s", projectID, fileID), nil, &download); err != nil {
+		return nil, err
+	}
+	return &download, nil
+}
+
+// UploadFile uploads an encrypted file; the token needs the files.write scope
+func (c *Client) UploadFile(projectID string, upload FileUpload) (*UploadedFile, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	fields := map[string]string{
+		"name":         upload.Name,
+		"folder":       upload.Folder,
+		"mimeType":     upload.MimeType,
+		"encryptedFek": upload.EncryptedFEK,
+		"checksum":     upload.Checksum,
+		"originalSize": strconv.FormatInt(upload.OriginalSize, 10),
+	}
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+	part, err := form.CreateFormFile("file", upload.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	part.Write(upload.Data)
+	if err := form.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/v1/cli/projects/%s/files", c.baseURL, projectID), &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	c.setHeaders(req)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, c.handleError(resp)
+	}
+
+	var uploaded UploadedFile
+	if err := json.NewDecoder(resp.Body).Decode(&uploaded); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &uploaded, nil
+}
+
+// doJSON performs an authenticated request with an optional JSON body and decodes the response into out
+func (c *Client) doJSON(method, path string, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.setHeaders(req)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return c.handleError(resp)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
 // setHeaders sets common headers for API requests
 func (c *Client) setHeaders(req *http.Request) {
 	req.Header.Set("X-CLI-Identity", c.identityID)
+	req.Header.Set("X-API-Version", APIVersion)
+	req.Header.Set("X-Envie-Envelope-Versions", crypto.SupportedEnvelopeVersionsHeader())
+	req.Header.Set("X-Envie-Algorithms", crypto.SupportedAlgorithmsHeader())
 	req.Header.Set("User-Agent", "envie-cli/1.0")
 	req.Header.Set("Accept", "application/json")
 }
@@ -129,7 +558,7 @@ func (c *Client) handleError(resp *http.Response) error {
 
 	var errResp ErrorResponse
 	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error != "" {
-		return fmt.Errorf("%s (status %d)", errResp.Error, resp.StatusCode)
+		return &Error{StatusCode: resp.StatusCode, Code: errResp.Code, Message: errResp.Error}
 	}
 
 	switch resp.StatusCode {
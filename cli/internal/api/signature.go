@@ -0,0 +1,168 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxSignatureAge is how old a config signature may be, and how far ahead of the
+// local clock, before it is rejected as a replay
+const MaxSignatureAge = 10 * time.Minute
+
+const (
+	signatureAlgorithm  = "ed25519"
+	signatureMessageTag = "envie-config-signature-v1"
+	signatureDigestTag  = "envie-config-items-v1"
+)
+
+// uuidPattern matches project IDs, as opposed to slugs
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ErrConfigUnsigned is a config without a signature from a client that pins
+// signing keys
+var ErrConfigUnsigned = errors.New("the server sent an unsigned config, but signing keys are pinned")
+
+// ConfigSignature is the server's signature over a config, see the backend's
+// configsign package
+type ConfigSignature struct {
+	KeyID      string `json:"keyId"`
+	Algorithm  string `json:"algorithm"`
+	KeyVersion int    `json:"keyVersion"`
+	ItemDigest string `json:"itemDigest"`
+	SignedAt   string `json:"signedAt"`
+	Value      string `json:"value"`
+}
+
+// ParseSigningKey parses a base64 Ed25519 public key, as the server logs it and
+// serves it on /version
+func ParseSigningKey(value string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid signing key %q: expected a base64 Ed25519 public key", value)
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// SigningKeyID names a public key the way signatures do: the first 8 bytes of its
+// SHA-256, in hex
+func SigningKeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// PinSigningKeys makes GetProjectConfig reject configs that aren't signed by one
+// of keys. Several keys let the server's key be rotated without breaking
+// pipelines.
+func (c *Client) PinSigningKeys(keys []ed25519.PublicKey) {
+	c.signingKeys = make(map[string]ed25519.PublicKey, len(keys))
+	for _, key := range keys {
+		c.signingKeys[SigningKeyID(key)] = key
+	}
+}
+
+// VerifyConfigSignature checks that config carries a signature by one of keys,
+// by key ID, over its project ID, checksum and items, signed within
+// MaxSignatureAge of now
+func VerifyConfigSignature(config *ProjectConfigResponse, keys map[string]ed25519.PublicKey, now time.Time) error {
+	signature := config.Signature
+	if signature == nil {
+		return ErrConfigUnsigned
+	}
+	if signature.Algorithm != signatureAlgorithm {
+		return fmt.Errorf("config signed with unsupported algorithm %q", signature.Algorithm)
+	}
+	key, ok := keys[signature.KeyID]
+	if !ok {
+		return fmt.Errorf("config signed with key %s, which isn't pinned", signature.KeyID)
+	}
+
+	signedAt, err := time.Parse(time.RFC3339, signature.SignedAt)
+	if err != nil {
+		return fmt.Errorf("invalid config signature time %q", signature.SignedAt)
+	}
+	if age := now.Sub(signedAt); age > MaxSignatureAge || age < -MaxSignatureAge {
+		return fmt.Errorf("config signed at %s, more than %s from now; it may be a replay", signature.SignedAt, MaxSignatureAge)
+	}
+
+	if digest := ConfigItemDigest(config.Items); digest != signature.ItemDigest {
+		return errors.New("config items don't match their signature")
+	}
+	value, err := base64.StdEncoding.DecodeString(signature.Value)
+	if err != nil {
+		return errors.New("invalid config signature encoding")
+	}
+	message := signatureMessage(config.ProjectID, config.ConfigChecksum, signature.KeyVersion, signature.ItemDigest, signedAt)
+	if !ed25519.Verify(key, message, value) {
+		return errors.New("invalid config signature")
+	}
+	return nil
+}
+
+// verifyConfig checks the signature of a config requested for project, an ID or
+// slug, and that it is that project's: a signature holds for any config the
+// server served in the last MaxSignatureAge, including other projects'. Slugs
+// only resolve to the token's own project, so for a slug the config must be the
+// token's project.
+func (c *Client) verifyConfig(project string, config *ProjectConfigResponse, now time.Time) error {
+	if err := VerifyConfigSignature(config, c.signingKeys, now); err != nil {
+		return err
+	}
+	expected := project
+	if !uuidPattern.MatchString(project) {
+		info, err := c.VerifyIdentity()
+		if err != nil {
+			return fmt.Errorf("failed to resolve project %s: %w", project, err)
+		}
+		if info.ProjectSlug != project {
+			return fmt.Errorf("the token is for project %s, not %s", info.ProjectSlug, project)
+		}
+		expected = info.ProjectID
+	}
+	if !strings.EqualFold(config.ProjectID, expected) {
+		return fmt.Errorf("the server sent the config of project %s for project %s", config.ProjectID, project)
+	}
+	return nil
+}
+
+// ConfigItemDigest is the SHA-256, in hex, of items in the order served: their
+// count, then each item's name, encrypted value, value type and whether it was
+// masked
+func ConfigItemDigest(items []ConfigItem) string {
+	fields := make([]string, 0, 1+4*len(items))
+	fields = append(fields, strconv.Itoa(len(items)))
+	for _, item := range items {
+		fields = append(fields, item.Name, item.EncryptedValue, item.ValueType, strconv.FormatBool(item.Masked))
+	}
+	sum := sha256.Sum256(framedFields(signatureDigestTag, fields))
+	return hex.EncodeToString(sum[:])
+}
+
+func signatureMessage(projectID, checksum string, keyVersion int, itemDigest string, signedAt time.Time) []byte {
+	return framedFields(signatureMessageTag, []string{
+		projectID,
+		checksum,
+		strconv.Itoa(keyVersion),
+		itemDigest,
+		signedAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// framedFields writes tag and fields, each prefixed with its length as a
+// big-endian uint64
+func framedFields(tag string, fields []string) []byte {
+	var b []byte
+	for _, field := range append([]string{tag}, fields...) {
+		b = binary.BigEndian.AppendUint64(b, uint64(len(field)))
+		b = append(b, field...)
+	}
+	return b
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signedConfig is the backend's vector in internal/configsign/configsign_test.go
+func signedConfig() *ProjectConfigResponse {
+	return &ProjectConfigResponse{
+		ProjectID:      "7d1f1c36-2b9a-4c55-9a1e-1f0a4c3e8b21",
+		ConfigChecksum: "4c4820abcea6b7725146144d70c1ca12edef93776f5d5ee7b484290ab41fc561",
+		Items: []ConfigItem{
+			{Name: "A", EncryptedValue: "eA==", ValueType: "string"},
+			{Name: "B", ValueType: "string", Masked: true},
+		},
+		Signature: &ConfigSignature{
+			KeyID:      "eb2b7e17484260da",
+			Algorithm:  "ed25519",
+			KeyVersion: 3,
+			ItemDigest: "c112f6d55e86d8c3cd7c4c10a85357c2b5635922ee07cd3147de8ba53bb811de",
+			SignedAt:   "2026-10-16T10:00:00Z",
+			Value:      "GsKg/q+NzcSIPlDH10vu331gfKak+vBjxpKBN23mtS2SXFg2/XYG6ed4HrGv+jSdAaUJ61uA4v+VKqUN/pKAAQ==",
+		},
+	}
+}
+
+func pinnedKeys(t *testing.T) map[string]ed25519.PublicKey {
+	t.Helper()
+	key, err := ParseSigningKey("8hHRFhKAGZfitA3evl6aXCSghOnB5F6fauKKH5X2p0A=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := SigningKeyID(key); id != "eb2b7e17484260da" {
+		t.Fatalf("key ID %s", id)
+	}
+	return map[string]ed25519.PublicKey{SigningKeyID(key): key}
+}
+
+func TestVerifyConfigSignature(t *testing.T) {
+	keys := pinnedKeys(t)
+	signedAt := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+
+	if err := VerifyConfigSignature(signedConfig(), keys, signedAt.Add(time.Minute)); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(*ProjectConfigResponse)
+		now    time.Time
+		want   string
+	}{
+		{"unsigned", func(c *ProjectConfigResponse) { c.Signature = nil }, signedAt, "unsigned"},
+		{"unknown key", func(c *ProjectConfigResponse) { c.Signature.KeyID = "0000000000000000" }, signedAt, "isn't pinned"},
+		{"other algorithm", func(c *ProjectConfigResponse) { c.Signature.Algorithm = "hmac" }, signedAt, "unsupported algorithm"},
+		{"replayed", func(*ProjectConfigResponse) {}, signedAt.Add(MaxSignatureAge + time.Second), "replay"},
+		{"from the future", func(*ProjectConfigResponse) {}, signedAt.Add(-MaxSignatureAge - time.Second), "replay"},
+		{"value swapped", func(c *ProjectConfigResponse) { c.Items[0].EncryptedValue = "eQ==" }, signedAt, "don't match"},
+		{"item dropped", func(c *ProjectConfigResponse) { c.Items = c.Items[:1] }, signedAt, "don't match"},
+		{"unmasked", func(c *ProjectConfigResponse) { c.Items[1].Masked = false }, signedAt, "don't match"},
+		{"digest replaced", func(c *ProjectConfigResponse) {
+			c.Items = c.Items[:1]
+			c.Signature.ItemDigest = ConfigItemDigest(c.Items)
+		}, signedAt, "invalid config signature"},
+		{"other project", func(c *ProjectConfigResponse) { c.ProjectID = "0d6a5d0e-8f5b-4d63-9c8e-7a3b1e2f4c5d" }, signedAt, "invalid config signature"},
+		{"stale checksum", func(c *ProjectConfigResponse) { c.ConfigChecksum = strings.Repeat("0", 64) }, signedAt, "invalid config signature"},
+		{"other key version", func(c *ProjectConfigResponse) { c.Signature.KeyVersion = 2 }, signedAt, "invalid config signature"},
+		{"time moved", func(c *ProjectConfigResponse) { c.Signature.SignedAt = "2026-10-16T10:05:00Z" }, signedAt, "invalid config signature"},
+	}
+	for _, tt := range tests {
+		config := signedConfig()
+		tt.tamper(config)
+		err := VerifyConfigSignature(config, keys, tt.now)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	config := signedConfig()
+	config.Signature = nil
+	if err := VerifyConfigSignature(config, keys, signedAt); !errors.Is(err, ErrConfigUnsigned) {
+		t.Errorf("unsigned: %v", err)
+	}
+}
+
+// A correctly signed config of another project is refused, whether the project
+// was requested by ID or by slug
+func TestVerifyConfigProject(t *testing.T) {
+	projectID := signedConfig().ProjectID
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/cli/verify" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(IdentityInfo{ProjectID: projectID, ProjectSlug: "api"})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "identity")
+	client.signingKeys = pinnedKeys(t)
+	now := time.Date(2026, 10, 16, 10, 1, 0, 0, time.UTC)
+
+	for _, requested := range []string{projectID, strings.ToUpper(projectID), "api"} {
+		if err := client.verifyConfig(requested, signedConfig(), now); err != nil {
+			t.Errorf("config of %s rejected: %v", requested, err)
+		}
+	}
+
+	projectID = "0d6a5d0e-8f5b-4d63-9c8e-7a3b1e2f4c5d"
+	for _, requested := range []string{projectID, "api", "web"} {
+		if err := client.verifyConfig(requested, signedConfig(), now); err == nil {
+			t.Errorf("config of another project accepted for %s", requested)
+		}
+	}
+}
+
+func TestParseSigningKey(t *testing.T) {
+	for _, value := range []string{"", "not base64!", "c2hvcnQ="} {
+		if _, err := ParseSigningKey(value); err == nil {
+			t.Errorf("%q accepted", value)
+		}
+	}
+}
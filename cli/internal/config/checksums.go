@@ -0,0 +1,91 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ChecksumsFileName is the file recording the config checksum of every export
+const ChecksumsFileName = "checksums.json"
+
+// CachedChecksum is the config checksum of a project's last export on this machine
+type CachedChecksum struct {
+	Checksum  string    `json:"checksum"`
+	FetchedAt time.Time `json:"fetchedAt"`
+}
+
+func checksumsPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, ChecksumsFileName), nil
+}
+
+func loadChecksums() (map[string]CachedChecksum, error) {
+	path, err := checksumsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	checksums := map[string]CachedChecksum{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return checksums, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached checksums: %w", err)
+	}
+	if err := json.Unmarshal(data, &checksums); err != nil {
+		return nil, fmt.Errorf("failed to parse cached checksums: %w", err)
+	}
+	return checksums, nil
+}
+
+// RecordChecksum remembers the checksum a project's config was exported at
+func RecordChecksum(projectID, checksum string) error {
+	checksums, err := loadChecksums()
+	if err != nil {
+		// A corrupt cache only loses the comparison in 'envie status'
+		checksums = map[string]CachedChecksum{}
+	}
+	checksums[projectID] = CachedChecksum{Checksum: checksum, FetchedAt: time.Now().UTC()}
+
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(configDir, 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(checksums, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cached checksums: %w", err)
+	}
+	path, err := checksumsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write cached checksums: %w", err)
+	}
+	return nil
+}
+
+// LoadChecksum returns the checksum of the project's last export, nil if it was
+// never exported here
+func LoadChecksum(projectID string) (*CachedChecksum, error) {
+	checksums, err := loadChecksums()
+	if err != nil {
+		return nil, err
+	}
+	cached, ok := checksums[projectID]
+	if !ok {
+		return nil, nil
+	}
+	return &cached, nil
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"github.com/stranavad/envie/cli/internal/crypto"
 )
 
 const (
@@ -15,9 +17,30 @@ const (
 	CredentialsFileName = "credentials.json"
 )
 
-// Credentials stores CLI authentication information
+// Credentials stores CLI authentication information.
+// Exactly one of Token or EncryptedToken is set; EncryptedToken is used when
+// the token was stored with 'envie auth --encrypt'.
 type Credentials struct {
-	Token string `json:"token"`
+	Token          string                     `json:"token,omitempty"`
+	EncryptedToken *crypto.PassphraseEnvelope `json:"encryptedToken,omitempty"`
+}
+
+// IsEncrypted reports whether the stored token is protected by a passphrase
+func (c *Credentials) IsEncrypted() bool {
+	return c.EncryptedToken != nil
+}
+
+// Unlock returns the plaintext token, decrypting it with the passphrase if needed
+func (c *Credentials) Unlock(passphrase string) (string, error) {
+	if !c.IsEncrypted() {
+		return c.Token, nil
+	}
+
+	tokenBytes, err := crypto.DecryptWithPassphrase(c.EncryptedToken, passphrase)
+	if err != nil {
+		return "", err
+	}
+	return string(tokenBytes), nil
 }
 
 // GetConfigDir returns the path to the Envie config directory
@@ -88,7 +111,7 @@ func LoadCredentials() (*Credentials, error) {
 		return nil, fmt.Errorf("failed to parse credentials: %w", err)
 	}
 
-	if creds.Token == "" {
+	if creds.Token == "" && creds.EncryptedToken == nil {
 		return nil, fmt.Errorf("credentials file is empty or invalid")
 	}
 
@@ -108,19 +131,3 @@ func ClearCredentials() error {
 
 	return nil
 }
-
-// GetToken retrieves the token from environment variable or credentials file
-func GetToken() (string, error) {
-	// 1. Check environment variable first (highest priority)
-	if token := os.Getenv("ENVIE_TOKEN"); token != "" {
-		return token, nil
-	}
-
-	// 2. Check credentials file
-	creds, err := LoadCredentials()
-	if err != nil {
-		return "", err
-	}
-
-	return creds.Token, nil
-}
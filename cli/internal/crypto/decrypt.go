@@ -1,15 +1,9 @@
 package crypto
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
-	"io"
-
-	"golang.org/x/crypto/curve25519"
-	"golang.org/x/crypto/hkdf"
 )
 
 const (
@@ -39,19 +33,44 @@ func DecryptWithPrivateKey(privateKey []byte, encrypted []byte) ([]byte, error)
 	ciphertext := encrypted[EphemeralPublicKeySize+IVSize:]
 
 	// Compute shared secret using X25519
-	sharedSecret, err := curve25519.X25519(privateKey, ephemeralPublic)
+	sharedSecret, err := provider.X25519(privateKey, ephemeralPublic)
 	if err != nil {
 		return nil, fmt.Errorf("X25519 key exchange failed: %w", err)
 	}
 
 	// Derive AES key using HKDF
-	aesKey, err := deriveAESKey(sharedSecret)
+	aesKey, err := provider.HKDF(sharedSecret, []byte("envie-encrypt"), 32)
 	if err != nil {
 		return nil, fmt.Errorf("key derivation failed: %w", err)
 	}
 
 	// Decrypt with AES-GCM
-	plaintext, err := decryptAESGCM(aesKey, iv, ciphertext)
+	plaintext, err := provider.OpenAESGCM(aesKey, iv, ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("AES-GCM decryption failed: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// decryptWithPrivateKeySHA256 decrypts keys wrapped by the desktop app, which derives
+// the AES key as SHA-256 of the X25519 shared secret instead of HKDF
+func decryptWithPrivateKeySHA256(privateKey []byte, encrypted []byte) ([]byte, error) {
+	if len(encrypted) < MinEncryptedSize {
+		return nil, fmt.Errorf("encrypted data too short: %d bytes", len(encrypted))
+	}
+
+	ephemeralPublic := encrypted[:EphemeralPublicKeySize]
+	iv := encrypted[EphemeralPublicKeySize : EphemeralPublicKeySize+IVSize]
+	ciphertext := encrypted[EphemeralPublicKeySize+IVSize:]
+
+	sharedSecret, err := provider.X25519(privateKey, ephemeralPublic)
+	if err != nil {
+		return nil, fmt.Errorf("X25519 key exchange failed: %w", err)
+	}
+
+	aesKey := sha256.Sum256(sharedSecret)
+	plaintext, err := provider.OpenAESGCM(aesKey[:], iv, ciphertext)
 	if err != nil {
 		return nil, fmt.Errorf("AES-GCM decryption failed: %w", err)
 	}
@@ -81,44 +100,32 @@ func DecryptConfigValue(projectKey []byte, encrypted []byte) ([]byte, error) {
 	iv := encrypted[:IVSize]
 	ciphertext := encrypted[IVSize:]
 
-	return decryptAESGCM(projectKey, iv, ciphertext)
+	return provider.OpenAESGCM(projectKey, iv, ciphertext)
 }
 
-// DecryptConfigValueBase64 is a convenience function that handles base64 encoded input
-func DecryptConfigValueBase64(projectKey []byte, encryptedBase64 string) ([]byte, error) {
-	encrypted, err := base64.StdEncoding.DecodeString(encryptedBase64)
+// DecryptConfigValueBase64 decrypts an encoded config value, dispatching on its
+// algorithm. Legacy values are plain AES-GCM.
+func DecryptConfigValueBase64(projectKey []byte, encoded string) ([]byte, error) {
+	alg, encrypted, err := DecodeBlob(encoded, AlgAESGCM)
 	if err != nil {
-		return nil, fmt.Errorf("invalid base64 encoding: %w", err)
-	}
-	return DecryptConfigValue(projectKey, encrypted)
-}
-
-// deriveAESKey derives an AES-256 key from a shared secret using HKDF
-func deriveAESKey(sharedSecret []byte) ([]byte, error) {
-	reader := hkdf.New(sha256.New, sharedSecret, nil, []byte("envie-encrypt"))
-	key := make([]byte, 32) // AES-256
-	if _, err := io.ReadFull(reader, key); err != nil {
 		return nil, err
 	}
-	return key, nil
-}
-
-// decryptAESGCM decrypts data using AES-GCM
-func decryptAESGCM(key, iv, ciphertext []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
+	if alg != AlgAESGCM {
+		return nil, fmt.Errorf("algorithm 0x%02x is not a project key cipher", byte(alg))
 	}
+	return DecryptConfigValue(projectKey, encrypted)
+}
 
-	aesGCM, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
+// EncryptConfigValueBase64 encrypts a config value with the project key in the
+// versioned format, as the desktop app does
+func EncryptConfigValueBase64(projectKey []byte, plaintext []byte) (string, error) {
+	iv := make([]byte, IVSize)
+	if err := provider.Random(iv); err != nil {
+		return "", fmt.Errorf("failed to generate IV: %w", err)
 	}
-
-	plaintext, err := aesGCM.Open(nil, iv, ciphertext, nil)
+	ciphertext, err := provider.SealAESGCM(projectKey, iv, plaintext)
 	if err != nil {
-		return nil, err
+		return "", fmt.Errorf("AES-GCM encryption failed: %w", err)
 	}
-
-	return plaintext, nil
+	return EncodeBlob(AlgAESGCM, append(iv, ciphertext...)), nil
 }
@@ -0,0 +1,177 @@
+package crypto
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Envelope versions for data wrapped to a token's public key.
+//
+// v1: AlgX25519HKDF, also stored as legacy plain base64
+// v2: AlgX25519MLKEM768, only ever written in the versioned blob format (see Algorithm)
+//
+// v2 is a hybrid X25519 + ML-KEM-768 scheme that stays confidential unless both the
+// classical and the post-quantum KEM are broken.
+const (
+	EnvelopeV1 = 1
+	EnvelopeV2 = 2
+
+	// MLKEMSeedSize is the size of the ML-KEM-768 private key seed
+	MLKEMSeedSize = 64
+
+	// MLKEMCiphertextSize is the size of an ML-KEM-768 ciphertext
+	MLKEMCiphertextSize = 1088
+)
+
+// SupportedEnvelopeVersions lists every envelope version this CLI can unwrap
+var SupportedEnvelopeVersions = []int{EnvelopeV1, EnvelopeV2}
+
+// SupportedEnvelopeVersionsHeader formats SupportedEnvelopeVersions for the API header
+func SupportedEnvelopeVersionsHeader() string {
+	parts := make([]string, len(SupportedEnvelopeVersions))
+	for i, v := range SupportedEnvelopeVersions {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+// EnvelopeVersion returns the version of an encoded envelope, or 0 if the blob is
+// not a token envelope
+func EnvelopeVersion(encoded string) int {
+	alg, _, err := DecodeBlob(encoded, AlgX25519HKDF)
+	if err != nil {
+		return 0
+	}
+	switch alg {
+	case AlgX25519HKDF:
+		return EnvelopeV1
+	case AlgX25519MLKEM768:
+		return EnvelopeV2
+	default:
+		return 0
+	}
+}
+
+// DecryptEnvelope unwraps a key encrypted to the identity, dispatching on the blob's
+// algorithm. Legacy blobs are v1 envelopes.
+func DecryptEnvelope(identity *DerivedIdentity, encoded string) ([]byte, error) {
+	alg, encrypted, err := DecodeBlob(encoded, AlgX25519HKDF)
+	if err != nil {
+		return nil, err
+	}
+
+	switch alg {
+	case AlgX25519HKDF:
+		return DecryptWithPrivateKey(identity.PrivateKey, encrypted)
+	case AlgX25519MLKEM768:
+		return DecryptHybrid(identity, encrypted)
+	case AlgX25519SHA256:
+		return decryptWithPrivateKeySHA256(identity.PrivateKey, encrypted)
+	default:
+		return nil, fmt.Errorf("algorithm 0x%02x is not a public key envelope", byte(alg))
+	}
+}
+
+// EncryptEnvelope wraps plaintext to the identity's public keys in the given envelope
+// version. Tokens are normally created in the desktop app; this is used by
+// `envie token generate --offline` to register tokens with test servers.
+func EncryptEnvelope(identity *DerivedIdentity, version int, plaintext []byte) (string, error) {
+	ephemeralPrivate := make([]byte, 32)
+	if err := provider.Random(ephemeralPrivate); err != nil {
+		return "", fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	ephemeralPublic, err := provider.X25519PublicKey(ephemeralPrivate)
+	if err != nil {
+		return "", fmt.Errorf("failed to derive ephemeral public key: %w", err)
+	}
+	dhShared, err := provider.X25519(ephemeralPrivate, identity.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("X25519 key exchange failed: %w", err)
+	}
+
+	var alg Algorithm
+	var header, aesKey []byte
+	switch version {
+	case EnvelopeV1:
+		alg = AlgX25519HKDF
+		header = ephemeralPublic
+		aesKey, err = provider.HKDF(dhShared, []byte("envie-encrypt"), 32)
+	case EnvelopeV2:
+		kemShared, kemCiphertext, kemErr := provider.MLKEM768Encapsulate(identity.KEMPublicKey)
+		if kemErr != nil {
+			return "", fmt.Errorf("ML-KEM encapsulation failed: %w", kemErr)
+		}
+		alg = AlgX25519MLKEM768
+		header = append(append([]byte{}, ephemeralPublic...), kemCiphertext...)
+		aesKey, err = deriveHybridKey(kemShared, dhShared, ephemeralPublic, identity.PublicKey)
+	default:
+		return "", fmt.Errorf("unsupported envelope version %d", version)
+	}
+	if err != nil {
+		return "", fmt.Errorf("key derivation failed: %w", err)
+	}
+
+	iv := make([]byte, IVSize)
+	if err := provider.Random(iv); err != nil {
+		return "", fmt.Errorf("failed to generate IV: %w", err)
+	}
+	ciphertext, err := provider.SealAESGCM(aesKey, iv, plaintext)
+	if err != nil {
+		return "", fmt.Errorf("AES-GCM encryption failed: %w", err)
+	}
+
+	envelope := make([]byte, 0, len(header)+len(iv)+len(ciphertext))
+	envelope = append(envelope, header...)
+	envelope = append(envelope, iv...)
+	envelope = append(envelope, ciphertext...)
+	return EncodeBlob(alg, envelope), nil
+}
+
+// DecryptHybrid decrypts a v2 envelope using X25519 + ML-KEM-768 + HKDF + AES-GCM
+//
+// Encrypted format: ephemeral_public_key (32) || mlkem_ciphertext (1088) || iv (12) || ciphertext+tag
+func DecryptHybrid(identity *DerivedIdentity, encrypted []byte) ([]byte, error) {
+	headerSize := EphemeralPublicKeySize + MLKEMCiphertextSize + IVSize
+	if len(encrypted) < headerSize+16 {
+		return nil, fmt.Errorf("encrypted data too short: %d bytes", len(encrypted))
+	}
+
+	ephemeralPublic := encrypted[:EphemeralPublicKeySize]
+	kemCiphertext := encrypted[EphemeralPublicKeySize : EphemeralPublicKeySize+MLKEMCiphertextSize]
+	iv := encrypted[EphemeralPublicKeySize+MLKEMCiphertextSize : headerSize]
+	ciphertext := encrypted[headerSize:]
+
+	dhShared, err := provider.X25519(identity.PrivateKey, ephemeralPublic)
+	if err != nil {
+		return nil, fmt.Errorf("X25519 key exchange failed: %w", err)
+	}
+
+	kemShared, err := provider.MLKEM768Decapsulate(identity.KEMSeed, kemCiphertext)
+	if err != nil {
+		return nil, fmt.Errorf("ML-KEM decapsulation failed: %w", err)
+	}
+
+	aesKey, err := deriveHybridKey(kemShared, dhShared, ephemeralPublic, identity.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("key derivation failed: %w", err)
+	}
+
+	plaintext, err := provider.OpenAESGCM(aesKey, iv, ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("AES-GCM decryption failed: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// deriveHybridKey combines both shared secrets, binding the X25519 ciphertext and
+// recipient key into the derivation (X-Wing style combiner)
+func deriveHybridKey(kemShared, dhShared, ephemeralPublic, recipientPublic []byte) ([]byte, error) {
+	ikm := make([]byte, 0, len(kemShared)+len(dhShared)+len(ephemeralPublic)+len(recipientPublic))
+	ikm = append(ikm, kemShared...)
+	ikm = append(ikm, dhShared...)
+	ikm = append(ikm, ephemeralPublic...)
+	ikm = append(ikm, recipientPublic...)
+	return provider.HKDF(ikm, []byte("envie-encrypt-v2"), 32)
+}
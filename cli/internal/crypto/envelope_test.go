@@ -0,0 +1,86 @@
+package crypto
+
+import (
+	"testing"
+)
+
+func TestDecryptEnvelopeHybrid(t *testing.T) {
+	tokenBytes := make([]byte, TokenLength)
+	if err := provider.Random(tokenBytes); err != nil {
+		t.Fatal(err)
+	}
+	identity, err := DeriveIdentity(tokenBytes)
+	if err != nil {
+		t.Fatalf("DeriveIdentity failed: %v", err)
+	}
+
+	projectKey := []byte("0123456789abcdef0123456789abcdef")
+	encoded, err := EncryptEnvelope(identity, EnvelopeV2, projectKey)
+	if err != nil {
+		t.Fatalf("EncryptEnvelope failed: %v", err)
+	}
+
+	if EnvelopeVersion(encoded) != EnvelopeV2 {
+		t.Fatalf("expected envelope version %d", EnvelopeV2)
+	}
+
+	decrypted, err := DecryptEnvelope(identity, encoded)
+	if err != nil {
+		t.Fatalf("DecryptEnvelope failed: %v", err)
+	}
+	if string(decrypted) != string(projectKey) {
+		t.Errorf("expected %q, got %q", projectKey, decrypted)
+	}
+
+	other, _ := DeriveIdentity(make([]byte, TokenLength))
+	if _, err := DecryptEnvelope(other, encoded); err == nil {
+		t.Error("expected error when decrypting with a different identity")
+	}
+}
+
+func TestEncryptEnvelopeV1(t *testing.T) {
+	_, identity, err := GenerateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	projectKey := []byte("0123456789abcdef0123456789abcdef")
+	encoded, err := EncryptEnvelope(identity, EnvelopeV1, projectKey)
+	if err != nil {
+		t.Fatalf("EncryptEnvelope failed: %v", err)
+	}
+	if EnvelopeVersion(encoded) != EnvelopeV1 {
+		t.Fatalf("expected envelope version %d", EnvelopeV1)
+	}
+
+	decrypted, err := DecryptEnvelope(identity, encoded)
+	if err != nil {
+		t.Fatalf("DecryptEnvelope failed: %v", err)
+	}
+	if string(decrypted) != string(projectKey) {
+		t.Errorf("expected %q, got %q", projectKey, decrypted)
+	}
+
+	if _, err := EncryptEnvelope(identity, 3, projectKey); err == nil {
+		t.Error("expected error for an unknown envelope version")
+	}
+}
+
+func TestEncryptConfigValue(t *testing.T) {
+	projectKey := []byte("0123456789abcdef0123456789abcdef")
+	encoded, err := EncryptConfigValueBase64(projectKey, []byte("postgres://canary"))
+	if err != nil {
+		t.Fatalf("EncryptConfigValueBase64 failed: %v", err)
+	}
+	if alg, _, err := DecodeBlob(encoded, AlgX25519HKDF); err != nil || alg != AlgAESGCM {
+		t.Fatalf("expected a versioned AES-GCM blob, got 0x%02x (%v)", byte(alg), err)
+	}
+
+	decrypted, err := DecryptConfigValueBase64(projectKey, encoded)
+	if err != nil {
+		t.Fatalf("DecryptConfigValueBase64 failed: %v", err)
+	}
+	if string(decrypted) != "postgres://canary" {
+		t.Errorf("expected %q, got %q", "postgres://canary", decrypted)
+	}
+}
@@ -0,0 +1,76 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Algorithm identifies how a versioned blob was encrypted. It is the first byte of
+// the decoded blob.
+//
+// Versioned blobs are encoded as "$" + base64(algorithm (1) || body). Legacy blobs are
+// plain base64 and their algorithm follows from where they are stored.
+type Algorithm byte
+
+const (
+	// AlgAESGCM: iv (12) || ciphertext+tag under the project key
+	AlgAESGCM Algorithm = 0x01
+	// AlgX25519HKDF: ephemeral_x25519_public (32) || iv (12) || ciphertext+tag (envelope v1)
+	AlgX25519HKDF Algorithm = 0x02
+	// AlgX25519MLKEM768: ephemeral_x25519_public (32) || mlkem768_ciphertext (1088) || iv (12) || ciphertext+tag (envelope v2)
+	AlgX25519MLKEM768 Algorithm = 0x03
+	// AlgX25519SHA256: ephemeral_x25519_public (32) || iv (12) || ciphertext+tag, key = SHA-256(shared secret)
+	AlgX25519SHA256 Algorithm = 0x04
+
+	// VersionedBlobPrefix marks a blob in the versioned format (not part of the base64 alphabet)
+	VersionedBlobPrefix = "$"
+)
+
+// SupportedAlgorithms lists every algorithm this CLI can decrypt
+var SupportedAlgorithms = []Algorithm{AlgAESGCM, AlgX25519HKDF, AlgX25519MLKEM768, AlgX25519SHA256}
+
+// SupportedAlgorithmsHeader formats SupportedAlgorithms for the API header
+func SupportedAlgorithmsHeader() string {
+	parts := make([]string, len(SupportedAlgorithms))
+	for i, alg := range SupportedAlgorithms {
+		parts[i] = strconv.Itoa(int(alg))
+	}
+	return strings.Join(parts, ",")
+}
+
+// EncodeBlob returns body in the versioned format
+func EncodeBlob(alg Algorithm, body []byte) string {
+	data := make([]byte, 0, 1+len(body))
+	data = append(data, byte(alg))
+	data = append(data, body...)
+	return VersionedBlobPrefix + base64.StdEncoding.EncodeToString(data)
+}
+
+// DecodeBlob parses an encoded blob. Legacy blobs report the legacy algorithm the
+// caller expects for that kind of data.
+func DecodeBlob(encoded string, legacy Algorithm) (Algorithm, []byte, error) {
+	if !strings.HasPrefix(encoded, VersionedBlobPrefix) {
+		body, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid base64 encoding: %w", err)
+		}
+		return legacy, body, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encoded, VersionedBlobPrefix))
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid base64 encoding: %w", err)
+	}
+	if len(data) == 0 {
+		return 0, nil, fmt.Errorf("empty encrypted blob")
+	}
+
+	alg := Algorithm(data[0])
+	if !slices.Contains(SupportedAlgorithms, alg) {
+		return 0, nil, fmt.Errorf("unsupported encryption algorithm 0x%02x, upgrade the Envie CLI", byte(alg))
+	}
+	return alg, data[1:], nil
+}
@@ -0,0 +1,69 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func sealConfigValueForTest(t *testing.T, projectKey, plaintext []byte) []byte {
+	t.Helper()
+
+	iv := make([]byte, IVSize)
+	if err := provider.Random(iv); err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := provider.SealAESGCM(projectKey, iv, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(iv, ciphertext...)
+}
+
+func TestDecryptConfigValueVersionedAndLegacy(t *testing.T) {
+	projectKey := []byte("0123456789abcdef0123456789abcdef")
+	encrypted := sealConfigValueForTest(t, projectKey, []byte("secret"))
+
+	for name, encoded := range map[string]string{
+		"legacy":    base64.StdEncoding.EncodeToString(encrypted),
+		"versioned": EncodeBlob(AlgAESGCM, encrypted),
+	} {
+		plaintext, err := DecryptConfigValueBase64(projectKey, encoded)
+		if err != nil {
+			t.Fatalf("%s: decrypt failed: %v", name, err)
+		}
+		if string(plaintext) != "secret" {
+			t.Fatalf("%s: got %q", name, plaintext)
+		}
+	}
+}
+
+func TestDecodeBlobRejectsUnknownAlgorithm(t *testing.T) {
+	encoded := EncodeBlob(Algorithm(0x7f), []byte("body"))
+	if _, _, err := DecodeBlob(encoded, AlgAESGCM); err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Fatalf("expected unsupported algorithm error, got %v", err)
+	}
+}
+
+func TestDecryptConfigValueRejectsEnvelopeAlgorithm(t *testing.T) {
+	projectKey := []byte("0123456789abcdef0123456789abcdef")
+	encoded := EncodeBlob(AlgX25519HKDF, sealConfigValueForTest(t, projectKey, []byte("secret")))
+	if _, err := DecryptConfigValueBase64(projectKey, encoded); err == nil {
+		t.Fatal("expected an error for a public key envelope used as a config value")
+	}
+}
+
+func TestEnvelopeVersionOfVersionedBlobs(t *testing.T) {
+	cases := map[string]int{
+		EncodeBlob(AlgX25519HKDF, []byte{1}):     EnvelopeV1,
+		EncodeBlob(AlgX25519MLKEM768, []byte{1}): EnvelopeV2,
+		EncodeBlob(AlgAESGCM, []byte{1}):         0,
+		"v2:AQ==":                                0,
+		"AQ==":                                   EnvelopeV1,
+	}
+	for encoded, want := range cases {
+		if got := EnvelopeVersion(encoded); got != want {
+			t.Errorf("EnvelopeVersion(%q) = %d, want %d", encoded, got, want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// Fuzz targets for the parsers that handle tokens and server responses. The seeds
+// below and testdata/fuzz/<target> run as regular tests; to fuzz, e.g.
+//
+//	go test ./internal/crypto -run '^$' -fuzz FuzzDecryptEnvelope -fuzztime 1m
+//
+// New failing inputs are written to testdata/fuzz and should be committed with the fix.
+
+func FuzzParseToken(f *testing.F) {
+	for _, v := range loadTestVectors(f).Tokens {
+		f.Add(v.Token)
+	}
+	f.Add("")
+	f.Add(TokenPrefix)
+	f.Add(TokenPrefix + "====")
+	f.Add(TokenPrefix + strings.Repeat("A", 44))
+
+	f.Fuzz(func(t *testing.T, token string) {
+		identity, err := ParseToken(token)
+		if err != nil {
+			return
+		}
+
+		tokenBytes, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, TokenPrefix))
+		if err != nil || len(tokenBytes) != TokenLength {
+			t.Fatalf("accepted token with %d bytes (%v)", len(tokenBytes), err)
+		}
+		identityID, err := hex.DecodeString(identity.IdentityID)
+		if err != nil || len(identityID) != 16 {
+			t.Fatalf("identity ID %q is not 16 bytes of hex", identity.IdentityID)
+		}
+		if hash := sha256.Sum256(identityID); hex.EncodeToString(hash[:]) != identity.IdentityIDHash {
+			t.Fatal("identity ID hash does not match the identity ID")
+		}
+		if len(identity.PrivateKey) != 32 || len(identity.PublicKey) != 32 || len(identity.KEMPublicKey) != 1184 {
+			t.Fatal("derived keys have the wrong size")
+		}
+	})
+}
+
+func FuzzDecodeBlob(f *testing.F) {
+	addBlobSeeds(f)
+
+	f.Fuzz(func(t *testing.T, encoded string) {
+		alg, body, err := DecodeBlob(encoded, AlgAESGCM)
+		if err != nil {
+			return
+		}
+		reAlg, reBody, err := DecodeBlob(EncodeBlob(alg, body), AlgX25519HKDF)
+		if err != nil || reAlg != alg || string(reBody) != string(body) {
+			t.Fatalf("EncodeBlob does not round-trip: alg 0x%02x, err %v", byte(reAlg), err)
+		}
+
+		switch version := EnvelopeVersion(encoded); version {
+		case 0, EnvelopeV1, EnvelopeV2:
+		default:
+			t.Fatalf("EnvelopeVersion = %d", version)
+		}
+	})
+}
+
+func FuzzDecryptEnvelope(f *testing.F) {
+	vectors := loadTestVectors(f)
+	identity, err := ParseToken(vectors.Tokens[0].Token)
+	if err != nil {
+		f.Fatal(err)
+	}
+	addBlobSeeds(f)
+
+	f.Fuzz(func(t *testing.T, encoded string) {
+		plaintext, err := DecryptEnvelope(identity, encoded)
+		if err != nil {
+			return
+		}
+		// Forging an authenticated envelope is infeasible, so only real ones open
+		for _, v := range vectors.Envelopes {
+			if v.Token == vectors.Tokens[0].Name && hex.EncodeToString(plaintext) == v.Plaintext {
+				return
+			}
+		}
+		t.Fatalf("opened an envelope that was not sealed to the identity: %x", plaintext)
+	})
+}
+
+func FuzzDecryptConfigValue(f *testing.F) {
+	vectors := loadTestVectors(f)
+	projectKey := mustHex(f, vectors.ConfigValues[0].ProjectKey)
+	addBlobSeeds(f)
+
+	f.Fuzz(func(t *testing.T, encoded string) {
+		if _, err := DecryptConfigValueBase64(projectKey, encoded); err != nil {
+			return
+		}
+		if alg, _, _ := DecodeBlob(encoded, AlgAESGCM); alg != AlgAESGCM {
+			t.Fatalf("decrypted a blob with algorithm 0x%02x", byte(alg))
+		}
+	})
+}
+
+func addBlobSeeds(f *testing.F) {
+	vectors := loadTestVectors(f)
+	for _, v := range vectors.Envelopes {
+		f.Add(v.Encoded)
+	}
+	for _, v := range vectors.ConfigValues {
+		f.Add(v.Encoded)
+	}
+	for _, v := range vectors.InvalidBlobs {
+		f.Add(v.Encoded)
+	}
+	f.Add("")
+	f.Add(VersionedBlobPrefix)
+	f.Add(EncodeBlob(AlgX25519MLKEM768, make([]byte, EphemeralPublicKeySize+MLKEMCiphertextSize+IVSize+16)))
+}
@@ -0,0 +1,137 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// PassphraseKDF identifies the key derivation function used for passphrase envelopes
+	PassphraseKDF = "argon2id"
+
+	// SaltSize is the size of the random Argon2id salt
+	SaltSize = 16
+)
+
+// Argon2Params are the Argon2id cost parameters stored alongside the ciphertext
+// so they can be raised in the future without breaking existing envelopes
+type Argon2Params struct {
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"` // KiB
+	Threads uint8  `json:"threads"`
+}
+
+// DefaultArgon2Params follows the RFC 9106 second recommended option (64 MiB, 3 passes)
+var DefaultArgon2Params = Argon2Params{
+	Time:    3,
+	Memory:  64 * 1024,
+	Threads: 4,
+}
+
+// Upper bounds for Argon2Params read from disk. An edited credentials file must
+// not be able to make the CLI allocate unbounded memory or spin forever.
+const (
+	MaxArgon2Time    = 16
+	MaxArgon2Memory  = 1024 * 1024 // KiB (1 GiB)
+	MaxArgon2Threads = 16
+)
+
+// Validate checks that the parameters are usable by Argon2id and within the maxima above
+func (p Argon2Params) Validate() error {
+	if p.Time == 0 || p.Time > MaxArgon2Time {
+		return fmt.Errorf("argon2 time must be between 1 and %d, got %d", MaxArgon2Time, p.Time)
+	}
+	if p.Threads == 0 || p.Threads > MaxArgon2Threads {
+		return fmt.Errorf("argon2 threads must be between 1 and %d, got %d", MaxArgon2Threads, p.Threads)
+	}
+	if p.Memory < 8*uint32(p.Threads) || p.Memory > MaxArgon2Memory {
+		return fmt.Errorf("argon2 memory must be between %d and %d KiB, got %d", 8*uint32(p.Threads), MaxArgon2Memory, p.Memory)
+	}
+	return nil
+}
+
+// PassphraseEnvelope holds data encrypted with a key derived from a passphrase
+//
+// Key derivation: Argon2id(passphrase, salt) -> 32 byte AES-256 key
+// Encryption: AES-GCM with a random 12 byte nonce
+type PassphraseEnvelope struct {
+	KDF        string       `json:"kdf"`
+	Params     Argon2Params `json:"params"`
+	Salt       string       `json:"salt"`
+	Nonce      string       `json:"nonce"`
+	Ciphertext string       `json:"ciphertext"`
+}
+
+// EncryptWithPassphrase encrypts plaintext with a key derived from the passphrase
+func EncryptWithPassphrase(plaintext []byte, passphrase string) (*PassphraseEnvelope, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase must not be empty")
+	}
+
+	salt := make([]byte, SaltSize)
+	if err := provider.Random(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	nonce := make([]byte, IVSize)
+	if err := provider.Random(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	params := DefaultArgon2Params
+	key := derivePassphraseKey(passphrase, salt, params)
+
+	ciphertext, err := provider.SealAESGCM(key, nonce, plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("AES-GCM encryption failed: %w", err)
+	}
+
+	return &PassphraseEnvelope{
+		KDF:        PassphraseKDF,
+		Params:     params,
+		Salt:       base64.StdEncoding.EncodeToString(salt),
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
+	}, nil
+}
+
+// DecryptWithPassphrase decrypts an envelope created by EncryptWithPassphrase
+func DecryptWithPassphrase(envelope *PassphraseEnvelope, passphrase string) ([]byte, error) {
+	if envelope.KDF != PassphraseKDF {
+		return nil, fmt.Errorf("unsupported key derivation function: %s", envelope.KDF)
+	}
+
+	if err := envelope.Params.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid key derivation parameters: %w", err)
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(envelope.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt encoding: %w", err)
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(envelope.Nonce)
+	if err != nil || len(nonce) != IVSize {
+		return nil, fmt.Errorf("invalid nonce")
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(envelope.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ciphertext encoding: %w", err)
+	}
+
+	key := derivePassphraseKey(passphrase, salt, envelope.Params)
+
+	plaintext, err := provider.OpenAESGCM(key, nonce, ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("wrong passphrase or corrupted credentials")
+	}
+
+	return plaintext, nil
+}
+
+func derivePassphraseKey(passphrase string, salt []byte, params Argon2Params) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, params.Time, params.Memory, params.Threads, 32)
+}
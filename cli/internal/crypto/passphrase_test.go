@@ -0,0 +1,112 @@
+package crypto
+
+import (
+	"testing"
+)
+
+func TestPassphraseRoundTrip(t *testing.T) {
+	plaintext := []byte("envie_AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA")
+
+	envelope, err := EncryptWithPassphrase(plaintext, "correct horse battery staple")
+	if err != nil {
+		t.Fatalf("EncryptWithPassphrase failed: %v", err)
+	}
+
+	if envelope.KDF != PassphraseKDF {
+		t.Errorf("expected kdf %s, got %s", PassphraseKDF, envelope.KDF)
+	}
+
+	decrypted, err := DecryptWithPassphrase(envelope, "correct horse battery staple")
+	if err != nil {
+		t.Fatalf("DecryptWithPassphrase failed: %v", err)
+	}
+
+	if string(decrypted) != string(plaintext) {
+		t.Errorf("expected %q, got %q", plaintext, decrypted)
+	}
+
+	if _, err := DecryptWithPassphrase(envelope, "wrong passphrase"); err == nil {
+		t.Error("expected error for wrong passphrase")
+	}
+}
+
+func TestEncryptWithEmptyPassphrase(t *testing.T) {
+	if _, err := EncryptWithPassphrase([]byte("secret"), ""); err == nil {
+		t.Error("expected error for empty passphrase")
+	}
+}
+
+func TestDecryptWithWrongPassphrase(t *testing.T) {
+	envelope, err := EncryptWithPassphrase([]byte("secret"), "right")
+	if err != nil {
+		t.Fatalf("EncryptWithPassphrase failed: %v", err)
+	}
+
+	if _, err := DecryptWithPassphrase(envelope, "wrong"); err == nil || err.Error() != "wrong passphrase or corrupted credentials" {
+		t.Errorf("expected wrong passphrase error, got %v", err)
+	}
+}
+
+func TestDecryptRejectsInvalidParams(t *testing.T) {
+	envelope, err := EncryptWithPassphrase([]byte("secret"), "passphrase")
+	if err != nil {
+		t.Fatalf("EncryptWithPassphrase failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		params Argon2Params
+	}{
+		{"zero params", Argon2Params{}},
+		{"zero time", Argon2Params{Time: 0, Memory: 64 * 1024, Threads: 4}},
+		{"zero threads", Argon2Params{Time: 3, Memory: 64 * 1024, Threads: 0}},
+		{"zero memory", Argon2Params{Time: 3, Memory: 0, Threads: 4}},
+		{"memory below threads minimum", Argon2Params{Time: 3, Memory: 16, Threads: 4}},
+		{"excessive time", Argon2Params{Time: MaxArgon2Time + 1, Memory: 64 * 1024, Threads: 4}},
+		{"excessive memory", Argon2Params{Time: 3, Memory: MaxArgon2Memory + 1, Threads: 4}},
+		{"excessive threads", Argon2Params{Time: 3, Memory: 64 * 1024, Threads: MaxArgon2Threads + 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := *envelope
+			tampered.Params = tt.params
+			if _, err := DecryptWithPassphrase(&tampered, "passphrase"); err == nil {
+				t.Error("expected error for invalid params")
+			}
+		})
+	}
+}
+
+func TestDecryptRejectsMalformedEnvelope(t *testing.T) {
+	envelope, err := EncryptWithPassphrase([]byte("secret"), "passphrase")
+	if err != nil {
+		t.Fatalf("EncryptWithPassphrase failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*PassphraseEnvelope)
+	}{
+		{"unknown kdf", func(e *PassphraseEnvelope) { e.KDF = "scrypt" }},
+		{"bad salt", func(e *PassphraseEnvelope) { e.Salt = "!!" }},
+		{"short nonce", func(e *PassphraseEnvelope) { e.Nonce = "AAAA" }},
+		{"bad ciphertext", func(e *PassphraseEnvelope) { e.Ciphertext = "!!" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := *envelope
+			tt.mutate(&tampered)
+			if _, err := DecryptWithPassphrase(&tampered, "passphrase"); err == nil {
+				t.Error("expected error for malformed envelope")
+			}
+		})
+	}
+}
+
+func TestDefaultArgon2ParamsAreValid(t *testing.T) {
+	if err := DefaultArgon2Params.Validate(); err != nil {
+		t.Errorf("default params rejected: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+)
+
+// Provider supplies the cryptographic primitives behind envie's encryption scheme
+// (X25519 ECDH + HKDF-SHA256 + AES-256-GCM). Token parsing and decryption only go
+// through the active provider, so a build can swap in a FIPS-validated module or a
+// post-quantum hybrid implementation without touching callers.
+type Provider interface {
+	// Name identifies the provider in diagnostics
+	Name() string
+
+	// Random fills b with cryptographically secure random bytes
+	Random(b []byte) error
+
+	// X25519 computes the shared secret between a private scalar and a peer public key
+	X25519(privateKey, peerPublicKey []byte) ([]byte, error)
+
+	// X25519PublicKey derives the public key for a private scalar
+	X25519PublicKey(privateKey []byte) ([]byte, error)
+
+	// HKDF derives length bytes from secret using HKDF-SHA256 with an empty salt
+	HKDF(secret, info []byte, length int) ([]byte, error)
+
+	// SealAESGCM encrypts and authenticates plaintext, returning ciphertext || tag
+	SealAESGCM(key, iv, plaintext []byte) ([]byte, error)
+
+	// OpenAESGCM authenticates and decrypts ciphertext || tag
+	OpenAESGCM(key, iv, ciphertext []byte) ([]byte, error)
+
+	// MLKEM768EncapsulationKey derives the ML-KEM-768 encapsulation (public) key from a 64 byte seed
+	MLKEM768EncapsulationKey(seed []byte) ([]byte, error)
+
+	// MLKEM768Encapsulate generates a shared secret and its ciphertext for an encapsulation key
+	MLKEM768Encapsulate(encapsulationKey []byte) (sharedKey, ciphertext []byte, err error)
+
+	// MLKEM768Decapsulate recovers the shared secret from a ciphertext using the key seed
+	MLKEM768Decapsulate(seed, ciphertext []byte) ([]byte, error)
+}
+
+var provider Provider = defaultProvider()
+
+// SetProvider replaces the active crypto provider. It must be called before any
+// token is parsed.
+func SetProvider(p Provider) {
+	if p == nil {
+		panic("crypto: nil provider")
+	}
+	provider = p
+}
+
+// CurrentProvider returns the active crypto provider
+func CurrentProvider() Provider {
+	return provider
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,96 @@
+//go:build fips
+
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/mlkem"
+	"crypto/rand"
+	"crypto/sha256"
+)
+
+func defaultProvider() Provider {
+	return fipsProvider{}
+}
+
+// fipsProvider implements the primitives only with standard library packages from
+// the Go Cryptographic Module. Build with -tags fips and run with GOFIPS140 set.
+//
+// X25519 is not a FIPS-approved algorithm: it works with GODEBUG=fips140=on but
+// fails under fips140=only, which therefore can't decrypt envie tokens.
+type fipsProvider struct{}
+
+func (fipsProvider) Name() string {
+	return "fips"
+}
+
+func (fipsProvider) Random(b []byte) error {
+	_, err := rand.Read(b)
+	return err
+}
+
+func (fipsProvider) X25519(privateKey, peerPublicKey []byte) ([]byte, error) {
+	priv, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := ecdh.X25519().NewPublicKey(peerPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return priv.ECDH(pub)
+}
+
+func (fipsProvider) X25519PublicKey(privateKey []byte) ([]byte, error) {
+	priv, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return priv.PublicKey().Bytes(), nil
+}
+
+func (fipsProvider) HKDF(secret, info []byte, length int) ([]byte, error) {
+	return hkdf.Key(sha256.New, secret, nil, string(info), length)
+}
+
+func (fipsProvider) SealAESGCM(key, iv, plaintext []byte) ([]byte, error) {
+	aesGCM, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return aesGCM.Seal(nil, iv, plaintext, nil), nil
+}
+
+func (fipsProvider) OpenAESGCM(key, iv, ciphertext []byte) ([]byte, error) {
+	aesGCM, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return aesGCM.Open(nil, iv, ciphertext, nil)
+}
+
+func (fipsProvider) MLKEM768EncapsulationKey(seed []byte) ([]byte, error) {
+	dk, err := mlkem.NewDecapsulationKey768(seed)
+	if err != nil {
+		return nil, err
+	}
+	return dk.EncapsulationKey().Bytes(), nil
+}
+
+func (fipsProvider) MLKEM768Encapsulate(encapsulationKey []byte) ([]byte, []byte, error) {
+	ek, err := mlkem.NewEncapsulationKey768(encapsulationKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	sharedKey, ciphertext := ek.Encapsulate()
+	return sharedKey, ciphertext, nil
+}
+
+func (fipsProvider) MLKEM768Decapsulate(seed, ciphertext []byte) ([]byte, error) {
+	dk, err := mlkem.NewDecapsulationKey768(seed)
+	if err != nil {
+		return nil, err
+	}
+	return dk.Decapsulate(ciphertext)
+}
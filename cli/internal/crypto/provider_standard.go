@@ -0,0 +1,87 @@
+//go:build !fips
+
+package crypto
+
+import (
+	"crypto/mlkem"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+func defaultProvider() Provider {
+	return standardProvider{}
+}
+
+// standardProvider implements the primitives with golang.org/x/crypto and the standard library
+type standardProvider struct{}
+
+func (standardProvider) Name() string {
+	return "standard"
+}
+
+func (standardProvider) Random(b []byte) error {
+	_, err := rand.Read(b)
+	return err
+}
+
+func (standardProvider) X25519(privateKey, peerPublicKey []byte) ([]byte, error) {
+	return curve25519.X25519(privateKey, peerPublicKey)
+}
+
+func (standardProvider) X25519PublicKey(privateKey []byte) ([]byte, error) {
+	return curve25519.X25519(privateKey, curve25519.Basepoint)
+}
+
+func (standardProvider) HKDF(secret, info []byte, length int) ([]byte, error) {
+	reader := hkdf.New(sha256.New, secret, nil, info)
+	result := make([]byte, length)
+	if _, err := io.ReadFull(reader, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (standardProvider) SealAESGCM(key, iv, plaintext []byte) ([]byte, error) {
+	aesGCM, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return aesGCM.Seal(nil, iv, plaintext, nil), nil
+}
+
+func (standardProvider) OpenAESGCM(key, iv, ciphertext []byte) ([]byte, error) {
+	aesGCM, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return aesGCM.Open(nil, iv, ciphertext, nil)
+}
+
+func (standardProvider) MLKEM768EncapsulationKey(seed []byte) ([]byte, error) {
+	dk, err := mlkem.NewDecapsulationKey768(seed)
+	if err != nil {
+		return nil, err
+	}
+	return dk.EncapsulationKey().Bytes(), nil
+}
+
+func (standardProvider) MLKEM768Encapsulate(encapsulationKey []byte) ([]byte, []byte, error) {
+	ek, err := mlkem.NewEncapsulationKey768(encapsulationKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	sharedKey, ciphertext := ek.Encapsulate()
+	return sharedKey, ciphertext, nil
+}
+
+func (standardProvider) MLKEM768Decapsulate(seed, ciphertext []byte) ([]byte, error) {
+	dk, err := mlkem.NewDecapsulationKey768(seed)
+	if err != nil {
+		return nil, err
+	}
+	return dk.Decapsulate(ciphertext)
+}
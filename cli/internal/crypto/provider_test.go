@@ -0,0 +1,68 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+// stubProvider wraps the default provider so tests can tell it apart
+type stubProvider struct {
+	Provider
+}
+
+func (stubProvider) Name() string {
+	return "stub"
+}
+
+func TestDefaultProviderIsActive(t *testing.T) {
+	if got, want := CurrentProvider().Name(), defaultProvider().Name(); got != want {
+		t.Errorf("active provider %q, want default %q", got, want)
+	}
+}
+
+func TestSetProvider(t *testing.T) {
+	original := CurrentProvider()
+	defer SetProvider(original)
+
+	SetProvider(stubProvider{original})
+	if got := CurrentProvider().Name(); got != "stub" {
+		t.Errorf("expected stub provider, got %q", got)
+	}
+}
+
+func TestSetNilProviderPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected SetProvider(nil) to panic")
+		}
+	}()
+	SetProvider(nil)
+}
+
+func TestProviderX25519Agreement(t *testing.T) {
+	p := CurrentProvider()
+
+	alice := bytes.Repeat([]byte{1}, 32)
+	bob := bytes.Repeat([]byte{2}, 32)
+
+	alicePub, err := p.X25519PublicKey(alice)
+	if err != nil {
+		t.Fatalf("X25519PublicKey failed: %v", err)
+	}
+	bobPub, err := p.X25519PublicKey(bob)
+	if err != nil {
+		t.Fatalf("X25519PublicKey failed: %v", err)
+	}
+
+	s1, err := p.X25519(alice, bobPub)
+	if err != nil {
+		t.Fatalf("X25519 failed: %v", err)
+	}
+	s2, err := p.X25519(bob, alicePub)
+	if err != nil {
+		t.Fatalf("X25519 failed: %v", err)
+	}
+	if !bytes.Equal(s1, s2) {
+		t.Error("X25519 shared secrets differ")
+	}
+}
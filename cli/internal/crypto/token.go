@@ -5,11 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
-	"io"
 	"strings"
-
-	"golang.org/x/crypto/curve25519"
-	"golang.org/x/crypto/hkdf"
 )
 
 const (
@@ -33,6 +29,12 @@ type DerivedIdentity struct {
 
 	// PublicKey is the X25519 public key (32 bytes)
 	PublicKey []byte
+
+	// KEMSeed is the ML-KEM-768 private key seed for hybrid (v2) envelopes (64 bytes)
+	KEMSeed []byte
+
+	// KEMPublicKey is the ML-KEM-768 encapsulation key (1184 bytes)
+	KEMPublicKey []byte
 }
 
 // ParseToken validates and parses an Envie CLI token, deriving the identity and keys
@@ -60,7 +62,7 @@ func ParseToken(token string) (*DerivedIdentity, error) {
 // DeriveIdentity derives the identity ID and keypair from raw token bytes
 func DeriveIdentity(tokenBytes []byte) (*DerivedIdentity, error) {
 	// Derive identity ID (16 bytes = 32 hex characters)
-	identityIDBytes, err := hkdfDerive(tokenBytes, []byte("envie-identity-id"), 16)
+	identityIDBytes, err := provider.HKDF(tokenBytes, []byte("envie-identity-id"), 16)
 	if err != nil {
 		return nil, fmt.Errorf("failed to derive identity ID: %w", err)
 	}
@@ -71,44 +73,43 @@ func DeriveIdentity(tokenBytes []byte) (*DerivedIdentity, error) {
 	identityIDHash := hex.EncodeToString(hash[:])
 
 	// Derive X25519 private key (32 bytes)
-	privateKey, err := hkdfDerive(tokenBytes, []byte("envie-private-key"), 32)
+	privateKey, err := provider.HKDF(tokenBytes, []byte("envie-private-key"), 32)
 	if err != nil {
 		return nil, fmt.Errorf("failed to derive private key: %w", err)
 	}
 
 	// Derive public key from private key
-	publicKey, err := curve25519.X25519(privateKey, curve25519.Basepoint)
+	publicKey, err := provider.X25519PublicKey(privateKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to derive public key: %w", err)
 	}
 
+	// Derive ML-KEM-768 key seed for post-quantum hybrid envelopes
+	kemSeed, err := provider.HKDF(tokenBytes, []byte("envie-mlkem-seed"), MLKEMSeedSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive ML-KEM seed: %w", err)
+	}
+
+	kemPublicKey, err := provider.MLKEM768EncapsulationKey(kemSeed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive ML-KEM public key: %w", err)
+	}
+
 	return &DerivedIdentity{
 		IdentityID:     identityID,
 		IdentityIDHash: identityIDHash,
 		PrivateKey:     privateKey,
 		PublicKey:      publicKey,
+		KEMSeed:        kemSeed,
+		KEMPublicKey:   kemPublicKey,
 	}, nil
 }
 
-// hkdfDerive derives key material using HKDF-SHA256
-func hkdfDerive(secret, info []byte, length int) ([]byte, error) {
-	reader := hkdf.New(sha256.New, secret, nil, info)
-	result := make([]byte, length)
-	if _, err := io.ReadFull(reader, result); err != nil {
-		return nil, err
-	}
-	return result, nil
-}
-
-// GenerateToken creates a new random token (for testing/development)
+// GenerateToken creates a new random token and derives its identity
 func GenerateToken() (string, *DerivedIdentity, error) {
-	// In production, tokens are generated in the desktop app
-	// This is just for testing
 	tokenBytes := make([]byte, TokenLength)
-	// Note: In production, use crypto/rand
-	// For now, this is just a placeholder
-	for i := range tokenBytes {
-		tokenBytes[i] = byte(i)
+	if err := provider.Random(tokenBytes); err != nil {
+		return "", nil, fmt.Errorf("failed to generate token: %w", err)
 	}
 
 	identity, err := DeriveIdentity(tokenBytes)
@@ -119,3 +120,13 @@ func GenerateToken() (string, *DerivedIdentity, error) {
 	token := TokenPrefix + base64.RawURLEncoding.EncodeToString(tokenBytes)
 	return token, identity, nil
 }
+
+// TokenDisplayPrefix returns the first characters after TokenPrefix, which the
+// server stores to help users recognise a token
+func TokenDisplayPrefix(token string) string {
+	encoded := strings.TrimPrefix(token, TokenPrefix)
+	if len(encoded) > 3 {
+		encoded = encoded[:3]
+	}
+	return encoded
+}
@@ -72,3 +72,30 @@ func TestParseTokenInvalidFormat(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateToken(t *testing.T) {
+	token, identity, err := GenerateToken()
+	if err != nil {
+		t.Fatalf("GenerateToken failed: %v", err)
+	}
+
+	parsed, err := ParseToken(token)
+	if err != nil {
+		t.Fatalf("generated token does not parse: %v", err)
+	}
+	if parsed.IdentityIDHash != identity.IdentityIDHash {
+		t.Error("returned identity does not match the token")
+	}
+
+	other, _, err := GenerateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token == other {
+		t.Error("two generated tokens are equal")
+	}
+
+	if got := TokenDisplayPrefix(token); len(got) != 3 || token[len(TokenPrefix):len(TokenPrefix)+3] != got {
+		t.Errorf("TokenDisplayPrefix = %q", got)
+	}
+}
@@ -0,0 +1,151 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// vectorsPath is the test vector file shared with backend/internal/crypto
+const vectorsPath = "../../../testdata/crypto-vectors.json"
+
+type testVectors struct {
+	Tokens []struct {
+		Name               string `json:"name"`
+		Token              string `json:"token"`
+		IdentityID         string `json:"identityId"`
+		IdentityIDHash     string `json:"identityIdHash"`
+		PublicKey          string `json:"publicKey"`
+		KEMPublicKeySHA256 string `json:"kemPublicKeySha256"`
+	} `json:"tokens"`
+	Envelopes []struct {
+		Name            string `json:"name"`
+		Token           string `json:"token"`
+		Plaintext       string `json:"plaintext"`
+		Algorithm       int    `json:"algorithm"`
+		EnvelopeVersion int    `json:"envelopeVersion"`
+		Encoded         string `json:"encoded"`
+	} `json:"envelopes"`
+	ConfigValues []struct {
+		Name       string `json:"name"`
+		ProjectKey string `json:"projectKey"`
+		Plaintext  string `json:"plaintext"`
+		Encoded    string `json:"encoded"`
+	} `json:"configValues"`
+	InvalidBlobs []struct {
+		Name    string `json:"name"`
+		Encoded string `json:"encoded"`
+	} `json:"invalidBlobs"`
+}
+
+func loadTestVectors(t testing.TB) *testVectors {
+	t.Helper()
+
+	data, err := os.ReadFile(vectorsPath)
+	if err != nil {
+		t.Fatalf("failed to read test vectors: %v", err)
+	}
+
+	var vectors testVectors
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatalf("failed to parse test vectors: %v", err)
+	}
+	return &vectors
+}
+
+func mustHex(t testing.TB, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid hex in test vectors: %v", err)
+	}
+	return b
+}
+
+func TestVectorsTokenDerivation(t *testing.T) {
+	for _, v := range loadTestVectors(t).Tokens {
+		t.Run(v.Name, func(t *testing.T) {
+			identity, err := ParseToken(v.Token)
+			if err != nil {
+				t.Fatalf("ParseToken failed: %v", err)
+			}
+
+			if identity.IdentityID != v.IdentityID {
+				t.Errorf("identity ID = %s, want %s", identity.IdentityID, v.IdentityID)
+			}
+			if identity.IdentityIDHash != v.IdentityIDHash {
+				t.Errorf("identity ID hash = %s, want %s", identity.IdentityIDHash, v.IdentityIDHash)
+			}
+			if got := hex.EncodeToString(identity.PublicKey); got != v.PublicKey {
+				t.Errorf("public key = %s, want %s", got, v.PublicKey)
+			}
+			kemHash := sha256.Sum256(identity.KEMPublicKey)
+			if got := hex.EncodeToString(kemHash[:]); got != v.KEMPublicKeySHA256 {
+				t.Errorf("ML-KEM public key hash = %s, want %s", got, v.KEMPublicKeySHA256)
+			}
+		})
+	}
+}
+
+func TestVectorsEnvelopes(t *testing.T) {
+	vectors := loadTestVectors(t)
+
+	identities := map[string]*DerivedIdentity{}
+	for _, v := range vectors.Tokens {
+		identity, err := ParseToken(v.Token)
+		if err != nil {
+			t.Fatalf("ParseToken failed: %v", err)
+		}
+		identities[v.Name] = identity
+	}
+
+	for _, v := range vectors.Envelopes {
+		t.Run(v.Name, func(t *testing.T) {
+			alg, _, err := DecodeBlob(v.Encoded, AlgX25519HKDF)
+			if err != nil {
+				t.Fatalf("DecodeBlob failed: %v", err)
+			}
+			if int(alg) != v.Algorithm {
+				t.Errorf("algorithm = %d, want %d", alg, v.Algorithm)
+			}
+			if got := EnvelopeVersion(v.Encoded); got != v.EnvelopeVersion {
+				t.Errorf("envelope version = %d, want %d", got, v.EnvelopeVersion)
+			}
+
+			plaintext, err := DecryptEnvelope(identities[v.Token], v.Encoded)
+			if err != nil {
+				t.Fatalf("DecryptEnvelope failed: %v", err)
+			}
+			if got := hex.EncodeToString(plaintext); got != v.Plaintext {
+				t.Errorf("plaintext = %s, want %s", got, v.Plaintext)
+			}
+		})
+	}
+}
+
+func TestVectorsConfigValues(t *testing.T) {
+	for _, v := range loadTestVectors(t).ConfigValues {
+		t.Run(v.Name, func(t *testing.T) {
+			plaintext, err := DecryptConfigValueBase64(mustHex(t, v.ProjectKey), v.Encoded)
+			if err != nil {
+				t.Fatalf("DecryptConfigValueBase64 failed: %v", err)
+			}
+			if string(plaintext) != v.Plaintext {
+				t.Errorf("plaintext = %q, want %q", plaintext, v.Plaintext)
+			}
+		})
+	}
+}
+
+func TestVectorsInvalidBlobs(t *testing.T) {
+	for _, v := range loadTestVectors(t).InvalidBlobs {
+		t.Run(v.Name, func(t *testing.T) {
+			if _, _, err := DecodeBlob(v.Encoded, AlgAESGCM); err == nil {
+				t.Error("expected DecodeBlob to fail")
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/stranavad/envie/cli/internal/api"
+)
+
+// Provider pushes environment variables to a deployment platform
+type Provider interface {
+	// Push upserts the given variables on the target and returns the number of keys written
+	Push(ctx context.Context, target api.DeploymentTarget, credentials string, vars map[string]string) (int, error)
+}
+
+// ForTarget returns the provider implementation for the target's provider name
+func ForTarget(target api.DeploymentTarget) (Provider, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	switch target.Provider {
+	case "vercel":
+		return &vercelProvider{httpClient: client, baseURL: "https://api.vercel.com"}, nil
+	case "netlify":
+		return &netlifyProvider{httpClient: client, baseURL: "https://api.netlify.com"}, nil
+	case "fly":
+		return &flyProvider{httpClient: client, baseURL: "https://api.fly.io"}, nil
+	default:
+		return nil, fmt.Errorf("unsupported deployment provider: %s", target.Provider)
+	}
+}
+
+// ApplyMapping renames and filters secrets according to the target's key mapping.
+// An empty mapping pushes every key under its original name.
+func ApplyMapping(target api.DeploymentTarget, secrets map[string]string) (map[string]string, error) {
+	if len(target.KeyMapping) == 0 {
+		result := make(map[string]string, len(secrets))
+		for k, v := range secrets {
+			result[k] = v
+		}
+		return result, nil
+	}
+
+	result := make(map[string]string, len(target.KeyMapping))
+	for _, m := range target.KeyMapping {
+		value, ok := secrets[m.Source]
+		if !ok {
+			return nil, fmt.Errorf("mapped key '%s' does not exist in project", m.Source)
+		}
+		result[m.Target] = value
+	}
+	return result, nil
+}
+
+func sortedKeys(vars map[string]string) []string {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func doJSON(ctx context.Context, client *http.Client, method, url, bearer string, body any, out any) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+bearer)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("provider returned status %d: %s", resp.StatusCode, truncate(string(respBody), 200))
+	}
+
+	if out != nil && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to decode provider response: %w", err)
+		}
+	}
+
+	return resp.StatusCode, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
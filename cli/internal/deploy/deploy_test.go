@@ -0,0 +1,63 @@
+package deploy
+
+import (
+	"testing"
+
+	"github.com/stranavad/envie/cli/internal/api"
+)
+
+func TestApplyMappingWithoutMappingCopiesAllKeys(t *testing.T) {
+	secrets := map[string]string{"A": "1", "B": "2"}
+
+	result, err := ApplyMapping(api.DeploymentTarget{}, secrets)
+	if err != nil {
+		t.Fatalf("ApplyMapping failed: %v", err)
+	}
+
+	if len(result) != 2 || result["A"] != "1" || result["B"] != "2" {
+		t.Errorf("unexpected result %v", result)
+	}
+
+	result["A"] = "changed"
+	if secrets["A"] != "1" {
+		t.Error("ApplyMapping must not alias the input map")
+	}
+}
+
+func TestApplyMappingRenamesAndFilters(t *testing.T) {
+	target := api.DeploymentTarget{KeyMapping: []api.DeploymentKeyMapping{
+		{Source: "DATABASE_URL", Target: "DB_URL"},
+	}}
+	secrets := map[string]string{"DATABASE_URL": "postgres://", "UNMAPPED": "x"}
+
+	result, err := ApplyMapping(target, secrets)
+	if err != nil {
+		t.Fatalf("ApplyMapping failed: %v", err)
+	}
+
+	if len(result) != 1 || result["DB_URL"] != "postgres://" {
+		t.Errorf("unexpected result %v", result)
+	}
+}
+
+func TestApplyMappingMissingSource(t *testing.T) {
+	target := api.DeploymentTarget{KeyMapping: []api.DeploymentKeyMapping{
+		{Source: "MISSING", Target: "X"},
+	}}
+
+	if _, err := ApplyMapping(target, map[string]string{"A": "1"}); err == nil {
+		t.Error("expected error for a mapped key that does not exist")
+	}
+}
+
+func TestForTarget(t *testing.T) {
+	for _, name := range []string{"vercel", "netlify", "fly"} {
+		if _, err := ForTarget(api.DeploymentTarget{Provider: name}); err != nil {
+			t.Errorf("ForTarget(%s) failed: %v", name, err)
+		}
+	}
+
+	if _, err := ForTarget(api.DeploymentTarget{Provider: "heroku"}); err == nil {
+		t.Error("expected error for an unsupported provider")
+	}
+}
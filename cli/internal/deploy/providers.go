@@ -0,0 +1,151 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/stranavad/envie/cli/internal/api"
+)
+
+// vercelProvider upserts project environment variables through the Vercel REST API
+type vercelProvider struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+type vercelEnvVar struct {
+	Key    string   `json:"key"`
+	Value  string   `json:"value"`
+	Type   string   `json:"type"`
+	Target []string `json:"target"`
+}
+
+func (p *vercelProvider) Push(ctx context.Context, target api.DeploymentTarget, credentials string, vars map[string]string) (int, error) {
+	environments := target.Environments
+	if len(environments) == 0 {
+		environments = []string{"production", "preview", "development"}
+	}
+
+	query := url.Values{"upsert": {"true"}}
+	if target.ExternalTeam != nil && *target.ExternalTeam != "" {
+		query.Set("teamId", *target.ExternalTeam)
+	}
+
+	body := make([]vercelEnvVar, 0, len(vars))
+	for _, key := range sortedKeys(vars) {
+		body = append(body, vercelEnvVar{
+			Key:    key,
+			Value:  vars[key],
+			Type:   "encrypted",
+			Target: environments,
+		})
+	}
+
+	endpoint := fmt.Sprintf("%s/v10/projects/%s/env?%s", p.baseURL, url.PathEscape(target.ExternalID), query.Encode())
+	if _, err := doJSON(ctx, p.httpClient, "POST", endpoint, credentials, body, nil); err != nil {
+		return 0, err
+	}
+	return len(body), nil
+}
+
+// netlifyProvider sets site environment variables through the Netlify accounts env API
+type netlifyProvider struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+type netlifyEnvValue struct {
+	Value   string `json:"value"`
+	Context string `json:"context"`
+}
+
+type netlifyEnvVar struct {
+	Key    string            `json:"key"`
+	Values []netlifyEnvValue `json:"values"`
+}
+
+func (p *netlifyProvider) Push(ctx context.Context, target api.DeploymentTarget, credentials string, vars map[string]string) (int, error) {
+	if target.ExternalTeam == nil || *target.ExternalTeam == "" {
+		return 0, fmt.Errorf("netlify targets require an account ID")
+	}
+
+	accountID := url.PathEscape(*target.ExternalTeam)
+	query := url.Values{"site_id": {target.ExternalID}}.Encode()
+
+	contexts := target.Environments
+	if len(contexts) == 0 {
+		contexts = []string{"all"}
+	}
+
+	pushed := 0
+	for _, key := range sortedKeys(vars) {
+		values := make([]netlifyEnvValue, len(contexts))
+		for i, ctxName := range contexts {
+			values[i] = netlifyEnvValue{Value: vars[key], Context: ctxName}
+		}
+
+		updateURL := fmt.Sprintf("%s/api/v1/accounts/%s/env/%s?%s", p.baseURL, accountID, url.PathEscape(key), query)
+		status, err := doJSON(ctx, p.httpClient, "PUT", updateURL, credentials, netlifyEnvVar{Key: key, Values: values}, nil)
+		if status == http.StatusNotFound {
+			createURL := fmt.Sprintf("%s/api/v1/accounts/%s/env?%s", p.baseURL, accountID, query)
+			_, err = doJSON(ctx, p.httpClient, "POST", createURL, credentials, []netlifyEnvVar{{Key: key, Values: values}}, nil)
+		}
+		if err != nil {
+			return pushed, fmt.Errorf("failed to set '%s': %w", key, err)
+		}
+		pushed++
+	}
+
+	return pushed, nil
+}
+
+// flyProvider sets app secrets through the Fly.io GraphQL API
+type flyProvider struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+const flySetSecretsMutation = `mutation($input: SetSecretsInput!) {
+  setSecrets(input: $input) { release { id } }
+}`
+
+type flySecret struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type flyGraphQLResponse struct {
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func (p *flyProvider) Push(ctx context.Context, target api.DeploymentTarget, credentials string, vars map[string]string) (int, error) {
+	secrets := make([]flySecret, 0, len(vars))
+	for _, key := range sortedKeys(vars) {
+		secrets = append(secrets, flySecret{Key: key, Value: vars[key]})
+	}
+
+	body := map[string]any{
+		"query": flySetSecretsMutation,
+		"variables": map[string]any{
+			"input": map[string]any{
+				"appId":      target.ExternalID,
+				"secrets":    secrets,
+				"replaceAll": false,
+			},
+		},
+	}
+
+	var resp flyGraphQLResponse
+	if _, err := doJSON(ctx, p.httpClient, "POST", p.baseURL+"/graphql", credentials, body, &resp); err != nil {
+		return 0, err
+	}
+	if len(resp.Errors) > 0 {
+		return 0, fmt.Errorf("fly.io error: %s", resp.Errors[0].Message)
+	}
+
+	return len(secrets), nil
+}
@@ -0,0 +1,166 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stranavad/envie/cli/internal/api"
+)
+
+type recordedRequest struct {
+	Method string
+	Path   string
+	Query  string
+	Auth   string
+	Body   []byte
+}
+
+// newRecordingServer answers each request with the next status in statuses (200 once exhausted)
+func newRecordingServer(t *testing.T, statuses []int, response string) (*httptest.Server, *[]recordedRequest) {
+	t.Helper()
+	var requests []recordedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, recordedRequest{
+			Method: r.Method,
+			Path:   r.URL.EscapedPath(),
+			Query:  r.URL.RawQuery,
+			Auth:   r.Header.Get("Authorization"),
+			Body:   body,
+		})
+		status := http.StatusOK
+		if len(statuses) > 0 {
+			status, statuses = statuses[0], statuses[1:]
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, response)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestVercelPush(t *testing.T) {
+	server, requests := newRecordingServer(t, nil, "{}")
+	provider := &vercelProvider{httpClient: server.Client(), baseURL: server.URL}
+	target := api.DeploymentTarget{ExternalID: "prj/1", ExternalTeam: strPtr("team_1"), Environments: []string{"production"}}
+
+	pushed, err := provider.Push(context.Background(), target, "tok", map[string]string{"B": "2", "A": "1"})
+	if err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if pushed != 2 || len(*requests) != 1 {
+		t.Fatalf("pushed %d keys in %d requests", pushed, len(*requests))
+	}
+
+	req := (*requests)[0]
+	if req.Method != "POST" || req.Path != "/v10/projects/prj%2F1/env" {
+		t.Errorf("unexpected request %s %s", req.Method, req.Path)
+	}
+	if req.Query != "teamId=team_1&upsert=true" {
+		t.Errorf("unexpected query %q", req.Query)
+	}
+	if req.Auth != "Bearer tok" {
+		t.Errorf("unexpected authorization %q", req.Auth)
+	}
+
+	var body []vercelEnvVar
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if len(body) != 2 || body[0].Key != "A" || body[0].Type != "encrypted" || body[0].Target[0] != "production" {
+		t.Errorf("unexpected body %s", req.Body)
+	}
+}
+
+func TestNetlifyPushCreatesMissingKeys(t *testing.T) {
+	// The first key exists and is updated; the second is missing and gets created
+	server, requests := newRecordingServer(t, []int{http.StatusOK, http.StatusNotFound, http.StatusOK}, "")
+	provider := &netlifyProvider{httpClient: server.Client(), baseURL: server.URL}
+	target := api.DeploymentTarget{ExternalID: "site-1", ExternalTeam: strPtr("acct")}
+
+	pushed, err := provider.Push(context.Background(), target, "tok", map[string]string{"A": "1", "B": "2"})
+	if err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if pushed != 2 || len(*requests) != 3 {
+		t.Fatalf("pushed %d keys in %d requests", pushed, len(*requests))
+	}
+
+	update, create := (*requests)[1], (*requests)[2]
+	if update.Method != "PUT" || update.Path != "/api/v1/accounts/acct/env/B" || update.Query != "site_id=site-1" {
+		t.Errorf("unexpected update %s %s?%s", update.Method, update.Path, update.Query)
+	}
+	if create.Method != "POST" || create.Path != "/api/v1/accounts/acct/env" {
+		t.Errorf("unexpected create %s %s", create.Method, create.Path)
+	}
+
+	var body []netlifyEnvVar
+	if err := json.Unmarshal(create.Body, &body); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if len(body) != 1 || body[0].Key != "B" || body[0].Values[0].Context != "all" || body[0].Values[0].Value != "2" {
+		t.Errorf("unexpected body %s", create.Body)
+	}
+}
+
+func TestNetlifyPushRequiresAccount(t *testing.T) {
+	provider := &netlifyProvider{httpClient: http.DefaultClient, baseURL: "http://unused"}
+	if _, err := provider.Push(context.Background(), api.DeploymentTarget{ExternalID: "site"}, "tok", map[string]string{"A": "1"}); err == nil {
+		t.Error("expected error without an account ID")
+	}
+}
+
+func TestFlyPush(t *testing.T) {
+	server, requests := newRecordingServer(t, nil, `{"data":{}}`)
+	provider := &flyProvider{httpClient: server.Client(), baseURL: server.URL}
+
+	pushed, err := provider.Push(context.Background(), api.DeploymentTarget{ExternalID: "my-app"}, "tok", map[string]string{"A": "1"})
+	if err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if pushed != 1 {
+		t.Errorf("pushed %d keys", pushed)
+	}
+
+	req := (*requests)[0]
+	if req.Method != "POST" || req.Path != "/graphql" || req.Auth != "Bearer tok" {
+		t.Errorf("unexpected request %s %s", req.Method, req.Path)
+	}
+
+	var body struct {
+		Query     string `json:"query"`
+		Variables struct {
+			Input struct {
+				AppID      string      `json:"appId"`
+				Secrets    []flySecret `json:"secrets"`
+				ReplaceAll bool        `json:"replaceAll"`
+			} `json:"input"`
+		} `json:"variables"`
+	}
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if body.Query != flySetSecretsMutation || body.Variables.Input.AppID != "my-app" || body.Variables.Input.ReplaceAll {
+		t.Errorf("unexpected body %s", req.Body)
+	}
+	if len(body.Variables.Input.Secrets) != 1 || body.Variables.Input.Secrets[0] != (flySecret{Key: "A", Value: "1"}) {
+		t.Errorf("unexpected secrets %+v", body.Variables.Input.Secrets)
+	}
+}
+
+func TestFlyPushGraphQLError(t *testing.T) {
+	server, _ := newRecordingServer(t, nil, `{"errors":[{"message":"app not found"}]}`)
+	provider := &flyProvider{httpClient: server.Client(), baseURL: server.URL}
+
+	if _, err := provider.Push(context.Background(), api.DeploymentTarget{ExternalID: "x"}, "tok", map[string]string{"A": "1"}); err == nil {
+		t.Error("expected error from GraphQL errors")
+	}
+}
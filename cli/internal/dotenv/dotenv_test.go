@@ -0,0 +1,42 @@
+package dotenv
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	data := []byte(`# comment
+PORT=8080
+export HOST=localhost
+EMPTY=
+QUOTED="line one\nsays \"hi\" # not a comment"
+SINGLE='$raw \n'
+INLINE=value # comment
+PORT=9090
+`)
+	want := map[string]string{
+		"PORT":   "9090",
+		"HOST":   "localhost",
+		"EMPTY":  "",
+		"QUOTED": "line one\nsays \"hi\" # not a comment",
+		"SINGLE": `$raw \n`,
+		"INLINE": "value",
+	}
+
+	got, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %q, want %q", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, data := range []string{"NOVALUE", "=value", "BAD KEY=1", `OPEN="unterminated`, "OPEN='x"} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("Parse(%q) succeeded", data)
+		}
+	}
+}
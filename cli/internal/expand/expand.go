@@ -0,0 +1,95 @@
+// Package expand resolves ${KEY} references between config values, such as a
+// DATABASE_URL composed from DB_HOST and DB_PASSWORD
+package expand
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Expand returns values with the ${KEY} references in the values named in refs
+// replaced by the value of KEY, itself expanded when it is in refs. $${ is a
+// literal ${. Values not in refs are returned as they are, so a value that only
+// happens to contain ${ is left alone.
+//
+// Referencing a key that doesn't exist or a cycle of references is an error.
+func Expand(values map[string]string, refs map[string]bool) (map[string]string, error) {
+	e := expander{values: values, refs: refs, done: map[string]string{}, visiting: map[string]bool{}}
+
+	expanded := make(map[string]string, len(values))
+	for name, value := range values {
+		if !refs[name] {
+			expanded[name] = value
+			continue
+		}
+		resolved, err := e.resolve(name, nil)
+		if err != nil {
+			return nil, err
+		}
+		expanded[name] = resolved
+	}
+	return expanded, nil
+}
+
+type expander struct {
+	values   map[string]string
+	refs     map[string]bool
+	done     map[string]string
+	visiting map[string]bool
+}
+
+// resolve expands the value of name. path is the chain of references leading to
+// it, for the error on a cycle.
+func (e *expander) resolve(name string, path []string) (string, error) {
+	if value, ok := e.done[name]; ok {
+		return value, nil
+	}
+	path = append(path, name)
+	if e.visiting[name] {
+		return "", fmt.Errorf("reference cycle: %s", strings.Join(path, " -> "))
+	}
+
+	value, ok := e.values[name]
+	if !ok {
+		return "", fmt.Errorf("%s references %s, which is not in the config", path[len(path)-2], name)
+	}
+	if !e.refs[name] {
+		return value, nil
+	}
+
+	e.visiting[name] = true
+	defer delete(e.visiting, name)
+
+	var sb strings.Builder
+	for {
+		i := strings.Index(value, "${")
+		if i < 0 {
+			sb.WriteString(value)
+			break
+		}
+		if i > 0 && value[i-1] == '$' {
+			sb.WriteString(value[:i-1] + "${")
+			value = value[i+2:]
+			continue
+		}
+		end := strings.IndexByte(value[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("%s has an unterminated ${ reference", name)
+		}
+
+		sb.WriteString(value[:i])
+		key := value[i+2 : i+end]
+		if key == "" {
+			return "", fmt.Errorf("%s has an empty ${} reference", name)
+		}
+		resolved, err := e.resolve(key, path)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(resolved)
+		value = value[i+end+1:]
+	}
+
+	e.done[name] = sb.String()
+	return e.done[name], nil
+}
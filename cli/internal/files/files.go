@@ -0,0 +1,130 @@
+// Package files encrypts and decrypts project files the way the desktop app
+// does: each file has its own AES-256-GCM key (the FEK), stored encrypted with
+// the project key like a config value.
+package files
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/stranavad/envie/cli/internal/api"
+	"github.com/stranavad/envie/cli/internal/crypto"
+)
+
+const fekSize = 32
+
+// Encrypted is a file encrypted for upload
+type Encrypted struct {
+	Data         []byte // iv (12) || ciphertext+tag
+	EncryptedFEK string
+	Checksum     string // hex SHA-256 of the plaintext
+}
+
+// Checksum returns the hex SHA-256 of data, as stored with files
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Encrypt encrypts plaintext with a new FEK and encrypts the FEK with the
+// project key
+func Encrypt(projectKey, plaintext []byte) (*Encrypted, error) {
+	provider := crypto.CurrentProvider()
+
+	fek := make([]byte, fekSize)
+	iv := make([]byte, crypto.IVSize)
+	if err := provider.Random(fek); err != nil {
+		return nil, fmt.Errorf("failed to generate file key: %w", err)
+	}
+	if err := provider.Random(iv); err != nil {
+		return nil, fmt.Errorf("failed to generate IV: %w", err)
+	}
+
+	ciphertext, err := provider.SealAESGCM(fek, iv, plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt file: %w", err)
+	}
+
+	// The app encrypts the base64 of the FEK, not the raw key
+	encryptedFEK, err := crypto.EncryptConfigValueBase64(projectKey, []byte(base64.StdEncoding.EncodeToString(fek)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt file key: %w", err)
+	}
+
+	return &Encrypted{
+		Data:         append(iv, ciphertext...),
+		EncryptedFEK: encryptedFEK,
+		Checksum:     Checksum(plaintext),
+	}, nil
+}
+
+// Decrypt decrypts a downloaded file and checks it against its checksum, if it
+// has one
+func Decrypt(projectKey []byte, download *api.FileDownload) ([]byte, error) {
+	encrypted, err := base64.StdEncoding.DecodeString(download.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode file: %w", err)
+	}
+
+	encodedFEK, err := crypto.DecryptConfigValueBase64(projectKey, download.EncryptedFEK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt file key: %w", err)
+	}
+	fek, err := base64.StdEncoding.DecodeString(string(encodedFEK))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode file key: %w", err)
+	}
+
+	if len(encrypted) < crypto.IVSize+16 {
+		return nil, fmt.Errorf("encrypted file too short: %d bytes", len(encrypted))
+	}
+	plaintext, err := crypto.CurrentProvider().OpenAESGCM(fek, encrypted[:crypto.IVSize], encrypted[crypto.IVSize:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt file: %w", err)
+	}
+
+	if download.Checksum != "" && Checksum(plaintext) != download.Checksum {
+		return nil, fmt.Errorf("checksum mismatch: the file was corrupted or tampered with")
+	}
+	return plaintext, nil
+}
+
+// Path returns the folder/name path of a file
+func Path(file api.ProjectFile) string {
+	if file.Folder == "" {
+		return file.Name
+	}
+	return file.Folder + "/" + file.Name
+}
+
+// Find returns the file ref names: its ID, its folder/name path, or its bare
+// name when only one file has it
+func Find(list []api.ProjectFile, ref string) (*api.ProjectFile, error) {
+	ref = strings.Trim(ref, "/")
+	var byName []*api.ProjectFile
+	for i := range list {
+		file := &list[i]
+		if file.ID == ref || Path(*file) == ref {
+			return file, nil
+		}
+		if file.Name == ref {
+			byName = append(byName, file)
+		}
+	}
+
+	switch len(byName) {
+	case 0:
+		return nil, fmt.Errorf("no file %s in the project", ref)
+	case 1:
+		return byName[0], nil
+	}
+	paths := make([]string, len(byName))
+	for i, file := range byName {
+		paths[i] = Path(*file)
+	}
+	return nil, fmt.Errorf("%d files are named %s, give the folder: %s", len(byName), path.Base(ref), strings.Join(paths, ", "))
+}
@@ -0,0 +1,73 @@
+package files
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stranavad/envie/cli/internal/api"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	projectKey := bytes.Repeat([]byte{7}, 32)
+	plaintext := []byte("-----BEGIN CERTIFICATE-----\nMIIB...\n")
+
+	encrypted, err := Encrypt(projectKey, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(encrypted.Data, plaintext) {
+		t.Error("encrypted data contains the plaintext")
+	}
+
+	download := &api.FileDownload{
+		Data:         base64.StdEncoding.EncodeToString(encrypted.Data),
+		EncryptedFEK: encrypted.EncryptedFEK,
+		Checksum:     encrypted.Checksum,
+	}
+	got, err := Decrypt(projectKey, download)
+	if err != nil || !bytes.Equal(got, plaintext) {
+		t.Fatalf("Decrypt() = %q, %v", got, err)
+	}
+
+	download.Checksum = Checksum([]byte("something else"))
+	if _, err := Decrypt(projectKey, download); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("checksum mismatch: err = %v", err)
+	}
+
+	if _, err := Decrypt(bytes.Repeat([]byte{8}, 32), download); err == nil {
+		t.Error("decrypted with the wrong project key")
+	}
+}
+
+func TestFind(t *testing.T) {
+	list := []api.ProjectFile{
+		{ID: "1", Name: "ca.pem", Folder: "certs/prod"},
+		{ID: "2", Name: "ca.pem", Folder: "certs/staging"},
+		{ID: "3", Name: "app.keytab"},
+	}
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"certs/prod/ca.pem", "1"},
+		{"/certs/staging/ca.pem", "2"},
+		{"app.keytab", "3"},
+		{"3", "3"},
+	}
+	for _, tt := range tests {
+		file, err := Find(list, tt.ref)
+		if err != nil || file.ID != tt.want {
+			t.Errorf("Find(%q) = %v, %v, want %s", tt.ref, file, err, tt.want)
+		}
+	}
+
+	if _, err := Find(list, "ca.pem"); err == nil || !strings.Contains(err.Error(), "certs/prod/ca.pem, certs/staging/ca.pem") {
+		t.Errorf("ambiguous name: err = %v", err)
+	}
+	if _, err := Find(list, "missing.pem"); err == nil {
+		t.Error("missing file found")
+	}
+}
@@ -0,0 +1,91 @@
+// Package merge combines the config of several projects into one set of
+// variables, such as organization-wide shared values and a service's own
+package merge
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Policies decide which project wins when several define a key with different
+// values
+const (
+	Last  = "last"  // the project listed later wins
+	First = "first" // the project listed first wins
+	Error = "error" // the merge fails
+)
+
+// Source is the decrypted config of one project
+type Source struct {
+	Project string
+	Values  map[string]string
+}
+
+// Conflict is a key that several projects define with different values
+type Conflict struct {
+	Key        string
+	Winner     string   // project whose value was kept
+	Overridden []string // projects whose values were dropped, in order
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s from %s overrides %v", c.Key, c.Winner, c.Overridden)
+}
+
+// Result is the merged config
+type Result struct {
+	Values    map[string]string
+	From      map[string]int // index of the source each key was taken from
+	Conflicts []Conflict     // sorted by key
+}
+
+// Merge combines the sources in order. Keys defined with the same value in
+// several sources aren't conflicts; the first of them is reported in From.
+func Merge(sources []Source, policy string) (*Result, error) {
+	if policy != Last && policy != First && policy != Error {
+		return nil, fmt.Errorf("unknown merge policy: %s (use last, first or error)", policy)
+	}
+
+	result := &Result{Values: map[string]string{}, From: map[string]int{}}
+	definedBy := map[string][]int{} // sources defining each key with a differing value
+	for i, source := range sources {
+		for key, value := range source.Values {
+			current, ok := result.Values[key]
+			switch {
+			case !ok:
+				result.Values[key], result.From[key] = value, i
+				definedBy[key] = []int{i}
+			case current == value:
+			default:
+				definedBy[key] = append(definedBy[key], i)
+				if policy == Last {
+					result.Values[key], result.From[key] = value, i
+				}
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(definedBy))
+	for key, indexes := range definedBy {
+		if len(indexes) > 1 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		conflict := Conflict{Key: key, Winner: sources[result.From[key]].Project}
+		for _, i := range definedBy[key] {
+			if i != result.From[key] {
+				conflict.Overridden = append(conflict.Overridden, sources[i].Project)
+			}
+		}
+		result.Conflicts = append(result.Conflicts, conflict)
+	}
+
+	if policy == Error && len(result.Conflicts) > 0 {
+		return nil, fmt.Errorf("%d key(s) defined differently in several projects, first %s in %s and %s",
+			len(result.Conflicts), keys[0], result.Conflicts[0].Winner, result.Conflicts[0].Overridden[0])
+	}
+	return result, nil
+}
@@ -0,0 +1,46 @@
+package merge
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	sources := []Source{
+		{"shared", map[string]string{"LOG_LEVEL": "info", "SENTRY_DSN": "https://sentry", "REGION": "eu"}},
+		{"api", map[string]string{"LOG_LEVEL": "debug", "PORT": "8080", "REGION": "eu"}},
+	}
+
+	tests := []struct {
+		policy    string
+		logLevel  string
+		from      int
+		conflicts []Conflict
+	}{
+		{Last, "debug", 1, []Conflict{{"LOG_LEVEL", "api", []string{"shared"}}}},
+		{First, "info", 0, []Conflict{{"LOG_LEVEL", "shared", []string{"api"}}}},
+	}
+	for _, tt := range tests {
+		result, err := Merge(sources, tt.policy)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.policy, err)
+		}
+		if len(result.Values) != 4 || result.Values["LOG_LEVEL"] != tt.logLevel || result.From["LOG_LEVEL"] != tt.from {
+			t.Errorf("%s: values = %v, from = %v", tt.policy, result.Values, result.From)
+		}
+		// The same value in both projects isn't a conflict
+		if result.From["REGION"] != 0 || !reflect.DeepEqual(result.Conflicts, tt.conflicts) {
+			t.Errorf("%s: conflicts = %+v, want %+v", tt.policy, result.Conflicts, tt.conflicts)
+		}
+	}
+
+	if _, err := Merge(sources, Error); err == nil {
+		t.Error("conflicting merge with the error policy succeeded")
+	}
+	if _, err := Merge(sources[:1], Error); err != nil {
+		t.Errorf("single source with the error policy: %v", err)
+	}
+	if _, err := Merge(sources, "random"); err == nil {
+		t.Error("unknown policy accepted")
+	}
+}
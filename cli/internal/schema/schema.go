@@ -0,0 +1,118 @@
+// Package schema checks config values against the variables a project requires
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+
+	"github.com/stranavad/envie/cli/internal/api"
+)
+
+// Problem kinds
+const (
+	Missing = "missing"
+	Empty   = "empty"
+	Type    = "type"
+	Pattern = "pattern"
+)
+
+// Problem is a required variable that a source doesn't satisfy
+type Problem struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+// Report is the outcome of checking one source of values, such as the project
+// config or a local .env file
+type Report struct {
+	Source    string    `json:"source"`
+	Checked   int       `json:"checked"`
+	Unchecked []string  `json:"unchecked,omitempty"` // present, but the value couldn't be read
+	Problems  []Problem `json:"problems"`
+}
+
+// OK reports whether every required variable is satisfied
+func (r Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Check verifies that values defines every variable of the schema with a
+// non-empty value of the right type that matches its pattern. Names in masked
+// are present but unreadable, so only their presence is checked.
+func Check(source string, variables []api.SchemaVariable, values map[string]string, masked []string) Report {
+	report := Report{Source: source, Checked: len(variables), Problems: []Problem{}}
+	isMasked := make(map[string]bool, len(masked))
+	for _, name := range masked {
+		isMasked[name] = true
+	}
+
+	for _, variable := range variables {
+		if isMasked[variable.Name] {
+			report.Unchecked = append(report.Unchecked, variable.Name)
+			continue
+		}
+		value, ok := values[variable.Name]
+		if !ok {
+			report.Problems = append(report.Problems, Problem{variable.Name, Missing, "not defined"})
+			continue
+		}
+		if value == "" {
+			report.Problems = append(report.Problems, Problem{variable.Name, Empty, "defined but empty"})
+			continue
+		}
+		if err := CheckType(variable.Type, value); err != nil {
+			report.Problems = append(report.Problems, Problem{variable.Name, Type, err.Error()})
+			continue
+		}
+		if variable.Pattern != nil {
+			if err := checkPattern(*variable.Pattern, value); err != nil {
+				report.Problems = append(report.Problems, Problem{variable.Name, Pattern, err.Error()})
+			}
+		}
+	}
+	return report
+}
+
+// numberPattern is a JSON number, so typed exports can emit it as is
+var numberPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// CheckType verifies that value is valid for a schema variable or config item
+// value type. Unknown types and string accept anything.
+func CheckType(kind, value string) error {
+	switch kind {
+	case "number":
+		if !numberPattern.MatchString(value) {
+			return fmt.Errorf("not a number")
+		}
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("not a boolean")
+		}
+	case "url":
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("not an absolute URL")
+		}
+	case "json":
+		if !json.Valid([]byte(value)) {
+			return fmt.Errorf("not valid JSON")
+		}
+	}
+	return nil
+}
+
+// checkPattern matches the whole value. The value is left out of the error, as it
+// may be a secret.
+func checkPattern(pattern, value string) error {
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	if !re.MatchString(value) {
+		return fmt.Errorf("does not match %q", pattern)
+	}
+	return nil
+}
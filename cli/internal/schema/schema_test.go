@@ -0,0 +1,74 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stranavad/envie/cli/internal/api"
+)
+
+func TestCheck(t *testing.T) {
+	pattern := `[a-z]+-\d+`
+	variables := []api.SchemaVariable{
+		{Name: "DATABASE_URL", Type: "url"},
+		{Name: "PORT", Type: "number"},
+		{Name: "DEBUG", Type: "boolean"},
+		{Name: "FEATURES", Type: "json"},
+		{Name: "RELEASE", Type: "string", Pattern: &pattern},
+		{Name: "API_KEY", Type: "string"},
+		{Name: "SECRET", Type: "string"},
+		{Name: "NAME", Type: "string"},
+	}
+	values := map[string]string{
+		"DATABASE_URL": "localhost:5432",
+		"PORT":         "8080",
+		"DEBUG":        "maybe",
+		"FEATURES":     `{"beta":true}`,
+		"RELEASE":      "v-12x",
+		"API_KEY":      "",
+		"EXTRA":        "ignored",
+	}
+
+	report := Check("project", variables, values, []string{"SECRET"})
+	want := []Problem{
+		{"DATABASE_URL", Type, "not an absolute URL"},
+		{"DEBUG", Type, "not a boolean"},
+		{"RELEASE", Pattern, `does not match "[a-z]+-\\d+"`},
+		{"API_KEY", Empty, "defined but empty"},
+		{"NAME", Missing, "not defined"},
+	}
+	if !reflect.DeepEqual(report.Problems, want) {
+		t.Errorf("problems = %+v\nwant %+v", report.Problems, want)
+	}
+	if report.OK() || report.Checked != len(variables) || !reflect.DeepEqual(report.Unchecked, []string{"SECRET"}) {
+		t.Errorf("report = %+v", report)
+	}
+
+	if ok := Check("project", variables[:2], map[string]string{"DATABASE_URL": "postgres://db/app", "PORT": "1"}, nil); !ok.OK() {
+		t.Errorf("valid values reported %+v", ok.Problems)
+	}
+}
+
+func TestCheckType(t *testing.T) {
+	tests := []struct {
+		kind, value string
+		valid       bool
+	}{
+		{"number", "-12.5e3", true},
+		{"number", "0x10", false},
+		{"number", "NaN", false},
+		{"number", "012", false},
+		{"boolean", "false", true},
+		{"boolean", "yes", false},
+		{"url", "https://example.com/path", true},
+		{"url", "/relative", false},
+		{"json", `[1, {"a": null}]`, true},
+		{"json", "{", false},
+		{"string", "anything", true},
+	}
+	for _, tt := range tests {
+		if err := CheckType(tt.kind, tt.value); (err == nil) != tt.valid {
+			t.Errorf("CheckType(%s, %q) = %v, want valid %v", tt.kind, tt.value, err, tt.valid)
+		}
+	}
+}
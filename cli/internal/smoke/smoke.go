@@ -0,0 +1,231 @@
+package smoke
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/stranavad/envie/cli/internal/api"
+	"github.com/stranavad/envie/cli/internal/crypto"
+)
+
+// CanaryKey is the config item the write check rewrites. The server only lets a
+// CLI token write this item, and only when it was created in the app.
+const CanaryKey = "ENVIE_SMOKE_CANARY"
+
+// Client is the part of the API client the smoke test exercises
+type Client interface {
+	VerifyIdentity() (*api.IdentityInfo, error)
+	GetConfigChecksum(projectID string) (*api.ConfigChecksumResponse, error)
+	GetProjectConfig(projectID string) (*api.ProjectConfigResponse, error)
+	WriteCanary(projectID, encryptedValue string) (*api.ConfigChecksumResponse, error)
+}
+
+// Step is the outcome of one check
+type Step struct {
+	Name     string
+	Detail   string
+	Duration time.Duration
+	Err      error
+}
+
+// Options select the optional checks
+type Options struct {
+	// Write rewrites CanaryKey with a random value and reads it back
+	Write bool
+}
+
+// check runs one step and returns a short description of what it saw
+type check struct {
+	name string
+	run  func() (string, error)
+}
+
+// Run checks the path a deploy takes through the service: verify the token, read
+// the checksum, fetch and decrypt the config and compare its checksum, then
+// optionally round trip a write. Every step is passed to report as it finishes;
+// Run stops at the first failure and returns its error.
+func Run(client Client, identity *crypto.DerivedIdentity, project string, opts Options, report func(Step)) error {
+	var (
+		info       *api.IdentityInfo
+		checksum   *api.ConfigChecksumResponse
+		config     *api.ProjectConfigResponse
+		projectKey []byte
+	)
+
+	steps := []check{
+		{"verify", func() (string, error) {
+			var err error
+			if info, err = client.VerifyIdentity(); err != nil {
+				return "", err
+			}
+			if project != info.ProjectID && project != info.ProjectSlug && project != info.ProjectName {
+				return "", fmt.Errorf("token belongs to project %s, not %s", info.ProjectName, project)
+			}
+			return fmt.Sprintf("token %q for project %s", info.TokenName, info.ProjectName), nil
+		}},
+		{"checksum", func() (string, error) {
+			var err error
+			if checksum, err = client.GetConfigChecksum(info.ProjectID); err != nil {
+				return "", err
+			}
+			return shortChecksum(checksum.ConfigChecksum), nil
+		}},
+		{"fetch", func() (string, error) {
+			var err error
+			if config, err = client.GetProjectConfig(info.ProjectID); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d items", len(config.Items)), nil
+		}},
+		{"decrypt", func() (string, error) {
+			var err error
+			if projectKey, _, err = decryptConfig(identity, config); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d values", len(config.Items)), nil
+		}},
+		{"compare", func() (string, error) {
+			if err := compareChecksums(config, checksum.ConfigChecksum); err != nil {
+				return "", err
+			}
+			return "checksums match", nil
+		}},
+	}
+	if opts.Write {
+		steps = append(steps, check{"write-read", func() (string, error) {
+			return writeRead(client, identity, info.ProjectID, projectKey)
+		}})
+	}
+
+	for _, step := range steps {
+		start := time.Now()
+		detail, err := step.run()
+		report(Step{Name: step.name, Detail: detail, Duration: time.Since(start), Err: err})
+		if err != nil {
+			return fmt.Errorf("%s failed: %w", step.name, err)
+		}
+	}
+	return nil
+}
+
+// writeRead stores a fresh random canary value, fetches the config again and
+// checks the value decrypts to what was written
+func writeRead(client Client, identity *crypto.DerivedIdentity, projectID string, projectKey []byte) (string, error) {
+	random := make([]byte, 16)
+	if err := crypto.CurrentProvider().Random(random); err != nil {
+		return "", err
+	}
+	value := fmt.Sprintf("smoke-%d-%s", time.Now().Unix(), hex.EncodeToString(random))
+
+	encrypted, err := crypto.EncryptConfigValueBase64(projectKey, []byte(value))
+	if err != nil {
+		return "", err
+	}
+	if _, err := client.WriteCanary(projectID, encrypted); err != nil {
+		return "", fmt.Errorf("write: %w", err)
+	}
+
+	config, err := client.GetProjectConfig(projectID)
+	if err != nil {
+		return "", fmt.Errorf("read back: %w", err)
+	}
+	_, values, err := decryptConfig(identity, config)
+	if err != nil {
+		return "", fmt.Errorf("read back: %w", err)
+	}
+	if got, ok := values[CanaryKey]; !ok {
+		return "", fmt.Errorf("%s is missing after the write", CanaryKey)
+	} else if got != value {
+		return "", fmt.Errorf("%s reads back a different value than was written", CanaryKey)
+	}
+	if err := compareChecksums(config, config.ConfigChecksum); err != nil {
+		return "", fmt.Errorf("read back: %w", err)
+	}
+	return "canary round trip", nil
+}
+
+func decryptConfig(identity *crypto.DerivedIdentity, config *api.ProjectConfigResponse) ([]byte, map[string]string, error) {
+	projectKey, err := crypto.DecryptEnvelope(identity, config.EncryptedProjectKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("project key: %w", err)
+	}
+	values := make(map[string]string, len(config.Items))
+	for _, item := range config.Items {
+		if item.Masked {
+			return nil, nil, fmt.Errorf("'%s': sensitive value withheld, the token lacks the secrets.reveal scope", item.Name)
+		}
+		plaintext, err := crypto.DecryptConfigValueBase64(projectKey, item.EncryptedValue)
+		if err != nil {
+			return nil, nil, fmt.Errorf("'%s': %w", item.Name, err)
+		}
+		values[item.Name] = string(plaintext)
+	}
+	return projectKey, values, nil
+}
+
+// compareChecksums checks the fetched items against the checksum reported with
+// them and the one read separately. A project whose config was never saved has no
+// checksum.
+func compareChecksums(config *api.ProjectConfigResponse, recorded string) error {
+	computed := ConfigChecksum(config.Items)
+	if config.ChecksumVersion < 2 {
+		computed = LegacyConfigChecksum(config.Items)
+	}
+	if recorded == "" && config.ConfigChecksum == "" && len(config.Items) == 0 {
+		return nil
+	}
+	if config.ConfigChecksum != computed {
+		return fmt.Errorf("fetched items hash to %s, the response reports %s", shortChecksum(computed), shortChecksum(config.ConfigChecksum))
+	}
+	if recorded != computed {
+		return fmt.Errorf("fetched items hash to %s, the checksum endpoint reports %s", shortChecksum(computed), shortChecksum(recorded))
+	}
+	return nil
+}
+
+// ConfigChecksum computes the server's config checksum in version 2: SHA-256 over
+// a tag, the item count, then each item's name and encrypted value in position
+// order, the count and each field prefixed with its length as a big-endian uint64
+func ConfigChecksum(items []api.ConfigItem) string {
+	hash := sha256.New()
+	var length [8]byte
+	write := func(field string) {
+		binary.BigEndian.PutUint64(length[:], uint64(len(field)))
+		hash.Write(length[:])
+		hash.Write([]byte(field))
+	}
+
+	hash.Write([]byte("envie-config-checksum-v2"))
+	binary.BigEndian.PutUint64(length[:], uint64(len(items)))
+	hash.Write(length[:])
+	for _, item := range items {
+		write(item.Name)
+		write(item.EncryptedValue)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// LegacyConfigChecksum computes the config checksum of servers before version 2:
+// SHA-256 over "name=encryptedValue" lines in position order
+func LegacyConfigChecksum(items []api.ConfigItem) string {
+	lines := make([]string, len(items))
+	for i, item := range items {
+		lines[i] = item.Name + "=" + item.EncryptedValue
+	}
+	hash := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(hash[:])
+}
+
+func shortChecksum(checksum string) string {
+	if checksum == "" {
+		return "(none)"
+	}
+	if len(checksum) > 12 {
+		return checksum[:12]
+	}
+	return checksum
+}
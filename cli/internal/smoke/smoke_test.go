@@ -0,0 +1,192 @@
+package smoke
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stranavad/envie/cli/internal/api"
+	"github.com/stranavad/envie/cli/internal/crypto"
+)
+
+// fakeClient serves a project from memory the way the server does, including the
+// checksum bookkeeping on canary writes
+type fakeClient struct {
+	t          *testing.T
+	projectKey []byte
+	config     api.ProjectConfigResponse
+
+	verifyErr     error
+	staleChecksum bool // the checksum endpoint lags behind the config
+	dropWrites    bool // canary writes succeed but are lost
+}
+
+func newFakeClient(t *testing.T, identity *crypto.DerivedIdentity, values map[string]string) *fakeClient {
+	projectKey := []byte("0123456789abcdef0123456789abcdef")
+	encryptedKey, err := crypto.EncryptEnvelope(identity, crypto.EnvelopeV2, projectKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeClient{t: t, projectKey: projectKey, config: api.ProjectConfigResponse{
+		ProjectID:           "p1",
+		ProjectName:         "monitoring",
+		EncryptedProjectKey: encryptedKey,
+		ChecksumVersion:     2,
+	}}
+	for _, name := range []string{"DATABASE_URL", CanaryKey} {
+		if value, ok := values[name]; ok {
+			f.config.Items = append(f.config.Items, api.ConfigItem{Name: name, EncryptedValue: f.encrypt(value)})
+		}
+	}
+	f.config.ConfigChecksum = ConfigChecksum(f.config.Items)
+	return f
+}
+
+func (f *fakeClient) encrypt(value string) string {
+	encrypted, err := crypto.EncryptConfigValueBase64(f.projectKey, []byte(value))
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return encrypted
+}
+
+func (f *fakeClient) VerifyIdentity() (*api.IdentityInfo, error) {
+	if f.verifyErr != nil {
+		return nil, f.verifyErr
+	}
+	return &api.IdentityInfo{TokenName: "monitor", ProjectID: "p1", ProjectName: "monitoring"}, nil
+}
+
+func (f *fakeClient) GetConfigChecksum(projectID string) (*api.ConfigChecksumResponse, error) {
+	checksum := f.config.ConfigChecksum
+	if f.staleChecksum {
+		checksum = strings.Repeat("0", 64)
+	}
+	return &api.ConfigChecksumResponse{ProjectID: projectID, ConfigChecksum: checksum}, nil
+}
+
+func (f *fakeClient) GetProjectConfig(projectID string) (*api.ProjectConfigResponse, error) {
+	config := f.config
+	config.Items = append([]api.ConfigItem(nil), f.config.Items...)
+	return &config, nil
+}
+
+func (f *fakeClient) WriteCanary(projectID, encryptedValue string) (*api.ConfigChecksumResponse, error) {
+	for i, item := range f.config.Items {
+		if item.Name != CanaryKey {
+			continue
+		}
+		if !f.dropWrites {
+			f.config.Items[i].EncryptedValue = encryptedValue
+			f.config.ConfigChecksum = ConfigChecksum(f.config.Items)
+		}
+		return &api.ConfigChecksumResponse{ProjectID: projectID, ConfigChecksum: f.config.ConfigChecksum}, nil
+	}
+	return nil, errors.New("Create the ENVIE_SMOKE_CANARY config item in the app to enable write checks (status 404)")
+}
+
+func runSmoke(t *testing.T, client *fakeClient, identity *crypto.DerivedIdentity, project string, opts Options) ([]Step, error) {
+	var steps []Step
+	err := Run(client, identity, project, opts, func(step Step) { steps = append(steps, step) })
+	return steps, err
+}
+
+func TestRun(t *testing.T) {
+	_, identity, err := crypto.GenerateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]string{"DATABASE_URL": "postgres://db", CanaryKey: "initial"}
+
+	tests := []struct {
+		name      string
+		project   string
+		opts      Options
+		setup     func(*fakeClient)
+		steps     int
+		failsWith string
+	}{
+		{"read only", "monitoring", Options{}, nil, 5, ""},
+		{"by project ID", "p1", Options{}, nil, 5, ""},
+		{"with write", "p1", Options{Write: true}, nil, 6, ""},
+		{"wrong project", "other", Options{}, nil, 1, "verify failed"},
+		{"server down", "p1", Options{}, func(f *fakeClient) { f.verifyErr = errors.New("request failed") }, 1, "verify failed"},
+		{"stale checksum", "p1", Options{}, func(f *fakeClient) { f.staleChecksum = true }, 5, "compare failed"},
+		{"corrupted value", "p1", Options{}, func(f *fakeClient) {
+			f.config.Items[0].EncryptedValue = f.config.Items[1].EncryptedValue[:20]
+			f.config.ConfigChecksum = ConfigChecksum(f.config.Items)
+		}, 4, "decrypt failed"},
+		{"lost write", "p1", Options{Write: true}, func(f *fakeClient) { f.dropWrites = true }, 6, "write-read failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeClient(t, identity, values)
+			if tt.setup != nil {
+				tt.setup(client)
+			}
+
+			steps, err := runSmoke(t, client, identity, tt.project, tt.opts)
+			if len(steps) != tt.steps {
+				t.Errorf("ran %d steps, want %d", len(steps), tt.steps)
+			}
+			if tt.failsWith == "" {
+				if err != nil {
+					t.Fatalf("Run failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.failsWith) {
+				t.Fatalf("err = %v, want %q", err, tt.failsWith)
+			}
+			if last := steps[len(steps)-1]; last.Err == nil {
+				t.Errorf("failed step %q reported no error", last.Name)
+			}
+		})
+	}
+}
+
+func TestRunWriteRequiresCanary(t *testing.T) {
+	_, identity, err := crypto.GenerateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newFakeClient(t, identity, map[string]string{"DATABASE_URL": "postgres://db"})
+
+	if _, err := runSmoke(t, client, identity, "p1", Options{Write: true}); err == nil || !strings.Contains(err.Error(), CanaryKey) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestRunEmptyProject(t *testing.T) {
+	_, identity, err := crypto.GenerateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newFakeClient(t, identity, nil)
+	client.config.ConfigChecksum = ""
+
+	if _, err := runSmoke(t, client, identity, "p1", Options{}); err != nil {
+		t.Errorf("Run failed on a project without config: %v", err)
+	}
+}
+
+func TestConfigChecksumSeparatesFields(t *testing.T) {
+	// The same name=value lines, split differently across items
+	one := []api.ConfigItem{{Name: "A", EncryptedValue: "x\nB=y"}}
+	two := []api.ConfigItem{{Name: "A", EncryptedValue: "x"}, {Name: "B", EncryptedValue: "y"}}
+	if LegacyConfigChecksum(one) != LegacyConfigChecksum(two) {
+		t.Fatal("legacy checksums differ, the test no longer covers the ambiguity")
+	}
+	if ConfigChecksum(one) == ConfigChecksum(two) {
+		t.Error("version 2 checksums of different configs match")
+	}
+}
+
+func TestConfigChecksumMatchesServer(t *testing.T) {
+	items := []api.ConfigItem{{Name: "A", EncryptedValue: "x"}, {Name: "B", EncryptedValue: "y\nz"}}
+	if got, want := ConfigChecksum(items), "4c4820abcea6b7725146144d70c1ca12edef93776f5d5ee7b484290ab41fc561"; got != want {
+		t.Errorf("ConfigChecksum = %s, want the server's %s", got, want)
+	}
+}
@@ -1,11 +1,41 @@
 import { EncryptionService } from '@/services/encryption.service';
-import { ProjectService, type ConfigItem } from '@/services/project.service';
+import { ProjectService, type ConfigItem, type ConfigValueType } from '@/services/project.service';
 
 /**
  * Composable for encrypting and decrypting config items.
  * Centralizes the common patterns used across the app for handling
  * project configuration encryption/decryption.
  */
+/**
+ * Check a plain value against its value type. Returns an error message, or null
+ * when the value is valid. The server can't see values, so every client runs this
+ * before encrypting.
+ */
+export function validateConfigValue(valueType: ConfigValueType | undefined, value: string): string | null {
+    switch (valueType) {
+        case 'number':
+            return /^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$/.test(value) ? null : 'must be a number';
+        case 'boolean':
+            return ['true', 'false', '1', '0'].includes(value.toLowerCase()) ? null : 'must be true or false';
+        case 'url':
+            try {
+                const url = new URL(value);
+                return url.host ? null : 'must be an absolute URL';
+            } catch {
+                return 'must be an absolute URL';
+            }
+        case 'json':
+            try {
+                JSON.parse(value);
+                return null;
+            } catch {
+                return 'must be valid JSON';
+            }
+        default:
+            return null;
+    }
+}
+
 export function useConfigEncryption() {
     /**
      * Decrypt a single config item value
@@ -30,7 +60,8 @@ export function useConfigEncryption() {
     /**
      * Decrypt all config items in place.
      * Returns a new array with decrypted values.
-     * Items that fail to decrypt will have value set to '[DECRYPTION FAILED]'
+     * Items that fail to decrypt will have value set to '[DECRYPTION FAILED]'.
+     * Masked items have no value to decrypt and keep an empty one.
      */
     async function decryptConfigItems(
         projectKey: string,
@@ -39,6 +70,10 @@ export function useConfigEncryption() {
         const decryptedItems: ConfigItem[] = [];
 
         for (const item of items) {
+            if (item.masked) {
+                decryptedItems.push({ ...item, value: '' });
+                continue;
+            }
             try {
                 const decryptedValue = await EncryptionService.decryptValue(projectKey, item.value);
                 decryptedItems.push({ ...item, value: decryptedValue });
@@ -53,17 +88,31 @@ export function useConfigEncryption() {
 
     /**
      * Encrypt all config items.
-     * Returns a new array with encrypted values.
+     * Returns a new array with encrypted values. Masked items left empty are
+     * sent as they are so the backend keeps their stored value.
+     * Throws when a value doesn't match its value type.
      */
     async function encryptConfigItems(
         projectKey: string,
         items: ConfigItem[]
     ): Promise<ConfigItem[]> {
+        for (const item of items) {
+            const error = item.masked && item.value === '' ? null : validateConfigValue(item.valueType, item.value);
+            if (error) {
+                throw new Error(`${item.name} ${error}`);
+            }
+        }
         return await Promise.all(
-            items.map(async (item) => ({
-                ...item,
-                value: await EncryptionService.encryptValue(projectKey, item.value),
-            }))
+            items.map(async (item) => {
+                if (item.masked && item.value === '') {
+                    return item;
+                }
+                return {
+                    ...item,
+                    masked: false,
+                    value: await EncryptionService.encryptValue(projectKey, item.value),
+                };
+            })
         );
     }
 
@@ -1,4 +1,9 @@
+// const backendUrl = 'http://localhost:8080';
+const backendUrl = 'https://api.envie.sh';
+
 export const config = {
-    // backendUrl: 'http://localhost:8080'
-    backendUrl: 'https://api.envie.sh'
+    backendUrl,
+    // Versioned application API. The public auth flows (login, callback, exchange,
+    // refresh) stay on backendUrl; logout is authenticated and lives under /v1.
+    apiUrl: `${backendUrl}/v1`,
 };
@@ -55,7 +55,7 @@ export const api = {
             headers['Content-Type'] = 'application/json';
         }
 
-        const response = await fetch(`${config.backendUrl}${endpoint}`, {
+        const response = await fetch(`${config.apiUrl}${endpoint}`, {
             ...options,
             headers
         });
@@ -66,7 +66,7 @@ export const api = {
                 const newToken = authStore.accessToken;
                 headers['Authorization'] = `Bearer ${newToken}`;
 
-                return fetch(`${config.backendUrl}${endpoint}`, {
+                return fetch(`${config.apiUrl}${endpoint}`, {
                     ...options,
                     headers
                 });
@@ -109,6 +109,17 @@ export const api = {
         return response.json();
     },
 
+    async patch<T>(endpoint: string, data?: unknown): Promise<T> {
+        const response = await this.fetch(endpoint, {
+            method: 'PATCH',
+            body: data ? JSON.stringify(data) : undefined
+        });
+        if (!response.ok) {
+            await handleErrorResponse(response);
+        }
+        return response.json();
+    },
+
     async delete(endpoint: string): Promise<void> {
         const response = await this.fetch(endpoint, {
             method: 'DELETE'
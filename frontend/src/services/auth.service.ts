@@ -80,15 +80,19 @@ export class AuthService {
         return response.json();
     }
 
-    static async logout(accessToken: string): Promise<void> {
-        await fetch(`${config.backendUrl}/auth/logout`, {
+    static async logout(accessToken: string, refreshToken?: string): Promise<void> {
+        await fetch(`${config.apiUrl}/auth/logout`, {
             method: 'POST',
-            headers: { 'Authorization': `Bearer ${accessToken}` },
+            headers: {
+                'Authorization': `Bearer ${accessToken}`,
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ refreshToken }),
         });
     }
 
     static async getCurrentUser(accessToken: string): Promise<User> {
-        const response = await fetch(`${config.backendUrl}/me`, {
+        const response = await fetch(`${config.apiUrl}/me`, {
             headers: { 'Authorization': `Bearer ${accessToken}` },
         });
 
@@ -100,7 +104,7 @@ export class AuthService {
     }
 
     static async updatePublicKey(accessToken: string, publicKey: string): Promise<{publicKey: string}> {
-        const response = await fetch(`${config.backendUrl}/me/public-key`, {
+        const response = await fetch(`${config.apiUrl}/me/public-key`, {
             method: 'PUT',
             headers: {
                 'Authorization': `Bearer ${accessToken}`,
@@ -120,7 +124,7 @@ export class AuthService {
         accessToken: string,
         request: RotateMasterKeyRequest
     ): Promise<RotateMasterKeyResponse> {
-        const response = await fetch(`${config.backendUrl}/me/rotate-master-key`, {
+        const response = await fetch(`${config.apiUrl}/me/rotate-master-key`, {
             method: 'POST',
             headers: {
                 'Authorization': `Bearer ${accessToken}`,
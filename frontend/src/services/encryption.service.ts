@@ -1,6 +1,7 @@
 import {x25519} from '@noble/curves/ed25519.js';
 import {sha256} from "@noble/hashes/sha2.js";
 import {hkdf} from "@noble/hashes/hkdf.js";
+import {ml_kem768} from "@noble/post-quantum/ml-kem.js";
 
 
 export interface KeyPair {
@@ -32,6 +33,37 @@ function concatBytes(...arrays: Uint8Array[]): Uint8Array {
     return result;
 }
 
+/**
+ * Versioned blob format: "$" + base64(algorithm (1 byte) || body).
+ * "$" is not in the base64 alphabet, so blobs written before the format existed
+ * (plain base64) are still recognised; their algorithm follows from where they are stored.
+ * Must match Algorithm in backend/internal/crypto and cli/internal/crypto.
+ */
+export const Algorithm = {
+    AesGcm: 0x01,          // iv (12) || ciphertext+tag
+    X25519Hkdf: 0x02,      // ephemeral pub (32) || iv (12) || ciphertext+tag, HKDF "envie-encrypt"
+    X25519MlKem768: 0x03,  // ephemeral pub (32) || ML-KEM-768 ciphertext (1088) || iv (12) || ciphertext+tag, wrapped for the CLI only
+    X25519Sha256: 0x04,    // ephemeral pub (32) || iv (12) || ciphertext+tag, key = SHA-256(shared secret)
+} as const;
+
+export type Algorithm = typeof Algorithm[keyof typeof Algorithm];
+
+const VERSIONED_BLOB_PREFIX = '$';
+
+function encodeBlob(algorithm: Algorithm, body: Uint8Array): string {
+    return VERSIONED_BLOB_PREFIX + bytesToBase64(concatBytes(new Uint8Array([algorithm]), body));
+}
+
+function decodeBlob(encoded: string, legacy: Algorithm): { algorithm: number; body: Uint8Array } {
+    if (!encoded.startsWith(VERSIONED_BLOB_PREFIX)) {
+        return { algorithm: legacy, body: base64ToBytes(encoded) };
+    }
+
+    const data = base64ToBytes(encoded.slice(VERSIONED_BLOB_PREFIX.length));
+    if (data.length === 0) throw new Error("Empty encrypted blob");
+    return { algorithm: data[0], body: data.slice(1) };
+}
+
 export class EncryptionService {
     /**
      * Generate key pair (public + private) for user encryption (asymmetric)
@@ -82,14 +114,15 @@ export class EncryptionService {
         const ciphertext = new Uint8Array(ciphertextBuffer);
         const combined = concatBytes(iv, ciphertext);
 
-        return bytesToBase64(combined);
+        return encodeBlob(Algorithm.AesGcm, combined);
     }
 
     static async decryptValue(keyB64: string, combinedB64: string): Promise<string> {
         const keyBytes = base64ToBytes(keyB64);
         if (keyBytes.length !== 32) throw new Error("Invalid key length");
 
-        const combined = base64ToBytes(combinedB64);
+        const { algorithm, body: combined } = decodeBlob(combinedB64, Algorithm.AesGcm);
+        if (algorithm !== Algorithm.AesGcm) throw new Error(`Unsupported value algorithm ${algorithm}`);
         if (combined.length < 12) throw new Error("Ciphertext too short");
 
         const iv = combined.slice(0, 12);
@@ -152,12 +185,15 @@ export class EncryptionService {
         const ciphertext = new Uint8Array(ciphertextBuffer);
 
         const combined = concatBytes(ephemeralPub, iv, ciphertext);
-        return bytesToBase64(combined);
+        return encodeBlob(Algorithm.X25519Sha256, combined);
     }
 
     static async decryptKey(privateKeyB64: string, encryptedDataB64: string): Promise<string> {
         const privKey = base64ToBytes(privateKeyB64);
-        const combined = base64ToBytes(encryptedDataB64);
+        const { algorithm, body: combined } = decodeBlob(encryptedDataB64, Algorithm.X25519Sha256);
+        if (algorithm !== Algorithm.X25519Sha256 && algorithm !== Algorithm.X25519Hkdf) {
+            throw new Error(`Unsupported key algorithm ${algorithm}`);
+        }
 
         if (combined.length < 32 + 12) throw new Error("Data too short");
 
@@ -168,7 +204,9 @@ export class EncryptionService {
         const sharedSecret = x25519.getSharedSecret(privKey, ephemeralPub);
 
         // 2. Derive Key
-        const derivedKeyBytes = sha256(sharedSecret);
+        const derivedKeyBytes = algorithm === Algorithm.X25519Hkdf
+            ? hkdf(sha256, sharedSecret, undefined, new TextEncoder().encode('envie-encrypt'), 32)
+            : sha256(sharedSecret);
 
         // 3. Decrypt
         const key = await crypto.subtle.importKey(
@@ -201,9 +239,12 @@ export class EncryptionService {
     }
 
     /**
-     * Generate a CLI access token with derived cryptographic material
+     * Generate a CLI access token with derived cryptographic material.
+     * With hybrid set, the project key is wrapped in a v2 envelope (X25519 + ML-KEM-768)
+     * so it stays confidential even if X25519 is broken later; only CLIs that
+     * advertise envelope version 2 can use such a token.
      */
-    static async generateAccessToken(projectKeyB64: string): Promise<GeneratedAccessToken> {
+    static async generateAccessToken(projectKeyB64: string, options: { hybrid?: boolean } = {}): Promise<GeneratedAccessToken> {
         const tokenBytes = crypto.getRandomValues(new Uint8Array(32));
         const encoder = new TextEncoder();
 
@@ -224,6 +265,20 @@ export class EncryptionService {
         // Derive public key
         const publicKey = x25519.getPublicKey(privateKey);
 
+        if (options.hybrid) {
+            // Derive the ML-KEM-768 key pair from a 64 byte seed, matching the CLI
+            const kemSeed = hkdf(sha256, tokenBytes, undefined, encoder.encode('envie-mlkem-seed'), 64);
+            const kemPublicKey = ml_kem768.keygen(kemSeed).publicKey;
+
+            return {
+                token,
+                tokenPrefix,
+                identityIdHash,
+                encryptedProjectKey: await this.encryptKeyToHybridPublicKey(publicKey, kemPublicKey, projectKeyB64),
+                envelopeVersion: EnvelopeVersion.V2,
+            };
+        }
+
         // Encrypt project key to the token's public key
         const encryptedProjectKey = await this.encryptKeyToPublicKey(publicKey, projectKeyB64);
 
@@ -232,6 +287,7 @@ export class EncryptionService {
             tokenPrefix,
             identityIdHash,
             encryptedProjectKey,
+            envelopeVersion: EnvelopeVersion.V1,
         };
     }
 
@@ -253,15 +309,53 @@ export class EncryptionService {
         const ciphertext = new Uint8Array(ciphertextBuffer);
 
         const combined = concatBytes(ephemeralPub, iv, ciphertext);
-        return bytesToBase64(combined);
+        return encodeBlob(Algorithm.X25519Hkdf, combined);
+    }
+
+    /**
+     * Wrap a key in a v2 envelope. The AES key is HKDF("envie-encrypt-v2") over
+     * kemShared || dhShared || ephemeralPub || recipientPub, matching the CLI's deriveHybridKey.
+     */
+    private static async encryptKeyToHybridPublicKey(publicKey: Uint8Array, kemPublicKey: Uint8Array, keyB64: string): Promise<string> {
+        const payload = base64ToBytes(keyB64);
+        const encoder = new TextEncoder();
+
+        const ephemeralPriv = x25519.utils.randomSecretKey();
+        const ephemeralPub = x25519.getPublicKey(ephemeralPriv);
+        const dhShared = x25519.getSharedSecret(ephemeralPriv, publicKey);
+
+        const { cipherText: kemCiphertext, sharedSecret: kemShared } = ml_kem768.encapsulate(kemPublicKey);
+
+        const ikm = concatBytes(kemShared, dhShared, ephemeralPub, publicKey);
+        const derivedKey = hkdf(sha256, ikm, undefined, encoder.encode('envie-encrypt-v2'), 32);
+
+        const key = await crypto.subtle.importKey('raw', derivedKey, 'AES-GCM', false, ['encrypt']);
+        const iv = crypto.getRandomValues(new Uint8Array(12));
+        const ciphertextBuffer = await crypto.subtle.encrypt({ name: 'AES-GCM', iv }, key, payload);
+        const ciphertext = new Uint8Array(ciphertextBuffer);
+
+        const combined = concatBytes(ephemeralPub, kemCiphertext, iv, ciphertext);
+        return encodeBlob(Algorithm.X25519MlKem768, combined);
     }
 }
 
+/**
+ * Envelope versions for keys wrapped to a token. Must match EnvelopeV1/EnvelopeV2
+ * in backend/internal/crypto and cli/internal/crypto.
+ */
+export const EnvelopeVersion = {
+    V1: 1, // X25519
+    V2: 2, // hybrid X25519 + ML-KEM-768
+} as const;
+
+export type EnvelopeVersion = typeof EnvelopeVersion[keyof typeof EnvelopeVersion];
+
 export interface GeneratedAccessToken {
     token: string;
     tokenPrefix: string;
     identityIdHash: string;
     encryptedProjectKey: string;
+    envelopeVersion: EnvelopeVersion;
 }
 
 function bytesToBase64Url(bytes: Uint8Array): string {
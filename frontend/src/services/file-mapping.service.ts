@@ -23,6 +23,8 @@ export interface FileMapping {
     filePath: string;
     lastLocalChecksum: string;
     lastRemoteChecksum: string;
+    // Format of lastLocalChecksum; mappings saved before versions have version 1
+    checksumVersion?: number;
     linkedAt: string;
     devicePublicKey: string;
 }
@@ -44,6 +46,15 @@ export interface SyncStatusResult {
 
 const STORE_NAME = 'file-mappings.json';
 
+// Format of the local file checksums, see computeChecksum
+const CHECKSUM_VERSION = 2;
+
+function uint64(n: number): Uint8Array {
+    const view = new DataView(new ArrayBuffer(8));
+    view.setBigUint64(0, BigInt(n));
+    return new Uint8Array(view.buffer);
+}
+
 export class FileMappingService {
     private static store: Store | null = null;
 
@@ -86,6 +97,7 @@ export class FileMappingService {
             filePath,
             lastLocalChecksum: localChecksum,
             lastRemoteChecksum: remoteChecksum,
+            checksumVersion: CHECKSUM_VERSION,
             linkedAt: new Date().toISOString(),
             devicePublicKey,
         };
@@ -141,9 +153,11 @@ export class FileMappingService {
     }
 
     /**
-     * Check the sync status of a linked project
+     * Check the sync status of a linked project. legacyRemoteChecksum is the
+     * server's version 1 checksum of the same config, which mappings saved before
+     * the server moved to version 2 recorded.
      */
-    static async checkSyncStatus(projectId: string, currentRemoteChecksum: string): Promise<SyncStatusResult> {
+    static async checkSyncStatus(projectId: string, currentRemoteChecksum: string, legacyRemoteChecksum = ''): Promise<SyncStatusResult> {
         const mapping = await this.getMapping(projectId);
 
         if (!mapping) {
@@ -162,9 +176,13 @@ export class FileMappingService {
         // Read current local file and compute checksum
         const content = await readTextFile(mapping.filePath);
         const currentLocalChecksum = await this.computeLocalFileChecksum(content);
+        const recordedLocalChecksum = mapping.checksumVersion === CHECKSUM_VERSION
+            ? currentLocalChecksum
+            : await this.computeLocalFileChecksum(content, mapping.checksumVersion ?? 1);
 
-        const localChanged = currentLocalChecksum !== mapping.lastLocalChecksum;
-        const remoteChanged = currentRemoteChecksum !== mapping.lastRemoteChecksum;
+        const localChanged = recordedLocalChecksum !== mapping.lastLocalChecksum;
+        const remoteChanged = currentRemoteChecksum !== mapping.lastRemoteChecksum &&
+            !(legacyRemoteChecksum && legacyRemoteChecksum === mapping.lastRemoteChecksum);
 
         let status: SyncStatus;
         if (localChanged && remoteChanged) {
@@ -199,6 +217,7 @@ export class FileMappingService {
             ...mapping,
             lastLocalChecksum: localChecksum,
             lastRemoteChecksum: remoteChecksum,
+            checksumVersion: CHECKSUM_VERSION,
         };
 
         const key = this.getMappingKey(projectId);
@@ -270,19 +289,36 @@ export class FileMappingService {
     }
 
     /**
-     * Compute SHA256 checksum from config items (matches backend algorithm)
+     * Compute SHA256 checksum from config items, serialized as the backend's config
+     * checksum: a tag, the item count, then each name and value prefixed with its
+     * length, so a value containing a newline can't pass for two items. Version 1
+     * joined name=value lines with newlines.
      */
-    static async computeChecksum(items: ConfigItem[]): Promise<string> {
+    static async computeChecksum(items: ConfigItem[], version = CHECKSUM_VERSION): Promise<string> {
         // Sort by position
         const sortedItems = [...items].sort((a, b) => a.position - b.position);
 
-        // Build string: name=value joined by newlines
-        const lines = sortedItems.map(item => `${item.name}=${item.value}`);
-        const content = lines.join('\n');
+        const encoder = new TextEncoder();
+        let data: Uint8Array;
+        if (version === 1) {
+            data = encoder.encode(sortedItems.map(item => `${item.name}=${item.value}`).join('\n'));
+        } else {
+            const parts = [encoder.encode('envie-config-checksum-v2'), uint64(sortedItems.length)];
+            for (const item of sortedItems) {
+                for (const field of [item.name, item.value]) {
+                    const bytes = encoder.encode(field);
+                    parts.push(uint64(bytes.length), bytes);
+                }
+            }
+            data = new Uint8Array(parts.reduce((length, part) => length + part.length, 0));
+            let offset = 0;
+            for (const part of parts) {
+                data.set(part, offset);
+                offset += part.length;
+            }
+        }
 
         // Compute SHA256
-        const encoder = new TextEncoder();
-        const data = encoder.encode(content);
         const hashBuffer = await crypto.subtle.digest('SHA-256', data);
         const hashArray = Array.from(new Uint8Array(hashBuffer));
         return hashArray.map(b => b.toString(16).padStart(2, '0')).join('');
@@ -291,7 +327,7 @@ export class FileMappingService {
     /**
      * Compute checksum from raw .env file content
      */
-    static async computeLocalFileChecksum(content: string): Promise<string> {
+    static async computeLocalFileChecksum(content: string, version = CHECKSUM_VERSION): Promise<string> {
         const items = this.parseEnvContent(content);
         // Convert to ConfigItem-like format with positions
         const configItems = items.map((item, index) => ({
@@ -302,6 +338,6 @@ export class FileMappingService {
             position: index,
         })) as ConfigItem[];
 
-        return this.computeChecksum(configItems);
+        return this.computeChecksum(configItems, version);
     }
 }
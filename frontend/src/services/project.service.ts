@@ -1,6 +1,14 @@
 import { api } from './api';
 import {Team} from "@/services/team.service.ts";
 
+export interface ProjectCapabilities {
+    canManageTokens: boolean;
+    canManageFiles: boolean;
+    canInitiateRotation: boolean;
+    canManageTeams: boolean;
+    canManageSecretManagers: boolean;
+}
+
 export interface ProjectShort {
     id: string;
     name: string;
@@ -8,6 +16,8 @@ export interface ProjectShort {
     organizationName: string;
     keyVersion: number;
     configChecksum?: string;
+    legacyConfigChecksum?: string;
+    capabilities: ProjectCapabilities;
     createdAt: string;
     updatedAt: string;
 }
@@ -42,8 +52,10 @@ export interface ProjectDetail {
     orgRole?: string;
     canEdit: boolean;
     canDelete: boolean;
+    capabilities: ProjectCapabilities;
     keyVersion: number;
     configChecksum?: string;
+    legacyConfigChecksum?: string;
 }
 
 export interface CreateProjectRequest {
@@ -95,6 +107,7 @@ export interface AddTeamToProjectRequest {
 export interface ProjectFile {
     id: string;
     name: string;
+    folder: string; // slash-separated path, '' for the top level
     sizeBytes: number;
     mimeType: string;
     encryptedFek: string;
@@ -110,12 +123,19 @@ export interface ProjectFile {
 export interface UploadFileRequest {
     file: File;
     name: string;
+    folder?: string;
     encryptedFek: string;
     checksum: string;
     mimeType: string;
     originalSize: number;
 }
 
+export interface FileFolder {
+    path: string;
+    fileCount: number;
+    sizeBytes: number;
+}
+
 export interface DownloadFileResponse {
     data: string; // base64 encoded
     encryptedFek: string;
@@ -146,6 +166,7 @@ export interface CreateProjectTokenRequest {
     tokenPrefix: string;
     identityIdHash: string;
     encryptedProjectKey: string;
+    envelopeVersion?: number; // 1 = X25519 (default), 2 = hybrid X25519 + ML-KEM-768
 }
 
 export class ProjectService {
@@ -169,8 +190,8 @@ export class ProjectService {
         await api.put(`/projects/${id}`, { name });
     }
 
-    static async deleteProject(id: string): Promise<void> {
-        await api.delete(`/projects/${id}`);
+    static async deleteProject(id: string, force = false): Promise<void> {
+        await api.delete(`/projects/${id}${force ? '?force=true' : ''}`);
     }
 
     static async getConfig(projectId: string): Promise<ConfigItem[]> {
@@ -201,6 +222,9 @@ export class ProjectService {
         formData.append('checksum', request.checksum);
         formData.append('mimeType', request.mimeType);
         formData.append('originalSize', request.originalSize.toString());
+        if (request.folder) {
+            formData.append('folder', request.folder);
+        }
 
         return api.postFormData<{ id: string; name: string; sizeBytes: number }>(`/projects/${projectId}/files`, formData);
     }
@@ -209,6 +233,18 @@ export class ProjectService {
         return api.get<DownloadFileResponse>(`/projects/${projectId}/files/${fileId}`);
     }
 
+    static async getFileFolders(projectId: string): Promise<FileFolder[]> {
+        return api.get<FileFolder[]>(`/projects/${projectId}/files/folders`);
+    }
+
+    static async updateFile(projectId: string, fileId: string, request: { name?: string; folder?: string }): Promise<void> {
+        await api.patch(`/projects/${projectId}/files/${fileId}`, request);
+    }
+
+    static async moveFileFolder(projectId: string, from: string, to: string): Promise<{ message: string; count: number }> {
+        return api.post<{ message: string; count: number }>(`/projects/${projectId}/files/folders/move`, { from, to });
+    }
+
     static async deleteFile(projectId: string, fileId: string): Promise<void> {
         await api.delete(`/projects/${projectId}/files/${fileId}`);
     }
@@ -230,13 +266,22 @@ export class ProjectService {
     }
 }
 
+// How clients read a config value; the server only stores it
+export type ConfigValueType = 'string' | 'number' | 'boolean' | 'url' | 'json';
+
 export interface ConfigItem {
     id: string;
     projectId: string;
     name: string;
     value: string;
     sensitive: boolean;
+    // Value withheld because the project restricts sensitive values; saving it
+    // unchanged keeps the stored value
+    masked?: boolean;
     position: number;
+    valueType?: ConfigValueType; // 'string' when omitted
+    // The value contains ${KEY} references to other items, expanded by the CLI
+    hasReferences?: boolean;
     category?: string;
     description?: string;
     expiresAt?: string;
@@ -222,11 +222,14 @@ export const useAuthStore = defineStore('auth', () => {
         try {
             if (accessToken.value) {
                 // Try to revoke tokens on backend
-                await fetch(`${config.backendUrl}/auth/logout`, {
+                const refreshToken = await useVaultStore().getRefreshToken();
+                await fetch(`${config.apiUrl}/auth/logout`, {
                     method: 'POST',
                     headers: {
-                        'Authorization': `Bearer ${accessToken.value}`
-                    }
+                        'Authorization': `Bearer ${accessToken.value}`,
+                        'Content-Type': 'application/json',
+                    },
+                    body: JSON.stringify({ refreshToken }),
                 });
             }
         } catch (e) {
@@ -262,7 +265,7 @@ export const useAuthStore = defineStore('auth', () => {
         if (!validToken) return;
 
         try {
-            const response = await fetch(`${config.backendUrl}/me`, {
+            const response = await fetch(`${config.apiUrl}/me`, {
                 headers: {
                     'Authorization': `Bearer ${validToken}`
                 }
@@ -394,7 +397,7 @@ export const useAuthStore = defineStore('auth', () => {
 
         // Legacy: try as direct JWT token (for backwards compatibility during transition)
         try {
-            const response = await fetch(`${config.backendUrl}/me`, {
+            const response = await fetch(`${config.apiUrl}/me`, {
                 headers: {
                     'Authorization': `Bearer ${linkingCode}`
                 }